@@ -0,0 +1,14 @@
+// mm-network-analyzer collects data about the machine it is running on and
+// its network connection to help diagnose routing, DNS, and other issues to
+// MaxMind servers.
+package main
+
+import (
+	"os"
+
+	"github.com/maxmind/mm-network-analyzer/pkg/analyzer"
+)
+
+func main() {
+	os.Exit(analyzer.Main(os.Args[1:]))
+}
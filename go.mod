@@ -1,5 +1,17 @@
 module github.com/maxmind/mm-network-analyzer
 
-go 1.15
+go 1.25.0
 
-require github.com/pkg/errors v0.9.1
+require (
+	filippo.io/age v1.2.1
+	github.com/BurntSushi/toml v1.6.0
+	github.com/miekg/dns v1.1.73
+	github.com/pkg/errors v0.9.1
+	github.com/quic-go/quic-go v0.61.0
+	golang.org/x/crypto v0.54.0
+	golang.org/x/net v0.57.0
+	golang.org/x/sys v0.47.0
+	golang.org/x/term v0.45.0
+)
+
+require golang.org/x/text v0.40.0 // indirect
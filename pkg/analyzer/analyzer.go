@@ -0,0 +1,885 @@
+// Package analyzer collects data about the machine it is running on and its
+// network connection to help diagnose routing, DNS, and other issues to
+// MaxMind servers. Main implements the mm-network-analyzer command, and
+// Collector lets other programs run the collection with their own tasks.
+package analyzer
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultHost   = "geoip.maxmind.com"
+	archivePrefix = "mm-network-analysis"
+)
+
+type analyzer struct {
+	archive ArchiveWriter
+	// redactor is nil unless --redact was given.
+	redactor *redactor
+	// progress reports the progress of the run. It may be nil.
+	progress *progress
+	// retryPolicy controls the retrying of network operations.
+	retryPolicy retryPolicy
+	// credentials is nil unless --account-id was given.
+	credentials *credentials
+	// runGeoIPUpdate is true if --geoipupdate was given.
+	runGeoIPUpdate bool
+	// hosts are the hosts given with --host.
+	hosts []string
+	// httpSamples is the number of requests the HTTPS latency task makes.
+	httpSamples int
+	// pingCount and pingInterval set the probe train of the ping tasks.
+	pingCount    int
+	pingInterval time.Duration
+	// tracerouteCycles is the number of rounds of probes each traceroute
+	// sends.
+	tracerouteCycles int
+	// maxTaskOutput is the most output a task may store in a file. Zero
+	// means no limit.
+	maxTaskOutput int64
+	// reference is the support ticket or other reference given with
+	// --reference.
+	reference string
+	// dial restricts and binds the connections the tasks make.
+	dial *dialConfig
+	// rdapURL is the base URL of the RDAP lookup. Empty means
+	// defaultRDAPURL.
+	rdapURL string
+	// downloadBaseURL is where the databases are downloaded from. Empty
+	// means defaultDownloadBaseURL.
+	downloadBaseURL string
+
+	// We use mutexes as it is a bit easier to handle writing
+	// in the main go routine
+	errorsMutex sync.Mutex
+	errors      []*taskError
+
+	filesMutex sync.Mutex
+	files      []*storedFile
+	// spoolDir holds the stored files too large to keep in memory. It is
+	// created by spool when first needed.
+	spoolOnce sync.Once
+	spoolDir  string
+	spoolErr  error
+
+	resultsMutex sync.Mutex
+	results      map[string]interface{}
+	// timedOut and interrupted hold the names of the tasks that were
+	// cancelled before they finished. They are guarded by resultsMutex.
+	timedOut    []string
+	interrupted []string
+	// taskRecords describe the tasks that were run for manifest.json. They
+	// are guarded by resultsMutex.
+	taskRecords []*taskRecord
+	// runStarted and runFinished are when runTasks started and returned.
+	runStarted  time.Time
+	runFinished time.Time
+}
+
+// Main runs the mm-network-analyzer command with args, which exclude the
+// program name, and returns the exit code.
+func Main(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "compare":
+			return runCompare(args[1:])
+		case "monitor":
+			return runMonitor(args[1:])
+		case "update":
+			return runUpdate(args[1:])
+		}
+	}
+	return run(args)
+}
+
+// run collects the diagnostic information and returns the exit code.
+func run(args []string) int {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	var hosts stringSliceFlag
+	fs.Var(
+		&hosts,
+		"host",
+		"Host to diagnose. May be repeated or comma separated. (default "+defaultHost+")",
+	)
+	var only, skip stringSliceFlag
+	fs.Var(&only, "only", "Only run tasks with these names or tags. May be repeated or comma separated.")
+	fs.Var(&skip, "skip", "Skip tasks with these names or tags. May be repeated or comma separated.")
+	configPath := fs.String("config", "", "Path to a TOML file defining additional tasks or disabling built-in ones")
+	var extraCmds repeatedFlag
+	fs.Var(
+		&extraCmds,
+		"extra-cmd",
+		`Also run a command and store its output in name.txt, given as "name=command args...". May be repeated.`,
+	)
+	pluginsDir := fs.String(
+		"plugins-dir",
+		"",
+		"Run each executable in this directory as a task, storing its standard output",
+	)
+	output := fs.String(
+		"output",
+		"",
+		"Path to write the archive to (default "+archivePrefix+"-<UTC timestamp>.<format>)",
+	)
+	format := fs.String("format", FormatZip, "Archive format: "+FormatZip+" or "+FormatTarGz)
+	compressionLevel := fs.Int(
+		"compression-level",
+		flate.DefaultCompression,
+		"Compression level from 0, which stores the files uncompressed, to 9, or -1 for the default",
+	)
+	storeCompressed := fs.Bool(
+		"store-compressed",
+		false,
+		"Store packet captures and compressed files in zip archives without compressing them again",
+	)
+	maxTaskOutput := byteSize(defaultMaxTaskOutput)
+	fs.Var(
+		&maxTaskOutput,
+		"max-task-output",
+		"Keep only the start and end of a task's output beyond this size, or 0 for no limit",
+	)
+	var maxArchiveSize byteSize
+	fs.Var(
+		&maxArchiveSize,
+		"max-archive-size",
+		"Split the archive into numbered parts of at most this size, e.g., 25MB",
+	)
+	var encryptTo stringSliceFlag
+	fs.Var(&encryptTo, "encrypt-to", "Encrypt the archive to this age public key. May be repeated.")
+	encryptPassphrase := fs.Bool(
+		"encrypt-passphrase",
+		false,
+		"Encrypt the archive with a passphrase read from "+passphraseEnv+" or the terminal",
+	)
+	redact := fs.Bool(
+		"redact",
+		false,
+		"Remove private IP addresses, host names, user names, and MAC addresses from the output",
+	)
+	parallelism := fs.Int("parallelism", defaultParallelism, "Number of tasks to run at once")
+	retries := fs.Int("retries", defaultRetries, "Number of times to retry a network operation that fails")
+	retryBackoff := fs.Duration(
+		"retry-backoff",
+		defaultRetryBackoff,
+		"Delay before the first retry, doubling for each subsequent retry",
+	)
+	httpSamples := fs.Int(
+		"http-samples",
+		defaultHTTPSamples,
+		"Number of HTTPS requests to make to each host to measure the latency distribution",
+	)
+	pingCount := fs.Int("ping-count", defaultPingCount, "Number of ICMP echo requests to send to each host")
+	pingInterval := fs.Duration("ping-interval", defaultPingInterval, "Interval between ICMP echo requests")
+	tracerouteCycles := fs.Int(
+		"traceroute-cycles",
+		defaultTracerouteCycles,
+		"Number of rounds of probes each traceroute sends, one per second",
+	)
+	taskTimeout := fs.Duration(
+		"task-timeout",
+		defaultTaskTimeout,
+		"Cancel any task that runs for longer than this",
+	)
+	maxDuration := fs.Duration(
+		"max-duration",
+		0,
+		"Cancel any tasks still running after this long and write the archive with what was collected",
+	)
+	schedule := fs.String(
+		"schedule",
+		"",
+		"Run a collection each time this cron expression matches, e.g., \"0 */6 * * *\", until interrupted",
+	)
+	scheduleKeep := fs.Int(
+		"schedule-keep",
+		defaultScheduleKeep,
+		"Number of archives to keep with --schedule. Older ones are removed.",
+	)
+	review := fs.Bool(
+		"review",
+		false,
+		"Review the collected files and choose which to drop before writing the archive",
+	)
+	upload := fs.Bool("upload", false, "Upload the archive to MaxMind support when done")
+	uploadURL := fs.String(
+		"upload-url",
+		"",
+		"URL to upload the archive to with --upload, as given by MaxMind support",
+	)
+	uploadTo := fs.String(
+		"upload-to",
+		"",
+		"Object storage or SFTP URL to upload the archive to "+
+			"(s3://bucket/key, gs://bucket/key, az://account/container/key, or sftp://user@host/path)",
+	)
+	accountID := fs.String(
+		"account-id",
+		"",
+		"MaxMind account ID to check the GeoIP web service with. The license key is read from "+licenseKeyEnv+
+			" or the terminal.",
+	)
+	runGeoIPUpdate := fs.Bool(
+		"geoipupdate",
+		false,
+		"Run geoipupdate verbosely with a temporary database directory to test database updates",
+	)
+	ipv4 := fs.Bool("ipv4", false, "Only connect over IPv4 and skip the IPv6 tasks")
+	ipv6 := fs.Bool("ipv6", false, "Only connect over IPv6 and skip the IPv4 tasks")
+	iface := fs.String("interface", "", "Send every probe from this network interface")
+	sourceIPFlag := fs.String(
+		"source-ip",
+		"",
+		"Send every probe from this local address. This implies --ipv4 or --ipv6 for its family.",
+	)
+	pcap := fs.Bool(
+		"pcap",
+		false,
+		"Capture packets to and from the hosts with tcpdump while the tasks run and include the capture",
+	)
+	notifyURL := fs.String(
+		"notify-url",
+		"",
+		"POST a JSON summary of the findings and errors to this webhook URL when the run finishes",
+	)
+	reference := fs.String(
+		"reference",
+		"",
+		"Support ticket or other reference, e.g., TICKET-1234, to include in the archive name, manifest, and upload",
+	)
+	fs.StringVar(reference, "ticket", "", "Alias for --reference")
+	var emailTo repeatedFlag
+	fs.Var(
+		&emailTo,
+		"email-to",
+		"Email the archive, or a link to it if it is too large and was uploaded, to this address. May be repeated.",
+	)
+	emailInsecure := fs.Bool(
+		"email-insecure",
+		false,
+		"Send --email-to messages unencrypted if the SMTP server does not offer STARTTLS",
+	)
+	listTasks := fs.Bool("list-tasks", false, "List the tasks that would be run and exit")
+	printVersion := fs.Bool("version", false, "Print the version and exit")
+	failOnProblems := fs.Bool(
+		"fail-on-problems",
+		false,
+		"Exit with status 4 if a problem with the error severity is found",
+	)
+	verbose := fs.Bool("verbose", false, "Log each task and error as it happens instead of showing progress")
+	quiet := fs.Bool("quiet", false, "Only log errors")
+	logFormat := fs.String("log-format", logFormatText, "Log format: "+logFormatText+" or "+logFormatJSON)
+	_ = fs.Parse(args)
+
+	if *printVersion {
+		fmt.Println(currentBuild())
+		return exitOK
+	}
+
+	runLog := &syncBuffer{}
+	logger, err := newLogger(os.Stderr, runLog, logLevel(*verbose, *quiet), *logFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+	if len(hosts) == 0 {
+		hosts = stringSliceFlag{defaultHost}
+	}
+
+	if *schedule != "" {
+		if *output != "" {
+			fatal(errors.New("--output may not be used with --schedule, as each archive needs its own name"))
+		}
+		if err := readScheduledSecrets(*accountID, encryptTo, *encryptPassphrase); err != nil {
+			fatal(err)
+		}
+		encrypted := len(encryptTo) > 0 || *encryptPassphrase
+		return runSchedule(fs, *schedule, *scheduleKeep, func(t time.Time) string {
+			return defaultArchivePath(t, *format, *reference, encrypted)
+		})
+	}
+
+	var conf *config
+	if *configPath != "" {
+		conf, err = loadConfig(*configPath)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	var email *emailSettings
+	if len(emailTo) > 0 {
+		var emailConf *emailConfig
+		if conf != nil {
+			emailConf = conf.Email
+		}
+		email, err = newEmailSettings(emailConf, emailTo, *emailInsecure)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	a := &analyzer{retryPolicy: retryPolicy{retries: *retries, backoff: *retryBackoff}}
+	defer a.removeSpool()
+	a.credentials, err = readCredentials(*accountID)
+	if err != nil {
+		fatal(err)
+	}
+	a.runGeoIPUpdate = *runGeoIPUpdate
+	a.hosts = hosts
+	a.httpSamples = *httpSamples
+	a.pingCount = *pingCount
+	a.pingInterval = *pingInterval
+	if a.pingCount < 1 || a.pingInterval <= 0 {
+		fatal(errors.New("--ping-count and --ping-interval must be positive"))
+	}
+	a.tracerouteCycles = *tracerouteCycles
+	a.maxTaskOutput = int64(maxTaskOutput)
+	a.reference = *reference
+	if a.tracerouteCycles < 1 {
+		fatal(errors.New("--traceroute-cycles must be positive"))
+	}
+	var family string
+	switch {
+	case *ipv4 && *ipv6:
+		fatal(errors.New("--ipv4 and --ipv6 may not be used together"))
+	case *ipv4:
+		family = "4"
+	case *ipv6:
+		family = "6"
+	}
+	a.dial, err = newDialConfig(family, *sourceIPFlag, *iface)
+	if err != nil {
+		fatal(err)
+	}
+	if *pcap && *redact {
+		fatal(errors.New("--pcap may not be used with --redact, as packet captures cannot be redacted"))
+	}
+	if *redact {
+		var extra []redactConfig
+		if conf != nil {
+			extra = conf.Redact
+		}
+		a.redactor, err = newRedactor(extra)
+		if err != nil {
+			fatal(err)
+		}
+	}
+
+	tasks := a.tasks()
+	for _, h := range hosts {
+		tasks = append(tasks, a.hostTasks(h)...)
+	}
+	if conf != nil {
+		tasks, err = conf.apply(a, tasks)
+		if err != nil {
+			fatal(err)
+		}
+	}
+	var pluginPaths []string
+	if conf != nil {
+		pluginPaths = conf.Plugins
+	}
+	plugins, err := a.pluginTasks(*pluginsDir, pluginPaths)
+	if err != nil {
+		fatal(err)
+	}
+	tasks = append(tasks, plugins...)
+	extra, err := a.extraCommandTasks(extraCmds, tasks)
+	if err != nil {
+		fatal(err)
+	}
+	tasks = append(tasks, extra...)
+	tasks = preflight(a.skipIPv6Tasks(filterTasks(a.dial.filterFamily(tasks), only, skip)))
+
+	if *listTasks {
+		printTasks(os.Stdout, tasks)
+		return exitOK
+	}
+
+	if *compressionLevel < flate.DefaultCompression || *compressionLevel > flate.BestCompression {
+		fatal(errors.New("--compression-level must be from -1 to 9"))
+	}
+	recipients, err := encryptionRecipients(encryptTo, *encryptPassphrase)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *output == stdoutPath && (*upload || *uploadTo != "" || *review || email != nil) {
+		fatal(errors.New(
+			"--upload, --upload-to, --email-to, and --review may not be used " +
+				"when writing the archive to standard output",
+		))
+	}
+	if *upload && *uploadURL == "" {
+		fatal(errors.New("--upload requires --upload-url, the upload URL given by MaxMind support"))
+	}
+	if *uploadURL != "" {
+		if err := checkUploadURL(*uploadURL); err != nil {
+			fatal(err)
+		}
+	}
+	if *reference != "" && !validReference.MatchString(*reference) {
+		fatal(errors.New(
+			"--reference must be at most 64 letters, digits, '.', '_', and '-', starting with a letter or digit",
+		))
+	}
+	if *output == "" {
+		*output = defaultArchivePath(time.Now(), *format, *reference, len(recipients) > 0)
+	}
+	err = a.open(*format, *output, archiveOptions{
+		recipients:      recipients,
+		limit:           int64(maxArchiveSize),
+		level:           *compressionLevel,
+		storeCompressed: *storeCompressed,
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := cancelOnSignal(context.Background())
+	defer stop()
+	if *maxDuration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *maxDuration)
+		defer cancel()
+	}
+
+	var capture *packetCapture
+	if *pcap {
+		capture, err = startCapture(ctx, a.targetHosts())
+		if err != nil {
+			slog.Error(err.Error())
+			a.storeError(ctx, err)
+		}
+	}
+
+	// A captive portal would make the HTTP tasks fail in misleading ways.
+	if slices.ContainsFunc(tasks, func(t *task) bool { return slices.Contains(t.tags, tagHTTP) }) {
+		a.checkCaptivePortal(ctx)
+	}
+
+	// The detailed log replaces the progress output with --verbose, and
+	// the progress output would get in the way of parsing JSON logs.
+	if !*verbose && !*quiet && *logFormat == logFormatText {
+		a.progress = newProgress(os.Stderr, len(tasks))
+	}
+	a.runTasks(ctx, tasks, *parallelism, *taskTimeout)
+
+	if capture != nil {
+		a.stopCapture(capture)
+	}
+
+	findings := a.addOutputs()
+	a.storeFile("run.log", runLog.Bytes())
+
+	a.redactFiles()
+
+	if *review {
+		err = a.review(ctx, os.Stdin, os.Stdout)
+		if err != nil {
+			slog.Error(err.Error())
+		}
+	}
+
+	err = a.addManifest()
+	if err != nil {
+		slog.Error(err.Error())
+	}
+
+	// finish sends the notification, if any, with the exit code.
+	finish := func(archive string, code int) int {
+		if *notifyURL != "" {
+			if err := a.notify(*notifyURL, archive, findings, code); err != nil {
+				slog.Error(err.Error())
+			}
+		}
+		return code
+	}
+
+	err = a.writeFiles()
+	if err != nil {
+		slog.Error(err.Error())
+		return finish("", exitArchiveFailed)
+	}
+
+	err = a.close()
+	if err != nil {
+		slog.Error(err.Error())
+		return finish("", exitArchiveFailed)
+	}
+
+	paths := archivePaths(a.archive, *output)
+	if *output == stdoutPath {
+		fmt.Fprintln(os.Stderr, "Diagnostic information written to standard output")
+	} else {
+		fmt.Printf("Diagnostic information written to %s\n", strings.Join(paths, ", "))
+	}
+
+	code := exitOK
+	if a.hasErrors() {
+		code = exitTaskErrors
+	}
+
+	// A split archive is uploaded one part at a time. The links are
+	// mailed with --email-to.
+	var links []string
+	if *upload {
+		for _, path := range paths {
+			url, err := uploadArchive(*uploadURL, path, *reference)
+			if err != nil {
+				slog.Error(err.Error())
+				code = exitTaskErrors
+			} else {
+				printUploadResult(os.Stdout, url)
+				links = append(links, url)
+			}
+		}
+	}
+
+	if *uploadTo != "" {
+		for _, path := range paths {
+			url, err := uploadToStorage(*uploadTo, path)
+			if err != nil {
+				slog.Error(err.Error())
+				code = exitTaskErrors
+			} else {
+				fmt.Printf("Archive uploaded to %s\n", url)
+				links = append(links, url)
+			}
+		}
+	}
+
+	if email != nil {
+		if err := email.emailArchive(paths, links, a.hostname(), *reference); err != nil {
+			slog.Error(err.Error())
+			code = exitTaskErrors
+		} else {
+			fmt.Printf("Archive emailed to %s\n", strings.Join(emailTo, ", "))
+		}
+	}
+
+	if *failOnProblems && hasErrorFindings(findings) {
+		code = exitProblems
+	}
+	return finish(strings.Join(paths, ", "), code)
+}
+
+// addOutputs stores the files derived from the results of the tasks: the
+// findings, report, CDN edges, summary, and errors. It returns the
+// findings.
+func (a *analyzer) addOutputs() []*Finding {
+	findings, err := a.addFindings()
+	if err != nil {
+		slog.Error(err.Error())
+	}
+
+	err = a.addReport()
+	if err != nil {
+		slog.Error(err.Error())
+	}
+
+	err = a.addCDNEdges()
+	if err != nil {
+		slog.Error(err.Error())
+	}
+
+	err = a.addSummary(findings)
+	if err != nil {
+		slog.Error(err.Error())
+	}
+
+	err = a.addErrors()
+	if err != nil {
+		slog.Error(err.Error())
+	}
+	return findings
+}
+
+// validReference matches the --reference values that are safe to include
+// in a file name.
+var validReference = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// defaultArchivePath returns a name that includes the time so that repeated
+// runs do not overwrite each other, and the reference, if any, so that the
+// archive can be matched to its support case. Encrypted archives end in
+// ".age".
+func defaultArchivePath(t time.Time, format, reference string, encrypted bool) string {
+	name := archivePrefix + "-"
+	if reference != "" {
+		name += reference + "-"
+	}
+	name += t.UTC().Format("20060102T1504Z") + "." + format
+	if encrypted {
+		name += ".age"
+	}
+	return name
+}
+
+func (a *analyzer) open(format, path string, opts archiveOptions) error {
+	w, err := newArchive(format, path, opts)
+	if err != nil {
+		return err
+	}
+	a.archive = w
+	return nil
+}
+
+func (a *analyzer) close() error {
+	return a.archive.Close()
+}
+
+func (a *analyzer) storeFile(name string, contents []byte) {
+	sf := a.newStoredFile(name, truncateTaskOutput(name, contents, a.maxTaskOutput))
+	a.filesMutex.Lock()
+	a.files = append(a.files, sf)
+	a.filesMutex.Unlock()
+}
+
+// targetHosts returns the hosts given with --host and the MaxMind
+// endpoints, without duplicates.
+func (a *analyzer) targetHosts() []string {
+	return slices.Compact(slices.Sorted(slices.Values(slices.Concat(a.hosts, maxmindEndpoints))))
+}
+
+// targetAddrs returns the addresses of targetHosts. Hosts that cannot be
+// resolved are skipped.
+func (a *analyzer) targetAddrs(ctx context.Context) []netip.Addr {
+	var addrs []netip.Addr
+	for _, host := range a.targetHosts() {
+		hostAddrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			slog.Info("error resolving host", "host", host, "error", err)
+			continue
+		}
+		for _, addr := range hostAddrs {
+			addrs = append(addrs, addr.Unmap())
+		}
+	}
+	return addrs
+}
+
+func (a *analyzer) hasErrors() bool {
+	a.errorsMutex.Lock()
+	defer a.errorsMutex.Unlock()
+	return len(a.errors) > 0
+}
+
+// storeError records an error, attributing it to the task whose context ctx
+// is, if any.
+func (a *analyzer) storeError(ctx context.Context, err error) {
+	a.storeTaskError(taskRecordFromContext(ctx).Name, err)
+}
+
+// storeTaskError records an error encountered by the named task. The name
+// is empty for errors outside of any task.
+func (a *analyzer) storeTaskError(task string, err error) {
+	slog.Info("task error", "task", task, "error", err)
+	a.errorsMutex.Lock()
+	a.errors = append(a.errors, &taskError{task: task, err: err})
+	a.errorsMutex.Unlock()
+}
+
+// commandContext is exec.CommandContext with a WaitDelay, so that the
+// command's children cannot keep a killed command's task running.
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...) // nolint: gas, gosec
+	cmd.WaitDelay = commandWaitDelay
+	return cmd
+}
+
+// createStoreCommand returns a task that stores the output of the command
+// in f. The command is killed if the task times out.
+func (a *analyzer) createStoreCommand(
+	f, command string,
+	args ...string,
+) *task {
+	return a.createFilteredCommand(f, nil, command, args...)
+}
+
+// createFilteredCommand is like createStoreCommand, but if the command
+// succeeds, its output is passed through filter before it is stored.
+func (a *analyzer) createFilteredCommand(
+	f string,
+	filter func(context.Context, []byte) []byte,
+	command string,
+	args ...string,
+) *task {
+	t := newTask(f, func(ctx context.Context) {
+		cmd := commandContext(ctx, command, args...)
+		out := a.newTaskOutput()
+		cmd.Stdout = out
+		cmd.Stderr = out
+		err := cmd.Run()
+		if cmd.ProcessState != nil {
+			record := taskRecordFromContext(ctx)
+			exitCode := cmd.ProcessState.ExitCode()
+			record.ExitCode = &exitCode
+			slog.Debug("command finished", "task", record.Name, "command", command, "exit_code", exitCode)
+		}
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+		}
+		if err != nil || filter == nil {
+			a.storeOutput(ctx, f, out)
+			return
+		}
+		output, err := out.bytes()
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error reading the output for %s", f))
+			return
+		}
+		a.storeFile(f, filter(ctx, output))
+	})
+	t.command = append([]string{command}, args...)
+	return t.withDescription("Runs `%s`", strings.Join(t.command, " ")).
+		withTools(command)
+}
+
+func (a *analyzer) addIP(ctx context.Context) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, publicIPURL, nil)
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error creating IP address request"))
+		return
+	}
+	var resp *http.Response
+	err = a.retry(ctx, "GET "+req.URL.String(), func() error {
+		var err error
+		resp, err = a.dial.httpClient().Do(req) // nolint: bodyclose
+		return err
+	})
+	if err != nil {
+		err = errors.Wrap(err, "error getting IP address")
+		a.storeError(ctx, err)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		err = errors.Wrap(err, "error reading IP address body")
+		a.storeError(ctx, err)
+		return
+	}
+
+	a.storeFile("ip-address.txt", body)
+	a.storeResult("ip-address", &ipAddressReport{IP: strings.TrimSpace(string(body))})
+}
+
+func (a *analyzer) addResolvConf(ctx context.Context) {
+	contents, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		err = errors.Wrap(err, "error reading resolv.conf")
+		a.storeError(ctx, err)
+		return
+	}
+	a.storeFile("resolv.conf", contents)
+}
+
+func (a *analyzer) addErrors() error {
+	a.errorsMutex.Lock()
+	defer a.errorsMutex.Unlock()
+	if len(a.errors) == 0 {
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	for _, storedErr := range a.errors {
+		_, err := fmt.Fprintf(buf, "%+v\n\n----------\n\n", storedErr.err)
+		if err != nil {
+			return errors.Wrap(err, "error writing errors.txt buffer")
+		}
+	}
+	a.storeFile("errors.txt", buf.Bytes())
+	return a.addErrorsJSON()
+}
+
+// redactFiles applies the redactor, if any, to every stored file. The
+// license key is always removed, in case a response or error echoes it.
+// Packet captures are skipped, as replacing bytes would corrupt them. A
+// spooled file is read into memory to be redacted, one at a time, and is
+// dropped if that fails so that it is not written unredacted.
+func (a *analyzer) redactFiles() {
+	if a.credentials == nil && a.redactor == nil {
+		return
+	}
+	a.filesMutex.Lock()
+	defer a.filesMutex.Unlock()
+	var kept []*storedFile
+	for _, sf := range a.files {
+		if strings.HasSuffix(sf.name, ".pcap") {
+			kept = append(kept, sf)
+			continue
+		}
+		contents, err := sf.read()
+		if err == nil {
+			err = sf.replace(a.scrub(contents))
+		}
+		if err != nil {
+			slog.Error("dropping file that could not be redacted", "file", sf.name, "error", err)
+			continue
+		}
+		kept = append(kept, sf)
+	}
+	a.files = kept
+}
+
+// scrub removes the license key and, with --redact, the redactor's
+// matches from contents.
+func (a *analyzer) scrub(contents []byte) []byte {
+	if a.credentials != nil {
+		contents = bytes.ReplaceAll(contents, []byte(a.credentials.licenseKey), []byte("<license key>"))
+	}
+	if a.redactor != nil {
+		contents = a.redactor.redact(contents)
+	}
+	return contents
+}
+
+func (a *analyzer) scrubString(s string) string {
+	if a.credentials == nil && a.redactor == nil {
+		return s
+	}
+	return string(a.scrub([]byte(s)))
+}
+
+// hostname returns this machine's host name, redacted with --redact.
+func (a *analyzer) hostname() string {
+	host, _ := os.Hostname()
+	return a.scrubString(host)
+}
+
+func (a *analyzer) writeFiles() error {
+	a.filesMutex.Lock()
+	defer a.filesMutex.Unlock()
+	now := time.Now()
+	for _, sf := range a.files {
+		r, err := sf.open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveFile(a.archive, sf.name, r, sf.length(), now)
+		_ = r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/pkg/errors"
+)
+
+// Archive formats.
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+// stdoutPath is the archive path that means standard output.
+const stdoutPath = "-"
+
+// ArchiveWriter writes the collected files to an archive.
+type ArchiveWriter interface {
+	WriteFile(name string, contents []byte, modified time.Time) error
+	Close() error
+}
+
+// streamingArchive is implemented by the ArchiveWriters that can write a
+// file from a reader, so that a spooled file is not read into memory.
+type streamingArchive interface {
+	writeFrom(name string, r io.Reader, size int64, modified time.Time) error
+}
+
+// writeArchiveFile writes the size bytes read from r to w as the named file,
+// streaming them if w supports that.
+func writeArchiveFile(w ArchiveWriter, name string, r io.Reader, size int64, modified time.Time) error {
+	if s, ok := w.(streamingArchive); ok {
+		return s.writeFrom(name, r, size, modified)
+	}
+	contents, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return errors.Wrap(err, "error reading "+name)
+	}
+	return w.WriteFile(name, contents, modified)
+}
+
+// archiveOptions control how an archive is written.
+type archiveOptions struct {
+	// recipients, if not empty, are who the archive is encrypted to.
+	recipients []age.Recipient
+	// limit, if non-zero, splits the archive into parts of at most this
+	// many bytes.
+	limit int64
+	// level is the compression level, from flate.NoCompression, which
+	// stores the files, to flate.BestCompression, or
+	// flate.DefaultCompression.
+	level int
+	// storeCompressed stores the files that are already compressed or
+	// compress poorly, e.g., packet captures, in zip archives without
+	// compressing them again.
+	storeCompressed bool
+}
+
+// NewArchiveWriter creates the file at path and returns a writer for the
+// given format. If recipients is not empty, the archive is encrypted to
+// them with age. If path is "-", the archive is written to standard
+// output.
+func NewArchiveWriter(format, path string, recipients []age.Recipient) (ArchiveWriter, error) {
+	return newArchiveWriter(format, path, archiveOptions{recipients: recipients, level: flate.DefaultCompression})
+}
+
+// newArchiveWriter is NewArchiveWriter with options other than the
+// recipients. The limit is ignored.
+func newArchiveWriter(format, path string, opts archiveOptions) (ArchiveWriter, error) {
+	switch format {
+	case FormatZip, FormatTarGz:
+	default:
+		return nil, errors.Errorf("unknown archive format %q", format)
+	}
+
+	var f io.WriteCloser = stdoutCloser{os.Stdout}
+	if path != stdoutPath {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, errors.Wrap(err, "error opening "+path)
+		}
+		f = file
+	}
+
+	out := f
+	if len(opts.recipients) > 0 {
+		var err error
+		out, err = newEncryptedFile(f, opts.recipients)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+
+	if format == FormatTarGz {
+		gz, err := gzip.NewWriterLevel(out, opts.level)
+		if err != nil {
+			_ = out.Close()
+			return nil, errors.Wrap(err, "error creating gzip writer")
+		}
+		return &tarGzArchive{
+			file: out,
+			gz:   gz,
+			tar:  tar.NewWriter(gz),
+		}, nil
+	}
+	z := &zipArchive{
+		file:            out,
+		zip:             zip.NewWriter(out),
+		store:           opts.level == flate.NoCompression,
+		storeCompressed: opts.storeCompressed,
+	}
+	if opts.level != flate.DefaultCompression {
+		z.zip.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, opts.level)
+		})
+	}
+	return z, nil
+}
+
+// compressedExtensions are those of files that compress poorly.
+var compressedExtensions = map[string]bool{
+	".pcap": true, ".pcapng": true, ".gz": true, ".zip": true, ".age": true,
+	".xz": true, ".bz2": true, ".zst": true,
+}
+
+// pieceSuffix matches the suffix of a piece of a file split across the
+// parts of an archive.
+var pieceSuffix = regexp.MustCompile(`\.[0-9]{3}$`)
+
+// isCompressed returns true if the file with this name compresses poorly.
+func isCompressed(name string) bool {
+	return compressedExtensions[strings.ToLower(filepath.Ext(pieceSuffix.ReplaceAllString(name, "")))]
+}
+
+// stdoutCloser leaves standard output open when the archive is closed so
+// that later writes, e.g., by a deferred flush, do not fail.
+type stdoutCloser struct {
+	io.Writer
+}
+
+func (stdoutCloser) Close() error {
+	return nil
+}
+
+type zipArchive struct {
+	file io.WriteCloser
+	zip  *zip.Writer
+	// store stores every file without compression, and storeCompressed
+	// only those that compress poorly.
+	store           bool
+	storeCompressed bool
+}
+
+func (z *zipArchive) WriteFile(name string, contents []byte, modified time.Time) error {
+	return z.writeFrom(name, bytes.NewReader(contents), int64(len(contents)), modified)
+}
+
+func (z *zipArchive) writeFrom(name string, r io.Reader, size int64, modified time.Time) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	}
+	if z.store || (z.storeCompressed && isCompressed(name)) {
+		header.Method = zip.Store
+	}
+	w, err := z.zip.CreateHeader(header)
+	if err != nil {
+		return errors.Wrap(err, "error creating "+name+" in zip file")
+	}
+	_, err = io.CopyN(w, r, size)
+	if err != nil {
+		return errors.Wrap(err, "error writing "+name+" to zip file")
+	}
+	return nil
+}
+
+func (z *zipArchive) Close() error {
+	err := z.zip.Close()
+	if err != nil {
+		return errors.Wrap(err, "error closing zip file writer")
+	}
+	err = z.file.Close()
+	if err != nil {
+		return errors.Wrap(err, "error closing zip file")
+	}
+	return nil
+}
+
+type tarGzArchive struct {
+	file io.WriteCloser
+	gz   *gzip.Writer
+	tar  *tar.Writer
+}
+
+func (t *tarGzArchive) WriteFile(name string, contents []byte, modified time.Time) error {
+	return t.writeFrom(name, bytes.NewReader(contents), int64(len(contents)), modified)
+}
+
+func (t *tarGzArchive) writeFrom(name string, r io.Reader, size int64, modified time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o600,
+		Size:    size,
+		ModTime: modified,
+	}
+	err := t.tar.WriteHeader(header)
+	if err != nil {
+		return errors.Wrap(err, "error creating "+name+" in tar file")
+	}
+	_, err = io.CopyN(t.tar, r, size)
+	if err != nil {
+		return errors.Wrap(err, "error writing "+name+" to tar file")
+	}
+	return nil
+}
+
+func (t *tarGzArchive) Close() error {
+	err := t.tar.Close()
+	if err != nil {
+		return errors.Wrap(err, "error closing tar file writer")
+	}
+	err = t.gz.Close()
+	if err != nil {
+		return errors.Wrap(err, "error closing gzip writer")
+	}
+	err = t.file.Close()
+	if err != nil {
+		return errors.Wrap(err, "error closing tar file")
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveWriterTruncates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.zip")
+	write := func(files map[string]string) {
+		t.Helper()
+		w, err := NewArchiveWriter(FormatZip, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, contents := range files {
+			if err := w.WriteFile(name, []byte(contents), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A smaller archive written over a larger one must not keep the end
+	// of the old one.
+	write(map[string]string{"big.txt": strings.Repeat("random-ish data 1234567890\n", 10000), "other.txt": "x"})
+	write(map[string]string{"small.txt": "small"})
+
+	if got := readArchive(t, FormatZip, path); !reflect.DeepEqual(got, map[string]string{"small.txt": "small"}) {
+		t.Errorf("the archive contains %v", got)
+	}
+}
+
+// captureStdout redirects os.Stdout to a file until the test ends and
+// returns the file's path.
+func captureStdout(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stdout")
+	f, err := os.Create(path) // nolint: gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = f
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		_ = f.Close()
+	})
+	return path
+}
+
+func TestArchiveWriterStdout(t *testing.T) {
+	path := captureStdout(t)
+	w, err := NewArchiveWriter(FormatTarGz, stdoutPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile("resolv.conf", []byte("nameserver 192.0.2.53\n"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Standard output is still open once the archive is closed.
+	if _, err := os.Stdout.Write(nil); err != nil {
+		t.Errorf("standard output was closed: %v", err)
+	}
+	if got := readArchive(t, FormatTarGz, path); got["resolv.conf"] != "nameserver 192.0.2.53\n" {
+		t.Errorf("the archive contains %v", got)
+	}
+}
+
+// readArchive returns the contents of the files in the archive at path.
+func readArchive(t *testing.T, format, path string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	switch format {
+	case FormatZip:
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		for _, zf := range r.File {
+			f, err := zf.Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(f)
+			_ = f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[zf.Name] = string(b)
+		}
+	case FormatTarGz:
+		f, err := os.Open(path) // nolint: gosec
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files[h.Name] = string(b)
+		}
+	default:
+		t.Fatalf("unknown format %s", format)
+	}
+	return files
+}
+
+func TestArchiveFormats(t *testing.T) {
+	want := map[string]string{
+		"resolv.conf": "nameserver 192.0.2.53\n",
+		"spooled.txt": strings.Repeat("spooled output\n", 1000),
+		"empty.txt":   "",
+	}
+	for _, format := range []string{FormatZip, FormatTarGz} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out."+format)
+			w, err := NewArchiveWriter(format, path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"resolv.conf", "empty.txt"} {
+				if err := w.WriteFile(name, []byte(want[name]), time.Now()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Both formats stream the spooled files from a reader.
+			spooled := want["spooled.txt"]
+			r := strings.NewReader(spooled + "not part of the file")
+			if err := writeArchiveFile(w, "spooled.txt", r, int64(len(spooled)), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := readArchive(t, format, path); !reflect.DeepEqual(got, want) {
+				t.Errorf("the archive contains %v", got)
+			}
+		})
+	}
+
+	if _, err := NewArchiveWriter("rar", filepath.Join(t.TempDir(), "out.rar"), nil); err == nil {
+		t.Error("NewArchiveWriter accepted an unknown format")
+	}
+}
+
+func TestCompressionOptions(t *testing.T) {
+	text := strings.Repeat("nameserver 192.0.2.53\n", 1000)
+	files := map[string]string{"resolv.conf": text, "capture.pcap": text, "capture.pcap.002": text}
+	write := func(format string, opts archiveOptions) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "out."+format)
+		w, err := newArchiveWriter(format, path, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, contents := range files {
+			if err := w.WriteFile(name, []byte(contents), time.Now()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := readArchive(t, format, path); !reflect.DeepEqual(got, files) {
+			t.Errorf("the archive written with %+v contains %v", opts, got)
+		}
+		return path
+	}
+	methods := func(path string) map[string]uint16 {
+		t.Helper()
+		r, err := zip.OpenReader(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		methods := map[string]uint16{}
+		for _, zf := range r.File {
+			methods[zf.Name] = zf.Method
+		}
+		return methods
+	}
+
+	for _, test := range []struct {
+		opts archiveOptions
+		want map[string]uint16
+	}{
+		{
+			archiveOptions{level: flate.DefaultCompression},
+			map[string]uint16{"resolv.conf": zip.Deflate, "capture.pcap": zip.Deflate, "capture.pcap.002": zip.Deflate},
+		},
+		{
+			archiveOptions{level: flate.BestCompression},
+			map[string]uint16{"resolv.conf": zip.Deflate, "capture.pcap": zip.Deflate, "capture.pcap.002": zip.Deflate},
+		},
+		{
+			archiveOptions{level: flate.NoCompression},
+			map[string]uint16{"resolv.conf": zip.Store, "capture.pcap": zip.Store, "capture.pcap.002": zip.Store},
+		},
+		{
+			archiveOptions{level: flate.DefaultCompression, storeCompressed: true},
+			map[string]uint16{"resolv.conf": zip.Deflate, "capture.pcap": zip.Store, "capture.pcap.002": zip.Store},
+		},
+	} {
+		if got := methods(write(FormatZip, test.opts)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("with %+v, the files were written with the methods %v, want %v", test.opts, got, test.want)
+		}
+	}
+
+	// Without compression, the tar.gz archive is larger than its contents.
+	fi, err := os.Stat(write(FormatTarGz, archiveOptions{level: flate.NoCompression}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() < int64(3*len(text)) {
+		t.Errorf("the uncompressed archive is %d bytes", fi.Size())
+	}
+	path := filepath.Join(t.TempDir(), "out.tar.gz")
+	if _, err := newArchiveWriter(FormatTarGz, path, archiveOptions{level: 10}); err == nil {
+		t.Error("newArchiveWriter accepted compression level 10")
+	}
+}
+
+func TestIsCompressed(t *testing.T) {
+	for name, want := range map[string]bool{
+		"capture.pcap":     true,
+		"capture.PCAPNG":   true,
+		"capture.pcap.003": true,
+		"GeoLite2.tar.gz":  true,
+		"resolv.conf":      false,
+		"ping.txt":         false,
+		"mtr.txt.001":      false,
+		"geoipupdate.1234": false,
+	} {
+		if got := isCompressed(name); got != want {
+			t.Errorf("isCompressed(%s) = %t, want %t", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// asnLookup is the origin AS of an address, from Team Cymru's IP to ASN
+// mapping service.
+type asnLookup struct {
+	// Source is "public" for the public IP address of this machine or the
+	// MaxMind host the address was resolved from.
+	Source   string `json:"source"`
+	IP       string `json:"ip"`
+	ASN      string `json:"asn,omitempty"`
+	ASName   string `json:"as_name,omitempty"`
+	Prefix   string `json:"prefix,omitempty"`
+	Country  string `json:"country,omitempty"`
+	Registry string `json:"registry,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// addASNs looks up the origin AS of the public IP address and of each
+// address of maxmindEndpoints and writes the results to asn.json. Routing
+// problems between two networks can then be attributed to them.
+func (a *analyzer) addASNs(ctx context.Context) {
+	var lookups []*asnLookup
+
+	var ip string
+	err := a.retry(ctx, "GET "+publicIPURL, func() error {
+		var err error
+		ip, err = publicIP(ctx, a.dial.restrictNetwork("tcp"))
+		return err
+	})
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error getting the IP address for the ASN lookup"))
+	} else {
+		lookups = append(lookups, &asnLookup{Source: "public", IP: ip})
+	}
+
+	for _, host := range maxmindEndpoints {
+		ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error resolving %s for the ASN lookup", host))
+			continue
+		}
+		for _, ip := range ips {
+			lookups = append(lookups, &asnLookup{Source: host, IP: ip.String()})
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, l := range lookups {
+		wg.Add(1)
+		go func(l *asnLookup) {
+			defer wg.Done()
+			if err := lookupASN(ctx, l); err != nil {
+				l.Error = err.Error()
+			}
+		}(l)
+	}
+	wg.Wait()
+
+	b, err := json.MarshalIndent(lookups, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding asn.json"))
+		return
+	}
+	a.storeFile("asn.json", b)
+	a.storeResult("asn", lookups)
+}
+
+// lookupASN fills in the origin AS of l.IP. The origin TXT record has the
+// form "ASN | prefix | country | registry | allocated" and the AS TXT record
+// "ASN | country | registry | allocated | name".
+func lookupASN(ctx context.Context, l *asnLookup) error {
+	rev, err := dns.ReverseAddr(l.IP)
+	if err != nil {
+		return errors.Wrapf(err, "error reversing %s", l.IP)
+	}
+	zone := "origin.asn.cymru.com"
+	if strings.HasSuffix(rev, ".ip6.arpa.") {
+		zone = "origin6.asn.cymru.com"
+	}
+	rev = strings.TrimSuffix(strings.TrimSuffix(rev, ".in-addr.arpa."), ".ip6.arpa.")
+
+	fields, err := cymruTXT(ctx, rev+"."+zone)
+	if err != nil {
+		return err
+	}
+	// An address announced by several ASes has them all in the first
+	// field, separated by spaces.
+	l.ASN = fields[0]
+	if len(fields) > 3 {
+		l.Prefix, l.Country, l.Registry = fields[1], fields[2], fields[3]
+	}
+
+	asn, _, _ := strings.Cut(l.ASN, " ")
+	fields, err = cymruTXT(ctx, "AS"+asn+".asn.cymru.com")
+	if err != nil {
+		return err
+	}
+	if len(fields) > 4 {
+		l.ASName = fields[4]
+	}
+	return nil
+}
+
+// cymruTXT returns the |-separated fields of the first TXT record of name.
+func cymruTXT(ctx context.Context, name string) ([]string, error) {
+	txts, err := net.DefaultResolver.LookupTXT(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error looking up %s", name)
+	}
+	if len(txts) == 0 {
+		return nil, errors.Errorf("no TXT records for %s", name)
+	}
+	fields := strings.Split(txts[0], "|")
+	for i, f := range fields {
+		fields[i] = strings.TrimSpace(f)
+	}
+	return fields, nil
+}
@@ -0,0 +1,96 @@
+package analyzer
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// useTestResolver makes net.DefaultResolver send its queries to the DNS
+// server at addr for the duration of the test.
+func useTestResolver(t *testing.T, addr string) {
+	t.Helper()
+	resolver := net.DefaultResolver
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}
+	t.Cleanup(func() { net.DefaultResolver = resolver })
+}
+
+// answerTXT returns a handler that answers TXT questions from records,
+// and with NXDOMAIN for other names.
+func answerTXT(records map[string]string) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		q := req.Question[0]
+		resp := new(dns.Msg)
+		txt, ok := records[strings.ToLower(q.Name)]
+		if !ok || q.Qtype != dns.TypeTXT {
+			resp.SetRcode(req, dns.RcodeNameError)
+			_ = w.WriteMsg(resp)
+			return
+		}
+		resp.SetReply(req)
+		resp.Answer = append(resp.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{txt},
+		})
+		_ = w.WriteMsg(resp)
+	}
+}
+
+func TestLookupASN(t *testing.T) {
+	useTestResolver(t, startTestDNSServer(t, answerTXT(map[string]string{
+		"1.2.0.192.origin.asn.cymru.com.": "64496 64497 | 192.0.2.0/24 | US | arin | 2000-01-01",
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.origin6.asn.cymru.com.": "64498 | " +
+			"2001:db8::/32 | GB | ripencc | 2000-01-01",
+		"as64496.asn.cymru.com.": "64496 | US | arin | 2000-01-01 | EXAMPLE-AS, US",
+		"as64498.asn.cymru.com.": "64498 | GB | ripencc | 2000-01-01 | EXAMPLE6-AS, GB",
+	})))
+
+	tests := []asnLookup{
+		// An address announced by several ASes is named by the first.
+		{
+			IP:       "192.0.2.1",
+			ASN:      "64496 64497",
+			ASName:   "EXAMPLE-AS, US",
+			Prefix:   "192.0.2.0/24",
+			Country:  "US",
+			Registry: "arin",
+		},
+		{
+			IP:       "2001:db8::1",
+			ASN:      "64498",
+			ASName:   "EXAMPLE6-AS, GB",
+			Prefix:   "2001:db8::/32",
+			Country:  "GB",
+			Registry: "ripencc",
+		},
+	}
+	for _, want := range tests {
+		l := &asnLookup{IP: want.IP}
+		if err := lookupASN(context.Background(), l); err != nil {
+			t.Errorf("lookupASN(%s): %v", want.IP, err)
+			continue
+		}
+		if *l != want {
+			t.Errorf("lookupASN(%s) = %+v, want %+v", want.IP, *l, want)
+		}
+	}
+
+	// Unannounced addresses are not in the zone.
+	l := &asnLookup{IP: "198.51.100.1"}
+	if err := lookupASN(context.Background(), l); err == nil ||
+		!strings.Contains(err.Error(), "error looking up 1.100.51.198.origin.asn.cymru.com") {
+		t.Errorf("lookupASN of an unannounced address = %v", err)
+	}
+	if err := lookupASN(context.Background(), &asnLookup{IP: "not an address"}); err == nil {
+		t.Error("lookupASN accepted an invalid address")
+	}
+}
@@ -0,0 +1,317 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// nameserver is an address of one of a zone's authoritative servers. The
+// address is empty if the name could not be resolved.
+type nameserver struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// authoritativeAnswer is a nameserver's answer to one of the questions.
+type authoritativeAnswer struct {
+	Nameserver    string   `json:"nameserver"`
+	Address       string   `json:"address,omitempty"`
+	Question      string   `json:"question"`
+	Rcode         string   `json:"rcode,omitempty"`
+	Authoritative bool     `json:"authoritative"`
+	Answers       []string `json:"answers,omitempty"`
+	RTTMS         float64  `json:"rtt_ms"`
+	Error         string   `json:"error,omitempty"`
+}
+
+// authoritativeComparison is the result of asking each of a zone's
+// authoritative servers about a host.
+type authoritativeComparison struct {
+	Host        string                 `json:"host"`
+	Zone        string                 `json:"zone,omitempty"`
+	Nameservers []nameserver           `json:"nameservers,omitempty"`
+	Answers     []*authoritativeAnswer `json:"answers,omitempty"`
+	// Divergent describes each answer that is missing or differs from
+	// the one given by most of the servers.
+	Divergent []string `json:"divergent,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+func (a *analyzer) createAuthoritativeTask(f, host string) *task {
+	return newTask(f, func(ctx context.Context) {
+		buf := new(bytes.Buffer)
+		c, err := compareAuthoritative(ctx, buf, host)
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+			fmt.Fprintf(buf, ";; %v\n", err)
+			c.Error = err.Error()
+		}
+		for _, d := range c.Divergent {
+			fmt.Fprintf(buf, ";; DIVERGENT: %s\n", d)
+		}
+		a.storeFile(f, buf.Bytes())
+		a.storeResult(taskName(f), c)
+	}).withTags(tagDNS).
+		withDescription("Asks each authoritative nameserver for %s's zone directly for its A and AAAA records", host)
+}
+
+// compareAuthoritative asks each authoritative server of host's zone for
+// the A and AAAA records of host and compares the answers. Each response
+// is written to buf. The returned comparison is never nil.
+func compareAuthoritative(ctx context.Context, buf *bytes.Buffer, host string) (*authoritativeComparison, error) {
+	c := &authoritativeComparison{Host: host}
+	zone, err := findZone(ctx, host)
+	if err != nil {
+		return c, err
+	}
+	c.Zone = zone
+
+	servers, err := authoritativeServers(ctx, zone)
+	if err != nil {
+		return c, err
+	}
+	compareAuthoritativeAnswers(ctx, buf, c, servers)
+	return c, nil
+}
+
+// compareAuthoritativeAnswers asks each of servers for the A and AAAA
+// records of c.Host and records the answers and any divergence in c.
+func compareAuthoritativeAnswers(
+	ctx context.Context,
+	buf *bytes.Buffer,
+	c *authoritativeComparison,
+	servers []nameserver,
+) {
+	c.Nameservers = servers
+	host, zone := c.Host, c.Zone
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		q := newDNSQuery(host, qtype)
+		answers := map[string][]string{}
+		var servers []string
+		for _, ns := range c.Nameservers {
+			label := ns.Name + " (" + ns.Address + ")"
+			if ns.Address == "" {
+				c.Divergent = append(c.Divergent, ns.Name+" could not be resolved: "+ns.Error)
+				continue
+			}
+			r := &authoritativeAnswer{Nameserver: ns.Name, Address: ns.Address, Question: q.String()}
+			c.Answers = append(c.Answers, r)
+
+			m := newDNSMessage(q, false)
+			m.RecursionDesired = false
+			resp, rtt, err := exchangeDNS(ctx, m, ns.Address)
+			r.RTTMS = durationMS(rtt)
+			if err != nil {
+				r.Error = err.Error()
+				c.Divergent = append(c.Divergent, label+" did not answer "+q.String()+": "+r.Error)
+				continue
+			}
+			writeDNSResponse(buf, resp, ns.Address, rtt)
+			r.Rcode = dns.RcodeToString[resp.Rcode]
+			r.Authoritative = resp.Authoritative
+			for _, rr := range resp.Answer {
+				r.Answers = append(r.Answers, rr.String())
+			}
+			if !r.Authoritative {
+				c.Divergent = append(c.Divergent, label+" is not authoritative for "+zone)
+			}
+			answers[label] = normalizeAnswers(r.Answers)
+			servers = append(servers, label)
+		}
+
+		consensus := mostCommonAnswer(servers, answers)
+		for _, label := range servers {
+			if !slices.Equal(answers[label], consensus) {
+				c.Divergent = append(c.Divergent, fmt.Sprintf(
+					"%s answered %s with [%s] while most servers answered [%s]",
+					label, q, strings.Join(answers[label], ", "), strings.Join(consensus, ", "),
+				))
+			}
+		}
+	}
+}
+
+// findZone returns the zone that name is in, using the SOA record that the
+// system resolver returns for it.
+func findZone(ctx context.Context, name string) (string, error) {
+	server, err := resolveDNSServer(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	m := newDNSMessage(newDNSQuery(name, dns.TypeSOA), false)
+	m.RecursionDesired = true
+	resp, _, err := exchangeDNS(ctx, m, server)
+	if err != nil {
+		return "", err
+	}
+	for _, rr := range append(resp.Answer, resp.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Hdr.Name, nil
+		}
+	}
+	return "", dnsResultErrorf("no SOA record found for %s", name)
+}
+
+// authoritativeServers returns the addresses of the name servers for zone,
+// using the system resolver. Like dig -4, only IPv4 addresses are used.
+func authoritativeServers(ctx context.Context, zone string) ([]nameserver, error) {
+	server, err := resolveDNSServer(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	m := newDNSMessage(newDNSQuery(zone, dns.TypeNS), false)
+	m.RecursionDesired = true
+	resp, _, err := exchangeDNS(ctx, m, server)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, rr := range resp.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			names = append(names, ns.Ns)
+		}
+	}
+	if len(names) == 0 {
+		return nil, dnsResultErrorf("no NS records found for %s", zone)
+	}
+	slices.Sort(names)
+
+	var servers []nameserver
+	for _, name := range names {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", name)
+		if err != nil {
+			servers = append(servers, nameserver{Name: name, Error: err.Error()})
+			continue
+		}
+		for _, ip := range ips {
+			servers = append(servers, nameserver{Name: name, Address: net.JoinHostPort(ip.String(), "53")})
+		}
+	}
+	return servers, nil
+}
+
+// normalizeAnswers returns answers sorted and without TTLs so that answers
+// from different servers may be compared.
+func normalizeAnswers(answers []string) []string {
+	normalized := dnsAnswersByQuestion([]*dnsReport{{Answers: answers}})[""]
+	slices.Sort(normalized)
+	return normalized
+}
+
+// mostCommonAnswer returns the answer given by the most servers, preferring
+// the first server's in a tie.
+func mostCommonAnswer(servers []string, answers map[string][]string) []string {
+	counts := map[string]int{}
+	var best []string
+	bestCount := 0
+	for _, s := range servers {
+		key := strings.Join(answers[s], "\n")
+		counts[key]++
+		if counts[key] > bestCount {
+			best, bestCount = answers[s], counts[key]
+		}
+	}
+	return best
+}
+
+// soaSerial is the serial of a zone's SOA record on one of its
+// authoritative servers.
+type soaSerial struct {
+	Nameserver string  `json:"nameserver"`
+	Address    string  `json:"address,omitempty"`
+	Serial     uint32  `json:"serial,omitempty"`
+	RTTMS      float64 `json:"rtt_ms,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// soaComparison is the SOA serial on each of a zone's authoritative
+// servers. A server with an older serial has not received the latest
+// version of the zone.
+type soaComparison struct {
+	Zone    string       `json:"zone"`
+	Serials []*soaSerial `json:"serials,omitempty"`
+	// Mismatch is true if the servers that answered have different
+	// serials.
+	Mismatch bool   `json:"mismatch"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (a *analyzer) createSOATask(f, zone string) *task {
+	return newTask(f, func(ctx context.Context) {
+		buf := new(bytes.Buffer)
+		c, err := compareSOA(ctx, buf, zone)
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+			fmt.Fprintf(buf, ";; %v\n", err)
+			c.Error = err.Error()
+		}
+		for _, s := range c.Serials {
+			if s.Error != "" {
+				fmt.Fprintf(buf, ";; %s (%s): %s\n", s.Nameserver, s.Address, s.Error)
+			} else {
+				fmt.Fprintf(buf, ";; %s (%s): serial %d\n", s.Nameserver, s.Address, s.Serial)
+			}
+		}
+		a.storeFile(f, buf.Bytes())
+		a.storeResult(taskName(f), c)
+	}).withTags(tagDNS).
+		withDescription("Compares the SOA serial for %s on each of its authoritative nameservers", zone)
+}
+
+// compareSOA asks each authoritative server of zone for its SOA record.
+// Each response is written to buf. The returned comparison is never nil.
+func compareSOA(ctx context.Context, buf *bytes.Buffer, zone string) (*soaComparison, error) {
+	c := &soaComparison{Zone: dns.Fqdn(zone)}
+	servers, err := authoritativeServers(ctx, c.Zone)
+	if err != nil {
+		return c, err
+	}
+	compareSOASerials(ctx, buf, c, servers)
+	return c, nil
+}
+
+// compareSOASerials asks each of servers for the SOA record of c.Zone and
+// records the serials in c.
+func compareSOASerials(ctx context.Context, buf *bytes.Buffer, c *soaComparison, servers []nameserver) {
+	q := newDNSQuery(c.Zone, dns.TypeSOA)
+	var serial uint32
+	for _, ns := range servers {
+		s := &soaSerial{Nameserver: ns.Name, Address: ns.Address, Error: ns.Error}
+		c.Serials = append(c.Serials, s)
+		if ns.Address == "" {
+			continue
+		}
+
+		m := newDNSMessage(q, false)
+		m.RecursionDesired = false
+		resp, rtt, err := exchangeDNS(ctx, m, ns.Address)
+		if err != nil {
+			s.Error = err.Error()
+			continue
+		}
+		writeDNSResponse(buf, resp, ns.Address, rtt)
+		s.RTTMS = durationMS(rtt)
+		for _, rr := range resp.Answer {
+			if soa, ok := rr.(*dns.SOA); ok {
+				s.Serial = soa.Serial
+			}
+		}
+		if s.Serial == 0 {
+			s.Error = "no SOA record in " + dns.RcodeToString[resp.Rcode] + " response"
+			continue
+		}
+		if serial != 0 && s.Serial != serial {
+			c.Mismatch = true
+		}
+		serial = s.Serial
+	}
+}
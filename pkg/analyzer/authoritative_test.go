@@ -0,0 +1,172 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// answerAuthoritative returns a handler that answers A questions with ip,
+// setting the AA bit if authoritative is set.
+func answerAuthoritative(ip string, authoritative bool) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.Authoritative = authoritative
+		q := req.Question[0]
+		if q.Qtype == dns.TypeA {
+			resp.Answer = append(resp.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+				A:   net.ParseIP(ip),
+			})
+		}
+		_ = w.WriteMsg(resp)
+	}
+}
+
+func TestCompareAuthoritativeAnswers(t *testing.T) {
+	servers := []nameserver{
+		{Name: "ns1.maxmind.com.", Address: startTestDNSServer(t, answerAuthoritative("192.0.2.1", true))},
+		{Name: "ns2.maxmind.com.", Address: startTestDNSServer(t, answerAuthoritative("192.0.2.1", true))},
+		{Name: "ns3.maxmind.com.", Address: startTestDNSServer(t, answerAuthoritative("192.0.2.2", false))},
+		{Name: "ns4.maxmind.com.", Error: "no such host"},
+	}
+	c := &authoritativeComparison{Host: "geoip.maxmind.com", Zone: "maxmind.com."}
+	var buf bytes.Buffer
+	compareAuthoritativeAnswers(context.Background(), &buf, c, servers)
+
+	// The three servers with addresses are asked for A and AAAA records.
+	if len(c.Answers) != 6 || !reflect.DeepEqual(c.Nameservers, servers) {
+		t.Errorf("comparison = %+v", c)
+	}
+	ns3 := "ns3.maxmind.com. (" + servers[2].Address + ")"
+	want := []string{
+		ns3 + " is not authoritative for maxmind.com.",
+		"ns4.maxmind.com. could not be resolved: no such host",
+		ns3 + " answered geoip.maxmind.com. IN A with [geoip.maxmind.com. 0 IN A 192.0.2.2] " +
+			"while most servers answered [geoip.maxmind.com. 0 IN A 192.0.2.1]",
+		ns3 + " is not authoritative for maxmind.com.",
+		"ns4.maxmind.com. could not be resolved: no such host",
+	}
+	if !reflect.DeepEqual(c.Divergent, want) {
+		t.Errorf("divergent =\n%s\nwant\n%s", strings.Join(c.Divergent, "\n"), strings.Join(want, "\n"))
+	}
+	if !strings.Contains(buf.String(), ";; SERVER: "+servers[0].Address) {
+		t.Errorf("the responses were not written:\n%s", buf.String())
+	}
+
+	fs := findingsFor(map[string]interface{}{"geoip.maxmind.com-dig-authoritative": c})
+	if len(fs) != len(want) || fs[0].Check != "dns-authoritative-mismatch" {
+		t.Errorf("findings = %v", findingChecks(fs))
+	}
+}
+
+func TestMostCommonAnswer(t *testing.T) {
+	answers := map[string][]string{
+		"a": {"192.0.2.1"},
+		"b": {"192.0.2.2"},
+		"c": {"192.0.2.2"},
+		"d": {"192.0.2.3"},
+	}
+	if got := mostCommonAnswer([]string{"a", "b", "c", "d"}, answers); !reflect.DeepEqual(got, []string{"192.0.2.2"}) {
+		t.Errorf("mostCommonAnswer = %v", got)
+	}
+	// In a tie, the first server's answer wins.
+	if got := mostCommonAnswer([]string{"d", "a"}, answers); !reflect.DeepEqual(got, []string{"192.0.2.3"}) {
+		t.Errorf("mostCommonAnswer with a tie = %v", got)
+	}
+	if got := mostCommonAnswer(nil, answers); got != nil {
+		t.Errorf("mostCommonAnswer without servers = %v", got)
+	}
+}
+
+func TestNormalizeAnswers(t *testing.T) {
+	got := normalizeAnswers([]string{
+		"maxmind.com.\t300\tIN\tA\t192.0.2.2",
+		"maxmind.com. 60 IN A 192.0.2.1",
+	})
+	want := []string{"maxmind.com. 0 IN A 192.0.2.1", "maxmind.com. 0 IN A 192.0.2.2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeAnswers = %q, want %q", got, want)
+	}
+}
+
+// answerSOA returns a handler that answers SOA questions with serial, or
+// with no records if it is 0.
+func answerSOA(serial uint32) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.Authoritative = true
+		if serial != 0 {
+			resp.Answer = append(resp.Answer, &dns.SOA{
+				Hdr:    dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+				Ns:     "ns1.maxmind.com.",
+				Mbox:   "hostmaster.maxmind.com.",
+				Serial: serial,
+			})
+		}
+		_ = w.WriteMsg(resp)
+	}
+}
+
+func TestCompareSOASerials(t *testing.T) {
+	tests := []struct {
+		serials  []uint32
+		mismatch bool
+	}{
+		{[]uint32{2024010101, 2024010101}, false},
+		{[]uint32{2024010101, 2024010102, 2024010101}, true},
+		// A server without the record is not compared.
+		{[]uint32{2024010101, 0, 2024010101}, false},
+	}
+	for _, test := range tests {
+		var servers []nameserver
+		for _, serial := range test.serials {
+			addr := startTestDNSServer(t, answerSOA(serial))
+			servers = append(servers, nameserver{Name: "ns.maxmind.com.", Address: addr})
+		}
+		servers = append(servers, nameserver{Name: "ns9.maxmind.com.", Error: "no such host"})
+
+		c := &soaComparison{Zone: "maxmind.com."}
+		var buf bytes.Buffer
+		compareSOASerials(context.Background(), &buf, c, servers)
+		if c.Mismatch != test.mismatch || len(c.Serials) != len(servers) {
+			t.Errorf("serials %v: comparison = %+v", test.serials, c)
+			continue
+		}
+		for i, serial := range test.serials {
+			s := c.Serials[i]
+			if s.Serial != serial || s.Address != servers[i].Address || (serial == 0) != (s.Error != "") {
+				t.Errorf("serials %v: server %d = %+v", test.serials, i, s)
+			}
+		}
+		if s := c.Serials[len(servers)-1]; s.Error != "no such host" || s.Address != "" {
+			t.Errorf("unresolved server = %+v", s)
+		}
+	}
+}
+
+func TestSOAFindings(t *testing.T) {
+	c := &soaComparison{
+		Zone: "maxmind.com.",
+		Serials: []*soaSerial{
+			{Nameserver: "ns1.maxmind.com.", Serial: 2024010101},
+			{Nameserver: "ns2.maxmind.com.", Serial: 2024010102},
+			{Nameserver: "ns3.maxmind.com.", Error: "i/o timeout"},
+		},
+		Mismatch: true,
+	}
+	fs := findingsFor(map[string]interface{}{"maxmind.com-dig-soa": c})
+	if got := strings.Join(findingChecks(fs), ","); got != "dns-nameserver-unreachable,dns-soa-mismatch" {
+		t.Fatalf("checks = %s", got)
+	}
+	if want := "(ns1.maxmind.com.: 2024010101, ns2.maxmind.com.: 2024010102)"; !strings.Contains(fs[1].Summary, want) {
+		t.Errorf("summary = %q", fs[1].Summary)
+	}
+}
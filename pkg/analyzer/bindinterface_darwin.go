@@ -0,0 +1,26 @@
+package analyzer
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// bindToInterface makes the socket underlying c send and receive only on
+// iface.
+func bindToInterface(c syscall.RawConn, network string, iface *net.Interface) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if isIPv6Network(network) {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_BOUND_IF, iface.Index)
+			return
+		}
+		sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_BOUND_IF, iface.Index)
+	})
+	if err != nil {
+		return errors.Wrap(err, "error accessing socket")
+	}
+	return errors.Wrapf(sockErr, "error binding to %s", iface.Name)
+}
@@ -0,0 +1,22 @@
+package analyzer
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// bindToInterface makes the socket underlying c send and receive only on
+// iface.
+func bindToInterface(c syscall.RawConn, _ string, iface *net.Interface) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.BindToDevice(int(fd), iface.Name)
+	})
+	if err != nil {
+		return errors.Wrap(err, "error accessing socket")
+	}
+	return errors.Wrapf(sockErr, "error binding to %s", iface.Name)
+}
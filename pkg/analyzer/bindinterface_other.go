@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !windows
+
+package analyzer
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// bindToInterface is not implemented on this platform.
+func bindToInterface(syscall.RawConn, string, *net.Interface) error {
+	return errors.New("binding to an interface is not supported on this platform")
+}
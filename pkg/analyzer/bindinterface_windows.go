@@ -0,0 +1,36 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Socket options from ws2ipdef.h, which the syscall package lacks.
+const (
+	ipUnicastIf   = 31
+	ipv6UnicastIf = 31
+)
+
+// bindToInterface makes the socket underlying c send only on iface.
+func bindToInterface(c syscall.RawConn, network string, iface *net.Interface) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if isIPv6Network(network) {
+			sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IPV6, ipv6UnicastIf, iface.Index)
+			return
+		}
+		// Unlike IPV6_UNICAST_IF, IP_UNICAST_IF takes the index in
+		// network byte order.
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(iface.Index))
+		index := int(binary.NativeEndian.Uint32(b[:]))
+		sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, ipUnicastIf, index)
+	})
+	if err != nil {
+		return errors.Wrap(err, "error accessing socket")
+	}
+	return errors.Wrapf(sockErr, "error binding to %s", iface.Name)
+}
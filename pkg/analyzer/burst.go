@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// burstRequests is the number of requests the burst task makes at once.
+// It is enough to trip a per-client limit meant to stop abuse but not to
+// be abuse itself.
+const burstRequests = 10
+
+// burstRequest is the outcome of one request of a burst.
+type burstRequest struct {
+	StatusCode int     `json:"status_code,omitempty"`
+	RetryAfter string  `json:"retry_after,omitempty"`
+	Server     string  `json:"server,omitempty"`
+	TotalMS    float64 `json:"total_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// burstReport is the result of making burstRequests requests to a host
+// at once. Rate limiting, whether by the service or something in between,
+// shows as 429 or 503 responses rather than as network errors.
+type burstReport struct {
+	URL      string          `json:"url"`
+	Requests []*burstRequest `json:"requests"`
+	// StatusCodes counts the responses by status code.
+	StatusCodes map[int]int `json:"status_codes,omitempty"`
+	RateLimited int         `json:"rate_limited"`
+	Failed      int         `json:"failed"`
+}
+
+func (a *analyzer) createBurstTask(f, host string) *task {
+	url := "https://" + host + "/"
+	return newTask(f, func(ctx context.Context) {
+		r := burst(ctx, url)
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", f))
+			return
+		}
+		a.storeFile(f, b)
+		a.storeResult(taskName(f), r)
+	}).withTags(tagHTTP).
+		withDescription("Requests %s %d times at once, recording any rate limiting", url, burstRequests)
+}
+
+func burst(ctx context.Context, url string) *burstReport {
+	r := &burstReport{URL: url, Requests: make([]*burstRequest, burstRequests)}
+	var wg sync.WaitGroup
+	for i := range r.Requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := traceHTTP(ctx, dialConfigFromContext(ctx).restrictNetwork("tcp"), url)
+			r.Requests[i] = &burstRequest{
+				StatusCode: result.statusCode,
+				RetryAfter: result.header.Get("Retry-After"),
+				Server:     result.header.Get("Server"),
+				TotalMS:    durationMS(result.totalDuration()),
+				Error:      errorString(err),
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, req := range r.Requests {
+		switch {
+		case req.Error != "":
+			r.Failed++
+			continue
+		case req.StatusCode == http.StatusTooManyRequests,
+			req.StatusCode == http.StatusServiceUnavailable && req.RetryAfter != "":
+			r.RateLimited++
+		}
+		if r.StatusCodes == nil {
+			r.StatusCodes = map[int]int{}
+		}
+		r.StatusCodes[req.StatusCode]++
+	}
+	return r
+}
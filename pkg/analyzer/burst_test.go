@@ -0,0 +1,61 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBurst(t *testing.T) {
+	var n atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Server", "test")
+		switch n.Add(1) {
+		case 1, 2, 3:
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 4:
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 5:
+			// Without Retry-After, a 503 is an outage rather than a
+			// limit.
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	r := burst(context.Background(), server.URL+"/")
+	if len(r.Requests) != burstRequests || r.Failed != 0 || r.RateLimited != 4 {
+		t.Errorf("report = %+v", r)
+	}
+	want := map[int]int{http.StatusOK: 5, http.StatusTooManyRequests: 3, http.StatusServiceUnavailable: 2}
+	if !reflect.DeepEqual(r.StatusCodes, want) {
+		t.Errorf("status codes = %v, want %v", r.StatusCodes, want)
+	}
+	for _, req := range r.Requests {
+		if req.Server != "test" || (req.StatusCode == http.StatusTooManyRequests && req.RetryAfter != "30") {
+			t.Errorf("request = %+v", req)
+		}
+	}
+
+	url := server.URL + "/"
+	server.Close()
+	r = burst(context.Background(), url)
+	if r.Failed != burstRequests || r.StatusCodes != nil || r.Requests[0].Error == "" {
+		t.Errorf("report for a closed server = %+v", r)
+	}
+}
+
+func TestBurstFindings(t *testing.T) {
+	r := &burstReport{URL: "https://geoip.maxmind.com/", Requests: make([]*burstRequest, 10), RateLimited: 4}
+	fs := findingsFor(map[string]interface{}{"geoip.maxmind.com-burst": r})
+	want := "4 of 10 parallel requests to https://geoip.maxmind.com/ were rate limited"
+	if len(fs) != 1 || fs[0].Check != "rate-limited" || !strings.HasPrefix(fs[0].Summary, want) {
+		t.Errorf("findings = %+v", fs)
+	}
+}
@@ -0,0 +1,114 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// captivePortalTimeout bounds each captive portal probe so that it does
+// not noticeably delay the run.
+const captivePortalTimeout = 5 * time.Second
+
+// captiveProbe is a URL with a known response. A captive portal answers it
+// with a redirect or its login page instead.
+type captiveProbe struct {
+	url    string
+	status int
+	// body is a string the response must contain, if any.
+	body string
+}
+
+var captiveProbes = []captiveProbe{
+	{url: "http://connectivitycheck.gstatic.com/generate_204", status: http.StatusNoContent},
+	{url: "http://captive.apple.com/hotspot-detect.html", status: http.StatusOK, body: "Success"},
+}
+
+// captivePortalReport is the evidence for or against a captive portal.
+type captivePortalReport struct {
+	Detected bool                  `json:"detected"`
+	Probes   []*captivePortalProbe `json:"probes"`
+}
+
+type captivePortalProbe struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Location   string `json:"location,omitempty"`
+	// Body is the start of an unexpected response body.
+	Body        string `json:"body,omitempty"`
+	Intercepted bool   `json:"intercepted"`
+	Error       string `json:"error,omitempty"`
+}
+
+// checkCaptivePortal requests captiveProbes before the tasks run, writing
+// the results to captive-portal.json. Behind a captive portal, most of
+// the tasks fail in misleading ways, e.g., with TLS errors, so this is
+// logged prominently.
+func (a *analyzer) checkCaptivePortal(ctx context.Context) {
+	r := &captivePortalReport{}
+	for _, p := range captiveProbes {
+		result := probeCaptivePortal(ctx, p)
+		r.Probes = append(r.Probes, result)
+		if result.Intercepted {
+			r.Detected = true
+		}
+	}
+	if r.Detected {
+		slog.Warn("a captive portal appears to be intercepting HTTP requests; log in to the network and run again")
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding captive-portal.json"))
+		return
+	}
+	a.storeFile("captive-portal.json", b)
+	a.storeResult("captive-portal", r)
+}
+
+func probeCaptivePortal(ctx context.Context, p captiveProbe) *captivePortalProbe {
+	r := &captivePortalProbe{URL: p.url}
+	ctx, cancel := context.WithTimeout(ctx, captivePortalTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DialContext:       dialConfigFromContext(ctx).dialContext,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+
+	r.StatusCode = resp.StatusCode
+	r.Location = resp.Header.Get("Location")
+	if resp.StatusCode != p.status || !strings.Contains(string(body), p.body) {
+		r.Intercepted = true
+		r.Body = string(body)
+	}
+	return r
+}
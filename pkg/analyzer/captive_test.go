@@ -0,0 +1,82 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProbeCaptivePortal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/generate_204":
+			w.WriteHeader(http.StatusNoContent)
+		case "/hotspot-detect.html":
+			_, _ = w.Write([]byte("<HTML><HEAD><TITLE>Success</TITLE></HEAD><BODY>Success</BODY></HTML>"))
+		case "/login":
+			_, _ = w.Write([]byte("<html>Welcome to Airport Wi-Fi</html>"))
+		default:
+			w.Header().Set("Location", "http://portal.example.com/login")
+			w.WriteHeader(http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		probe       captiveProbe
+		intercepted bool
+		location    string
+		body        string
+	}{
+		{captiveProbe{url: server.URL + "/generate_204", status: http.StatusNoContent}, false, "", ""},
+		{captiveProbe{url: server.URL + "/hotspot-detect.html", status: http.StatusOK, body: "Success"}, false, "", ""},
+		{
+			captiveProbe{url: server.URL + "/login", status: http.StatusOK, body: "Success"},
+			true, "", "<html>Welcome to Airport Wi-Fi</html>",
+		},
+		{
+			captiveProbe{url: server.URL + "/redirected", status: http.StatusNoContent},
+			true, "http://portal.example.com/login", "",
+		},
+	}
+	for _, test := range tests {
+		r := probeCaptivePortal(context.Background(), test.probe)
+		if r.URL != test.probe.url || r.Error != "" || r.Intercepted != test.intercepted ||
+			r.Location != test.location || r.Body != test.body {
+			t.Errorf("probeCaptivePortal(%s) = %+v", test.probe.url, r)
+		}
+	}
+}
+
+func TestCheckCaptivePortal(t *testing.T) {
+	// A captive portal answers every request with its login page.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("<html>Log in to continue</html>"))
+	}))
+	defer server.Close()
+	probes := captiveProbes
+	captiveProbes = []captiveProbe{
+		{url: server.URL + "/generate_204", status: http.StatusNoContent},
+		// .invalid names never resolve (RFC 6761).
+		{url: "http://captive.invalid/hotspot-detect.html", status: http.StatusOK, body: "Success"},
+	}
+	defer func() { captiveProbes = probes }()
+
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.checkCaptivePortal(context.Background())
+
+	r, ok := a.results["captive-portal"].(*captivePortalReport)
+	if !ok || !r.Detected || len(r.Probes) != 2 || !r.Probes[0].Intercepted ||
+		r.Probes[1].Intercepted || r.Probes[1].Error == "" {
+		t.Fatalf("results = %#v", a.results["captive-portal"])
+	}
+	if len(storedContents(t, a, "captive-portal.json")) == 0 {
+		t.Error("captive-portal.json is empty")
+	}
+	fs := findingsFor(map[string]interface{}{"captive-portal": r})
+	if len(fs) != 1 || fs[0].Check != "captive-portal" || fs[0].Severity != severityError {
+		t.Errorf("findings = %+v", fs)
+	}
+}
@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// edgeInfo is what the response headers say about the CDN edge that
+// served a request.
+type edgeInfo struct {
+	Server string `json:"server,omitempty"`
+	CFRay  string `json:"cf_ray,omitempty"`
+	// POP is the edge location, e.g., the airport code at the end of a
+	// CF-Ray or X-Served-By header, or X-Amz-Cf-Pop.
+	POP string `json:"pop,omitempty"`
+	// CacheStatus is CF-Cache-Status or X-Cache.
+	CacheStatus string `json:"cache_status,omitempty"`
+	Age         string `json:"age,omitempty"`
+	Via         string `json:"via,omitempty"`
+	ServedBy    string `json:"served_by,omitempty"`
+}
+
+// newEdgeInfo parses the CDN headers in h. It returns nil if there are
+// none.
+func newEdgeInfo(h http.Header) *edgeInfo {
+	e := &edgeInfo{
+		Server:      h.Get("Server"),
+		CFRay:       h.Get("CF-Ray"),
+		CacheStatus: h.Get("CF-Cache-Status"),
+		Age:         h.Get("Age"),
+		Via:         h.Get("Via"),
+		ServedBy:    h.Get("X-Served-By"),
+	}
+	if e.CacheStatus == "" {
+		e.CacheStatus = h.Get("X-Cache")
+	}
+	switch {
+	case e.CFRay != "":
+		e.POP = lastField(e.CFRay, "-")
+	case h.Get("X-Amz-Cf-Pop") != "":
+		e.POP = h.Get("X-Amz-Cf-Pop")
+	case e.ServedBy != "":
+		// Fastly lists each cache, e.g., "cache-iad-kiad7000-IAD,
+		// cache-sjc10041-SJC"; the last is the edge.
+		e.POP = lastField(lastField(e.ServedBy, ","), "-")
+	}
+	if *e == (edgeInfo{}) {
+		return nil
+	}
+	return e
+}
+
+// cdnEdge is the edge that served the request of one HTTP trace task.
+type cdnEdge struct {
+	Task       string    `json:"task"`
+	URL        string    `json:"url"`
+	RemoteAddr string    `json:"remote_address,omitempty"`
+	Edge       *edgeInfo `json:"edge"`
+}
+
+// addCDNEdges collects the CDN headers of each HTTP trace task into
+// cdn-edges.json so that it is clear at a glance which edges served the
+// client. Nothing is written if no response had CDN headers.
+func (a *analyzer) addCDNEdges() error {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	var edges []*cdnEdge
+	for _, name := range sortedKeys(a.results) {
+		r, ok := a.results[name].(*httpReport)
+		if !ok || r.Edge == nil {
+			continue
+		}
+		edges = append(edges, &cdnEdge{Task: name, URL: r.URL, RemoteAddr: r.RemoteAddr, Edge: r.Edge})
+	}
+	if len(edges) == 0 {
+		return nil
+	}
+
+	b, err := json.MarshalIndent(edges, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding cdn-edges.json")
+	}
+	a.storeFile("cdn-edges.json", b)
+	return nil
+}
+
+func lastField(s, sep string) string {
+	return strings.TrimSpace(s[strings.LastIndex(s, sep)+1:])
+}
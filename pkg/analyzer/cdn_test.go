@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestNewEdgeInfo(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   *edgeInfo
+	}{
+		{"none", http.Header{"Content-Type": {"text/html"}}, nil},
+		{
+			"Cloudflare",
+			http.Header{
+				"Server":          {"cloudflare"},
+				"Cf-Ray":          {"8a1b2c3d4e5f6789-IAD"},
+				"Cf-Cache-Status": {"HIT"},
+				"Age":             {"42"},
+			},
+			&edgeInfo{Server: "cloudflare", CFRay: "8a1b2c3d4e5f6789-IAD", POP: "IAD", CacheStatus: "HIT", Age: "42"},
+		},
+		{
+			"CloudFront",
+			http.Header{"X-Amz-Cf-Pop": {"FRA56-P3"}, "X-Cache": {"Miss from cloudfront"}},
+			&edgeInfo{POP: "FRA56-P3", CacheStatus: "Miss from cloudfront"},
+		},
+		{
+			"Fastly",
+			http.Header{"X-Served-By": {"cache-iad-kiad7000-IAD, cache-sjc10041-SJC"}, "Via": {"1.1 varnish"}},
+			&edgeInfo{ServedBy: "cache-iad-kiad7000-IAD, cache-sjc10041-SJC", POP: "SJC", Via: "1.1 varnish"},
+		},
+	}
+	for _, test := range tests {
+		got := newEdgeInfo(test.header)
+		if (got == nil) != (test.want == nil) || (got != nil && *got != *test.want) {
+			t.Errorf("%s: edge = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLastField(t *testing.T) {
+	for s, want := range map[string]string{
+		"8a1b-IAD":  "IAD",
+		"IAD":       "IAD",
+		"a-b- SJC ": "SJC",
+		"":          "",
+	} {
+		if got := lastField(s, "-"); got != want {
+			t.Errorf("lastField(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestAddCDNEdges(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	if err := a.addCDNEdges(); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.files) != 0 {
+		t.Error("cdn-edges.json was written without any CDN headers")
+	}
+
+	edge := &edgeInfo{CFRay: "8a1b2c3d4e5f6789-IAD", POP: "IAD"}
+	a.storeResult("updates.maxmind.com-https-ipv4", &httpReport{
+		URL:        "https://updates.maxmind.com",
+		RemoteAddr: "104.18.0.5:443",
+		Edge:       edge,
+	})
+	a.storeResult("geoip.maxmind.com-https-ipv4", &httpReport{URL: "https://geoip.maxmind.com"})
+	a.storeResult("ntp", &ntpReport{})
+	if err := a.addCDNEdges(); err != nil {
+		t.Fatal(err)
+	}
+	var edges []*cdnEdge
+	if err := json.Unmarshal(storedContents(t, a, "cdn-edges.json"), &edges); err != nil {
+		t.Fatal(err)
+	}
+	want := []*cdnEdge{{
+		Task:       "updates.maxmind.com-https-ipv4",
+		URL:        "https://updates.maxmind.com",
+		RemoteAddr: "104.18.0.5:443",
+		Edge:       edge,
+	}}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("edges = %+v, want %+v", edges, want)
+	}
+}
@@ -0,0 +1,227 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// certificateExpiryDays is how close to expiry, in days, a certificate may
+// be before it is flagged.
+const certificateExpiryDays = 14
+
+// publicCAOrganizations are the organizations of the public certificate
+// authorities that MaxMind's endpoints and CDN are likely to use. A chain
+// with no certificate from one of these was probably issued by a TLS
+// intercepting proxy.
+var publicCAOrganizations = []string{
+	"Amazon",
+	"Cloudflare",
+	"COMODO CA Limited",
+	"DigiCert Inc",
+	"Entrust, Inc.",
+	"GlobalSign",
+	"GoDaddy.com, Inc.",
+	"Google Trust Services",
+	"Google Trust Services LLC",
+	"IdenTrust",
+	"Internet Security Research Group",
+	"Let's Encrypt",
+	"Sectigo Limited",
+	"SSL Corporation",
+	"The USERTRUST Network",
+}
+
+// certChainReport is the result of checking the certificate chain
+// presented by a host.
+type certChainReport struct {
+	Host         string        `json:"host"`
+	Address      string        `json:"address,omitempty"`
+	TLSVersion   string        `json:"tls_version,omitempty"`
+	Certificates []certSummary `json:"certificates,omitempty"`
+	// Verified is true if the chain is valid for the host using the
+	// system roots.
+	Verified      bool    `json:"verified"`
+	VerifyError   string  `json:"verify_error,omitempty"`
+	HostnameMatch bool    `json:"hostname_match"`
+	ExpiresInDays float64 `json:"expires_in_days"`
+	// Interception is true if the chain appears to be from a TLS
+	// intercepting proxy rather than a public certificate authority.
+	Interception bool   `json:"interception"`
+	Error        string `json:"error,omitempty"`
+
+	pem []byte
+}
+
+type certSummary struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serial_number"`
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	DNSNames           []string  `json:"dns_names,omitempty"`
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	SHA256             string    `json:"sha256"`
+}
+
+// addCertificates checks the certificate chain of each MaxMind endpoint
+// and writes the chains and the results to tls-certificates.txt.
+func (a *analyzer) addCertificates(ctx context.Context) {
+	reports := make([]*certChainReport, len(maxmindEndpoints))
+	var wg sync.WaitGroup
+	for i, host := range maxmindEndpoints {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			r, err := fetchCertificates(ctx, host)
+			if err != nil {
+				a.storeError(ctx, errors.Wrapf(err, "error checking the certificates of %s", host))
+				r.Error = err.Error()
+			}
+			reports[i] = r
+		}(i, host)
+	}
+	wg.Wait()
+
+	buf := new(bytes.Buffer)
+	for _, r := range reports {
+		r.format(buf)
+	}
+	a.storeFile("tls-certificates.txt", buf.Bytes())
+	a.storeResult("tls-certificates", reports)
+}
+
+// fetchCertificates connects to host on port 443 and checks the presented
+// certificate chain. The returned report is never nil.
+func fetchCertificates(ctx context.Context, host string) (*certChainReport, error) {
+	dial := dialConfigFromContext(ctx)
+	r := &certChainReport{Host: host}
+
+	ctx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+
+	// The chain is verified below so that we can record it even if it is
+	// invalid.
+	dialer := &tls.Dialer{NetDialer: dial.newDialer("tcp"), Config: &tls.Config{
+		ServerName:         host,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, // nolint: gosec
+	}}
+	conn, err := dialer.DialContext(ctx, dial.restrictNetwork("tcp"), net.JoinHostPort(host, "443"))
+	if err != nil {
+		return r, errors.Wrap(err, "error connecting")
+	}
+	defer conn.Close()
+
+	tlsConn := conn.(*tls.Conn)
+	state := tlsConn.ConnectionState()
+	r.Address = tlsConn.RemoteAddr().String()
+	r.TLSVersion = tlsVersionName(state.Version)
+
+	return r, r.checkChain(host, state.PeerCertificates)
+}
+
+// checkChain records the certificates and checks that they are a valid
+// chain for host from a public certificate authority.
+func (r *certChainReport) checkChain(host string, certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		return errors.New("no certificates presented")
+	}
+
+	pemBuf := new(bytes.Buffer)
+	for _, cert := range certs {
+		fingerprint := sha256.Sum256(cert.Raw)
+		r.Certificates = append(r.Certificates, certSummary{
+			Subject:            cert.Subject.String(),
+			Issuer:             cert.Issuer.String(),
+			SerialNumber:       cert.SerialNumber.Text(16),
+			NotBefore:          cert.NotBefore,
+			NotAfter:           cert.NotAfter,
+			DNSNames:           cert.DNSNames,
+			SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+			SHA256:             hex.EncodeToString(fingerprint[:]),
+		})
+		_ = pem.Encode(pemBuf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	r.pem = pemBuf.Bytes()
+
+	leaf := certs[0]
+	r.HostnameMatch = leaf.VerifyHostname(host) == nil
+	r.ExpiresInDays = time.Until(leaf.NotAfter).Hours() / 24
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates})
+	r.Verified = err == nil
+	r.VerifyError = errorString(err)
+
+	r.Interception = true
+	for _, cert := range certs {
+		if isPublicCA(cert.Issuer.Organization) {
+			r.Interception = false
+		}
+	}
+	return nil
+}
+
+func isPublicCA(organizations []string) bool {
+	for _, org := range organizations {
+		for _, known := range publicCAOrganizations {
+			if strings.EqualFold(org, known) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r *certChainReport) format(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "=== %s", r.Host)
+	if r.Address != "" {
+		fmt.Fprintf(buf, " (%s, %s)", r.Address, r.TLSVersion)
+	}
+	fmt.Fprintln(buf)
+	if r.Error != "" {
+		fmt.Fprintf(buf, "Error: %s\n\n", r.Error)
+		return
+	}
+
+	verified := "yes"
+	if !r.Verified {
+		verified = "no: " + r.VerifyError
+	}
+	fmt.Fprintf(buf, "Valid for the system roots: %s\n", verified)
+	fmt.Fprintf(buf, "Hostname matches: %t\n", r.HostnameMatch)
+	fmt.Fprintf(buf, "Leaf expires in: %.1f days\n", r.ExpiresInDays)
+	if r.Interception {
+		fmt.Fprintln(buf, "WARNING: no certificate was issued by a known public CA; "+
+			"the connection may be intercepted by a proxy")
+	}
+
+	for i, c := range r.Certificates {
+		fmt.Fprintf(buf, "\nCertificate %d\n", i)
+		fmt.Fprintf(buf, "  Subject:   %s\n", c.Subject)
+		fmt.Fprintf(buf, "  Issuer:    %s\n", c.Issuer)
+		fmt.Fprintf(buf, "  Serial:    %s\n", c.SerialNumber)
+		fmt.Fprintf(buf, "  Validity:  %s to %s\n", c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339))
+		if len(c.DNSNames) > 0 {
+			fmt.Fprintf(buf, "  DNS names: %s\n", strings.Join(c.DNSNames, ", "))
+		}
+		fmt.Fprintf(buf, "  Algorithm: %s\n", c.SignatureAlgorithm)
+		fmt.Fprintf(buf, "  SHA-256:   %s\n", c.SHA256)
+	}
+	fmt.Fprintf(buf, "\n%s\n", r.pem)
+}
@@ -0,0 +1,175 @@
+package analyzer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA returns a self-signed CA certificate from organization and its
+// key.
+func testCA(t *testing.T, organization string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{organization}, CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	return testSignCertificate(t, template, template, key, key), key
+}
+
+// testSignCertificate returns the certificate for template and key signed
+// by parent with parentKey.
+func testSignCertificate(
+	t *testing.T,
+	template, parent *x509.Certificate,
+	key, parentKey *ecdsa.PrivateKey,
+) *x509.Certificate {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// testLeaf returns a certificate for dnsName expiring at notAfter, issued
+// by ca.
+func testLeaf(
+	t *testing.T,
+	ca *x509.Certificate,
+	caKey *ecdsa.PrivateKey,
+	dnsName string,
+	notAfter time.Time,
+) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSignCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(0xabc),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, key, caKey)
+}
+
+// testCertChain returns a leaf certificate for dnsName expiring at notAfter
+// and the CA certificate from caOrganization that issued it.
+func testCertChain(t *testing.T, caOrganization, dnsName string, notAfter time.Time) []*x509.Certificate {
+	t.Helper()
+	ca, caKey := testCA(t, caOrganization)
+	return []*x509.Certificate{testLeaf(t, ca, caKey, dnsName, notAfter), ca}
+}
+
+func TestCheckChain(t *testing.T) {
+	expires := time.Now().Add(10 * 24 * time.Hour)
+	certs := testCertChain(t, "Let's Encrypt", "geoip.maxmind.com", expires)
+	r := &certChainReport{Host: "geoip.maxmind.com"}
+	if err := r.checkChain("geoip.maxmind.com", certs); err != nil {
+		t.Fatal(err)
+	}
+	// The test CA is not one of the system roots.
+	if r.Verified || r.VerifyError == "" {
+		t.Errorf("verified = %t, %q", r.Verified, r.VerifyError)
+	}
+	if !r.HostnameMatch || r.Interception || r.ExpiresInDays < 9.9 || r.ExpiresInDays > 10 {
+		t.Errorf("report = %+v", r)
+	}
+	if len(r.Certificates) != 2 || r.Certificates[0].SerialNumber != "abc" ||
+		r.Certificates[1].Issuer != "CN=Test CA,O=Let's Encrypt" {
+		t.Errorf("certificates = %+v", r.Certificates)
+	}
+
+	var buf bytes.Buffer
+	r.format(&buf)
+	for _, want := range []string{
+		"=== geoip.maxmind.com\n",
+		"Valid for the system roots: no: ",
+		"Hostname matches: true\n",
+		"\nCertificate 1\n  Subject:   CN=Test CA,O=Let's Encrypt\n",
+		"  DNS names: geoip.maxmind.com\n",
+		"-----BEGIN CERTIFICATE-----",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("the output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "WARNING") {
+		t.Errorf("the output warns about interception:\n%s", buf.String())
+	}
+}
+
+func TestCheckChainInterception(t *testing.T) {
+	certs := testCertChain(t, "Corporate Proxy", "geoip.maxmind.com", time.Now().Add(24*time.Hour))
+	r := &certChainReport{Host: "updates.maxmind.com"}
+	if err := r.checkChain("updates.maxmind.com", certs); err != nil {
+		t.Fatal(err)
+	}
+	if !r.Interception || r.HostnameMatch {
+		t.Errorf("report = %+v", r)
+	}
+	var buf bytes.Buffer
+	r.format(&buf)
+	if !strings.Contains(buf.String(), "WARNING: no certificate was issued by a known public CA") {
+		t.Errorf("the output does not warn about interception:\n%s", buf.String())
+	}
+
+	if err := (&certChainReport{}).checkChain("geoip.maxmind.com", nil); err == nil {
+		t.Error("checkChain accepted an empty chain")
+	}
+}
+
+func TestCertChainFindings(t *testing.T) {
+	tests := []struct {
+		report *certChainReport
+		want   string
+	}{
+		{&certChainReport{Verified: true, ExpiresInDays: 90}, ""},
+		{&certChainReport{Verified: true, ExpiresInDays: 3}, "certificate-expiring"},
+		{&certChainReport{VerifyError: "expired"}, "certificate-invalid"},
+		{
+			&certChainReport{Interception: true, VerifyError: "unknown authority"},
+			"tls-interception,certificate-invalid",
+		},
+		{&certChainReport{Error: "connection refused"}, ""},
+	}
+	for _, test := range tests {
+		test.report.Host = "geoip.maxmind.com"
+		fs := findingsFor(map[string]interface{}{"tls-certificates": []*certChainReport{test.report}})
+		if got := strings.Join(findingChecks(fs), ","); got != test.want {
+			t.Errorf("findings for %+v = %s, want %s", test.report, got, test.want)
+		}
+	}
+}
+
+func TestIsPublicCA(t *testing.T) {
+	if !isPublicCA([]string{"Example", "DIGICERT INC"}) {
+		t.Error("DigiCert is not a public CA")
+	}
+	if isPublicCA([]string{"Zscaler Inc."}) || isPublicCA(nil) {
+		t.Error("a proxy is a public CA")
+	}
+}
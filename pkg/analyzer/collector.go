@@ -0,0 +1,151 @@
+package analyzer
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Task is a task registered with a Collector by a program embedding the
+// analyzer.
+type Task interface {
+	// Name is the name of the file the task stores, e.g., "uname.txt". As
+	// with the built-in tasks, Options.Only and Options.Skip select the
+	// task by this name without the extension.
+	Name() string
+	// Run collects the task's data and stores it with c. It should return
+	// promptly once ctx is done.
+	Run(ctx context.Context, c *Collector)
+}
+
+// Options configure a Collector. The zero value runs the built-in tasks
+// against the default host with the command's defaults.
+type Options struct {
+	// Hosts are the hosts to diagnose. The default is geoip.maxmind.com.
+	Hosts []string
+	// Only and Skip select the tasks to run by name or tag, as with the
+	// --only and --skip flags.
+	Only []string
+	Skip []string
+	// Parallelism is the number of tasks run at once. The default is 4.
+	Parallelism int
+	// TaskTimeout cancels a task that runs for longer than this and does
+	// not set its own timeout. The default is 60 seconds.
+	TaskTimeout time.Duration
+	// NoBuiltinTasks, if true, runs only the registered tasks.
+	NoBuiltinTasks bool
+	// Reference is a support ticket or other reference recorded in the
+	// manifest.
+	Reference string
+	// IPVersion, if 4 or 6, restricts every connection to that version of
+	// IP and skips the tasks for the other, as with --ipv4 and --ipv6.
+	IPVersion int
+	// SourceIP and Interface send every probe from this local address or
+	// network interface, as with --source-ip and --interface. A source
+	// address implies its IP version.
+	SourceIP  string
+	Interface string
+}
+
+// Collector runs the built-in and registered tasks and writes their
+// output, findings, report, and manifest to an archive. A Collector may
+// only be run once.
+type Collector struct {
+	a     *analyzer
+	opts  Options
+	tasks []Task
+	// err is the error in opts, which Run returns.
+	err error
+}
+
+// NewCollector returns a Collector with opts. If opts are invalid, Run
+// returns the error without running anything.
+func NewCollector(opts Options) *Collector {
+	if len(opts.Hosts) == 0 {
+		opts.Hosts = []string{defaultHost}
+	}
+	if opts.Parallelism == 0 {
+		opts.Parallelism = defaultParallelism
+	}
+	if opts.TaskTimeout == 0 {
+		opts.TaskTimeout = defaultTaskTimeout
+	}
+	var family string
+	if opts.IPVersion != 0 {
+		family = strconv.Itoa(opts.IPVersion)
+	}
+	dial, err := newDialConfig(family, opts.SourceIP, opts.Interface)
+	return &Collector{
+		a: &analyzer{
+			retryPolicy:      retryPolicy{retries: defaultRetries, backoff: defaultRetryBackoff},
+			hosts:            opts.Hosts,
+			httpSamples:      defaultHTTPSamples,
+			pingCount:        defaultPingCount,
+			pingInterval:     defaultPingInterval,
+			tracerouteCycles: defaultTracerouteCycles,
+			maxTaskOutput:    defaultMaxTaskOutput,
+			reference:        opts.Reference,
+			dial:             dial,
+		},
+		opts: opts,
+		err:  err,
+	}
+}
+
+// Register adds t to the tasks that are run.
+func (c *Collector) Register(t Task) {
+	c.tasks = append(c.tasks, t)
+}
+
+// StoreFile stores a file in the archive.
+func (c *Collector) StoreFile(name string, contents []byte) {
+	c.a.storeFile(name, contents)
+}
+
+// StoreResult stores the parsed result of a task, which is included in
+// report.json under name. It must be encodable as JSON.
+func (c *Collector) StoreResult(name string, result interface{}) {
+	c.a.storeResult(name, result)
+}
+
+// StoreError records an error, which is included in errors.txt and
+// errors.json. ctx is that passed to Task.Run, which attributes the error
+// to the task.
+func (c *Collector) StoreError(ctx context.Context, err error) {
+	c.a.storeError(ctx, err)
+}
+
+// Run runs the tasks and writes everything collected to w, which the
+// caller must close. It returns the problems found in the results. The
+// tasks still running when ctx is done are cancelled, and what they
+// collected is written.
+func (c *Collector) Run(ctx context.Context, w ArchiveWriter) ([]*Finding, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	a := c.a
+	defer a.removeSpool()
+	var tasks []*task
+	if !c.opts.NoBuiltinTasks {
+		tasks = a.tasks()
+		for _, h := range c.opts.Hosts {
+			tasks = append(tasks, a.hostTasks(h)...)
+		}
+	}
+	for _, t := range c.tasks {
+		tasks = append(tasks, newTask(t.Name(), func(ctx context.Context) {
+			t.Run(ctx, c)
+		}).withDescription("Runs the registered task %s", t.Name()))
+	}
+	tasks = preflight(a.skipIPv6Tasks(filterTasks(a.dial.filterFamily(tasks), c.opts.Only, c.opts.Skip)))
+
+	a.runTasks(ctx, tasks, c.opts.Parallelism, c.opts.TaskTimeout)
+	findings := a.addOutputs()
+	a.redactFiles()
+	if err := a.addManifest(); err != nil {
+		return findings, err
+	}
+
+	a.archive = w
+	return findings, a.writeFiles()
+}
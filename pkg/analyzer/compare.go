@@ -0,0 +1,493 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// compare only reports a change in latency if it is at least
+// compareLatencyMinMS milliseconds and compareLatencyFraction of the
+// earlier latency.
+const (
+	compareLatencyMinMS    = 5
+	compareLatencyFraction = 0.2
+)
+
+// analysis is the data compare reads from an archive.
+type analysis struct {
+	path        string
+	generated   string
+	ip          string
+	nameservers []string
+	endpoints   map[string]*endpointHealth
+	http        map[string]*httpReport
+	dns         map[string][]*dnsReport
+	ping        map[string]*pingReport
+	traceroutes map[string]*tracerouteResult
+}
+
+// runCompare implements the compare command, which reports the differences
+// between two archives.
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare OLD-ARCHIVE NEW-ARCHIVE\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var analyses [2]*analysis
+	for i, path := range fs.Args() {
+		var err error
+		analyses[i], err = readAnalysis(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitArchiveFailed
+		}
+	}
+	compareAnalyses(os.Stdout, analyses[0], analyses[1])
+	return exitOK
+}
+
+// readAnalysis reads report.json and resolv.conf from the archive at path.
+func readAnalysis(path string) (*analysis, error) {
+	files, err := readArchiveFiles(path, "report.json", "resolv.conf")
+	if err != nil {
+		return nil, err
+	}
+	b, ok := files["report.json"]
+	if !ok {
+		return nil, errors.Errorf("%s does not contain report.json", path)
+	}
+
+	var r struct {
+		Generated string                     `json:"generated"`
+		Tasks     map[string]json.RawMessage `json:"tasks"`
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, errors.Wrapf(err, "error decoding report.json from %s", path)
+	}
+
+	an := &analysis{
+		path:        path,
+		generated:   r.Generated,
+		nameservers: parseNameservers(files["resolv.conf"]),
+		endpoints:   map[string]*endpointHealth{},
+		http:        map[string]*httpReport{},
+		dns:         map[string][]*dnsReport{},
+		ping:        map[string]*pingReport{},
+		traceroutes: map[string]*tracerouteResult{},
+	}
+	for name, raw := range r.Tasks {
+		if err := an.addResult(name, raw); err != nil {
+			return nil, errors.Wrapf(err, "error decoding the result of %s from %s", name, path)
+		}
+	}
+	return an, nil
+}
+
+// addResult decodes a task result from report.json. The type of the result
+// is determined by its shape as report.json does not record it.
+func (an *analysis) addResult(name string, raw json.RawMessage) error {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) == nil {
+		switch {
+		case fields["ip"] != nil:
+			var r ipAddressReport
+			err := json.Unmarshal(raw, &r)
+			an.ip = r.IP
+			return err
+		case fields["hops"] != nil:
+			var r tracerouteResult
+			an.traceroutes[name] = &r
+			return json.Unmarshal(raw, &r)
+		case fields["url"] != nil:
+			var r httpReport
+			an.http[name] = &r
+			return json.Unmarshal(raw, &r)
+		case fields["sent"] != nil:
+			var r pingReport
+			an.ping[name] = &r
+			return json.Unmarshal(raw, &r)
+		}
+		return nil
+	}
+
+	var items []map[string]json.RawMessage
+	if json.Unmarshal(raw, &items) != nil || len(items) == 0 {
+		return nil
+	}
+	switch {
+	case items[0]["question"] != nil:
+		var rs []*dnsReport
+		err := json.Unmarshal(raw, &rs)
+		an.dns[name] = rs
+		return err
+	case items[0]["tcp_443"] != nil:
+		var rs []*endpointHealth
+		if err := json.Unmarshal(raw, &rs); err != nil {
+			return err
+		}
+		for _, h := range rs {
+			an.endpoints[h.Host] = h
+		}
+	}
+	return nil
+}
+
+// readArchiveFiles returns the contents of the named files from the zip or
+// tar.gz archive at path. Files missing from the archive are omitted.
+func readArchiveFiles(path string, names ...string) (map[string][]byte, error) {
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening archive")
+	}
+	defer f.Close()
+
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+	files := map[string][]byte{}
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len("age-encryption.org/"))
+	switch {
+	case string(magic) == "age-encryption.org/":
+		return nil, errors.Errorf("%s is encrypted; decrypt it with age -d first", path)
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", path)
+		}
+		tr := tar.NewReader(gz)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				return files, nil
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "error reading %s", path)
+			}
+			if !wanted[h.Name] {
+				continue
+			}
+			files[h.Name], err = io.ReadAll(tr)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error reading %s from %s", h.Name, path)
+			}
+		}
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting archive size")
+	}
+	zr, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", path)
+	}
+	for _, zf := range zr.File {
+		if !wanted[zf.Name] {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error opening %s in %s", zf.Name, path)
+		}
+		files[zf.Name], err = io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s from %s", zf.Name, path)
+		}
+	}
+	return files, nil
+}
+
+func parseNameservers(resolvConf []byte) []string {
+	var servers []string
+	for _, line := range strings.Split(string(resolvConf), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+// compareAnalyses writes the differences between before and after to w.
+// Only the data present in both is compared.
+func compareAnalyses(w io.Writer, before, after *analysis) {
+	fmt.Fprintf(w, "Comparing %s (%s)\n", before.path, before.generated)
+	fmt.Fprintf(w, "     with %s (%s)\n", after.path, after.generated)
+
+	changes := 0
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		changes += len(lines)
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for _, line := range lines {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+
+	var lines []string
+	if before.ip != after.ip {
+		lines = append(lines, fmt.Sprintf("%s -> %s", orNone(before.ip), orNone(after.ip)))
+	}
+	section("Public IP address", lines)
+
+	if before.nameservers != nil && after.nameservers != nil {
+		section("Resolvers in resolv.conf", diffLists(before.nameservers, after.nameservers))
+	}
+	section("Resolved addresses", compareAddresses(before, after))
+	section("Routes", compareRoutes(before, after))
+	section("Reachability", compareReachability(before, after))
+	section("Latency (ms)", compareLatency(before, after))
+
+	if changes == 0 {
+		fmt.Fprintln(w, "\nNo differences found.")
+	}
+}
+
+func compareAddresses(before, after *analysis) []string {
+	var lines []string
+	for _, name := range unionKeys(before.dns, after.dns) {
+		if before.dns[name] == nil || after.dns[name] == nil {
+			continue
+		}
+		oldAnswers := dnsAnswersByQuestion(before.dns[name])
+		newAnswers := dnsAnswersByQuestion(after.dns[name])
+		for _, q := range unionKeys(oldAnswers, newAnswers) {
+			diff := diffLists(oldAnswers[q], newAnswers[q])
+			if len(diff) == 0 {
+				continue
+			}
+			lines = append(lines, name+" "+q+":")
+			for _, d := range diff {
+				lines = append(lines, "  "+d)
+			}
+		}
+	}
+	for _, host := range unionKeys(before.endpoints, after.endpoints) {
+		o, n := before.endpoints[host], after.endpoints[host]
+		if o == nil || n == nil {
+			continue
+		}
+		diff := diffLists(o.Addresses, n.Addresses)
+		if len(diff) == 0 {
+			continue
+		}
+		lines = append(lines, "endpoint-health "+host+":")
+		for _, d := range diff {
+			lines = append(lines, "  "+d)
+		}
+	}
+	return lines
+}
+
+// dnsAnswersByQuestion returns the answers to each question with the TTLs
+// removed, as they change from one run to the next.
+func dnsAnswersByQuestion(reports []*dnsReport) map[string][]string {
+	answers := map[string][]string{}
+	for _, r := range reports {
+		var as []string
+		for _, a := range r.Answers {
+			if rr, err := dns.NewRR(a); err == nil && rr != nil {
+				rr.Header().Ttl = 0
+				a = strings.Join(strings.Fields(rr.String()), " ")
+			}
+			as = append(as, a)
+		}
+		answers[r.Question] = as
+	}
+	return answers
+}
+
+func compareRoutes(before, after *analysis) []string {
+	var lines []string
+	for _, name := range unionKeys(before.traceroutes, after.traceroutes) {
+		if before.traceroutes[name] == nil || after.traceroutes[name] == nil {
+			continue
+		}
+		oldHops := hopAddresses(before.traceroutes[name])
+		newHops := hopAddresses(after.traceroutes[name])
+		n := len(oldHops)
+		if len(newHops) > n {
+			n = len(newHops)
+		}
+		var changed []string
+		for i := 0; i < n; i++ {
+			o, nw := "(none)", "(none)"
+			if i < len(oldHops) {
+				o = oldHops[i]
+			}
+			if i < len(newHops) {
+				nw = newHops[i]
+			}
+			if o != nw {
+				changed = append(changed, fmt.Sprintf("  hop %d: %s -> %s", i+1, o, nw))
+			}
+		}
+		if len(changed) > 0 {
+			lines = append(lines, name+":")
+			lines = append(lines, changed...)
+		}
+	}
+	return lines
+}
+
+func hopAddresses(r *tracerouteResult) []string {
+	if r == nil {
+		return nil
+	}
+	hops := make([]string, len(r.Hops))
+	for i, hop := range r.Hops {
+		hops[i] = "*"
+		if len(hop.Addresses) > 0 {
+			hops[i] = strings.Join(hop.Addresses, ", ")
+		}
+	}
+	return hops
+}
+
+func compareReachability(before, after *analysis) []string {
+	var lines []string
+	status := func(ok bool, err string) string {
+		if ok {
+			return "ok"
+		}
+		if err == "" {
+			return "failed"
+		}
+		return "failed (" + err + ")"
+	}
+	for _, name := range unionKeys(before.http, after.http) {
+		o, n := before.http[name], after.http[name]
+		if o == nil || n == nil || (o.Error == "") == (n.Error == "") {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf(
+			"%s: %s -> %s", name, status(o.Error == "", o.Error), status(n.Error == "", n.Error),
+		))
+	}
+	for _, host := range unionKeys(before.endpoints, after.endpoints) {
+		o, n := before.endpoints[host], after.endpoints[host]
+		if o == nil || n == nil || o.HTTP.OK == n.HTTP.OK {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf(
+			"endpoint-health %s: %s -> %s", host, status(o.HTTP.OK, o.HTTP.Error), status(n.HTTP.OK, n.HTTP.Error),
+		))
+	}
+	for _, name := range unionKeys(before.ping, after.ping) {
+		o, n := before.ping[name], after.ping[name]
+		if o == nil || n == nil || o.Loss == n.Loss {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %.1f%% -> %.1f%% packet loss", name, o.Loss, n.Loss))
+	}
+	return lines
+}
+
+func compareLatency(before, after *analysis) []string {
+	var lines []string
+	add := func(name string, o, n float64) {
+		delta := n - o
+		if o == 0 || n == 0 || math.Abs(delta) < compareLatencyMinMS || math.Abs(delta) < compareLatencyFraction*o {
+			return
+		}
+		lines = append(lines, fmt.Sprintf("%s: %.1f -> %.1f (%+.1f)", name, o, n, delta))
+	}
+	for _, name := range unionKeys(before.http, after.http) {
+		if o, n := before.http[name], after.http[name]; o != nil && n != nil {
+			add(name+" total", o.Timings.Total, n.Timings.Total)
+		}
+	}
+	for _, name := range unionKeys(before.ping, after.ping) {
+		if o, n := before.ping[name], after.ping[name]; o != nil && n != nil {
+			add(name+" average", o.AvgMS, n.AvgMS)
+		}
+	}
+	for _, host := range unionKeys(before.endpoints, after.endpoints) {
+		if o, n := before.endpoints[host], after.endpoints[host]; o != nil && n != nil {
+			add("endpoint-health "+host+" HTTPS", o.HTTP.DurationMS, n.HTTP.DurationMS)
+		}
+	}
+	for _, name := range unionKeys(before.traceroutes, after.traceroutes) {
+		o, n := before.traceroutes[name], after.traceroutes[name]
+		if o == nil || n == nil || !o.Reached || !n.Reached || len(o.Hops) == 0 || len(n.Hops) == 0 {
+			continue
+		}
+		add(name+" final hop", o.Hops[len(o.Hops)-1].AvgMS, n.Hops[len(n.Hops)-1].AvgMS)
+	}
+	return lines
+}
+
+// diffLists returns the elements removed from before, prefixed with "-", and
+// those added in after, prefixed with "+".
+func diffLists(before, after []string) []string {
+	inOld := map[string]bool{}
+	for _, s := range before {
+		inOld[s] = true
+	}
+	inNew := map[string]bool{}
+	for _, s := range after {
+		inNew[s] = true
+	}
+	var diff []string
+	for _, s := range before {
+		if !inNew[s] {
+			diff = append(diff, "- "+s)
+		}
+	}
+	for _, s := range after {
+		if !inOld[s] {
+			diff = append(diff, "+ "+s)
+		}
+	}
+	return diff
+}
+
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := map[string]struct{}{}
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
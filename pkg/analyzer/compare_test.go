@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"bytes"
+	"compress/flate"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeAnalysisArchive writes an archive with report.json holding results
+// and resolv.conf, and returns its path.
+func writeAnalysisArchive(t *testing.T, format string, results map[string]interface{}, resolvConf string) string {
+	t.Helper()
+	a := &analyzer{}
+	defer a.removeSpool()
+	for name, r := range results {
+		a.storeResult(name, r)
+	}
+	if err := a.addReport(); err != nil {
+		t.Fatal(err)
+	}
+	a.storeFile("resolv.conf", []byte(resolvConf))
+
+	path := filepath.Join(t.TempDir(), "analysis."+format)
+	if err := a.open(format, path, archiveOptions{level: flate.DefaultCompression}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.writeFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCompare(t *testing.T) {
+	ms := time.Millisecond
+	before := writeAnalysisArchive(t, FormatZip, map[string]interface{}{
+		"ip-address": &ipAddressReport{IP: "192.0.2.1"},
+		"geoip.maxmind.com-dig": []*dnsReport{{
+			Question: "geoip.maxmind.com. IN A",
+			Answers:  []string{"geoip.maxmind.com.\t300\tIN\tA\t198.51.100.1"},
+		}},
+		"geoip.maxmind.com-https": &httpReport{URL: "https://geoip.maxmind.com", Timings: httpTimingsMS{Total: 100}},
+		"geoip.maxmind.com-ping":  testPingResult(10*ms, 10*ms).report("geoip.maxmind.com", nil),
+		"geoip.maxmind.com-traceroute": &tracerouteResult{Hops: []*tracerouteHop{
+			{Addresses: []string{"192.0.2.254"}},
+			{Addresses: []string{"203.0.113.1"}},
+		}},
+	}, "nameserver 192.0.2.53\n")
+	after := writeAnalysisArchive(t, FormatTarGz, map[string]interface{}{
+		"ip-address": &ipAddressReport{IP: "192.0.2.2"},
+		// Only the TTL changed, which is not a difference.
+		"geoip.maxmind.com-dig": []*dnsReport{{
+			Question: "geoip.maxmind.com. IN A",
+			Answers:  []string{"geoip.maxmind.com.\t60\tIN\tA\t198.51.100.1"},
+		}},
+		"geoip.maxmind.com-https": &httpReport{
+			URL:   "https://geoip.maxmind.com",
+			Error: "connection refused",
+		},
+		"geoip.maxmind.com-ping": testPingResult(30*ms, 0).report("geoip.maxmind.com", nil),
+		"geoip.maxmind.com-traceroute": &tracerouteResult{Hops: []*tracerouteHop{
+			{Addresses: []string{"192.0.2.254"}},
+			{},
+			{Addresses: []string{"203.0.113.1"}},
+		}},
+	}, "nameserver 192.0.2.54\n")
+
+	b, err := readAnalysis(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := readAnalysis(after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	compareAnalyses(&buf, b, a)
+	out := buf.String()
+	for _, want := range []string{
+		"Public IP address:\n  192.0.2.1 -> 192.0.2.2\n",
+		"Resolvers in resolv.conf:\n  - 192.0.2.53\n  + 192.0.2.54\n",
+		"    hop 2: 203.0.113.1 -> *\n    hop 3: (none) -> 203.0.113.1\n",
+		"geoip.maxmind.com-https: ok -> failed (connection refused)\n",
+		"geoip.maxmind.com-ping: 0.0% -> 50.0% packet loss\n",
+		"geoip.maxmind.com-ping average: 10.0 -> 30.0 (+20.0)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the output does not contain %q:\n%s", want, out)
+		}
+	}
+	// The HTTPS request failed, so it has no latency to compare.
+	for _, unwanted := range []string{"Resolved addresses", "https total", "No differences"} {
+		if strings.Contains(out, unwanted) {
+			t.Errorf("the output contains %q:\n%s", unwanted, out)
+		}
+	}
+
+	buf.Reset()
+	compareAnalyses(&buf, b, b)
+	if !strings.Contains(buf.String(), "\nNo differences found.\n") {
+		t.Errorf("comparing an archive with itself:\n%s", buf.String())
+	}
+}
+
+func TestReadAnalysisErrors(t *testing.T) {
+	dir := t.TempDir()
+	encrypted := filepath.Join(dir, "encrypted.zip.age")
+	if err := os.WriteFile(encrypted, []byte("age-encryption.org/v1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	noReport := filepath.Join(dir, "no-report.zip")
+	w, err := NewArchiveWriter(FormatZip, noReport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile("hosts", nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		encrypted:                         "is encrypted",
+		noReport:                          "does not contain report.json",
+		filepath.Join(dir, "missing.zip"): "error opening archive",
+	} {
+		_, err := readAnalysis(path)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("readAnalysis(%s) = %v, want %q", filepath.Base(path), err, want)
+		}
+	}
+}
+
+func TestDiffLists(t *testing.T) {
+	got := diffLists([]string{"a", "b", "c"}, []string{"c", "d", "a"})
+	if want := "- b,+ d"; strings.Join(got, ",") != want {
+		t.Errorf("diffLists = %v, want %s", got, want)
+	}
+	if got := diffLists([]string{"a"}, []string{"a"}); got != nil {
+		t.Errorf("diffLists of equal lists = %v", got)
+	}
+}
@@ -0,0 +1,172 @@
+package analyzer
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// config is the contents of the file given with --config. For example:
+//
+//	# Run plugins in addition to those in --plugins-dir.
+//	plugins = ["/opt/diagnostics/check-vpn.sh"]
+//
+//	# Disable a built-in task.
+//	[[task]]
+//	name    = "geoip.maxmind.com-ping-ipv6"
+//	enabled = false
+//
+//	# Give a built-in task longer to run.
+//	[[task]]
+//	name    = "geoip.maxmind.com-dig-google-trace"
+//	timeout = "2m"
+//
+//	# Add a command.
+//	[[task]]
+//	name    = "uptime"
+//	command = "uptime"
+//	output  = "uptime.txt"
+//	timeout = "30s"
+//
+//	# Add a rule for --redact.
+//	[[redact]]
+//	pattern     = "customer-[0-9]+"
+//	replacement = "[REDACTED-CUSTOMER]"
+//
+//	# The SMTP server for --email-to. The password may instead be given
+//	# with MM_NETWORK_ANALYZER_SMTP_PASSWORD.
+//	[email]
+//	server   = "smtp.example.com:587"
+//	from     = "Network diagnostics <diagnostics@example.com>"
+//	username = "diagnostics"
+type config struct {
+	Plugins []string       `toml:"plugins"`
+	Tasks   []taskConfig   `toml:"task"`
+	Redact  []redactConfig `toml:"redact"`
+	Email   *emailConfig   `toml:"email"`
+}
+
+// redactConfig is an additional rule used by --redact. The replacement
+// defaults to "[REDACTED]".
+type redactConfig struct {
+	Pattern     string `toml:"pattern"`
+	Replacement string `toml:"replacement"`
+}
+
+// taskConfig defines a task or changes a built-in task. If command is set,
+// the task runs the command, replacing any built-in task of the same name.
+// Otherwise, the entry only applies to the built-in task with that name,
+// which may be disabled or given a different timeout.
+type taskConfig struct {
+	Name    string   `toml:"name"`
+	Enabled *bool    `toml:"enabled"`
+	Command string   `toml:"command"`
+	Args    []string `toml:"args"`
+	Tags    []string `toml:"tags"`
+	Output  string   `toml:"output"`
+	Timeout string   `toml:"timeout"`
+}
+
+func loadConfig(path string) (*config, error) {
+	var c config
+	md, err := toml.DecodeFile(path, &c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading config file %s", path)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, errors.Errorf("unknown key %q in config file %s", undecoded[0].String(), path)
+	}
+	for _, tc := range c.Tasks {
+		if tc.Name == "" {
+			return nil, errors.Errorf("task without a name in config file %s", path)
+		}
+	}
+	return &c, nil
+}
+
+// apply returns tasks after replacing, disabling, and adding tasks as
+// configured.
+func (c *config) apply(a *analyzer, tasks []*task) ([]*task, error) {
+	byName := map[string]int{}
+	for i, t := range tasks {
+		byName[t.name] = i
+	}
+
+	for _, tc := range c.Tasks {
+		i, builtIn := byName[tc.Name]
+
+		if tc.Command != "" {
+			t, err := a.createConfigTask(tc)
+			if err != nil {
+				return nil, err
+			}
+			if builtIn {
+				tasks[i] = t
+			} else {
+				byName[tc.Name] = len(tasks)
+				tasks = append(tasks, t)
+			}
+			i, builtIn = byName[tc.Name], true
+		}
+
+		if !builtIn {
+			// The task may be for a host that is not being diagnosed in
+			// this run, so this is not fatal.
+			slog.Warn("config refers to unknown task", "task", tc.Name)
+			continue
+		}
+		if tc.Enabled != nil && !*tc.Enabled {
+			tasks[i] = nil
+			continue
+		}
+		if tc.Command == "" && tc.Timeout != "" {
+			timeout, err := parseTaskTimeout(tc)
+			if err != nil {
+				return nil, err
+			}
+			tasks[i].timeout = timeout
+		}
+	}
+
+	var enabled []*task
+	for _, t := range tasks {
+		if t != nil {
+			enabled = append(enabled, t)
+		}
+	}
+	return enabled, nil
+}
+
+func (a *analyzer) createConfigTask(tc taskConfig) (*task, error) {
+	timeout, err := parseTaskTimeout(tc)
+	if err != nil {
+		return nil, err
+	}
+
+	output := tc.Output
+	if output == "" {
+		output = tc.Name + ".txt"
+	}
+
+	t := a.createStoreCommand(output, tc.Command, tc.Args...)
+	t.name = tc.Name
+	return t.withTags(tc.Tags...).withTimeout(timeout), nil
+}
+
+// parseTaskTimeout returns the timeout set for the task, or zero if none
+// is set.
+func parseTaskTimeout(tc taskConfig) (time.Duration, error) {
+	if tc.Timeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(tc.Timeout)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error parsing timeout for task %q", tc.Name)
+	}
+	if timeout <= 0 {
+		return 0, errors.Errorf("timeout for task %q must be positive", tc.Name)
+	}
+	return timeout, nil
+}
@@ -0,0 +1,110 @@
+package analyzer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	c, err := loadConfig(writeConfig(t, `
+[[task]]
+name    = "uptime"
+command = "uptime"
+args    = ["-p"]
+tags    = ["local"]
+timeout = "30s"
+
+[[task]]
+name    = "ntp"
+enabled = false
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Tasks) != 2 || c.Tasks[0].Command != "uptime" || !reflect.DeepEqual(c.Tasks[0].Args, []string{"-p"}) {
+		t.Errorf("tasks = %+v", c.Tasks)
+	}
+	if c.Tasks[1].Enabled == nil || *c.Tasks[1].Enabled {
+		t.Errorf("ntp is not disabled: %+v", c.Tasks[1])
+	}
+
+	for contents, want := range map[string]string{
+		"[[task]]\nname = \"x\"\ncommand = \"x\"\ntimout = \"1s\"\n": `unknown key "task.timout"`,
+		"[[task]]\ncommand = \"uptime\"\n":                           "task without a name",
+		"[[task]\n":                                                  "error reading config file",
+	} {
+		_, err := loadConfig(writeConfig(t, contents))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadConfig(%q) = %v, want %q", contents, err, want)
+		}
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	a := &analyzer{}
+	builtIn := func() []*task {
+		return []*task{
+			newTask("ntp.json", nil),
+			newTask("resolv.conf", nil),
+			newTask("hosts", nil),
+		}
+	}
+	disabled := false
+	c := &config{Tasks: []taskConfig{
+		{Name: "ntp", Enabled: &disabled},
+		{Name: "hosts", Timeout: "5s"},
+		{Name: "resolv", Command: "cat", Args: []string{"/etc/resolv.conf"}, Output: "resolv.txt"},
+		{Name: "uptime", Command: "uptime", Tags: []string{tagLocal}, Timeout: "30s"},
+		{Name: "not-a-task", Timeout: "1s"},
+	}}
+	tasks, err := c.apply(a, builtIn())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	byName := map[string]*task{}
+	for _, task := range tasks {
+		names = append(names, task.name)
+		byName[task.name] = task
+	}
+	// The replaced task keeps its place and new tasks are added at the end.
+	if want := []string{"resolv", "hosts", "uptime"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("tasks = %v, want %v", names, want)
+	}
+	if got := byName["hosts"].timeout; got != 5*time.Second {
+		t.Errorf("hosts has the timeout %s", got)
+	}
+	resolv := byName["resolv"]
+	if !reflect.DeepEqual(resolv.command, []string{"cat", "/etc/resolv.conf"}) || resolv.outputs[0] != "resolv.txt" {
+		t.Errorf("resolv runs %v into %v", resolv.command, resolv.outputs)
+	}
+	uptime := byName["uptime"]
+	if uptime.outputs[0] != "uptime.txt" || uptime.timeout != 30*time.Second || !uptime.matches(tagLocal) {
+		t.Errorf("uptime = %+v", uptime)
+	}
+
+	for _, bad := range []taskConfig{
+		{Name: "hosts", Timeout: "soon"},
+		{Name: "hosts", Timeout: "-1s"},
+		{Name: "uptime", Command: "uptime", Timeout: "0s"},
+	} {
+		c := &config{Tasks: []taskConfig{bad}}
+		if _, err := c.apply(a, builtIn()); err == nil {
+			t.Errorf("apply accepted %+v", bad)
+		}
+	}
+}
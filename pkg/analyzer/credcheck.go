@@ -0,0 +1,151 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// credentialCheck is the result of authenticating to one of MaxMind's
+// services. FailedStep is the first step that failed: "dns", "tcp", "tls",
+// or "auth".
+type credentialCheck struct {
+	Service    string          `json:"service"`
+	URL        string          `json:"url"`
+	Network    *endpointHealth `json:"network"`
+	Auth       endpointCheck   `json:"auth"`
+	StatusCode int             `json:"status_code,omitempty"`
+	// Code is the error code in the body of an error response, e.g.,
+	// AUTHORIZATION_INVALID.
+	Code       string `json:"code,omitempty"`
+	FailedStep string `json:"failed_step,omitempty"`
+	Diagnosis  string `json:"diagnosis,omitempty"`
+}
+
+// addCredentialChecks authenticates to the database update service and the
+// GeoIP web service with the given credentials, recording which step of
+// each fails, and writes the results to credentials.json. The web service
+// request uses one GeoIP2 Country query.
+func (a *analyzer) addCredentialChecks(ctx context.Context) {
+	edition := configuredEdition()
+
+	checks := []*credentialCheck{
+		{
+			Service: "database update service",
+			URL:     "https://updates.maxmind.com/geoip/updates/metadata?edition_id=" + url.QueryEscape(edition),
+		},
+		{
+			Service: "GeoIP web service",
+			URL:     "https://" + defaultHost + "/geoip/v2.1/country/me",
+		},
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range checks {
+		wg.Add(1)
+		go func(c *credentialCheck) {
+			defer wg.Done()
+			a.checkCredentials(ctx, c)
+		}(c)
+	}
+	wg.Wait()
+
+	b, err := json.MarshalIndent(checks, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding credentials.json"))
+		return
+	}
+	a.storeFile("credentials.json", b)
+	a.storeResult("credentials", checks)
+}
+
+// checkCredentials checks the network path to c.URL and then makes an
+// authenticated request to it.
+func (a *analyzer) checkCredentials(ctx context.Context, c *credentialCheck) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		c.FailedStep = "auth"
+		c.Auth.Error = err.Error()
+		return
+	}
+	c.Network = checkEndpoint(ctx, u.Hostname())
+	switch {
+	case !c.Network.DNS.OK:
+		c.FailedStep = "dns"
+		c.Diagnosis = u.Hostname() + " could not be resolved"
+		return
+	case !c.Network.TCP.OK:
+		c.FailedStep = "tcp"
+		c.Diagnosis = "could not connect to " + u.Hostname() + " on port 443; check firewalls and proxies"
+		return
+	case !c.Network.TLS.OK:
+		c.FailedStep = "tls"
+		c.Diagnosis = "the TLS handshake with " + u.Hostname() + " failed; a proxy may be intercepting TLS"
+		return
+	}
+	a.checkAuth(ctx, c)
+}
+
+// checkAuth makes an authenticated request to c.URL and diagnoses an error
+// response.
+func (a *analyzer) checkAuth(ctx context.Context, c *credentialCheck) {
+	ctx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.URL, nil)
+	if err != nil {
+		c.FailedStep = "auth"
+		c.Auth.Error = err.Error()
+		return
+	}
+	req.SetBasicAuth(a.credentials.accountID, a.credentials.licenseKey)
+	req.Header.Set("User-Agent", os.Args[0])
+
+	start := time.Now()
+	resp, err := a.dial.httpClient().Do(req)
+	if err != nil {
+		c.Auth = newEndpointCheck(start, err)
+		c.FailedStep = "auth"
+		c.Diagnosis = "the request failed after the connection succeeded"
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	c.Auth = newEndpointCheck(start, err)
+	c.StatusCode = resp.StatusCode
+
+	var parsed struct {
+		Code  string `json:"code"`
+		Error string `json:"error"`
+	}
+	_ = json.Unmarshal(body, &parsed)
+	c.Code = parsed.Code
+
+	if resp.StatusCode == http.StatusOK {
+		return
+	}
+	c.Auth.OK = false
+	c.Auth.Error = resp.Status
+	if parsed.Error != "" {
+		c.Auth.Error += ": " + parsed.Error
+	}
+	c.FailedStep = "auth"
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		c.Diagnosis = "the account ID or license key is invalid"
+	case http.StatusPaymentRequired:
+		c.Diagnosis = "the account has no remaining queries or funds for this service"
+	case http.StatusForbidden:
+		c.Diagnosis = "the credentials are valid but the account does not have access to this service or edition"
+	case http.StatusTooManyRequests:
+		c.Diagnosis = "requests are being rate limited"
+	default:
+		c.Diagnosis = "unexpected response; a proxy may have answered instead of MaxMind"
+	}
+}
@@ -0,0 +1,90 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, key, _ := r.BasicAuth()
+		switch {
+		case id != "42":
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code":"ACCOUNT_ID_UNKNOWN","error":"Unknown account ID."}`))
+		case key == "no-funds":
+			w.WriteHeader(http.StatusPaymentRequired)
+			_, _ = w.Write([]byte(`{"code":"INSUFFICIENT_FUNDS","error":"Out of queries."}`))
+		case key == "no-access":
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"code":"PERMISSION_REQUIRED","error":"No access to this service."}`))
+		case key == "busy":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case key == "proxy":
+			http.Error(w, "<html>Bad gateway</html>", http.StatusBadGateway)
+		default:
+			_, _ = w.Write([]byte(`{"country":{"iso_code":"US"}}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		accountID, licenseKey string
+		status                int
+		code, error           string
+		diagnosis             string
+	}{
+		{"42", "testlicensekey", http.StatusOK, "", "", ""},
+		{
+			"43", "testlicensekey", http.StatusUnauthorized, "ACCOUNT_ID_UNKNOWN",
+			"401 Unauthorized: Unknown account ID.", "the account ID or license key is invalid",
+		},
+		{
+			"42", "no-funds", http.StatusPaymentRequired, "INSUFFICIENT_FUNDS",
+			"402 Payment Required: Out of queries.", "the account has no remaining queries or funds for this service",
+		},
+		{
+			"42", "no-access", http.StatusForbidden, "PERMISSION_REQUIRED",
+			"403 Forbidden: No access to this service.",
+			"the credentials are valid but the account does not have access to this service or edition",
+		},
+		{"42", "busy", http.StatusTooManyRequests, "", "429 Too Many Requests", "requests are being rate limited"},
+		{
+			"42", "proxy", http.StatusBadGateway, "", "502 Bad Gateway",
+			"unexpected response; a proxy may have answered instead of MaxMind",
+		},
+	}
+	for _, test := range tests {
+		a := &analyzer{credentials: &credentials{accountID: test.accountID, licenseKey: test.licenseKey}}
+		c := &credentialCheck{Service: "GeoIP web service", URL: server.URL + "/geoip/v2.1/country/me"}
+		a.checkAuth(context.Background(), c)
+
+		failedStep := ""
+		if test.status != http.StatusOK {
+			failedStep = "auth"
+		}
+		if c.StatusCode != test.status || c.Code != test.code || c.Auth.Error != test.error ||
+			c.Auth.OK != (test.status == http.StatusOK) || c.FailedStep != failedStep || c.Diagnosis != test.diagnosis {
+			t.Errorf("%s/%s: check = %+v", test.accountID, test.licenseKey, c)
+		}
+	}
+}
+
+func TestCheckCredentialsDNSFailure(t *testing.T) {
+	a := &analyzer{credentials: &credentials{accountID: "42", licenseKey: "testlicensekey"}}
+	// .invalid names never resolve (RFC 6761).
+	c := &credentialCheck{Service: "database update service", URL: "https://updates.invalid/geoip/updates/metadata"}
+	a.checkCredentials(context.Background(), c)
+	if c.FailedStep != "dns" || c.Diagnosis != "updates.invalid could not be resolved" || c.StatusCode != 0 {
+		t.Errorf("check = %+v", c)
+	}
+
+	fs := findingsFor(map[string]interface{}{"credentials": []*credentialCheck{c}})
+	want := "authenticating to the database update service failed at the dns step: " +
+		"updates.invalid could not be resolved"
+	if len(fs) != 1 || fs[0].Check != "credentials-failure" || fs[0].Summary != want {
+		t.Errorf("findings = %+v", fs)
+	}
+}
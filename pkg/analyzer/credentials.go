@@ -0,0 +1,48 @@
+package analyzer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+// licenseKeyEnv may hold the license key for --account-id so that it need
+// not be typed and does not appear in the process list.
+const licenseKeyEnv = "MM_NETWORK_ANALYZER_LICENSE_KEY"
+
+// credentials are a MaxMind account ID and license key. They are used to
+// check access to MaxMind's services and are never written to the archive.
+type credentials struct {
+	accountID  string
+	licenseKey string
+}
+
+// readCredentials returns the credentials for accountID, or nil if it is
+// empty. The license key is read from licenseKeyEnv or the terminal.
+func readCredentials(accountID string) (*credentials, error) {
+	if accountID == "" {
+		return nil, nil
+	}
+	if key := os.Getenv(licenseKeyEnv); key != "" {
+		return &credentials{accountID: accountID, licenseKey: key}, nil
+	}
+	fd := int(os.Stdin.Fd()) // nolint: gosec
+	if !term.IsTerminal(fd) {
+		return nil, errors.Errorf("%s must be set when not running in a terminal", licenseKeyEnv)
+	}
+
+	fmt.Fprintf(os.Stderr, "License key for account %s: ", accountID)
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading license key")
+	}
+	key := strings.TrimSpace(string(b))
+	if key == "" {
+		return nil, errors.New("empty license key")
+	}
+	return &credentials{accountID: accountID, licenseKey: key}, nil
+}
@@ -0,0 +1,37 @@
+package analyzer
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadCredentials(t *testing.T) {
+	c, err := readCredentials("")
+	if c != nil || err != nil {
+		t.Errorf("readCredentials without an account ID = %+v, %v", c, err)
+	}
+
+	t.Setenv(licenseKeyEnv, "testlicensekey")
+	c, err = readCredentials("42")
+	if err != nil || c.accountID != "42" || c.licenseKey != "testlicensekey" {
+		t.Errorf("readCredentials = %+v, %v", c, err)
+	}
+}
+
+func TestReadCredentialsWithoutTerminal(t *testing.T) {
+	t.Setenv(licenseKeyEnv, "")
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	stdin := os.Stdin
+	os.Stdin = devNull
+	defer func() { os.Stdin = stdin }()
+
+	_, err = readCredentials("42")
+	if err == nil || !strings.Contains(err.Error(), licenseKeyEnv+" must be set") {
+		t.Errorf("readCredentials = %v", err)
+	}
+}
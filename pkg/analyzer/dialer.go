@@ -0,0 +1,216 @@
+package analyzer
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// dialConfig is how the probes connect. --ipv4 and --ipv6 restrict every
+// connection to one address family, and --source-ip and --interface bind
+// every probe to one address or interface, e.g., to test one uplink of a
+// multihomed server or the path outside of a VPN. A nil *dialConfig places
+// no restrictions.
+type dialConfig struct {
+	// family is "4" or "6" to restrict connections to that address family,
+	// and "" otherwise.
+	family string
+	ip     net.IP
+	iface  *net.Interface
+	// client is used by the tasks that make plain HTTP requests. Its
+	// transport dials with the config rather than changing
+	// http.DefaultTransport, which belongs to the whole process.
+	client *http.Client
+}
+
+// newDialConfig validates the --ipv4 or --ipv6, --source-ip, and
+// --interface values. family is "4", "6", or "". A source address implies
+// its address family.
+func newDialConfig(family, ip, ifaceName string) (*dialConfig, error) {
+	d := &dialConfig{family: family}
+	switch family {
+	case "", "4", "6":
+	default:
+		return nil, errors.Errorf("invalid IP version %s", family)
+	}
+	if ip != "" {
+		d.ip = net.ParseIP(ip)
+		if d.ip == nil {
+			return nil, errors.Errorf("invalid source IP address %q", ip)
+		}
+		ipFamily := "6"
+		if ip4 := d.ip.To4(); ip4 != nil {
+			d.ip, ipFamily = ip4, "4"
+		}
+		if family != "" && family != ipFamily {
+			return nil, errors.Errorf("the source IP address %s is not an IPv%s address", ip, family)
+		}
+		d.family = ipFamily
+	}
+	if ifaceName != "" {
+		iface, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error finding interface %s", ifaceName)
+		}
+		d.iface = iface
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = d.dialContext
+	d.client = &http.Client{Transport: transport}
+	return d, nil
+}
+
+type dialConfigKey struct{}
+
+// dialConfigFromContext returns the dialConfig of the analyzer running the
+// task, or nil if ctx is not a task's context.
+func dialConfigFromContext(ctx context.Context) *dialConfig {
+	d, _ := ctx.Value(dialConfigKey{}).(*dialConfig)
+	return d
+}
+
+// addressFamily returns "4" or "6" if connections are restricted to that
+// address family, and "" otherwise.
+func (d *dialConfig) addressFamily() string {
+	if d == nil {
+		return ""
+	}
+	return d.family
+}
+
+// httpClient returns the client for plain HTTP requests.
+func (d *dialConfig) httpClient() *http.Client {
+	if d == nil || d.client == nil {
+		return http.DefaultClient
+	}
+	return d.client
+}
+
+// restrictNetwork returns network, e.g., "tcp", "udp", or miekg/dns's
+// "tcp-tls", limited to the address family. Networks that already name a
+// family are returned unchanged.
+func (d *dialConfig) restrictNetwork(network string) string {
+	family := d.addressFamily()
+	if family == "" {
+		return network
+	}
+	base, suffix, _ := strings.Cut(network, "-")
+	switch base {
+	case "tcp", "udp", "ip":
+	default:
+		return network
+	}
+	network = base + family
+	if suffix != "" {
+		network += "-" + suffix
+	}
+	return network
+}
+
+// filterFamily removes the tasks for the address family that --ipv4 or
+// --ipv6 excludes. These are named with an -ipv4 or -ipv6 suffix.
+func (d *dialConfig) filterFamily(tasks []*task) []*task {
+	var excluded string
+	switch d.addressFamily() {
+	case "4":
+		excluded = "-ipv6"
+	case "6":
+		excluded = "-ipv4"
+	default:
+		return tasks
+	}
+	var filtered []*task
+	for _, t := range tasks {
+		if !strings.HasSuffix(t.name, excluded) {
+			filtered = append(filtered, t)
+		}
+	}
+	return filtered
+}
+
+// isIPv6Network returns true if network, e.g., "tcp6" or "ip6:ipv6-icmp",
+// is an IPv6 network.
+func isIPv6Network(network string) bool {
+	return strings.Contains(network, "6")
+}
+
+// sourceIP returns the address given with --source-ip, or nil.
+func (d *dialConfig) sourceIP() net.IP {
+	if d == nil {
+		return nil
+	}
+	return d.ip
+}
+
+// sourceInterface returns the interface given with --interface, or nil.
+func (d *dialConfig) sourceInterface() *net.Interface {
+	if d == nil {
+		return nil
+	}
+	return d.iface
+}
+
+// newDialer returns a dialer for network that binds to the source address
+// and interface, if set.
+func (d *dialConfig) newDialer(network string) *net.Dialer {
+	dialer := &net.Dialer{Control: d.bindControl}
+	switch ip := d.sourceIP(); {
+	case ip == nil:
+	case strings.HasPrefix(network, "udp"):
+		dialer.LocalAddr = &net.UDPAddr{IP: ip}
+	default:
+		dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	return dialer
+}
+
+// bindControl binds the socket to the source interface, if set. It is a
+// net.Dialer and net.ListenConfig Control function.
+func (d *dialConfig) bindControl(network, _ string, c syscall.RawConn) error {
+	iface := d.sourceInterface()
+	if iface == nil {
+		return nil
+	}
+	return bindToInterface(c, network, iface)
+}
+
+// listenAddr returns the IP address to listen on for network, "ip4" or
+// "ip6". It is the source address or, with --interface, the first address
+// of that family on the interface. The ICMP sockets can only be bound this
+// way, as golang.org/x/net/icmp does not take a Control function.
+func (d *dialConfig) listenAddr(network string) string {
+	if ip := d.sourceIP(); ip != nil {
+		return ip.String()
+	}
+	if iface := d.sourceInterface(); iface != nil {
+		addrs, err := iface.Addrs()
+		if err == nil {
+			for _, addr := range addrs {
+				ipNet, ok := addr.(*net.IPNet)
+				if ok && ipNetwork(ipNet.IP) == network && !ipNet.IP.IsLinkLocalUnicast() {
+					return ipNet.IP.String()
+				}
+			}
+		}
+	}
+	if network == "ip6" {
+		return "::"
+	}
+	return "0.0.0.0"
+}
+
+// dialContext is an http.Transport DialContext that restricts the
+// connection to the address family and binds it to the source address and
+// interface.
+func (d *dialConfig) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := d.newDialer(network)
+	dialer.Timeout = 30 * time.Second
+	dialer.KeepAlive = 30 * time.Second
+	return dialer.DialContext(ctx, d.restrictNetwork(network), addr)
+}
@@ -0,0 +1,282 @@
+package analyzer
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestNewDialConfig(t *testing.T) {
+	tests := []struct {
+		family string
+		ip     string
+		want   string
+		wantIP net.IP
+	}{
+		{"", "", "", nil},
+		{"4", "", "4", nil},
+		{"6", "", "6", nil},
+		{"", "127.0.0.1", "4", net.IPv4(127, 0, 0, 1).To4()},
+		{"4", "127.0.0.1", "4", net.IPv4(127, 0, 0, 1).To4()},
+		{"", "::1", "6", net.IPv6loopback},
+		{"6", "::1", "6", net.IPv6loopback},
+	}
+	for _, test := range tests {
+		d, err := newDialConfig(test.family, test.ip, "")
+		if err != nil {
+			t.Errorf("newDialConfig(%q, %q): %v", test.family, test.ip, err)
+			continue
+		}
+		if d.addressFamily() != test.want || !d.sourceIP().Equal(test.wantIP) {
+			t.Errorf("newDialConfig(%q, %q) = %s and %s", test.family, test.ip, d.addressFamily(), d.sourceIP())
+		}
+	}
+
+	for _, bad := range []struct{ family, ip, iface string }{
+		{"5", "", ""},
+		{"", "not an address", ""},
+		{"6", "127.0.0.1", ""},
+		{"4", "::1", ""},
+		{"", "", "no-such-interface0"},
+	} {
+		if _, err := newDialConfig(bad.family, bad.ip, bad.iface); err == nil {
+			t.Errorf("newDialConfig(%q, %q, %q) succeeded", bad.family, bad.ip, bad.iface)
+		}
+	}
+}
+
+func TestDialConfigDoesNotChangeDefaultTransport(t *testing.T) {
+	dialContext := func() uintptr {
+		return reflect.ValueOf(http.DefaultTransport.(*http.Transport).DialContext).Pointer()
+	}
+	before := dialContext()
+	d, err := newDialConfig("", "127.0.0.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dialContext() != before {
+		t.Error("http.DefaultTransport was changed")
+	}
+	if d.httpClient() == http.DefaultClient || d.httpClient().Transport == http.DefaultTransport {
+		t.Error("the config uses the default client")
+	}
+	var nilConfig *dialConfig
+	if nilConfig.httpClient() != http.DefaultClient {
+		t.Error("a nil config does not use the default client")
+	}
+}
+
+func TestRestrictNetwork(t *testing.T) {
+	tests := []struct {
+		family  string
+		network string
+		want    string
+	}{
+		{"", "tcp", "tcp"},
+		{"4", "tcp", "tcp4"},
+		{"6", "udp", "udp6"},
+		{"4", "ip", "ip4"},
+		{"6", "tcp-tls", "tcp6-tls"},
+		{"4", "tcp6", "tcp6"},
+		{"4", "unix", "unix"},
+	}
+	for _, test := range tests {
+		d := &dialConfig{family: test.family}
+		if got := d.restrictNetwork(test.network); got != test.want {
+			t.Errorf("restrictNetwork(%q) with family %q = %q, want %q", test.network, test.family, got, test.want)
+		}
+	}
+	var d *dialConfig
+	if got := d.restrictNetwork("tcp"); got != "tcp" {
+		t.Errorf("nil config restricted tcp to %q", got)
+	}
+}
+
+func TestDialContextRestrictsFamily(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	ctx := context.Background()
+	conn, err := (&dialConfig{family: "4"}).dialContext(ctx, "tcp", net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host, _, _ := net.SplitHostPort(conn.RemoteAddr().String()); host != "127.0.0.1" {
+		t.Errorf("connected to %s", conn.RemoteAddr())
+	}
+	_ = conn.Close()
+
+	if _, err := (&dialConfig{family: "6"}).dialContext(ctx, "tcp", l.Addr().String()); err == nil {
+		t.Error("connected to an IPv4 address over IPv6")
+	}
+}
+
+func TestFilterFamily(t *testing.T) {
+	tasks := []*task{{name: "ping-ipv4"}, {name: "ping-ipv6"}, {name: "dns"}}
+	names := func(tasks []*task) []string {
+		var names []string
+		for _, t := range tasks {
+			names = append(names, t.name)
+		}
+		return names
+	}
+	tests := []struct {
+		d    *dialConfig
+		want []string
+	}{
+		{nil, []string{"ping-ipv4", "ping-ipv6", "dns"}},
+		{&dialConfig{family: "4"}, []string{"ping-ipv4", "dns"}},
+		{&dialConfig{family: "6"}, []string{"ping-ipv6", "dns"}},
+	}
+	for _, test := range tests {
+		if got := names(test.d.filterFamily(tasks)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("family %q kept %v, want %v", test.d.addressFamily(), got, test.want)
+		}
+	}
+}
+
+func TestNewDialerSource(t *testing.T) {
+	d := &dialConfig{ip: net.IPv4(192, 0, 2, 1)}
+	if addr, ok := d.newDialer("udp").LocalAddr.(*net.UDPAddr); !ok || !addr.IP.Equal(d.ip) {
+		t.Errorf("UDP local address = %v", d.newDialer("udp").LocalAddr)
+	}
+	if addr, ok := d.newDialer("tcp").LocalAddr.(*net.TCPAddr); !ok || !addr.IP.Equal(d.ip) {
+		t.Errorf("TCP local address = %v", d.newDialer("tcp").LocalAddr)
+	}
+	var nilConfig *dialConfig
+	if addr := nilConfig.newDialer("tcp").LocalAddr; addr != nil {
+		t.Errorf("nil config has local address %v", addr)
+	}
+	if got := d.listenAddr("ip4"); got != "192.0.2.1" {
+		t.Errorf("listenAddr = %s", got)
+	}
+	if got := nilConfig.listenAddr("ip6"); got != "::" {
+		t.Errorf("nil config listenAddr = %s", got)
+	}
+}
+
+func TestBindControl(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		t.Skip("binding to an interface is not supported on this platform")
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loopback *net.Interface
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			loopback = &iface
+			break
+		}
+	}
+	if loopback == nil {
+		t.Skip("there is no loopback interface")
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	d := &dialConfig{iface: loopback}
+	conn, err := d.newDialer("tcp").Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("connecting over %s: %v", loopback.Name, err)
+	}
+	_ = conn.Close()
+	if got := d.listenAddr("ip4"); got != "127.0.0.1" {
+		t.Errorf("listenAddr on %s = %s", loopback.Name, got)
+	}
+}
+
+func TestIsIPv6Network(t *testing.T) {
+	for network, want := range map[string]bool{
+		"tcp": false, "tcp4": false, "udp4": false, "ip4:icmp": false,
+		"tcp6": true, "udp6": true, "ip6:ipv6-icmp": true,
+	} {
+		if got := isIPv6Network(network); got != want {
+			t.Errorf("isIPv6Network(%q) = %v", network, got)
+		}
+	}
+}
+
+// memoryArchive is an ArchiveWriter that keeps the files in memory.
+type memoryArchive map[string][]byte
+
+func (m memoryArchive) WriteFile(name string, contents []byte, _ time.Time) error {
+	m[name] = contents
+	return nil
+}
+
+func (memoryArchive) Close() error { return nil }
+
+type funcTask struct {
+	name string
+	run  func(ctx context.Context, c *Collector)
+}
+
+func (t funcTask) Name() string                          { return t.name }
+func (t funcTask) Run(ctx context.Context, c *Collector) { t.run(ctx, c) }
+
+func TestCollectorDialOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RemoteAddr)
+	}))
+	defer server.Close()
+
+	c := NewCollector(Options{NoBuiltinTasks: true, IPVersion: 4, SourceIP: "127.0.0.1"})
+	var family, remote string
+	c.Register(funcTask{name: "check.txt", run: func(ctx context.Context, c *Collector) {
+		dial := dialConfigFromContext(ctx)
+		family = dial.addressFamily()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		if err != nil {
+			c.StoreError(ctx, err)
+			return
+		}
+		resp, err := dial.httpClient().Do(req)
+		if err != nil {
+			c.StoreError(ctx, err)
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		remote = string(b)
+	}})
+	ran := false
+	c.Register(funcTask{name: "skipped-ipv6.txt", run: func(context.Context, *Collector) { ran = true }})
+
+	if _, err := c.Run(context.Background(), memoryArchive{}); err != nil {
+		t.Fatal(err)
+	}
+	if family != "4" {
+		t.Errorf("the task ran with family %q, want 4", family)
+	}
+	if host, _, _ := net.SplitHostPort(remote); host != "127.0.0.1" {
+		t.Errorf("the request came from %q", remote)
+	}
+	if ran {
+		t.Error("the IPv6 task ran with IPVersion 4")
+	}
+}
+
+func TestCollectorInvalidOptions(t *testing.T) {
+	c := NewCollector(Options{NoBuiltinTasks: true, IPVersion: 6, SourceIP: "127.0.0.1"})
+	c.Register(funcTask{name: "never.txt", run: func(context.Context, *Collector) {
+		t.Error("a task ran despite invalid options")
+	}})
+	if _, err := c.Run(context.Background(), memoryArchive{}); err == nil {
+		t.Error("Run succeeded with invalid options")
+	}
+}
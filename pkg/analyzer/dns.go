@@ -0,0 +1,454 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+const (
+	resolvConfPath = "/etc/resolv.conf"
+
+	// This matches the default EDNS0 buffer size used by recent versions
+	// of dig.
+	ednsBufferSize = 1232
+
+	// maxTraceDepth bounds the number of referrals we follow when doing
+	// iterative resolution.
+	maxTraceDepth = 16
+
+	// Transports for dnsOptions. dnsOverTCP sends queries over TCP only,
+	// dnsOverTLS with DNS over TLS (RFC 7858), and dnsOverHTTPS with DNS
+	// over HTTPS (RFC 8484).
+	dnsOverTCP   = "tcp"
+	dnsOverTLS   = "tls"
+	dnsOverHTTPS = "https"
+)
+
+// dnsQuery is a single question to ask a server.
+type dnsQuery struct {
+	name   string
+	qtype  uint16
+	qclass uint16
+}
+
+func newDNSQuery(name string, qtype uint16) dnsQuery {
+	return dnsQuery{name: name, qtype: qtype, qclass: dns.ClassINET}
+}
+
+func newChaosQuery(name string, qtype uint16) dnsQuery {
+	return dnsQuery{name: name, qtype: qtype, qclass: dns.ClassCHAOS}
+}
+
+func (q dnsQuery) String() string {
+	return fmt.Sprintf("%s %s %s", dns.Fqdn(q.name), dns.ClassToString[q.qclass], dns.TypeToString[q.qtype])
+}
+
+// dnsOptions controls how queries are made and what is written.
+type dnsOptions struct {
+	// server is the server to query. It may be a host name or an IP
+	// address, optionally with a port. If it is empty, the first
+	// nameserver in resolv.conf is used.
+	server string
+	// nsid requests the name server identifier (RFC 5001).
+	nsid bool
+	// short writes only the answer data, like dig +short.
+	short bool
+	// trace does iterative resolution from the root, like dig +trace.
+	trace bool
+	// transport is how queries are sent. By default, they are sent over
+	// UDP, falling back to TCP. With dnsOverTLS, the port defaults to 853.
+	// With dnsOverHTTPS, server is the URL of the DNS over HTTPS endpoint.
+	transport string
+	// clientSubnet, if set, is sent as the EDNS Client Subnet option
+	// (RFC 7871), e.g., "216.160.83.0/24".
+	clientSubnet string
+}
+
+func (a *analyzer) createDNSTask(f string, opts dnsOptions, queries ...dnsQuery) *task {
+	return newTask(f, func(ctx context.Context) {
+		buf := new(bytes.Buffer)
+		var reports []*dnsReport
+		for _, q := range queries {
+			var r *dnsReport
+			var err error
+			if opts.trace {
+				// Retrying would repeat the referrals already written to
+				// buf, and each referral is tried with every server.
+				r, err = traceDNS(ctx, buf, opts, q)
+			} else {
+				err = a.retry(ctx, q.String(), func() error {
+					var err error
+					r, err = queryDNS(ctx, buf, opts, q)
+					return err
+				})
+			}
+			if err != nil {
+				a.storeError(ctx, errors.Wrapf(err, "error getting data for %s (%s)", f, q))
+				fmt.Fprintf(buf, ";; %s: %v\n\n", q, err)
+				r.Error = err.Error()
+			}
+			reports = append(reports, r)
+		}
+		a.storeFile(f, buf.Bytes())
+		a.storeResult(taskName(f), reports)
+	}).withTags(tagDNS).withDescription("%s", opts.describe(queries))
+}
+
+func (opts dnsOptions) describe(queries []dnsQuery) string {
+	qs := make([]string, len(queries))
+	for i, q := range queries {
+		qs[i] = q.String()
+	}
+	server := opts.server
+	if server == "" {
+		server = "the system resolver"
+	}
+	desc := fmt.Sprintf("Queries %s for %s", server, strings.Join(qs, ", "))
+	if opts.trace {
+		desc += ", following referrals from the root"
+	}
+	if opts.nsid {
+		desc += ", requesting the NSID"
+	}
+	if opts.clientSubnet != "" {
+		desc += ", with the client subnet " + opts.clientSubnet
+	}
+	return desc
+}
+
+// queryDNS asks the server in opts q and writes the response to buf. The
+// returned report is never nil.
+func queryDNS(ctx context.Context, buf *bytes.Buffer, opts dnsOptions, q dnsQuery) (*dnsReport, error) {
+	r := &dnsReport{Question: q.String()}
+
+	m := newDNSMessage(q, opts.nsid)
+	m.RecursionDesired = true
+	if opts.clientSubnet != "" {
+		subnet, err := newClientSubnetOption(opts.clientSubnet)
+		if err != nil {
+			return r, err
+		}
+		opt := m.IsEdns0()
+		opt.Option = append(opt.Option, subnet)
+	}
+
+	resp, rtt, server, err := opts.exchange(ctx, m)
+	r.Server = server
+	if err != nil {
+		return r, err
+	}
+	r.setResponse(resp, rtt)
+
+	if opts.short {
+		writeShortDNS(buf, resp)
+		return r, nil
+	}
+	writeDNSResponse(buf, resp, server, rtt)
+	return r, nil
+}
+
+func newClientSubnetOption(subnet string) (*dns.EDNS0_SUBNET, error) {
+	_, network, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing client subnet %s", subnet)
+	}
+	ones, _ := network.Mask.Size()
+	o := &dns.EDNS0_SUBNET{
+		Code:          dns.EDNS0SUBNET,
+		Family:        1,
+		SourceNetmask: uint8(ones),
+		Address:       network.IP,
+	}
+	if network.IP.To4() == nil {
+		o.Family = 2
+	}
+	return o, nil
+}
+
+// exchange sends m to the server in opts using its transport. It returns
+// the address or URL of the server, which is empty if it could not be
+// determined.
+func (opts dnsOptions) exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, time.Duration, string, error) {
+	server := opts.server
+	switch opts.transport {
+	case dnsOverHTTPS:
+		resp, rtt, err := exchangeDoH(ctx, m, server)
+		return resp, rtt, server, err
+	case dnsOverTLS:
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "853")
+		}
+	}
+
+	addr, err := resolveDNSServer(ctx, server)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	var resp *dns.Msg
+	var rtt time.Duration
+	switch opts.transport {
+	case dnsOverTCP, dnsOverTLS:
+		host, _, _ := net.SplitHostPort(server)
+		resp, rtt, err = exchangeDNSStream(ctx, m, addr, opts.transport, host)
+	default:
+		resp, rtt, err = exchangeDNS(ctx, m, addr)
+	}
+	return resp, rtt, addr, err
+}
+
+// traceDNS follows referrals from the root servers down to the servers
+// authoritative for q. The root servers are found by asking opts.server.
+func traceDNS(ctx context.Context, buf *bytes.Buffer, opts dnsOptions, q dnsQuery) (*dnsReport, error) {
+	r := &dnsReport{Question: q.String()}
+	server, err := resolveDNSServer(ctx, opts.server)
+	if err != nil {
+		return r, err
+	}
+
+	m := newDNSMessage(newDNSQuery(".", dns.TypeNS), opts.nsid)
+	m.RecursionDesired = true
+	resp, rtt, err := exchangeDNS(ctx, m, server)
+	if err != nil {
+		return r, errors.Wrap(err, "error getting root servers")
+	}
+	writeDNSResponse(buf, resp, server, rtt)
+
+	servers := referralServers(resp.Answer, resp.Extra)
+	for depth := 0; depth < maxTraceDepth; depth++ {
+		if len(servers) == 0 {
+			return r, dnsResultErrorf("no servers to follow referral to")
+		}
+
+		m := newDNSMessage(q, opts.nsid)
+		m.RecursionDesired = false
+
+		var lastErr error
+		resp = nil
+		for _, s := range servers {
+			resp, rtt, lastErr = exchangeDNS(ctx, m, s)
+			if lastErr == nil {
+				server = s
+				break
+			}
+			fmt.Fprintf(buf, ";; error querying %s: %v\n\n", s, lastErr)
+		}
+		if resp == nil {
+			return r, errors.Wrap(lastErr, "error following referral")
+		}
+		writeDNSResponse(buf, resp, server, rtt)
+		r.Server = server
+		r.setResponse(resp, rtt)
+
+		if resp.Authoritative || len(resp.Answer) > 0 || resp.Rcode != dns.RcodeSuccess {
+			return r, nil
+		}
+
+		servers = referralServers(resp.Ns, resp.Extra)
+	}
+	return r, errors.Errorf("gave up after following %d referrals", maxTraceDepth)
+}
+
+// referralServers returns the addresses of the name servers in ns, using
+// the glue records in extra when present and looking up the name servers
+// otherwise.
+func referralServers(ns, extra []dns.RR) []string {
+	glue := map[string][]string{}
+	for _, rr := range extra {
+		switch rr := rr.(type) {
+		case *dns.A:
+			glue[strings.ToLower(rr.Hdr.Name)] = append(glue[strings.ToLower(rr.Hdr.Name)], rr.A.String())
+		case *dns.AAAA:
+			glue[strings.ToLower(rr.Hdr.Name)] = append(glue[strings.ToLower(rr.Hdr.Name)], rr.AAAA.String())
+		}
+	}
+
+	var servers []string
+	for _, rr := range ns {
+		nsRR, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+		addrs := glue[strings.ToLower(nsRR.Ns)]
+		if len(addrs) == 0 {
+			ips, err := net.LookupIP(nsRR.Ns)
+			if err != nil {
+				continue
+			}
+			for _, ip := range ips {
+				addrs = append(addrs, ip.String())
+			}
+		}
+		for _, addr := range addrs {
+			servers = append(servers, net.JoinHostPort(addr, "53"))
+		}
+	}
+	return servers
+}
+
+func newDNSMessage(q dnsQuery, nsid bool) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(q.name), q.qtype)
+	m.Question[0].Qclass = q.qclass
+	m.SetEdns0(ednsBufferSize, false)
+	if nsid {
+		opt := m.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+	}
+	return m
+}
+
+// newDNSClient returns a client for network, "udp", "tcp", or "tcp-tls",
+// that honors the --ipv4, --ipv6, --source-ip, and --interface settings of
+// the task running with ctx.
+func newDNSClient(ctx context.Context, network string) *dns.Client {
+	dial := dialConfigFromContext(ctx)
+	return &dns.Client{Net: dial.restrictNetwork(network), Dialer: dial.newDialer(network)}
+}
+
+// exchangeDNS sends m to server over UDP, retrying over TCP if the
+// response is truncated.
+func exchangeDNS(ctx context.Context, m *dns.Msg, server string) (*dns.Msg, time.Duration, error) {
+	c := newDNSClient(ctx, "udp")
+	c.UDPSize = ednsBufferSize
+	resp, rtt, err := c.ExchangeContext(ctx, m, server)
+	if err == nil && resp.Truncated {
+		resp, rtt, err = newDNSClient(ctx, "tcp").ExchangeContext(ctx, m, server)
+	}
+	if err != nil {
+		return nil, rtt, errors.Wrapf(err, "error querying %s", server)
+	}
+	return resp, rtt, nil
+}
+
+// exchangeDNSStream sends m to server over TCP or, for dnsOverTLS, TLS. The
+// server's certificate must be valid for serverName, which may be an IP
+// address.
+func exchangeDNSStream(
+	ctx context.Context,
+	m *dns.Msg,
+	server, transport, serverName string,
+) (*dns.Msg, time.Duration, error) {
+	c := newDNSClient(ctx, "tcp")
+	if transport == dnsOverTLS {
+		c = newDNSClient(ctx, "tcp-tls")
+		c.TLSConfig = &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	}
+	resp, rtt, err := c.ExchangeContext(ctx, m, server)
+	if err != nil {
+		return nil, rtt, errors.Wrapf(err, "error querying %s over %s", server, transport)
+	}
+	return resp, rtt, nil
+}
+
+// exchangeDoH sends m to the DNS over HTTPS endpoint at url.
+func exchangeDoH(ctx context.Context, m *dns.Msg, url string) (*dns.Msg, time.Duration, error) {
+	// RFC 8484 recommends an ID of 0 so that responses may be cached.
+	m.Id = 0
+	packed, err := m.Pack()
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error packing query")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	req.Header.Set("User-Agent", os.Args[0])
+
+	start := time.Now()
+	resp, err := dialConfigFromContext(ctx).httpClient().Do(req)
+	if err != nil {
+		return nil, time.Since(start), errors.Wrapf(err, "error querying %s", url)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, dns.MaxMsgSize))
+	rtt := time.Since(start)
+	if err != nil {
+		return nil, rtt, errors.Wrapf(err, "error reading response from %s", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, rtt, httpStatusErrorf(resp.StatusCode, "%s returned %s", url, resp.Status)
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(body); err != nil {
+		return nil, rtt, errors.Wrapf(err, "error parsing response from %s", url)
+	}
+	return msg, rtt, nil
+}
+
+// resolveDNSServer turns server into an address to send queries to. An
+// empty server means the first nameserver from resolv.conf.
+func resolveDNSServer(ctx context.Context, server string) (string, error) {
+	if server == "" {
+		servers, err := systemResolvers()
+		if err != nil {
+			return "", err
+		}
+		return servers[0], nil
+	}
+
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		host = server
+		port = "53"
+	}
+	if net.ParseIP(host) != nil {
+		return net.JoinHostPort(host, port), nil
+	}
+
+	// Like dig -4, we only use IPv4 addresses of named servers.
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", host)
+	if err != nil {
+		return "", errors.Wrapf(err, "error looking up server %s", host)
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+func writeDNSResponse(buf *bytes.Buffer, resp *dns.Msg, server string, rtt time.Duration) {
+	buf.WriteString(resp.String())
+	fmt.Fprintf(buf, "\n;; Query time: %d msec\n", rtt.Milliseconds())
+	fmt.Fprintf(buf, ";; SERVER: %s\n", server)
+	fmt.Fprintf(buf, ";; WHEN: %s\n", time.Now().UTC().Format(time.RFC1123))
+	fmt.Fprintf(buf, ";; MSG SIZE  rcvd: %d\n\n", resp.Len())
+}
+
+func (r *dnsReport) setResponse(resp *dns.Msg, rtt time.Duration) {
+	r.Rcode = dns.RcodeToString[resp.Rcode]
+	r.RTTMS = durationMS(rtt)
+	r.Answers = nil
+	for _, rr := range resp.Answer {
+		r.Answers = append(r.Answers, rr.String())
+	}
+	r.ClientSubnet = ""
+	r.ClientSubnetScope = nil
+	if opt := resp.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+				r.ClientSubnet = fmt.Sprintf("%s/%d", subnet.Address, subnet.SourceNetmask)
+				scope := subnet.SourceScope
+				r.ClientSubnetScope = &scope
+			}
+		}
+	}
+}
+
+func writeShortDNS(buf *bytes.Buffer, resp *dns.Msg) {
+	for _, rr := range resp.Answer {
+		buf.WriteString(strings.TrimPrefix(rr.String(), rr.Header().String()))
+		buf.WriteString("\n")
+	}
+}
@@ -0,0 +1,304 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// startTestDNSServer serves h over UDP and TCP on the same local port and
+// returns the address.
+func startTestDNSServer(t *testing.T, h dns.HandlerFunc) string {
+	t.Helper()
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	l, err := net.Listen("tcp4", addr)
+	if err != nil {
+		_ = pc.Close()
+		t.Skipf("cannot listen on %s over TCP: %v", addr, err)
+	}
+	for _, s := range []*dns.Server{{PacketConn: pc, Handler: h}, {Listener: l, Handler: h}} {
+		started := make(chan struct{})
+		s.NotifyStartedFunc = func() { close(started) }
+		go func() { _ = s.ActivateAndServe() }()
+		<-started
+		t.Cleanup(func() { _ = s.Shutdown() })
+	}
+	return addr
+}
+
+// answerA answers every question with 192.0.2.1, echoing any client subnet
+// option with a scope of 24.
+func answerA(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	resp.Answer = append(resp.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.IPv4(192, 0, 2, 1),
+	})
+	if opt := req.IsEdns0(); opt != nil {
+		respOpt := resp.SetEdns0(opt.UDPSize(), false).IsEdns0()
+		for _, o := range opt.Option {
+			if subnet, ok := o.(*dns.EDNS0_SUBNET); ok {
+				echo := *subnet
+				echo.SourceScope = 24
+				respOpt.Option = append(respOpt.Option, &echo)
+			}
+		}
+	}
+	_ = w.WriteMsg(resp)
+}
+
+func TestQueryDNS(t *testing.T) {
+	server := startTestDNSServer(t, answerA)
+	q := newDNSQuery("example.com", dns.TypeA)
+
+	var buf bytes.Buffer
+	r, err := queryDNS(context.Background(), &buf, dnsOptions{server: server}, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Server != server || r.Rcode != "NOERROR" ||
+		len(r.Answers) != 1 || !strings.Contains(r.Answers[0], "192.0.2.1") {
+		t.Errorf("report = %+v", r)
+	}
+	for _, want := range []string{"example.com.", "192.0.2.1", ";; SERVER: " + server} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("the output does not contain %q:\n%s", want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if _, err := queryDNS(context.Background(), &buf, dnsOptions{server: server, short: true}, q); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "192.0.2.1\n" {
+		t.Errorf("short output = %q", got)
+	}
+
+	buf.Reset()
+	r, err = queryDNS(context.Background(), &buf, dnsOptions{server: server, clientSubnet: "198.51.100.0/24"}, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ClientSubnet != "198.51.100.0/24" || r.ClientSubnetScope == nil || *r.ClientSubnetScope != 24 {
+		t.Errorf("client subnet %q with scope %v", r.ClientSubnet, r.ClientSubnetScope)
+	}
+
+	if _, err := queryDNS(context.Background(), &buf, dnsOptions{server: server, clientSubnet: "bad"}, q); err == nil {
+		t.Error("an invalid client subnet was accepted")
+	}
+}
+
+func TestQueryDNSTCP(t *testing.T) {
+	var mu sync.Mutex
+	var nets []string
+	queried := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		s := strings.Join(nets, ",")
+		nets = nil
+		return s
+	}
+	server := startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		mu.Lock()
+		nets = append(nets, w.LocalAddr().Network())
+		mu.Unlock()
+		if w.LocalAddr().Network() == "udp" {
+			resp := new(dns.Msg)
+			resp.SetReply(req)
+			resp.Truncated = true
+			_ = w.WriteMsg(resp)
+			return
+		}
+		answerA(w, req)
+	})
+	q := newDNSQuery("example.com", dns.TypeA)
+
+	// A truncated response over UDP is retried over TCP.
+	var buf bytes.Buffer
+	r, err := queryDNS(context.Background(), &buf, dnsOptions{server: server}, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := queried(); len(r.Answers) != 1 || got != "udp,tcp" {
+		t.Errorf("got %d answers over %s", len(r.Answers), got)
+	}
+
+	opts := dnsOptions{server: server, transport: dnsOverTCP}
+	if _, err := queryDNS(context.Background(), &buf, opts, q); err != nil {
+		t.Fatal(err)
+	}
+	if got := queried(); got != "tcp" {
+		t.Errorf("dnsOverTCP queried over %s", got)
+	}
+}
+
+func TestExchangeDoH(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil || req.Id != 0 {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		resp := new(dns.Msg)
+		resp.SetRcode(req, dns.RcodeNameError)
+		packed, _ := resp.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(packed)
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	opts := dnsOptions{server: server.URL, transport: dnsOverHTTPS}
+	r, err := queryDNS(context.Background(), &buf, opts, newDNSQuery("missing.example", dns.TypeA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Server != server.URL || r.Rcode != "NXDOMAIN" {
+		t.Errorf("report = %+v", r)
+	}
+
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	m := newDNSMessage(newDNSQuery("missing.example", dns.TypeA), false)
+	_, _, err = exchangeDoH(context.Background(), m, notFound.URL)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("an HTTP error returned %v", err)
+	}
+}
+
+func TestNewClientSubnetOption(t *testing.T) {
+	tests := []struct {
+		subnet string
+		family uint16
+		mask   uint8
+		addr   string
+	}{
+		{"216.160.83.0/24", 1, 24, "216.160.83.0"},
+		{"216.160.83.56/24", 1, 24, "216.160.83.0"},
+		{"2001:db8::/56", 2, 56, "2001:db8::"},
+	}
+	for _, test := range tests {
+		o, err := newClientSubnetOption(test.subnet)
+		if err != nil {
+			t.Errorf("newClientSubnetOption(%q): %v", test.subnet, err)
+			continue
+		}
+		if o.Family != test.family || o.SourceNetmask != test.mask || o.Address.String() != test.addr {
+			t.Errorf("newClientSubnetOption(%q) = %+v", test.subnet, o)
+		}
+	}
+	if _, err := newClientSubnetOption("216.160.83.0"); err == nil {
+		t.Error("a subnet without a prefix length was accepted")
+	}
+}
+
+func TestResolveDNSServer(t *testing.T) {
+	for server, want := range map[string]string{
+		"192.0.2.53":          "192.0.2.53:53",
+		"192.0.2.53:5353":     "192.0.2.53:5353",
+		"2001:db8::53":        "[2001:db8::53]:53",
+		"[2001:db8::53]:5353": "[2001:db8::53]:5353",
+	} {
+		got, err := resolveDNSServer(context.Background(), server)
+		if err != nil || got != want {
+			t.Errorf("resolveDNSServer(%q) = %q, %v, want %q", server, got, err, want)
+		}
+	}
+}
+
+func TestReferralServers(t *testing.T) {
+	rr := func(s string) dns.RR {
+		r, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	ns := []dns.RR{
+		rr("example.com. 3600 IN NS a.iana-servers.net."),
+		rr("example.com. 3600 IN NS B.iana-servers.net."),
+		rr("example.com. 3600 IN SOA a.example. b.example. 1 2 3 4 5"),
+	}
+	extra := []dns.RR{
+		rr("a.iana-servers.net. 3600 IN A 192.0.2.1"),
+		rr("a.iana-servers.net. 3600 IN AAAA 2001:db8::1"),
+		rr("b.iana-servers.net. 3600 IN A 192.0.2.2"),
+	}
+	got := strings.Join(referralServers(ns, extra), " ")
+	if want := "192.0.2.1:53 [2001:db8::1]:53 192.0.2.2:53"; got != want {
+		t.Errorf("referralServers = %q, want %q", got, want)
+	}
+}
+
+func TestDNSQueryString(t *testing.T) {
+	if got := newDNSQuery("maxmind.com", dns.TypeAAAA).String(); got != "maxmind.com. IN AAAA" {
+		t.Errorf("String = %q", got)
+	}
+	if got := newChaosQuery("id.server", dns.TypeTXT).String(); got != "id.server. CH TXT" {
+		t.Errorf("String = %q", got)
+	}
+
+	desc := dnsOptions{trace: true, nsid: true}.describe([]dnsQuery{newDNSQuery("maxmind.com", dns.TypeA)})
+	want := "Queries the system resolver for maxmind.com. IN A, following referrals from the root, requesting the NSID"
+	if desc != want {
+		t.Errorf("describe = %q, want %q", desc, want)
+	}
+}
+
+func TestDNSMismatchFindings(t *testing.T) {
+	report := func(server string, answers ...string) []*dnsReport {
+		return []*dnsReport{{Question: "geoip.maxmind.com. IN A", Server: server, Rcode: "NOERROR", Answers: answers}}
+	}
+	tests := []struct {
+		system []*dnsReport
+		want   string
+	}{
+		// TTLs and spacing are ignored when comparing records.
+		{report("192.0.2.53:53", "geoip.maxmind.com.\t60\tIN\tA\t192.0.2.1"), ""},
+		// One shared record is enough.
+		{report("192.0.2.53:53", "geoip.maxmind.com. 5 IN A 192.0.2.1", "geoip.maxmind.com. 5 IN A 192.0.2.9"), ""},
+		{report("192.0.2.53:53"), ""},
+		{report("192.0.2.53:53", "geoip.maxmind.com. 60 IN A 203.0.113.1"), "dns-mismatch"},
+	}
+	for _, test := range tests {
+		fs := findingsFor(map[string]interface{}{
+			"geoip.maxmind.com-dig": test.system,
+			"geoip.maxmind.com-dig-doh-google": report(
+				"https://dns.google/dns-query", "geoip.maxmind.com. 300 IN A 192.0.2.1"),
+			// A failed DNS over HTTPS query is neither compared nor
+			// reported.
+			"geoip.maxmind.com-dig-doh-quad9": []*dnsReport{
+				{Question: "geoip.maxmind.com. IN A", Server: "https://dns.quad9.net/dns-query", Error: "timeout"},
+			},
+		})
+		if got := strings.Join(findingChecks(fs), ","); got != test.want {
+			t.Errorf("findings for %v = %s, want %s", test.system[0].Answers, got, test.want)
+			continue
+		}
+		if test.want != "" {
+			want := []string{"geoip.maxmind.com-dig", "geoip.maxmind.com-dig-doh-google"}
+			if !reflect.DeepEqual(fs[0].Tasks, want) {
+				t.Errorf("tasks = %v, want %v", fs[0].Tasks, want)
+			}
+		}
+	}
+}
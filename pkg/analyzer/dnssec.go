@@ -0,0 +1,316 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// DNSSEC statuses, as in RFC 4035 section 4.3, plus dnssecStripped for a
+// signed zone whose signatures the resolver did not return.
+const (
+	dnssecSecure   = "secure"
+	dnssecInsecure = "insecure"
+	dnssecBogus    = "bogus"
+	dnssecStripped = "stripped"
+)
+
+// rootTrustAnchors are the DS records of the root zone's key signing keys,
+// KSK-2017 and KSK-2024, as published by IANA.
+var rootTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// dnssecReport is the result of validating the answer for a name from the
+// root down, using records from the system resolver.
+type dnssecReport struct {
+	Name     string `json:"name"`
+	Resolver string `json:"resolver,omitempty"`
+	// ADBit is true if the resolver set the Authenticated Data bit, i.e.,
+	// it validated the answer itself.
+	ADBit   bool          `json:"ad_bit"`
+	Answers []string      `json:"answers,omitempty"`
+	RRSIGs  []string      `json:"rrsigs,omitempty"`
+	Chain   []*dnssecZone `json:"chain,omitempty"`
+	Status  string        `json:"status,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// dnssecZone is a zone in the chain of trust. DS is empty for the root,
+// which is checked against rootTrustAnchors instead.
+type dnssecZone struct {
+	Zone   string   `json:"zone"`
+	DS     []string `json:"ds,omitempty"`
+	DNSKEY []string `json:"dnskey,omitempty"`
+	RRSIGs []string `json:"rrsigs,omitempty"`
+}
+
+func (a *analyzer) createDNSSECTask(f, name string) *task {
+	return newTask(f, func(ctx context.Context) {
+		buf := new(bytes.Buffer)
+		r, err := validateDNSSEC(ctx, buf, name)
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+			r.Error = err.Error()
+		}
+		fmt.Fprintf(buf, ";; DNSSEC status: %s\n", r.Status)
+		fmt.Fprintf(buf, ";; AD bit set by resolver: %t\n", r.ADBit)
+		if r.Error != "" {
+			fmt.Fprintf(buf, ";; %s\n", r.Error)
+		}
+		a.storeFile(f, buf.Bytes())
+		a.storeResult(taskName(f), r)
+	}).withTags(tagDNS).
+		withDescription("Validates the DNSSEC chain of trust for %s using records from the system resolver", name)
+}
+
+// validateDNSSEC asks the system resolver for the A records of name and
+// validates them from the root trust anchors down. Each response is
+// written to buf. For a bogus chain, the returned error says which link
+// failed. The returned report is never nil.
+func validateDNSSEC(ctx context.Context, buf *bytes.Buffer, name string) (*dnssecReport, error) {
+	server, err := resolveDNSServer(ctx, "")
+	if err != nil {
+		return &dnssecReport{Name: dns.Fqdn(name)}, err
+	}
+	return validateDNSSECWith(ctx, buf, server, name)
+}
+
+// validateDNSSECWith is validateDNSSEC using the resolver at server.
+func validateDNSSECWith(ctx context.Context, buf *bytes.Buffer, server, name string) (*dnssecReport, error) {
+	r := &dnssecReport{Name: dns.Fqdn(name), Resolver: server}
+
+	// The first query is made with checking enabled so that the AD bit
+	// reflects the resolver's own validation.
+	resp, err := dnssecQuery(ctx, buf, server, r.Name, dns.TypeA, false)
+	if err == nil {
+		r.ADBit = resp.AuthenticatedData
+	} else {
+		// A validating resolver returns SERVFAIL for a bogus answer, so
+		// look at the records it rejected.
+		resp, err = dnssecQuery(ctx, buf, server, r.Name, dns.TypeA, true)
+		if err != nil {
+			return r, err
+		}
+	}
+	answers, sigs := splitRRSIGs(resp.Answer, dns.TypeA)
+	r.Answers = rrStrings(answers)
+	r.RRSIGs = rrStrings(sigs)
+	if len(answers) == 0 {
+		return r, errors.Errorf("no A records for %s", r.Name)
+	}
+
+	if len(sigs) == 0 {
+		// Either the zone is unsigned or the resolver dropped the
+		// signatures. A DS record for the zone tells them apart.
+		ds, _, err := dnssecRRset(ctx, buf, server, r.Name, dns.TypeDS)
+		if err != nil {
+			return r, err
+		}
+		if len(ds) > 0 {
+			r.Status = dnssecStripped
+			return r, nil
+		}
+		r.Status = dnssecInsecure
+		return r, nil
+	}
+
+	// Failures to query the resolver leave the status empty, while
+	// validation failures make it bogus.
+	bogus := func(err error) (*dnssecReport, error) {
+		r.Status = dnssecBogus
+		return r, err
+	}
+	signer := sigs[0].(*dns.RRSIG).SignerName
+	var trusted []*dns.DNSKEY
+	var parentKeys []*dns.DNSKEY
+	for _, zone := range zoneChain(signer) {
+		z := &dnssecZone{Zone: zone}
+
+		var ds []dns.RR
+		if zone == "." {
+			for _, anchor := range rootTrustAnchors {
+				rr, err := dns.NewRR(anchor)
+				if err != nil {
+					return r, errors.Wrap(err, "error parsing root trust anchor")
+				}
+				ds = append(ds, rr)
+			}
+		} else {
+			var dsSigs []dns.RR
+			ds, dsSigs, err = dnssecRRset(ctx, buf, server, zone, dns.TypeDS)
+			if err != nil {
+				return r, err
+			}
+			z.DS = rrStrings(ds)
+			z.RRSIGs = append(z.RRSIGs, rrStrings(dsSigs)...)
+			if len(ds) == 0 {
+				if zone != signer {
+					// This is not a zone cut.
+					continue
+				}
+				r.Chain = append(r.Chain, z)
+				return bogus(errors.Errorf("no DS records for %s", zone))
+			}
+			if err := verifyRRset(ds, dsSigs, parentKeys); err != nil {
+				r.Chain = append(r.Chain, z)
+				return bogus(errors.Wrapf(err, "error verifying the DS records for %s", zone))
+			}
+		}
+		r.Chain = append(r.Chain, z)
+
+		keys, keySigs, err := dnssecRRset(ctx, buf, server, zone, dns.TypeDNSKEY)
+		if err != nil {
+			return r, err
+		}
+		z.DNSKEY = rrStrings(keys)
+		z.RRSIGs = append(z.RRSIGs, rrStrings(keySigs)...)
+
+		trusted = nil
+		for _, rr := range keys {
+			trusted = append(trusted, rr.(*dns.DNSKEY))
+		}
+		if !matchesDS(trusted, ds) {
+			return bogus(errors.Errorf("no DNSKEY for %s matches its DS records", zone))
+		}
+		if err := verifyRRset(keys, keySigs, trusted); err != nil {
+			return bogus(errors.Wrapf(err, "error verifying the DNSKEY records for %s", zone))
+		}
+		parentKeys = trusted
+	}
+
+	if err := verifyRRset(answers, sigs, trusted); err != nil {
+		return bogus(errors.Wrapf(err, "error verifying the A records for %s", r.Name))
+	}
+	r.Status = dnssecSecure
+	return r, nil
+}
+
+// dnssecQuery asks server for name with the DNSSEC OK bit set and writes
+// the response to buf. If checkingDisabled is set, a validating resolver
+// returns records even if they fail its validation.
+func dnssecQuery(
+	ctx context.Context,
+	buf *bytes.Buffer,
+	server, name string,
+	qtype uint16,
+	checkingDisabled bool,
+) (*dns.Msg, error) {
+	m := newDNSMessage(newDNSQuery(name, qtype), false)
+	m.RecursionDesired = true
+	m.CheckingDisabled = checkingDisabled
+	m.IsEdns0().SetDo()
+
+	resp, rtt, err := exchangeDNS(ctx, m, server)
+	if err != nil {
+		return nil, err
+	}
+	writeDNSResponse(buf, resp, server, rtt)
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, dnsResultErrorf("%s returned %s for %s %s",
+			server, dns.RcodeToString[resp.Rcode], name, dns.TypeToString[qtype])
+	}
+	return resp, nil
+}
+
+// dnssecRRset returns the records of qtype for name and their signatures.
+func dnssecRRset(
+	ctx context.Context,
+	buf *bytes.Buffer,
+	server, name string,
+	qtype uint16,
+) ([]dns.RR, []dns.RR, error) {
+	resp, err := dnssecQuery(ctx, buf, server, name, qtype, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	rrs, sigs := splitRRSIGs(resp.Answer, qtype)
+	return rrs, sigs, nil
+}
+
+// splitRRSIGs returns the records in rrs of qtype and the signatures
+// covering them.
+func splitRRSIGs(rrs []dns.RR, qtype uint16) ([]dns.RR, []dns.RR) {
+	var records, sigs []dns.RR
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			if sig.TypeCovered == qtype {
+				sigs = append(sigs, rr)
+			}
+			continue
+		}
+		if rr.Header().Rrtype == qtype {
+			records = append(records, rr)
+		}
+	}
+	return records, sigs
+}
+
+// verifyRRset returns nil if any of sigs is a currently valid signature of
+// rrset by one of keys.
+func verifyRRset(rrset, sigs []dns.RR, keys []*dns.DNSKEY) error {
+	if len(sigs) == 0 {
+		return errors.New("no signatures")
+	}
+	var lastErr error
+	for _, rr := range sigs {
+		sig := rr.(*dns.RRSIG)
+		if !sig.ValidityPeriod(time.Now()) {
+			lastErr = errors.Errorf("signature by key %d is outside its validity period", sig.KeyTag)
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			err := sig.Verify(key, rrset)
+			if err == nil {
+				return nil
+			}
+			lastErr = errors.Wrapf(err, "error verifying signature by key %d", sig.KeyTag)
+		}
+	}
+	if lastErr == nil {
+		return errors.New("no signature is by a trusted key")
+	}
+	return lastErr
+}
+
+// matchesDS returns true if any of keys has the digest in one of ds.
+func matchesDS(keys []*dns.DNSKEY, ds []dns.RR) bool {
+	for _, rr := range ds {
+		d := rr.(*dns.DS)
+		for _, key := range keys {
+			keyDS := key.ToDS(d.DigestType)
+			if keyDS != nil && keyDS.KeyTag == d.KeyTag && strings.EqualFold(keyDS.Digest, d.Digest) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// zoneChain returns the names from the root down to zone. Names that are
+// not zone cuts have no DS records and are skipped by validateDNSSEC.
+func zoneChain(zone string) []string {
+	labels := dns.SplitDomainName(zone)
+	zones := []string{"."}
+	for i := len(labels) - 1; i >= 0; i-- {
+		zones = append(zones, dns.Fqdn(strings.Join(labels[i:], ".")))
+	}
+	return zones
+}
+
+func rrStrings(rrs []dns.RR) []string {
+	var s []string
+	for _, rr := range rrs {
+		s = append(s, rr.String())
+	}
+	return s
+}
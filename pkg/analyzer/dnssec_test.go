@@ -0,0 +1,188 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// testZoneKey is a key signing a zone in a test DNSSEC hierarchy.
+type testZoneKey struct {
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newTestZoneKey(t *testing.T, zone string) *testZoneKey {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testZoneKey{key: key, priv: priv.(crypto.Signer)}
+}
+
+// sign returns rrset followed by its signature.
+func (k *testZoneKey) sign(t *testing.T, rrset ...dns.RR) []dns.RR {
+	t.Helper()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrset[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 3600},
+		KeyTag:     k.key.KeyTag(),
+		SignerName: k.key.Hdr.Name,
+		Algorithm:  k.key.Algorithm,
+		Inception:  uint32(time.Now().Add(-time.Hour).Unix()),
+		Expiration: uint32(time.Now().Add(time.Hour).Unix()),
+	}
+	if err := sig.Sign(k.priv, rrset); err != nil {
+		t.Fatal(err)
+	}
+	return append(rrset, sig)
+}
+
+// dnssecTest configures the resolver started by startDNSSECServer.
+type dnssecTest struct {
+	// ad sets the AD bit in the answer for maxmind.com.
+	ad bool
+	// strip removes the signatures from the answer for maxmind.com.
+	strip bool
+	// tamper changes the answer for maxmind.com after it is signed.
+	tamper bool
+	// unsigned serves maxmind.com without DNSSEC.
+	unsigned bool
+}
+
+// startDNSSECServer serves a signed hierarchy for maxmind.com and makes
+// its root key the trust anchor for the duration of the test.
+func startDNSSECServer(t *testing.T, test dnssecTest) string {
+	t.Helper()
+	root := newTestZoneKey(t, ".")
+	com := newTestZoneKey(t, "com.")
+	maxmind := newTestZoneKey(t, "maxmind.com.")
+
+	a, _ := dns.NewRR("maxmind.com. 300 IN A 192.0.2.1")
+	records := map[dns.Question][]dns.RR{
+		{Name: ".", Qtype: dns.TypeDNSKEY}:            root.sign(t, root.key),
+		{Name: "com.", Qtype: dns.TypeDS}:             root.sign(t, com.key.ToDS(dns.SHA256)),
+		{Name: "com.", Qtype: dns.TypeDNSKEY}:         com.sign(t, com.key),
+		{Name: "maxmind.com.", Qtype: dns.TypeDNSKEY}: maxmind.sign(t, maxmind.key),
+		{Name: "maxmind.com.", Qtype: dns.TypeA}:      maxmind.sign(t, a),
+	}
+	if !test.unsigned {
+		records[dns.Question{Name: "maxmind.com.", Qtype: dns.TypeDS}] = com.sign(t, maxmind.key.ToDS(dns.SHA256))
+	}
+	answer := records[dns.Question{Name: "maxmind.com.", Qtype: dns.TypeA}]
+	switch {
+	case test.strip, test.unsigned:
+		answer = answer[:1]
+	case test.tamper:
+		forged, _ := dns.NewRR("maxmind.com. 300 IN A 203.0.113.1")
+		answer = []dns.RR{forged, answer[1]}
+	}
+	records[dns.Question{Name: "maxmind.com.", Qtype: dns.TypeA}] = answer
+
+	anchors := rootTrustAnchors
+	rootTrustAnchors = []string{root.key.ToDS(dns.SHA256).String()}
+	t.Cleanup(func() { rootTrustAnchors = anchors })
+
+	return startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		q := req.Question[0]
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.Answer = records[dns.Question{Name: q.Name, Qtype: q.Qtype}]
+		resp.AuthenticatedData = test.ad && q.Name == "maxmind.com." && q.Qtype == dns.TypeA
+		_ = w.WriteMsg(resp)
+	})
+}
+
+func TestValidateDNSSEC(t *testing.T) {
+	tests := []struct {
+		test   dnssecTest
+		status string
+		err    string
+	}{
+		{dnssecTest{ad: true}, dnssecSecure, ""},
+		{dnssecTest{}, dnssecSecure, ""},
+		{dnssecTest{strip: true}, dnssecStripped, ""},
+		{dnssecTest{unsigned: true}, dnssecInsecure, ""},
+		{dnssecTest{tamper: true}, dnssecBogus, "error verifying the A records for maxmind.com."},
+	}
+	for _, test := range tests {
+		server := startDNSSECServer(t, test.test)
+		var buf bytes.Buffer
+		r, err := validateDNSSECWith(context.Background(), &buf, server, "maxmind.com")
+		if r.Status != test.status || r.ADBit != test.test.ad || r.Resolver != server {
+			t.Errorf("%+v: report = %+v", test.test, r)
+		}
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%+v: error = %v, want %q", test.test, err, test.err)
+		}
+		if test.status == dnssecSecure {
+			var zones []string
+			for _, z := range r.Chain {
+				zones = append(zones, z.Zone)
+			}
+			if want := []string{".", "com.", "maxmind.com."}; !reflect.DeepEqual(zones, want) {
+				t.Errorf("chain = %v, want %v", zones, want)
+			}
+		}
+		if !strings.Contains(buf.String(), "maxmind.com.") {
+			t.Errorf("%+v: the responses were not written:\n%s", test.test, buf.String())
+		}
+	}
+}
+
+func TestValidateDNSSECServerFailure(t *testing.T) {
+	server := startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		resp := new(dns.Msg)
+		resp.SetRcode(req, dns.RcodeServerFailure)
+		_ = w.WriteMsg(resp)
+	})
+	var buf bytes.Buffer
+	r, err := validateDNSSECWith(context.Background(), &buf, server, "maxmind.com")
+	// A resolver that does not answer says nothing about the chain of
+	// trust.
+	if err == nil || !strings.Contains(err.Error(), "SERVFAIL") || r.Status != "" {
+		t.Errorf("status %q, error %v", r.Status, err)
+	}
+}
+
+func TestZoneChain(t *testing.T) {
+	if got, want := zoneChain("maxmind.com."), []string{".", "com.", "maxmind.com."}; !reflect.DeepEqual(got, want) {
+		t.Errorf("zoneChain = %v, want %v", got, want)
+	}
+	if got := zoneChain("."); !reflect.DeepEqual(got, []string{"."}) {
+		t.Errorf("zoneChain(.) = %v", got)
+	}
+}
+
+func TestDNSSECFindings(t *testing.T) {
+	tests := []struct {
+		report *dnssecReport
+		want   string
+	}{
+		{&dnssecReport{Status: dnssecSecure, ADBit: true}, ""},
+		{&dnssecReport{Status: dnssecInsecure}, ""},
+		{&dnssecReport{Status: dnssecSecure}, "dnssec-not-validated"},
+		{&dnssecReport{Status: dnssecStripped}, "dnssec-stripped"},
+		{&dnssecReport{Status: dnssecBogus, Error: "no DS records for maxmind.com."}, "dnssec-invalid"},
+	}
+	for _, test := range tests {
+		test.report.Name = "maxmind.com."
+		test.report.Resolver = "192.0.2.53:53"
+		fs := findingsFor(map[string]interface{}{"dnssec-maxmind.com": test.report})
+		if got := strings.Join(findingChecks(fs), ","); got != test.want {
+			t.Errorf("findings for status %q = %s, want %s", test.report.Status, got, test.want)
+		}
+	}
+}
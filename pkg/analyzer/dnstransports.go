@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// publicResolvers are queried over each transport by the dns-transports
+// task. Their certificates are valid for their IP addresses, so DNS over
+// TLS may be verified without a host name.
+var publicResolvers = []struct {
+	name   string
+	server string
+}{
+	{"Cloudflare", "1.1.1.1"},
+	{"Google", "8.8.8.8"},
+	{"Quad9", "9.9.9.9"},
+}
+
+// dnsTransports are the transports compared. The empty transport is plain
+// DNS over UDP.
+var dnsTransports = []string{"", dnsOverTCP, dnsOverTLS}
+
+// dnsTransportCheck is the result of a query to a resolver over a single
+// transport.
+type dnsTransportCheck struct {
+	Resolver  string   `json:"resolver"`
+	Transport string   `json:"transport"`
+	Server    string   `json:"server,omitempty"`
+	RTTMS     float64  `json:"rtt_ms"`
+	Answers   []string `json:"answers,omitempty"`
+	// MatchesUDP is true if the answers are the same as those received
+	// over UDP from the same resolver.
+	MatchesUDP bool   `json:"matches_udp"`
+	Error      string `json:"error,omitempty"`
+}
+
+// addDNSTransports queries each public resolver for defaultHost over UDP,
+// TCP, and TLS and writes the responses to dns-transports.txt and the
+// results to dns-transports.json.
+func (a *analyzer) addDNSTransports(ctx context.Context) {
+	q := newDNSQuery(defaultHost, dns.TypeA)
+	buf := new(bytes.Buffer)
+	var checks []*dnsTransportCheck
+	for _, resolver := range publicResolvers {
+		var udpAnswers []string
+		for _, transport := range dnsTransports {
+			opts := dnsOptions{server: resolver.server, transport: transport}
+			c := &dnsTransportCheck{Resolver: resolver.name, Transport: transport}
+			if transport == "" {
+				c.Transport = "udp"
+			}
+
+			fmt.Fprintf(buf, ";; %s over %s\n", resolver.name, c.Transport)
+			var r *dnsReport
+			err := a.retry(ctx, q.String()+" over "+c.Transport, func() error {
+				var err error
+				r, err = queryDNS(ctx, buf, opts, q)
+				return err
+			})
+			c.Server = r.Server
+			c.RTTMS = r.RTTMS
+			c.Answers = dnsAnswersByQuestion([]*dnsReport{r})[r.Question]
+			slices.Sort(c.Answers)
+			if err != nil {
+				a.storeError(ctx, errors.Wrapf(err, "error querying %s over %s", resolver.name, c.Transport))
+				fmt.Fprintf(buf, ";; %s: %v\n\n", q, err)
+				c.Error = err.Error()
+			}
+
+			if transport == "" {
+				udpAnswers = c.Answers
+			}
+			c.MatchesUDP = c.Error == "" && slices.Equal(c.Answers, udpAnswers)
+			checks = append(checks, c)
+		}
+	}
+
+	a.storeFile("dns-transports.txt", buf.Bytes())
+	b, err := json.MarshalIndent(checks, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding dns-transports.json"))
+		return
+	}
+	a.storeFile("dns-transports.json", b)
+	a.storeResult("dns-transports", checks)
+}
@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestQueryDNSOverTLS(t *testing.T) {
+	// The test server speaks plain DNS over TCP, so the TLS handshake
+	// never completes.
+	server := startTestDNSServer(t, answerA)
+	q := newDNSQuery("example.com", dns.TypeA)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var buf bytes.Buffer
+	r, err := queryDNS(ctx, &buf, dnsOptions{server: server, transport: dnsOverTLS}, q)
+	if err == nil || !strings.Contains(err.Error(), "over tls") {
+		t.Errorf("DNS over TLS to a plain DNS server returned %v", err)
+	}
+	if r.Server != server {
+		t.Errorf("server = %q, want %q", r.Server, server)
+	}
+
+	// Without a port, DNS over TLS uses 853.
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = l.Close()
+	host, _, _ := net.SplitHostPort(l.Addr().String())
+	r, _ = queryDNS(context.Background(), &buf, dnsOptions{server: host, transport: dnsOverTLS}, q)
+	if want := net.JoinHostPort(host, "853"); r.Server != want {
+		t.Errorf("server = %q, want %q", r.Server, want)
+	}
+}
+
+func TestDNSTransportFindings(t *testing.T) {
+	answers := []string{"geoip.maxmind.com. 0 IN A 192.0.2.1"}
+	checks := []*dnsTransportCheck{
+		{Resolver: "Cloudflare", Transport: "udp", Answers: answers},
+		{Resolver: "Cloudflare", Transport: dnsOverTCP, Answers: answers, MatchesUDP: true},
+		{Resolver: "Cloudflare", Transport: dnsOverTLS, Error: "connection refused"},
+		{Resolver: "Google", Transport: "udp", Answers: answers},
+		{Resolver: "Google", Transport: dnsOverTLS, Answers: []string{"geoip.maxmind.com. 0 IN A 203.0.113.1"}},
+		{Resolver: "Quad9", Transport: "udp", Answers: answers},
+		{Resolver: "Quad9", Transport: dnsOverTLS, Answers: answers, MatchesUDP: true},
+		// When plain DNS fails too, DNS over TLS being blocked is not
+		// the problem.
+		{Resolver: "OpenDNS", Transport: "udp", Error: "i/o timeout"},
+		{Resolver: "OpenDNS", Transport: dnsOverTLS, Error: "i/o timeout"},
+	}
+	fs := findingsFor(map[string]interface{}{"dns-transports": checks})
+	if got := strings.Join(findingChecks(fs), ","); got != "dot-blocked,dns-transport-mismatch" {
+		t.Fatalf("checks = %s", got)
+	}
+	if !strings.Contains(fs[0].Summary, "Cloudflare") || !strings.Contains(fs[1].Summary, "Google") {
+		t.Errorf("findings = %+v, %+v", fs[0], fs[1])
+	}
+}
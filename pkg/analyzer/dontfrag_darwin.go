@@ -0,0 +1,25 @@
+package analyzer
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// setDontFragment sets the Don't Fragment bit on packets sent on the
+// socket underlying c.
+func setDontFragment(c syscall.RawConn, network string) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if network == "ip6" {
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_DONTFRAG, 1)
+			return
+		}
+		sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_DONTFRAG, 1)
+	})
+	if err != nil {
+		return errors.Wrap(err, "error accessing socket")
+	}
+	return errors.Wrap(sockErr, "error setting Don't Fragment")
+}
@@ -0,0 +1,27 @@
+package analyzer
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// setDontFragment sets the Don't Fragment bit on packets sent on the
+// socket underlying c. IP_PMTUDISC_PROBE also makes the kernel ignore the
+// path MTU it has cached, so that we can measure it ourselves.
+func setDontFragment(c syscall.RawConn, network string) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if network == "ip6" {
+			sockErr = syscall.SetsockoptInt(
+				int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_PROBE,
+			)
+			return
+		}
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_PROBE)
+	})
+	if err != nil {
+		return errors.Wrap(err, "error accessing socket")
+	}
+	return errors.Wrap(sockErr, "error setting Don't Fragment")
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !windows
+
+package analyzer
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// setDontFragment is not implemented on this platform.
+func setDontFragment(syscall.RawConn, string) error {
+	return errors.New("setting Don't Fragment is not supported on this platform")
+}
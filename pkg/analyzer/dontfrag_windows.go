@@ -0,0 +1,30 @@
+package analyzer
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Socket options from ws2ipdef.h, which the syscall package lacks.
+const (
+	ipDontFragment   = 14
+	ipv6DontFragment = 14
+)
+
+// setDontFragment sets the Don't Fragment bit on packets sent on the
+// socket underlying c.
+func setDontFragment(c syscall.RawConn, network string) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if network == "ip6" {
+			sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IPV6, ipv6DontFragment, 1)
+			return
+		}
+		sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_IP, ipDontFragment, 1)
+	})
+	if err != nil {
+		return errors.Wrap(err, "error accessing socket")
+	}
+	return errors.Wrap(sockErr, "error setting Don't Fragment")
+}
@@ -0,0 +1,147 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// downloadTestBytes is how much of the database is downloaded to measure
+// the throughput.
+const downloadTestBytes = 50 << 20
+
+// downloadStallThreshold is how long a read must block before it counts as
+// a stall.
+const downloadStallThreshold = 2 * time.Second
+
+// defaultDownloadBaseURL is where the databases are downloaded from.
+const defaultDownloadBaseURL = "https://download.maxmind.com/geoip/databases/"
+
+// downloadURL returns the URL of the latest database of edition.
+func (a *analyzer) downloadURL(edition string) string {
+	baseURL := a.downloadBaseURL
+	if baseURL == "" {
+		baseURL = defaultDownloadBaseURL
+	}
+	return baseURL + url.PathEscape(edition) + "/download?suffix=tar.gz"
+}
+
+// downloadReport is the result of a timed partial database download.
+type downloadReport struct {
+	URL        string `json:"url"`
+	Edition    string `json:"edition"`
+	StatusCode int    `json:"status_code,omitempty"`
+	// FinalHost is the host that served the database after any redirects.
+	FinalHost      string          `json:"final_host,omitempty"`
+	Bytes          int64           `json:"bytes"`
+	TTFBMS         float64         `json:"ttfb_ms,omitempty"`
+	DurationMS     float64         `json:"duration_ms"`
+	ThroughputMbps float64         `json:"throughput_mbps"`
+	Stalls         []downloadStall `json:"stalls,omitempty"`
+	TLSVersion     string          `json:"tls_version,omitempty"`
+	Error          string          `json:"error,omitempty"`
+}
+
+// downloadStall is a read that blocked for at least downloadStallThreshold.
+type downloadStall struct {
+	AtBytes    int64   `json:"at_bytes"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// addDownload downloads the first downloadTestBytes of a database with the
+// given credentials and writes the throughput, time to first byte, and
+// any stalls to download-throughput.json. The data is discarded.
+func (a *analyzer) addDownload(ctx context.Context) {
+	edition := configuredEdition()
+
+	var r *downloadReport
+	err := a.retry(ctx, "GET "+a.downloadURL(edition), func() error {
+		var err error
+		r, err = a.download(ctx, edition)
+		return err
+	})
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if r.Error != "" {
+		a.storeError(ctx, errors.Wrap(errors.New(r.Error), "error downloading "+edition))
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding download-throughput.json"))
+		return
+	}
+	a.storeFile("download-throughput.json", b)
+	a.storeResult("download-throughput", r)
+}
+
+// download makes a single timed range request. The returned report is
+// never nil.
+func (a *analyzer) download(ctx context.Context, edition string) (*downloadReport, error) {
+	r := &downloadReport{URL: a.downloadURL(edition), Edition: edition}
+
+	var firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, r.URL, nil)
+	if err != nil {
+		return r, errors.Wrap(err, "error creating download request")
+	}
+	req.SetBasicAuth(a.credentials.accountID, a.credentials.licenseKey)
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", downloadTestBytes-1))
+	req.Header.Set("User-Agent", os.Args[0])
+
+	start := time.Now()
+	defer func() {
+		r.DurationMS = durationMS(time.Since(start))
+		if !firstByte.IsZero() {
+			r.TTFBMS = durationMS(firstByte.Sub(start))
+		}
+		if secs := time.Since(start).Seconds(); secs > 0 {
+			r.ThroughputMbps = float64(r.Bytes) * 8 / 1e6 / secs
+		}
+	}()
+
+	resp, err := a.dial.httpClient().Do(req)
+	if err != nil {
+		return r, errors.Wrap(err, "error making download request")
+	}
+	defer resp.Body.Close()
+	r.StatusCode = resp.StatusCode
+	r.FinalHost = resp.Request.URL.Host
+	if resp.TLS != nil {
+		r.TLSVersion = tlsVersionName(resp.TLS.Version)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		// Error responses such as 401 are not retried.
+		r.Error = "download returned " + resp.Status
+		return r, nil
+	}
+
+	buf := make([]byte, 32*1024)
+	body := io.LimitReader(resp.Body, downloadTestBytes)
+	for {
+		readStart := time.Now()
+		n, err := body.Read(buf)
+		if wait := time.Since(readStart); wait >= downloadStallThreshold {
+			r.Stalls = append(r.Stalls, downloadStall{AtBytes: r.Bytes, DurationMS: durationMS(wait)})
+		}
+		r.Bytes += int64(n)
+		if err == io.EOF {
+			return r, nil
+		}
+		if err != nil {
+			return r, errors.Wrap(err, "error reading download")
+		}
+	}
+}
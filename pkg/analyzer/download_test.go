@@ -0,0 +1,111 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// serveDownload serves handler for the duration of the test and returns
+// the download base URL to give the analyzer.
+func serveDownload(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL + "/geoip/databases/"
+}
+
+func TestAddDownload(t *testing.T) {
+	useGeoIPConf(t, "EditionIDs GeoIP2-City\n")
+	const size = 100000
+	var unauthorized atomic.Int32
+	baseURL := serveDownload(t, func(w http.ResponseWriter, r *http.Request) {
+		if id, key, ok := r.BasicAuth(); !ok || id != "42" || key != "testlicensekey" {
+			unauthorized.Add(1)
+			http.Error(w, "invalid license key", http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/geoip/databases/GeoIP2-City/download":
+			// download.maxmind.com redirects to a presigned URL.
+			http.Redirect(w, r, "/r2/GeoIP2-City.tar.gz", http.StatusFound)
+		case "/r2/GeoIP2-City.tar.gz":
+			if r.Header.Get("Range") != "bytes=0-52428799" {
+				http.Error(w, "no range", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(bytes.Repeat([]byte{0x1f}, size))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	a := &analyzer{
+		credentials:     &credentials{accountID: "42", licenseKey: "testlicensekey"},
+		downloadBaseURL: baseURL,
+	}
+	defer a.removeSpool()
+	a.addDownload(context.Background())
+	r, ok := a.results["download-throughput"].(*downloadReport)
+	if !ok {
+		t.Fatalf("results = %#v", a.results["download-throughput"])
+	}
+	if r.Edition != "GeoIP2-City" || r.StatusCode != http.StatusPartialContent || r.Bytes != size ||
+		r.Error != "" || r.ThroughputMbps <= 0 || r.TTFBMS > r.DurationMS || r.TLSVersion != "" {
+		t.Errorf("report = %+v", r)
+	}
+	if !strings.HasPrefix(baseURL, "http://"+r.FinalHost+"/") {
+		t.Errorf("final host = %q", r.FinalHost)
+	}
+	if !bytes.Contains(storedContents(t, a, "download-throughput.json"), []byte(`"bytes": 100000`)) {
+		t.Error("download-throughput.json does not have the report")
+	}
+	if a.hasErrors() {
+		t.Error("errors were recorded")
+	}
+
+	// An error response is not retried.
+	a = &analyzer{
+		credentials:     &credentials{accountID: "42", licenseKey: "wrong"},
+		retryPolicy:     retryPolicy{retries: 2},
+		downloadBaseURL: baseURL,
+	}
+	defer a.removeSpool()
+	a.addDownload(context.Background())
+	r = a.results["download-throughput"].(*downloadReport)
+	if r.StatusCode != http.StatusUnauthorized || r.Error != "download returned 401 Unauthorized" {
+		t.Errorf("report = %+v", r)
+	}
+	if n := unauthorized.Load(); n != 1 {
+		t.Errorf("the download was requested %d times", n)
+	}
+	if !a.hasErrors() {
+		t.Error("the error was not recorded")
+	}
+}
+
+func TestDownloadFindings(t *testing.T) {
+	r := &downloadReport{
+		Error:  "error reading download: unexpected EOF",
+		Stalls: []downloadStall{{AtBytes: 1 << 20, DurationMS: 5000}},
+	}
+	fs := findingsFor(map[string]interface{}{"download-throughput": r})
+	if got := strings.Join(findingChecks(fs), ","); got != "download-failure,download-stalled" {
+		t.Fatalf("checks = %s", got)
+	}
+	if want := "the database download stalled for 5000 ms after 1048576 bytes"; fs[1].Summary != want {
+		t.Errorf("summary = %q, want %q", fs[1].Summary, want)
+	}
+}
+
+func TestDownloadURL(t *testing.T) {
+	want := "https://download.maxmind.com/geoip/databases/GeoIP2-City%2FISP/download?suffix=tar.gz"
+	if got := (&analyzer{}).downloadURL("GeoIP2-City/ISP"); got != want {
+		t.Errorf("downloadURL = %q, want %q", got, want)
+	}
+}
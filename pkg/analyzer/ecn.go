@@ -0,0 +1,32 @@
+package analyzer
+
+// ecnSYN is the outcome of sending one kind of SYN.
+type ecnSYN struct {
+	Attempts int  `json:"attempts"`
+	Answered bool `json:"answered"`
+	// Reply is the flags of the reply, e.g., "SYN ACK ECE".
+	Reply string  `json:"reply,omitempty"`
+	RTTMS float64 `json:"rtt_ms,omitempty"`
+	Error string  `json:"error,omitempty"`
+}
+
+// ecnReport compares the replies to a plain SYN and to an ECN-setup SYN,
+// which has the ECE and CWR flags set (RFC 3168). A server that supports
+// ECN answers the latter with ECE set. Some middleboxes drop ECN-setup
+// SYNs, or clear the flags so that ECN is never used, and a few mangle
+// ECN-marked packets later in the connection, which causes intermittent
+// stalls. Only the handshake is tested.
+type ecnReport struct {
+	Host    string  `json:"host"`
+	Address string  `json:"address,omitempty"`
+	Network string  `json:"network"`
+	Plain   *ecnSYN `json:"plain_syn,omitempty"`
+	ECN     *ecnSYN `json:"ecn_setup_syn,omitempty"`
+	// Negotiated is true if the ECN-setup SYN was answered with ECE, i.e.,
+	// the server agreed to use ECN and the flags survived the path.
+	Negotiated bool `json:"negotiated"`
+	// Blackholed is true if the plain SYN was answered but the ECN-setup
+	// SYN was not.
+	Blackholed bool   `json:"blackholed"`
+	Error      string `json:"error,omitempty"`
+}
@@ -0,0 +1,200 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ecnTimeout  = time.Second
+	ecnAttempts = 3
+
+	tcpFlagFIN = 0x01
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+	tcpFlagACK = 0x10
+	tcpFlagECE = 0x40
+	tcpFlagCWR = 0x80
+)
+
+func (a *analyzer) createECNTask(f, network, host string) *task {
+	return newTask(f, func(ctx context.Context) {
+		r, err := probeECN(ctx, network, host)
+		if err != nil {
+			r.Error = err.Error()
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+		}
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", f))
+			return
+		}
+		a.storeFile(f, b)
+		a.storeResult(taskName(f), r)
+	}).withTags(tagRouting).
+		withDescription("Checks whether ECN-setup SYNs to %s over %s are answered", host, familyName(network)).
+		withPrivileges("root")
+}
+
+// probeECN sends SYNs to port 443 on host from a raw socket. The kernel
+// resets the connections when the SYN-ACKs arrive, as it has no socket
+// for them, so no connection is left half-open on the server.
+func probeECN(ctx context.Context, network, host string) (*ecnReport, error) {
+	dial := dialConfigFromContext(ctx)
+	r := &ecnReport{Host: host, Network: network}
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return r, errors.Wrapf(err, "error looking up %s", host)
+	}
+	dst := ips[0]
+	r.Address = dst.String()
+
+	udp, err := dial.newDialer("udp").Dial("udp"+network[2:], net.JoinHostPort(dst.String(), "443"))
+	if err != nil {
+		return r, errors.Wrapf(err, "error finding the route to %s", dst)
+	}
+	src := udp.LocalAddr().(*net.UDPAddr).IP
+	_ = udp.Close()
+
+	lc := net.ListenConfig{Control: dial.bindControl}
+	conn, err := lc.ListenPacket(ctx, network+":tcp", src.String())
+	if err != nil {
+		return r, errors.Wrap(err, "error opening raw TCP socket (the ECN probe requires root)")
+	}
+	defer conn.Close()
+
+	r.Plain, err = sendSYN(ctx, conn, src, dst, tcpFlagSYN)
+	if err != nil {
+		return r, err
+	}
+	r.ECN, err = sendSYN(ctx, conn, src, dst, tcpFlagSYN|tcpFlagECE|tcpFlagCWR)
+	if err != nil {
+		return r, err
+	}
+	r.Negotiated = r.ECN.Answered && strings.Contains(r.ECN.Reply, "ECE")
+	r.Blackholed = r.Plain.Answered && !r.ECN.Answered
+	return r, nil
+}
+
+// sendSYN sends a SYN with flags from src to port 443 on dst until it is
+// answered or ecnAttempts have timed out. The source port is held by a
+// listener so that no other connection uses it meanwhile.
+func sendSYN(ctx context.Context, conn net.PacketConn, src, dst net.IP, flags byte) (*ecnSYN, error) {
+	network := "tcp4"
+	if dst.To4() == nil {
+		network = "tcp6"
+	}
+	lc := net.ListenConfig{Control: dialConfigFromContext(ctx).bindControl}
+	l, err := lc.Listen(ctx, network, net.JoinHostPort(src.String(), "0"))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reserving a source port")
+	}
+	defer l.Close()
+	srcPort := l.Addr().(*net.TCPAddr).Port
+
+	s := &ecnSYN{}
+	seq := rand.Uint32()
+	segment := tcpSYNSegment(src, dst, srcPort, 443, seq, flags)
+	buf := make([]byte, 1500)
+	for ; s.Attempts < ecnAttempts && ctx.Err() == nil; s.Attempts++ {
+		sent := time.Now()
+		if _, err := conn.WriteTo(segment, &net.IPAddr{IP: dst}); err != nil {
+			s.Error = errors.Wrap(err, "error sending SYN").Error()
+			return s, nil
+		}
+		if err := conn.SetReadDeadline(sent.Add(ecnTimeout)); err != nil {
+			return nil, errors.Wrap(err, "error setting read deadline")
+		}
+		for {
+			// The IPv4 header is removed by the net package and not
+			// included for IPv6.
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			h := buf[:n]
+			if n < 20 || !from.(*net.IPAddr).IP.Equal(dst) ||
+				binary.BigEndian.Uint16(h[0:]) != 443 || int(binary.BigEndian.Uint16(h[2:])) != srcPort ||
+				binary.BigEndian.Uint32(h[8:]) != seq+1 {
+				continue
+			}
+			s.Attempts++
+			s.Answered = true
+			s.RTTMS = durationMS(time.Since(sent))
+			s.Reply = tcpFlagNames(h[13])
+			return s, nil
+		}
+	}
+	return s, nil
+}
+
+// tcpSYNSegment builds a SYN with an MSS option, like the kernel sends.
+func tcpSYNSegment(src, dst net.IP, srcPort, dstPort int, seq uint32, flags byte) []byte {
+	b := make([]byte, 24)
+	binary.BigEndian.PutUint16(b[0:], uint16(srcPort))
+	binary.BigEndian.PutUint16(b[2:], uint16(dstPort))
+	binary.BigEndian.PutUint32(b[4:], seq)
+	b[12] = 6 << 4 // Data offset in 32-bit words.
+	b[13] = flags
+	binary.BigEndian.PutUint16(b[14:], 64240)
+	// Kind 2, length 4: MSS.
+	b[20], b[21] = 2, 4
+	binary.BigEndian.PutUint16(b[22:], 1460)
+	binary.BigEndian.PutUint16(b[16:], tcpChecksum(src, dst, b))
+	return b
+}
+
+// tcpChecksum returns the checksum of segment including the IPv4 or IPv6
+// pseudo-header.
+func tcpChecksum(src, dst net.IP, segment []byte) uint16 {
+	var pseudo []byte
+	if src4, dst4 := src.To4(), dst.To4(); src4 != nil && dst4 != nil {
+		pseudo = append(append(pseudo, src4...), dst4...)
+		pseudo = append(pseudo, 0, 6)
+		pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(len(segment)))
+	} else {
+		pseudo = append(append(pseudo, src.To16()...), dst.To16()...)
+		pseudo = binary.BigEndian.AppendUint32(pseudo, uint32(len(segment)))
+		pseudo = append(pseudo, 0, 0, 0, 6)
+	}
+	var sum uint32
+	for _, data := range [][]byte{pseudo, segment} {
+		for i := 0; i+1 < len(data); i += 2 {
+			sum += uint32(binary.BigEndian.Uint16(data[i:]))
+		}
+		if len(data)%2 == 1 {
+			sum += uint32(data[len(data)-1]) << 8
+		}
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+func tcpFlagNames(flags byte) string {
+	var names []string
+	for _, f := range []struct {
+		bit  byte
+		name string
+	}{
+		{tcpFlagSYN, "SYN"},
+		{tcpFlagACK, "ACK"},
+		{tcpFlagRST, "RST"},
+		{tcpFlagFIN, "FIN"},
+		{tcpFlagECE, "ECE"},
+		{tcpFlagCWR, "CWR"},
+	} {
+		if flags&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,60 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestProbeECNLoopback(t *testing.T) {
+	// Nothing listens on port 443, so the kernel answers each SYN with a
+	// reset.
+	r, err := probeECN(context.Background(), "ip4", "127.0.0.1")
+	if err != nil {
+		t.Skipf("cannot open a raw socket here: %v", err)
+	}
+	if !r.Plain.Answered || r.Plain.Reply != "ACK RST" || !r.ECN.Answered || r.Negotiated || r.Blackholed {
+		t.Errorf("report = %+v, plain %+v, ECN %+v", r, r.Plain, r.ECN)
+	}
+}
+
+func TestTCPSYNSegment(t *testing.T) {
+	for _, addrs := range [][2]string{{"192.0.2.1", "198.51.100.2"}, {"2001:db8::1", "2001:db8::2"}} {
+		src, dst := net.ParseIP(addrs[0]), net.ParseIP(addrs[1])
+		b := tcpSYNSegment(src, dst, 40000, 443, 12345, tcpFlagSYN|tcpFlagECE|tcpFlagCWR)
+		if len(b) != 24 || b[12] != 6<<4 || tcpFlagNames(b[13]) != "SYN ECE CWR" {
+			t.Errorf("segment = %x", b)
+		}
+		if binary.BigEndian.Uint16(b[0:]) != 40000 || binary.BigEndian.Uint16(b[2:]) != 443 ||
+			binary.BigEndian.Uint32(b[4:]) != 12345 || binary.BigEndian.Uint16(b[22:]) != 1460 {
+			t.Errorf("segment = %x", b)
+		}
+		// The checksum of a segment that includes its checksum is zero.
+		if sum := tcpChecksum(src, dst, b); sum != 0 {
+			t.Errorf("from %s, the checksum does not verify: %#x", src, sum)
+		}
+	}
+}
+
+func TestTCPChecksum(t *testing.T) {
+	// The pseudo-header is 0a00 0001 0a00 0002 0006 0003 and the segment,
+	// padded with a zero byte, 0102 0300.
+	src, dst := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	if got := tcpChecksum(src, dst, []byte{1, 2, 3}); got != ^uint16(0x180e) {
+		t.Errorf("checksum = %#x", got)
+	}
+}
+
+func TestTCPFlagNames(t *testing.T) {
+	for flags, want := range map[byte]string{
+		tcpFlagSYN | tcpFlagACK:              "SYN ACK",
+		tcpFlagSYN | tcpFlagACK | tcpFlagECE: "SYN ACK ECE",
+		tcpFlagRST | tcpFlagACK:              "ACK RST",
+		0:                                    "",
+	} {
+		if got := tcpFlagNames(flags); got != want {
+			t.Errorf("tcpFlagNames(%#x) = %q, want %q", flags, got, want)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package analyzer
+
+import "testing"
+
+func TestECNFindings(t *testing.T) {
+	r := &ecnReport{
+		Host:       "geoip.maxmind.com",
+		Address:    "104.18.0.5",
+		Network:    "ip4",
+		Plain:      &ecnSYN{Attempts: 1, Answered: true, Reply: "SYN ACK"},
+		ECN:        &ecnSYN{Attempts: 3},
+		Blackholed: true,
+	}
+	fs := findingsFor(map[string]interface{}{"geoip.maxmind.com-ecn-ipv4": r})
+	want := "SYNs to 104.18.0.5 that request ECN are dropped but plain SYNs are answered; clients with ECN " +
+		"enabled cannot connect over IPv4"
+	if len(fs) != 1 || fs[0].Check != "ecn-blackhole" || fs[0].Summary != want {
+		t.Errorf("findings = %+v", fs)
+	}
+}
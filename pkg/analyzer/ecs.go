@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// ecsServers are the servers asked with each of ecsSubnets. Google and
+// Quad9's 9.9.9.11 pass the client subnet on to authoritative servers;
+// Cloudflare's authoritative servers show how they handle it directly.
+var ecsServers = []string{"8.8.8.8", "9.9.9.11", "josh.ns.cloudflare.com"}
+
+// ecsSubnets are sent as the EDNS Client Subnet. 0.0.0.0/0 asks the server
+// not to use the client's address. The others are in different regions
+// in MaxMind's GeoIP2 test data: the US, the UK, and China.
+var ecsSubnets = []string{"0.0.0.0/0", "216.160.83.0/24", "81.2.69.0/24", "175.16.199.0/24"}
+
+// createECSTask queries each of ecsServers for host with each of
+// ecsSubnets, recording the scope and answers returned, which determine
+// the CDN node that clients in each subnet are sent to.
+func (a *analyzer) createECSTask(f, host string) *task {
+	q := newDNSQuery(host, dns.TypeA)
+	return newTask(f, func(ctx context.Context) {
+		buf := new(bytes.Buffer)
+		var reports []*dnsReport
+		for _, server := range ecsServers {
+			for _, subnet := range ecsSubnets {
+				opts := dnsOptions{server: server, clientSubnet: subnet}
+				var r *dnsReport
+				err := a.retry(ctx, q.String()+" with client subnet "+subnet, func() error {
+					var err error
+					r, err = queryDNS(ctx, buf, opts, q)
+					return err
+				})
+				if err != nil {
+					a.storeError(ctx, errors.Wrapf(
+						err, "error getting data for %s (%s from %s with %s)", f, q, server, subnet,
+					))
+					fmt.Fprintf(buf, ";; %s from %s with client subnet %s: %v\n\n", q, server, subnet, err)
+					r.Error = err.Error()
+				}
+				reports = append(reports, r)
+			}
+		}
+		a.storeFile(f, buf.Bytes())
+		a.storeResult(taskName(f), reports)
+	}).withTags(tagDNS).
+		withDescription("Queries public resolvers and Cloudflare for %s with several EDNS Client Subnets", host)
+}
@@ -0,0 +1,37 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestECSTask(t *testing.T) {
+	server := startTestDNSServer(t, answerA)
+	servers := ecsServers
+	ecsServers = []string{server}
+	defer func() { ecsServers = servers }()
+
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.createECSTask("example.com-dig-ecs.txt", "example.com").run(context.Background())
+
+	reports, ok := a.results["example.com-dig-ecs"].([]*dnsReport)
+	if !ok || len(reports) != len(ecsSubnets) {
+		t.Fatalf("results = %#v", a.results["example.com-dig-ecs"])
+	}
+	for i, r := range reports {
+		// The test server echoes the subnet with a scope of 24.
+		scope := r.ClientSubnetScope
+		if r.Error != "" || r.ClientSubnet != ecsSubnets[i] || scope == nil || *scope != 24 {
+			t.Errorf("report for %s = %+v", ecsSubnets[i], r)
+		}
+	}
+	out := string(storedContents(t, a, "example.com-dig-ecs.txt"))
+	if strings.Count(out, ";; SERVER: "+server) != len(ecsSubnets) {
+		t.Errorf("output:\n%s", out)
+	}
+	if a.hasErrors() {
+		t.Error("errors were recorded")
+	}
+}
@@ -0,0 +1,111 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// ednsBufferSizes are the EDNS0 UDP buffer sizes each resolver is queried
+// with. Zero means the query has no OPT record, limiting the response to
+// 512 bytes.
+var ednsBufferSizes = []uint16{0, 512, ednsBufferSize, 4096}
+
+// ednsQuery has a large answer, particularly with the DNSSEC OK bit set, so
+// it is truncated at the smaller buffer sizes and must be retried over TCP.
+var ednsQuery = newDNSQuery(".", dns.TypeDNSKEY)
+
+// ednsProbe is the result of probing a resolver's EDNS0 and TCP support.
+type ednsProbe struct {
+	Resolver string        `json:"resolver"`
+	UDP      []*ednsResult `json:"udp"`
+	TCP      endpointCheck `json:"tcp"`
+	// TCPSize is the size of the response over TCP, which is never
+	// truncated.
+	TCPSize int `json:"tcp_size,omitempty"`
+}
+
+// ednsResult is the response to a query over UDP with a single buffer
+// size.
+type ednsResult struct {
+	BufferSize   uint16 `json:"buffer_size"`
+	ResponseSize int    `json:"response_size,omitempty"`
+	Truncated    bool   `json:"truncated"`
+	// ServerBufferSize is the buffer size in the response's OPT record, if
+	// it has one.
+	ServerBufferSize uint16  `json:"server_buffer_size,omitempty"`
+	Rcode            string  `json:"rcode,omitempty"`
+	RTTMS            float64 `json:"rtt_ms"`
+	Error            string  `json:"error,omitempty"`
+}
+
+// addEDNS probes each nameserver in resolv.conf for EDNS0 buffer sizes,
+// truncation, and TCP support and writes the results to dns-edns.json.
+func (a *analyzer) addEDNS(ctx context.Context) {
+	servers, err := systemResolvers()
+	if err != nil {
+		a.storeError(ctx, err)
+		return
+	}
+
+	results := make([]*ednsProbe, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			results[i] = probeEDNS(ctx, server)
+		}(i, server)
+	}
+	wg.Wait()
+
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding dns-edns.json"))
+		return
+	}
+	a.storeFile("dns-edns.json", b)
+	a.storeResult("dns-edns", results)
+}
+
+func probeEDNS(ctx context.Context, server string) *ednsProbe {
+	p := &ednsProbe{Resolver: server}
+
+	for _, size := range ednsBufferSizes {
+		m := new(dns.Msg)
+		m.SetQuestion(ednsQuery.name, ednsQuery.qtype)
+		if size > 0 {
+			m.SetEdns0(size, true)
+		}
+
+		// The read buffer is as large as possible so that we can see if
+		// the server ignores the buffer size.
+		c := newDNSClient(ctx, "udp")
+		c.UDPSize = dns.MaxMsgSize
+		resp, rtt, err := c.ExchangeContext(ctx, m, server)
+		r := &ednsResult{BufferSize: size, RTTMS: durationMS(rtt), Error: errorString(err)}
+		if err == nil {
+			r.ResponseSize = resp.Len()
+			r.Truncated = resp.Truncated
+			r.Rcode = dns.RcodeToString[resp.Rcode]
+			if opt := resp.IsEdns0(); opt != nil {
+				r.ServerBufferSize = opt.UDPSize()
+			}
+		}
+		p.UDP = append(p.UDP, r)
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion(ednsQuery.name, ednsQuery.qtype)
+	m.SetEdns0(ednsBufferSize, true)
+	c := newDNSClient(ctx, "tcp")
+	resp, rtt, err := c.ExchangeContext(ctx, m, server)
+	p.TCP = endpointCheck{OK: err == nil, DurationMS: durationMS(rtt), Error: errorString(err)}
+	if err == nil {
+		p.TCPSize = resp.Len()
+	}
+	return p
+}
@@ -0,0 +1,121 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// answerLarge answers with about 3000 bytes of records, truncated to fit
+// the client's buffer size over UDP. It advertises a buffer size of 1232.
+func answerLarge(w dns.ResponseWriter, req *dns.Msg) {
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	for i := 0; i < 40; i++ {
+		resp.Answer = append(resp.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{fmt.Sprintf("%02d%s", i, strings.Repeat("x", 60))},
+		})
+	}
+	size := dns.MinMsgSize
+	if opt := req.IsEdns0(); opt != nil {
+		size = int(opt.UDPSize())
+		resp.SetEdns0(ednsBufferSize, false)
+	}
+	if w.LocalAddr().Network() == "udp" {
+		resp.Truncate(size)
+	}
+	_ = w.WriteMsg(resp)
+}
+
+func TestProbeEDNS(t *testing.T) {
+	server := startTestDNSServer(t, answerLarge)
+	p := probeEDNS(context.Background(), server)
+
+	if p.Resolver != server || !p.TCP.OK || p.TCPSize < 2500 {
+		t.Errorf("probe = %+v", p)
+	}
+	if len(p.UDP) != len(ednsBufferSizes) {
+		t.Fatalf("%d UDP results", len(p.UDP))
+	}
+	for _, r := range p.UDP {
+		if r.Error != "" || r.Rcode != "NOERROR" {
+			t.Errorf("buffer size %d: %+v", r.BufferSize, r)
+		}
+		if truncated := r.BufferSize < 4096; r.Truncated != truncated {
+			t.Errorf("buffer size %d: truncated = %t", r.BufferSize, r.Truncated)
+		}
+		if r.BufferSize > 0 && r.ResponseSize > int(r.BufferSize) {
+			t.Errorf("buffer size %d: response size %d", r.BufferSize, r.ResponseSize)
+		}
+		// Without an OPT record in the query, there is none in the
+		// response.
+		want := uint16(ednsBufferSize)
+		if r.BufferSize == 0 {
+			want = 0
+		}
+		if r.ServerBufferSize != want {
+			t.Errorf("buffer size %d: server buffer size = %d, want %d", r.BufferSize, r.ServerBufferSize, want)
+		}
+	}
+	if findings := findingsFor(map[string]interface{}{"dns-edns": []*ednsProbe{p}}); len(findings) != 0 {
+		t.Errorf("findings = %v", findingChecks(findings))
+	}
+}
+
+func TestProbeEDNSWithoutTCP(t *testing.T) {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dns.Server{PacketConn: pc, Handler: dns.HandlerFunc(answerLarge)}
+	started := make(chan struct{})
+	s.NotifyStartedFunc = func() { close(started) }
+	go func() { _ = s.ActivateAndServe() }()
+	<-started
+	defer func() { _ = s.Shutdown() }()
+
+	p := probeEDNS(context.Background(), pc.LocalAddr().String())
+	if p.TCP.OK || p.TCP.Error == "" || p.TCPSize != 0 {
+		t.Errorf("TCP = %+v", p.TCP)
+	}
+	fs := findingsFor(map[string]interface{}{"dns-edns": []*ednsProbe{p}})
+	if got := strings.Join(findingChecks(fs), ","); got != "dns-tcp-broken" {
+		t.Errorf("checks = %s", got)
+	}
+}
+
+func TestEDNSFindings(t *testing.T) {
+	udp := func(errs ...string) []*ednsResult {
+		var rs []*ednsResult
+		for i, size := range ednsBufferSizes {
+			rs = append(rs, &ednsResult{BufferSize: size, Error: errs[i]})
+		}
+		return rs
+	}
+	tests := []struct {
+		probe *ednsProbe
+		want  string
+	}{
+		{&ednsProbe{UDP: udp("", "", "", ""), TCP: endpointCheck{OK: true}}, ""},
+		{&ednsProbe{UDP: udp("", "", "i/o timeout", "i/o timeout"), TCP: endpointCheck{OK: true}}, "dns-edns-broken"},
+		// A resolver that does not answer at all is reported by
+		// dns-no-response instead.
+		{&ednsProbe{UDP: udp("timeout", "timeout", "timeout", "timeout")}, ""},
+	}
+	for _, test := range tests {
+		test.probe.Resolver = "192.0.2.53:53"
+		fs := findingsFor(map[string]interface{}{"dns-edns": []*ednsProbe{test.probe}})
+		if got := strings.Join(findingChecks(fs), ","); got != test.want {
+			t.Errorf("findings = %s, want %s", got, test.want)
+			continue
+		}
+		if test.want == "dns-edns-broken" && !strings.Contains(fs[0].Summary, "1232 or 4096 bytes") {
+			t.Errorf("summary = %q", fs[0].Summary)
+		}
+	}
+}
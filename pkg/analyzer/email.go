@@ -0,0 +1,357 @@
+package analyzer
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The environment variables with the SMTP settings for --email-to. They
+// override those in the [email] table of the config file, and are the
+// only place other than the config file that the password may be given.
+const (
+	smtpServerEnv   = "MM_NETWORK_ANALYZER_SMTP_SERVER"
+	smtpFromEnv     = "MM_NETWORK_ANALYZER_SMTP_FROM"
+	smtpUsernameEnv = "MM_NETWORK_ANALYZER_SMTP_USERNAME"
+	smtpPasswordEnv = "MM_NETWORK_ANALYZER_SMTP_PASSWORD"
+)
+
+const (
+	// defaultMaxAttachment is the largest archive part that is attached.
+	// Base64 makes the message a third larger, and many mail servers
+	// reject messages larger than 10 to 25 MB.
+	defaultMaxAttachment = 10 << 20
+	emailDialTimeout     = 30 * time.Second
+	emailTimeout         = 5 * time.Minute
+	// smtpsPort is the port for SMTP over implicit TLS rather than
+	// STARTTLS.
+	smtpsPort = "465"
+)
+
+// emailConfig is the [email] table of the config file.
+type emailConfig struct {
+	// Server is the SMTP server's host and port, e.g.,
+	// "smtp.example.com:587".
+	Server   string `toml:"server"`
+	From     string `toml:"from"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	// MaxAttachmentSize is the largest archive part that is attached,
+	// e.g., "10MB". A larger archive is sent as a link if it was
+	// uploaded.
+	MaxAttachmentSize string `toml:"max_attachment_size"`
+}
+
+// emailSettings are the resolved settings for --email-to.
+type emailSettings struct {
+	server        string
+	host          string
+	port          string
+	from          *mail.Address
+	to            []*mail.Address
+	username      string
+	password      string
+	maxAttachment int64
+	// insecure allows the message to be sent unencrypted if the server
+	// does not offer STARTTLS. It is set with --email-insecure.
+	insecure bool
+	// rootCAs are the CAs the server's certificate is verified against,
+	// or nil for the system's.
+	rootCAs *x509.CertPool
+}
+
+// newEmailSettings returns the settings for mailing the archive to the
+// given recipients from conf, which may be nil, and the environment. If
+// insecure is true, the message is sent unencrypted to a server that does
+// not offer STARTTLS.
+func newEmailSettings(conf *emailConfig, to []string, insecure bool) (*emailSettings, error) {
+	c := emailConfig{}
+	if conf != nil {
+		c = *conf
+	}
+	for _, v := range []struct {
+		env   string
+		value *string
+	}{
+		{smtpServerEnv, &c.Server},
+		{smtpFromEnv, &c.From},
+		{smtpUsernameEnv, &c.Username},
+		{smtpPasswordEnv, &c.Password},
+	} {
+		if s := os.Getenv(v.env); s != "" {
+			*v.value = s
+		}
+	}
+	if c.Server == "" || c.From == "" {
+		return nil, errors.Errorf(
+			"--email-to requires an SMTP server and sender, set in the [email] table of --config or with %s and %s",
+			smtpServerEnv, smtpFromEnv,
+		)
+	}
+
+	s := &emailSettings{
+		server:        c.Server,
+		username:      c.Username,
+		password:      c.Password,
+		maxAttachment: defaultMaxAttachment,
+		insecure:      insecure,
+	}
+	var err error
+	s.host, s.port, err = net.SplitHostPort(c.Server)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid SMTP server %q, which must include the port", c.Server)
+	}
+	s.from, err = mail.ParseAddress(c.From)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid sender address %q", c.From)
+	}
+	for _, addr := range to {
+		parsed, err := mail.ParseAddressList(addr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid --email-to address %q", addr)
+		}
+		s.to = append(s.to, parsed...)
+	}
+	if c.MaxAttachmentSize != "" {
+		var size byteSize
+		if err := size.Set(c.MaxAttachmentSize); err != nil {
+			return nil, errors.Wrap(err, "invalid max_attachment_size")
+		}
+		s.maxAttachment = int64(size)
+	}
+	return s, nil
+}
+
+// emailArchive mails the archive parts at paths. Each part is attached to
+// its own message if every part fits within the attachment limit.
+// Otherwise, links, which are the URLs the archive was uploaded to, are
+// sent instead. The subject names host, which is redacted with --redact.
+func (s *emailSettings) emailArchive(paths, links []string, host, reference string) error {
+	attach := true
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return errors.Wrap(err, "error getting the size of the archive")
+		}
+		if fi.Size() > s.maxAttachment {
+			attach = false
+		}
+	}
+	if !attach && len(links) == 0 {
+		return errors.Errorf(
+			"the archive is larger than the %d-byte attachment limit; "+
+				"split it with --max-archive-size or upload it with --upload or --upload-to to mail a link",
+			s.maxAttachment,
+		)
+	}
+
+	subject := "Network diagnostics from " + host
+	if reference != "" {
+		subject += " for " + reference
+	}
+	if !attach {
+		return s.send(subject, nil, links)
+	}
+	for i, path := range paths {
+		partSubject := subject
+		if len(paths) > 1 {
+			partSubject += fmt.Sprintf(" (part %d of %d)", i+1, len(paths))
+		}
+		if err := s.send(partSubject, []string{path}, links); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends a message with the files at paths attached. The connection
+// must be encrypted, either with TLS throughout on port 465 or with
+// STARTTLS, unless insecure is set.
+func (s *emailSettings) send(subject string, paths, links []string) error {
+	dialer := &net.Dialer{Timeout: emailDialTimeout}
+	tlsConfig := &tls.Config{ServerName: s.host, RootCAs: s.rootCAs, MinVersion: tls.VersionTLS12}
+	var conn net.Conn
+	var err error
+	if s.port == smtpsPort {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.server, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", s.server)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "error connecting to SMTP server %s", s.server)
+	}
+	_ = conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		_ = conn.Close()
+		return errors.Wrapf(err, "error starting SMTP session with %s", s.server)
+	}
+	defer c.Close()
+
+	if s.port != smtpsPort {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return errors.Wrap(err, "error starting TLS with the SMTP server")
+			}
+		} else if !s.insecure {
+			return errors.Errorf(
+				"the SMTP server %s does not offer STARTTLS; use --email-insecure to send the archive unencrypted",
+				s.server,
+			)
+		}
+	}
+	// PlainAuth refuses to send the password without TLS unless the server
+	// is local.
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return errors.Wrap(err, "error authenticating with the SMTP server")
+		}
+	}
+	if err := c.Mail(s.from.Address); err != nil {
+		return errors.Wrap(err, "error setting the sender")
+	}
+	for _, addr := range s.to {
+		if err := c.Rcpt(addr.Address); err != nil {
+			return errors.Wrapf(err, "error adding recipient %s", addr.Address)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return errors.Wrap(err, "error starting the message")
+	}
+	if err := s.writeMessage(w, subject, paths, links); err != nil {
+		_ = w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "error sending the message")
+	}
+	return errors.Wrap(c.Quit(), "error ending SMTP session")
+}
+
+// writeMessage writes a MIME message with a text body and the files at
+// paths attached. The attachments are streamed rather than read into
+// memory.
+func (s *emailSettings) writeMessage(w io.Writer, subject string, paths, links []string) error {
+	var to []string
+	for _, addr := range s.to {
+		to = append(to, addr.String())
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	_, domain, _ := strings.Cut(s.from.Address, "@")
+
+	mw := multipart.NewWriter(w)
+	headers := []string{
+		"From: " + s.from.String(),
+		"To: " + strings.Join(to, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + hex.EncodeToString(id) + "@" + domain + ">",
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/mixed; boundary=" + mw.Boundary(),
+	}
+	if _, err := io.WriteString(w, strings.Join(headers, "\r\n")+"\r\n\r\n"); err != nil {
+		return errors.Wrap(err, "error writing message headers")
+	}
+
+	body, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return errors.Wrap(err, "error writing message body")
+	}
+	var text strings.Builder
+	text.WriteString("The diagnostic information collected by mm-network-analyzer ")
+	if len(paths) > 0 {
+		text.WriteString("is attached.\r\n")
+	} else {
+		text.WriteString("is too large to attach.\r\n")
+	}
+	if len(links) > 0 {
+		text.WriteString("\r\nIt was uploaded to:\r\n\r\n")
+		for _, link := range links {
+			text.WriteString(link + "\r\n")
+		}
+	}
+	if _, err := io.WriteString(body, text.String()); err != nil {
+		return errors.Wrap(err, "error writing message body")
+	}
+
+	for _, path := range paths {
+		if err := writeAttachment(mw, path); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(mw.Close(), "error finishing message")
+}
+
+func writeAttachment(mw *multipart.Writer, path string) error {
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return errors.Wrap(err, "error opening archive to attach")
+	}
+	defer f.Close()
+
+	name := filepath.Base(path)
+	part, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"application/octet-stream"},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": name})},
+	})
+	if err != nil {
+		return errors.Wrap(err, "error attaching "+name)
+	}
+	enc := base64.NewEncoder(base64.StdEncoding, &lineWrapper{w: part})
+	if _, err := io.Copy(enc, f); err != nil {
+		return errors.Wrap(err, "error attaching "+name)
+	}
+	if err := enc.Close(); err != nil {
+		return errors.Wrap(err, "error attaching "+name)
+	}
+	_, err = io.WriteString(part, "\r\n")
+	return errors.Wrap(err, "error attaching "+name)
+}
+
+// lineWrapper breaks what is written to it into lines of at most 76
+// bytes, as MIME requires of base64 content.
+type lineWrapper struct {
+	w   io.Writer
+	col int
+}
+
+func (l *lineWrapper) Write(p []byte) (int, error) {
+	const lineLen = 76
+	written := 0
+	for len(p) > 0 {
+		if l.col == lineLen {
+			if _, err := io.WriteString(l.w, "\r\n"); err != nil {
+				return written, err
+			}
+			l.col = 0
+		}
+		n := min(lineLen-l.col, len(p))
+		if _, err := l.w.Write(p[:n]); err != nil {
+			return written, err
+		}
+		l.col += n
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,236 @@
+package analyzer
+
+import (
+	"crypto/tls"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts one SMTP session and records the message and
+// whether it was sent over TLS.
+type fakeSMTPServer struct {
+	listener net.Listener
+	cert     *tls.Certificate
+	done     chan struct{}
+	message  string
+	tls      bool
+}
+
+// newFakeSMTPServer starts a server that offers STARTTLS if cert is not nil.
+func newFakeSMTPServer(t *testing.T, cert *tls.Certificate) *fakeSMTPServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: l, cert: cert, done: make(chan struct{})}
+	go s.serve()
+	t.Cleanup(func() { _ = l.Close() })
+	return s
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	tp := textproto.NewConn(conn)
+	_ = tp.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			if s.cert != nil && !s.tls {
+				_ = tp.PrintfLine("250-localhost")
+				_ = tp.PrintfLine("250 STARTTLS")
+			} else {
+				_ = tp.PrintfLine("250 localhost")
+			}
+		case "STARTTLS":
+			_ = tp.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, &tls.Config{
+				Certificates: []tls.Certificate{*s.cert},
+				MinVersion:   tls.VersionTLS12,
+			})
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, tp, s.tls = tlsConn, textproto.NewConn(tlsConn), true
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			b, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.message = string(b)
+			_ = tp.PrintfLine("250 queued")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func testEmailSettings(t *testing.T, server string, insecure bool) *emailSettings {
+	t.Helper()
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &emailSettings{
+		server:        server,
+		host:          host,
+		port:          port,
+		from:          &mail.Address{Address: "diagnostics@example.com"},
+		to:            []*mail.Address{{Address: "support@example.com"}},
+		maxAttachment: defaultMaxAttachment,
+		insecure:      insecure,
+	}
+}
+
+func TestEmailRequiresTLS(t *testing.T) {
+	server := newFakeSMTPServer(t, nil)
+	s := testEmailSettings(t, server.listener.Addr().String(), false)
+	err := s.send("Network diagnostics", nil, []string{"https://example.com/archive"})
+	if err == nil || !strings.Contains(err.Error(), "--email-insecure") {
+		t.Fatalf("sending without STARTTLS returned %v", err)
+	}
+	<-server.done
+	if server.message != "" {
+		t.Error("the message was sent unencrypted")
+	}
+}
+
+func TestEmailInsecure(t *testing.T) {
+	server := newFakeSMTPServer(t, nil)
+	s := testEmailSettings(t, server.listener.Addr().String(), true)
+	if err := s.send("Network diagnostics", nil, []string{"https://example.com/archive"}); err != nil {
+		t.Fatal(err)
+	}
+	<-server.done
+	if server.tls {
+		t.Error("the server did not offer STARTTLS but the session used TLS")
+	}
+	if !strings.Contains(server.message, "https://example.com/archive") {
+		t.Errorf("message = %q", server.message)
+	}
+}
+
+func TestEmailArchiveRedactsHost(t *testing.T) {
+	host, _ := os.Hostname()
+	if host == "" || host == "localhost" {
+		t.Skip("the host name is not redacted")
+	}
+	r, err := newRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &analyzer{redactor: r}
+	path := filepath.Join(t.TempDir(), "mm-network-analysis.zip")
+	if err := os.WriteFile(path, []byte("PK"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newFakeSMTPServer(t, nil)
+	s := testEmailSettings(t, server.listener.Addr().String(), true)
+	if err := s.emailArchive([]string{path}, nil, a.hostname(), "CASE-1"); err != nil {
+		t.Fatal(err)
+	}
+	<-server.done
+	var subject string
+	for _, line := range strings.Split(server.message, "\n") {
+		if strings.HasPrefix(line, "Subject: ") {
+			subject = strings.TrimSpace(line)
+		}
+	}
+	if subject != "Subject: Network diagnostics from [REDACTED-HOSTNAME] for CASE-1" {
+		t.Errorf("subject = %q", subject)
+	}
+}
+
+func TestEmailStartTLS(t *testing.T) {
+	cert, pool := testCertificate(t)
+	server := newFakeSMTPServer(t, cert)
+	s := testEmailSettings(t, server.listener.Addr().String(), false)
+	s.rootCAs = pool
+
+	path := writeTestArchive(t, "archive contents")
+	if err := s.send("Network diagnostics", []string{path}, nil); err != nil {
+		t.Fatal(err)
+	}
+	<-server.done
+	if !server.tls {
+		t.Error("the message was not sent over TLS")
+	}
+	if !strings.Contains(server.message, "Content-Disposition: attachment") {
+		t.Errorf("the message has no attachment: %q", server.message)
+	}
+}
+
+func TestEmailStartTLSUntrusted(t *testing.T) {
+	cert, _ := testCertificate(t)
+	server := newFakeSMTPServer(t, cert)
+	s := testEmailSettings(t, server.listener.Addr().String(), true)
+	// The certificate is not trusted, and --email-insecure does not allow
+	// falling back to plaintext after STARTTLS fails.
+	if err := s.send("Network diagnostics", nil, []string{"https://example.com/archive"}); err == nil {
+		t.Fatal("sending to a server with an untrusted certificate succeeded")
+	}
+	<-server.done
+	if server.message != "" {
+		t.Error("the message was sent")
+	}
+}
+
+func TestNewEmailSettings(t *testing.T) {
+	for _, env := range []string{smtpServerEnv, smtpFromEnv, smtpUsernameEnv, smtpPasswordEnv} {
+		t.Setenv(env, "")
+	}
+	conf := &emailConfig{
+		Server:            "smtp.example.com:587",
+		From:              "Diagnostics <diagnostics@example.com>",
+		MaxAttachmentSize: "1MiB",
+	}
+	s, err := newEmailSettings(conf, []string{"a@example.com, b@example.com", "c@example.com"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.host != "smtp.example.com" || s.port != "587" || len(s.to) != 3 || s.maxAttachment != 1<<20 || s.insecure {
+		t.Errorf("settings = %+v", s)
+	}
+
+	t.Setenv(smtpServerEnv, "mail.example.com:465")
+	s, err = newEmailSettings(conf, []string{"a@example.com"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.server != "mail.example.com:465" || !s.insecure {
+		t.Errorf("settings = %+v", s)
+	}
+
+	for _, bad := range []*emailConfig{
+		nil,
+		{Server: "smtp.example.com", From: "diagnostics@example.com"},
+		{Server: "smtp.example.com:587", From: "not an address"},
+		{Server: "smtp.example.com:587", From: "diagnostics@example.com", MaxAttachmentSize: "big"},
+	} {
+		t.Setenv(smtpServerEnv, "")
+		if _, err := newEmailSettings(bad, []string{"a@example.com"}, false); err == nil {
+			t.Errorf("newEmailSettings(%+v) succeeded", bad)
+		}
+	}
+}
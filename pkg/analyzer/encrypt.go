@@ -0,0 +1,92 @@
+package analyzer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+// passphraseEnv may hold the passphrase for --encrypt-passphrase so that
+// it need not be typed.
+const passphraseEnv = "MM_NETWORK_ANALYZER_PASSPHRASE"
+
+// encryptionRecipients returns the age recipients to encrypt the archive
+// to, or nil if the archive should not be encrypted.
+func encryptionRecipients(publicKeys []string, usePassphrase bool) ([]age.Recipient, error) {
+	if usePassphrase && len(publicKeys) > 0 {
+		return nil, errors.New("--encrypt-to and --encrypt-passphrase may not be used together")
+	}
+
+	if usePassphrase {
+		passphrase, err := readPassphrase()
+		if err != nil {
+			return nil, err
+		}
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating passphrase recipient")
+		}
+		return []age.Recipient{r}, nil
+	}
+
+	var recipients []age.Recipient
+	for _, k := range publicKeys {
+		r, err := age.ParseX25519Recipient(k)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing age public key %q", k)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+func readPassphrase() (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+	fd := int(os.Stdin.Fd()) // nolint: gosec
+	if !term.IsTerminal(fd) {
+		return "", errors.Errorf("%s must be set when not running in a terminal", passphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase to encrypt the archive with: ")
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading passphrase")
+	}
+	passphrase := strings.TrimSpace(string(b))
+	if passphrase == "" {
+		return "", errors.New("empty passphrase")
+	}
+	return passphrase, nil
+}
+
+// encryptedFile encrypts everything written to it and closes the age
+// stream before the underlying file.
+type encryptedFile struct {
+	io.WriteCloser
+	file io.WriteCloser
+}
+
+func newEncryptedFile(f io.WriteCloser, recipients []age.Recipient) (*encryptedFile, error) {
+	w, err := age.Encrypt(f, recipients...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting encryption")
+	}
+	return &encryptedFile{WriteCloser: w, file: f}, nil
+}
+
+func (e *encryptedFile) Close() error {
+	err := e.WriteCloser.Close()
+	if err != nil {
+		_ = e.file.Close()
+		return errors.Wrap(err, "error finishing encryption")
+	}
+	return e.file.Close()
+}
@@ -0,0 +1,130 @@
+package analyzer
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+// decryptArchive decrypts the archive at path with identity into a new
+// file and returns its path.
+func decryptArchive(t *testing.T, path string, identity age.Identity) string {
+	t.Helper()
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := age.Decrypt(f, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted := strings.TrimSuffix(path, ".age")
+	if err := os.WriteFile(decrypted, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return decrypted
+}
+
+func TestEncryptToPublicKey(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipients, err := encryptionRecipients([]string{identity.Recipient().String()}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.zip.age")
+	w, err := NewArchiveWriter(FormatZip, path, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile("resolv.conf", []byte("nameserver 192.0.2.53\n"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("192.0.2.53")) {
+		t.Error("the archive is not encrypted")
+	}
+	if _, err := age.Decrypt(bytes.NewReader(b), other); err == nil {
+		t.Error("the archive was decrypted with another key")
+	}
+	got := readArchive(t, FormatZip, decryptArchive(t, path, identity))
+	if want := map[string]string{"resolv.conf": "nameserver 192.0.2.53\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("the archive contains %v", got)
+	}
+}
+
+func TestEncryptWithPassphrase(t *testing.T) {
+	t.Setenv(passphraseEnv, "correct horse battery staple")
+	recipients, err := encryptionRecipients(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The default work factor takes about a second.
+	recipients[0].(*age.ScryptRecipient).SetWorkFactor(10)
+
+	path := filepath.Join(t.TempDir(), "out.tar.gz.age")
+	w, err := NewArchiveWriter(FormatTarGz, path, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFile("hosts", []byte("127.0.0.1 localhost\n"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	identity, err := age.NewScryptIdentity("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readArchive(t, FormatTarGz, decryptArchive(t, path, identity))
+	if want := map[string]string{"hosts": "127.0.0.1 localhost\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("the archive contains %v", got)
+	}
+}
+
+func TestEncryptionRecipients(t *testing.T) {
+	recipients, err := encryptionRecipients(nil, false)
+	if err != nil || recipients != nil {
+		t.Errorf("recipients without encryption = %v, %v", recipients, err)
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := identity.Recipient().String()
+	if _, err := encryptionRecipients([]string{key}, true); err == nil {
+		t.Error("encryptionRecipients accepted --encrypt-to with --encrypt-passphrase")
+	}
+	if _, err := encryptionRecipients([]string{key, "age1notakey"}, false); err == nil {
+		t.Error("encryptionRecipients accepted an invalid public key")
+	}
+}
@@ -0,0 +1,123 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const endpointTimeout = 10 * time.Second
+
+// maxmindEndpoints are the hosts customers commonly need to reach.
+var maxmindEndpoints = []string{
+	"geoip.maxmind.com",
+	"geolite.maxmind.com",
+	"download.maxmind.com",
+	"updates.maxmind.com",
+	"minfraud.maxmind.com",
+}
+
+type endpointCheck struct {
+	OK         bool    `json:"ok"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+type endpointHealth struct {
+	Host       string        `json:"host"`
+	Addresses  []string      `json:"addresses,omitempty"`
+	DNS        endpointCheck `json:"dns"`
+	TCP        endpointCheck `json:"tcp_443"`
+	TLS        endpointCheck `json:"tls"`
+	TLSVersion string        `json:"tls_version,omitempty"`
+	HTTP       endpointCheck `json:"http"`
+	HTTPStatus string        `json:"http_status,omitempty"`
+}
+
+// addEndpointHealth probes DNS, TCP, TLS, and HTTP for each MaxMind
+// endpoint and writes the results to endpoint-health.json.
+func (a *analyzer) addEndpointHealth(ctx context.Context) {
+	results := make([]*endpointHealth, len(maxmindEndpoints))
+	var wg sync.WaitGroup
+	for i, host := range maxmindEndpoints {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			results[i] = checkEndpoint(ctx, host)
+		}(i, host)
+	}
+	wg.Wait()
+
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding endpoint-health.json"))
+		return
+	}
+	a.storeFile("endpoint-health.json", b)
+	a.storeResult("endpoint-health", results)
+}
+
+// checkEndpoint runs each check in turn, stopping at the first failure as
+// the later checks depend on the earlier ones.
+func checkEndpoint(ctx context.Context, host string) *endpointHealth {
+	dial := dialConfigFromContext(ctx)
+	h := &endpointHealth{Host: host}
+
+	ctx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	h.DNS = newEndpointCheck(start, err)
+	if err != nil {
+		return h
+	}
+	h.Addresses = addrs
+
+	start = time.Now()
+	dialer := dial.newDialer("tcp")
+	dialer.Timeout = endpointTimeout
+	conn, err := dialer.DialContext(ctx, dial.restrictNetwork("tcp"), net.JoinHostPort(host, "443"))
+	h.TCP = newEndpointCheck(start, err)
+	if err != nil {
+		return h
+	}
+
+	start = time.Now()
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	err = tlsConn.HandshakeContext(ctx)
+	h.TLS = newEndpointCheck(start, err)
+	_ = tlsConn.Close()
+	if err != nil {
+		return h
+	}
+	h.TLSVersion = tlsVersionName(tlsConn.ConnectionState().Version)
+
+	result, err := traceHTTP(ctx, dial.restrictNetwork("tcp"), "https://"+host+"/")
+	h.HTTP = endpointCheck{
+		OK:         err == nil,
+		DurationMS: durationMS(result.totalDuration()),
+	}
+	if err != nil {
+		h.HTTP.Error = err.Error()
+	}
+	h.HTTPStatus = result.status
+
+	return h
+}
+
+func newEndpointCheck(start time.Time, err error) endpointCheck {
+	c := endpointCheck{
+		OK:         err == nil,
+		DurationMS: durationMS(time.Since(start)),
+	}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	return c
+}
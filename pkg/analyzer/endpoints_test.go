@@ -0,0 +1,44 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestCheckEndpointStopsAtFirstFailure(t *testing.T) {
+	// .invalid names never resolve (RFC 6761).
+	h := checkEndpoint(context.Background(), "endpoint.invalid")
+	if h.DNS.OK || h.DNS.Error == "" {
+		t.Errorf("DNS check = %+v", h.DNS)
+	}
+	if h.Addresses != nil || h.TCP != (endpointCheck{}) || h.TLS != (endpointCheck{}) || h.HTTP != (endpointCheck{}) {
+		t.Errorf("the checks after DNS ran: %+v", h)
+	}
+
+	b, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{`"host":"endpoint.invalid"`, `"tcp_443":{"ok":false`, `"dns":{"ok":false`} {
+		if !strings.Contains(string(b), key) {
+			t.Errorf("%s does not contain %s", b, key)
+		}
+	}
+}
+
+func TestNewEndpointCheck(t *testing.T) {
+	start := time.Now().Add(-50 * time.Millisecond)
+	c := newEndpointCheck(start, nil)
+	if !c.OK || c.Error != "" || c.DurationMS < 50 {
+		t.Errorf("successful check = %+v", c)
+	}
+	c = newEndpointCheck(start, errors.New("connection refused"))
+	if c.OK || c.Error != "connection refused" {
+		t.Errorf("failed check = %+v", c)
+	}
+}
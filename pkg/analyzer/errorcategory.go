@@ -0,0 +1,155 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// Error categories in errors.json.
+const (
+	errorToolMissing = "tool_missing"
+	errorTimeout     = "timeout"
+	errorInterrupted = "interrupted"
+	errorDNS         = "dns"
+	errorTCPRefused  = "tcp_refused"
+	errorNetwork     = "network"
+	errorTLS         = "tls"
+	errorHTTP        = "http"
+	errorCommand     = "command_failed"
+	errorOther       = "other"
+)
+
+// taskError is an error and the name of the task that encountered it,
+// which is empty for errors outside of any task.
+type taskError struct {
+	task string
+	err  error
+}
+
+// errorEntry is an entry in errors.json.
+type errorEntry struct {
+	Task     string `json:"task,omitempty"`
+	Category string `json:"category"`
+	Message  string `json:"message"`
+	// HTTPStatus is set for errors in the http category caused by an
+	// unexpected response status.
+	HTTPStatus int `json:"http_status,omitempty"`
+	// ExitCode is set for errors in the command_failed category.
+	ExitCode *int `json:"exit_code,omitempty"`
+}
+
+// httpStatusError is an unexpected HTTP response status.
+type httpStatusError struct {
+	msg  string
+	code int
+}
+
+func (e *httpStatusError) Error() string {
+	return e.msg
+}
+
+// httpStatusErrorf returns an error for an unexpected response status code
+// with the formatted message.
+func httpStatusErrorf(code int, format string, args ...interface{}) error {
+	return errors.WithStack(&httpStatusError{msg: fmt.Sprintf(format, args...), code: code})
+}
+
+// dnsResultError is a DNS response that lacks what was asked for, e.g., an
+// NXDOMAIN response or a missing record, rather than a failed lookup.
+type dnsResultError struct {
+	msg string
+}
+
+func (e *dnsResultError) Error() string {
+	return e.msg
+}
+
+// dnsResultErrorf returns a dnsResultError with the formatted message.
+func dnsResultErrorf(format string, args ...interface{}) error {
+	return errors.WithStack(&dnsResultError{msg: fmt.Sprintf(format, args...)})
+}
+
+// categorizeError returns the category of err. The more specific causes
+// are checked first, e.g., a DNS lookup that times out is a DNS error.
+func categorizeError(err error) string {
+	var dnsErr *net.DNSError
+	var resultErr *dnsResultError
+	var statusErr *httpStatusError
+	var exitErr *exec.ExitError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var opErr *net.OpError
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, exec.ErrNotFound):
+		return errorToolMissing
+	case errors.As(err, &dnsErr), errors.As(err, &resultErr):
+		return errorDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return errorTCPRefused
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr),
+		strings.Contains(err.Error(), "tls: "):
+		return errorTLS
+	case errors.As(err, &statusErr):
+		return errorHTTP
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return errorTimeout
+	case errors.Is(err, context.Canceled):
+		return errorInterrupted
+	case errors.As(err, &opErr):
+		return errorNetwork
+	case errors.As(err, &exitErr):
+		return errorCommand
+	}
+	return errorOther
+}
+
+func newErrorEntry(te *taskError) errorEntry {
+	e := errorEntry{
+		Task:     te.task,
+		Category: categorizeError(te.err),
+		Message:  te.err.Error(),
+	}
+	var statusErr *httpStatusError
+	if e.Category == errorHTTP && errors.As(te.err, &statusErr) {
+		e.HTTPStatus = statusErr.code
+	}
+	var exitErr *exec.ExitError
+	if e.Category == errorCommand && errors.As(te.err, &exitErr) {
+		code := exitErr.ExitCode()
+		e.ExitCode = &code
+	}
+	return e
+}
+
+// addErrorsJSON stores errors.json, which lists the errors with their
+// category and task for automated triage. errorsMutex must be held.
+func (a *analyzer) addErrorsJSON() error {
+	entries := make([]errorEntry, 0, len(a.errors))
+	for _, te := range a.errors {
+		entries = append(entries, newErrorEntry(te))
+	}
+	b, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding errors.json")
+	}
+	a.storeFile("errors.json", b)
+	return nil
+}
@@ -0,0 +1,117 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestCategorizeError(t *testing.T) {
+	// The test binary rejects the unknown flag.
+	exitErr := exec.Command(os.Args[0], "-no-such-flag").Run() // nolint: gosec
+	if exitErr == nil {
+		t.Fatal("the test binary accepted an unknown flag")
+	}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{errors.Wrap(exec.ErrNotFound, "task mtr was skipped"), errorToolMissing},
+		{&net.DNSError{Err: "no such host", Name: "geoip.maxmind.com", IsNotFound: true}, errorDNS},
+		// A lookup that times out is a DNS error rather than a timeout.
+		{errors.Wrap(&net.DNSError{Err: "i/o timeout", IsTimeout: true}, "error resolving"), errorDNS},
+		{dnsResultErrorf("no TXT record for %s", "geoip.maxmind.com"), errorDNS},
+		{errors.Wrap(refused, "error connecting"), errorTCPRefused},
+		{&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, errorTLS},
+		{tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, errorTLS},
+		{x509.HostnameError{Certificate: &x509.Certificate{}, Host: "geoip.maxmind.com"}, errorTLS},
+		{errors.New("remote error: tls: handshake failure"), errorTLS},
+		{httpStatusErrorf(503, "unexpected status: %s", "503 Service Unavailable"), errorHTTP},
+		{errors.Wrap(context.DeadlineExceeded, "error getting data"), errorTimeout},
+		{&net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}, errorTimeout},
+		{errors.Wrap(context.Canceled, "error getting data"), errorInterrupted},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)}, errorNetwork},
+		{errors.Wrap(exitErr, "error getting data for mtr.txt"), errorCommand},
+		{errors.New("error reading resolv.conf"), errorOther},
+	}
+	for _, test := range tests {
+		if got := categorizeError(test.err); got != test.want {
+			t.Errorf("categorizeError(%v) = %s, want %s", test.err, got, test.want)
+		}
+	}
+}
+
+func TestNewErrorEntry(t *testing.T) {
+	e := newErrorEntry(&taskError{
+		task: "download",
+		err:  errors.Wrap(httpStatusErrorf(404, "unexpected status: 404 Not Found"), "error downloading"),
+	})
+	want := errorEntry{
+		Task:       "download",
+		Category:   errorHTTP,
+		Message:    "error downloading: unexpected status: 404 Not Found",
+		HTTPStatus: 404,
+	}
+	if !reflect.DeepEqual(e, want) {
+		t.Errorf("entry = %+v, want %+v", e, want)
+	}
+
+	err := exec.Command(os.Args[0], "-no-such-flag").Run() // nolint: gosec
+	e = newErrorEntry(&taskError{task: "probe", err: err})
+	if e.Category != errorCommand || e.ExitCode == nil || *e.ExitCode == 0 {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestAddErrorsJSON(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	if err := a.addErrors(); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.files) != 0 {
+		t.Error("files were stored without any errors")
+	}
+
+	a.storeTaskError("", errors.New("error starting the capture"))
+	missing := a.createStoreCommand("mtr.txt", "mtr", "geoip.maxmind.com")
+	missing.missingTools = []string{"mtr"}
+	a.runTasks(context.Background(), []*task{
+		missing,
+		newTask("ntp.json", func(ctx context.Context) {
+			a.storeError(ctx, errors.Wrap(context.DeadlineExceeded, "error querying pool.ntp.org"))
+		}),
+	}, 1, time.Minute)
+	if err := a.addErrors(); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []errorEntry
+	if err := json.Unmarshal(storedContents(t, a, "errors.json"), &entries); err != nil {
+		t.Fatal(err)
+	}
+	want := []errorEntry{
+		{Category: errorOther, Message: "error starting the capture"},
+		{
+			Task:     "mtr",
+			Category: errorToolMissing,
+			Message:  "task mtr was skipped as mtr is not installed: " + exec.ErrNotFound.Error(),
+		},
+		{Task: "ntp", Category: errorTimeout, Message: "error querying pool.ntp.org: context deadline exceeded"},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("errors.json = %+v, want %+v", entries, want)
+	}
+}
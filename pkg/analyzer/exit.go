@@ -0,0 +1,17 @@
+package analyzer
+
+// Exit codes. 2 is used by the flag package for invalid arguments.
+const (
+	exitOK = 0
+	// exitArchiveFailed means that the archive could not be written.
+	exitArchiveFailed = 1
+	// exitTaskErrors means that the archive was written, but some tasks or
+	// the upload failed.
+	exitTaskErrors = 3
+	// exitProblems means that --fail-on-problems was given and a finding
+	// with the error severity was reported.
+	exitProblems = 4
+	// exitUpdateFailed means that the update command could not check for
+	// or install a release.
+	exitUpdateFailed = 5
+)
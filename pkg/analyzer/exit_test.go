@@ -0,0 +1,83 @@
+package analyzer
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runProbe runs the analyzer with only a task from the config file that
+// runs the test binary with args, and returns the exit code.
+func runProbe(t *testing.T, args ...string) int {
+	t.Helper()
+	logger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(logger) })
+
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = fmt.Sprintf("%q", arg)
+	}
+	conf := writeConfig(t, fmt.Sprintf(`
+[[task]]
+name    = "probe"
+command = %q
+args    = [%s]
+`, os.Args[0], strings.Join(quoted, ", ")))
+	output := filepath.Join(t.TempDir(), "out.zip")
+	code := run([]string{"--config", conf, "--only", "probe", "--output", output, "--quiet"})
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("the archive was not written: %v", err)
+	}
+	return code
+}
+
+func TestRunExitCodes(t *testing.T) {
+	if code := runProbe(t, "-test.run=^$"); code != exitOK {
+		t.Errorf("a clean run exited with %d, want %d", code, exitOK)
+	}
+	// The test binary rejects the unknown flag.
+	if code := runProbe(t, "-no-such-flag"); code != exitTaskErrors {
+		t.Errorf("a run with a failed task exited with %d, want %d", code, exitTaskErrors)
+	}
+}
+
+func TestRunToStdout(t *testing.T) {
+	logger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(logger) })
+	conf := writeConfig(t, fmt.Sprintf(`
+[[task]]
+name    = "probe"
+command = %q
+args    = ["-test.run=^$"]
+`, os.Args[0]))
+	path := captureStdout(t)
+	if code := run([]string{"--config", conf, "--only", "probe", "--output", "-", "--quiet"}); code != exitOK {
+		t.Errorf("the run exited with %d", code)
+	}
+	// Nothing but the archive is written to standard output.
+	b, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "PK\x03\x04") {
+		t.Errorf("standard output starts with %q", b[:min(len(b), 20)])
+	}
+	files := readArchive(t, FormatZip, path)
+	if _, ok := files["probe.txt"]; !ok {
+		t.Errorf("the archive contains %v", files)
+	}
+}
+
+func TestHasErrorFindings(t *testing.T) {
+	warning := &Finding{Severity: severityWarning, Check: "clock-skew"}
+	failure := &Finding{Severity: severityError, Check: "dns-no-response"}
+	if hasErrorFindings(nil) || hasErrorFindings([]*Finding{warning}) {
+		t.Error("warnings are reported as problems")
+	}
+	if !hasErrorFindings([]*Finding{warning, failure}) {
+		t.Error("an error finding is not reported as a problem")
+	}
+}
@@ -0,0 +1,134 @@
+package analyzer
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// repeatedFlag is a flag.Value that may be set more than once. Unlike
+// stringSliceFlag, values are not split on commas.
+type repeatedFlag []string
+
+func (r *repeatedFlag) String() string {
+	return strings.Join(*r, " ")
+}
+
+func (r *repeatedFlag) Set(v string) error {
+	*r = append(*r, v)
+	return nil
+}
+
+// Values returns each value the flag was set to, as String joins them
+// ambiguously.
+func (r *repeatedFlag) Values() []string {
+	return *r
+}
+
+// extraCommandTasks returns a task for each --extra-cmd value, which has
+// the form "name=command args...". The output is stored in name.txt, so
+// the name may not contain a "." and may not be that of another task, the
+// output of another task, or a file the analyzer writes itself.
+func (a *analyzer) extraCommandTasks(values []string, tasks []*task) ([]*task, error) {
+	names := map[string]bool{}
+	outputs := map[string]bool{}
+	for _, t := range tasks {
+		names[t.name] = true
+		for _, output := range t.outputs {
+			outputs[output] = true
+		}
+	}
+
+	var extra []*task
+	for _, v := range values {
+		name, cmdline, ok := strings.Cut(v, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, `/\.`) {
+			return nil, errors.Errorf(`--extra-cmd %q is not of the form "name=command args..."`, v)
+		}
+		if isReservedName(name) {
+			return nil, errors.Errorf("--extra-cmd name %q is reserved for a file the analyzer writes", name)
+		}
+		if names[name] || outputs[name+".txt"] {
+			return nil, errors.Errorf("--extra-cmd name %q is already used by another task", name)
+		}
+		args, err := splitCommandLine(cmdline)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing --extra-cmd %q", v)
+		}
+		if len(args) == 0 {
+			return nil, errors.Errorf("--extra-cmd %q has no command", v)
+		}
+		names[name] = true
+		outputs[name+".txt"] = true
+
+		t := a.createStoreCommand(name+".txt", args[0], args[1:]...)
+		t.name = name
+		extra = append(extra, t)
+	}
+	return extra, nil
+}
+
+// isReservedName returns true if name is that of a file the analyzer
+// writes itself, e.g., "errors" for errors.txt and errors.json.
+func isReservedName(name string) bool {
+	for f := range untruncatedFiles {
+		if taskName(f) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitCommandLine splits s into words on unquoted whitespace. Single
+// quotes preserve everything within them; within double quotes and
+// outside of quotes, a backslash escapes the next character. No other
+// shell syntax is interpreted.
+func splitCommandLine(s string) ([]string, error) {
+	var (
+		words   []string
+		word    strings.Builder
+		inWord  bool
+		quote   rune
+		escaped bool
+	)
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
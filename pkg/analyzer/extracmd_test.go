@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"  \t\n", nil},
+		{"ss -tan", []string{"ss", "-tan"}},
+		{"  dig  +short\tgeoip.maxmind.com ", []string{"dig", "+short", "geoip.maxmind.com"}},
+		{`cat '/tmp/a b' "c d"`, []string{"cat", "/tmp/a b", "c d"}},
+		{`echo ''`, []string{"echo", ""}},
+		{`echo a\ b`, []string{"echo", "a b"}},
+		{`echo '\n' "\"" \'`, []string{"echo", `\n`, `"`, `'`}},
+		{`grep -e 'a"b' x"y"'z'`, []string{"grep", "-e", `a"b`, "xyz"}},
+		{`echo $HOME; ls | wc`, []string{"echo", "$HOME;", "ls", "|", "wc"}},
+	}
+	for _, test := range tests {
+		got, err := splitCommandLine(test.in)
+		if err != nil {
+			t.Errorf("splitCommandLine(%q) = %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitCommandLine(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+
+	for _, in := range []string{`echo 'a`, `echo "a`, `echo a\`} {
+		if _, err := splitCommandLine(in); err == nil {
+			t.Errorf("splitCommandLine(%q) succeeded", in)
+		}
+	}
+}
+
+func TestExtraCommandTasks(t *testing.T) {
+	a := &analyzer{}
+	builtIn := []*task{newTask("ntp.json", nil)}
+	extra, err := a.extraCommandTasks([]string{
+		"uptime=uptime -p",
+		" ss-summary = ss -s",
+	}, builtIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extra) != 2 {
+		t.Fatalf("tasks = %+v", extra)
+	}
+	for i, want := range []struct {
+		name    string
+		command []string
+	}{
+		{"uptime", []string{"uptime", "-p"}},
+		{"ss-summary", []string{"ss", "-s"}},
+	} {
+		if extra[i].name != want.name || !reflect.DeepEqual(extra[i].command, want.command) ||
+			extra[i].outputs[0] != want.name+".txt" {
+			t.Errorf("task %d runs %v into %v as %s", i, extra[i].command, extra[i].outputs, extra[i].name)
+		}
+	}
+
+	// A config file task may store its output under another name.
+	load := newTask("load-average.txt", nil)
+	load.name = "load"
+	builtIn = append(builtIn, load)
+	for values, want := range map[string]string{
+		"uptime":              "is not of the form",
+		"uptime.txt=uptime":   "is not of the form",
+		"=uptime":             "is not of the form",
+		"../uptime=uptime":    "is not of the form",
+		"ntp=ntpq -p":         "already used by another task",
+		"a=true,a=false":      "already used by another task",
+		"load-average=uptime": "already used by another task",
+		"errors=true":         "is reserved",
+		"summary=true":        "is reserved",
+		"run=true":            "is reserved",
+		"uptime=  ":           "has no command",
+		"uptime=echo 'a b":    "error parsing --extra-cmd",
+		`c:\uptime=uptime -p`: "is not of the form",
+	} {
+		_, err := a.extraCommandTasks(strings.Split(values, ","), builtIn)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("extraCommandTasks(%q) = %v, want %q", values, err, want)
+		}
+	}
+}
+
+func TestRepeatedFlag(t *testing.T) {
+	var r repeatedFlag
+	for _, v := range []string{"a=echo 1,2", "b=true"} {
+		if err := r.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []string{"a=echo 1,2", "b=true"}; !reflect.DeepEqual(r.Values(), want) {
+		t.Errorf("Values = %q, want %q", r.Values(), want)
+	}
+}
@@ -0,0 +1,663 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Finding severities. Errors are problems that prevent the connection to
+// MaxMind from working; warnings may explain degraded performance or be
+// harmless on some networks.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// maxClockSkewSeconds is the largest difference from the time reported by
+// web servers that is not flagged. A large skew breaks TLS certificate
+// validation and makes timestamps in the output hard to correlate.
+const maxClockSkewSeconds = 60
+
+// Finding is an obvious problem detected in the collected data.
+type Finding struct {
+	// Severity is "error" or "warning".
+	Severity string `json:"severity"`
+	// Check identifies the kind of problem, e.g., "dns-no-response".
+	Check   string `json:"check"`
+	Summary string `json:"summary"`
+	// Tasks are the tasks whose output shows the problem.
+	Tasks []string `json:"tasks,omitempty"`
+}
+
+// findings examines the results of the tasks and returns the problems
+// found, errors first.
+func (a *analyzer) findings() []*Finding {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	names := make([]string, 0, len(a.results))
+	for name := range a.results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var fs []*Finding
+	add := func(severity, check, summary string, tasks ...string) {
+		fs = append(fs, &Finding{Severity: severity, Check: check, Summary: summary, Tasks: tasks})
+	}
+
+	// hostStatus tracks whether any attempt to reach a host succeeded and
+	// which tasks made the attempts.
+	type hostStatus struct {
+		ok    bool
+		tasks []string
+	}
+	httpHosts := map[string]*hostStatus{}
+	pingHosts := map[string]*hostStatus{}
+	ipv6 := &hostStatus{}
+	dnsServers := map[string]*hostStatus{}
+	// systemDNS and dohDNS are the DNS results, by task name, from the
+	// system resolver and from DNS over HTTPS.
+	systemDNS := map[string][]*dnsReport{}
+	dohDNS := map[string][]*dnsReport{}
+	track := func(m map[string]*hostStatus, key, name string, ok bool) {
+		s := m[key]
+		if s == nil {
+			s = &hostStatus{}
+			m[key] = s
+		}
+		s.ok = s.ok || ok
+		s.tasks = append(s.tasks, name)
+	}
+
+	for _, name := range names {
+		switch r := a.results[name].(type) {
+		case []*endpointHealth:
+			for _, h := range r {
+				checkEndpointHealth(h, name, add)
+			}
+		case []*tlsHandshake:
+			checkTLSHandshakes(r, name, add)
+		case []*quicProbe:
+			for _, p := range r {
+				// Clients fall back to TCP, so this is only a problem for
+				// performance.
+				if p.Blocked && p.TCPTLS.OK {
+					add(severityWarning, "quic-blocked", fmt.Sprintf(
+						"QUIC to %s timed out, so UDP 443 is probably blocked; "+
+							"clients trying QUIC first take %.0f ms to fall back to TCP",
+						p.Host, p.FallbackMS,
+					), name)
+				}
+			}
+		case []*ocspCheck:
+			for _, c := range r {
+				checkOCSP(c, name, add)
+			}
+		case []*dnsTransportCheck:
+			checkDNSTransports(r, name, add)
+		case []*resolverCheck:
+			checkResolvers(r, name, add)
+		case *authoritativeComparison:
+			for _, d := range r.Divergent {
+				add(severityWarning, "dns-authoritative-mismatch", r.Host+": "+d, name)
+			}
+		case *soaComparison:
+			checkSOA(r, name, add)
+		case []*geoIPConf:
+			for _, c := range r {
+				if c.PlaceholderKey {
+					add(severityError, "geoipupdate-placeholder-key", c.Path+
+						" has the placeholder license key from an old geoipupdate package; replace it with yours", name)
+				}
+			}
+		case []*mmdbInfo:
+			for _, db := range r {
+				if db.Stale {
+					add(severityWarning, "mmdb-stale", fmt.Sprintf(
+						"%s (%s) was built %.0f days ago; check that geoipupdate is running",
+						db.Path, db.DatabaseType, db.AgeDays,
+					), name)
+				}
+			}
+		case *downloadReport:
+			if r.Error != "" {
+				add(severityError, "download-failure", "the database download failed: "+r.Error, name)
+			}
+			for _, s := range r.Stalls {
+				add(severityWarning, "download-stalled", fmt.Sprintf(
+					"the database download stalled for %.0f ms after %d bytes", s.DurationMS, s.AtBytes,
+				), name)
+			}
+		case *burstReport:
+			if r.RateLimited > 0 {
+				add(severityWarning, "rate-limited", fmt.Sprintf(
+					"%d of %d parallel requests to %s were rate limited; the Server header in the output shows "+
+						"whether MaxMind or something in between limited them",
+					r.RateLimited, len(r.Requests), r.URL,
+				), name)
+			}
+		case *popReport:
+			if len(r.POPs) > 1 {
+				add(severityWarning, "pop-bouncing", fmt.Sprintf(
+					"connections to %s were served by %d CDN edges (%s), so latency may vary between requests",
+					r.URL, len(r.POPs), strings.Join(r.POPs, ", "),
+				), name)
+			}
+		case *keepAliveReport:
+			if r.ClosedEarly {
+				add(severityWarning, "keepalive-closed", "a persistent connection to "+r.URL+
+					" was closed early or could not be reused; something may be closing idle connections", name)
+			}
+		case *sustainedReport:
+			if r.Throttled {
+				add(severityWarning, "throughput-throttled", fmt.Sprintf(
+					"the sustained download slowed from %.1f Mbps to %.1f Mbps, which suggests traffic shaping",
+					r.FirstMbps, r.LastMbps,
+				), name)
+			}
+			if r.StalledSamples > 0 {
+				add(severityWarning, "throughput-stalled", fmt.Sprintf(
+					"nothing was received for %d of the %d seconds of the sustained download",
+					r.StalledSamples, len(r.Samples),
+				), name)
+			}
+		case []*credentialCheck:
+			for _, c := range r {
+				if c.FailedStep != "" {
+					add(severityError, "credentials-failure", fmt.Sprintf(
+						"authenticating to the %s failed at the %s step: %s", c.Service, c.FailedStep, c.Diagnosis,
+					), name)
+				}
+			}
+		case *proxyReport:
+			for _, p := range r.Probes {
+				if !p.Differs {
+					continue
+				}
+				add(severityWarning, "proxy-mismatch", fmt.Sprintf(
+					"%s through the proxy %s: %s; directly: %s", p.URL, p.Proxy, p.Via.describe(), p.Direct.describe(),
+				), name)
+			}
+		case *pacReport:
+			for _, d := range r.Decisions {
+				first, _, _ := strings.Cut(d.Result, ";")
+				if d.Error == "" && strings.TrimSpace(first) != "DIRECT" {
+					add(severityWarning, "pac-proxy", fmt.Sprintf(
+						"the proxy auto-config file at %s sends %s through %q", r.URL, d.URL, d.Result,
+					), name)
+				}
+			}
+		case *ntpReport:
+			if r.OffsetMS != nil && math.Abs(*r.OffsetMS/1000) > maxClockSkewSeconds {
+				direction := "behind"
+				if *r.OffsetMS < 0 {
+					direction = "ahead of"
+				}
+				add(severityWarning, "clock-skew", fmt.Sprintf(
+					"the local clock is %.0f seconds %s the time reported by NTP servers, which breaks "+
+						"TLS certificate validation and signed requests", math.Abs(*r.OffsetMS/1000), direction,
+				), name)
+			}
+		case *hostsReport:
+			for _, o := range r.Overrides {
+				add(severityWarning, "hosts-override", fmt.Sprintf(
+					"%s is set to %s on line %d of %s, which takes precedence over DNS",
+					o.Host, o.Address, o.Line, r.Path,
+				), name)
+			}
+		case *captivePortalReport:
+			if r.Detected {
+				add(severityError, "captive-portal", "a captive portal is intercepting HTTP requests, "+
+					"so other failures may only mean that you need to log in to the network", name)
+			}
+		case *webServiceReport:
+			if r.Error != "" {
+				add(severityError, "web-service-failure", "the GeoIP2 City web service lookup failed: "+r.Error, name)
+			}
+		case []*ednsProbe:
+			for _, p := range r {
+				checkEDNS(p, name, add)
+			}
+		case *dnssecReport:
+			checkDNSSEC(r, name, add)
+		case []*certChainReport:
+			for _, c := range r {
+				checkCertChain(c, name, add)
+			}
+		case *httpReport:
+			u, err := url.Parse(r.URL)
+			if err != nil {
+				continue
+			}
+			track(httpHosts, u.Hostname(), name, r.Error == "")
+			if r.Network == "tcp6" {
+				ipv6.ok = ipv6.ok || r.Error == ""
+				ipv6.tasks = append(ipv6.tasks, name)
+			}
+			if u.Scheme == "https" && r.Error != "" && r.RemoteAddr != "" && r.TLSVersion == "" {
+				add(severityError, "tls-failure", fmt.Sprintf(
+					"the TLS handshake with %s (%s) failed: %s", u.Hostname(), r.RemoteAddr, r.Error,
+				), name)
+			}
+			if r.ClockSkewSeconds != nil && math.Abs(*r.ClockSkewSeconds) > maxClockSkewSeconds {
+				add(severityWarning, "clock-skew", fmt.Sprintf(
+					"the local clock differs from the time reported by %s by %.0f seconds",
+					u.Hostname(), *r.ClockSkewSeconds,
+				), name)
+			}
+		case *http2Report:
+			// A failed TLS handshake is reported by the other checks.
+			if r.TLSVersion != "" && r.Error != "" {
+				add(severityWarning, "http2-failure", "HTTP/2 to "+r.Host+" failed: "+r.Error, name)
+			}
+		case *pingReport:
+			track(pingHosts, r.Host, name, r.Received > 0)
+			if strings.HasSuffix(name, "-ipv6") {
+				ipv6.ok = ipv6.ok || r.Received > 0
+				ipv6.tasks = append(ipv6.tasks, name)
+			}
+		case []*dnsReport:
+			switch {
+			case strings.HasSuffix(name, "-dig"):
+				systemDNS[name] = r
+			case strings.Contains(name, "-dig-doh-"):
+				// DNS over HTTPS being blocked does not affect the
+				// connection to MaxMind, so it is not tracked below.
+				dohDNS[name] = r
+				continue
+			}
+			for _, dr := range r {
+				if dr.Server == "" {
+					continue
+				}
+				track(dnsServers, dr.Server, name, dr.Error == "")
+			}
+		case *tracerouteResult:
+			checkTraceroute(r, name, add)
+		case []*linkReport:
+			for _, l := range r {
+				if l.SpeedMbps > 0 && l.SpeedMbps <= slowLinkMbps {
+					add(severityWarning, "slow-link", fmt.Sprintf(
+						"the interface %s negotiated only %d Mbps, which may be a bad cable or port",
+						l.Interface, l.SpeedMbps,
+					), name)
+				}
+				if l.Duplex == "half" {
+					add(severityWarning, "half-duplex", fmt.Sprintf(
+						"the interface %s negotiated half duplex, which usually means a duplex mismatch "+
+							"that causes collisions and loss under load", l.Interface,
+					), name)
+				}
+			}
+		case *ipv6Check:
+			if !r.Available {
+				add(severityWarning, "no-ipv6", "this host has no IPv6 connectivity, as "+r.Reason+
+					"; the IPv6 tasks were skipped", name)
+			}
+		case *ecnReport:
+			if r.Blackholed {
+				add(severityWarning, "ecn-blackhole", fmt.Sprintf(
+					"SYNs to %s that request ECN are dropped but plain SYNs are answered; clients with ECN "+
+						"enabled cannot connect over %s", r.Address, familyName(r.Network),
+				), name)
+			}
+		case *happyEyeballsReport:
+			if r.Preferred == "IPv6" && r.IPv6 != nil && r.IPv6.Error != "" && r.IPv4 != nil && r.IPv4.Error == "" {
+				add(severityWarning, "ipv6-preferred-broken", fmt.Sprintf(
+					"IPv6 is preferred for %s but connecting over it failed (%s); clients without "+
+						"Happy Eyeballs will hang until their connect timeout before trying IPv4",
+					r.Host, r.IPv6.Error,
+				), name)
+			}
+		case *tcpOptionsReport:
+			if len(r.Stripped) > 0 {
+				add(severityWarning, "tcp-options-stripped", fmt.Sprintf(
+					"the %s connection to %s did not negotiate %s; a middlebox may be stripping TCP options",
+					familyName(r.Network), r.Host, strings.Join(r.Stripped, " or "),
+				), name)
+			}
+		case *pmtuResult:
+			if r.Blackhole {
+				add(severityWarning, "pmtu-blackhole", fmt.Sprintf(
+					"%s packets to %s larger than %d bytes are dropped without a \"packet too big\" error, "+
+						"which can stall downloads; the local interface MTU is %d",
+					familyName(r.Network), r.Host, r.PathMTU, r.LocalMTU,
+				), name)
+			}
+		}
+	}
+
+	for _, host := range sortedKeys(httpHosts) {
+		if s := httpHosts[host]; !s.ok {
+			add(severityError, "http-unreachable", "no HTTP request to "+host+" succeeded", s.tasks...)
+		}
+	}
+	for _, host := range sortedKeys(pingHosts) {
+		// ICMP is often filtered, so this alone does not mean that the
+		// host is unreachable.
+		if s := pingHosts[host]; !s.ok {
+			add(severityWarning, "ping-unanswered", "no ping to "+host+" was answered", s.tasks...)
+		}
+	}
+	if len(ipv6.tasks) > 0 && !ipv6.ok {
+		add(severityWarning, "no-ipv6", "no HTTP request or ping over IPv6 succeeded; "+
+			"this network may not have an IPv6 route", ipv6.tasks...)
+	}
+	checkDNSMismatch(systemDNS, dohDNS, add)
+	for _, server := range sortedKeys(dnsServers) {
+		if s := dnsServers[server]; !s.ok {
+			add(severityError, "dns-no-response", "the DNS server "+server+" did not answer any query", s.tasks...)
+		}
+	}
+
+	sort.SliceStable(fs, func(i, j int) bool {
+		return fs[i].Severity == severityError && fs[j].Severity != severityError
+	})
+	return fs
+}
+
+func checkEndpointHealth(h *endpointHealth, name string, add func(string, string, string, ...string)) {
+	switch {
+	case !h.DNS.OK:
+		add(severityError, "endpoint-down", "could not resolve "+h.Host+": "+h.DNS.Error, name)
+	case !h.TCP.OK:
+		add(severityError, "endpoint-down", "could not connect to "+h.Host+" on port 443: "+h.TCP.Error, name)
+	case !h.TLS.OK:
+		add(severityError, "tls-failure", "the TLS handshake with "+h.Host+" failed: "+h.TLS.Error, name)
+	case !h.HTTP.OK:
+		add(severityError, "endpoint-down", "the HTTPS request to "+h.Host+" failed: "+h.HTTP.Error, name)
+	}
+}
+
+// checkDNSMismatch flags a question for which the system resolver's answers
+// share no records with the answers from DNS over HTTPS, which bypasses the
+// local network's resolvers.
+func checkDNSMismatch(system, doh map[string][]*dnsReport, add func(string, string, string, ...string)) {
+	dohAnswers := map[string]map[string]bool{}
+	dohTasks := map[string][]string{}
+	for _, name := range sortedKeys(doh) {
+		for q, answers := range dnsAnswersByQuestion(doh[name]) {
+			if len(answers) == 0 {
+				continue
+			}
+			if dohAnswers[q] == nil {
+				dohAnswers[q] = map[string]bool{}
+			}
+			for _, answer := range answers {
+				dohAnswers[q][answer] = true
+			}
+			dohTasks[q] = append(dohTasks[q], name)
+		}
+	}
+
+	for _, name := range sortedKeys(system) {
+		answers := dnsAnswersByQuestion(system[name])
+		for _, q := range sortedKeys(answers) {
+			if len(answers[q]) == 0 || dohAnswers[q] == nil {
+				continue
+			}
+			shared := false
+			for _, answer := range answers[q] {
+				shared = shared || dohAnswers[q][answer]
+			}
+			if !shared {
+				add(severityWarning, "dns-mismatch", "the system resolver's answers for "+q+
+					" share no records with those from DNS over HTTPS; it may be returning stale or hijacked records",
+					append([]string{name}, dohTasks[q]...)...)
+			}
+		}
+	}
+}
+
+// checkDNSTransports flags DNS over TLS failing where plain DNS works, which
+// breaks private DNS settings, and answers over UDP that differ from those
+// over TLS, which suggests that plain DNS is being intercepted.
+func checkDNSTransports(checks []*dnsTransportCheck, name string, add func(string, string, string, ...string)) {
+	udpOK := map[string]bool{}
+	for _, c := range checks {
+		if c.Transport == "udp" && c.Error == "" {
+			udpOK[c.Resolver] = true
+		}
+	}
+	for _, c := range checks {
+		if c.Transport != dnsOverTLS || !udpOK[c.Resolver] {
+			continue
+		}
+		switch {
+		case c.Error != "":
+			add(severityWarning, "dot-blocked", "DNS over TLS to "+c.Resolver+
+				" failed even though plain DNS works: "+c.Error, name)
+		case !c.MatchesUDP:
+			add(severityWarning, "dns-transport-mismatch", c.Resolver+
+				" returned different answers over UDP than over TLS; plain DNS may be intercepted", name)
+		}
+	}
+}
+
+// checkResolvers flags configured resolvers that answer none of the
+// queries sent to them. Clients try the others after a timeout, so this is
+// an error only if none of them answer.
+func checkResolvers(checks []*resolverCheck, name string, add func(string, string, string, ...string)) {
+	severity := severityError
+	for _, c := range checks {
+		if c.Latency.Answered > 0 {
+			severity = severityWarning
+		}
+	}
+	for _, c := range checks {
+		if c.Latency.Answered == 0 {
+			add(severity, "dns-resolver-down", fmt.Sprintf(
+				"the configured resolver %s answered none of %d queries: %s", c.Resolver, c.Latency.Sent, c.UDP.Error,
+			), name)
+		}
+	}
+}
+
+// checkSOA flags authoritative servers with different SOA serials, which
+// serve stale records until they catch up, and ones that do not answer.
+func checkSOA(c *soaComparison, name string, add func(string, string, string, ...string)) {
+	var serials []string
+	for _, s := range c.Serials {
+		if s.Error != "" {
+			add(severityWarning, "dns-nameserver-unreachable", fmt.Sprintf(
+				"the authoritative nameserver %s for %s did not return its SOA record: %s",
+				s.Nameserver, c.Zone, s.Error,
+			), name)
+			continue
+		}
+		serials = append(serials, fmt.Sprintf("%s: %d", s.Nameserver, s.Serial))
+	}
+	if c.Mismatch {
+		add(severityWarning, "dns-soa-mismatch", fmt.Sprintf(
+			"the authoritative nameservers for %s have different SOA serials (%s), so some may serve stale records",
+			c.Zone, strings.Join(serials, ", "),
+		), name)
+	}
+}
+
+// checkEDNS flags a resolver that does not answer over TCP, which makes
+// truncated responses fail, and one that does not answer queries with
+// larger EDNS0 buffer sizes, as when a firewall drops fragmented UDP.
+func checkEDNS(p *ednsProbe, name string, add func(string, string, string, ...string)) {
+	udpOK := false
+	var failedSizes []string
+	for _, r := range p.UDP {
+		if r.Error == "" {
+			udpOK = true
+		} else if r.BufferSize > 512 {
+			failedSizes = append(failedSizes, fmt.Sprint(r.BufferSize))
+		}
+	}
+	if !udpOK {
+		// The resolver is not answering at all, which dns-no-response
+		// reports.
+		return
+	}
+	if !p.TCP.OK {
+		add(severityWarning, "dns-tcp-broken", "the resolver "+p.Resolver+
+			" answers over UDP but not TCP, so truncated responses will fail to resolve: "+p.TCP.Error, name)
+	}
+	if len(failedSizes) > 0 {
+		add(severityWarning, "dns-edns-broken", "the resolver "+p.Resolver+
+			" did not answer queries with an EDNS0 buffer size of "+strings.Join(failedSizes, " or ")+
+			" bytes; large UDP responses may be dropped", name)
+	}
+}
+
+// checkDNSSEC flags a chain of trust that does not validate, a resolver
+// that strips signatures, and a resolver that does not validate answers
+// that are secure.
+func checkDNSSEC(r *dnssecReport, name string, add func(string, string, string, ...string)) {
+	switch {
+	case r.Status == dnssecBogus:
+		add(severityError, "dnssec-invalid", "the DNSSEC chain of trust for "+r.Name+
+			" does not validate, so validating resolvers will fail to resolve it: "+r.Error, name)
+	case r.Status == dnssecStripped:
+		add(severityWarning, "dnssec-stripped", "the resolver "+r.Resolver+" did not return the signatures for "+
+			r.Name+", so clients cannot validate it with DNSSEC", name)
+	case r.Status == dnssecSecure && !r.ADBit:
+		add(severityWarning, "dnssec-not-validated", "the resolver "+r.Resolver+
+			" did not set the AD bit for "+r.Name+", which validates; it does not check DNSSEC", name)
+	}
+}
+
+// checkTLSHandshakes flags a TLS version that fails with a host when
+// another version succeeds, as happens with middleboxes that do not
+// understand TLS 1.3. Failures of every version are already reported by
+// the endpoint health check.
+func checkTLSHandshakes(hs []*tlsHandshake, name string, add func(string, string, string, ...string)) {
+	ok := map[string]bool{}
+	for _, h := range hs {
+		ok[h.Host] = ok[h.Host] || h.TLS.OK
+	}
+	for _, h := range hs {
+		if h.TCP.OK && !h.TLS.OK && ok[h.Host] {
+			add(severityWarning, "tls-version-failure", fmt.Sprintf(
+				"the %s handshake with %s failed even though other versions succeeded: %s",
+				h.Version, h.Host, h.TLS.Error,
+			), name)
+		}
+	}
+}
+
+// checkOCSP flags a revoked certificate and an OCSP responder that cannot
+// be reached. Clients that check revocation may wait for the responder on
+// every connection, which makes TLS mysteriously slow.
+func checkOCSP(c *ocspCheck, name string, add func(string, string, string, ...string)) {
+	for _, s := range []*ocspStatus{c.Stapled, c.Response} {
+		if s != nil && s.Status == "revoked" {
+			add(severityError, "certificate-revoked", "the certificate for "+c.Host+" has been revoked", name)
+			return
+		}
+	}
+	if c.Response != nil && c.Response.Error != "" {
+		add(severityWarning, "ocsp-unreachable", fmt.Sprintf(
+			"the OCSP responder %s for %s could not be queried: %s", c.Responder, c.Host, c.Response.Error,
+		), name)
+	}
+}
+
+// checkCertChain flags a certificate chain that is not valid for the host,
+// that is about to expire, or that appears to be from a TLS intercepting
+// proxy. An intercepting proxy's CA may be in the system roots, so
+// interception is flagged even if the chain is valid.
+func checkCertChain(r *certChainReport, name string, add func(string, string, string, ...string)) {
+	if r.Error != "" {
+		return
+	}
+	if r.Interception {
+		add(severityError, "tls-interception", "the certificate for "+r.Host+
+			" was not issued by a known public CA; the connection appears to be intercepted by a proxy", name)
+	}
+	switch {
+	case !r.Verified:
+		add(severityError, "certificate-invalid", "the certificate chain for "+r.Host+
+			" is not valid for the system roots: "+r.VerifyError, name)
+	case r.ExpiresInDays < certificateExpiryDays:
+		add(severityWarning, "certificate-expiring", fmt.Sprintf(
+			"the certificate for %s expires in %.1f days", r.Host, r.ExpiresInDays,
+		), name)
+	}
+}
+
+// checkTraceroute flags a traceroute that did not reach the destination
+// because every hop after some point lost all of its probes. Routers often
+// do not answer probes, so lost hops followed by answering hops are not
+// flagged.
+func checkTraceroute(r *tracerouteResult, name string, add func(string, string, string, ...string)) {
+	if r.Reached {
+		return
+	}
+	last := -1
+	for i, hop := range r.Hops {
+		if hop.Received > 0 {
+			last = i
+		}
+	}
+	if last == len(r.Hops)-1 {
+		return
+	}
+	after := "the first hop"
+	if last >= 0 {
+		after = fmt.Sprintf("hop %d (%s)", r.Hops[last].TTL, strings.Join(r.Hops[last].Addresses, ", "))
+	}
+	add(severityWarning, "traceroute-loss", fmt.Sprintf(
+		"the traceroute to %s did not reach it; all probes were lost after %s", r.Host, after,
+	), name)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// addFindings writes the findings to findings.json and findings.txt and
+// logs each of them. It returns the findings.
+func (a *analyzer) addFindings() ([]*Finding, error) {
+	fs := a.findings()
+	for _, f := range fs {
+		slog.Warn("finding", "severity", f.Severity, "check", f.Check, "summary", f.Summary)
+	}
+
+	b, err := json.MarshalIndent(fs, "", "  ")
+	if err != nil {
+		return fs, errors.Wrap(err, "error encoding findings.json")
+	}
+	a.storeFile("findings.json", b)
+
+	buf := new(bytes.Buffer)
+	if len(fs) == 0 {
+		buf.WriteString("No problems found.\n")
+	}
+	for _, f := range fs {
+		fmt.Fprintf(buf, "%-7s %s: %s\n", strings.ToUpper(f.Severity), f.Check, f.Summary)
+		if len(f.Tasks) > 0 {
+			fmt.Fprintf(buf, "        See: %s\n", strings.Join(f.Tasks, ", "))
+		}
+	}
+	a.storeFile("findings.txt", buf.Bytes())
+	return fs, nil
+}
+
+// hasErrorFindings returns true if any of fs is an error.
+func hasErrorFindings(fs []*Finding) bool {
+	for _, f := range fs {
+		if f.Severity == severityError {
+			return true
+		}
+	}
+	return false
+}
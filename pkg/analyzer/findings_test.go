@@ -0,0 +1,142 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// findingsFor returns the findings for the task results.
+func findingsFor(results map[string]interface{}) []*Finding {
+	a := &analyzer{}
+	for name, r := range results {
+		a.storeResult(name, r)
+	}
+	return a.findings()
+}
+
+// findingChecks returns the checks of fs in order.
+func findingChecks(fs []*Finding) []string {
+	var checks []string
+	for _, f := range fs {
+		checks = append(checks, f.Check)
+	}
+	return checks
+}
+
+func TestFindings(t *testing.T) {
+	skew := 600.0
+	lost := testPingResult(0, 0)
+	lost.host = "geoip.maxmind.com"
+	fs := findingsFor(map[string]interface{}{
+		// The TLS handshake failed after connecting.
+		"geoip.maxmind.com-https-ipv4": &httpReport{
+			URL:        "https://geoip.maxmind.com",
+			Network:    "tcp4",
+			RemoteAddr: "192.0.2.1:443",
+			Error:      "remote error: tls: handshake failure",
+		},
+		"geoip.maxmind.com-https-ipv6": &httpReport{
+			URL:     "https://geoip.maxmind.com",
+			Network: "tcp6",
+			Error:   "connect: network is unreachable",
+		},
+		"updates.maxmind.com-https-ipv4": &httpReport{
+			URL:              "https://updates.maxmind.com",
+			Network:          "tcp4",
+			TLSVersion:       "TLS 1.3",
+			ClockSkewSeconds: &skew,
+		},
+		"geoip.maxmind.com-ping-ipv6": lost.report("geoip.maxmind.com", nil),
+		"geoip.maxmind.com-dig": []*dnsReport{
+			{Question: "geoip.maxmind.com. IN A", Server: "192.0.2.53:53", Error: "i/o timeout"},
+			{Question: "geoip.maxmind.com. IN A", Server: "192.0.2.54:53", Rcode: "NOERROR"},
+		},
+		"geoip.maxmind.com-traceroute": &tracerouteResult{Host: "geoip.maxmind.com", Hops: []*tracerouteHop{
+			{TTL: 1, Addresses: []string{"192.0.2.254"}, Received: 3},
+			{TTL: 2, Loss: 100},
+		}},
+	})
+
+	// Errors come first.
+	want := []string{
+		"tls-failure",
+		"http-unreachable",
+		"dns-no-response",
+		"traceroute-loss",
+		"clock-skew",
+		"ping-unanswered",
+		"no-ipv6",
+	}
+	if got := findingChecks(fs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("checks = %v, want %v", got, want)
+	}
+	for _, test := range []struct {
+		i       int
+		summary string
+		tasks   string
+	}{
+		{
+			1,
+			"no HTTP request to geoip.maxmind.com succeeded",
+			"geoip.maxmind.com-https-ipv4,geoip.maxmind.com-https-ipv6",
+		},
+		{2, "the DNS server 192.0.2.53:53 did not answer any query", "geoip.maxmind.com-dig"},
+		{3, "all probes were lost after hop 1 (192.0.2.254)", "geoip.maxmind.com-traceroute"},
+		{4, "the local clock differs from the time reported by updates.maxmind.com by 600 seconds", ""},
+		{6, "this network may not have an IPv6 route", "geoip.maxmind.com-https-ipv6,geoip.maxmind.com-ping-ipv6"},
+	} {
+		f := fs[test.i]
+		if !strings.Contains(f.Summary, test.summary) {
+			t.Errorf("%s: summary = %q, want %q", f.Check, f.Summary, test.summary)
+		}
+		if test.tasks != "" && strings.Join(f.Tasks, ",") != test.tasks {
+			t.Errorf("%s: tasks = %v, want %s", f.Check, f.Tasks, test.tasks)
+		}
+	}
+}
+
+func TestFindingsHealthy(t *testing.T) {
+	fs := findingsFor(map[string]interface{}{
+		"geoip.maxmind.com-https-ipv6": &httpReport{URL: "https://geoip.maxmind.com", Network: "tcp6"},
+		"geoip.maxmind.com-ping":       testPingResult(10*time.Millisecond).report("geoip.maxmind.com", nil),
+		"geoip.maxmind.com-dig":        []*dnsReport{{Server: "192.0.2.53:53", Rcode: "NOERROR"}},
+		"geoip.maxmind.com-traceroute": &tracerouteResult{Reached: true, Hops: []*tracerouteHop{{TTL: 1, Loss: 100}}},
+	})
+	if len(fs) != 0 {
+		t.Errorf("checks = %v", findingChecks(fs))
+	}
+}
+
+func TestAddFindings(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	if _, err := a.addFindings(); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(storedContents(t, a, "findings.txt")); got != "No problems found.\n" {
+		t.Errorf("findings.txt = %q", got)
+	}
+
+	a = &analyzer{}
+	defer a.removeSpool()
+	a.storeResult("geoip.maxmind.com-https", &httpReport{URL: "https://geoip.maxmind.com", Error: "refused"})
+	fs, err := a.addFindings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ERROR   http-unreachable: no HTTP request to geoip.maxmind.com succeeded\n" +
+		"        See: geoip.maxmind.com-https\n"
+	if got := string(storedContents(t, a, "findings.txt")); got != want {
+		t.Errorf("findings.txt = %q, want %q", got, want)
+	}
+	var stored []*Finding
+	if err := json.Unmarshal(storedContents(t, a, "findings.json"), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stored, fs) {
+		t.Errorf("findings.json = %+v", stored)
+	}
+}
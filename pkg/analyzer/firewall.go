@@ -0,0 +1,144 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// firewallFilter removes the firewall rules that cannot affect our traffic
+// from the output of iptables-save or nft list ruleset. A rule is removed
+// only if it has an address condition that none of the target hosts' or
+// local interfaces' addresses satisfy, so rules without one, and rules
+// using sets, are kept.
+type firewallFilter struct {
+	addrs []netip.Addr
+}
+
+func (a *analyzer) newFirewallFilter(ctx context.Context) *firewallFilter {
+	f := &firewallFilter{addrs: a.targetAddrs(ctx)}
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range ifaceAddrs {
+			if prefix, err := netip.ParsePrefix(addr.String()); err == nil {
+				f.addrs = append(f.addrs, prefix.Addr().Unmap())
+			}
+		}
+	}
+	return f
+}
+
+// filterIPTables filters the output of iptables-save or ip6tables-save.
+func (a *analyzer) filterIPTables(ctx context.Context, output []byte) []byte {
+	f := a.newFirewallFilter(ctx)
+	return f.filterLines(output, f.keepIPTablesLine)
+}
+
+// filterNFT filters the output of nft list ruleset.
+func (a *analyzer) filterNFT(ctx context.Context, output []byte) []byte {
+	f := a.newFirewallFilter(ctx)
+	return f.filterLines(output, f.keepNFTLine)
+}
+
+func (f *firewallFilter) keepIPTablesLine(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != "-A" {
+		return true
+	}
+	for i := 1; i < len(fields)-1; i++ {
+		switch fields[i] {
+		case "-s", "--source", "-d", "--destination":
+		default:
+			continue
+		}
+		if fields[i-1] == "!" {
+			continue
+		}
+		if !f.matchesAny(strings.Split(fields[i+1], ",")) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *firewallFilter) keepNFTLine(line string) bool {
+	fields := strings.Fields(line)
+	for i := 1; i < len(fields)-1; i++ {
+		if (fields[i] != "saddr" && fields[i] != "daddr") ||
+			(fields[i-1] != "ip" && fields[i-1] != "ip6") {
+			continue
+		}
+		value := fields[i+1]
+		// Negations, sets, and anonymous sets are kept.
+		if value == "!=" || strings.HasPrefix(value, "@") || strings.HasPrefix(value, "{") {
+			continue
+		}
+		if !f.matchesAny([]string{value}) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterLines keeps the lines of output for which keep returns true and
+// notes how many were removed.
+func (f *firewallFilter) filterLines(output []byte, keep func(string) bool) []byte {
+	buf := new(bytes.Buffer)
+	removed := 0
+	for line := range strings.Lines(string(output)) {
+		if !keep(line) {
+			removed++
+			continue
+		}
+		buf.WriteString(line)
+	}
+	fmt.Fprintf(buf, "# Removed rules that only match other addresses: %d\n", removed)
+	return buf.Bytes()
+}
+
+// matchesAny returns true if any of our addresses is in one of specs,
+// which are addresses, prefixes, or nft ranges (a-b). Specs that cannot
+// be parsed, such as host names, are assumed to match.
+func (f *firewallFilter) matchesAny(specs []string) bool {
+	for _, spec := range specs {
+		contains, ok := parseAddressSpec(spec)
+		if !ok {
+			return true
+		}
+		for _, addr := range f.addrs {
+			if contains(addr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseAddressSpec(spec string) (func(netip.Addr) bool, bool) {
+	if lo, hi, found := strings.Cut(spec, "-"); found {
+		first, err1 := netip.ParseAddr(lo)
+		last, err2 := netip.ParseAddr(hi)
+		if err1 != nil || err2 != nil {
+			return nil, false
+		}
+		return func(addr netip.Addr) bool {
+			return addr.BitLen() == first.BitLen() && first.Compare(addr) <= 0 && addr.Compare(last) <= 0
+		}, true
+	}
+	if strings.Contains(spec, "/") {
+		prefix, err := netip.ParsePrefix(spec)
+		if err != nil {
+			return nil, false
+		}
+		prefix = prefix.Masked()
+		return prefix.Contains, true
+	}
+	ip, err := netip.ParseAddr(spec)
+	if err != nil {
+		return nil, false
+	}
+	return func(addr netip.Addr) bool { return addr == ip }, true
+}
@@ -0,0 +1,109 @@
+package analyzer
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func testFirewallFilter() *firewallFilter {
+	return &firewallFilter{addrs: []netip.Addr{
+		netip.MustParseAddr("104.18.0.5"),
+		netip.MustParseAddr("192.168.1.20"),
+		netip.MustParseAddr("2606:4700::6812:5"),
+	}}
+}
+
+func TestFilterIPTables(t *testing.T) {
+	output := `*filter
+:INPUT ACCEPT [0:0]
+-A INPUT -s 10.0.0.0/8 -j DROP
+-A INPUT -s 192.168.1.0/24 -j ACCEPT
+-A OUTPUT -d 104.18.0.5/32 -p tcp -m tcp --dport 443 -j REJECT
+-A OUTPUT -d 203.0.113.1,104.18.0.0/16 -j DROP
+-A OUTPUT ! -d 203.0.113.0/24 -j ACCEPT
+-A OUTPUT -d 203.0.113.0/24 -j DROP
+-A OUTPUT -d blocked.example.com -j DROP
+-A OUTPUT -p udp --dport 53 -j ACCEPT
+COMMIT
+`
+	want := `*filter
+:INPUT ACCEPT [0:0]
+-A INPUT -s 192.168.1.0/24 -j ACCEPT
+-A OUTPUT -d 104.18.0.5/32 -p tcp -m tcp --dport 443 -j REJECT
+-A OUTPUT -d 203.0.113.1,104.18.0.0/16 -j DROP
+-A OUTPUT ! -d 203.0.113.0/24 -j ACCEPT
+-A OUTPUT -d blocked.example.com -j DROP
+-A OUTPUT -p udp --dport 53 -j ACCEPT
+COMMIT
+# Removed rules that only match other addresses: 2
+`
+	f := testFirewallFilter()
+	if got := string(f.filterLines([]byte(output), f.keepIPTablesLine)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFilterNFT(t *testing.T) {
+	output := `table inet filter {
+	chain output {
+		type filter hook output priority filter; policy accept;
+		ip daddr 10.0.0.0/8 drop
+		ip daddr 104.18.0.1-104.18.0.9 tcp dport 443 reject
+		ip6 daddr 2001:db8::/32 drop
+		ip6 daddr 2606:4700::/32 accept
+		ip daddr != 203.0.113.0/24 accept
+		ip daddr @blocklist drop
+		ip saddr { 10.0.0.1, 10.0.0.2 } drop
+		udp dport 53 accept
+	}
+}
+`
+	want := `table inet filter {
+	chain output {
+		type filter hook output priority filter; policy accept;
+		ip daddr 104.18.0.1-104.18.0.9 tcp dport 443 reject
+		ip6 daddr 2606:4700::/32 accept
+		ip daddr != 203.0.113.0/24 accept
+		ip daddr @blocklist drop
+		ip saddr { 10.0.0.1, 10.0.0.2 } drop
+		udp dport 53 accept
+	}
+}
+# Removed rules that only match other addresses: 2
+`
+	f := testFirewallFilter()
+	if got := string(f.filterLines([]byte(output), f.keepNFTLine)); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseAddressSpec(t *testing.T) {
+	addr := netip.MustParseAddr("104.18.0.5")
+	tests := []struct {
+		spec            string
+		contains, valid bool
+	}{
+		{"104.18.0.5", true, true},
+		{"104.18.0.6", false, true},
+		{"104.18.0.5/32", true, true},
+		{"104.18.0.9/16", true, true},
+		{"104.19.0.0/16", false, true},
+		{"104.18.0.1-104.18.0.5", true, true},
+		{"104.18.0.6-104.18.0.9", false, true},
+		{"::1-::ffff", false, true},
+		{"2606:4700::/32", false, true},
+		{"104.18.0.1-example", false, false},
+		{"104.18.0.0/33", false, false},
+		{"example.com", false, false},
+	}
+	for _, test := range tests {
+		contains, ok := parseAddressSpec(test.spec)
+		if ok != test.valid {
+			t.Errorf("parseAddressSpec(%q) ok = %v", test.spec, ok)
+			continue
+		}
+		if ok && contains(addr) != test.contains {
+			t.Errorf("%s contains %s = %v", test.spec, addr, !test.contains)
+		}
+	}
+}
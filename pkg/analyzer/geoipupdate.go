@@ -0,0 +1,212 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// geoIPConfPaths are where geoipupdate's packages and its documentation put
+// GeoIP.conf. On Windows, it is under %ProgramData% instead.
+var geoIPConfPaths = []string{
+	"/usr/local/etc/GeoIP.conf",
+	"/etc/GeoIP.conf",
+	"/opt/homebrew/etc/GeoIP.conf",
+}
+
+// geoIPConfEnv names the environment variable geoipupdate reads the path
+// of its configuration file from. geoipupdate reads the other settings
+// from variables with the same prefix.
+const geoIPConfEnv = "GEOIPUPDATE_CONF_FILE"
+
+// licenseKeyLine matches the license key setting in GeoIP.conf.
+var licenseKeyLine = regexp.MustCompile(`(?m)^(\s*LicenseKey\s+)(\S+)`)
+
+// placeholderLicenseKey is the license key in the GeoIP.conf shipped with
+// old geoipupdate packages, which does not work.
+const placeholderLicenseKey = "000000000000"
+
+// geoIPConf is the parsed settings of a GeoIP.conf file.
+type geoIPConf struct {
+	Path              string   `json:"path"`
+	AccountID         string   `json:"account_id,omitempty"`
+	EditionIDs        []string `json:"edition_ids,omitempty"`
+	DatabaseDirectory string   `json:"database_directory,omitempty"`
+	Host              string   `json:"host,omitempty"`
+	Proxy             string   `json:"proxy,omitempty"`
+	HasLicenseKey     bool     `json:"has_license_key"`
+	// PlaceholderKey is true if the license key is placeholderLicenseKey.
+	PlaceholderKey bool `json:"placeholder_key"`
+	licenseKey     string
+}
+
+// findGeoIPConfs returns the paths of the GeoIP.conf files on this machine,
+// starting with the one named by geoIPConfEnv.
+func findGeoIPConfs() []string {
+	var candidates []string
+	if p := os.Getenv(geoIPConfEnv); p != "" {
+		candidates = append(candidates, p)
+	}
+	candidates = append(candidates, geoIPConfPaths...)
+	if d := os.Getenv("ProgramData"); d != "" {
+		candidates = append(candidates, filepath.Join(d, "MaxMind", "GeoIPUpdate", "GeoIP.conf"))
+	}
+
+	var paths []string
+	for _, p := range candidates {
+		if _, err := os.Stat(p); err == nil && !slices.Contains(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// defaultEdition is used to test database downloads unless GeoIP.conf
+// names another edition.
+const defaultEdition = "GeoLite2-City"
+
+// configuredEdition returns the first edition in the first GeoIP.conf, or
+// defaultEdition.
+func configuredEdition() string {
+	if paths := findGeoIPConfs(); len(paths) > 0 {
+		if contents, err := os.ReadFile(paths[0]); err == nil {
+			if ids := parseGeoIPConf(paths[0], contents).EditionIDs; len(ids) > 0 {
+				return ids[0]
+			}
+		}
+	}
+	return defaultEdition
+}
+
+// addGeoIPConf copies each GeoIP.conf found, with its license key
+// redacted, and geoipupdate's environment variables to
+// geoipupdate-conf.txt.
+func (a *analyzer) addGeoIPConf(ctx context.Context) {
+	buf := new(bytes.Buffer)
+	var confs []*geoIPConf
+	for _, p := range findGeoIPConfs() {
+		contents, err := os.ReadFile(p) // nolint: gosec
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error reading %s", p))
+			continue
+		}
+		confs = append(confs, parseGeoIPConf(p, contents))
+		fmt.Fprintf(buf, "# %s\n%s\n", p, licenseKeyLine.ReplaceAll(contents, []byte("${1}<redacted>")))
+	}
+	if len(confs) == 0 {
+		fmt.Fprintf(buf, "# No GeoIP.conf found in %s\n\n", strings.Join(geoIPConfPaths, ", "))
+	}
+
+	var env []string
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(k, "GEOIPUPDATE_") {
+			continue
+		}
+		if k == "GEOIPUPDATE_LICENSE_KEY" {
+			v = "<redacted>"
+		}
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	if len(env) > 0 {
+		fmt.Fprintf(buf, "# Environment\n%s\n", strings.Join(env, "\n"))
+	}
+
+	a.storeFile("geoipupdate-conf.txt", buf.Bytes())
+	a.storeResult("geoipupdate-conf", confs)
+}
+
+func parseGeoIPConf(path string, contents []byte) *geoIPConf {
+	c := &geoIPConf{Path: path}
+	s := bufio.NewScanner(bytes.NewReader(contents))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		// UserId is the old name of AccountID.
+		case "AccountID", "UserId":
+			c.AccountID = fields[1]
+		case "LicenseKey":
+			c.licenseKey = fields[1]
+			c.HasLicenseKey = true
+			c.PlaceholderKey = fields[1] == placeholderLicenseKey
+		// ProductIds is the old name of EditionIDs.
+		case "EditionIDs", "ProductIds":
+			c.EditionIDs = fields[1:]
+		case "DatabaseDirectory":
+			c.DatabaseDirectory = fields[1]
+		case "Host":
+			c.Host = fields[1]
+		case "Proxy":
+			c.Proxy = fields[1]
+		}
+	}
+	return c
+}
+
+// createGeoIPUpdateTask runs geoipupdate verbosely with a temporary
+// database directory, so that the update is tested without replacing the
+// installed databases. The license keys in the output are redacted.
+func (a *analyzer) createGeoIPUpdateTask(f string) *task {
+	t := newTask(f, func(ctx context.Context) {
+		dir, err := os.MkdirTemp("", "mm-network-analyzer-geoipupdate-")
+		if err != nil {
+			a.storeError(ctx, errors.Wrap(err, "error creating geoipupdate database directory"))
+			return
+		}
+		defer os.RemoveAll(dir)
+
+		args := []string{"-v", "-d", dir}
+		var keys []string
+		if paths := findGeoIPConfs(); len(paths) > 0 {
+			args = append(args, "-f", paths[0])
+			if contents, err := os.ReadFile(paths[0]); err == nil {
+				keys = append(keys, parseGeoIPConf(paths[0], contents).licenseKey)
+			}
+		}
+		keys = append(keys, os.Getenv("GEOIPUPDATE_LICENSE_KEY"))
+
+		cmd := commandContext(ctx, "geoipupdate", args...)
+		out := a.newTaskOutput()
+		cmd.Stdout = out
+		cmd.Stderr = out
+		err = cmd.Run()
+		if cmd.ProcessState != nil {
+			record := taskRecordFromContext(ctx)
+			exitCode := cmd.ProcessState.ExitCode()
+			record.ExitCode = &exitCode
+			slog.Debug("command finished", "task", record.Name, "command", "geoipupdate", "exit_code", exitCode)
+		}
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+		}
+		output, err := out.bytes()
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error reading the output for %s", f))
+			return
+		}
+		for _, key := range keys {
+			if key != "" {
+				output = bytes.ReplaceAll(output, []byte(key), []byte("<redacted>"))
+			}
+		}
+		a.storeFile(f, output)
+	})
+	t.command = []string{"geoipupdate", "-v", "-d", "<temporary directory>"}
+	return t.withTags(tagHTTP).
+		withDescription("Runs `geoipupdate -v` with a temporary database directory to test database updates").
+		withTools("geoipupdate")
+}
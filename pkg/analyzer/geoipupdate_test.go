@@ -0,0 +1,141 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGeoIPUpdateTaskOutputIsBounded(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake geoipupdate is a shell script")
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho \"using license key $GEOIPUPDATE_LICENSE_KEY\"\n" +
+		"i=0\nwhile [ $i -lt 2000 ]; do echo 'downloading GeoLite2-City'; i=$((i+1)); done\n" +
+		"echo \"done with $GEOIPUPDATE_LICENSE_KEY\"\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(bin, "geoipupdate"), []byte(script), 0o700); err != nil { // nolint: gosec
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GEOIPUPDATE_LICENSE_KEY", "testlicensekey")
+	t.Setenv(geoIPConfEnv, filepath.Join(bin, "missing.conf"))
+
+	const limit = 4096
+	a := &analyzer{maxTaskOutput: limit}
+	defer a.removeSpool()
+	a.createGeoIPUpdateTask("geoipupdate.txt").run(context.Background())
+
+	b := storedContents(t, a, "geoipupdate.txt")
+	if len(b) > limit {
+		t.Errorf("stored %d bytes, want at most %d", len(b), limit)
+	}
+	if bytes.Contains(b, []byte("testlicensekey")) {
+		t.Errorf("output contains the license key:\n%s", b)
+	}
+	if !bytes.HasPrefix(b, []byte("using license key <redacted>\n")) ||
+		!bytes.HasSuffix(b, []byte("done with <redacted>\n")) {
+		t.Errorf("output does not keep its start and end:\n%s", b)
+	}
+	if !bytes.Contains(b, []byte("bytes truncated")) {
+		t.Error("output has no truncation marker")
+	}
+	if len(a.errors) == 0 {
+		t.Error("the failed command was not reported")
+	}
+}
+
+const testGeoIPConf = `# GeoIP.conf file for geoipupdate
+AccountID 42
+LicenseKey testlicensekey
+EditionIDs GeoIP2-City GeoIP2-ISP
+DatabaseDirectory /var/lib/GeoIP
+# Proxy 192.0.2.1:3128
+`
+
+// useGeoIPConf makes contents the only GeoIP.conf found for the duration
+// of the test and returns its path.
+func useGeoIPConf(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "GeoIP.conf")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(geoIPConfEnv, path)
+	t.Setenv("ProgramData", "")
+	paths := geoIPConfPaths
+	geoIPConfPaths = nil
+	t.Cleanup(func() { geoIPConfPaths = paths })
+	return path
+}
+
+func TestParseGeoIPConf(t *testing.T) {
+	c := parseGeoIPConf("GeoIP.conf", []byte(testGeoIPConf))
+	want := &geoIPConf{
+		Path:              "GeoIP.conf",
+		AccountID:         "42",
+		EditionIDs:        []string{"GeoIP2-City", "GeoIP2-ISP"},
+		DatabaseDirectory: "/var/lib/GeoIP",
+		HasLicenseKey:     true,
+		licenseKey:        "testlicensekey",
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("parseGeoIPConf = %+v, want %+v", c, want)
+	}
+
+	// Old versions of geoipupdate used other names.
+	c = parseGeoIPConf("GeoIP.conf", []byte("UserId 999999\nLicenseKey 000000000000\nProductIds 106 GeoLite2-City\n"))
+	editions := []string{"106", "GeoLite2-City"}
+	if c.AccountID != "999999" || !c.PlaceholderKey || !reflect.DeepEqual(c.EditionIDs, editions) {
+		t.Errorf("parseGeoIPConf of an old file = %+v", c)
+	}
+}
+
+func TestAddGeoIPConf(t *testing.T) {
+	path := useGeoIPConf(t, testGeoIPConf)
+	t.Setenv("GEOIPUPDATE_LICENSE_KEY", "testlicensekey")
+	t.Setenv("GEOIPUPDATE_VERBOSE", "1")
+
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.addGeoIPConf(context.Background())
+
+	b := storedContents(t, a, "geoipupdate-conf.txt")
+	if bytes.Contains(b, []byte("testlicensekey")) {
+		t.Errorf("geoipupdate-conf.txt contains the license key:\n%s", b)
+	}
+	for _, want := range []string{
+		"# " + path + "\n",
+		"LicenseKey <redacted>\n",
+		"GEOIPUPDATE_LICENSE_KEY=<redacted>\n",
+		"GEOIPUPDATE_VERBOSE=1",
+	} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Errorf("geoipupdate-conf.txt does not contain %q:\n%s", want, b)
+		}
+	}
+	confs, ok := a.results["geoipupdate-conf"].([]*geoIPConf)
+	if !ok || len(confs) != 1 || confs[0].Path != path || confs[0].AccountID != "42" {
+		t.Errorf("results = %#v", a.results["geoipupdate-conf"])
+	}
+	if got := configuredEdition(); got != "GeoIP2-City" {
+		t.Errorf("configuredEdition = %q", got)
+	}
+}
+
+func TestGeoIPConfFindings(t *testing.T) {
+	confs := []*geoIPConf{
+		{Path: "/etc/GeoIP.conf", HasLicenseKey: true},
+		{Path: "/usr/local/etc/GeoIP.conf", HasLicenseKey: true, PlaceholderKey: true},
+	}
+	fs := findingsFor(map[string]interface{}{"geoipupdate-conf": confs})
+	if len(fs) != 1 || fs[0].Check != "geoipupdate-placeholder-key" ||
+		!strings.HasPrefix(fs[0].Summary, "/usr/local/etc/GeoIP.conf ") {
+		t.Errorf("findings = %+v", fs)
+	}
+}
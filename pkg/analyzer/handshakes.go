@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// handshakeVersions are the TLS versions each endpoint is tested with.
+var handshakeVersions = []uint16{tls.VersionTLS12, tls.VersionTLS13}
+
+// tlsHandshake is the result of connecting to a host with a single TLS
+// version. The TCP connect and TLS handshake are timed separately so that
+// a slow TLS handshake may be told apart from a slow network.
+type tlsHandshake struct {
+	Host        string        `json:"host"`
+	Version     string        `json:"version"`
+	Address     string        `json:"address,omitempty"`
+	TCP         endpointCheck `json:"tcp_443"`
+	TLS         endpointCheck `json:"tls"`
+	CipherSuite string        `json:"cipher_suite,omitempty"`
+	ALPN        string        `json:"alpn,omitempty"`
+}
+
+// addTLSHandshakes times a TLS 1.2 and a TLS 1.3 handshake with each
+// MaxMind endpoint and writes the results to tls-handshakes.json.
+func (a *analyzer) addTLSHandshakes(ctx context.Context) {
+	results := make([][]*tlsHandshake, len(maxmindEndpoints))
+	var wg sync.WaitGroup
+	for i, host := range maxmindEndpoints {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			// The versions are tested one after the other so that they
+			// do not compete with each other.
+			for _, version := range handshakeVersions {
+				results[i] = append(results[i], timeTLSHandshake(ctx, host, version))
+			}
+		}(i, host)
+	}
+	wg.Wait()
+
+	var handshakes []*tlsHandshake
+	for _, r := range results {
+		handshakes = append(handshakes, r...)
+	}
+
+	b, err := json.MarshalIndent(handshakes, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding tls-handshakes.json"))
+		return
+	}
+	a.storeFile("tls-handshakes.json", b)
+	a.storeResult("tls-handshakes", handshakes)
+}
+
+func timeTLSHandshake(ctx context.Context, host string, version uint16) *tlsHandshake {
+	return timeTLSHandshakeTo(ctx, host, net.JoinHostPort(host, "443"), version, nil)
+}
+
+// timeTLSHandshakeTo is timeTLSHandshake connecting to addr and verifying
+// the certificate with rootCAs, or the system roots if it is nil.
+func timeTLSHandshakeTo(ctx context.Context, host, addr string, version uint16, rootCAs *x509.CertPool) *tlsHandshake {
+	dial := dialConfigFromContext(ctx)
+	h := &tlsHandshake{Host: host, Version: tlsVersionName(version)}
+
+	ctx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+
+	start := time.Now()
+	dialer := dial.newDialer("tcp")
+	dialer.Timeout = endpointTimeout
+	conn, err := dialer.DialContext(ctx, dial.restrictNetwork("tcp"), addr)
+	h.TCP = newEndpointCheck(start, err)
+	if err != nil {
+		return h
+	}
+	h.Address = conn.RemoteAddr().String()
+
+	start = time.Now()
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName: host,
+		RootCAs:    rootCAs,
+		MinVersion: version,
+		MaxVersion: version,
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+	err = tlsConn.HandshakeContext(ctx)
+	h.TLS = newEndpointCheck(start, err)
+	_ = tlsConn.Close()
+	if err != nil {
+		return h
+	}
+
+	state := tlsConn.ConnectionState()
+	h.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	h.ALPN = state.NegotiatedProtocol
+	return h
+}
@@ -0,0 +1,87 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testCertificate returns a certificate for 127.0.0.1 and a pool that
+// trusts it.
+func testCertificate(t *testing.T) (*tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	server := httptest.NewTLSServer(nil)
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	return &server.TLS.Certificates[0], pool
+}
+
+func TestTimeTLSHandshake(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	_, roots := testCertificate(t)
+	addr := server.Listener.Addr().String()
+
+	for _, version := range handshakeVersions {
+		h := timeTLSHandshakeTo(context.Background(), "example.com", addr, version, roots)
+		if !h.TCP.OK || !h.TLS.OK || h.Address != addr || h.ALPN != "h2" || h.CipherSuite == "" {
+			t.Errorf("%s handshake = %+v", tlsVersionName(version), h)
+		}
+		if h.Version != tlsVersionName(version) {
+			t.Errorf("version = %s", h.Version)
+		}
+	}
+
+	// The certificate is not valid for the system roots.
+	h := timeTLSHandshakeTo(context.Background(), "example.com", addr, tls.VersionTLS13, nil)
+	if !h.TCP.OK || h.TLS.OK || h.TLS.Error == "" || h.CipherSuite != "" {
+		t.Errorf("untrusted handshake = %+v", h)
+	}
+}
+
+func TestTimeTLSHandshakeConnectError(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	addr := server.Listener.Addr().String()
+	server.Close()
+
+	h := timeTLSHandshakeTo(context.Background(), "example.com", addr, tls.VersionTLS12, nil)
+	if h.TCP.OK || h.TCP.Error == "" || h.TLS != (endpointCheck{}) {
+		t.Errorf("handshake = %+v", h)
+	}
+}
+
+func TestTLSHandshakeFindings(t *testing.T) {
+	ok := endpointCheck{OK: true}
+	failed := endpointCheck{Error: "protocol version not supported"}
+	tests := []struct {
+		handshakes []*tlsHandshake
+		want       string
+	}{
+		{[]*tlsHandshake{
+			{Host: "geoip.maxmind.com", Version: "TLS 1.2", TCP: ok, TLS: ok},
+			{Host: "geoip.maxmind.com", Version: "TLS 1.3", TCP: ok, TLS: failed},
+		}, "the TLS 1.3 handshake with geoip.maxmind.com failed even though other versions succeeded"},
+		// When every version fails, the problem is not the version.
+		{[]*tlsHandshake{
+			{Host: "geoip.maxmind.com", Version: "TLS 1.2", TCP: ok, TLS: failed},
+			{Host: "geoip.maxmind.com", Version: "TLS 1.3", TCP: ok, TLS: failed},
+		}, ""},
+	}
+	for _, test := range tests {
+		fs := findingsFor(map[string]interface{}{"tls-handshakes": test.handshakes})
+		var got string
+		if len(fs) > 0 {
+			got = fs[0].Summary
+		}
+		if len(fs) > 1 || !strings.HasPrefix(got, test.want) || (test.want == "") != (got == "") {
+			t.Errorf("findings = %v, want %q", findingChecks(fs), test.want)
+		}
+	}
+}
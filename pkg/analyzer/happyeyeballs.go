@@ -0,0 +1,136 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// happyEyeballsFallbackDelay is how long the dual-stack dial waits for the
+// preferred family before also trying the other one. It is Go's default
+// and the delay RFC 8305 recommends.
+const happyEyeballsFallbackDelay = 300 * time.Millisecond
+
+// familyConnect is the result of connecting to the first address of one
+// family.
+type familyConnect struct {
+	Address   string  `json:"address,omitempty"`
+	ConnectMS float64 `json:"connect_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// happyEyeballsReport shows which family is preferred for a dual-stack host
+// and what that costs. A client without Happy Eyeballs that prefers a
+// broken family hangs until its connect timeout.
+type happyEyeballsReport struct {
+	Host string `json:"host"`
+	// Addresses are in the order the resolver returned them, which is the
+	// order clients try them in. Preferred is the family of the first.
+	Addresses []string       `json:"addresses,omitempty"`
+	Preferred string         `json:"preferred,omitempty"`
+	IPv4      *familyConnect `json:"ipv4"`
+	IPv6      *familyConnect `json:"ipv6"`
+	// DualStack is the result of a Happy Eyeballs dial, and Used the
+	// family it connected with.
+	DualStack       *familyConnect `json:"dual_stack"`
+	Used            string         `json:"used,omitempty"`
+	FallbackDelayMS float64        `json:"fallback_delay_ms"`
+	Error           string         `json:"error,omitempty"`
+}
+
+func (a *analyzer) createHappyEyeballsTask(f, host string) *task {
+	return newTask(f, func(ctx context.Context) {
+		r := happyEyeballs(ctx, host)
+		if r.Error != "" {
+			a.storeError(ctx, errors.Errorf("error getting data for %s: %s", f, r.Error))
+		}
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", f))
+			return
+		}
+		a.storeFile(f, b)
+		a.storeResult(taskName(f), r)
+	}).withTags(tagRouting).
+		withDescription("Compares IPv4, IPv6, and Happy Eyeballs connection times to %s", host)
+}
+
+func happyEyeballs(ctx context.Context, host string) *happyEyeballsReport {
+	dial := dialConfigFromContext(ctx)
+	r := &happyEyeballsReport{Host: host, FallbackDelayMS: durationMS(happyEyeballsFallbackDelay)}
+
+	ctx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	var first4, first6 net.IP
+	for _, addr := range addrs {
+		r.Addresses = append(r.Addresses, addr.IP.String())
+		if addr.IP.To4() != nil && first4 == nil {
+			first4 = addr.IP
+		} else if addr.IP.To4() == nil && first6 == nil {
+			first6 = addr.IP
+		}
+	}
+	r.Preferred = familyName(ipNetwork(addrs[0].IP))
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		r.IPv4 = connectFamily(ctx, "tcp4", first4)
+	}()
+	go func() {
+		defer wg.Done()
+		r.IPv6 = connectFamily(ctx, "tcp6", first6)
+	}()
+	go func() {
+		defer wg.Done()
+		dialer := dial.newDialer("tcp")
+		dialer.FallbackDelay = happyEyeballsFallbackDelay
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, dial.restrictNetwork("tcp"), net.JoinHostPort(host, "443"))
+		r.DualStack = &familyConnect{ConnectMS: durationMS(time.Since(start)), Error: errorString(err)}
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		remote := conn.RemoteAddr().(*net.TCPAddr)
+		r.DualStack.Address = remote.IP.String()
+		r.Used = familyName(ipNetwork(remote.IP))
+	}()
+	wg.Wait()
+	return r
+}
+
+// connectFamily connects to port 443 on ip. It returns nil if ip is nil,
+// i.e., the host has no address of that family.
+func connectFamily(ctx context.Context, network string, ip net.IP) *familyConnect {
+	if ip == nil {
+		return nil
+	}
+	dialer := dialConfigFromContext(ctx).newDialer("tcp")
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), "443"))
+	c := &familyConnect{Address: ip.String(), ConnectMS: durationMS(time.Since(start)), Error: errorString(err)}
+	if err == nil {
+		_ = conn.Close()
+	}
+	return c
+}
+
+// ipNetwork returns "ip4" or "ip6" for ip.
+func ipNetwork(ip net.IP) string {
+	if ip.To4() != nil {
+		return "ip4"
+	}
+	return "ip6"
+}
@@ -0,0 +1,70 @@
+package analyzer
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestHappyEyeballs(t *testing.T) {
+	r := happyEyeballs(context.Background(), "localhost")
+	if r.Error != "" {
+		t.Fatal(r.Error)
+	}
+	if !slices.Contains(r.Addresses, "127.0.0.1") || r.Preferred == "" || r.FallbackDelayMS != 300 {
+		t.Errorf("report = %+v", r)
+	}
+	if r.IPv4 == nil || r.IPv4.Address != "127.0.0.1" {
+		t.Errorf("IPv4 = %+v", r.IPv4)
+	}
+	if r.DualStack == nil || (r.DualStack.Error == "") != (r.Used != "") {
+		t.Errorf("dual stack = %+v, used %q", r.DualStack, r.Used)
+	}
+
+	// .invalid names never resolve (RFC 6761).
+	r = happyEyeballs(context.Background(), "happy-eyeballs.invalid")
+	if r.Error == "" || r.IPv4 != nil || r.IPv6 != nil || r.DualStack != nil {
+		t.Errorf("report = %+v", r)
+	}
+}
+
+func TestConnectFamily(t *testing.T) {
+	if c := connectFamily(context.Background(), "tcp6", nil); c != nil {
+		t.Errorf("connecting without an address = %+v", c)
+	}
+}
+
+func TestIPNetwork(t *testing.T) {
+	for ip, want := range map[string]string{
+		"192.0.2.1":        "ip4",
+		"::ffff:192.0.2.1": "ip4",
+		"2001:db8::1":      "ip6",
+	} {
+		if got := ipNetwork(net.ParseIP(ip)); got != want {
+			t.Errorf("ipNetwork(%s) = %s, want %s", ip, got, want)
+		}
+	}
+}
+
+func TestHappyEyeballsFindings(t *testing.T) {
+	broken := &happyEyeballsReport{
+		Host:      "geoip.maxmind.com",
+		Preferred: "IPv6",
+		IPv4:      &familyConnect{Address: "104.18.0.5"},
+		IPv6:      &familyConnect{Address: "2606:4700::6812:5", Error: "i/o timeout"},
+	}
+	fs := findingsFor(map[string]interface{}{"geoip.maxmind.com-happy-eyeballs": broken})
+	want := "IPv6 is preferred for geoip.maxmind.com but connecting over it failed (i/o timeout)"
+	if len(fs) != 1 || fs[0].Check != "ipv6-preferred-broken" || !strings.HasPrefix(fs[0].Summary, want) {
+		t.Errorf("findings = %+v", fs)
+	}
+
+	// Without IPv4 to fall back to, the failure is not about the
+	// preference.
+	broken.IPv4.Error = "i/o timeout"
+	if fs := findingsFor(map[string]interface{}{"geoip.maxmind.com-happy-eyeballs": broken}); len(fs) != 0 {
+		t.Errorf("findings = %+v", fs)
+	}
+}
@@ -0,0 +1,82 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const nsswitchConfPath = "/etc/nsswitch.conf"
+
+// hostsOverride is an entry in the hosts file for one of the target hosts.
+// It takes precedence over DNS, so the host may resolve correctly with dig
+// and still be reached at the wrong address.
+type hostsOverride struct {
+	Host    string `json:"host"`
+	Address string `json:"address"`
+	Line    int    `json:"line"`
+}
+
+type hostsReport struct {
+	Path      string           `json:"path"`
+	Overrides []*hostsOverride `json:"overrides,omitempty"`
+}
+
+func (a *analyzer) addHostsFile(ctx context.Context) {
+	path := hostsFilePath()
+	contents, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error reading the hosts file"))
+		return
+	}
+	a.storeFile("hosts", contents)
+
+	r := &hostsReport{Path: path, Overrides: findHostsOverrides(contents, a.targetHosts())}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding hosts.json"))
+		return
+	}
+	a.storeFile("hosts.json", b)
+	a.storeResult("hosts", r)
+}
+
+// findHostsOverrides returns the entries in the hosts file contents for any
+// of hosts.
+func findHostsOverrides(contents []byte, hosts []string) []*hostsOverride {
+	var overrides []*hostsOverride
+	n := 0
+	for line := range strings.Lines(string(contents)) {
+		n++
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		for _, name := range fields[1:] {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			if slices.Contains(hosts, name) {
+				overrides = append(overrides, &hostsOverride{Host: name, Address: fields[0], Line: n})
+			}
+		}
+	}
+	return overrides
+}
+
+// addNSSwitchConf stores nsswitch.conf, which determines whether the hosts
+// file or DNS is used first. It only exists on some platforms.
+func (a *analyzer) addNSSwitchConf(ctx context.Context) {
+	contents, err := os.ReadFile(nsswitchConfPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error reading nsswitch.conf"))
+		return
+	}
+	a.storeFile("nsswitch.conf", contents)
+}
@@ -0,0 +1,49 @@
+package analyzer
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestFindHostsOverrides(t *testing.T) {
+	contents := `127.0.0.1	localhost
+# 192.0.2.1 geoip.maxmind.com
+192.0.2.2	updates.maxmind.com. mirror.example.com # pinned
+::1 localhost ip6-localhost
+198.51.100.3 Example.COM
+192.0.2.4
+`
+	got := findHostsOverrides([]byte(contents), []string{"geoip.maxmind.com", "updates.maxmind.com", "example.com"})
+	want := []*hostsOverride{
+		{Host: "updates.maxmind.com", Address: "192.0.2.2", Line: 3},
+		{Host: "example.com", Address: "198.51.100.3", Line: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("overrides = %+v, want %+v", got, want)
+	}
+}
+
+func TestAddHostsFile(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.addHostsFile(context.Background())
+	if a.hasErrors() {
+		t.Fatalf("errors: %v", a.errors)
+	}
+	storedContents(t, a, "hosts")
+	if r, ok := a.results["hosts"].(*hostsReport); !ok || r.Path != hostsFilePath() {
+		t.Errorf("result = %+v", a.results["hosts"])
+	}
+}
+
+func TestHostsFindings(t *testing.T) {
+	fs := findingsFor(map[string]interface{}{"hosts": &hostsReport{
+		Path:      "/etc/hosts",
+		Overrides: []*hostsOverride{{Host: "geoip.maxmind.com", Address: "192.0.2.1", Line: 7}},
+	}})
+	want := "geoip.maxmind.com is set to 192.0.2.1 on line 7 of /etc/hosts, which takes precedence over DNS"
+	if len(fs) != 1 || fs[0].Check != "hosts-override" || fs[0].Summary != want {
+		t.Errorf("findings = %+v", fs)
+	}
+}
@@ -0,0 +1,204 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// httpTraceResult holds what we learned while making a single HTTP request.
+// The zero time is used for phases that did not happen, e.g., DNS lookup
+// when connecting to an IP address or the TLS handshake for plain HTTP.
+type httpTraceResult struct {
+	url     string
+	network string
+
+	remoteAddr string
+	proto      string
+	status     string
+	statusCode int
+	header     http.Header
+	body       []byte
+	tlsState   *tls.ConnectionState
+
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+	done         time.Time
+}
+
+func (a *analyzer) createHTTPTraceTask(f, network, url string) *task {
+	return newTask(f, func(ctx context.Context) {
+		var result *httpTraceResult
+		err := a.retry(ctx, "GET "+url, func() error {
+			var err error
+			result, err = traceHTTP(ctx, network, url)
+			return err
+		})
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+		}
+		a.storeFile(f, result.format())
+		a.storeResult(taskName(f), result.report(err))
+	}).withTags(tagHTTP).
+		withDescription("Requests %s over %s, recording the timing of each phase", url, familyName(network))
+}
+
+// traceHTTP makes a GET request to url over network ("tcp4" or "tcp6") and
+// records the timing of each phase of the request. The returned result is
+// never nil so that partial timings are available when the request fails.
+func traceHTTP(ctx context.Context, network, url string) (*httpTraceResult, error) {
+	r := &httpTraceResult{
+		url:     url,
+		network: network,
+	}
+
+	dialer := dialConfigFromContext(ctx).newDialer(network)
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			DisableKeepAlives: true,
+		},
+		// Like curl without -L, we want to see the redirect itself.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart:     func(httptrace.DNSStartInfo) { r.dnsStart = time.Now() },
+		DNSDone:      func(httptrace.DNSDoneInfo) { r.dnsDone = time.Now() },
+		ConnectStart: func(string, string) { r.connectStart = time.Now() },
+		ConnectDone: func(_, addr string, _ error) {
+			r.connectDone = time.Now()
+			r.remoteAddr = addr
+		},
+		TLSHandshakeStart:    func() { r.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { r.tlsDone = time.Now() },
+		GotFirstResponseByte: func() { r.firstByte = time.Now() },
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return r, errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("User-Agent", os.Args[0])
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	r.start = time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		r.done = time.Now()
+		return r, errors.Wrap(err, "error making request")
+	}
+	defer resp.Body.Close()
+
+	r.proto = resp.Proto
+	r.status = resp.Status
+	r.statusCode = resp.StatusCode
+	r.header = resp.Header
+	r.tlsState = resp.TLS
+
+	r.body, err = io.ReadAll(resp.Body)
+	r.done = time.Now()
+	if err != nil {
+		return r, errors.Wrap(err, "error reading response body")
+	}
+	return r, nil
+}
+
+func (r *httpTraceResult) dnsDuration() time.Duration {
+	return phaseDuration(r.dnsStart, r.dnsDone)
+}
+
+func (r *httpTraceResult) connectDuration() time.Duration {
+	return phaseDuration(r.connectStart, r.connectDone)
+}
+
+func (r *httpTraceResult) tlsDuration() time.Duration {
+	return phaseDuration(r.tlsStart, r.tlsDone)
+}
+
+func (r *httpTraceResult) ttfbDuration() time.Duration {
+	return phaseDuration(r.start, r.firstByte)
+}
+
+func (r *httpTraceResult) totalDuration() time.Duration {
+	return phaseDuration(r.start, r.done)
+}
+
+// phaseDuration returns the duration between start and end or zero if the
+// phase did not complete.
+func phaseDuration(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// format renders the result in a stable, human-readable layout.
+func (r *httpTraceResult) format() []byte {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "URL:             %s\n", r.url)
+	fmt.Fprintf(buf, "Network:         %s\n", r.network)
+	fmt.Fprintf(buf, "Start:           %s\n", r.start.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(buf, "Remote address:  %s\n", r.remoteAddr)
+	fmt.Fprintf(buf, "Protocol:        %s\n", r.proto)
+	fmt.Fprintf(buf, "Status:          %s\n", r.status)
+	if r.tlsState != nil {
+		fmt.Fprintf(buf, "TLS version:     %s\n", tlsVersionName(r.tlsState.Version))
+		fmt.Fprintf(buf, "TLS cipher:      %s\n", tls.CipherSuiteName(r.tlsState.CipherSuite))
+	}
+
+	fmt.Fprintf(buf, "\nTimings:\n")
+	fmt.Fprintf(buf, "  DNS lookup:         %s\n", r.dnsDuration())
+	fmt.Fprintf(buf, "  TCP connect:        %s\n", r.connectDuration())
+	fmt.Fprintf(buf, "  TLS handshake:      %s\n", r.tlsDuration())
+	fmt.Fprintf(buf, "  Time to first byte: %s\n", r.ttfbDuration())
+	fmt.Fprintf(buf, "  Total:              %s\n", r.totalDuration())
+
+	if r.header != nil {
+		fmt.Fprintf(buf, "\nResponse headers:\n")
+		_ = r.header.Write(buf)
+	}
+
+	if r.body != nil {
+		fmt.Fprintf(buf, "\nResponse body:\n")
+		buf.Write(r.body)
+	}
+
+	return buf.Bytes()
+}
+
+func tlsVersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return fmt.Sprintf("0x%04x", v)
+	}
+}
@@ -0,0 +1,291 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// http2ProbeResult holds what we learned while making a single HTTP/2
+// request. The request is made frame by frame rather than with net/http so
+// that the server's settings and each frame it sends are visible.
+type http2ProbeResult struct {
+	host string
+
+	remoteAddr string
+	tlsVersion uint16
+	alpn       string
+	settings   []http2.Setting
+	frames     []string
+	status     string
+	header     http.Header
+	bodySize   int
+
+	start        time.Time
+	connectDone  time.Time
+	tlsDone      time.Time
+	settingsDone time.Time
+	firstByte    time.Time
+	done         time.Time
+}
+
+// http2Report is the parsed result of an HTTP/2 probe. Settings and TTFB
+// are measured from the start of the probe, like TTFB in httpReport.
+type http2Report struct {
+	Host       string            `json:"host"`
+	RemoteAddr string            `json:"remote_address,omitempty"`
+	TLSVersion string            `json:"tls_version,omitempty"`
+	ALPN       string            `json:"alpn,omitempty"`
+	Settings   map[string]uint32 `json:"settings,omitempty"`
+	StatusCode int               `json:"status_code,omitempty"`
+	Frames     []string          `json:"frames,omitempty"`
+	Timings    struct {
+		Connect  float64 `json:"connect"`
+		TLS      float64 `json:"tls"`
+		Settings float64 `json:"settings"`
+		TTFB     float64 `json:"ttfb"`
+		Total    float64 `json:"total"`
+	} `json:"timings_ms"`
+	Error string `json:"error,omitempty"`
+}
+
+func (a *analyzer) createHTTP2Task(f, host string) *task {
+	return newTask(f, func(ctx context.Context) {
+		var result *http2ProbeResult
+		err := a.retry(ctx, "HTTP/2 GET https://"+host+"/", func() error {
+			var err error
+			result, err = probeHTTP2(ctx, host)
+			return err
+		})
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+		}
+		a.storeFile(f, result.format())
+		a.storeResult(taskName(f), result.report(err))
+	}).withTags(tagHTTP).
+		withDescription("Requests https://%s/ over HTTP/2, recording ALPN, the server's settings, and each frame", host)
+}
+
+// probeHTTP2 connects directly to host on port 443, negotiates HTTP/2 with
+// ALPN, and makes a GET request for "/". The returned result is never nil
+// so that partial results are available when the probe fails.
+func probeHTTP2(ctx context.Context, host string) (*http2ProbeResult, error) {
+	dial := dialConfigFromContext(ctx)
+	r := &http2ProbeResult{host: host, start: time.Now()}
+
+	dialer := dial.newDialer("tcp")
+	conn, err := dialer.DialContext(ctx, dial.restrictNetwork("tcp"), net.JoinHostPort(host, "443"))
+	if err != nil {
+		r.done = time.Now()
+		return r, errors.Wrap(err, "error connecting")
+	}
+	defer conn.Close()
+	r.connectDone = time.Now()
+	r.remoteAddr = conn.RemoteAddr().String()
+
+	// The framer does not take a context, so closing the connection is
+	// what interrupts a blocked read.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName: host,
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{http2.NextProtoTLS, "http/1.1"},
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		r.done = time.Now()
+		return r, errors.Wrap(err, "error in TLS handshake")
+	}
+	r.tlsDone = time.Now()
+	state := tlsConn.ConnectionState()
+	r.tlsVersion = state.Version
+	r.alpn = state.NegotiatedProtocol
+	if r.alpn != http2.NextProtoTLS {
+		r.done = time.Now()
+		return r, errors.Errorf("the server did not negotiate HTTP/2 with ALPN (negotiated %q)", r.alpn)
+	}
+
+	err = r.exchange(tlsConn)
+	r.done = time.Now()
+	if err != nil && ctx.Err() != nil {
+		return r, ctx.Err()
+	}
+	return r, err
+}
+
+func (r *http2ProbeResult) exchange(conn io.ReadWriter) error {
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		return errors.Wrap(err, "error writing the client preface")
+	}
+	fr := http2.NewFramer(conn, conn)
+	fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := fr.WriteSettings(); err != nil {
+		return errors.Wrap(err, "error writing settings")
+	}
+
+	headers := new(bytes.Buffer)
+	enc := hpack.NewEncoder(headers)
+	for _, f := range []hpack.HeaderField{
+		{Name: ":method", Value: http.MethodGet},
+		{Name: ":scheme", Value: "https"},
+		{Name: ":authority", Value: r.host},
+		{Name: ":path", Value: "/"},
+		{Name: "user-agent", Value: os.Args[0]},
+	} {
+		_ = enc.WriteField(f)
+	}
+	err := fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: headers.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	if err != nil {
+		return errors.Wrap(err, "error writing the request headers")
+	}
+
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return errors.Wrap(err, "error reading frame")
+		}
+		r.frames = append(r.frames, fmt.Sprintf("%-12s %s", time.Since(r.start).Round(time.Microsecond), f.Header()))
+
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() {
+				continue
+			}
+			if r.settingsDone.IsZero() {
+				r.settingsDone = time.Now()
+				_ = f.ForeachSetting(func(s http2.Setting) error {
+					r.settings = append(r.settings, s)
+					return nil
+				})
+			}
+			if err := fr.WriteSettingsAck(); err != nil {
+				return errors.Wrap(err, "error acknowledging settings")
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				if err := fr.WritePing(true, f.Data); err != nil {
+					return errors.Wrap(err, "error answering ping")
+				}
+			}
+		case *http2.GoAwayFrame:
+			return errors.Errorf("the server sent GOAWAY with %s", f.ErrCode)
+		case *http2.RSTStreamFrame:
+			return errors.Errorf("the server reset the stream with %s", f.ErrCode)
+		case *http2.MetaHeadersFrame:
+			if r.firstByte.IsZero() {
+				r.firstByte = time.Now()
+			}
+			if r.header == nil {
+				r.status = f.PseudoValue("status")
+				r.header = http.Header{}
+				for _, hf := range f.RegularFields() {
+					r.header.Add(hf.Name, hf.Value)
+				}
+			}
+			if f.StreamEnded() {
+				return nil
+			}
+		case *http2.DataFrame:
+			if r.firstByte.IsZero() {
+				r.firstByte = time.Now()
+			}
+			n := len(f.Data())
+			r.bodySize += n
+			if f.StreamEnded() {
+				return nil
+			}
+			// Return the flow control window so that a large body does
+			// not stall the stream.
+			if n > 0 {
+				_ = fr.WriteWindowUpdate(0, uint32(n))
+				_ = fr.WriteWindowUpdate(f.StreamID, uint32(n))
+			}
+		}
+	}
+}
+
+func (r *http2ProbeResult) report(err error) *http2Report {
+	hr := &http2Report{
+		Host:       r.host,
+		RemoteAddr: r.remoteAddr,
+		ALPN:       r.alpn,
+		Frames:     r.frames,
+		Error:      errorString(err),
+	}
+	if r.tlsVersion != 0 {
+		hr.TLSVersion = tlsVersionName(r.tlsVersion)
+	}
+	if len(r.settings) > 0 {
+		hr.Settings = map[string]uint32{}
+		for _, s := range r.settings {
+			hr.Settings[s.ID.String()] = s.Val
+		}
+	}
+	hr.StatusCode, _ = strconv.Atoi(r.status)
+	hr.Timings.Connect = durationMS(phaseDuration(r.start, r.connectDone))
+	hr.Timings.TLS = durationMS(phaseDuration(r.connectDone, r.tlsDone))
+	hr.Timings.Settings = durationMS(phaseDuration(r.start, r.settingsDone))
+	hr.Timings.TTFB = durationMS(phaseDuration(r.start, r.firstByte))
+	hr.Timings.Total = durationMS(phaseDuration(r.start, r.done))
+	return hr
+}
+
+// format renders the result in a stable, human-readable layout.
+func (r *http2ProbeResult) format() []byte {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintf(buf, "URL:             https://%s/\n", r.host)
+	fmt.Fprintf(buf, "Start:           %s\n", r.start.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(buf, "Remote address:  %s\n", r.remoteAddr)
+	if r.tlsVersion != 0 {
+		fmt.Fprintf(buf, "TLS version:     %s\n", tlsVersionName(r.tlsVersion))
+	}
+	fmt.Fprintf(buf, "ALPN:            %q\n", r.alpn)
+	fmt.Fprintf(buf, "Status:          %s\n", r.status)
+	fmt.Fprintf(buf, "Body size:       %d\n", r.bodySize)
+
+	fmt.Fprintf(buf, "\nTimings:\n")
+	fmt.Fprintf(buf, "  TCP connect:        %s\n", phaseDuration(r.start, r.connectDone))
+	fmt.Fprintf(buf, "  TLS handshake:      %s\n", phaseDuration(r.connectDone, r.tlsDone))
+	fmt.Fprintf(buf, "  Server settings:    %s\n", phaseDuration(r.start, r.settingsDone))
+	fmt.Fprintf(buf, "  Time to first byte: %s\n", phaseDuration(r.start, r.firstByte))
+	fmt.Fprintf(buf, "  Total:              %s\n", phaseDuration(r.start, r.done))
+
+	if len(r.settings) > 0 {
+		fmt.Fprintf(buf, "\nServer settings:\n")
+		for _, s := range r.settings {
+			fmt.Fprintf(buf, "  %s = %d\n", s.ID, s.Val)
+		}
+	}
+
+	if len(r.frames) > 0 {
+		fmt.Fprintf(buf, "\nFrames received:\n")
+		for _, f := range r.frames {
+			fmt.Fprintf(buf, "  %s\n", f)
+		}
+	}
+
+	if r.header != nil {
+		fmt.Fprintf(buf, "\nResponse headers:\n")
+		_ = r.header.Write(buf)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,96 @@
+package analyzer
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// exchangeHTTP2 makes the probe's request to an HTTP/2 server with
+// handler.
+func exchangeHTTP2(t *testing.T, handler http.HandlerFunc) (*http2ProbeResult, error) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	conn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true, // nolint: gosec
+		NextProtos:         []string{http2.NextProtoTLS},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if p := conn.ConnectionState().NegotiatedProtocol; p != http2.NextProtoTLS {
+		t.Fatalf("negotiated %q", p)
+	}
+
+	r := &http2ProbeResult{host: "example.com", start: time.Now()}
+	err = r.exchange(conn)
+	r.done = time.Now()
+	return r, err
+}
+
+func TestHTTP2Exchange(t *testing.T) {
+	// The body is larger than the initial flow control window.
+	body := strings.Repeat("x", 100000)
+	r, err := exchangeHTTP2(t, func(w http.ResponseWriter, req *http.Request) {
+		if req.Host != "example.com" || req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("X-Test", "yes")
+		_, _ = w.Write([]byte(body))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.status != "200" || r.bodySize != len(body) || r.header.Get("X-Test") != "yes" {
+		t.Errorf("status %s, body size %d, header %v", r.status, r.bodySize, r.header)
+	}
+	if len(r.settings) == 0 || r.settingsDone.IsZero() || r.firstByte.IsZero() || len(r.frames) < 3 {
+		t.Errorf("result = %+v", r)
+	}
+
+	r.tlsVersion = tls.VersionTLS13
+	hr := r.report(nil)
+	if hr.StatusCode != 200 || hr.TLSVersion != "TLS 1.3" || hr.Settings["MAX_CONCURRENT_STREAMS"] == 0 {
+		t.Errorf("report = %+v", hr)
+	}
+	if hr.Timings.TTFB <= 0 || hr.Timings.Total < hr.Timings.TTFB {
+		t.Errorf("timings = %+v", hr.Timings)
+	}
+	out := string(r.format())
+	for _, want := range []string{"URL:             https://example.com/\n", "Status:          200\n", "X-Test: yes"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHTTP2ExchangeReset(t *testing.T) {
+	_, err := exchangeHTTP2(t, func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	if err == nil || !strings.Contains(err.Error(), "the server reset the stream") {
+		t.Errorf("exchange = %v", err)
+	}
+}
+
+func TestHTTP2Findings(t *testing.T) {
+	fs := findingsFor(map[string]interface{}{
+		"geoip.maxmind.com-http2":   &http2Report{Host: "geoip.maxmind.com", TLSVersion: "TLS 1.3", Error: "GOAWAY"},
+		"updates.maxmind.com-http2": &http2Report{Host: "updates.maxmind.com", Error: "handshake failure"},
+	})
+	// The failed TLS handshake is reported by the other checks.
+	if len(fs) != 1 || fs[0].Check != "http2-failure" || fs[0].Summary != "HTTP/2 to geoip.maxmind.com failed: GOAWAY" {
+		t.Errorf("findings = %v", findingChecks(fs))
+	}
+}
@@ -0,0 +1,102 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.Header().Set("X-Test", "yes")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	r, err := traceHTTP(context.Background(), "tcp4", server.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.statusCode != http.StatusOK || string(r.body) != "hello" || r.header.Get("X-Test") != "yes" {
+		t.Errorf("got status %d, body %q, and header %v", r.statusCode, r.body, r.header)
+	}
+	if r.remoteAddr != server.Listener.Addr().String() {
+		t.Errorf("remote address = %q", r.remoteAddr)
+	}
+	if r.connectDuration() <= 0 || r.ttfbDuration() <= 0 || r.totalDuration() < r.ttfbDuration() {
+		t.Errorf(
+			"timings: connect %s, first byte %s, total %s",
+			r.connectDuration(), r.ttfbDuration(), r.totalDuration(),
+		)
+	}
+	// Connecting to an IP address without TLS has neither phase.
+	if r.dnsDuration() != 0 || r.tlsDuration() != 0 {
+		t.Errorf("timings: DNS %s, TLS %s", r.dnsDuration(), r.tlsDuration())
+	}
+
+	out := string(r.format())
+	for _, want := range []string{"URL:             " + server.URL, "Status:          200 OK", "X-Test: yes", "hello"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the output does not contain %q:\n%s", want, out)
+		}
+	}
+
+	// Redirects are recorded rather than followed.
+	r, err = traceHTTP(context.Background(), "tcp4", server.URL+"/redirect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.statusCode != http.StatusFound || r.header.Get("Location") != "/" {
+		t.Errorf("got status %d and location %q", r.statusCode, r.header.Get("Location"))
+	}
+}
+
+func TestTraceHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	r, err := traceHTTP(context.Background(), "tcp4", url)
+	if err == nil {
+		t.Fatal("the request to a closed server succeeded")
+	}
+	if r == nil || r.done.IsZero() {
+		t.Fatal("a failed request returned no result")
+	}
+	if out := string(r.format()); !strings.Contains(out, "URL:             "+url) {
+		t.Errorf("the partial result lacks the URL:\n%s", out)
+	}
+}
+
+func TestPhaseDuration(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := phaseDuration(start, start.Add(time.Second)); got != time.Second {
+		t.Errorf("phaseDuration = %s", got)
+	}
+	if got := phaseDuration(start, time.Time{}); got != 0 {
+		t.Errorf("an unfinished phase lasted %s", got)
+	}
+	if got := phaseDuration(time.Time{}, start); got != 0 {
+		t.Errorf("an unstarted phase lasted %s", got)
+	}
+}
+
+func TestTLSVersionName(t *testing.T) {
+	for v, want := range map[uint16]string{
+		tls.VersionTLS12: "TLS 1.2",
+		tls.VersionTLS13: "TLS 1.3",
+		0x0300:           "0x0300",
+	} {
+		if got := tlsVersionName(v); got != want {
+			t.Errorf("tlsVersionName(%#x) = %q, want %q", v, got, want)
+		}
+	}
+}
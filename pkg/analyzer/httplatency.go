@@ -0,0 +1,92 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// defaultHTTPSamples is the number of requests the HTTPS latency task
+// makes unless --http-samples is given.
+const defaultHTTPSamples = 20
+
+// httpLatencySample is the outcome of one request of the HTTPS latency
+// task.
+type httpLatencySample struct {
+	StatusCode int           `json:"status_code,omitempty"`
+	RemoteAddr string        `json:"remote_addr,omitempty"`
+	TimingsMS  httpTimingsMS `json:"timings_ms"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// httpLatencyReport is the distribution of each phase of a series of
+// requests. A single request says little about a path whose latency
+// varies, and the tail is what makes clients time out.
+type httpLatencyReport struct {
+	URL     string               `json:"url"`
+	Samples []*httpLatencySample `json:"samples"`
+	Failed  int                  `json:"failed"`
+	// The distributions are of the requests that succeeded.
+	DNS     *distribution `json:"dns,omitempty"`
+	Connect *distribution `json:"connect,omitempty"`
+	TLS     *distribution `json:"tls,omitempty"`
+	TTFB    *distribution `json:"ttfb,omitempty"`
+	Total   *distribution `json:"total,omitempty"`
+}
+
+func (a *analyzer) createHTTPLatencyTask(f, host string) *task {
+	url := "https://" + host + "/"
+	return newTask(f, func(ctx context.Context) {
+		r := httpLatency(ctx, url, a.httpSamples)
+		if r.Failed > 0 {
+			a.storeError(ctx, errors.Errorf(
+				"error getting data for %s: %d of %d requests failed", f, r.Failed, len(r.Samples),
+			))
+		}
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", f))
+			return
+		}
+		a.storeFile(f, b)
+		a.storeResult(taskName(f), r)
+	}).withTags(tagHTTP).
+		withDescription("Requests %s %d times, recording the distribution of each phase's timing", url, a.httpSamples)
+}
+
+// httpLatency requests url count times, one after another, each over a new
+// connection so that every phase is measured. It stops early if ctx is
+// done.
+func httpLatency(ctx context.Context, url string, count int) *httpLatencyReport {
+	r := &httpLatencyReport{URL: url}
+	var dnsMS, connectMS, tlsMS, ttfbMS, totalMS []float64
+	for i := 0; i < count && ctx.Err() == nil; i++ {
+		result, err := traceHTTP(ctx, dialConfigFromContext(ctx).restrictNetwork("tcp"), url)
+		report := result.report(err)
+		r.Samples = append(r.Samples, &httpLatencySample{
+			StatusCode: report.StatusCode,
+			RemoteAddr: report.RemoteAddr,
+			TimingsMS:  report.Timings,
+			Error:      report.Error,
+		})
+		if err != nil {
+			r.Failed++
+			continue
+		}
+		// There is no lookup if host is an IP address.
+		if !result.dnsDone.IsZero() {
+			dnsMS = append(dnsMS, report.Timings.DNS)
+		}
+		connectMS = append(connectMS, report.Timings.Connect)
+		tlsMS = append(tlsMS, report.Timings.TLS)
+		ttfbMS = append(ttfbMS, report.Timings.TTFB)
+		totalMS = append(totalMS, report.Timings.Total)
+	}
+	r.DNS = newDistribution(dnsMS)
+	r.Connect = newDistribution(connectMS)
+	r.TLS = newDistribution(tlsMS)
+	r.TTFB = newDistribution(ttfbMS)
+	r.Total = newDistribution(totalMS)
+	return r
+}
@@ -0,0 +1,56 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	r := httpLatency(context.Background(), server.URL+"/", 5)
+	if len(r.Samples) != 5 || r.Failed != 0 {
+		t.Fatalf("report = %+v", r)
+	}
+	if r.Samples[0].StatusCode != http.StatusOK || r.Samples[0].RemoteAddr != server.Listener.Addr().String() {
+		t.Errorf("sample = %+v", r.Samples[0])
+	}
+	// The URL has an IP address, so nothing is looked up.
+	if r.DNS != nil {
+		t.Errorf("DNS = %+v", r.DNS)
+	}
+	for name, d := range map[string]*distribution{"connect": r.Connect, "TTFB": r.TTFB, "total": r.Total} {
+		if d == nil || d.Count != 5 || d.MinMS > d.P50MS || d.P50MS > d.MaxMS {
+			t.Errorf("%s = %+v", name, d)
+		}
+	}
+
+	url := server.URL + "/"
+	server.Close()
+	r = httpLatency(context.Background(), url, 2)
+	if len(r.Samples) != 2 || r.Failed != 2 || r.Samples[0].Error == "" || r.Total != nil {
+		t.Errorf("report for a closed server = %+v", r)
+	}
+}
+
+func TestHTTPLatencyStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if r := httpLatency(ctx, "http://127.0.0.1:1/", 20); len(r.Samples) != 0 {
+		t.Errorf("%d requests were made after the context was cancelled", len(r.Samples))
+	}
+}
+
+func TestHTTPLatencyTask(t *testing.T) {
+	a := &analyzer{httpSamples: 3}
+	task := a.createHTTPLatencyTask("example.com-https-latency.json", "example.com")
+	want := "Requests https://example.com/ 3 times, recording the distribution of each phase's timing"
+	if task.description != want {
+		t.Errorf("description = %q", task.description)
+	}
+}
@@ -0,0 +1,163 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// These are well-known public addresses that are only used to find the
+// interfaces of the default routes. Nothing is sent to them.
+const (
+	activeInterfaceIPv4 = "8.8.8.8"
+	activeInterfaceIPv6 = "2001:4860:4860::8888"
+)
+
+// createInterfacesTask returns a task that lists the network interfaces
+// and their addresses using the standard library. It is the fallback for
+// platform tools such as ip and ifconfig.
+func (a *analyzer) createInterfacesTask(f string) *task {
+	return newTask(f, func(ctx context.Context) {
+		b, err := formatInterfaces()
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+		}
+		a.storeFile(f, b)
+	}).withTags(tagLocal).
+		withDescription("Lists the network interfaces and their addresses")
+}
+
+func formatInterfaces() ([]byte, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing interfaces")
+	}
+
+	buf := new(bytes.Buffer)
+	for _, iface := range ifaces {
+		fmt.Fprintf(buf, "%d: %s: <%s> mtu %d\n", iface.Index, iface.Name, iface.Flags, iface.MTU)
+		if len(iface.HardwareAddr) > 0 {
+			fmt.Fprintf(buf, "    link %s\n", iface.HardwareAddr)
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			fmt.Fprintf(buf, "    error getting addresses: %v\n", err)
+			continue
+		}
+		for _, addr := range addrs {
+			family := "inet"
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() == nil {
+				family = "inet6"
+			}
+			fmt.Fprintf(buf, "    %s %s\n", family, addr)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// createInterfaceCommand returns a task that runs the command once for each
+// of the interfaces returned by list, with the interface name as the last
+// argument, and stores the combined output in f.
+func (a *analyzer) createInterfaceCommand(
+	f string,
+	list func() ([]net.Interface, error),
+	command string,
+	args ...string,
+) *task {
+	t := newTask(f, func(ctx context.Context) {
+		ifaces, err := list()
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+			return
+		}
+		buf := new(bytes.Buffer)
+		for _, iface := range ifaces {
+			cmdArgs := append(slices.Clone(args), iface.Name)
+			fmt.Fprintf(buf, "# %s %s\n", command, strings.Join(cmdArgs, " "))
+			output, err := commandContext(ctx, command, cmdArgs...).CombinedOutput()
+			buf.Write(output)
+			if err != nil {
+				// Virtual interfaces often do not support the command, so
+				// this is not stored as an error.
+				fmt.Fprintf(buf, "# %v\n", err)
+			}
+			fmt.Fprintln(buf)
+		}
+		a.storeFile(f, buf.Bytes())
+	})
+	t.command = append([]string{command}, args...)
+	return t.withDescription("Runs `%s <interface>`", strings.Join(t.command, " ")).
+		withTools(command)
+}
+
+// nonLoopbackInterfaces returns every interface other than loopback.
+func nonLoopbackInterfaces() ([]net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing interfaces")
+	}
+	return slices.DeleteFunc(ifaces, func(iface net.Interface) bool {
+		return iface.Flags&net.FlagLoopback != 0
+	}), nil
+}
+
+// activeInterfaces returns the interfaces that the default IPv4 and IPv6
+// routes use, which are usually the same one.
+func (d *dialConfig) activeInterfaces() ([]net.Interface, error) {
+	var ifaces []net.Interface
+	var errs []string
+	for _, dst := range []struct {
+		network string
+		ip      net.IP
+	}{{"ip4", net.ParseIP(activeInterfaceIPv4)}, {"ip6", net.ParseIP(activeInterfaceIPv6)}} {
+		iface, err := d.routeInterface(dst.network, dst.ip)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if !slices.ContainsFunc(ifaces, func(i net.Interface) bool { return i.Index == iface.Index }) {
+			ifaces = append(ifaces, *iface)
+		}
+	}
+	if len(ifaces) == 0 {
+		return nil, errors.New(strings.Join(errs, "; "))
+	}
+	return ifaces, nil
+}
+
+// routeInterface returns the interface that packets to ip leave from,
+// which is the one given with --interface if there is one. Connecting a
+// UDP socket picks the route without sending anything.
+func (d *dialConfig) routeInterface(network string, ip net.IP) (*net.Interface, error) {
+	if iface := d.sourceInterface(); iface != nil {
+		return iface, nil
+	}
+	conn, err := d.newDialer("udp").Dial("udp"+network[2:], net.JoinHostPort(ip.String(), "443"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error finding the route to %s", ip)
+	}
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	_ = conn.Close()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing interfaces")
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(local) {
+				return &iface, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("no interface has the address %s", local)
+}
@@ -0,0 +1,82 @@
+package analyzer
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestCreateInterfaceCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command is a shell script")
+	}
+	list := func() ([]net.Interface, error) {
+		return []net.Interface{{Name: "eth0"}, {Name: "eth1"}}, nil
+	}
+	a := &analyzer{}
+	defer a.removeSpool()
+	task := a.createInterfaceCommand("ethtool-s.txt", list, "sh", "-c", `echo "stats for $0"; [ "$0" = eth0 ]`)
+	if task.description != "Runs `sh -c echo \"stats for $0\"; [ \"$0\" = eth0 ] <interface>`" {
+		t.Errorf("description = %q", task.description)
+	}
+	task.run(context.Background())
+
+	// An interface that does not support the command is noted in the
+	// output rather than stored as an error.
+	if a.hasErrors() {
+		t.Errorf("errors: %v", a.errors)
+	}
+	want := `# sh -c echo "stats for $0"; [ "$0" = eth0 ] eth0
+stats for eth0
+
+# sh -c echo "stats for $0"; [ "$0" = eth0 ] eth1
+stats for eth1
+# exit status 1
+
+`
+	if got := string(storedContents(t, a, "ethtool-s.txt")); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	a = &analyzer{}
+	defer a.removeSpool()
+	a.createInterfaceCommand("ethtool.txt", func() ([]net.Interface, error) {
+		return nil, errors.New("no route")
+	}, "ethtool").run(context.Background())
+	if !a.hasErrors() {
+		t.Error("the failure to list the interfaces was not stored")
+	}
+}
+
+func TestNonLoopbackInterfaces(t *testing.T) {
+	ifaces, err := nonLoopbackInterfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			t.Errorf("%s is a loopback interface", iface.Name)
+		}
+	}
+}
+
+func TestRouteInterface(t *testing.T) {
+	var d *dialConfig
+	iface, err := d.routeInterface("ip4", net.ParseIP("127.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iface.Flags&net.FlagLoopback == 0 {
+		t.Errorf("the route to 127.0.0.1 leaves from %s", iface.Name)
+	}
+
+	// The interface given with --interface is used regardless of the
+	// route.
+	d = &dialConfig{iface: &net.Interface{Name: "eth9"}}
+	if iface, err := d.routeInterface("ip4", net.ParseIP("127.0.0.1")); err != nil || iface.Name != "eth9" {
+		t.Errorf("routeInterface = %v, %v", iface, err)
+	}
+}
@@ -0,0 +1,40 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// createSysNetStatsTask returns a task that lists each interface's counters
+// from /sys/class/net. It is the fallback for ip -s link. carrier_changes
+// counts how often the link went up or down, which shows a flapping NIC.
+func (a *analyzer) createSysNetStatsTask(f string) *task {
+	return newTask(f, func(ctx context.Context) {
+		dirs, err := filepath.Glob("/sys/class/net/*")
+		if err != nil || len(dirs) == 0 {
+			a.storeError(ctx, errors.Errorf("error getting data for %s: no interfaces in /sys/class/net", f))
+			return
+		}
+		buf := new(bytes.Buffer)
+		for _, dir := range dirs {
+			fmt.Fprintf(buf, "%s:\n", filepath.Base(dir))
+			files, _ := filepath.Glob(filepath.Join(dir, "statistics", "*"))
+			files = append(files, filepath.Join(dir, "carrier_changes"))
+			for _, file := range files {
+				b, err := os.ReadFile(file)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(buf, "    %s: %s\n", filepath.Base(file), strings.TrimSpace(string(b)))
+			}
+		}
+		a.storeFile(f, buf.Bytes())
+	}).withTags(tagLocal).
+		withDescription("Lists the interface counters in /sys/class/net")
+}
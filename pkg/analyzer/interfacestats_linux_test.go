@@ -0,0 +1,20 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSysNetStatsTask(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.createSysNetStatsTask("ip-s-link.txt").run(context.Background())
+	if a.hasErrors() {
+		t.Fatalf("errors: %v", a.errors)
+	}
+	got := string(storedContents(t, a, "ip-s-link.txt"))
+	if !strings.Contains(got, "lo:\n") || !strings.Contains(got, "    rx_bytes: ") {
+		t.Errorf("ip-s-link.txt = %q", got)
+	}
+}
@@ -0,0 +1,81 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows/registry"
+)
+
+// internetSettingsKeys are where Edge and most Windows programs read their
+// proxy settings from. The policy key overrides the others when an
+// administrator manages the settings.
+var internetSettingsKeys = []struct {
+	name string
+	root registry.Key
+	path string
+}{
+	{`HKCU`, registry.CURRENT_USER, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`},
+	{`HKLM`, registry.LOCAL_MACHINE, `Software\Microsoft\Windows\CurrentVersion\Internet Settings`},
+	{`HKLM`, registry.LOCAL_MACHINE, `Software\Policies\Microsoft\Windows\CurrentVersion\Internet Settings`},
+}
+
+// internetSettingsValues are the values that affect which proxy is used.
+var internetSettingsValues = []string{
+	"ProxyEnable",
+	"ProxyServer",
+	"ProxyOverride",
+	"AutoConfigURL",
+	"AutoDetect",
+	"ProxySettingsPerUser",
+}
+
+// createInternetSettingsTask returns a task that stores the proxy values in
+// each of internetSettingsKeys. Keys and values that do not exist, which is
+// common, are noted rather than treated as errors.
+func (a *analyzer) createInternetSettingsTask(f string) *task {
+	return newTask(f, func(ctx context.Context) {
+		buf := new(bytes.Buffer)
+		for _, key := range internetSettingsKeys {
+			fmt.Fprintf(buf, "%s\\%s\n", key.name, key.path)
+			if err := writeInternetSettings(buf, key.root, key.path); err != nil {
+				a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+				fmt.Fprintf(buf, "    %v\n", err)
+			}
+			fmt.Fprintln(buf)
+		}
+		a.storeFile(f, buf.Bytes())
+	}).withTags(tagLocal, tagHTTP).
+		withDescription("Reads the proxy settings from the Internet Settings registry keys")
+}
+
+func writeInternetSettings(buf *bytes.Buffer, root registry.Key, path string) error {
+	k, err := registry.OpenKey(root, path, registry.QUERY_VALUE)
+	if err == registry.ErrNotExist {
+		fmt.Fprintln(buf, "    (key does not exist)")
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "error opening registry key")
+	}
+	defer k.Close()
+
+	for _, name := range internetSettingsValues {
+		if s, _, err := k.GetStringValue(name); err == nil {
+			fmt.Fprintf(buf, "    %s = %q\n", name, s)
+			continue
+		}
+		n, _, err := k.GetIntegerValue(name)
+		switch {
+		case err == nil:
+			fmt.Fprintf(buf, "    %s = %d\n", name, n)
+		case err == registry.ErrNotExist:
+			fmt.Fprintf(buf, "    %s is not set\n", name)
+		default:
+			fmt.Fprintf(buf, "    %s: %v\n", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package analyzer
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+func TestWriteInternetSettings(t *testing.T) {
+	const path = `Software\mm-network-analyzer-test\Internet Settings`
+	k, _, err := registry.CreateKey(registry.CURRENT_USER, path, registry.SET_VALUE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = registry.DeleteKey(registry.CURRENT_USER, path)
+		_ = registry.DeleteKey(registry.CURRENT_USER, `Software\mm-network-analyzer-test`)
+	}()
+	if err := k.SetDWordValue("ProxyEnable", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.SetStringValue("ProxyServer", "proxy.example.com:8080"); err != nil {
+		t.Fatal(err)
+	}
+	_ = k.Close()
+
+	buf := new(bytes.Buffer)
+	if err := writeInternetSettings(buf, registry.CURRENT_USER, path); err != nil {
+		t.Fatal(err)
+	}
+	want := `    ProxyEnable = 1
+    ProxyServer = "proxy.example.com:8080"
+    ProxyOverride is not set
+    AutoConfigURL is not set
+    AutoDetect is not set
+    ProxySettingsPerUser is not set
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := writeInternetSettings(buf, registry.CURRENT_USER, path+`\missing`); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "    (key does not exist)\n" {
+		t.Errorf("missing key = %q", got)
+	}
+}
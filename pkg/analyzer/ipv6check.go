@@ -0,0 +1,76 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ipv6Check is the result of checking, before any task runs, whether the
+// host has IPv6 connectivity. Without it, the IPv6 tasks are skipped
+// rather than each failing with the same error.
+type ipv6Check struct {
+	Available bool `json:"available"`
+	// Address is the source address of the default IPv6 route.
+	Address      string   `json:"address,omitempty"`
+	Reason       string   `json:"reason,omitempty"`
+	SkippedTasks []string `json:"skipped_tasks,omitempty"`
+}
+
+// checkIPv6 checks that there is a default IPv6 route and that its source
+// address is global. Connecting a UDP socket picks the route without
+// sending anything.
+func checkIPv6() *ipv6Check {
+	c := &ipv6Check{}
+	conn, err := net.Dial("udp6", net.JoinHostPort(activeInterfaceIPv6, "443"))
+	if err != nil {
+		c.Reason = "there is no default IPv6 route"
+		return c
+	}
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	_ = conn.Close()
+	if !local.IsGlobalUnicast() || local.IsPrivate() {
+		c.Reason = fmt.Sprintf("the default IPv6 route uses %s, which is not a global address", local)
+		return c
+	}
+	c.Available = true
+	c.Address = local.String()
+	return c
+}
+
+// skipIPv6Tasks checks for IPv6 connectivity if any of tasks is an IPv6
+// task and, if there is none, marks those tasks to be skipped. It adds a
+// task that stores the result of the check. With --ipv4 or --ipv6, the
+// choice is the user's and nothing is checked.
+func (a *analyzer) skipIPv6Tasks(tasks []*task) []*task {
+	isIPv6 := func(t *task) bool { return strings.HasSuffix(t.name, "-ipv6") }
+	if a.dial.addressFamily() != "" || !slices.ContainsFunc(tasks, isIPv6) {
+		return tasks
+	}
+	c := checkIPv6()
+	if !c.Available {
+		for _, t := range tasks {
+			if isIPv6(t) {
+				t.skipReason = "this host has no IPv6 connectivity: " + c.Reason
+				c.SkippedTasks = append(c.SkippedTasks, t.name)
+			}
+		}
+		slog.Warn("skipping the IPv6 tasks", "reason", c.Reason)
+	}
+	check := newTask("ipv6-check.json", func(ctx context.Context) {
+		b, err := json.MarshalIndent(c, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrap(err, "error encoding ipv6-check.json"))
+			return
+		}
+		a.storeFile("ipv6-check.json", b)
+		a.storeResult("ipv6-check", c)
+	}).withTags(tagRouting).withDescription("Records whether this host has IPv6 connectivity")
+	return append([]*task{check}, tasks...)
+}
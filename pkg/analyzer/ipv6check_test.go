@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSkipIPv6Tasks(t *testing.T) {
+	a := &analyzer{}
+	ipv4Only := []*task{newTask("ping-ipv4.txt", nil)}
+	if got := a.skipIPv6Tasks(ipv4Only); len(got) != 1 {
+		t.Errorf("without IPv6 tasks, the tasks are %d long", len(got))
+	}
+	a.dial = &dialConfig{family: "4"}
+	if got := a.skipIPv6Tasks([]*task{newTask("ping-ipv6.txt", nil)}); len(got) != 1 {
+		t.Errorf("with --ipv4, the tasks are %d long", len(got))
+	}
+
+	a = &analyzer{}
+	defer a.removeSpool()
+	ran := false
+	tasks := a.skipIPv6Tasks([]*task{
+		newTask("ping-ipv4.txt", nil),
+		newTask("ping-ipv6.txt", func(context.Context) { ran = true }),
+	})
+	if len(tasks) != 3 || tasks[0].name != "ipv6-check" {
+		t.Fatalf("the check task was not added first: %v", tasks)
+	}
+	a.runTasks(context.Background(), tasks[:1], 1, time.Minute)
+	c, ok := a.results["ipv6-check"].(*ipv6Check)
+	if !ok {
+		t.Fatalf("result = %+v", a.results["ipv6-check"])
+	}
+	if c.Available != (c.Address != "") || c.Available == (c.Reason != "") {
+		t.Errorf("check = %+v", c)
+	}
+	if skipped := tasks[2].skipReason != ""; skipped == c.Available {
+		t.Errorf("with IPv6 available %v, the IPv6 task has the skip reason %q", c.Available, tasks[2].skipReason)
+	}
+	if tasks[1].skipReason != "" {
+		t.Errorf("the IPv4 task is skipped: %s", tasks[1].skipReason)
+	}
+
+	// A skipped task is recorded but not run.
+	tasks[2].skipReason = "this host has no IPv6 connectivity: there is no default IPv6 route"
+	a.runTasks(context.Background(), tasks[2:], 1, time.Minute)
+	r := a.taskRecords[len(a.taskRecords)-1]
+	if ran || r.Status != taskStatusSkipped || !strings.HasPrefix(r.Note, "this host has no IPv6") {
+		t.Errorf("ran %v, record = %+v", ran, r)
+	}
+}
+
+func TestIPv6CheckFindings(t *testing.T) {
+	fs := findingsFor(map[string]interface{}{
+		"ipv6-check": &ipv6Check{Reason: "there is no default IPv6 route"},
+	})
+	want := "this host has no IPv6 connectivity, as there is no default IPv6 route; the IPv6 tasks were skipped"
+	if len(fs) != 1 || fs[0].Check != "no-ipv6" || fs[0].Summary != want {
+		t.Errorf("findings = %+v", fs)
+	}
+	if fs := findingsFor(map[string]interface{}{"ipv6-check": &ipv6Check{Available: true}}); len(fs) != 0 {
+		t.Errorf("findings = %+v", fs)
+	}
+}
@@ -0,0 +1,269 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// keepAliveRequests is the number of requests made over new connections
+// and then over one persistent connection.
+const keepAliveRequests = 5
+
+// keepAliveIdle are the idle periods after which the persistent connection
+// is used again. Servers, including MaxMind's, keep idle connections open
+// for longer than the longest of these.
+var keepAliveIdle = []time.Duration{5 * time.Second, 30 * time.Second}
+
+// keepAliveRequest is the outcome of one request of the keep-alive task.
+type keepAliveRequest struct {
+	Reused     bool    `json:"reused"`
+	IdleMS     float64 `json:"idle_ms,omitempty"`
+	StatusCode int     `json:"status_code,omitempty"`
+	TotalMS    float64 `json:"total_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// idleProbe is the outcome of using the persistent connection after it
+// was idle for IdleMS. If the connection was closed in the meantime,
+// ClosedAfterMS is how long after the last response that happened, and
+// CloseError is what reading from it returned, e.g., EOF for a FIN or a
+// reset from a middlebox.
+type idleProbe struct {
+	IdleMS        float64           `json:"idle_ms"`
+	ClosedAfterMS *float64          `json:"closed_after_ms,omitempty"`
+	CloseError    string            `json:"close_error,omitempty"`
+	Request       *keepAliveRequest `json:"request"`
+}
+
+// keepAliveReport compares requests over new connections with requests
+// over one persistent connection, and records whether the persistent
+// connection survives being idle.
+type keepAliveReport struct {
+	URL        string              `json:"url"`
+	Fresh      []*keepAliveRequest `json:"fresh"`
+	Persistent []*keepAliveRequest `json:"persistent"`
+	// FreshTotal and PersistentTotal are the distributions of the total
+	// times of the requests that succeeded.
+	FreshTotal      *distribution `json:"fresh_total,omitempty"`
+	PersistentTotal *distribution `json:"persistent_total,omitempty"`
+	// KeepAliveHeader is the server's Keep-Alive response header, which
+	// may give its idle timeout.
+	KeepAliveHeader string       `json:"keep_alive_header,omitempty"`
+	Idle            []*idleProbe `json:"idle"`
+	// ClosedEarly is true if the persistent connection was closed while
+	// idle, or could not be reused.
+	ClosedEarly bool `json:"closed_early"`
+}
+
+func (a *analyzer) createKeepAliveTask(f, host string) *task {
+	url := "https://" + host + "/"
+	return newTask(f, func(ctx context.Context) {
+		r := keepAlive(ctx, url)
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", f))
+			return
+		}
+		a.storeFile(f, b)
+		a.storeResult(taskName(f), r)
+	}).withTags(tagHTTP).
+		withTimeout(2*time.Minute).
+		withDescription(
+			"Compares requests to %s over new and persistent connections, and reuses the connection after it is idle",
+			url,
+		)
+}
+
+func keepAlive(ctx context.Context, url string) *keepAliveReport {
+	r := &keepAliveReport{URL: url}
+
+	fresh := newKeepAliveClient(ctx, true)
+	var freshMS []float64
+	for i := 0; i < keepAliveRequests && ctx.Err() == nil; i++ {
+		req, _ := fresh.get(ctx, url)
+		r.Fresh = append(r.Fresh, req)
+		if req.Error == "" {
+			freshMS = append(freshMS, req.TotalMS)
+		}
+	}
+	r.FreshTotal = newDistribution(freshMS)
+
+	persistent := newKeepAliveClient(ctx, false)
+	defer persistent.transport.CloseIdleConnections()
+	var persistentMS []float64
+	for i := 0; i < keepAliveRequests && ctx.Err() == nil; i++ {
+		req, resp := persistent.get(ctx, url)
+		r.Persistent = append(r.Persistent, req)
+		if req.Error == "" {
+			persistentMS = append(persistentMS, req.TotalMS)
+			r.KeepAliveHeader = resp.Header.Get("Keep-Alive")
+		}
+		if i > 0 && !req.Reused {
+			r.ClosedEarly = true
+		}
+	}
+	r.PersistentTotal = newDistribution(persistentMS)
+
+	for _, idle := range keepAliveIdle {
+		conn := persistent.lastConn()
+		if conn == nil || sleepContext(ctx, idle) != nil {
+			break
+		}
+		p := &idleProbe{IdleMS: durationMS(idle)}
+		if closedAfter, err := conn.closedAfter(); err != nil {
+			ms := durationMS(closedAfter)
+			p.ClosedAfterMS = &ms
+			p.CloseError = err.Error()
+			r.ClosedEarly = true
+		}
+		p.Request, _ = persistent.get(ctx, url)
+		if !p.Request.Reused {
+			r.ClosedEarly = true
+		}
+		r.Idle = append(r.Idle, p)
+	}
+	return r
+}
+
+// keepAliveClient is an HTTP client that keeps track of the connections
+// it opens.
+type keepAliveClient struct {
+	client    *http.Client
+	transport *http.Transport
+
+	mu    sync.Mutex
+	conns []*watchedConn
+}
+
+// newKeepAliveClient returns a client that dials with the settings of the
+// task running with ctx.
+func newKeepAliveClient(ctx context.Context, disableKeepAlives bool) *keepAliveClient {
+	dial := dialConfigFromContext(ctx)
+	c := &keepAliveClient{}
+	c.transport = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dial.dialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			wc := &watchedConn{Conn: conn}
+			c.mu.Lock()
+			c.conns = append(c.conns, wc)
+			c.mu.Unlock()
+			return wc, nil
+		},
+		DisableKeepAlives: disableKeepAlives,
+		// The idle probes must not be cut short by our own transport.
+		IdleConnTimeout: 0,
+	}
+	c.client = &http.Client{Transport: c.transport}
+	return c
+}
+
+func (c *keepAliveClient) lastConn() *watchedConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.conns) == 0 {
+		return nil
+	}
+	return c.conns[len(c.conns)-1]
+}
+
+// get requests url and reads the whole response. The response is nil if
+// the request failed.
+func (c *keepAliveClient) get(ctx context.Context, url string) (*keepAliveRequest, *http.Response) {
+	r := &keepAliveRequest{}
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.Reused = info.Reused
+			r.IdleMS = durationMS(info.IdleTime)
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, url, nil)
+	if err != nil {
+		r.Error = errors.Wrap(err, "error creating request").Error()
+		return r, nil
+	}
+	req.Header.Set("User-Agent", os.Args[0])
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		r.TotalMS = durationMS(time.Since(start))
+		r.Error = errors.Wrap(err, "error making request").Error()
+		return r, nil
+	}
+	defer resp.Body.Close()
+	r.StatusCode = resp.StatusCode
+	_, err = io.Copy(io.Discard, resp.Body)
+	r.TotalMS = durationMS(time.Since(start))
+	if err != nil {
+		r.Error = errors.Wrap(err, "error reading response body").Error()
+		return r, nil
+	}
+	if conn := c.lastConn(); conn != nil {
+		conn.used()
+	}
+	return r, resp
+}
+
+// watchedConn records when the peer, or something between us and it,
+// closes the connection. The HTTP transport reads from idle connections in
+// the background, so the read fails as soon as that happens.
+type watchedConn struct {
+	net.Conn
+
+	mu       sync.Mutex
+	lastUsed time.Time
+	closedAt time.Time
+	closeErr error
+	closing  bool
+}
+
+func (c *watchedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if err != nil {
+		c.mu.Lock()
+		if !c.closing && c.closeErr == nil {
+			c.closedAt = time.Now()
+			c.closeErr = err
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+func (c *watchedConn) Close() error {
+	c.mu.Lock()
+	c.closing = true
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+func (c *watchedConn) used() {
+	c.mu.Lock()
+	c.lastUsed = time.Now()
+	c.mu.Unlock()
+}
+
+// closedAfter returns how long after it was last used the connection was
+// closed by the other end, and the error reading from it returned. The
+// error is nil if it is still open.
+func (c *watchedConn) closedAfter() (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeErr == nil {
+		return 0, nil
+	}
+	return c.closedAt.Sub(c.lastUsed), c.closeErr
+}
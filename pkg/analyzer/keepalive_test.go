@@ -0,0 +1,80 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// serveKeepAlive starts a server that closes connections after they are
+// idle for idleTimeout and sets keepAliveIdle to idle for the test.
+func serveKeepAlive(t *testing.T, idleTimeout time.Duration, idle ...time.Duration) *httptest.Server {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	server.Config.IdleTimeout = idleTimeout
+	server.Start()
+	t.Cleanup(server.Close)
+
+	saved := keepAliveIdle
+	keepAliveIdle = idle
+	t.Cleanup(func() { keepAliveIdle = saved })
+	return server
+}
+
+func TestKeepAlive(t *testing.T) {
+	server := serveKeepAlive(t, time.Minute, 50*time.Millisecond)
+
+	r := keepAlive(context.Background(), server.URL+"/")
+	if len(r.Fresh) != keepAliveRequests || len(r.Persistent) != keepAliveRequests {
+		t.Fatalf("%d fresh and %d persistent requests", len(r.Fresh), len(r.Persistent))
+	}
+	for i, req := range r.Fresh {
+		if req.Reused || req.StatusCode != http.StatusOK {
+			t.Errorf("fresh request %d = %+v", i, req)
+		}
+	}
+	for i, req := range r.Persistent {
+		if req.Reused != (i > 0) || req.StatusCode != http.StatusOK {
+			t.Errorf("persistent request %d = %+v", i, req)
+		}
+	}
+	if r.FreshTotal.Count != keepAliveRequests || r.PersistentTotal.Count != keepAliveRequests {
+		t.Errorf("distributions = %+v and %+v", r.FreshTotal, r.PersistentTotal)
+	}
+	if len(r.Idle) != 1 || r.Idle[0].IdleMS != 50 || !r.Idle[0].Request.Reused || r.Idle[0].ClosedAfterMS != nil {
+		t.Errorf("idle probes = %+v", r.Idle)
+	}
+	if r.ClosedEarly {
+		t.Error("the connection was closed early")
+	}
+}
+
+func TestKeepAliveClosedEarly(t *testing.T) {
+	server := serveKeepAlive(t, 100*time.Millisecond, 500*time.Millisecond)
+
+	r := keepAlive(context.Background(), server.URL+"/")
+	if !r.ClosedEarly || len(r.Idle) != 1 {
+		t.Fatalf("report = %+v", r)
+	}
+	p := r.Idle[0]
+	if p.ClosedAfterMS == nil || *p.ClosedAfterMS < 100 || *p.ClosedAfterMS >= 500 || p.CloseError == "" {
+		t.Errorf("idle probe = %+v", p)
+	}
+	// A new connection is made for the request.
+	if p.Request.Reused || p.Request.Error != "" {
+		t.Errorf("request after the close = %+v", p.Request)
+	}
+}
+
+func TestKeepAliveFindings(t *testing.T) {
+	fs := findingsFor(map[string]interface{}{
+		"geoip.maxmind.com-keepalive": &keepAliveReport{URL: "https://geoip.maxmind.com/", ClosedEarly: true},
+	})
+	if len(fs) != 1 || fs[0].Check != "keepalive-closed" {
+		t.Errorf("findings = %+v", fs)
+	}
+}
@@ -0,0 +1,13 @@
+package analyzer
+
+// slowLinkMbps is the speed at or below which a wired link is reported. A
+// link that negotiated 10 or 100 Mbps usually has a bad cable or port.
+const slowLinkMbps = 100
+
+// linkReport is the negotiated speed and duplex of an active interface.
+// They are unknown for most virtual and wireless interfaces.
+type linkReport struct {
+	Interface string `json:"interface"`
+	SpeedMbps int    `json:"speed_mbps,omitempty"`
+	Duplex    string `json:"duplex,omitempty"`
+}
@@ -0,0 +1,54 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// createLinkTask returns a task that reads the negotiated speed and duplex
+// of the active interfaces from /sys/class/net.
+func (a *analyzer) createLinkTask(f string) *task {
+	return newTask(f, func(ctx context.Context) {
+		ifaces, err := a.dial.activeInterfaces()
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+			return
+		}
+		var reports []*linkReport
+		for _, iface := range ifaces {
+			reports = append(reports, readLinkSettings(iface.Name))
+		}
+		b, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", f))
+			return
+		}
+		a.storeFile(f, b)
+		a.storeResult(taskName(f), reports)
+	}).withTags(tagLocal).
+		withDescription("Reads the negotiated speed and duplex of the active interfaces from /sys/class/net")
+}
+
+func readLinkSettings(name string) *linkReport {
+	r := &linkReport{Interface: name}
+	dir := filepath.Join("/sys/class/net", name)
+	// Reading these fails with EINVAL for interfaces that do not report
+	// them, so failures are not errors.
+	if b, err := os.ReadFile(filepath.Join(dir, "speed")); err == nil {
+		if speed, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil && speed > 0 {
+			r.SpeedMbps = speed
+		}
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "duplex")); err == nil {
+		if duplex := strings.TrimSpace(string(b)); duplex != "unknown" {
+			r.Duplex = duplex
+		}
+	}
+	return r
+}
@@ -0,0 +1,13 @@
+package analyzer
+
+import "testing"
+
+func TestReadLinkSettings(t *testing.T) {
+	// Loopback has no speed or duplex, and reading them must not fail.
+	if r := readLinkSettings("lo"); *r != (linkReport{Interface: "lo"}) {
+		t.Errorf("lo = %+v", r)
+	}
+	if r := readLinkSettings("no-such-interface"); *r != (linkReport{Interface: "no-such-interface"}) {
+		t.Errorf("missing interface = %+v", r)
+	}
+}
@@ -0,0 +1,20 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLinkFindings(t *testing.T) {
+	fs := findingsFor(map[string]interface{}{"link": []*linkReport{
+		{Interface: "eth0", SpeedMbps: 100, Duplex: "half"},
+		{Interface: "eth1", SpeedMbps: 1000, Duplex: "full"},
+		{Interface: "wlan0"},
+	}})
+	if want := []string{"slow-link", "half-duplex"}; !reflect.DeepEqual(findingChecks(fs), want) {
+		t.Fatalf("findings = %v, want %v", findingChecks(fs), want)
+	}
+	if want := "the interface eth0 negotiated only 100 Mbps, which may be a bad cable or port"; fs[0].Summary != want {
+		t.Errorf("summary = %q", fs[0].Summary)
+	}
+}
@@ -0,0 +1,122 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Log formats for --log-format.
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// newLogger returns a logger that writes records at level or above to
+// terminal and all records to runLog, which is stored in the archive as
+// run.log.
+func newLogger(terminal, runLog io.Writer, level slog.Level, format string) (*slog.Logger, error) {
+	newHandler := func(w io.Writer, level slog.Level) slog.Handler {
+		opts := &slog.HandlerOptions{Level: level}
+		if format == logFormatJSON {
+			return slog.NewJSONHandler(w, opts)
+		}
+		return slog.NewTextHandler(w, opts)
+	}
+	switch format {
+	case logFormatText, logFormatJSON:
+	default:
+		return nil, errors.Errorf("unknown log format %q", format)
+	}
+	return slog.New(multiHandler{
+		newHandler(terminal, level),
+		newHandler(runLog, slog.LevelDebug),
+	}), nil
+}
+
+// logLevel returns the level to log to the terminal at for the --verbose
+// and --quiet flags.
+func logLevel(verbose, quiet bool) slog.Level {
+	switch {
+	case verbose:
+		return slog.LevelDebug
+	case quiet:
+		return slog.LevelError
+	default:
+		return slog.LevelWarn
+	}
+}
+
+// fatal logs err and exits as no archive can be written.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(exitArchiveFailed)
+}
+
+// multiHandler sends each record to every handler that is enabled for it.
+type multiHandler []slog.Handler
+
+func (h multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if !handler.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := handler.Handle(ctx, r.Clone()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (h multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(h))
+	for i, handler := range h {
+		handlers[i] = handler.WithGroup(name)
+	}
+	return handlers
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// Bytes returns a copy of the buffer's contents.
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
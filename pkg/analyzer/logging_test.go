@@ -0,0 +1,74 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var terminal, runLog bytes.Buffer
+	logger, err := newLogger(&terminal, &runLog, slog.LevelWarn, logFormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger = logger.With("run", 1)
+	logger.Debug("task started", "task", "dig")
+	logger.Warn("slow task", "task", "mtr")
+
+	// The terminal only gets the warning, but run.log gets everything.
+	if out := terminal.String(); strings.Contains(out, "task started") || !strings.Contains(out, "task=mtr") {
+		t.Errorf("terminal output:\n%s", out)
+	}
+	for _, want := range []string{"level=DEBUG msg=\"task started\" run=1 task=dig", "level=WARN"} {
+		if !strings.Contains(runLog.String(), want) {
+			t.Errorf("run.log does not contain %s:\n%s", want, runLog.String())
+		}
+	}
+
+	if _, err := newLogger(&terminal, &runLog, slog.LevelWarn, "xml"); err == nil {
+		t.Error("newLogger accepted an unknown format")
+	}
+}
+
+func TestNewLoggerJSON(t *testing.T) {
+	var terminal, runLog bytes.Buffer
+	logger, err := newLogger(&terminal, &runLog, slog.LevelDebug, logFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.WithGroup("command").Info("command finished", "exit_code", 2)
+	for _, out := range []*bytes.Buffer{&terminal, &runLog} {
+		var record struct {
+			Msg     string `json:"msg"`
+			Command struct {
+				ExitCode int `json:"exit_code"`
+			} `json:"command"`
+		}
+		if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+			t.Fatalf("%v: %s", err, out)
+		}
+		if record.Msg != "command finished" || record.Command.ExitCode != 2 {
+			t.Errorf("record = %+v", record)
+		}
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	tests := []struct {
+		verbose, quiet bool
+		want           slog.Level
+	}{
+		{false, false, slog.LevelWarn},
+		{true, false, slog.LevelDebug},
+		{false, true, slog.LevelError},
+		{true, true, slog.LevelDebug},
+	}
+	for _, test := range tests {
+		if got := logLevel(test.verbose, test.quiet); got != test.want {
+			t.Errorf("logLevel(%t, %t) = %s, want %s", test.verbose, test.quiet, got, test.want)
+		}
+	}
+}
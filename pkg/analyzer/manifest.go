@@ -0,0 +1,187 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Task statuses recorded in manifest.json.
+const (
+	taskStatusCompleted   = "completed"
+	taskStatusTimedOut    = "timed out"
+	taskStatusInterrupted = "interrupted"
+	taskStatusNotStarted  = "not started"
+	// taskStatusToolMissing means that the task was not run as a tool it
+	// needs is not installed.
+	taskStatusToolMissing = "tool missing"
+	// taskStatusSkipped means that the task was not run as it could not
+	// succeed on this host, e.g., an IPv6 task without IPv6 connectivity.
+	taskStatusSkipped = "skipped"
+)
+
+// manifest is written to manifest.json. It describes every task that was
+// run and every file in the archive so that support can check that the
+// archive is complete and spot truncated output.
+type manifest struct {
+	Generated time.Time `json:"generated"`
+	Analyzer  buildInfo `json:"analyzer"`
+	// Reference is the support ticket or other reference given with
+	// --reference.
+	Reference string `json:"reference,omitempty"`
+	// Run is when the tasks started and finished.
+	Run   *runTiming     `json:"run,omitempty"`
+	Tasks []*taskRecord  `json:"tasks"`
+	Files []manifestFile `json:"files"`
+}
+
+// taskRecord is the manifest entry for a task. The fields are set as the
+// task runs.
+type taskRecord struct {
+	Name string `json:"name"`
+	// Command is the command line for tasks that run a command.
+	Command []string `json:"command,omitempty"`
+	Status  string   `json:"status"`
+	// Note is why the task was skipped.
+	Note       string     `json:"note,omitempty"`
+	Started    *time.Time `json:"started,omitempty"`
+	Finished   *time.Time `json:"finished,omitempty"`
+	DurationMS float64    `json:"duration_ms"`
+	// TimeoutMS is how long the task was allowed to run.
+	TimeoutMS float64 `json:"timeout_ms,omitempty"`
+	// ExitCode is set for tasks that run a command.
+	ExitCode *int `json:"exit_code,omitempty"`
+	// Attempts are the outcomes of the network operations that may be
+	// retried.
+	Attempts []attemptRecord `json:"attempts,omitempty"`
+	Outputs  []manifestFile  `json:"outputs"`
+
+	// outputs are the names of the files the task writes.
+	outputs []string
+	// mu guards Attempts, which some tasks add to concurrently.
+	mu sync.Mutex
+}
+
+func (r *taskRecord) addAttempt(attempt attemptRecord) {
+	r.mu.Lock()
+	r.Attempts = append(r.Attempts, attempt)
+	r.mu.Unlock()
+}
+
+// runTiming is when the tasks started and finished. The duration is
+// measured with the monotonic clock, so it is right even if the wall
+// clock was changed during the run, e.g., by NTP.
+type runTiming struct {
+	Started    time.Time `json:"started"`
+	Finished   time.Time `json:"finished"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+type manifestFile struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// scrubTaskRecord applies scrubString to the parts of r that may hold
+// addresses, host names, or the license key.
+func (a *analyzer) scrubTaskRecord(r *taskRecord) {
+	if len(r.Command) > 0 {
+		command := make([]string, len(r.Command))
+		for i, arg := range r.Command {
+			command[i] = a.scrubString(arg)
+		}
+		r.Command = command
+	}
+	r.Note = a.scrubString(r.Note)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.Attempts) > 0 {
+		attempts := make([]attemptRecord, len(r.Attempts))
+		for i, attempt := range r.Attempts {
+			attempt.Operation = a.scrubString(attempt.Operation)
+			attempt.Error = a.scrubString(attempt.Error)
+			attempts[i] = attempt
+		}
+		r.Attempts = attempts
+	}
+}
+
+type taskRecordKey struct{}
+
+// taskRecordFromContext returns the record of the running task, or a
+// record that is discarded if ctx is not a task's context.
+func taskRecordFromContext(ctx context.Context) *taskRecord {
+	if r, ok := ctx.Value(taskRecordKey{}).(*taskRecord); ok {
+		return r
+	}
+	return &taskRecord{}
+}
+
+// addManifest stores manifest.json. It must be called after every other
+// file has been stored and changed, e.g., by redactFiles or --review, so
+// that the sizes and checksums are those of the archived files. As
+// manifest.json is stored after redactFiles, the command lines, notes, and
+// attempts it records are scrubbed here. The file and task names are
+// kept, as they must match the names in the archive.
+func (a *analyzer) addManifest() error {
+	a.filesMutex.Lock()
+	files := map[string]manifestFile{}
+	m := &manifest{
+		Generated: time.Now().UTC(),
+		Analyzer:  currentBuild(),
+		Reference: a.reference,
+		Files:     []manifestFile{},
+	}
+	if !a.runStarted.IsZero() {
+		m.Run = &runTiming{
+			Started:    a.runStarted,
+			Finished:   a.runFinished,
+			DurationMS: durationMS(a.runFinished.Sub(a.runStarted)),
+		}
+	}
+	for _, sf := range a.files {
+		sum, err := sf.sha256()
+		if err != nil {
+			a.filesMutex.Unlock()
+			return err
+		}
+		mf := manifestFile{
+			Name:   sf.name,
+			Size:   int(sf.length()),
+			SHA256: sum,
+		}
+		files[sf.name] = mf
+		m.Files = append(m.Files, mf)
+	}
+	a.filesMutex.Unlock()
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Name < m.Files[j].Name })
+
+	a.resultsMutex.Lock()
+	m.Tasks = append(m.Tasks, a.taskRecords...)
+	a.resultsMutex.Unlock()
+	sort.Slice(m.Tasks, func(i, j int) bool { return m.Tasks[i].Name < m.Tasks[j].Name })
+
+	for _, r := range m.Tasks {
+		a.scrubTaskRecord(r)
+		r.Outputs = []manifestFile{}
+		for _, name := range r.outputs {
+			// The output is missing if the task failed or the file was
+			// dropped during --review.
+			if mf, ok := files[name]; ok {
+				r.Outputs = append(r.Outputs, mf)
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding manifest.json")
+	}
+	a.storeFile("manifest.json", b)
+	return nil
+}
@@ -0,0 +1,182 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifest(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.runTasks(context.Background(), []*task{
+		newTask("hosts", func(context.Context) {
+			a.storeFile("hosts", []byte("127.0.0.1 localhost\n"))
+		}),
+		// The output of a failed task is missing.
+		newTask("ntp.json", func(context.Context) {}),
+	}, 1, time.Minute)
+	if err := a.addManifest(); err != nil {
+		t.Fatal(err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(storedContents(t, a, "manifest.json"), &m); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("127.0.0.1 localhost\n"))
+	want := manifestFile{Name: "hosts", Size: 20, SHA256: hex.EncodeToString(sum[:])}
+	if len(m.Files) != 1 || m.Files[0] != want {
+		t.Errorf("files = %+v, want %+v", m.Files, want)
+	}
+	if len(m.Tasks) != 2 {
+		t.Fatalf("tasks = %+v", m.Tasks)
+	}
+	hosts, ntp := m.Tasks[0], m.Tasks[1]
+	if hosts.Name != "hosts" || hosts.Status != taskStatusCompleted || hosts.Started == nil ||
+		len(hosts.Outputs) != 1 || hosts.Outputs[0] != want {
+		t.Errorf("hosts = %+v", hosts)
+	}
+	if ntp.Name != "ntp" || len(ntp.Outputs) != 0 {
+		t.Errorf("ntp = %+v", ntp)
+	}
+}
+
+func TestManifestIsRedacted(t *testing.T) {
+	r, err := newRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &analyzer{
+		redactor:    r,
+		credentials: &credentials{accountID: "1", licenseKey: "secret-license-key"},
+	}
+	defer a.removeSpool()
+
+	a.storeFile("dig-internal.txt", []byte("server 10.1.2.3 answered for db.corp"))
+	a.taskRecords = []*taskRecord{{
+		Name:    "dig-internal",
+		Command: []string{"dig", "@192.168.1.1", "db.corp"},
+		Status:  taskStatusCompleted,
+		Note:    "resolver 10.0.0.53 was used",
+		Attempts: []attemptRecord{{
+			Operation: "GET https://geoip.maxmind.com/?key=secret-license-key",
+			Attempt:   1,
+			Error:     "dial udp 172.16.0.1:53: i/o timeout for printer.local",
+		}},
+		outputs: []string{"dig-internal.txt"},
+	}}
+
+	a.redactFiles()
+	if err := a.addManifest(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := storedContents(t, a, "manifest.json")
+	for _, leaked := range []string{
+		"10.1.2.3", "192.168.1.1", "10.0.0.53", "172.16.0.1", "db.corp", "printer.local", "secret-license-key",
+	} {
+		if strings.Contains(string(b), leaked) {
+			t.Errorf("manifest.json contains %q:\n%s", leaked, b)
+		}
+	}
+
+	var m manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Tasks) != 1 || m.Tasks[0].Name != "dig-internal" {
+		t.Fatalf("tasks = %+v", m.Tasks)
+	}
+	if got := m.Tasks[0].Command; len(got) != 3 || got[1] != "@[REDACTED-PRIVATE-IP]" {
+		t.Errorf("command = %q", got)
+	}
+
+	// The checksum is that of the redacted file in the archive.
+	redacted := storedContents(t, a, "dig-internal.txt")
+	sum := sha256.Sum256(redacted)
+	want := hex.EncodeToString(sum[:])
+	if len(m.Files) != 1 || m.Files[0].SHA256 != want || m.Files[0].Size != len(redacted) {
+		t.Errorf("files = %+v, want the checksum %s of %q", m.Files, want, redacted)
+	}
+	if outputs := m.Tasks[0].Outputs; len(outputs) != 1 || outputs[0].SHA256 != want {
+		t.Errorf("outputs = %+v", outputs)
+	}
+}
+
+func TestManifestWithoutRedaction(t *testing.T) {
+	a := &analyzer{}
+	a.taskRecords = []*taskRecord{{
+		Name:    "dig-internal",
+		Command: []string{"dig", "@192.168.1.1"},
+		Status:  taskStatusCompleted,
+	}}
+	if err := a.addManifest(); err != nil {
+		t.Fatal(err)
+	}
+	if b := storedContents(t, a, "manifest.json"); !strings.Contains(string(b), "192.168.1.1") {
+		t.Errorf("manifest.json was redacted without --redact:\n%s", b)
+	}
+}
+
+func TestManifestTiming(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	if err := a.addManifest(); err != nil {
+		t.Fatal(err)
+	}
+	if b := storedContents(t, a, "manifest.json"); strings.Contains(string(b), `"run"`) {
+		t.Errorf("manifest.json has the timing of tasks that were not run:\n%s", b)
+	}
+
+	a = &analyzer{}
+	defer a.removeSpool()
+	sleep := func(context.Context) { time.Sleep(20 * time.Millisecond) }
+	a.runTasks(context.Background(), []*task{
+		newTask("ping.txt", sleep).withTimeout(time.Minute),
+		newTask("ntp.json", sleep),
+	}, 1, 90*time.Second)
+	if err := a.addManifest(); err != nil {
+		t.Fatal(err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(storedContents(t, a, "manifest.json"), &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Run == nil || m.Run.DurationMS < 40 || m.Run.Finished.Before(m.Run.Started) {
+		t.Fatalf("run = %+v", m.Run)
+	}
+	timeouts := map[string]float64{}
+	for _, r := range m.Tasks {
+		timeouts[r.Name] = r.TimeoutMS
+		if r.Started.Before(m.Run.Started) || r.Finished.After(m.Run.Finished) {
+			t.Errorf("%s ran from %s to %s, outside of the run", r.Name, r.Started, r.Finished)
+		}
+	}
+	// Tasks without their own timeout have the default.
+	if want := map[string]float64{"ping": 60000, "ntp": 90000}; !reflect.DeepEqual(timeouts, want) {
+		t.Errorf("timeouts = %v, want %v", timeouts, want)
+	}
+}
+
+func TestManifestReference(t *testing.T) {
+	c := NewCollector(Options{NoBuiltinTasks: true, Reference: "CASE-1"})
+	c.Register(funcTask{name: "check.txt", run: func(context.Context, *Collector) {}})
+	archive := memoryArchive{}
+	if _, err := c.Run(context.Background(), archive); err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(archive["manifest.json"], &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Reference != "CASE-1" {
+		t.Errorf("reference = %q", m.Reference)
+	}
+}
@@ -0,0 +1,144 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const metricsPrefix = "mm_network_monitor_"
+
+// serveMetrics serves the monitor's latest samples in the Prometheus text
+// format at /metrics on addr until ctx is done.
+func (m *monitor) serveMetrics(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "error listening on %s", addr)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(m.metrics())
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("error serving metrics", "error", err)
+		}
+	}()
+	slog.Info("serving metrics", "url", "http://"+ln.Addr().String()+"/metrics")
+	return nil
+}
+
+// metrics renders the latest samples. Probes that did not run because an
+// earlier one failed, e.g., TLS after a failed TCP connection, are
+// reported as failed with no duration.
+func (m *monitor) metrics() []byte {
+	m.mu.Lock()
+	samples, rounds := m.latest, m.rounds
+	m.mu.Unlock()
+
+	w := &metricsWriter{buf: new(bytes.Buffer)}
+	w.family("rounds_total", "counter", "Rounds of probes run.")
+	w.sample("rounds_total", nil, float64(rounds))
+
+	w.family("last_sample_timestamp_seconds", "gauge", "Time at which the host was last probed.")
+	for _, s := range samples {
+		w.sample("last_sample_timestamp_seconds", []string{"host", s.Endpoint.Host}, float64(s.Time.Unix()))
+	}
+
+	w.family("probe_success", "gauge", "Whether the probe succeeded.")
+	for _, s := range samples {
+		for _, p := range monitorProbes(s.Endpoint) {
+			w.sample("probe_success", []string{"host", s.Endpoint.Host, "probe", p.name}, boolValue(p.check.OK))
+		}
+	}
+	w.family("probe_duration_seconds", "gauge", "Time taken by the probe.")
+	for _, s := range samples {
+		for _, p := range monitorProbes(s.Endpoint) {
+			if p.check.OK {
+				w.sample(
+					"probe_duration_seconds",
+					[]string{"host", s.Endpoint.Host, "probe", p.name},
+					p.check.DurationMS/1000,
+				)
+			}
+		}
+	}
+
+	w.family("http_status_code", "gauge", "Status code of the HTTPS request.")
+	for _, s := range samples {
+		// The status is, e.g., "200 OK".
+		code, _, _ := strings.Cut(s.Endpoint.HTTPStatus, " ")
+		if v, err := strconv.Atoi(code); err == nil {
+			w.sample("http_status_code", []string{"host", s.Endpoint.Host}, float64(v))
+		}
+	}
+
+	w.family("ping_loss_ratio", "gauge", "Fraction of ICMP echo requests lost.")
+	for _, s := range samples {
+		if s.Ping != nil && s.Ping.Sent > 0 {
+			w.sample("ping_loss_ratio", []string{"host", s.Endpoint.Host}, s.Ping.Loss/100)
+		}
+	}
+	w.family("ping_rtt_seconds", "gauge", "Average round-trip time of the ICMP echo requests answered.")
+	for _, s := range samples {
+		if s.Ping != nil && s.Ping.Received > 0 {
+			w.sample("ping_rtt_seconds", []string{"host", s.Endpoint.Host}, s.Ping.AvgMS/1000)
+		}
+	}
+	return w.buf.Bytes()
+}
+
+type monitorProbe struct {
+	name  string
+	check endpointCheck
+}
+
+func monitorProbes(e *endpointHealth) []monitorProbe {
+	return []monitorProbe{{"dns", e.DNS}, {"tcp", e.TCP}, {"tls", e.TLS}, {"http", e.HTTP}}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// metricsWriter writes the Prometheus text exposition format.
+type metricsWriter struct {
+	buf *bytes.Buffer
+}
+
+func (w *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(w.buf, "# HELP %s%s %s\n# TYPE %s%s %s\n", metricsPrefix, name, help, metricsPrefix, name, typ)
+}
+
+// sample writes a single sample. labels are pairs of names and values.
+func (w *metricsWriter) sample(name string, labels []string, v float64) {
+	w.buf.WriteString(metricsPrefix + name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			fmt.Fprintf(w.buf, "%s=%s", labels[i], strconv.Quote(labels[i+1]))
+		}
+		w.buf.WriteByte('}')
+	}
+	fmt.Fprintf(w.buf, " %s\n", strconv.FormatFloat(v, 'g', -1, 64))
+}
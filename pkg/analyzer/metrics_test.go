@@ -0,0 +1,126 @@
+package analyzer
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitorMetrics(t *testing.T) {
+	ok := endpointCheck{OK: true, DurationMS: 25}
+	m := &monitor{rounds: 3, latest: []*monitorSample{
+		{
+			Time: time.Unix(1700000000, 0),
+			Endpoint: &endpointHealth{
+				Host:       "geoip.maxmind.com",
+				DNS:        ok,
+				TCP:        ok,
+				TLS:        ok,
+				HTTP:       endpointCheck{OK: true, DurationMS: 120},
+				HTTPStatus: "200 OK",
+			},
+			Ping: &pingReport{Sent: 4, Received: 3, Loss: 25, AvgMS: 12.5},
+		},
+		{
+			// The TLS and HTTPS probes did not run after the failed
+			// connection and the ping did not get any replies.
+			Time: time.Unix(1700000060, 0),
+			Endpoint: &endpointHealth{
+				Host: "updates.maxmind.com",
+				DNS:  ok,
+				TCP:  endpointCheck{Error: "connection refused"},
+			},
+			Ping: &pingReport{Sent: 4, Loss: 100},
+		},
+	}}
+
+	want := `# HELP mm_network_monitor_rounds_total Rounds of probes run.
+# TYPE mm_network_monitor_rounds_total counter
+mm_network_monitor_rounds_total 3
+# HELP mm_network_monitor_last_sample_timestamp_seconds Time at which the host was last probed.
+# TYPE mm_network_monitor_last_sample_timestamp_seconds gauge
+mm_network_monitor_last_sample_timestamp_seconds{host="geoip.maxmind.com"} 1.7e+09
+mm_network_monitor_last_sample_timestamp_seconds{host="updates.maxmind.com"} 1.70000006e+09
+# HELP mm_network_monitor_probe_success Whether the probe succeeded.
+# TYPE mm_network_monitor_probe_success gauge
+mm_network_monitor_probe_success{host="geoip.maxmind.com",probe="dns"} 1
+mm_network_monitor_probe_success{host="geoip.maxmind.com",probe="tcp"} 1
+mm_network_monitor_probe_success{host="geoip.maxmind.com",probe="tls"} 1
+mm_network_monitor_probe_success{host="geoip.maxmind.com",probe="http"} 1
+mm_network_monitor_probe_success{host="updates.maxmind.com",probe="dns"} 1
+mm_network_monitor_probe_success{host="updates.maxmind.com",probe="tcp"} 0
+mm_network_monitor_probe_success{host="updates.maxmind.com",probe="tls"} 0
+mm_network_monitor_probe_success{host="updates.maxmind.com",probe="http"} 0
+# HELP mm_network_monitor_probe_duration_seconds Time taken by the probe.
+# TYPE mm_network_monitor_probe_duration_seconds gauge
+mm_network_monitor_probe_duration_seconds{host="geoip.maxmind.com",probe="dns"} 0.025
+mm_network_monitor_probe_duration_seconds{host="geoip.maxmind.com",probe="tcp"} 0.025
+mm_network_monitor_probe_duration_seconds{host="geoip.maxmind.com",probe="tls"} 0.025
+mm_network_monitor_probe_duration_seconds{host="geoip.maxmind.com",probe="http"} 0.12
+mm_network_monitor_probe_duration_seconds{host="updates.maxmind.com",probe="dns"} 0.025
+# HELP mm_network_monitor_http_status_code Status code of the HTTPS request.
+# TYPE mm_network_monitor_http_status_code gauge
+mm_network_monitor_http_status_code{host="geoip.maxmind.com"} 200
+# HELP mm_network_monitor_ping_loss_ratio Fraction of ICMP echo requests lost.
+# TYPE mm_network_monitor_ping_loss_ratio gauge
+mm_network_monitor_ping_loss_ratio{host="geoip.maxmind.com"} 0.25
+mm_network_monitor_ping_loss_ratio{host="updates.maxmind.com"} 1
+# HELP mm_network_monitor_ping_rtt_seconds Average round-trip time of the ICMP echo requests answered.
+# TYPE mm_network_monitor_ping_rtt_seconds gauge
+mm_network_monitor_ping_rtt_seconds{host="geoip.maxmind.com"} 0.0125
+`
+	if got := string(m.metrics()); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMetricsWriterQuotesLabels(t *testing.T) {
+	m := &monitor{latest: []*monitorSample{{Endpoint: &endpointHealth{Host: `a"b\c`}}}}
+	if want := `{host="a\"b\\c"}`; !strings.Contains(string(m.metrics()), want) {
+		t.Errorf("metrics do not contain %s:\n%s", want, m.metrics())
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	// Find a free port to serve on.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &monitor{rounds: 1}
+	if err := m.serveMetrics(ctx, addr); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.serveMetrics(ctx, addr); err == nil || !strings.Contains(err.Error(), "error listening on") {
+		t.Errorf("serving twice on %s = %v", addr, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(string(body), "mm_network_monitor_rounds_total 1\n") {
+		t.Errorf("body = %s", body)
+	}
+}
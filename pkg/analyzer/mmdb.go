@@ -0,0 +1,294 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// mmdbStaleAfter is the age after which a database is reported as stale.
+// MaxMind updates its databases at least weekly.
+const mmdbStaleAfter = 30 * 24 * time.Hour
+
+// mmdbDirs are where geoipupdate and the OS packages put databases by
+// default, in addition to the DatabaseDirectory of each GeoIP.conf.
+var mmdbDirs = []string{
+	"/usr/share/GeoIP",
+	"/usr/local/share/GeoIP",
+	"/var/lib/GeoIP",
+	"/opt/homebrew/var/GeoIP",
+}
+
+// mmdbMetadataMarker precedes the metadata section at the end of a MaxMind
+// DB file.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbMetadataMaxSize bounds how far from the end of the file the metadata
+// is searched for, as in the MaxMind DB specification.
+const mmdbMetadataMaxSize = 128 * 1024
+
+// mmdbInfo is the metadata of a MaxMind DB file.
+type mmdbInfo struct {
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	DatabaseType string    `json:"database_type,omitempty"`
+	BuildEpoch   uint64    `json:"build_epoch,omitempty"`
+	Built        time.Time `json:"built,omitzero"`
+	AgeDays      float64   `json:"age_days,omitempty"`
+	Stale        bool      `json:"stale"`
+	NodeCount    uint64    `json:"node_count,omitempty"`
+	RecordSize   uint64    `json:"record_size,omitempty"`
+	IPVersion    uint64    `json:"ip_version,omitempty"`
+	Languages    []string  `json:"languages,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// addMMDB records the metadata of each .mmdb file in mmdbDirs and in the
+// DatabaseDirectory of each GeoIP.conf and writes it to mmdb.json.
+func (a *analyzer) addMMDB(ctx context.Context) {
+	dirs := slices.Clone(mmdbDirs)
+	if d := os.Getenv("ProgramData"); d != "" {
+		dirs = append(dirs, filepath.Join(d, "MaxMind", "GeoIPUpdate", "GeoIP"))
+	}
+	for _, p := range findGeoIPConfs() {
+		contents, err := os.ReadFile(p) // nolint: gosec
+		if err != nil {
+			continue
+		}
+		if d := parseGeoIPConf(p, contents).DatabaseDirectory; d != "" && !slices.Contains(dirs, d) {
+			dirs = append(dirs, d)
+		}
+	}
+
+	dbs := []*mmdbInfo{}
+	for _, dir := range dirs {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.mmdb"))
+		for _, p := range paths {
+			info, err := readMMDBInfo(p, time.Now())
+			if err != nil {
+				a.storeError(ctx, err)
+				info.Error = err.Error()
+			}
+			dbs = append(dbs, info)
+		}
+	}
+
+	b, err := json.MarshalIndent(dbs, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding mmdb.json"))
+		return
+	}
+	a.storeFile("mmdb.json", b)
+	a.storeResult("mmdb", dbs)
+}
+
+// readMMDBInfo reads the metadata of the database at path. The returned
+// info is never nil.
+func readMMDBInfo(path string, now time.Time) (*mmdbInfo, error) {
+	info := &mmdbInfo{Path: path}
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return info, errors.Wrapf(err, "error opening %s", path)
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return info, errors.Wrapf(err, "error getting the size of %s", path)
+	}
+	info.Size = st.Size()
+
+	offset := max(info.Size-mmdbMetadataMaxSize, 0)
+	tail := make([]byte, info.Size-offset)
+	if _, err := f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return info, errors.Wrapf(err, "error reading %s", path)
+	}
+	i := bytes.LastIndex(tail, mmdbMetadataMarker)
+	if i < 0 {
+		return info, errors.Errorf("%s is not a MaxMind DB file", path)
+	}
+
+	d := &mmdbDecoder{buf: tail[i+len(mmdbMetadataMarker):]}
+	v, err := d.decode()
+	if err != nil {
+		return info, errors.Wrapf(err, "error decoding the metadata of %s", path)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return info, errors.Errorf("the metadata of %s is not a map", path)
+	}
+
+	info.DatabaseType, _ = m["database_type"].(string)
+	info.BuildEpoch, _ = m["build_epoch"].(uint64)
+	info.NodeCount, _ = m["node_count"].(uint64)
+	info.RecordSize, _ = m["record_size"].(uint64)
+	info.IPVersion, _ = m["ip_version"].(uint64)
+	if languages, ok := m["languages"].([]any); ok {
+		for _, l := range languages {
+			if s, ok := l.(string); ok {
+				info.Languages = append(info.Languages, s)
+			}
+		}
+	}
+	if info.BuildEpoch > 0 {
+		info.Built = time.Unix(int64(info.BuildEpoch), 0).UTC() // nolint: gosec
+		age := now.Sub(info.Built)
+		info.AgeDays = math.Round(age.Hours()/24*10) / 10
+		info.Stale = age > mmdbStaleAfter
+	}
+	return info, nil
+}
+
+// mmdbDecoder decodes the MaxMind DB data section format. It supports
+// everything that is used in the metadata, which has no pointers.
+type mmdbDecoder struct {
+	buf    []byte
+	offset int
+}
+
+// MaxMind DB data types.
+const (
+	mmdbPointer = 1
+	mmdbString  = 2
+	mmdbDouble  = 3
+	mmdbBytes   = 4
+	mmdbUint16  = 5
+	mmdbUint32  = 6
+	mmdbMap     = 7
+	mmdbInt32   = 8
+	mmdbUint64  = 9
+	mmdbUint128 = 10
+	mmdbArray   = 11
+	mmdbBoolean = 14
+	mmdbFloat   = 15
+)
+
+// mmdbMaxDepth bounds the nesting of maps and arrays so that a corrupt
+// file cannot exhaust the stack.
+const mmdbMaxDepth = 32
+
+func (d *mmdbDecoder) decode() (any, error) {
+	return d.decodeDepth(0)
+}
+
+func (d *mmdbDecoder) decodeDepth(depth int) (any, error) {
+	if depth > mmdbMaxDepth {
+		return nil, errors.New("data is nested too deeply")
+	}
+	ctrl, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	typ := int(ctrl[0] >> 5)
+	if typ == 0 {
+		ext, err := d.next(1)
+		if err != nil {
+			return nil, err
+		}
+		typ = 7 + int(ext[0])
+	}
+	if typ == mmdbPointer {
+		return nil, errors.New("unexpected pointer")
+	}
+
+	size := int(ctrl[0] & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, err := d.next(n)
+		if err != nil {
+			return nil, err
+		}
+		var extra int
+		for _, c := range b {
+			extra = extra<<8 | int(c)
+		}
+		size = []int{29, 285, 65821}[n-1] + extra
+	}
+
+	switch typ {
+	case mmdbMap:
+		m := make(map[string]any, size)
+		for range size {
+			k, err := d.decodeDepth(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, errors.New("map key is not a string")
+			}
+			if m[key], err = d.decodeDepth(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case mmdbArray:
+		a := make([]any, 0, size)
+		for range size {
+			v, err := d.decodeDepth(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case mmdbBoolean:
+		return size != 0, nil
+	}
+
+	b, err := d.next(size)
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case mmdbString:
+		return string(b), nil
+	case mmdbBytes:
+		return b, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, errors.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, errors.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbInt32:
+		if size > 8 {
+			return nil, errors.Errorf("invalid integer size %d", size)
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		if typ == mmdbInt32 {
+			return int64(int32(n)), nil // nolint: gosec
+		}
+		return n, nil
+	case mmdbUint128:
+		// None of the metadata fields we report are this large.
+		return b, nil
+	}
+	return nil, errors.Errorf("unknown data type %d", typ)
+}
+
+// next returns the next n bytes of the buffer.
+func (d *mmdbDecoder) next(n int) ([]byte, error) {
+	if n < 0 || d.offset+n > len(d.buf) {
+		return nil, errors.New("unexpected end of data")
+	}
+	b := d.buf[d.offset : d.offset+n]
+	d.offset += n
+	return b, nil
+}
@@ -0,0 +1,225 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// encodeMMDB encodes v in the MaxMind DB data section format. It supports
+// the types used in the metadata.
+func encodeMMDB(t *testing.T, v any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	control := func(typ, size int) {
+		var ext []byte
+		if size >= 29 {
+			ext = []byte{byte(size - 29)}
+			size = 29
+		}
+		if typ <= 7 {
+			buf.WriteByte(byte(typ<<5 | size))
+		} else {
+			buf.Write([]byte{byte(size), byte(typ - 7)})
+		}
+		buf.Write(ext)
+	}
+	switch v := v.(type) {
+	case string:
+		control(mmdbString, len(v))
+		buf.WriteString(v)
+	case uint16:
+		control(mmdbUint16, 2)
+		_ = binary.Write(&buf, binary.BigEndian, v)
+	case uint32:
+		control(mmdbUint32, 4)
+		_ = binary.Write(&buf, binary.BigEndian, v)
+	case uint64:
+		control(mmdbUint64, 8)
+		_ = binary.Write(&buf, binary.BigEndian, v)
+	case float64:
+		control(mmdbDouble, 8)
+		_ = binary.Write(&buf, binary.BigEndian, math.Float64bits(v))
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		control(mmdbBoolean, size)
+	case []any:
+		control(mmdbArray, len(v))
+		for _, e := range v {
+			buf.Write(encodeMMDB(t, e))
+		}
+	case map[string]any:
+		control(mmdbMap, len(v))
+		for k, e := range v {
+			buf.Write(encodeMMDB(t, k))
+			buf.Write(encodeMMDB(t, e))
+		}
+	default:
+		t.Fatalf("cannot encode %T", v)
+	}
+	return buf.Bytes()
+}
+
+// writeTestMMDB writes a database with the metadata to dir and returns its
+// path. The search tree and data section are not valid.
+func writeTestMMDB(t *testing.T, dir, name string, metadata map[string]any) string {
+	t.Helper()
+	contents := append(bytes.Repeat([]byte{0}, 1024), mmdbMetadataMarker...)
+	contents = append(contents, encodeMMDB(t, metadata)...)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, contents, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testMMDBMetadata(built time.Time) map[string]any {
+	return map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 uint64(built.Unix()),
+		"database_type":               "GeoIP2-City",
+		"description":                 map[string]any{"en": "GeoIP2 City database with a description over 29 bytes"},
+		"ip_version":                  uint16(6),
+		"languages":                   []any{"de", "en"},
+		"node_count":                  uint32(3000000),
+		"record_size":                 uint16(28),
+	}
+}
+
+func TestReadMMDBInfo(t *testing.T) {
+	built := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	path := writeTestMMDB(t, t.TempDir(), "GeoIP2-City.mmdb", testMMDBMetadata(built))
+
+	info, err := readMMDBInfo(path, built.Add(45*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := os.Stat(path)
+	want := &mmdbInfo{
+		Path:         path,
+		Size:         st.Size(),
+		DatabaseType: "GeoIP2-City",
+		BuildEpoch:   uint64(built.Unix()),
+		Built:        built,
+		AgeDays:      45,
+		Stale:        true,
+		NodeCount:    3000000,
+		RecordSize:   28,
+		IPVersion:    6,
+		Languages:    []string{"de", "en"},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("readMMDBInfo = %+v, want %+v", info, want)
+	}
+
+	if info, _ := readMMDBInfo(path, built.Add(36*time.Hour)); info.Stale || info.AgeDays != 1.5 {
+		t.Errorf("a new database is %.1f days old and stale: %t", info.AgeDays, info.Stale)
+	}
+}
+
+func TestReadMMDBInfoErrors(t *testing.T) {
+	dir := t.TempDir()
+	notMMDB := filepath.Join(dir, "GeoIP.dat")
+	if err := os.WriteFile(notMMDB, []byte("legacy GeoIP database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated.mmdb")
+	metadata := encodeMMDB(t, map[string]any{"database_type": "GeoIP2-City"})
+	contents := append(bytes.Clone(mmdbMetadataMarker), metadata...)
+	if err := os.WriteFile(truncated, contents[:len(contents)-3], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		filepath.Join(dir, "missing.mmdb"): "error opening",
+		notMMDB:                            "is not a MaxMind DB file",
+		truncated:                          "unexpected end of data",
+	} {
+		info, err := readMMDBInfo(path, time.Now())
+		if err == nil || !strings.Contains(err.Error(), want) || info.Path != path {
+			t.Errorf("readMMDBInfo(%s) = %+v, %v, want %q", path, info, err, want)
+		}
+	}
+}
+
+func TestMMDBDecoder(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want any
+	}{
+		{encodeMMDB(t, 1.5), 1.5},
+		{encodeMMDB(t, true), true},
+		{encodeMMDB(t, strings.Repeat("x", 200)), strings.Repeat("x", 200)},
+		// An int32 is sign extended.
+		{[]byte{0x04, 0x01, 0xff, 0xff, 0xff, 0xfe}, int64(-2)},
+		// A float.
+		{[]byte{0x04, 0x08, 0x3f, 0xc0, 0x00, 0x00}, 1.5},
+	}
+	for _, test := range tests {
+		d := &mmdbDecoder{buf: test.data}
+		if got, err := d.decode(); err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("decode(% x) = %v, %v, want %v", test.data, got, err, test.want)
+		}
+	}
+
+	nested := bytes.Repeat([]byte{0x01, 0x04}, mmdbMaxDepth+2)
+	for data, want := range map[string]string{
+		"\x20":         "unexpected pointer",
+		string(nested): "nested too deeply",
+		"\xe1\xa0":     "map key is not a string",
+		"\x00\x05":     "unknown data type 12",
+		"\x62\x00\x00": "invalid double size 2",
+		"\x44abc":      "unexpected end of data",
+	} {
+		d := &mmdbDecoder{buf: []byte(data)}
+		if _, err := d.decode(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("decode(% x) = %v, want %q", data, err, want)
+		}
+	}
+}
+
+func TestAddMMDB(t *testing.T) {
+	shareDir := t.TempDir()
+	confDir := t.TempDir()
+	dirs := mmdbDirs
+	mmdbDirs = []string{shareDir}
+	defer func() { mmdbDirs = dirs }()
+	// The DatabaseDirectory of GeoIP.conf is searched too.
+	useGeoIPConf(t, "DatabaseDirectory "+confDir+"\n")
+
+	now := time.Now()
+	fresh := writeTestMMDB(t, shareDir, "GeoLite2-ASN.mmdb", testMMDBMetadata(now.Add(-48*time.Hour)))
+	stale := writeTestMMDB(t, confDir, "GeoIP2-City.mmdb", testMMDBMetadata(now.Add(-90*24*time.Hour)))
+	if err := os.WriteFile(filepath.Join(confDir, "README.txt"), []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.addMMDB(context.Background())
+
+	dbs, ok := a.results["mmdb"].([]*mmdbInfo)
+	if !ok || len(dbs) != 2 || dbs[0].Path != fresh || dbs[1].Path != stale || dbs[0].Stale || !dbs[1].Stale {
+		t.Fatalf("results = %#v", a.results["mmdb"])
+	}
+	if !bytes.Contains(storedContents(t, a, "mmdb.json"), []byte(`"database_type": "GeoIP2-City"`)) {
+		t.Error("mmdb.json does not have the metadata")
+	}
+
+	fs := findingsFor(map[string]interface{}{"mmdb": dbs})
+	if len(fs) != 1 || fs[0].Check != "mmdb-stale" ||
+		!strings.HasPrefix(fs[0].Summary, stale+" (GeoIP2-City) was built 90 days ago") {
+		t.Errorf("findings = %+v", fs)
+	}
+}
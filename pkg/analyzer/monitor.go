@@ -0,0 +1,349 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMonitorInterval  = 5 * time.Minute
+	defaultMonitorRetention = 7 * 24 * time.Hour
+	defaultMonitorDir       = "mm-network-monitor"
+	// monitorPingCount is kept small so that a round finishes well within
+	// the interval.
+	monitorPingCount = 5
+
+	monitorFilePrefix = "samples-"
+	monitorFileSuffix = ".jsonl"
+	monitorDayLayout  = "20060102"
+)
+
+// monitorSample is the result of one round of the monitor's probes against
+// a host.
+type monitorSample struct {
+	Time     time.Time       `json:"time"`
+	Endpoint *endpointHealth `json:"endpoint"`
+	Ping     *pingReport     `json:"ping"`
+}
+
+// monitor runs a reduced set of probes on an interval and appends the
+// results to a file per UTC day in dir. Files older than retention are
+// removed.
+type monitor struct {
+	dir       string
+	hosts     []string
+	retention time.Duration
+
+	// mu guards latest and rounds, which are served as metrics.
+	mu     sync.Mutex
+	latest []*monitorSample
+	rounds int
+}
+
+// runMonitor implements the monitor command, which probes the hosts until
+// interrupted or, with --package, writes the accumulated history to an
+// archive.
+func runMonitor(args []string) int {
+	fs := flag.NewFlagSet("monitor", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s monitor [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	var hosts stringSliceFlag
+	fs.Var(&hosts, "host", "Host to probe. May be repeated or comma separated. (default "+defaultHost+")")
+	interval := fs.Duration("interval", defaultMonitorInterval, "Time between rounds of probes")
+	dir := fs.String("data-dir", defaultMonitorDir, "Directory to store the samples in")
+	retention := fs.Duration("retention", defaultMonitorRetention, "Remove samples older than this")
+	pkg := fs.String(
+		"package",
+		"",
+		"Write the samples in --data-dir and a summary of them to this archive and exit",
+	)
+	format := fs.String("format", FormatZip, "Archive format for --package: "+FormatZip+" or "+FormatTarGz)
+	var maxSize byteSize
+	fs.Var(&maxSize, "max-archive-size", "Split the --package archive into numbered parts of at most this size")
+	metricsAddr := fs.String(
+		"metrics-addr",
+		"",
+		"Serve the latest results as Prometheus metrics on this address, e.g., localhost:9464",
+	)
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if len(hosts) == 0 {
+		hosts = stringSliceFlag{defaultHost}
+	}
+
+	m := &monitor{dir: *dir, hosts: hosts, retention: *retention}
+	if *pkg != "" {
+		paths, err := m.writePackage(*format, *pkg, int64(maxSize))
+		if err != nil {
+			slog.Error(err.Error())
+			return exitArchiveFailed
+		}
+		fmt.Printf("Monitoring history written to %s\n", strings.Join(paths, ", "))
+		return exitOK
+	}
+	if *interval <= 0 {
+		fatal(errors.New("--interval must be positive"))
+	}
+	if err := os.MkdirAll(m.dir, 0o750); err != nil {
+		fatal(errors.Wrapf(err, "error creating %s", m.dir))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *metricsAddr != "" {
+		if err := m.serveMetrics(ctx, *metricsAddr); err != nil {
+			fatal(err)
+		}
+	}
+	slog.Info("monitoring", "hosts", strings.Join(m.hosts, ","), "interval", interval.String(), "data_dir", m.dir)
+	for {
+		start := time.Now()
+		samples := m.probe(ctx)
+		m.mu.Lock()
+		m.latest = samples
+		m.rounds++
+		m.mu.Unlock()
+		if err := m.record(samples); err != nil {
+			slog.Error(err.Error())
+		}
+		if err := m.prune(start); err != nil {
+			slog.Error(err.Error())
+		}
+		if sleepContext(ctx, time.Until(start.Add(*interval))) != nil {
+			return exitOK
+		}
+	}
+}
+
+// probe runs one round of probes against each host at once.
+func (m *monitor) probe(ctx context.Context) []*monitorSample {
+	samples := make([]*monitorSample, len(m.hosts))
+	var wg sync.WaitGroup
+	for i, host := range m.hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			s := &monitorSample{Time: time.Now().UTC(), Endpoint: checkEndpoint(ctx, host)}
+			result, err := ping(ctx, "ip4", host, monitorPingCount, defaultPingInterval)
+			s.Ping = result.report(host, err)
+			samples[i] = s
+		}(i, host)
+	}
+	wg.Wait()
+	return samples
+}
+
+// record appends samples to the file for the current day.
+func (m *monitor) record(samples []*monitorSample) error {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, s := range samples {
+		if err := enc.Encode(s); err != nil {
+			return errors.Wrap(err, "error encoding monitor sample")
+		}
+	}
+
+	path := filepath.Join(m.dir, monitorFilePrefix+time.Now().UTC().Format(monitorDayLayout)+monitorFileSuffix)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640) // nolint: gosec
+	if err != nil {
+		return errors.Wrapf(err, "error opening %s", path)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		_ = f.Close()
+		return errors.Wrapf(err, "error writing %s", path)
+	}
+	return errors.Wrapf(f.Close(), "error closing %s", path)
+}
+
+// prune removes the files for days that ended more than the retention
+// period before now.
+func (m *monitor) prune(now time.Time) error {
+	files, err := m.files()
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		day, err := time.Parse(
+			monitorDayLayout,
+			strings.TrimSuffix(strings.TrimPrefix(name, monitorFilePrefix), monitorFileSuffix),
+		)
+		if err != nil || now.Sub(day.AddDate(0, 0, 1)) <= m.retention {
+			continue
+		}
+		path := filepath.Join(m.dir, name)
+		if err := os.Remove(path); err != nil {
+			return errors.Wrapf(err, "error removing %s", path)
+		}
+	}
+	return nil
+}
+
+// writeSampleFile streams the named sample file into w and returns it
+// opened at the start so that it may be summarized.
+func (m *monitor) writeSampleFile(w ArchiveWriter, name string, modified time.Time) (*os.File, error) {
+	f, err := os.Open(filepath.Join(m.dir, name)) // nolint: gosec
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening %s", name)
+	}
+	fi, err := f.Stat()
+	if err == nil {
+		err = writeArchiveFile(w, name, f, fi.Size(), modified)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, errors.Wrapf(err, "error writing %s", name)
+	}
+	return f, nil
+}
+
+// files returns the names of the sample files in the data directory,
+// oldest first.
+func (m *monitor) files() ([]string, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", m.dir)
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, monitorFilePrefix) && strings.HasSuffix(name, monitorFileSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// monitorSummary summarizes the samples of a single host so that periods
+// of failure or high latency stand out without reading every sample.
+type monitorSummary struct {
+	Host    string    `json:"host"`
+	Samples int       `json:"samples"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	// The failures count the samples in which each probe failed.
+	DNSFailures  int `json:"dns_failures"`
+	TCPFailures  int `json:"tcp_failures"`
+	TLSFailures  int `json:"tls_failures"`
+	HTTPFailures int `json:"http_failures"`
+	// PingLossSamples is the number of samples that lost at least one ping.
+	PingLossSamples int           `json:"ping_loss_samples"`
+	HTTPMS          *distribution `json:"http_ms,omitempty"`
+	PingAvgMS       *distribution `json:"ping_avg_ms,omitempty"`
+}
+
+// writePackage writes every sample file and monitor-summary.json to an
+// archive at path, split into parts of at most limit bytes if it is
+// non-zero. It returns the paths written.
+func (m *monitor) writePackage(format, path string, limit int64) ([]string, error) {
+	files, err := m.files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("there are no samples in %s", m.dir)
+	}
+
+	w, err := newArchive(format, path, archiveOptions{limit: limit, level: flate.DefaultCompression})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	summaries := map[string]*monitorSummary{}
+	httpMS, pingMS := map[string][]float64{}, map[string][]float64{}
+	for _, name := range files {
+		f, err := m.writeSampleFile(w, name, now)
+		if err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			var s monitorSample
+			// A line cut short by an interrupted write is skipped.
+			if json.Unmarshal(scanner.Bytes(), &s) != nil || s.Endpoint == nil {
+				continue
+			}
+			host := s.Endpoint.Host
+			sum := summaries[host]
+			if sum == nil {
+				sum = &monitorSummary{Host: host, First: s.Time}
+				summaries[host] = sum
+			}
+			sum.add(&s)
+			if s.Endpoint.HTTP.OK {
+				httpMS[host] = append(httpMS[host], s.Endpoint.HTTP.DurationMS)
+			}
+			if s.Ping != nil && s.Ping.Received > 0 {
+				pingMS[host] = append(pingMS[host], s.Ping.AvgMS)
+			}
+		}
+		_ = f.Close()
+	}
+
+	var list []*monitorSummary
+	for _, host := range sortedKeys(summaries) {
+		sum := summaries[host]
+		sum.HTTPMS = newDistribution(httpMS[host])
+		sum.PingAvgMS = newDistribution(pingMS[host])
+		list = append(list, sum)
+	}
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		_ = w.Close()
+		return nil, errors.Wrap(err, "error encoding monitor-summary.json")
+	}
+	if err := w.WriteFile("monitor-summary.json", b, now); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	return archivePaths(w, path), w.Close()
+}
+
+func (sum *monitorSummary) add(s *monitorSample) {
+	sum.Samples++
+	sum.Last = s.Time
+	// checkEndpoint stops at the first failure, so only that probe is
+	// counted.
+	e := s.Endpoint
+	switch {
+	case !e.DNS.OK:
+		sum.DNSFailures++
+	case !e.TCP.OK:
+		sum.TCPFailures++
+	case !e.TLS.OK:
+		sum.TLSFailures++
+	case !e.HTTP.OK:
+		sum.HTTPFailures++
+	}
+	if s.Ping != nil && s.Ping.Sent > 0 && s.Ping.Received < s.Ping.Sent {
+		sum.PingLossSamples++
+	}
+}
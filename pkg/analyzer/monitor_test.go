@@ -0,0 +1,140 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitorRecordAndPrune(t *testing.T) {
+	m := &monitor{dir: t.TempDir(), retention: 48 * time.Hour}
+	samples := []*monitorSample{
+		{Endpoint: &endpointHealth{Host: "geoip.maxmind.com"}},
+		{Endpoint: &endpointHealth{Host: "updates.maxmind.com"}},
+	}
+	for range 2 {
+		if err := m.record(samples); err != nil {
+			t.Fatal(err)
+		}
+	}
+	today := monitorFilePrefix + time.Now().UTC().Format(monitorDayLayout) + monitorFileSuffix
+	b, err := os.ReadFile(filepath.Join(m.dir, today)) // nolint: gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(b), "\n"); lines != 4 {
+		t.Errorf("%s has %d lines", today, lines)
+	}
+
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, name := range []string{"samples-20240307.jsonl", "samples-20240308.jsonl", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(m.dir, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The 7th ended more than two days before now, but the 8th did not.
+	if err := m.prune(now); err != nil {
+		t.Fatal(err)
+	}
+	files, err := m.files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"samples-20240308.jsonl", today}; !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+	if _, err := os.Stat(filepath.Join(m.dir, "notes.txt")); err != nil {
+		t.Errorf("a file that is not a sample file was removed: %v", err)
+	}
+}
+
+func TestMonitorWritePackage(t *testing.T) {
+	m := &monitor{dir: t.TempDir()}
+	if _, err := m.writePackage(FormatZip, filepath.Join(t.TempDir(), "empty.zip"), 0); err == nil ||
+		!strings.Contains(err.Error(), "there are no samples") {
+		t.Errorf("packaging without samples = %v", err)
+	}
+
+	ok := endpointCheck{OK: true, DurationMS: 50}
+	start := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	samples := []*monitorSample{
+		{
+			Time:     start,
+			Endpoint: &endpointHealth{Host: "geoip.maxmind.com", DNS: ok, TCP: ok, TLS: ok, HTTP: ok},
+			Ping:     &pingReport{Sent: 5, Received: 5, AvgMS: 10},
+		},
+		{
+			Time:     start.Add(5 * time.Minute),
+			Endpoint: &endpointHealth{Host: "geoip.maxmind.com", DNS: ok, TCP: ok},
+			Ping:     &pingReport{Sent: 5, Received: 3, AvgMS: 20},
+		},
+		{
+			Time:     start.Add(10 * time.Minute),
+			Endpoint: &endpointHealth{Host: "geoip.maxmind.com"},
+			Ping:     &pingReport{Sent: 5},
+		},
+	}
+	var lines []string
+	for _, s := range samples {
+		b, err := json.Marshal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(b))
+	}
+	// A line cut short by an interrupted write is skipped.
+	contents := strings.Join(lines, "\n") + "\n" + `{"time":"2024-03-10T12:15:00Z","endp`
+	if err := os.WriteFile(filepath.Join(m.dir, "samples-20240310.jsonl"), []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "monitor.zip")
+	paths, err := m.writePackage(FormatZip, path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(paths, []string{path}) {
+		t.Errorf("paths = %v", paths)
+	}
+	files := readArchive(t, FormatZip, path)
+	if files["samples-20240310.jsonl"] != contents {
+		t.Errorf("samples-20240310.jsonl = %q", files["samples-20240310.jsonl"])
+	}
+	var summaries []*monitorSummary
+	if err := json.Unmarshal([]byte(files["monitor-summary.json"]), &summaries); err != nil {
+		t.Fatal(err)
+	}
+	want := []*monitorSummary{{
+		Host:            "geoip.maxmind.com",
+		Samples:         3,
+		First:           start,
+		Last:            start.Add(10 * time.Minute),
+		DNSFailures:     1,
+		TLSFailures:     1,
+		PingLossSamples: 2,
+		HTTPMS:          &distribution{Count: 1, MinMS: 50, P50MS: 50, P95MS: 50, P99MS: 50, MaxMS: 50},
+		PingAvgMS:       &distribution{Count: 2, MinMS: 10, P50MS: 10, P95MS: 20, P99MS: 20, MaxMS: 20},
+	}}
+	if !reflect.DeepEqual(summaries, want) {
+		b, _ := json.Marshal(summaries)
+		t.Errorf("summaries = %s", b)
+	}
+}
+
+func TestMonitorProbe(t *testing.T) {
+	// .invalid names never resolve (RFC 6761).
+	m := &monitor{hosts: []string{"monitor.invalid"}}
+	samples := m.probe(context.Background())
+	if len(samples) != 1 || samples[0].Time.IsZero() {
+		t.Fatalf("samples = %+v", samples)
+	}
+	s := samples[0]
+	if s.Endpoint.Host != "monitor.invalid" || s.Endpoint.DNS.OK || s.Ping.Error == "" {
+		t.Errorf("sample = %+v, %+v", s.Endpoint, s.Ping)
+	}
+}
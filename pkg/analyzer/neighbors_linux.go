@@ -0,0 +1,23 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// createProcARPTask returns a task that stores the IPv4 neighbor table from
+// /proc/net/arp. It is the fallback for ip neigh. The kernel does not
+// expose the IPv6 neighbor table in /proc.
+func (a *analyzer) createProcARPTask(f string) *task {
+	return newTask(f, func(ctx context.Context) {
+		b, err := os.ReadFile("/proc/net/arp")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+			return
+		}
+		a.storeFile(f, b)
+	}).withTags(tagLocal).
+		withDescription("Reads the IPv4 neighbor table from /proc/net/arp")
+}
@@ -0,0 +1,95 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// netplanDir holds the netplan configuration.
+const netplanDir = "/etc/netplan"
+
+// netplanSecret matches the netplan keys whose values are secrets, such as
+// Wi-Fi passwords and 802.1X credentials.
+var netplanSecret = regexp.MustCompile(`(?im)^(\s*-?\s*(?:password|psk|key|secret|identity|` +
+	`anonymous-identity|client-key-password|private-key|preshared-key)\s*:\s*)\S.*$`)
+
+// netConfigTasks returns the tasks that collect the NetworkManager and
+// netplan configuration, which is where the DNS servers and routes we see
+// usually come from, for whichever of them are in use. planDir is normally
+// netplanDir.
+func (a *analyzer) netConfigTasks(planDir string) []*task {
+	var tasks []*task
+	if _, err := exec.LookPath("nmcli"); err == nil {
+		tasks = append(tasks,
+			a.createStoreCommand("nmcli-device-show.txt", "nmcli", "device", "show").withTags(tagLocal),
+			a.createNMConnectionsTask("nmcli-connection-show.txt"),
+		)
+	}
+	if _, err := os.Stat(planDir); err == nil {
+		tasks = append(tasks, a.createNetplanTask("netplan.txt", planDir))
+	}
+	return tasks
+}
+
+// createNMConnectionsTask returns a task that stores the settings of each
+// active NetworkManager connection. nmcli hides secrets unless
+// --show-secrets is given.
+func (a *analyzer) createNMConnectionsTask(f string) *task {
+	t := newTask(f, func(ctx context.Context) {
+		out, err := commandContext(ctx, "nmcli", "-t", "-f", "UUID", "connection", "show", "--active").Output()
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+			return
+		}
+		buf := new(bytes.Buffer)
+		for _, uuid := range strings.Fields(string(out)) {
+			fmt.Fprintf(buf, "# nmcli connection show %s\n", uuid)
+			details, err := commandContext(ctx, "nmcli", "connection", "show", uuid).CombinedOutput()
+			buf.Write(details)
+			if err != nil {
+				a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+				fmt.Fprintf(buf, "# %v\n", err)
+			}
+			fmt.Fprintln(buf)
+		}
+		a.storeFile(f, buf.Bytes())
+	}).withTags(tagLocal).
+		withDescription("Runs `nmcli connection show` for each active connection").
+		withTools("nmcli")
+	t.command = []string{"nmcli", "connection", "show"}
+	return t
+}
+
+// createNetplanTask returns a task that stores the netplan YAML files in
+// planDir with their secrets redacted.
+func (a *analyzer) createNetplanTask(f, planDir string) *task {
+	return newTask(f, func(ctx context.Context) {
+		paths, err := filepath.Glob(filepath.Join(planDir, "*.yaml"))
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+			return
+		}
+		buf := new(bytes.Buffer)
+		for _, path := range paths {
+			fmt.Fprintf(buf, "# %s\n", path)
+			b, err := os.ReadFile(path)
+			if err != nil {
+				a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+				fmt.Fprintf(buf, "# %v\n\n", err)
+				continue
+			}
+			buf.Write(netplanSecret.ReplaceAll(b, []byte("${1}<redacted>")))
+			fmt.Fprintln(buf)
+		}
+		a.storeFile(f, buf.Bytes())
+	}).withTags(tagLocal).
+		withDescription("Copies the netplan configuration in %s with secrets redacted", planDir)
+}
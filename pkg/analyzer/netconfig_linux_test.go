@@ -0,0 +1,78 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNetplanTask(t *testing.T) {
+	planDir := t.TempDir()
+
+	config := `network:
+  version: 2
+  wifis:
+    wlan0:
+      dhcp4: true
+      access-points:
+        "home":
+          password: "correct horse battery staple"
+          auth:
+            key-management: eap
+            identity: user@example.com
+            anonymous-identity: anonymous@example.com
+            client-key-password: hunter2
+  ethernets:
+    eth0:
+      nameservers:
+        addresses: [192.0.2.53]
+`
+	if err := os.WriteFile(filepath.Join(planDir, "50-cloud-init.yaml"), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.createNetplanTask("netplan.txt", planDir).run(context.Background())
+	if a.hasErrors() {
+		t.Fatalf("errors: %v", a.errors)
+	}
+	want := "# " + filepath.Join(planDir, "50-cloud-init.yaml") + `
+network:
+  version: 2
+  wifis:
+    wlan0:
+      dhcp4: true
+      access-points:
+        "home":
+          password: <redacted>
+          auth:
+            key-management: eap
+            identity: <redacted>
+            anonymous-identity: <redacted>
+            client-key-password: <redacted>
+  ethernets:
+    eth0:
+      nameservers:
+        addresses: [192.0.2.53]
+
+`
+	if got := string(storedContents(t, a, "netplan.txt")); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestNetConfigTasks(t *testing.T) {
+	planDir := t.TempDir()
+	t.Setenv("PATH", t.TempDir())
+
+	tasks := (&analyzer{}).netConfigTasks(planDir)
+	if len(tasks) != 1 || tasks[0].name != "netplan" {
+		t.Errorf("tasks without nmcli = %+v", tasks)
+	}
+
+	if tasks := (&analyzer{}).netConfigTasks(filepath.Join(planDir, "missing")); tasks != nil {
+		t.Errorf("tasks without nmcli or netplan = %+v", tasks)
+	}
+}
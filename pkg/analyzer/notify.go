@@ -0,0 +1,81 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const notifyTimeout = 30 * time.Second
+
+// notification is the body POSTed to --notify-url when a run finishes.
+type notification struct {
+	// Text is a one-line summary. Slack and Teams incoming webhooks
+	// display it as the message.
+	Text      string     `json:"text"`
+	Host      string     `json:"host,omitempty"`
+	Reference string     `json:"reference,omitempty"`
+	Archive   string     `json:"archive,omitempty"`
+	ExitCode  int        `json:"exit_code"`
+	Findings  []*Finding `json:"findings"`
+	Errors    []string   `json:"errors,omitempty"`
+}
+
+// notify POSTs a summary of the run to url. With --redact, the host name,
+// errors, and findings are redacted as they are in the archive.
+func (a *analyzer) notify(url, archive string, findings []*Finding, code int) error {
+	n := &notification{
+		Archive:   a.scrubString(archive),
+		Reference: a.reference,
+		ExitCode:  code,
+		Findings:  []*Finding{},
+	}
+	for _, f := range findings {
+		scrubbed := *f
+		scrubbed.Summary = a.scrubString(f.Summary)
+		n.Findings = append(n.Findings, &scrubbed)
+	}
+	n.Host = a.hostname()
+	a.errorsMutex.Lock()
+	for _, err := range a.errors {
+		n.Errors = append(n.Errors, a.scrubString(err.err.Error()))
+	}
+	a.errorsMutex.Unlock()
+
+	status := "finished"
+	if archive == "" {
+		status = "failed to write its archive"
+	}
+	n.Text = fmt.Sprintf(
+		"mm-network-analyzer on %s %s with %d findings and %d errors",
+		n.Host, status, len(findings), len(n.Errors),
+	)
+	if a.reference != "" {
+		n.Text += " for " + a.reference
+	}
+	if archive != "" {
+		n.Text += ": " + n.Archive
+	}
+	n.Text = a.scrubString(n.Text)
+
+	b, err := json.Marshal(n)
+	if err != nil {
+		return errors.Wrap(err, "error encoding notification")
+	}
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(b)) // nolint: noctx
+	if err != nil {
+		return errors.Wrap(err, "error sending notification")
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("notification failed with %s", resp.Status)
+	}
+	return nil
+}
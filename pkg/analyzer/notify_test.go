@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNotify(t *testing.T) {
+	var (
+		contentType string
+		body        []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s", r.Method)
+		}
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	a := &analyzer{reference: "TICKET-123"}
+	a.storeTaskError("ntp", errors.New("i/o timeout"))
+	findings := []*Finding{{Severity: severityWarning, Check: "clock-offset", Summary: "The clock is off"}}
+	if err := a.notify(server.URL, "/tmp/mm-network-analysis.zip", findings, 1); err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/json" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	want := "mm-network-analyzer on " + host + " finished with 1 findings and 1 errors for TICKET-123: " +
+		"/tmp/mm-network-analysis.zip"
+	if n.Text != want {
+		t.Errorf("text = %q, want %q", n.Text, want)
+	}
+	if n.Host != host || n.Reference != "TICKET-123" || n.ExitCode != 1 || n.Archive != "/tmp/mm-network-analysis.zip" {
+		t.Errorf("notification = %+v", n)
+	}
+	if len(n.Findings) != 1 || n.Findings[0].Check != "clock-offset" {
+		t.Errorf("findings = %+v", n.Findings)
+	}
+	if len(n.Errors) != 1 || n.Errors[0] != "i/o timeout" {
+		t.Errorf("errors = %v", n.Errors)
+	}
+}
+
+func TestNotifyRedacts(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	r, err := newRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &analyzer{redactor: r}
+	a.storeTaskError("ntp", errors.New("dial udp 192.168.1.20:123: i/o timeout"))
+	findings := []*Finding{{Severity: severityError, Check: "dns-no-response", Summary: "192.168.1.53 did not answer"}}
+	if err := a.notify(server.URL, "/tmp/mm-network-analysis.zip", findings, 1); err != nil {
+		t.Fatal(err)
+	}
+	if findings[0].Summary != "192.168.1.53 did not answer" {
+		t.Errorf("the finding was redacted in place: %q", findings[0].Summary)
+	}
+
+	var n notification
+	if err := json.Unmarshal(body, &n); err != nil {
+		t.Fatal(err)
+	}
+	if len(n.Errors) != 1 || n.Errors[0] != "dial udp [REDACTED-PRIVATE-IP]:123: i/o timeout" {
+		t.Errorf("errors = %q", n.Errors)
+	}
+	if len(n.Findings) != 1 || n.Findings[0].Summary != "[REDACTED-PRIVATE-IP] did not answer" {
+		t.Errorf("findings = %+v", n.Findings)
+	}
+	host, _ := os.Hostname()
+	if host == "" || host == "localhost" {
+		return
+	}
+	if n.Host != "[REDACTED-HOSTNAME]" || strings.Contains(string(body), host) {
+		t.Errorf("the host name was not redacted: %s", body)
+	}
+	if want := "mm-network-analyzer on [REDACTED-HOSTNAME] finished"; !strings.HasPrefix(n.Text, want) {
+		t.Errorf("text = %q, want the prefix %q", n.Text, want)
+	}
+}
+
+func TestNotifyWithoutArchive(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	a := &analyzer{}
+	if err := a.notify(server.URL, "", nil, 2); err != nil {
+		t.Fatal(err)
+	}
+	var n map[string]any
+	if err := json.Unmarshal(body, &n); err != nil {
+		t.Fatal(err)
+	}
+	text, _ := n["text"].(string)
+	if !strings.HasSuffix(text, " failed to write its archive with 0 findings and 0 errors") {
+		t.Errorf("text = %q", text)
+	}
+	// The findings are always a list so that receivers need not check for
+	// null.
+	if findings, ok := n["findings"].([]any); !ok || len(findings) != 0 {
+		t.Errorf("findings = %v", n["findings"])
+	}
+	for _, key := range []string{"archive", "reference", "errors"} {
+		if _, ok := n[key]; ok {
+			t.Errorf("%s is set: %s", key, body)
+		}
+	}
+}
+
+func TestNotifyFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "no such hook", http.StatusNotFound)
+	}))
+	a := &analyzer{}
+	err := a.notify(server.URL, "", nil, 0)
+	if err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("notifying a missing hook = %v", err)
+	}
+
+	// Nothing is listening once the server is closed.
+	server.Close()
+	err = a.notify(server.URL, "", nil, 0)
+	if err == nil || !strings.Contains(err.Error(), "error sending notification") {
+		t.Errorf("notifying a closed server = %v", err)
+	}
+}
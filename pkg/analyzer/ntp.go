@@ -0,0 +1,148 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const ntpTimeout = 5 * time.Second
+
+// ntpServers are public NTP services run by different operators, so that
+// one being wrong or blocked is apparent.
+var ntpServers = []string{
+	"time.cloudflare.com",
+	"time.google.com",
+	"pool.ntp.org",
+}
+
+// ntpEpochOffset is the number of seconds between the NTP epoch, 1900, and
+// the Unix epoch.
+const ntpEpochOffset = 2208988800
+
+// ntpSample is the local clock's offset from one NTP server. A positive
+// offset means that the local clock is behind.
+type ntpSample struct {
+	Server   string  `json:"server"`
+	Address  string  `json:"address,omitempty"`
+	Stratum  int     `json:"stratum,omitempty"`
+	OffsetMS float64 `json:"offset_ms"`
+	RTTMS    float64 `json:"rtt_ms,omitempty"`
+	Error    string  `json:"error,omitempty"`
+}
+
+type ntpReport struct {
+	Samples []*ntpSample `json:"samples"`
+	// OffsetMS is the median offset of the servers that answered.
+	OffsetMS *float64 `json:"offset_ms,omitempty"`
+}
+
+func (a *analyzer) addNTP(ctx context.Context) {
+	r := &ntpReport{}
+	var offsets []float64
+	for _, server := range ntpServers {
+		s := queryNTP(ctx, server)
+		r.Samples = append(r.Samples, s)
+		if s.Error != "" {
+			a.storeError(ctx, errors.Errorf("error querying NTP server %s: %s", server, s.Error))
+			continue
+		}
+		offsets = append(offsets, s.OffsetMS)
+	}
+	if len(offsets) > 0 {
+		slices.Sort(offsets)
+		median := offsets[len(offsets)/2]
+		r.OffsetMS = &median
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding ntp.json"))
+		return
+	}
+	a.storeFile("ntp.json", b)
+	a.storeResult("ntp", r)
+}
+
+// queryNTP sends a single SNTP (RFC 4330) request to server.
+func queryNTP(ctx context.Context, server string) *ntpSample {
+	return queryNTPAt(ctx, server, net.JoinHostPort(server, "123"))
+}
+
+// queryNTPAt is queryNTP sending the request to addr.
+func queryNTPAt(ctx context.Context, server, addr string) *ntpSample {
+	dial := dialConfigFromContext(ctx)
+	s := &ntpSample{Server: server}
+
+	ctx, cancel := context.WithTimeout(ctx, ntpTimeout)
+	defer cancel()
+
+	dialer := dial.newDialer("udp")
+	conn, err := dialer.DialContext(ctx, dial.restrictNetwork("udp"), addr)
+	if err != nil {
+		s.Error = err.Error()
+		return s
+	}
+	defer conn.Close()
+	s.Address = conn.RemoteAddr().String()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	// LI = 0, VN = 4, Mode = 3 (client). The transmit timestamp is echoed
+	// back as the originate timestamp, which lets us match the response.
+	req := make([]byte, 48)
+	req[0] = 0x23
+	sent := time.Now()
+	binary.BigEndian.PutUint64(req[40:], toNTPTime(sent))
+	if _, err := conn.Write(req); err != nil {
+		s.Error = err.Error()
+		return s
+	}
+
+	resp := make([]byte, 48)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			s.Error = err.Error()
+			return s
+		}
+		if n >= 48 && binary.BigEndian.Uint64(resp[24:]) == binary.BigEndian.Uint64(req[40:]) {
+			break
+		}
+	}
+	received := time.Now()
+
+	s.Stratum = int(resp[1])
+	if s.Stratum == 0 {
+		// A kiss-o'-death packet, e.g., RATE, with the code in the
+		// reference ID.
+		s.Error = "server sent kiss code " + string(resp[12:16])
+		return s
+	}
+	serverReceived := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+	serverSent := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+	offset := (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	s.OffsetMS = durationMS(offset)
+	s.RTTMS = durationMS(received.Sub(sent) - serverSent.Sub(serverReceived))
+	return s
+}
+
+// toNTPTime returns t as a 64-bit NTP timestamp: seconds since 1900 in the
+// high 32 bits and the fraction of a second in the low 32 bits.
+func toNTPTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return secs<<32 | frac
+}
+
+func fromNTPTime(ts uint64) time.Time {
+	secs := int64(ts>>32) - ntpEpochOffset
+	nanos := int64((ts & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(secs, nanos)
+}
@@ -0,0 +1,118 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveNTP answers each request on a loopback UDP socket with the packets
+// that reply returns and returns the socket's address.
+func serveNTP(t *testing.T, reply func(req []byte) [][]byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, resp := range reply(buf[:n]) {
+				_, _ = conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// ntpResponse returns a stratum 2 response to req from a server whose clock
+// is offset ahead of ours.
+func ntpResponse(req []byte, offset time.Duration) []byte {
+	resp := make([]byte, 48)
+	resp[0] = 0x24
+	resp[1] = 2
+	copy(resp[24:32], req[40:48])
+	now := toNTPTime(time.Now().Add(offset))
+	binary.BigEndian.PutUint64(resp[32:], now)
+	binary.BigEndian.PutUint64(resp[40:], now)
+	return resp
+}
+
+func TestQueryNTP(t *testing.T) {
+	addr := serveNTP(t, func(req []byte) [][]byte {
+		// A response to another request is ignored.
+		stale := ntpResponse(req, -time.Hour)
+		binary.BigEndian.PutUint64(stale[24:], 1)
+		return [][]byte{stale, ntpResponse(req, 90*time.Second)}
+	})
+	s := queryNTPAt(context.Background(), "time.example.com", addr)
+	if s.Error != "" {
+		t.Fatal(s.Error)
+	}
+	if s.Server != "time.example.com" || s.Address != addr || s.Stratum != 2 {
+		t.Errorf("sample = %+v", s)
+	}
+	if math.Abs(s.OffsetMS-90000) > 1000 || s.RTTMS < 0 {
+		t.Errorf("offset = %.0fms, RTT = %.0fms", s.OffsetMS, s.RTTMS)
+	}
+}
+
+func TestQueryNTPKissOfDeath(t *testing.T) {
+	addr := serveNTP(t, func(req []byte) [][]byte {
+		resp := ntpResponse(req, 0)
+		resp[1] = 0
+		copy(resp[12:16], "RATE")
+		return [][]byte{resp}
+	})
+	s := queryNTPAt(context.Background(), "time.example.com", addr)
+	if s.Error != "server sent kiss code RATE" {
+		t.Errorf("error = %q", s.Error)
+	}
+}
+
+func TestQueryNTPTimeout(t *testing.T) {
+	addr := serveNTP(t, func([]byte) [][]byte { return nil })
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if s := queryNTPAt(ctx, "time.example.com", addr); s.Error == "" {
+		t.Errorf("sample = %+v", s)
+	}
+}
+
+func TestNTPTime(t *testing.T) {
+	now := time.Unix(1700000000, 123456789)
+	if got := fromNTPTime(toNTPTime(now)); got.Sub(now).Abs() > time.Microsecond {
+		t.Errorf("round trip = %s, want %s", got, now)
+	}
+	if got := toNTPTime(time.Unix(0, 0)) >> 32; got != ntpEpochOffset {
+		t.Errorf("the Unix epoch is %d seconds after 1900", got)
+	}
+}
+
+func TestNTPFindings(t *testing.T) {
+	for offset, want := range map[float64]string{
+		-120000: "the local clock is 120 seconds ahead of the time reported by NTP servers",
+		90000:   "the local clock is 90 seconds behind the time reported by NTP servers",
+		30000:   "",
+	} {
+		fs := findingsFor(map[string]interface{}{"ntp": &ntpReport{OffsetMS: &offset}})
+		if want == "" {
+			if len(fs) != 0 {
+				t.Errorf("findings for %.0fms = %+v", offset, fs)
+			}
+			continue
+		}
+		if len(fs) != 1 || fs[0].Check != "clock-skew" || !strings.HasPrefix(fs[0].Summary, want) {
+			t.Errorf("findings for %.0fms = %+v", offset, fs)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspCheck is the result of checking the revocation status of the
+// certificate presented by a host, both from the response stapled to the
+// TLS handshake and by asking the certificate's OCSP responder.
+type ocspCheck struct {
+	Host string `json:"host"`
+	// Stapled is the OCSP response stapled to the handshake, if any.
+	Stapled *ocspStatus `json:"stapled,omitempty"`
+	// Responder is the OCSP responder named in the certificate. Some CAs no
+	// longer run one, in which case only CRLs are available.
+	Responder string      `json:"responder,omitempty"`
+	Response  *ocspStatus `json:"response,omitempty"`
+	// CRLs are the CRL distribution points named in the certificate.
+	CRLs  []string `json:"crls,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+type ocspStatus struct {
+	Status     string     `json:"status,omitempty"`
+	ThisUpdate *time.Time `json:"this_update,omitempty"`
+	NextUpdate *time.Time `json:"next_update,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	DurationMS float64    `json:"duration_ms,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// addOCSP checks the revocation status of each MaxMind endpoint's
+// certificate and writes the results to ocsp.json.
+func (a *analyzer) addOCSP(ctx context.Context) {
+	results := make([]*ocspCheck, len(maxmindEndpoints))
+	var wg sync.WaitGroup
+	for i, host := range maxmindEndpoints {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			results[i] = a.checkOCSP(ctx, host)
+		}(i, host)
+	}
+	wg.Wait()
+
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding ocsp.json"))
+		return
+	}
+	a.storeFile("ocsp.json", b)
+	a.storeResult("ocsp", results)
+}
+
+func (a *analyzer) checkOCSP(ctx context.Context, host string) *ocspCheck {
+	c := &ocspCheck{Host: host}
+
+	dialCtx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+	dialer := &tls.Dialer{
+		NetDialer: a.dial.newDialer("tcp"),
+		Config:    &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12},
+	}
+	conn, err := dialer.DialContext(dialCtx, a.dial.restrictNetwork("tcp"), net.JoinHostPort(host, "443"))
+	if err != nil {
+		c.Error = errors.Wrap(err, "error connecting").Error()
+		return c
+	}
+	state := conn.(*tls.Conn).ConnectionState()
+	_ = conn.Close()
+
+	if len(state.PeerCertificates) < 2 {
+		c.Error = "the server did not present an issuer certificate"
+		return c
+	}
+	leaf, issuer := state.PeerCertificates[0], state.PeerCertificates[1]
+	c.CRLs = leaf.CRLDistributionPoints
+
+	if len(state.OCSPResponse) > 0 {
+		c.Stapled = parseOCSPResponse(state.OCSPResponse, issuer)
+	}
+
+	if len(leaf.OCSPServer) == 0 {
+		return c
+	}
+	c.Responder = leaf.OCSPServer[0]
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		c.Error = errors.Wrap(err, "error creating OCSP request").Error()
+		return c
+	}
+
+	var body []byte
+	var duration time.Duration
+	err = a.retry(ctx, "POST "+c.Responder, func() error {
+		start := time.Now()
+		var err error
+		body, err = postOCSP(ctx, c.Responder, req)
+		duration = time.Since(start)
+		return err
+	})
+	if err != nil {
+		c.Response = &ocspStatus{DurationMS: durationMS(duration), Error: err.Error()}
+		return c
+	}
+	c.Response = parseOCSPResponse(body, issuer)
+	c.Response.DurationMS = durationMS(duration)
+	return c
+}
+
+func postOCSP(ctx context.Context, responder string, ocspReq []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responder, bytes.NewReader(ocspReq))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("User-Agent", os.Args[0])
+
+	resp, err := dialConfigFromContext(ctx).httpClient().Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error making request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpStatusErrorf(resp.StatusCode, "the OCSP responder returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading response")
+	}
+	return body, nil
+}
+
+func parseOCSPResponse(b []byte, issuer *x509.Certificate) *ocspStatus {
+	resp, err := ocsp.ParseResponse(b, issuer)
+	if err != nil {
+		return &ocspStatus{Error: errors.Wrap(err, "error parsing OCSP response").Error()}
+	}
+	s := &ocspStatus{ThisUpdate: &resp.ThisUpdate}
+	switch resp.Status {
+	case ocsp.Good:
+		s.Status = "good"
+	case ocsp.Revoked:
+		s.Status = "revoked"
+		s.RevokedAt = &resp.RevokedAt
+	default:
+		s.Status = "unknown"
+	}
+	if !resp.NextUpdate.IsZero() {
+		s.NextUpdate = &resp.NextUpdate
+	}
+	return s
+}
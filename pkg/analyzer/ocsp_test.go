@@ -0,0 +1,93 @@
+package analyzer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestPostOCSP(t *testing.T) {
+	ca, caKey := testCA(t, "Let's Encrypt")
+	leaf := testLeaf(t, ca, caKey, "geoip.maxmind.com", time.Now().Add(24*time.Hour))
+	revokedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil || r.Header.Get("Content-Type") != "application/ocsp-request" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		req, err := ocsp.ParseRequest(b)
+		if err != nil || req.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		resp, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       ocsp.Revoked,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    revokedAt,
+		}, caKey)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(resp)
+	}))
+	defer server.Close()
+
+	req, err := ocsp.CreateRequest(leaf, ca, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := postOCSP(context.Background(), server.URL, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := parseOCSPResponse(body, ca)
+	if s.Status != "revoked" || s.RevokedAt == nil || !s.RevokedAt.Equal(revokedAt) || s.NextUpdate == nil {
+		t.Errorf("status = %+v", s)
+	}
+
+	// The response must be signed by the issuer.
+	other, _ := testCA(t, "Let's Encrypt")
+	s = parseOCSPResponse(body, other)
+	if s.Status != "" || !strings.Contains(s.Error, "error parsing OCSP response") {
+		t.Errorf("status with the wrong issuer = %+v", s)
+	}
+
+	if _, err := postOCSP(context.Background(), server.URL, []byte("not a request")); err == nil ||
+		!strings.Contains(err.Error(), "400 Bad Request") {
+		t.Errorf("postOCSP with a bad request = %v", err)
+	}
+}
+
+func TestOCSPFindings(t *testing.T) {
+	tests := []struct {
+		check *ocspCheck
+		want  string
+	}{
+		{&ocspCheck{Stapled: &ocspStatus{Status: "good"}, Response: &ocspStatus{Status: "good"}}, ""},
+		{
+			&ocspCheck{Stapled: &ocspStatus{Status: "revoked"}, Response: &ocspStatus{Error: "timeout"}},
+			"certificate-revoked",
+		},
+		{&ocspCheck{Responder: "http://r3.o.lencr.org", Response: &ocspStatus{Error: "timeout"}}, "ocsp-unreachable"},
+		// Without a responder, there is nothing to query.
+		{&ocspCheck{CRLs: []string{"http://crl.example.com"}}, ""},
+	}
+	for _, test := range tests {
+		test.check.Host = "geoip.maxmind.com"
+		fs := findingsFor(map[string]interface{}{"ocsp": []*ocspCheck{test.check}})
+		if got := strings.Join(findingChecks(fs), ","); got != test.want {
+			t.Errorf("findings for %+v = %s, want %s", test.check, got, test.want)
+		}
+	}
+}
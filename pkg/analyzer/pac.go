@@ -0,0 +1,1129 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// pacEvaluator runs FindProxyForURL in a proxy auto-config file. PAC files
+// are JavaScript, but nearly all of them use a small subset of it:
+// functions, var, if and else, return, the usual operators, string
+// methods, and the PAC helper functions. That subset is interpreted here.
+// Anything else is reported as unsupported rather than guessed at.
+type pacEvaluator struct {
+	ctx       context.Context
+	functions map[string]*pacFunction
+	globals   map[string]any
+	// steps bounds the work done so that a PAC file that loops forever
+	// through recursion cannot hang the task.
+	steps int
+	// depth is the number of PAC functions being called.
+	depth int
+}
+
+type pacFunction struct {
+	params []string
+	body   []pacNode
+}
+
+const (
+	// pacMaxSteps is the most statements and calls a single evaluation
+	// may run.
+	pacMaxSteps = 100000
+	// pacMaxDepth is the deepest nesting of statements and expressions the
+	// parser accepts, so that a hostile PAC file cannot exhaust the stack.
+	pacMaxDepth = 200
+	// pacMaxCallDepth is the deepest recursion of PAC functions allowed.
+	pacMaxCallDepth = 1000
+	// pacMaxString is the longest string concatenation may build.
+	pacMaxString = 1 << 20
+)
+
+// evaluatePAC returns the result of FindProxyForURL(url, host) in the PAC
+// file src, e.g., "PROXY proxy.example.com:8080; DIRECT".
+func evaluatePAC(ctx context.Context, src, url, host string) (string, error) {
+	p := &pacParser{lexer: pacLexer{src: src}}
+	prog, err := p.program()
+	if err != nil {
+		return "", errors.Wrap(err, "error parsing PAC file")
+	}
+
+	e := &pacEvaluator{ctx: ctx, functions: map[string]*pacFunction{}, globals: map[string]any{}}
+	for _, n := range prog {
+		if f, ok := n.(*pacFuncDecl); ok {
+			e.functions[f.name] = &pacFunction{params: f.params, body: f.body}
+		}
+	}
+	scope := &pacScope{vars: e.globals}
+	for _, n := range prog {
+		if _, ok := n.(*pacFuncDecl); ok {
+			continue
+		}
+		if _, _, err := e.exec(n, scope); err != nil {
+			return "", err
+		}
+	}
+
+	v, err := e.call("FindProxyForURL", []any{url, host})
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.Errorf("FindProxyForURL returned %s, not a string", pacString(v))
+	}
+	return s, nil
+}
+
+// pacScope holds the variables of a function call. Lookups fall back to
+// the globals.
+type pacScope struct {
+	vars   map[string]any
+	parent *pacScope
+}
+
+func (s *pacScope) lookup(name string) (any, bool) {
+	for ; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func (s *pacScope) assign(name string, v any) {
+	for c := s; c != nil; c = c.parent {
+		if _, ok := c.vars[name]; ok {
+			c.vars[name] = v
+			return
+		}
+	}
+	s.vars[name] = v
+}
+
+func (e *pacEvaluator) step() error {
+	e.steps++
+	if e.steps > pacMaxSteps {
+		return errors.New("PAC file took too many steps")
+	}
+	return e.ctx.Err()
+}
+
+// exec runs a statement, returning whether it returned and the value.
+func (e *pacEvaluator) exec(n pacNode, s *pacScope) (bool, any, error) {
+	if err := e.step(); err != nil {
+		return false, nil, err
+	}
+	switch n := n.(type) {
+	case *pacVar:
+		for i, name := range n.names {
+			var v any
+			if n.values[i] != nil {
+				var err error
+				if v, err = e.eval(n.values[i], s); err != nil {
+					return false, nil, err
+				}
+			}
+			s.vars[name] = v
+		}
+		return false, nil, nil
+	case *pacIf:
+		c, err := e.eval(n.cond, s)
+		if err != nil {
+			return false, nil, err
+		}
+		if pacTruthy(c) {
+			return e.exec(n.then, s)
+		}
+		if n.els != nil {
+			return e.exec(n.els, s)
+		}
+		return false, nil, nil
+	case *pacReturn:
+		if n.value == nil {
+			return true, nil, nil
+		}
+		v, err := e.eval(n.value, s)
+		return true, v, err
+	case *pacBlock:
+		for _, stmt := range n.body {
+			ret, v, err := e.exec(stmt, s)
+			if err != nil || ret {
+				return ret, v, err
+			}
+		}
+		return false, nil, nil
+	case *pacExprStmt:
+		_, err := e.eval(n.expr, s)
+		return false, nil, err
+	case *pacFuncDecl:
+		e.functions[n.name] = &pacFunction{params: n.params, body: n.body}
+		return false, nil, nil
+	}
+	return false, nil, errors.Errorf("unsupported statement %T", n)
+}
+
+func (e *pacEvaluator) eval(n pacNode, s *pacScope) (any, error) {
+	switch n := n.(type) {
+	case *pacLiteral:
+		return n.value, nil
+	case *pacIdent:
+		v, ok := s.lookup(n.name)
+		if !ok {
+			return nil, errors.Errorf("%s is not defined", n.name)
+		}
+		return v, nil
+	case *pacAssign:
+		v, err := e.eval(n.value, s)
+		if err != nil {
+			return nil, err
+		}
+		if n.op != "=" {
+			old, ok := s.lookup(n.name)
+			if !ok {
+				return nil, errors.Errorf("%s is not defined", n.name)
+			}
+			if v, err = pacAdd(old, v); err != nil {
+				return nil, err
+			}
+		}
+		s.assign(n.name, v)
+		return v, nil
+	case *pacUnary:
+		v, err := e.eval(n.operand, s)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "!" {
+			return !pacTruthy(v), nil
+		}
+		return -pacNumber(v), nil
+	case *pacTernary:
+		c, err := e.eval(n.cond, s)
+		if err != nil {
+			return nil, err
+		}
+		if pacTruthy(c) {
+			return e.eval(n.then, s)
+		}
+		return e.eval(n.els, s)
+	case *pacBinary:
+		l, err := e.eval(n.left, s)
+		if err != nil {
+			return nil, err
+		}
+		// && and || short circuit and return an operand, as in
+		// JavaScript.
+		switch n.op {
+		case "&&":
+			if !pacTruthy(l) {
+				return l, nil
+			}
+			return e.eval(n.right, s)
+		case "||":
+			if pacTruthy(l) {
+				return l, nil
+			}
+			return e.eval(n.right, s)
+		}
+		r, err := e.eval(n.right, s)
+		if err != nil {
+			return nil, err
+		}
+		return pacBinaryOp(n.op, l, r)
+	case *pacCall:
+		args := make([]any, len(n.args))
+		for i, a := range n.args {
+			v, err := e.eval(a, s)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		if n.receiver == nil {
+			return e.call(n.name, args)
+		}
+		recv, err := e.eval(n.receiver, s)
+		if err != nil {
+			return nil, err
+		}
+		return pacMethod(recv, n.name, args)
+	case *pacMember:
+		recv, err := e.eval(n.receiver, s)
+		if err != nil {
+			return nil, err
+		}
+		if str, ok := recv.(string); ok && n.name == "length" {
+			return float64(len(str)), nil
+		}
+		return nil, errors.Errorf("unsupported property %s", n.name)
+	}
+	return nil, errors.Errorf("unsupported expression %T", n)
+}
+
+func (e *pacEvaluator) call(name string, args []any) (any, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
+	if f, ok := e.functions[name]; ok {
+		e.depth++
+		defer func() { e.depth-- }()
+		if e.depth > pacMaxCallDepth {
+			return nil, errors.New("PAC file recursed too deeply")
+		}
+		s := &pacScope{vars: map[string]any{}, parent: &pacScope{vars: e.globals}}
+		for i, p := range f.params {
+			if i < len(args) {
+				s.vars[p] = args[i]
+			} else {
+				s.vars[p] = nil
+			}
+		}
+		_, v, err := e.exec(&pacBlock{body: f.body}, s)
+		return v, err
+	}
+	return e.builtin(name, args)
+}
+
+// builtin implements the PAC helper functions. The date and time
+// functions are not supported, as the result would depend on when the
+// analyzer happened to run.
+func (e *pacEvaluator) builtin(name string, args []any) (any, error) {
+	str := func(i int) string {
+		if i < len(args) {
+			return pacString(args[i])
+		}
+		return ""
+	}
+	switch name {
+	case "isPlainHostName":
+		return !strings.Contains(str(0), "."), nil
+	case "dnsDomainIs":
+		return strings.HasSuffix(strings.ToLower(str(0)), strings.ToLower(str(1))), nil
+	case "localHostOrDomainIs":
+		host, hostdom := strings.ToLower(str(0)), strings.ToLower(str(1))
+		return host == hostdom || (!strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+".")), nil
+	case "dnsDomainLevels":
+		return float64(strings.Count(str(0), ".")), nil
+	case "shExpMatch":
+		return pacGlobMatch(strings.ToLower(str(1)), strings.ToLower(str(0))), nil
+	case "isResolvable":
+		_, err := net.DefaultResolver.LookupHost(e.ctx, str(0))
+		return err == nil, nil
+	case "dnsResolve":
+		ips, err := net.DefaultResolver.LookupIP(e.ctx, "ip4", str(0))
+		if err != nil || len(ips) == 0 {
+			return nil, nil
+		}
+		return ips[0].String(), nil
+	case "myIpAddress":
+		// No packet is sent; connecting picks the local address that
+		// --source-ip or --interface would use.
+		conn, err := dialConfigFromContext(e.ctx).newDialer("udp").DialContext(e.ctx, "udp4", "198.51.100.1:53")
+		if err != nil {
+			return "127.0.0.1", nil
+		}
+		defer conn.Close()
+		return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+	case "isInNet":
+		ip := net.ParseIP(str(0))
+		if ip == nil {
+			ips, err := net.DefaultResolver.LookupIP(e.ctx, "ip4", str(0))
+			if err != nil || len(ips) == 0 {
+				return false, nil
+			}
+			ip = ips[0]
+		}
+		pattern, mask := net.ParseIP(str(1)).To4(), net.ParseIP(str(2)).To4()
+		ip = ip.To4()
+		if ip == nil || pattern == nil || mask == nil {
+			return false, nil
+		}
+		m := net.IPMask(mask)
+		return ip.Mask(m).Equal(pattern.Mask(m)), nil
+	case "convert_addr":
+		ip := net.ParseIP(str(0)).To4()
+		if ip == nil {
+			return float64(0), nil
+		}
+		return float64(uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])), nil
+	case "alert":
+		return nil, nil
+	}
+	return nil, errors.Errorf("unsupported function %s", name)
+}
+
+// pacGlobMatch matches a shell expression in which * matches any
+// sequence of characters and ? any single character. When a match fails,
+// only the most recent * is retried with one more character, as any
+// earlier * could only be extended into what the later one already
+// matches. This takes O(len(pattern) * len(s)) time at worst rather than
+// backtracking exponentially.
+func pacGlobMatch(pattern, s string) bool {
+	p, i := 0, 0
+	// star is the position in pattern after the last * and starI the
+	// position in s that it is currently matched up to.
+	star, starI := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			p++
+			star, starI = p, i
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case star >= 0:
+			starI++
+			p, i = star, starI
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func pacMethod(recv any, name string, args []any) (any, error) {
+	s, ok := recv.(string)
+	if !ok {
+		return nil, errors.Errorf("unsupported method %s on %s", name, pacString(recv))
+	}
+	num := func(i int, def int) int {
+		if i < len(args) {
+			return int(pacNumber(args[i]))
+		}
+		return def
+	}
+	clamp := func(i int) int { return min(max(i, 0), len(s)) }
+	switch name {
+	case "toLowerCase":
+		return strings.ToLower(s), nil
+	case "toUpperCase":
+		return strings.ToUpper(s), nil
+	case "indexOf":
+		if len(args) == 0 {
+			return float64(-1), nil
+		}
+		return float64(strings.Index(s, pacString(args[0]))), nil
+	case "substring":
+		start, end := clamp(num(0, 0)), clamp(num(1, len(s)))
+		if start > end {
+			start, end = end, start
+		}
+		return s[start:end], nil
+	case "substr":
+		start := num(0, 0)
+		if start < 0 {
+			start += len(s)
+		}
+		start = clamp(start)
+		return s[start:clamp(start+num(1, len(s)))], nil
+	}
+	return nil, errors.Errorf("unsupported method %s", name)
+}
+
+func pacBinaryOp(op string, l, r any) (any, error) {
+	switch op {
+	case "+":
+		return pacAdd(l, r)
+	case "-":
+		return pacNumber(l) - pacNumber(r), nil
+	case "==", "===":
+		return pacEqual(l, r), nil
+	case "!=", "!==":
+		return !pacEqual(l, r), nil
+	case "<", ">", "<=", ">=":
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if lok && rok {
+			c := strings.Compare(ls, rs)
+			return map[string]bool{"<": c < 0, ">": c > 0, "<=": c <= 0, ">=": c >= 0}[op], nil
+		}
+		a, b := pacNumber(l), pacNumber(r)
+		return map[string]bool{"<": a < b, ">": a > b, "<=": a <= b, ">=": a >= b}[op], nil
+	}
+	return nil, errors.Errorf("unsupported operator %s", op)
+}
+
+func pacAdd(l, r any) (any, error) {
+	_, ls := l.(string)
+	_, rs := r.(string)
+	if ls || rs {
+		s := pacString(l)
+		t := pacString(r)
+		if len(s)+len(t) > pacMaxString {
+			return nil, errors.New("PAC file built too long a string")
+		}
+		return s + t, nil
+	}
+	return pacNumber(l) + pacNumber(r), nil
+}
+
+func pacEqual(l, r any) bool {
+	if l == nil || r == nil {
+		return l == nil && r == nil
+	}
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			return ls == rs
+		}
+	}
+	if lb, ok := l.(bool); ok {
+		if rb, ok := r.(bool); ok {
+			return lb == rb
+		}
+	}
+	return pacNumber(l) == pacNumber(r)
+}
+
+func pacTruthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	}
+	return true
+}
+
+func pacNumber(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f
+	}
+	return 0
+}
+
+func pacString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// PAC syntax tree nodes.
+type (
+	pacNode     any
+	pacFuncDecl struct {
+		name   string
+		params []string
+		body   []pacNode
+	}
+	pacVar struct {
+		names  []string
+		values []pacNode
+	}
+	pacIf struct {
+		cond, then, els pacNode
+	}
+	pacReturn   struct{ value pacNode }
+	pacBlock    struct{ body []pacNode }
+	pacExprStmt struct{ expr pacNode }
+	pacLiteral  struct{ value any }
+	pacIdent    struct{ name string }
+	pacAssign   struct {
+		name, op string
+		value    pacNode
+	}
+	pacUnary struct {
+		op      string
+		operand pacNode
+	}
+	pacBinary struct {
+		op          string
+		left, right pacNode
+	}
+	pacTernary struct{ cond, then, els pacNode }
+	pacCall    struct {
+		receiver pacNode
+		name     string
+		args     []pacNode
+	}
+	pacMember struct {
+		receiver pacNode
+		name     string
+	}
+)
+
+// pacToken is a token of the PAC file. kind is "ident", "string",
+// "number", "punct", or "eof".
+type pacToken struct {
+	kind, text string
+	pos        int
+}
+
+type pacLexer struct {
+	src string
+	pos int
+}
+
+// pacPuncts are the punctuators we support, longest first.
+var pacPuncts = []string{
+	"===", "!==", "==", "!=", "<=", ">=", "&&", "||", "+=",
+	"(", ")", "{", "}", ",", ";", "=", "!", "<", ">", "+", "-", "?", ":", ".",
+}
+
+func (l *pacLexer) next() (pacToken, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			if i := strings.IndexByte(l.src[l.pos:], '\n'); i >= 0 {
+				l.pos += i
+			} else {
+				l.pos = len(l.src)
+			}
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			i := strings.Index(l.src[l.pos+2:], "*/")
+			if i < 0 {
+				return pacToken{}, errors.New("unterminated comment")
+			}
+			l.pos += i + 4
+		default:
+			return l.token()
+		}
+	}
+	return pacToken{kind: "eof", pos: l.pos}, nil
+}
+
+func (l *pacLexer) token() (pacToken, error) {
+	start := l.pos
+	c := rune(l.src[l.pos])
+	switch {
+	case c == '"' || c == '\'':
+		var b strings.Builder
+		for l.pos++; l.pos < len(l.src); l.pos++ {
+			ch := l.src[l.pos]
+			if ch == byte(c) {
+				l.pos++
+				return pacToken{kind: "string", text: b.String(), pos: start}, nil
+			}
+			if ch == '\\' && l.pos+1 < len(l.src) {
+				l.pos++
+				ch = map[byte]byte{'n': '\n', 't': '\t'}[l.src[l.pos]]
+				if ch == 0 {
+					ch = l.src[l.pos]
+				}
+			}
+			b.WriteByte(ch)
+		}
+		return pacToken{}, errors.Errorf("unterminated string at offset %d", start)
+	case unicode.IsDigit(c):
+		for l.pos < len(l.src) && (unicode.IsDigit(rune(l.src[l.pos])) || l.src[l.pos] == '.') {
+			l.pos++
+		}
+		return pacToken{kind: "number", text: l.src[start:l.pos], pos: start}, nil
+	case unicode.IsLetter(c) || c == '_' || c == '$':
+		for l.pos < len(l.src) {
+			ch := rune(l.src[l.pos])
+			if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) && ch != '_' && ch != '$' {
+				break
+			}
+			l.pos++
+		}
+		return pacToken{kind: "ident", text: l.src[start:l.pos], pos: start}, nil
+	}
+	for _, p := range pacPuncts {
+		if strings.HasPrefix(l.src[l.pos:], p) {
+			l.pos += len(p)
+			return pacToken{kind: "punct", text: p, pos: start}, nil
+		}
+	}
+	return pacToken{}, errors.Errorf("unsupported character %q at offset %d", c, start)
+}
+
+type pacParser struct {
+	lexer  pacLexer
+	tok    pacToken
+	peeked bool
+	// depth is the nesting of the statement or expression being parsed.
+	depth int
+}
+
+// enter increases the nesting depth, returning an error if it exceeds
+// pacMaxDepth. The caller must call leave when done.
+func (p *pacParser) enter() error {
+	p.depth++
+	if p.depth > pacMaxDepth {
+		return errors.New("PAC file is nested too deeply")
+	}
+	return nil
+}
+
+func (p *pacParser) leave() {
+	p.depth--
+}
+
+func (p *pacParser) peek() (pacToken, error) {
+	if !p.peeked {
+		t, err := p.lexer.next()
+		if err != nil {
+			return t, err
+		}
+		p.tok, p.peeked = t, true
+	}
+	return p.tok, nil
+}
+
+func (p *pacParser) advance() (pacToken, error) {
+	t, err := p.peek()
+	p.peeked = false
+	return t, err
+}
+
+// accept consumes the next token if it is the punctuator or keyword text.
+func (p *pacParser) accept(text string) (bool, error) {
+	t, err := p.peek()
+	if err != nil {
+		return false, err
+	}
+	if (t.kind == "punct" || t.kind == "ident") && t.text == text {
+		p.peeked = false
+		return true, nil
+	}
+	return false, nil
+}
+
+func (p *pacParser) expect(text string) error {
+	ok, err := p.accept(text)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		t, _ := p.peek()
+		return errors.Errorf("expected %q at offset %d, found %q", text, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *pacParser) ident() (string, error) {
+	t, err := p.advance()
+	if err != nil {
+		return "", err
+	}
+	if t.kind != "ident" {
+		return "", errors.Errorf("expected a name at offset %d, found %q", t.pos, t.text)
+	}
+	return t.text, nil
+}
+
+func (p *pacParser) program() ([]pacNode, error) {
+	var prog []pacNode
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == "eof" {
+			return prog, nil
+		}
+		n, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		prog = append(prog, n)
+	}
+}
+
+func (p *pacParser) statement() (pacNode, error) {
+	defer p.leave()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	t, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == "punct" {
+		switch t.text {
+		case "{":
+			return p.block()
+		case ";":
+			p.peeked = false
+			return &pacBlock{}, nil
+		}
+	}
+	if t.kind == "ident" {
+		switch t.text {
+		case "function":
+			p.peeked = false
+			return p.function()
+		case "var", "let", "const":
+			p.peeked = false
+			return p.varStatement()
+		case "if":
+			p.peeked = false
+			return p.ifStatement()
+		case "return":
+			p.peeked = false
+			r := &pacReturn{}
+			if ok, err := p.accept(";"); err != nil || ok {
+				return r, err
+			}
+			if next, err := p.peek(); err != nil || next.text == "}" {
+				return r, err
+			}
+			if r.value, err = p.expression(); err != nil {
+				return nil, err
+			}
+			_, err = p.accept(";")
+			return r, err
+		case "for", "while", "do", "switch", "try", "throw", "new":
+			return nil, errors.Errorf("unsupported statement %q at offset %d", t.text, t.pos)
+		}
+	}
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.accept(";")
+	return &pacExprStmt{expr: e}, err
+}
+
+func (p *pacParser) block() (*pacBlock, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	b := &pacBlock{}
+	for {
+		ok, err := p.accept("}")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return b, nil
+		}
+		if t, _ := p.peek(); t.kind == "eof" {
+			return nil, errors.New("unexpected end of file")
+		}
+		n, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		b.body = append(b.body, n)
+	}
+}
+
+func (p *pacParser) function() (pacNode, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	f := &pacFuncDecl{name: name}
+	for {
+		if ok, err := p.accept(")"); err != nil || ok {
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		param, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		f.params = append(f.params, param)
+		if _, err := p.accept(","); err != nil {
+			return nil, err
+		}
+	}
+	b, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	f.body = b.body
+	return f, nil
+}
+
+func (p *pacParser) varStatement() (pacNode, error) {
+	v := &pacVar{}
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		var value pacNode
+		if ok, err := p.accept("="); err != nil {
+			return nil, err
+		} else if ok {
+			if value, err = p.expression(); err != nil {
+				return nil, err
+			}
+		}
+		v.names = append(v.names, name)
+		v.values = append(v.values, value)
+		if ok, err := p.accept(","); err != nil || !ok {
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	_, err := p.accept(";")
+	return v, err
+}
+
+func (p *pacParser) ifStatement() (pacNode, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	cond, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	n := &pacIf{cond: cond}
+	if n.then, err = p.statement(); err != nil {
+		return nil, err
+	}
+	if ok, err := p.accept("else"); err != nil {
+		return nil, err
+	} else if ok {
+		if n.els, err = p.statement(); err != nil {
+			return nil, err
+		}
+	}
+	return n, nil
+}
+
+func (p *pacParser) expression() (pacNode, error) {
+	defer p.leave()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	left, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	t, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == "punct" && (t.text == "=" || t.text == "+=") {
+		id, ok := left.(*pacIdent)
+		if !ok {
+			return nil, errors.Errorf("unsupported assignment at offset %d", t.pos)
+		}
+		p.peeked = false
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return &pacAssign{name: id.name, op: t.text, value: value}, nil
+	}
+	return left, nil
+}
+
+func (p *pacParser) ternary() (pacNode, error) {
+	defer p.leave()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	cond, err := p.binary(0)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.accept("?"); err != nil || !ok {
+		return cond, err
+	}
+	then, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	els, err := p.ternary()
+	if err != nil {
+		return nil, err
+	}
+	return &pacTernary{cond: cond, then: then, els: els}, nil
+}
+
+// pacPrecedence lists the binary operators from lowest to highest
+// precedence.
+var pacPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "===", "!=="},
+	{"<", ">", "<=", ">="},
+	{"+", "-"},
+}
+
+func (p *pacParser) binary(level int) (pacNode, error) {
+	if level == len(pacPrecedence) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, err := p.peek()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind != "punct" || !slices.Contains(pacPrecedence[level], t.text) {
+			return left, nil
+		}
+		p.peeked = false
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &pacBinary{op: t.text, left: left, right: right}
+	}
+}
+
+func (p *pacParser) unary() (pacNode, error) {
+	defer p.leave()
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	t, err := p.peek()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == "punct" && (t.text == "!" || t.text == "-") {
+		p.peeked = false
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &pacUnary{op: t.text, operand: operand}, nil
+	}
+	return p.postfix()
+}
+
+func (p *pacParser) postfix() (pacNode, error) {
+	n, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if ok, err := p.accept("."); err != nil {
+			return nil, err
+		} else if ok {
+			name, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			if next, err := p.peek(); err != nil {
+				return nil, err
+			} else if next.text == "(" {
+				args, err := p.arguments()
+				if err != nil {
+					return nil, err
+				}
+				n = &pacCall{receiver: n, name: name, args: args}
+			} else {
+				n = &pacMember{receiver: n, name: name}
+			}
+			continue
+		}
+		if id, ok := n.(*pacIdent); ok {
+			if next, err := p.peek(); err != nil {
+				return nil, err
+			} else if next.text == "(" && next.kind == "punct" {
+				args, err := p.arguments()
+				if err != nil {
+					return nil, err
+				}
+				n = &pacCall{name: id.name, args: args}
+				continue
+			}
+		}
+		return n, nil
+	}
+}
+
+func (p *pacParser) arguments() ([]pacNode, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []pacNode
+	for {
+		if ok, err := p.accept(")"); err != nil || ok {
+			return args, err
+		}
+		a, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, a)
+		if _, err := p.accept(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *pacParser) primary() (pacNode, error) {
+	t, err := p.advance()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case "string":
+		return &pacLiteral{value: t.text}, nil
+	case "number":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing number at offset %d", t.pos)
+		}
+		return &pacLiteral{value: f}, nil
+	case "ident":
+		switch t.text {
+		case "true":
+			return &pacLiteral{value: true}, nil
+		case "false":
+			return &pacLiteral{value: false}, nil
+		case "null", "undefined":
+			return &pacLiteral{value: nil}, nil
+		case "new", "function", "typeof", "this":
+			return nil, errors.Errorf("unsupported expression %q at offset %d", t.text, t.pos)
+		}
+		return &pacIdent{name: t.text}, nil
+	case "punct":
+		if t.text == "(" {
+			e, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expect(")")
+		}
+	case "eof":
+		return nil, errors.New("unexpected end of file")
+	}
+	return nil, errors.Errorf("unexpected %q at offset %d", t.text, t.pos)
+}
@@ -0,0 +1,488 @@
+package analyzer
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPACGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"?", "", false},
+		{"?", "a", true},
+		{"?", "ab", false},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "www.example.com.evil.net", false},
+		{"http://*.internal/*", "http://wiki.internal/page", true},
+		{"*example*", "www.example.com", true},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "aXXbYYc", true},
+		{"a*b*c", "aXXbYY", false},
+		{"a*b*c", "acb", false},
+		{"*a*a*", "banana", true},
+		{"10.?.*", "10.1.2.3", true},
+		{"10.?.*", "10.12.2.3", false},
+		{"**", "x", true},
+		{"a**", "a", true},
+		{"*?", "", false},
+		{"*?", "x", true},
+		{"exact", "exact", true},
+		{"exact", "exacT", false},
+	}
+	for _, test := range tests {
+		if got := pacGlobMatch(test.pattern, test.s); got != test.want {
+			t.Errorf("pacGlobMatch(%q, %q) = %t, want %t", test.pattern, test.s, got, test.want)
+		}
+	}
+}
+
+func TestPACGlobMatchIsNotExponential(t *testing.T) {
+	// With backtracking at every *, this took seconds.
+	pattern := strings.Repeat("*a", 8) + "*b"
+	s := strings.Repeat("a", 47)
+	start := time.Now()
+	if pacGlobMatch(pattern, s) {
+		t.Error("pattern matched")
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("matching took %s", d)
+	}
+
+	pattern = strings.Repeat("*", 1000) + "b"
+	s = strings.Repeat("a", 10000)
+	start = time.Now()
+	if pacGlobMatch(pattern, s) {
+		t.Error("pattern matched")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("matching took %s", d)
+	}
+}
+
+func lexPAC(t *testing.T, src string) []pacToken {
+	t.Helper()
+	l := pacLexer{src: src}
+	var tokens []pacToken
+	for {
+		tok, err := l.next()
+		if err != nil {
+			t.Fatalf("lexing %q: %v", src, err)
+		}
+		if tok.kind == "eof" {
+			return tokens
+		}
+		tok.pos = 0
+		tokens = append(tokens, tok)
+	}
+}
+
+func TestPACLexer(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []pacToken
+	}{
+		{
+			src: `var x = "a\"b" + 'c\n';`,
+			want: []pacToken{
+				{kind: "ident", text: "var"},
+				{kind: "ident", text: "x"},
+				{kind: "punct", text: "="},
+				{kind: "string", text: `a"b`},
+				{kind: "punct", text: "+"},
+				{kind: "string", text: "c\n"},
+				{kind: "punct", text: ";"},
+			},
+		},
+		{
+			src: "// comment\nif (a === 1.5) /* block\ncomment */ { $b_2 += 3 }",
+			want: []pacToken{
+				{kind: "ident", text: "if"},
+				{kind: "punct", text: "("},
+				{kind: "ident", text: "a"},
+				{kind: "punct", text: "==="},
+				{kind: "number", text: "1.5"},
+				{kind: "punct", text: ")"},
+				{kind: "punct", text: "{"},
+				{kind: "ident", text: "$b_2"},
+				{kind: "punct", text: "+="},
+				{kind: "number", text: "3"},
+				{kind: "punct", text: "}"},
+			},
+		},
+		{
+			src: "a!==b||!c&&d<=e",
+			want: []pacToken{
+				{kind: "ident", text: "a"},
+				{kind: "punct", text: "!=="},
+				{kind: "ident", text: "b"},
+				{kind: "punct", text: "||"},
+				{kind: "punct", text: "!"},
+				{kind: "ident", text: "c"},
+				{kind: "punct", text: "&&"},
+				{kind: "ident", text: "d"},
+				{kind: "punct", text: "<="},
+				{kind: "ident", text: "e"},
+			},
+		},
+		{src: "// only a comment", want: nil},
+	}
+	for _, test := range tests {
+		if got := lexPAC(t, test.src); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("lexing %q gave\n%+v\nwant\n%+v", test.src, got, test.want)
+		}
+	}
+}
+
+func TestPACLexerErrors(t *testing.T) {
+	for _, src := range []string{`"unterminated`, "/* unterminated", "a # b", "x = `template`"} {
+		l := pacLexer{src: src}
+		var err error
+		for {
+			var tok pacToken
+			tok, err = l.next()
+			if err != nil || tok.kind == "eof" {
+				break
+			}
+		}
+		if err == nil {
+			t.Errorf("lexing %q succeeded", src)
+		}
+	}
+}
+
+func parsePAC(t *testing.T, src string) []pacNode {
+	t.Helper()
+	p := &pacParser{lexer: pacLexer{src: src}}
+	prog, err := p.program()
+	if err != nil {
+		t.Fatalf("parsing %q: %v", src, err)
+	}
+	return prog
+}
+
+func TestPACParserPrecedence(t *testing.T) {
+	prog := parsePAC(t, "a || b && c == 1 + 2 - -3;")
+	got := prog[0].(*pacExprStmt).expr
+	num := func(f float64) *pacLiteral { return &pacLiteral{value: f} }
+	want := &pacBinary{
+		op:   "||",
+		left: &pacIdent{name: "a"},
+		right: &pacBinary{
+			op:   "&&",
+			left: &pacIdent{name: "b"},
+			right: &pacBinary{
+				op:   "==",
+				left: &pacIdent{name: "c"},
+				right: &pacBinary{
+					op:    "-",
+					left:  &pacBinary{op: "+", left: num(1), right: num(2)},
+					right: &pacUnary{op: "-", operand: num(3)},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsed %#v", got)
+	}
+}
+
+func TestPACParserStatements(t *testing.T) {
+	prog := parsePAC(t, `
+function FindProxyForURL(url, host) {
+	var a = 1, b;
+	if (a) return "x"; else { b = host.toLowerCase(); }
+	return c ? "y" : s.length;
+}`)
+	if len(prog) != 1 {
+		t.Fatalf("got %d statements", len(prog))
+	}
+	f, ok := prog[0].(*pacFuncDecl)
+	if !ok || f.name != "FindProxyForURL" || !reflect.DeepEqual(f.params, []string{"url", "host"}) {
+		t.Fatalf("function = %#v", prog[0])
+	}
+	if len(f.body) != 3 {
+		t.Fatalf("body has %d statements", len(f.body))
+	}
+	v, ok := f.body[0].(*pacVar)
+	if !ok || !reflect.DeepEqual(v.names, []string{"a", "b"}) || v.values[1] != nil {
+		t.Errorf("var = %#v", f.body[0])
+	}
+	ifStmt, ok := f.body[1].(*pacIf)
+	if !ok || ifStmt.els == nil {
+		t.Fatalf("if = %#v", f.body[1])
+	}
+	assign := ifStmt.els.(*pacBlock).body[0].(*pacExprStmt).expr.(*pacAssign)
+	call := assign.value.(*pacCall)
+	if assign.name != "b" || call.name != "toLowerCase" || !reflect.DeepEqual(call.receiver, &pacIdent{name: "host"}) {
+		t.Errorf("assignment = %#v", assign)
+	}
+	ret := f.body[2].(*pacReturn)
+	ternary := ret.value.(*pacTernary)
+	if !reflect.DeepEqual(ternary.els, &pacMember{receiver: &pacIdent{name: "s"}, name: "length"}) {
+		t.Errorf("ternary = %#v", ternary)
+	}
+}
+
+func TestPACParserErrors(t *testing.T) {
+	for _, src := range []string{
+		"function f( {",
+		"function f() { return 1;",
+		"if (a { }",
+		"for (;;) {}",
+		"while (true) {}",
+		"x = new Date();",
+		"a.b = 1;",
+		"var = 1;",
+		"(1 + 2",
+		"1 +",
+		strings.Repeat("(", 10000) + "1" + strings.Repeat(")", 10000),
+		strings.Repeat("{", 10000),
+		strings.Repeat("a ? b : ", 10000) + "c",
+		strings.Repeat("!", 10000) + "a",
+	} {
+		p := &pacParser{lexer: pacLexer{src: src}}
+		if _, err := p.program(); err == nil {
+			name := src
+			if len(name) > 40 {
+				name = name[:40] + "..."
+			}
+			t.Errorf("parsing %q succeeded", name)
+		}
+	}
+}
+
+// evalPACExpr evaluates a JavaScript expression with FindProxyForURL.
+func evalPACExpr(t *testing.T, expr string) (string, error) {
+	t.Helper()
+	src := "function FindProxyForURL(url, host) { return '' + (" + expr + "); }"
+	return evaluatePAC(context.Background(), src, "http://www.example.com/path", "www.example.com")
+}
+
+func TestPACEvaluator(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1 + 2", "3"},
+		{"'a' + 1", "a1"},
+		{"1 + '1'", "11"},
+		{"5 - '2'", "3"},
+		{"-'3'", "-3"},
+		{"1.5 + 1", "2.5"},
+		{"1 == '1'", "true"},
+		{"1 === 1", "true"},
+		{"'a' != 'b'", "true"},
+		{"null == undefined", "true"},
+		{"null == 0", "false"},
+		{"true == 1", "true"},
+		{"'b' > 'a'", "true"},
+		{"10 > 9", "true"},
+		{"'10' < '9'", "true"},
+		{"!''", "true"},
+		{"!'x'", "false"},
+		{"!0", "true"},
+		{"0 || 'fallback'", "fallback"},
+		{"'first' || 'second'", "first"},
+		{"'first' && 'second'", "second"},
+		{"0 && undefinedName", "0"},
+		{"1 || undefinedName", "1"},
+		{"true ? 'y' : 'n'", "y"},
+		{"'' ? 'y' : 'n'", "n"},
+		{"host", "www.example.com"},
+		{"url.length", "27"},
+		{"host.toUpperCase()", "WWW.EXAMPLE.COM"},
+		{"'MiXeD'.toLowerCase()", "mixed"},
+		{"host.indexOf('example')", "4"},
+		{"host.indexOf('nope')", "-1"},
+		{"host.substring(4, 11)", "example"},
+		{"host.substring(11, 4)", "example"},
+		{"host.substring(4)", "example.com"},
+		{"host.substring(-5, 3)", "www"},
+		{"host.substr(4, 7)", "example"},
+		{"host.substr(-3)", "com"},
+		{"host.substr(100)", ""},
+		{"null", "null"},
+	}
+	for _, test := range tests {
+		got, err := evalPACExpr(t, test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s = %q, want %q", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestPACBuiltins(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"isPlainHostName('intranet')", "true"},
+		{"isPlainHostName('www.example.com')", "false"},
+		{"dnsDomainIs('www.example.com', '.example.com')", "true"},
+		{"dnsDomainIs('WWW.Example.COM', '.example.com')", "true"},
+		{"dnsDomainIs('www.example.net', '.example.com')", "false"},
+		{"localHostOrDomainIs('www', 'www.example.com')", "true"},
+		{"localHostOrDomainIs('www.example.com', 'www.example.com')", "true"},
+		{"localHostOrDomainIs('www.example.net', 'www.example.com')", "false"},
+		{"localHostOrDomainIs('home', 'www.example.com')", "false"},
+		{"dnsDomainLevels('www')", "0"},
+		{"dnsDomainLevels('www.example.com')", "2"},
+		{"shExpMatch('www.example.com', '*.example.com')", "true"},
+		{"shExpMatch('WWW.EXAMPLE.COM', '*.example.com')", "true"},
+		{"shExpMatch('http://host/a/b', '*/a/*')", "true"},
+		{"shExpMatch('example.com', '*.example.com')", "false"},
+		{"shExpMatch('10.1.2.3', '10.?.2.*')", "true"},
+		{"isInNet('10.1.2.3', '10.0.0.0', '255.0.0.0')", "true"},
+		{"isInNet('11.1.2.3', '10.0.0.0', '255.0.0.0')", "false"},
+		{"isInNet('192.168.1.77', '192.168.1.0', '255.255.255.0')", "true"},
+		{"isInNet('192.168.2.77', '192.168.1.0', '255.255.255.0')", "false"},
+		{"isInNet('192.168.2.77', '192.168.1.0', 'not a mask')", "false"},
+		{"isInNet('2001:db8::1', '10.0.0.0', '255.0.0.0')", "false"},
+		{"convert_addr('1.2.3.4')", "16909060"},
+		{"convert_addr('bogus')", "0"},
+		{"alert('ignored')", "null"},
+	}
+	for _, test := range tests {
+		got, err := evalPACExpr(t, test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s = %q, want %q", test.expr, got, test.want)
+		}
+	}
+
+	got, err := evalPACExpr(t, "myIpAddress()")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if net.ParseIP(got).To4() == nil {
+		t.Errorf("myIpAddress() = %q, want an IPv4 address", got)
+	}
+}
+
+const testPACFile = `
+// A typical corporate PAC file.
+var proxy = "PROXY proxy.example.com:8080";
+
+function isInternal(host) {
+	return isPlainHostName(host) ||
+		dnsDomainIs(host, ".corp.example.com") ||
+		shExpMatch(host, "*.internal");
+}
+
+function FindProxyForURL(url, host) {
+	host = host.toLowerCase();
+	if (isInternal(host))
+		return "DIRECT";
+	if (isInNet(host, "10.0.0.0", "255.0.0.0") || isInNet(host, "172.16.0.0", "255.240.0.0"))
+		return "DIRECT";
+	if (url.substring(0, 5) == "http:")
+		return proxy + "; DIRECT";
+	var backup = "PROXY backup.example.com:3128";
+	return proxy + "; " + backup;
+}
+`
+
+func TestFindProxyForURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		host string
+		want string
+	}{
+		{"https://intranet/", "intranet", "DIRECT"},
+		{"https://wiki.corp.example.com/", "wiki.corp.example.com", "DIRECT"},
+		{"https://build.internal/", "BUILD.INTERNAL", "DIRECT"},
+		{"https://10.2.3.4/", "10.2.3.4", "DIRECT"},
+		{"https://172.20.0.1/", "172.20.0.1", "DIRECT"},
+		{"http://www.maxmind.com/", "www.maxmind.com", "PROXY proxy.example.com:8080; DIRECT"},
+		{
+			"https://geoip.maxmind.com/",
+			"geoip.maxmind.com",
+			"PROXY proxy.example.com:8080; PROXY backup.example.com:3128",
+		},
+	}
+	for _, test := range tests {
+		got, err := evaluatePAC(context.Background(), testPACFile, test.url, test.host)
+		if err != nil {
+			t.Errorf("%s: %v", test.url, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("FindProxyForURL(%q, %q) = %q, want %q", test.url, test.host, got, test.want)
+		}
+	}
+}
+
+func TestPACEvaluationErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"missing FindProxyForURL", "function f() { return 'DIRECT'; }"},
+		{"non-string result", "function FindProxyForURL(url, host) { return 1; }"},
+		{"undefined variable", "function FindProxyForURL(url, host) { return nope; }"},
+		{"unsupported function", "function FindProxyForURL(url, host) { return weekdayRange('MON', 'FRI'); }"},
+		{"unsupported method", "function FindProxyForURL(url, host) { return host.split('.'); }"},
+		{"infinite recursion", "function FindProxyForURL(url, host) { return FindProxyForURL(url, host); }"},
+		{
+			"exponential recursion",
+			"function f(n) { return f(n) + f(n); } function FindProxyForURL(url, host) { return f(1); }",
+		},
+		{
+			"string blowup",
+			"function f(s) { return f(s + s); } function FindProxyForURL(url, host) { return f('x'); }",
+		},
+	}
+	for _, test := range tests {
+		if got, err := evaluatePAC(context.Background(), test.src, "http://a/", "a"); err == nil {
+			t.Errorf("%s: got %q, want an error", test.name, got)
+		}
+	}
+}
+
+func TestPACEvaluationCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := evaluatePAC(ctx, "function FindProxyForURL(url, host) { return 'DIRECT'; }", "http://a/", "a")
+	if err == nil {
+		t.Error("evaluation succeeded with a cancelled context")
+	}
+}
+
+func TestPACGlobalsAndAssignment(t *testing.T) {
+	src := `
+var count = 0;
+function bump() { count += 1; return count; }
+function FindProxyForURL(url, host) {
+	var local = "a";
+	local += "b";
+	bump();
+	bump();
+	return local + count;
+}`
+	got, err := evaluatePAC(context.Background(), src, "http://a/", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "ab2" {
+		t.Errorf("got %q, want ab2", got)
+	}
+}
@@ -0,0 +1,126 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// captureSnapLen is enough for the headers of every packet. Payloads
+	// are TLS encrypted anyway, and capturing them would make the
+	// download tests produce huge files.
+	captureSnapLen = "256"
+
+	// captureStopTimeout is how long tcpdump has to write out the
+	// capture after it is interrupted.
+	captureStopTimeout = 5 * time.Second
+)
+
+// packetCapture is a tcpdump process writing to a temporary file.
+type packetCapture struct {
+	cmd    *exec.Cmd
+	dir    string
+	path   string
+	stderr *bytes.Buffer
+	done   chan error
+}
+
+// startCapture starts tcpdump capturing packets to and from hosts, DNS
+// traffic, and ICMP, which includes the errors that routers along the path
+// send. The capture runs until stop is called.
+func startCapture(ctx context.Context, hosts []string) (*packetCapture, error) {
+	if _, err := exec.LookPath("tcpdump"); err != nil {
+		return nil, errors.Wrap(err, "error finding tcpdump, which --pcap requires")
+	}
+
+	var filter []string
+	for _, host := range hosts {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			slog.Warn("not capturing packets to host", "host", host, "error", err)
+			continue
+		}
+		for _, addr := range addrs {
+			filter = append(filter, "host "+addr.IP.String())
+		}
+	}
+	filter = append(filter, "port 53", "port 853", "icmp", "icmp6")
+
+	dir, err := os.MkdirTemp("", archivePrefix+"-pcap-")
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating packet capture directory")
+	}
+	c := &packetCapture{
+		dir:    dir,
+		path:   filepath.Join(dir, "capture.pcap"),
+		stderr: new(bytes.Buffer),
+		done:   make(chan error, 1),
+	}
+
+	// -U writes each packet as it arrives so that nothing is lost if
+	// tcpdump has to be killed.
+	args := []string{"-n", "-U", "-s", captureSnapLen, "-w", c.path}
+	if runtime.GOOS == "linux" {
+		args = append(args, "-i", "any")
+	}
+	args = append(args, strings.Join(filter, " or "))
+
+	c.cmd = exec.Command("tcpdump", args...) // nolint: gas, gosec
+	c.cmd.Stderr = c.stderr
+	if err := c.cmd.Start(); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, errors.Wrap(err, "error starting tcpdump")
+	}
+	go func() { c.done <- c.cmd.Wait() }()
+
+	// tcpdump exits right away if the filter is invalid or it lacks the
+	// privileges to capture, so give it a moment to fail.
+	select {
+	case err := <-c.done:
+		_ = os.RemoveAll(dir)
+		return nil, errors.Errorf(
+			"tcpdump exited before the tasks started (%v): %s", err, strings.TrimSpace(c.stderr.String()),
+		)
+	case <-time.After(time.Second):
+	}
+	return c, nil
+}
+
+// stop interrupts tcpdump and returns what it wrote to stderr, which
+// includes how many packets were captured and dropped. The capture is left
+// at c.path.
+func (c *packetCapture) stop() []byte {
+	if err := c.cmd.Process.Signal(os.Interrupt); err != nil {
+		_ = c.cmd.Process.Kill()
+	}
+	select {
+	case <-c.done:
+	case <-time.After(captureStopTimeout):
+		_ = c.cmd.Process.Kill()
+		<-c.done
+	}
+	return c.stderr.Bytes()
+}
+
+// stopCapture stops c and stores the capture in capture.pcap and tcpdump's
+// output in tcpdump.txt. The capture is moved to the spool rather than
+// read into memory.
+func (a *analyzer) stopCapture(c *packetCapture) {
+	defer os.RemoveAll(c.dir)
+
+	log := c.stop()
+	if err := a.storeFileFrom("capture.pcap", c.path); err != nil {
+		a.storeTaskError("", errors.Wrap(err, "error storing packet capture"))
+	}
+	a.storeFile("tcpdump.txt", log)
+}
@@ -0,0 +1,85 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// useFakeTcpdump puts a tcpdump shell script running script first on the
+// PATH.
+func useFakeTcpdump(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake tcpdump is a shell script")
+	}
+	bin := t.TempDir()
+	path := filepath.Join(bin, "tcpdump")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o700); err != nil { // nolint: gosec
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCapture(t *testing.T) {
+	args := filepath.Join(t.TempDir(), "args")
+	t.Setenv("TCPDUMP_ARGS", args)
+	useFakeTcpdump(t, `printf '%s\n' "$*" > "$TCPDUMP_ARGS"
+while [ $# -gt 1 ]; do
+	if [ "$1" = "-w" ]; then out=$2; fi
+	shift
+done
+trap 'printf packets > "$out"; echo "3 packets captured" >&2; exit 0' INT
+while :; do sleep 0.05; done
+`)
+
+	// .invalid names never resolve (RFC 6761), so the host is left out of
+	// the filter.
+	c, err := startCapture(context.Background(), []string{"127.0.0.1", "capture.invalid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.stopCapture(c)
+
+	if got := string(storedContents(t, a, "capture.pcap")); got != "packets" {
+		t.Errorf("capture.pcap = %q", got)
+	}
+	if got := string(storedContents(t, a, "tcpdump.txt")); got != "3 packets captured\n" {
+		t.Errorf("tcpdump.txt = %q", got)
+	}
+	if _, err := os.Stat(c.dir); !os.IsNotExist(err) {
+		t.Errorf("the capture directory was not removed: %v", err)
+	}
+
+	b, err := os.ReadFile(args) // nolint: gosec
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "host 127.0.0.1 or port 53 or port 853 or icmp or icmp6\n"
+	if !strings.HasSuffix(string(b), want) || !strings.HasPrefix(string(b), "-n -U -s "+captureSnapLen) {
+		t.Errorf("tcpdump was run with %q", b)
+	}
+}
+
+func TestStartCaptureFailure(t *testing.T) {
+	useFakeTcpdump(t, "echo 'tcpdump: any: You do not have permission to capture' >&2\nexit 1\n")
+
+	_, err := startCapture(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "You do not have permission") {
+		t.Errorf("startCapture = %v", err)
+	}
+}
+
+func TestStartCaptureWithoutTcpdump(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+
+	_, err := startCapture(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "which --pcap requires") {
+		t.Errorf("startCapture = %v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	// defaultPingCount and defaultPingInterval are used unless
+	// --ping-count or --ping-interval are given.
+	defaultPingCount    = 30
+	defaultPingInterval = time.Second
+	pingTimeout         = 2 * time.Second
+
+	protocolICMP   = 1
+	protocolICMPv6 = 58
+)
+
+// pingReply is the outcome of a single echo request. rtt is zero if no
+// reply was received.
+type pingReply struct {
+	seq int
+	rtt time.Duration
+}
+
+// pingResult holds the outcome of pinging a host.
+type pingResult struct {
+	host       string
+	addr       string
+	privileged bool
+	replies    []pingReply
+}
+
+// pingStats summarizes the replies in a pingResult. jitter is the mean
+// difference between the round-trip times of consecutive replies, as in
+// RFC 3550. A loss burst is a run of consecutive requests without a reply;
+// loss in bursts points at congestion or a flapping link rather than at
+// random drops.
+type pingStats struct {
+	sent             int
+	received         int
+	min              time.Duration
+	avg              time.Duration
+	max              time.Duration
+	stddev           time.Duration
+	jitter           time.Duration
+	lossBursts       int
+	longestLossBurst int
+}
+
+func (a *analyzer) createPingTask(f, network, host string) *task {
+	jsonFile := taskName(f) + ".json"
+	t := newTask(f, func(ctx context.Context) {
+		result, err := ping(ctx, network, host, a.pingCount, a.pingInterval)
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+		}
+		if result != nil {
+			a.storeFile(f, result.format())
+		}
+		report := result.report(host, err)
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", jsonFile))
+		} else {
+			a.storeFile(jsonFile, b)
+		}
+		a.storeResult(taskName(f), report)
+	}).withTags(tagRouting).
+		withDescription(
+			"Sends %d ICMP echo requests to %s over %s every %s, measuring loss and jitter",
+			a.pingCount, host, familyName(network), a.pingInterval,
+		).
+		withPrivileges("root, or permission to open unprivileged ICMP sockets")
+	t.outputs = append(t.outputs, jsonFile)
+	// A long probe train needs longer than the default timeout.
+	if train := time.Duration(a.pingCount)*a.pingInterval + pingTimeout; train > defaultTaskTimeout {
+		t.withTimeout(train + pingTimeout)
+	}
+	return t
+}
+
+// ping sends count ICMP echo requests to host over network ("ip4" or
+// "ip6"), one every interval. It uses a raw socket when permitted and
+// falls back to an unprivileged datagram socket otherwise. If ctx is done
+// before all of the requests are sent, the replies so far are returned
+// with ctx.Err().
+func ping(ctx context.Context, network, host string, count int, interval time.Duration) (*pingResult, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error looking up %s", host)
+	}
+	ip := ips[0]
+
+	conn, privileged, err := listenICMP(ctx, network)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	r := &pingResult{
+		host:       host,
+		addr:       ip.String(),
+		privileged: privileged,
+	}
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if !privileged {
+		dst = &net.UDPAddr{IP: ip}
+	}
+
+	var echoType icmp.Type = ipv4.ICMPTypeEcho
+	proto := protocolICMP
+	if network == "ip6" {
+		echoType = ipv6.ICMPTypeEchoRequest
+		proto = protocolICMPv6
+	}
+
+	// The kernel rewrites the ID for unprivileged sockets, so we only
+	// check it when using a raw socket.
+	id := os.Getpid() & 0xffff
+	for seq := 0; seq < count; seq++ {
+		sent := time.Now()
+		msg := icmp.Message{
+			Type: echoType,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("mm-network-analyzer")},
+		}
+		b, err := msg.Marshal(nil)
+		if err != nil {
+			return r, errors.Wrap(err, "error creating echo request")
+		}
+		if _, err := conn.WriteTo(b, dst); err != nil {
+			return r, errors.Wrap(err, "error sending echo request")
+		}
+
+		reply := pingReply{seq: seq}
+		if err := conn.SetReadDeadline(sent.Add(pingTimeout)); err != nil {
+			return r, errors.Wrap(err, "error setting read deadline")
+		}
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				// Timeout; the request is counted as lost.
+				break
+			}
+			m, err := icmp.ParseMessage(proto, buf[:n])
+			if err != nil {
+				continue
+			}
+			echo, ok := m.Body.(*icmp.Echo)
+			if !ok || echo.Seq != seq || (privileged && echo.ID != id) {
+				continue
+			}
+			if m.Type != ipv4.ICMPTypeEchoReply && m.Type != ipv6.ICMPTypeEchoReply {
+				continue
+			}
+			reply.rtt = time.Since(sent)
+			break
+		}
+		r.replies = append(r.replies, reply)
+
+		if seq < count-1 {
+			if err := sleepContext(ctx, time.Until(sent.Add(interval))); err != nil {
+				return r, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// listenICMP listens for ICMP on network, "ip4" or "ip6", with the source
+// address of the task running with ctx.
+func listenICMP(ctx context.Context, network string) (*icmp.PacketConn, bool, error) {
+	rawNetwork, udpNetwork := "ip4:icmp", "udp4"
+	if network == "ip6" {
+		rawNetwork, udpNetwork = "ip6:ipv6-icmp", "udp6"
+	}
+	rawAddr := dialConfigFromContext(ctx).listenAddr(network)
+
+	conn, rawErr := icmp.ListenPacket(rawNetwork, rawAddr)
+	if rawErr == nil {
+		return conn, true, nil
+	}
+	conn, err := icmp.ListenPacket(udpNetwork, rawAddr)
+	if err != nil {
+		return nil, false, errors.Wrapf(
+			err,
+			"error opening unprivileged ICMP socket after raw socket failed (%v)",
+			rawErr,
+		)
+	}
+	return conn, false, nil
+}
+
+func (r *pingResult) stats() pingStats {
+	s := pingStats{sent: len(r.replies)}
+	var sum float64
+	var jitterSum, prev time.Duration
+	var pairs, burst int
+	for _, reply := range r.replies {
+		if reply.rtt == 0 {
+			burst++
+			if burst == 1 {
+				s.lossBursts++
+			}
+			s.longestLossBurst = max(s.longestLossBurst, burst)
+			continue
+		}
+		burst = 0
+		if s.received == 0 || reply.rtt < s.min {
+			s.min = reply.rtt
+		}
+		if reply.rtt > s.max {
+			s.max = reply.rtt
+		}
+		if prev != 0 {
+			jitterSum += (reply.rtt - prev).Abs()
+			pairs++
+		}
+		prev = reply.rtt
+		s.received++
+		sum += float64(reply.rtt)
+	}
+	if pairs > 0 {
+		s.jitter = jitterSum / time.Duration(pairs)
+	}
+	if s.received == 0 {
+		return s
+	}
+	mean := sum / float64(s.received)
+	var variance float64
+	for _, reply := range r.replies {
+		if reply.rtt == 0 {
+			continue
+		}
+		d := float64(reply.rtt) - mean
+		variance += d * d
+	}
+	s.avg = time.Duration(mean)
+	s.stddev = time.Duration(math.Sqrt(variance / float64(s.received)))
+	return s
+}
+
+func (s pingStats) loss() float64 {
+	if s.sent == 0 {
+		return 0
+	}
+	return 100 * float64(s.sent-s.received) / float64(s.sent)
+}
+
+func (r *pingResult) format() []byte {
+	buf := new(bytes.Buffer)
+
+	socket := "raw socket"
+	if !r.privileged {
+		socket = "unprivileged datagram socket"
+	}
+	fmt.Fprintf(buf, "PING %s (%s) using %s\n", r.host, r.addr, socket)
+	for _, reply := range r.replies {
+		if reply.rtt == 0 {
+			fmt.Fprintf(buf, "seq=%d timeout\n", reply.seq)
+			continue
+		}
+		fmt.Fprintf(buf, "seq=%d time=%s\n", reply.seq, reply.rtt)
+	}
+
+	s := r.stats()
+	fmt.Fprintf(buf, "\n--- %s ping statistics ---\n", r.host)
+	fmt.Fprintf(
+		buf,
+		"%d packets transmitted, %d received, %.1f%% packet loss\n",
+		s.sent,
+		s.received,
+		s.loss(),
+	)
+	if s.received > 0 {
+		fmt.Fprintf(buf, "rtt min/avg/max/stddev = %s/%s/%s/%s\n", s.min, s.avg, s.max, s.stddev)
+		fmt.Fprintf(buf, "jitter = %s\n", s.jitter)
+	}
+	if s.lossBursts > 0 {
+		fmt.Fprintf(buf, "%d loss bursts, the longest of %d requests\n", s.lossBursts, s.longestLossBurst)
+	}
+	return buf.Bytes()
+}
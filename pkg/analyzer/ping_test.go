@@ -0,0 +1,121 @@
+package analyzer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testPingResult(rtts ...time.Duration) *pingResult {
+	r := &pingResult{host: "example.com", addr: "192.0.2.1", privileged: true}
+	for i, rtt := range rtts {
+		r.replies = append(r.replies, pingReply{seq: i, rtt: rtt})
+	}
+	return r
+}
+
+func TestPingStats(t *testing.T) {
+	ms := time.Millisecond
+	s := testPingResult(10*ms, 0, 20*ms, 30*ms).stats()
+	if s.sent != 4 || s.received != 3 {
+		t.Errorf("sent %d and received %d", s.sent, s.received)
+	}
+	if s.min != 10*ms || s.avg != 20*ms || s.max != 30*ms {
+		t.Errorf("min/avg/max = %s/%s/%s", s.min, s.avg, s.max)
+	}
+	// The population standard deviation of 10, 20, and 30 is 8.165.
+	if s.stddev < 8160*time.Microsecond || s.stddev > 8170*time.Microsecond {
+		t.Errorf("stddev = %s", s.stddev)
+	}
+	if got := s.loss(); got != 25 {
+		t.Errorf("loss = %f", got)
+	}
+
+	s = testPingResult(0, 0).stats()
+	if s.received != 0 || s.loss() != 100 || s.min != 0 || s.avg != 0 {
+		t.Errorf("stats with every request lost = %+v", s)
+	}
+	if got := (pingStats{}).loss(); got != 0 {
+		t.Errorf("loss without requests = %f", got)
+	}
+}
+
+func TestPingJitterAndLossBursts(t *testing.T) {
+	ms := time.Millisecond
+	r := testPingResult(10*ms, 0, 0, 20*ms, 0, 25*ms)
+	s := r.stats()
+	// The lost requests are skipped, so the differences are 10ms and 5ms.
+	if s.jitter != 7500*time.Microsecond {
+		t.Errorf("jitter = %s", s.jitter)
+	}
+	if s.lossBursts != 2 || s.longestLossBurst != 2 {
+		t.Errorf("%d loss bursts, the longest of %d", s.lossBursts, s.longestLossBurst)
+	}
+	out := string(r.format())
+	for _, want := range []string{"jitter = 7.5ms\n", "2 loss bursts, the longest of 2 requests\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the output does not contain %q:\n%s", want, out)
+		}
+	}
+	pr := r.report("example.com", nil)
+	if pr.JitterMS != 7.5 || pr.LossBursts != 2 || pr.LongestLossBurst != 2 {
+		t.Errorf("report = %+v", pr)
+	}
+
+	if s := testPingResult(10 * ms).stats(); s.jitter != 0 || s.lossBursts != 0 {
+		t.Errorf("stats of one reply = %+v", s)
+	}
+}
+
+func TestPingTaskTimeout(t *testing.T) {
+	a := &analyzer{pingCount: defaultPingCount, pingInterval: defaultPingInterval}
+	task := a.createPingTask("example.com-ping-ipv4.txt", "ip4", "example.com")
+	if task.timeout != 0 {
+		t.Errorf("the default probe train has the timeout %s", task.timeout)
+	}
+	if got := strings.Join(task.outputs, ","); got != "example.com-ping-ipv4.txt,example.com-ping-ipv4.json" {
+		t.Errorf("outputs = %s", got)
+	}
+
+	// A longer train than fits in the default timeout gets its own.
+	a.pingCount = 100
+	if task := a.createPingTask("example.com-ping-ipv4.txt", "ip4", "example.com"); task.timeout != 104*time.Second {
+		t.Errorf("100 requests have the timeout %s", task.timeout)
+	}
+}
+
+func TestPingFormat(t *testing.T) {
+	ms := time.Millisecond
+	out := string(testPingResult(10*ms, 0, 20*ms).format())
+	for _, want := range []string{
+		"PING example.com (192.0.2.1) using raw socket",
+		"seq=0 time=10ms",
+		"seq=1 timeout",
+		"3 packets transmitted, 2 received, 33.3% packet loss",
+		"rtt min/avg/max/stddev = 10ms/15ms/20ms/5ms",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("the output does not contain %q:\n%s", want, out)
+		}
+	}
+
+	r := testPingResult(0)
+	r.privileged = false
+	out = string(r.format())
+	if !strings.Contains(out, "unprivileged datagram socket") || strings.Contains(out, "rtt min") {
+		t.Errorf("output without replies:\n%s", out)
+	}
+}
+
+func TestPingLoopback(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r, err := ping(ctx, "ip4", "127.0.0.1", 2, 10*time.Millisecond)
+	if err != nil {
+		t.Skipf("cannot ping without privileges here: %v", err)
+	}
+	if s := r.stats(); s.sent != 2 || s.received != 2 {
+		t.Errorf("sent %d and received %d pinging the loopback address", s.sent, s.received)
+	}
+}
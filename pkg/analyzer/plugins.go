@@ -0,0 +1,101 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// tagPlugin is the tag of every plugin task.
+const tagPlugin = "plugin"
+
+// pluginStderrLimit is how much of a failed plugin's standard error is
+// kept and included in the error. As with task output, the start and end
+// are kept.
+const pluginStderrLimit = 4096
+
+// pluginTasks returns a task for each plugin in dir, if set, and each path
+// in paths. A plugin is an executable that writes its diagnostics to
+// standard output.
+func (a *analyzer) pluginTasks(dir string, paths []string) ([]*task, error) {
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading plugins directory %s", dir)
+		}
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil || !info.Mode().IsRegular() || !isExecutable(info) {
+				slog.Debug("skipping non-executable file in plugins directory", "file", e.Name())
+				continue
+			}
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	var tasks []*task
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error finding plugin %s", p)
+		}
+		tasks = append(tasks, a.createPluginTask(abs))
+	}
+	return tasks, nil
+}
+
+// isExecutable returns true if the file may be run as a plugin. On
+// Windows, this is decided by the extension.
+func isExecutable(info os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		switch strings.ToLower(filepath.Ext(info.Name())) {
+		case ".exe", ".bat", ".cmd", ".com":
+			return true
+		}
+		return false
+	}
+	return info.Mode().Perm()&0o111 != 0
+}
+
+// createPluginTask returns a task that runs the plugin at path and stores
+// its standard output in plugin-<name>.txt. The plugin's environment has
+// these variables in addition to the analyzer's:
+//
+//	MM_NETWORK_ANALYZER_HOSTS    the hosts being diagnosed, comma separated
+//	MM_NETWORK_ANALYZER_VERSION  the version of the analyzer
+//	MM_NETWORK_ANALYZER_FAMILY   "4" or "6" with --ipv4 or --ipv6
+func (a *analyzer) createPluginTask(path string) *task {
+	base := filepath.Base(path)
+	f := "plugin-" + strings.TrimSuffix(base, filepath.Ext(base)) + ".txt"
+	t := newTask(f, func(ctx context.Context) {
+		cmd := commandContext(ctx, path)
+		cmd.Env = append(
+			os.Environ(),
+			"MM_NETWORK_ANALYZER_HOSTS="+strings.Join(a.hosts, ","),
+			"MM_NETWORK_ANALYZER_VERSION="+currentBuild().Version,
+			"MM_NETWORK_ANALYZER_FAMILY="+a.dial.addressFamily(),
+		)
+		stdout := a.newTaskOutput()
+		stderr := newCappedBuffer(pluginStderrLimit)
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+		err := cmd.Run()
+		if cmd.ProcessState != nil {
+			exitCode := cmd.ProcessState.ExitCode()
+			taskRecordFromContext(ctx).ExitCode = &exitCode
+		}
+		if err != nil {
+			msg := bytes.TrimSpace(stderr.Bytes())
+			a.storeError(ctx, errors.Wrapf(err, "error running plugin %s: %s", path, msg))
+		}
+		a.storeOutput(ctx, f, stdout)
+	})
+	t.command = []string{path}
+	return t.withTags(tagPlugin).withDescription("Runs the plugin %s", path)
+}
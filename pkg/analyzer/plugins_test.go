@@ -0,0 +1,66 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func writePlugin(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugins are shell scripts")
+	}
+	path := filepath.Join(t.TempDir(), "check.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o700); err != nil { // nolint: gosec
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPluginTask(t *testing.T) {
+	path := writePlugin(t, `echo "$MM_NETWORK_ANALYZER_HOSTS $MM_NETWORK_ANALYZER_FAMILY"`)
+	a := &analyzer{hosts: []string{"a.example", "b.example"}, dial: &dialConfig{family: "6"}}
+	defer a.removeSpool()
+	a.createPluginTask(path).run(context.Background())
+
+	if got := string(storedContents(t, a, "plugin-check.txt")); got != "a.example,b.example 6\n" {
+		t.Errorf("plugin output = %q", got)
+	}
+	if len(a.errors) != 0 {
+		t.Errorf("errors = %v", a.errors[0].err)
+	}
+}
+
+func TestPluginStderrIsBounded(t *testing.T) {
+	path := writePlugin(t, `
+echo "first line of stderr" >&2
+i=0
+while [ $i -lt 5000 ]; do echo "noise noise noise noise" >&2; i=$((i+1)); done
+echo "last line of stderr" >&2
+echo "stdout"
+exit 3
+`)
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.createPluginTask(path).run(context.Background())
+
+	if len(a.errors) != 1 {
+		t.Fatalf("got %d errors, want 1", len(a.errors))
+	}
+	msg := a.errors[0].err.Error()
+	if len(msg) > pluginStderrLimit+len(path)+100 {
+		t.Errorf("the error is %d bytes long", len(msg))
+	}
+	for _, want := range []string{"first line of stderr", "last line of stderr", "bytes truncated", "exit status 3"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("the error does not contain %q", want)
+		}
+	}
+	if got := string(storedContents(t, a, "plugin-check.txt")); got != "stdout\n" {
+		t.Errorf("plugin output = %q", got)
+	}
+}
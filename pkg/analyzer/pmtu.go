@@ -0,0 +1,299 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	pmtuTimeout  = time.Second
+	pmtuAttempts = 2
+
+	// These are the smallest packets every IPv4 and IPv6 link must carry.
+	pmtuMinIPv4 = 68
+	pmtuMinIPv6 = 1280
+)
+
+// Outcomes of a path MTU probe.
+const (
+	pmtuReply      = "reply"
+	pmtuTooBig     = "too-big"
+	pmtuTimedOut   = "timeout"
+	pmtuLocalLimit = "local-too-big"
+)
+
+// pmtuProbe is the outcome of sending echo requests of one size with the
+// Don't Fragment bit set. Size includes the IP header.
+type pmtuProbe struct {
+	Size   int    `json:"size"`
+	Result string `json:"result"`
+	// ReportedMTU is the MTU from a "fragmentation needed" or "packet too
+	// big" message.
+	ReportedMTU int    `json:"reported_mtu,omitempty"`
+	From        string `json:"from,omitempty"`
+}
+
+// pmtuResult is the path MTU to a host. A blackhole is a router that drops
+// packets that are too big for the next link without telling the sender,
+// which stalls TCP connections once they send full-sized segments.
+type pmtuResult struct {
+	Host     string       `json:"host"`
+	Address  string       `json:"address"`
+	Network  string       `json:"network"`
+	LocalMTU int          `json:"local_mtu"`
+	PathMTU  int          `json:"path_mtu,omitempty"`
+	Probes   []*pmtuProbe `json:"probes"`
+	// Blackhole is true if packets that fit the local interface are
+	// dropped without any router reporting that they are too big.
+	Blackhole bool   `json:"blackhole"`
+	Error     string `json:"error,omitempty"`
+}
+
+// pmtuProber sends echo requests of varying sizes to a single address.
+type pmtuProber struct {
+	conn    net.PacketConn
+	network string
+	dst     net.IP
+	id      int
+	seq     int
+}
+
+func (a *analyzer) createPMTUTask(f, network, host string) *task {
+	return newTask(f, func(ctx context.Context) {
+		result, err := discoverPMTU(ctx, network, host)
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+			if result == nil {
+				return
+			}
+			result.Error = err.Error()
+		}
+		b, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", f))
+			return
+		}
+		a.storeFile(f, b)
+		a.storeResult(taskName(f), result)
+	}).withTags(tagRouting).
+		withDescription(
+			"Measures the path MTU to %s over %s with Don't Fragment echo requests",
+			host,
+			familyName(network),
+		).
+		withPrivileges("root")
+}
+
+// discoverPMTU finds the largest echo request that reaches host over
+// network ("ip4" or "ip6") without fragmentation by binary search between
+// the smallest size every link must carry and the MTU of the outgoing
+// interface. Like traceroute, it requires a raw ICMP socket so that the
+// errors from routers along the path are received.
+func discoverPMTU(ctx context.Context, network, host string) (*pmtuResult, error) {
+	dial := dialConfigFromContext(ctx)
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error looking up %s", host)
+	}
+	r := &pmtuResult{Host: host, Address: ips[0].String(), Network: network}
+
+	r.LocalMTU, err = dial.interfaceMTU(network, ips[0])
+	if err != nil {
+		return r, err
+	}
+
+	rawNetwork := "ip4:icmp"
+	if network == "ip6" {
+		rawNetwork = "ip6:ipv6-icmp"
+	}
+	lc := net.ListenConfig{
+		Control: func(_, address string, c syscall.RawConn) error {
+			if err := dial.bindControl(rawNetwork, address, c); err != nil {
+				return err
+			}
+			return setDontFragment(c, network)
+		},
+	}
+	conn, err := lc.ListenPacket(ctx, rawNetwork, dial.listenAddr(network))
+	if err != nil {
+		return r, errors.Wrap(err, "error opening raw ICMP socket (path MTU discovery requires root)")
+	}
+	defer conn.Close()
+
+	p := &pmtuProber{
+		conn:    conn,
+		network: network,
+		dst:     ips[0],
+		// Use a different ID than ping and traceroute so that they can
+		// all run at the same time.
+		id: (os.Getpid() + 2) & 0xffff,
+	}
+
+	good := pmtuMinIPv4
+	if network == "ip6" {
+		good = pmtuMinIPv6
+	}
+	probe, err := p.probe(ctx, good)
+	if err != nil {
+		return r, err
+	}
+	r.Probes = append(r.Probes, probe)
+	if probe.Result != pmtuReply {
+		return r, errors.Errorf("no reply to %d byte echo requests; ICMP may be blocked", good)
+	}
+
+	// The loopback interface's MTU can exceed the largest IP packet.
+	bad := min(r.LocalMTU, 65535) + 1
+	next := bad - 1
+	reported, timedOut := false, false
+	for good+1 < bad {
+		probe, err := p.probe(ctx, next)
+		if err != nil {
+			return r, err
+		}
+		r.Probes = append(r.Probes, probe)
+
+		switch probe.Result {
+		case pmtuReply:
+			good = next
+		case pmtuTooBig:
+			reported = true
+			bad = next
+			// Try the reported MTU next when it is plausible, which
+			// saves most of the search.
+			if probe.ReportedMTU > good && probe.ReportedMTU < bad {
+				next = probe.ReportedMTU
+				continue
+			}
+		case pmtuTimedOut:
+			timedOut = true
+			bad = next
+		default:
+			bad = next
+		}
+		next = good + (bad-good)/2
+	}
+	r.PathMTU = good
+	r.Blackhole = timedOut && !reported
+	return r, nil
+}
+
+// probe sends echo requests of size bytes, including the IP header, until
+// an attempt is answered or pmtuAttempts have timed out.
+func (p *pmtuProber) probe(ctx context.Context, size int) (*pmtuProbe, error) {
+	hdrLen, echoType := 20, icmp.Type(ipv4.ICMPTypeEcho)
+	if p.network == "ip6" {
+		hdrLen, echoType = 40, ipv6.ICMPTypeEchoRequest
+	}
+
+	result := &pmtuProbe{Size: size, Result: pmtuTimedOut}
+	for range pmtuAttempts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		p.seq = (p.seq + 1) & 0xffff
+		msg := icmp.Message{
+			Type: echoType,
+			Body: &icmp.Echo{ID: p.id, Seq: p.seq, Data: make([]byte, size-hdrLen-8)},
+		}
+		b, err := msg.Marshal(nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating echo request")
+		}
+		if _, err := p.conn.WriteTo(b, &net.IPAddr{IP: p.dst}); err != nil {
+			if errors.Is(err, syscall.EMSGSIZE) {
+				result.Result = pmtuLocalLimit
+				return result, nil
+			}
+			return nil, errors.Wrap(err, "error sending echo request")
+		}
+		if p.receive(result) {
+			return result, nil
+		}
+	}
+	return result, nil
+}
+
+// receive waits for a reply or error for the current sequence number and
+// records it in result. It returns false on timeout.
+func (p *pmtuProber) receive(result *pmtuProbe) bool {
+	proto := protocolICMP
+	if p.network == "ip6" {
+		proto = protocolICMPv6
+	}
+	if err := p.conn.SetReadDeadline(time.Now().Add(pmtuTimeout)); err != nil {
+		return false
+	}
+	buf := make([]byte, 65536)
+	for {
+		n, peer, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			return false
+		}
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+
+		switch body := m.Body.(type) {
+		case *icmp.Echo:
+			if body.ID != p.id || body.Seq != p.seq ||
+				(m.Type != ipv4.ICMPTypeEchoReply && m.Type != ipv6.ICMPTypeEchoReply) {
+				continue
+			}
+			result.Result = pmtuReply
+		case *icmp.DstUnreach:
+			// Code 4 is "fragmentation needed and DF set". The next-hop
+			// MTU is in the otherwise unused second half of the header,
+			// which icmp does not parse.
+			if m.Code != 4 || !p.quotesEcho(body.Data) {
+				continue
+			}
+			result.Result = pmtuTooBig
+			result.ReportedMTU = int(binary.BigEndian.Uint16(buf[6:8]))
+		case *icmp.PacketTooBig:
+			if !p.quotesEcho(body.Data) {
+				continue
+			}
+			result.Result = pmtuTooBig
+			result.ReportedMTU = body.MTU
+		default:
+			continue
+		}
+		if ipAddr, ok := peer.(*net.IPAddr); ok {
+			result.From = ipAddr.IP.String()
+		}
+		return true
+	}
+}
+
+// quotesEcho returns true if the ICMP error data quotes the current echo
+// request.
+func (p *pmtuProber) quotesEcho(data []byte) bool {
+	proto, payload, ok := quotedDatagram(p.network, data)
+	if !ok || (proto != protocolICMP && proto != protocolICMPv6) {
+		return false
+	}
+	return int(binary.BigEndian.Uint16(payload[4:6])) == p.id &&
+		int(binary.BigEndian.Uint16(payload[6:8])) == p.seq
+}
+
+// interfaceMTU returns the MTU of the interface that packets to ip leave
+// from.
+func (d *dialConfig) interfaceMTU(network string, ip net.IP) (int, error) {
+	iface, err := d.routeInterface(network, ip)
+	if err != nil {
+		return 0, err
+	}
+	return iface.MTU, nil
+}
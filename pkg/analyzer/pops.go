@@ -0,0 +1,82 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// popSamples is the number of connections the POP task makes.
+const popSamples = 10
+
+// popSample identifies the server that answered one connection.
+type popSample struct {
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Edge       *edgeInfo `json:"edge,omitempty"`
+	// CertSerial is the serial number of the leaf certificate. Edges of a
+	// CDN may present different certificates for the same name.
+	CertSerial string  `json:"cert_serial,omitempty"`
+	TotalMS    float64 `json:"total_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// popReport shows whether repeated connections to an anycast address
+// reach the same edge. A client that bounces between edges sees latency
+// that varies for no apparent reason.
+type popReport struct {
+	URL     string       `json:"url"`
+	Samples []*popSample `json:"samples"`
+	// POPs, Addresses, and CertSerials are the distinct values seen, in
+	// the order in which they were first seen.
+	POPs        []string `json:"pops,omitempty"`
+	Addresses   []string `json:"addresses,omitempty"`
+	CertSerials []string `json:"cert_serials,omitempty"`
+}
+
+func (a *analyzer) createPOPTask(f, host string) *task {
+	url := "https://" + host + "/"
+	return newTask(f, func(ctx context.Context) {
+		r := identifyPOPs(ctx, url)
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", f))
+			return
+		}
+		a.storeFile(f, b)
+		a.storeResult(taskName(f), r)
+	}).withTags(tagHTTP).
+		withDescription("Connects to %s %d times, recording which CDN edge answers each connection", url, popSamples)
+}
+
+func identifyPOPs(ctx context.Context, url string) *popReport {
+	r := &popReport{URL: url}
+	for i := 0; i < popSamples && ctx.Err() == nil; i++ {
+		result, err := traceHTTP(ctx, dialConfigFromContext(ctx).restrictNetwork("tcp"), url)
+		s := &popSample{
+			RemoteAddr: result.remoteAddr,
+			Edge:       newEdgeInfo(result.header),
+			TotalMS:    durationMS(result.totalDuration()),
+			Error:      errorString(err),
+		}
+		if result.tlsState != nil && len(result.tlsState.PeerCertificates) > 0 {
+			s.CertSerial = fmt.Sprintf("%x", result.tlsState.PeerCertificates[0].SerialNumber)
+		}
+		r.Samples = append(r.Samples, s)
+		if err != nil {
+			continue
+		}
+		if s.Edge != nil && s.Edge.POP != "" && !slices.Contains(r.POPs, s.Edge.POP) {
+			r.POPs = append(r.POPs, s.Edge.POP)
+		}
+		if s.RemoteAddr != "" && !slices.Contains(r.Addresses, s.RemoteAddr) {
+			r.Addresses = append(r.Addresses, s.RemoteAddr)
+		}
+		if s.CertSerial != "" && !slices.Contains(r.CertSerials, s.CertSerial) {
+			r.CertSerials = append(r.CertSerials, s.CertSerial)
+		}
+	}
+	return r
+}
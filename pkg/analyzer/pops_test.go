@@ -0,0 +1,54 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestIdentifyPOPs(t *testing.T) {
+	var n atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		pop := "IAD"
+		if n.Add(1)%3 == 0 {
+			pop = "EWR"
+		}
+		w.Header().Set("CF-Ray", "8a1b2c3d4e5f6789-"+pop)
+	}))
+	defer server.Close()
+
+	r := identifyPOPs(context.Background(), server.URL+"/")
+	if len(r.Samples) != popSamples {
+		t.Fatalf("%d samples", len(r.Samples))
+	}
+	if want := []string{"IAD", "EWR"}; !reflect.DeepEqual(r.POPs, want) {
+		t.Errorf("POPs = %v, want %v", r.POPs, want)
+	}
+	if want := []string{server.Listener.Addr().String()}; !reflect.DeepEqual(r.Addresses, want) {
+		t.Errorf("addresses = %v, want %v", r.Addresses, want)
+	}
+	// The server does not use TLS.
+	if r.CertSerials != nil || r.Samples[0].CertSerial != "" {
+		t.Errorf("certificate serials = %v", r.CertSerials)
+	}
+}
+
+func TestPOPFindings(t *testing.T) {
+	fs := findingsFor(map[string]interface{}{
+		"geoip.maxmind.com-pops": &popReport{URL: "https://geoip.maxmind.com/", POPs: []string{"IAD", "EWR"}},
+	})
+	want := "connections to https://geoip.maxmind.com/ were served by 2 CDN edges (IAD, EWR), " +
+		"so latency may vary between requests"
+	if len(fs) != 1 || fs[0].Check != "pop-bouncing" || fs[0].Summary != want {
+		t.Errorf("findings = %+v", fs)
+	}
+	fs = findingsFor(map[string]interface{}{
+		"geoip.maxmind.com-pops": &popReport{URL: "https://geoip.maxmind.com/", POPs: []string{"IAD"}},
+	})
+	if len(fs) != 0 {
+		t.Errorf("findings for one edge = %+v", fs)
+	}
+}
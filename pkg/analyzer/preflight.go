@@ -0,0 +1,50 @@
+package analyzer
+
+import (
+	"log/slog"
+	"os/exec"
+	"strings"
+)
+
+// preflight checks that the tools each task needs are installed. Tasks
+// with a missing tool are replaced by their native fallback, if they have
+// one, and are otherwise marked so that they are skipped with a clear note
+// rather than failing with an exec error.
+func preflight(tasks []*task) []*task {
+	installed := map[string]bool{}
+	checked := []*task{}
+	for _, t := range tasks {
+		var missing []string
+		for _, tool := range t.tools {
+			ok, seen := installed[tool]
+			if !seen {
+				_, err := exec.LookPath(tool)
+				ok = err == nil
+				installed[tool] = ok
+			}
+			if !ok {
+				missing = append(missing, tool)
+			}
+		}
+		if len(missing) == 0 {
+			checked = append(checked, t)
+			continue
+		}
+
+		if t.fallback != nil {
+			fb := t.fallback
+			fb.name = t.name
+			fb.tags = t.tags
+			fb.timeout = t.timeout
+			fb.description += " as " + strings.Join(missing, ", ") + " is not installed"
+			slog.Info("using native fallback", "task", t.name, "missing", missing)
+			checked = append(checked, fb)
+			continue
+		}
+
+		slog.Warn("task will be skipped as a tool is not installed", "task", t.name, "missing", missing)
+		t.missingTools = missing
+		checked = append(checked, t)
+	}
+	return checked
+}
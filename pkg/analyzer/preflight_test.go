@@ -0,0 +1,59 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreflight(t *testing.T) {
+	const missingTool = "mm-network-analyzer-no-such-tool"
+	installed := newTask("installed.txt", nil).withTools(os.Args[0])
+	fallback := newTask("mtr.txt", nil).withDescription("Traces the route natively")
+	withFallback := newTask("mtr.txt", nil).
+		withTools(missingTool).
+		withTags(tagRouting).
+		withTimeout(time.Minute).
+		withFallback(fallback)
+	skipped := newTask("dig.txt", nil).withTools(missingTool, os.Args[0])
+
+	tasks := preflight([]*task{installed, withFallback, skipped})
+	if len(tasks) != 3 || tasks[0] != installed || tasks[1] != fallback || tasks[2] != skipped {
+		t.Fatalf("preflight = %v", tasks)
+	}
+	if installed.missingTools != nil {
+		t.Errorf("%s is missing %v", installed.name, installed.missingTools)
+	}
+	// The fallback takes the place of the task.
+	if fallback.name != "mtr" || !fallback.matches(tagRouting) || fallback.timeout != time.Minute {
+		t.Errorf("fallback = %+v", fallback)
+	}
+	if want := "Traces the route natively as " + missingTool + " is not installed"; fallback.description != want {
+		t.Errorf("fallback description = %q", fallback.description)
+	}
+	if !reflect.DeepEqual(skipped.missingTools, []string{missingTool}) {
+		t.Errorf("%s is missing %v", skipped.name, skipped.missingTools)
+	}
+}
+
+func TestRunTaskWithMissingTool(t *testing.T) {
+	a := &analyzer{}
+	ran := false
+	dig := newTask("dig.txt", func(context.Context) { ran = true })
+	dig.missingTools = []string{"dig"}
+	a.runTasks(context.Background(), []*task{dig}, 1, time.Minute)
+
+	if ran {
+		t.Error("the task ran without its tool")
+	}
+	if r := a.taskRecords[0]; r.Status != taskStatusToolMissing {
+		t.Errorf("status = %s", r.Status)
+	}
+	want := "task dig was skipped as dig is not installed"
+	if len(a.errors) != 1 || !strings.Contains(a.errors[0].err.Error(), want) {
+		t.Errorf("errors = %v", a.errors)
+	}
+}
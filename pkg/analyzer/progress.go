@@ -0,0 +1,65 @@
+package analyzer
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// progress reports the tasks as they start and finish so that the user can
+// see that a long run is doing something.
+type progress struct {
+	mu       sync.Mutex
+	w        io.Writer
+	start    time.Time
+	total    int
+	finished int
+	running  map[string]time.Time
+}
+
+func newProgress(w io.Writer, total int) *progress {
+	return &progress{
+		w:       w,
+		start:   time.Now(),
+		total:   total,
+		running: map[string]time.Time{},
+	}
+}
+
+func (p *progress) taskStarted(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.running[name] = time.Now()
+	p.printf("started %s", name)
+}
+
+func (p *progress) taskFinished(name string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	took := time.Since(p.running[name]).Round(100 * time.Millisecond)
+	delete(p.running, name)
+	p.finished++
+	p.printf("finished %s in %s; %d remaining", name, took, p.total-p.finished)
+}
+
+// printf writes a line prefixed with the number of tasks finished and the
+// time elapsed. p.mu must be held.
+func (p *progress) printf(format string, args ...interface{}) {
+	fmt.Fprintf(
+		p.w,
+		"[%d/%d done, %s elapsed] %s\n",
+		p.finished,
+		p.total,
+		time.Since(p.start).Round(time.Second),
+		fmt.Sprintf(format, args...),
+	)
+}
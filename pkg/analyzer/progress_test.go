@@ -0,0 +1,61 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(&buf, 2)
+	p.taskStarted("dig")
+	p.taskStarted("ping")
+	p.taskFinished("dig")
+	p.taskFinished("ping")
+
+	want := []string{
+		`^\[0/2 done, 0s elapsed\] started dig$`,
+		`^\[0/2 done, 0s elapsed\] started ping$`,
+		`^\[1/2 done, 0s elapsed\] finished dig in 0s; 1 remaining$`,
+		`^\[2/2 done, 0s elapsed\] finished ping in 0s; 0 remaining$`,
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("the output has %d lines:\n%s", len(lines), buf.String())
+	}
+	for i, line := range lines {
+		if !regexp.MustCompile(want[i]).MatchString(line) {
+			t.Errorf("line %d is %q, want %s", i+1, line, want[i])
+		}
+	}
+}
+
+func TestRunTasksProgress(t *testing.T) {
+	var buf bytes.Buffer
+	a := &analyzer{progress: newProgress(&buf, 3)}
+	noop := func(context.Context) {}
+	a.runTasks(context.Background(), []*task{
+		newTask("a.txt", noop),
+		newTask("b.txt", noop),
+		newTask("c.txt", noop),
+	}, 2, time.Minute)
+
+	out := buf.String()
+	for _, name := range []string{"a", "b", "c"} {
+		if !strings.Contains(out, "started "+name+"\n") || !strings.Contains(out, "finished "+name+" in ") {
+			t.Errorf("the output does not show %s starting and finishing:\n%s", name, out)
+		}
+	}
+	if !strings.Contains(out, "[3/3 done") || !strings.Contains(out, "; 0 remaining\n") {
+		t.Errorf("the output does not end with every task finished:\n%s", out)
+	}
+
+	// Without a progress reporter, nothing is written.
+	var p *progress
+	p.taskStarted("a")
+	p.taskFinished("a")
+}
@@ -0,0 +1,159 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// proxyEnvVars are the environment variables Go and most tools read proxy
+// settings from. The lowercase forms take precedence in some tools.
+var proxyEnvVars = []string{
+	"HTTP_PROXY", "http_proxy",
+	"HTTPS_PROXY", "https_proxy",
+	"NO_PROXY", "no_proxy",
+	"ALL_PROXY", "all_proxy",
+}
+
+// proxyReport is the proxy configuration from the environment and the
+// result of requesting each MaxMind endpoint through it and directly.
+type proxyReport struct {
+	Environment map[string]string `json:"environment,omitempty"`
+	Probes      []*proxyProbe     `json:"probes"`
+}
+
+// proxyProbe compares a request through the configured proxy with one that
+// bypasses it. Proxy is empty if the request is not proxied.
+type proxyProbe struct {
+	URL    string      `json:"url"`
+	Proxy  string      `json:"proxy,omitempty"`
+	Via    *proxyFetch `json:"via_proxy,omitempty"`
+	Direct *proxyFetch `json:"direct"`
+	// Differs is true if the request succeeded one way but not the other
+	// or the status differs.
+	Differs bool `json:"differs"`
+}
+
+type proxyFetch struct {
+	endpointCheck
+	Status string `json:"status,omitempty"`
+}
+
+// addProxy records the proxy environment variables and requests each of
+// maxmindEndpoints both through the proxy they select and directly,
+// writing the results to proxy.json.
+func (a *analyzer) addProxy(ctx context.Context) {
+	r := &proxyReport{Environment: map[string]string{}}
+	for _, k := range proxyEnvVars {
+		if v, ok := os.LookupEnv(k); ok {
+			r.Environment[k] = redactProxyURL(v)
+		}
+	}
+
+	r.Probes = make([]*proxyProbe, len(maxmindEndpoints))
+	var wg sync.WaitGroup
+	for i, host := range maxmindEndpoints {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			r.Probes[i] = probeProxy(ctx, "https://"+host+"/")
+		}(i, host)
+	}
+	wg.Wait()
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding proxy.json"))
+		return
+	}
+	a.storeFile("proxy.json", b)
+	a.storeResult("proxy", r)
+}
+
+func probeProxy(ctx context.Context, rawURL string) *proxyProbe {
+	p := &proxyProbe{URL: rawURL}
+	p.Direct = fetchWithProxy(ctx, rawURL, nil)
+
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return p
+	}
+	proxyURL, err := http.ProxyFromEnvironment(req)
+	if err != nil || proxyURL == nil {
+		return p
+	}
+	p.Proxy = redactProxyURL(proxyURL.String())
+	p.Via = fetchWithProxy(ctx, rawURL, http.ProxyURL(proxyURL))
+	p.Differs = p.Via.OK != p.Direct.OK || p.Via.Status != p.Direct.Status
+	return p
+}
+
+// fetchWithProxy requests rawURL through proxy, or directly if it is nil.
+func fetchWithProxy(
+	ctx context.Context,
+	rawURL string,
+	proxy func(*http.Request) (*url.URL, error),
+) *proxyFetch {
+	ctx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             proxy,
+			DialContext:       dialConfigFromContext(ctx).dialContext,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	f := &proxyFetch{}
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		f.endpointCheck = newEndpointCheck(start, err)
+		return f
+	}
+	req.Header.Set("User-Agent", os.Args[0])
+	resp, err := client.Do(req)
+	if err == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		f.Status = resp.Status
+	}
+	f.endpointCheck = newEndpointCheck(start, err)
+	return f
+}
+
+// describe returns the status or error of the request.
+func (f *proxyFetch) describe() string {
+	if !f.OK {
+		return f.Error
+	}
+	return f.Status
+}
+
+// redactProxyURL removes any password from a proxy URL. NO_PROXY and
+// other values that are not URLs are returned unchanged.
+func redactProxyURL(s string) string {
+	var parts []string
+	for _, p := range strings.Split(s, ",") {
+		u, err := url.Parse(strings.TrimSpace(p))
+		if err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "redacted")
+			}
+			p = u.String()
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/quic-go/quic-go"
+)
+
+// quicHandshakeTimeout is how long to wait for a QUIC handshake. Where UDP
+// 443 is blocked, nothing is received and the handshake times out.
+const quicHandshakeTimeout = 5 * time.Second
+
+// dialQUIC makes a QUIC connection to port on host. The UDP socket is
+// ours rather than quic-go's so that --ipv4, --ipv6, --source-ip, and
+// --interface apply to it. The caller must close the socket once done with
+// the connection.
+func dialQUIC(
+	ctx context.Context,
+	host string,
+	port uint16,
+	tlsConfig *tls.Config,
+) (*quic.Conn, net.PacketConn, error) {
+	dial := dialConfigFromContext(ctx)
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, dial.restrictNetwork("ip"), host)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error resolving %s", host)
+	}
+	ip := ips[0].Unmap()
+	network := "ip4"
+	if ip.Is6() {
+		network = "ip6"
+	}
+	lc := net.ListenConfig{Control: dial.bindControl}
+	pc, err := lc.ListenPacket(ctx, "udp"+network[2:], net.JoinHostPort(dial.listenAddr(network), "0"))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error opening UDP socket")
+	}
+	conn, err := quic.Dial(
+		ctx,
+		pc,
+		net.UDPAddrFromAddrPort(netip.AddrPortFrom(ip, port)),
+		tlsConfig,
+		&quic.Config{HandshakeIdleTimeout: quicHandshakeTimeout},
+	)
+	if err != nil {
+		_ = pc.Close()
+		return nil, nil, err
+	}
+	return conn, pc, nil
+}
+
+// quicProbe is the result of a QUIC handshake with a host along with a
+// TCP and TLS handshake to compare it to.
+type quicProbe struct {
+	Host        string        `json:"host"`
+	Address     string        `json:"address,omitempty"`
+	QUIC        endpointCheck `json:"quic"`
+	QUICVersion string        `json:"quic_version,omitempty"`
+	ALPN        string        `json:"alpn,omitempty"`
+	// Blocked is true if the QUIC handshake timed out, which usually means
+	// that UDP 443 is dropped.
+	Blocked bool `json:"blocked"`
+	// TCPTLS is the TCP connect and TLS handshake, which is what clients
+	// fall back to when QUIC fails.
+	TCPTLS endpointCheck `json:"tcp_tls"`
+	// FallbackMS is how long a client that waits for QUIC to fail before
+	// falling back to TCP would take to connect.
+	FallbackMS float64 `json:"fallback_ms,omitempty"`
+}
+
+// addQUIC attempts a QUIC handshake with each MaxMind endpoint and writes
+// the results to quic.json.
+func (a *analyzer) addQUIC(ctx context.Context) {
+	results := make([]*quicProbe, len(maxmindEndpoints))
+	var wg sync.WaitGroup
+	for i, host := range maxmindEndpoints {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			results[i] = probeQUIC(ctx, host)
+		}(i, host)
+	}
+	wg.Wait()
+
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding quic.json"))
+		return
+	}
+	a.storeFile("quic.json", b)
+	a.storeResult("quic", results)
+}
+
+// quicBlocked returns true if err, from dialing QUIC with ctx, means that
+// nothing was received, as when UDP 443 is dropped.
+func quicBlocked(ctx context.Context, err error) bool {
+	var idleErr *quic.IdleTimeoutError
+	var handshakeErr *quic.HandshakeTimeoutError
+	return errors.Is(ctx.Err(), context.DeadlineExceeded) ||
+		errors.As(err, &idleErr) || errors.As(err, &handshakeErr)
+}
+
+func probeQUIC(ctx context.Context, host string) *quicProbe {
+	dial := dialConfigFromContext(ctx)
+	p := &quicProbe{Host: host}
+	tlsConfig := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS13, NextProtos: []string{"h3"}}
+
+	quicCtx, cancel := context.WithTimeout(ctx, quicHandshakeTimeout)
+	defer cancel()
+	start := time.Now()
+	conn, pc, err := dialQUIC(quicCtx, host, 443, tlsConfig)
+	p.QUIC = newEndpointCheck(start, err)
+	if err == nil {
+		state := conn.ConnectionState()
+		p.Address = conn.RemoteAddr().String()
+		p.QUICVersion = state.Version.String()
+		p.ALPN = state.TLS.NegotiatedProtocol
+		_ = conn.CloseWithError(0, "")
+		_ = pc.Close()
+	} else {
+		p.Blocked = quicBlocked(quicCtx, err)
+	}
+	if ctx.Err() != nil {
+		return p
+	}
+
+	tcpCtx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+	start = time.Now()
+	dialer := &tls.Dialer{
+		NetDialer: dial.newDialer("tcp"),
+		Config:    &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12},
+	}
+	tcpConn, err := dialer.DialContext(tcpCtx, dial.restrictNetwork("tcp"), net.JoinHostPort(host, "443"))
+	p.TCPTLS = newEndpointCheck(start, err)
+	if err == nil {
+		_ = tcpConn.Close()
+		if !p.QUIC.OK {
+			p.FallbackMS = p.QUIC.DurationMS + p.TCPTLS.DurationMS
+		}
+	}
+	return p
+}
@@ -0,0 +1,90 @@
+package analyzer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+func TestDialQUIC(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	serverTLS := server.TLS.Clone()
+	server.Close()
+	serverTLS.NextProtos = []string{"h3"}
+	ln, err := quic.ListenAddr("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			<-conn.Context().Done()
+		}
+	}()
+
+	_, roots := testCertificate(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	port := uint16(ln.Addr().(*net.UDPAddr).Port)
+	conn, pc, err := dialQUIC(ctx, "127.0.0.1", port, &tls.Config{
+		ServerName: "example.com",
+		RootCAs:    roots,
+		MinVersion: tls.VersionTLS13,
+		NextProtos: []string{"h3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	defer func() { _ = conn.CloseWithError(0, "") }()
+	if state := conn.ConnectionState(); state.TLS.NegotiatedProtocol != "h3" || state.Version != quic.Version1 {
+		t.Errorf("negotiated %q with %s", state.TLS.NegotiatedProtocol, state.Version)
+	}
+}
+
+func TestDialQUICBlocked(t *testing.T) {
+	// Nothing answers on this socket, as when UDP 443 is dropped.
+	silent, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	port := uint16(silent.LocalAddr().(*net.UDPAddr).Port)
+	_, _, err = dialQUIC(ctx, "127.0.0.1", port, &tls.Config{ServerName: "example.com", MinVersion: tls.VersionTLS13})
+	if err == nil {
+		t.Fatal("dialQUIC connected to a silent socket")
+	}
+	if !quicBlocked(ctx, err) {
+		t.Errorf("%v does not mean that QUIC is blocked", err)
+	}
+}
+
+func TestQUICFindings(t *testing.T) {
+	fs := findingsFor(map[string]interface{}{"quic": []*quicProbe{
+		{Host: "geoip.maxmind.com", Blocked: true, TCPTLS: endpointCheck{OK: true}, FallbackMS: 5100},
+		// Without a working fallback, the other checks report the
+		// problem.
+		{Host: "updates.maxmind.com", Blocked: true},
+		{Host: "download.maxmind.com", QUIC: endpointCheck{OK: true}, TCPTLS: endpointCheck{OK: true}},
+	}})
+	if len(fs) != 1 || fs[0].Check != "quic-blocked" {
+		t.Fatalf("findings = %v", findingChecks(fs))
+	}
+	if want := "clients trying QUIC first take 5100 ms to fall back to TCP"; !strings.Contains(fs[0].Summary, want) {
+		t.Errorf("summary = %q", fs[0].Summary)
+	}
+}
@@ -0,0 +1,144 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/pkg/errors"
+)
+
+// defaultRDAPURL redirects to the RDAP server of the regional internet
+// registry that allocated an address.
+const defaultRDAPURL = "https://rdap.org/ip/"
+
+// rdapReport is the parsed RDAP response for the public IP address.
+type rdapReport struct {
+	IP           string `json:"ip,omitempty"`
+	Handle       string `json:"handle,omitempty"`
+	Name         string `json:"name,omitempty"`
+	StartAddress string `json:"start_address,omitempty"`
+	EndAddress   string `json:"end_address,omitempty"`
+	Country      string `json:"country,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// rdapNetwork is the part of an RDAP IP network response (RFC 9083) that
+// we report.
+type rdapNetwork struct {
+	Handle       string       `json:"handle"`
+	Name         string       `json:"name"`
+	StartAddress string       `json:"startAddress"`
+	EndAddress   string       `json:"endAddress"`
+	Country      string       `json:"country"`
+	Entities     []rdapEntity `json:"entities"`
+}
+
+type rdapEntity struct {
+	Roles      []string          `json:"roles"`
+	VCardArray []json.RawMessage `json:"vcardArray"`
+}
+
+// addRDAP looks up the allocation of the public IP address in RDAP and
+// writes the response to ip-address-rdap.json.
+func (a *analyzer) addRDAP(ctx context.Context) {
+	r := &rdapReport{}
+	defer a.storeResult("ip-address-rdap", r)
+
+	err := a.retry(ctx, "GET "+publicIPURL, func() error {
+		var err error
+		r.IP, err = publicIP(ctx, a.dial.restrictNetwork("tcp"))
+		return err
+	})
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error getting the IP address for RDAP"))
+		r.Error = err.Error()
+		return
+	}
+
+	baseURL := a.rdapURL
+	if baseURL == "" {
+		baseURL = defaultRDAPURL
+	}
+	var body []byte
+	err = a.retry(ctx, "GET "+baseURL+r.IP, func() error {
+		var err error
+		body, err = fetchRDAP(ctx, baseURL, r.IP)
+		return err
+	})
+	if err != nil {
+		a.storeError(ctx, err)
+		r.Error = err.Error()
+		return
+	}
+	a.storeFile("ip-address-rdap.json", body)
+
+	var n rdapNetwork
+	if err := json.Unmarshal(body, &n); err != nil {
+		err = errors.Wrap(err, "error decoding RDAP response")
+		a.storeError(ctx, err)
+		r.Error = err.Error()
+		return
+	}
+	r.Handle = n.Handle
+	r.Name = n.Name
+	r.StartAddress = n.StartAddress
+	r.EndAddress = n.EndAddress
+	r.Country = n.Country
+	for _, e := range n.Entities {
+		if slices.Contains(e.Roles, "registrant") {
+			r.Organization = e.fullName()
+			break
+		}
+	}
+}
+
+// fetchRDAP gets the RDAP response for ip from the server at baseURL.
+func fetchRDAP(ctx context.Context, baseURL, ip string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+ip, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating RDAP request")
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := dialConfigFromContext(ctx).httpClient().Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting RDAP data")
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading RDAP response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpStatusErrorf(resp.StatusCode, "unexpected RDAP response status: %s", resp.Status)
+	}
+	return body, nil
+}
+
+// fullName returns the fn property of the entity's jCard (RFC 7095), which
+// has the form ["vcard", [[name, params, type, value], ...]].
+func (e rdapEntity) fullName() string {
+	if len(e.VCardArray) != 2 {
+		return ""
+	}
+	var props [][]json.RawMessage
+	if err := json.Unmarshal(e.VCardArray[1], &props); err != nil {
+		return ""
+	}
+	for _, p := range props {
+		if len(p) < 4 {
+			continue
+		}
+		var name, value string
+		if json.Unmarshal(p[0], &name) != nil || name != "fn" {
+			continue
+		}
+		if json.Unmarshal(p[3], &value) == nil {
+			return value
+		}
+	}
+	return ""
+}
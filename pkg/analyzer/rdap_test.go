@@ -0,0 +1,105 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testRDAPResponse = `{
+  "objectClassName": "ip network",
+  "handle": "NET-192-0-2-0-1",
+  "name": "TEST-NET-1",
+  "startAddress": "192.0.2.0",
+  "endAddress": "192.0.2.255",
+  "country": "US",
+  "entities": [
+    {
+      "roles": ["abuse"],
+      "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Abuse Desk"]]]
+    },
+    {
+      "roles": ["registrant"],
+      "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Example ISP"]]]
+    }
+  ]
+}`
+
+// serveRDAP serves handler for the duration of the test and returns the
+// RDAP base URL to give the analyzer.
+func serveRDAP(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL + "/ip/"
+}
+
+func TestAddRDAP(t *testing.T) {
+	servePublicIP(t, "192.0.2.1")
+	rdapURL := serveRDAP(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ip/192.0.2.1" || r.Header.Get("Accept") != "application/rdap+json" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testRDAPResponse))
+	})
+
+	a := &analyzer{rdapURL: rdapURL}
+	defer a.removeSpool()
+	a.addRDAP(context.Background())
+
+	want := &rdapReport{
+		IP:           "192.0.2.1",
+		Handle:       "NET-192-0-2-0-1",
+		Name:         "TEST-NET-1",
+		StartAddress: "192.0.2.0",
+		EndAddress:   "192.0.2.255",
+		Country:      "US",
+		Organization: "Example ISP",
+	}
+	if r, ok := a.results["ip-address-rdap"].(*rdapReport); !ok || *r != *want {
+		t.Errorf("report = %#v, want %#v", a.results["ip-address-rdap"], want)
+	}
+	if got := string(storedContents(t, a, "ip-address-rdap.json")); got != testRDAPResponse {
+		t.Errorf("ip-address-rdap.json = %s", got)
+	}
+}
+
+func TestAddRDAPNotFound(t *testing.T) {
+	servePublicIP(t, "192.0.2.1")
+	rdapURL := serveRDAP(t, http.NotFound)
+
+	a := &analyzer{rdapURL: rdapURL}
+	defer a.removeSpool()
+	a.addRDAP(context.Background())
+
+	r, ok := a.results["ip-address-rdap"].(*rdapReport)
+	if !ok || r.IP != "192.0.2.1" || !strings.Contains(r.Error, "404 Not Found") {
+		t.Errorf("report = %#v", a.results["ip-address-rdap"])
+	}
+	if !a.hasErrors() {
+		t.Error("the error was not recorded")
+	}
+}
+
+func TestRDAPEntityFullName(t *testing.T) {
+	tests := map[string]string{
+		`{"vcardArray": ["vcard", [["fn", {}, "text", "Example ISP"]]]}`:  "Example ISP",
+		`{"vcardArray": ["vcard", [["org", {}, "text", "Example ISP"]]]}`: "",
+		`{"vcardArray": ["vcard", [["fn", {}]]]}`:                         "",
+		`{"vcardArray": ["vcard", "not a list"]}`:                         "",
+		`{}`: "",
+	}
+	for entity, want := range tests {
+		var e rdapEntity
+		if err := json.Unmarshal([]byte(entity), &e); err != nil {
+			t.Fatal(err)
+		}
+		if got := e.fullName(); got != want {
+			t.Errorf("fullName of %s = %q, want %q", entity, got, want)
+		}
+	}
+}
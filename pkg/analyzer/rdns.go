@@ -0,0 +1,113 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// publicIPURL returns the address that a request to it came from.
+var publicIPURL = "http://" + defaultHost + "/app/update_getipaddr"
+
+// reverseDNSResult is the PTR records of the public IP address over one
+// address family.
+type reverseDNSResult struct {
+	Family string   `json:"family"`
+	IP     string   `json:"ip,omitempty"`
+	PTR    []string `json:"ptr,omitempty"`
+	// ForwardConfirmed is true if one of the PTR names resolves back to
+	// the IP address.
+	ForwardConfirmed bool   `json:"forward_confirmed"`
+	Error            string `json:"error,omitempty"`
+}
+
+// addReverseDNS fetches the public IP address over IPv4 and IPv6 and looks
+// up the PTR records of each, which usually name the ISP, and writes the
+// results to ip-address-ptr.txt.
+func (a *analyzer) addReverseDNS(ctx context.Context) {
+	buf := new(bytes.Buffer)
+	var results []*reverseDNSResult
+	for _, network := range []string{"tcp4", "tcp6"} {
+		r := &reverseDNSResult{Family: familyName(network)}
+		results = append(results, r)
+
+		err := a.retry(ctx, "GET "+publicIPURL+" over "+r.Family, func() error {
+			var err error
+			r.IP, err = publicIP(ctx, network)
+			return err
+		})
+		if err == nil {
+			err = a.retry(ctx, "PTR lookup of "+r.IP, func() error {
+				var err error
+				r.PTR, err = net.DefaultResolver.LookupAddr(ctx, r.IP)
+				return err
+			})
+		}
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting the PTR records of the %s address", r.Family))
+			r.Error = err.Error()
+			fmt.Fprintf(buf, "%s: %v\n", r.Family, err)
+			continue
+		}
+
+		for _, name := range r.PTR {
+			ips, err := net.DefaultResolver.LookupIPAddr(ctx, name)
+			if err != nil {
+				continue
+			}
+			for _, ip := range ips {
+				if ip.IP.Equal(net.ParseIP(r.IP)) {
+					r.ForwardConfirmed = true
+				}
+			}
+		}
+		fmt.Fprintf(buf, "%s: %s\n", r.Family, r.IP)
+		for _, name := range r.PTR {
+			fmt.Fprintf(buf, "  PTR %s\n", name)
+		}
+		fmt.Fprintf(buf, "  forward-confirmed: %t\n", r.ForwardConfirmed)
+	}
+	a.storeFile("ip-address-ptr.txt", buf.Bytes())
+	a.storeResult("ip-address-ptr", results)
+}
+
+// publicIP returns the public IP address of this machine, as seen by
+// defaultHost over network ("tcp", "tcp4", or "tcp6").
+func publicIP(ctx context.Context, network string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, publicIPURL, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating IP address request")
+	}
+
+	dialer := dialConfigFromContext(ctx).newDialer(network)
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+			DisableKeepAlives: true,
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error getting IP address")
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading IP address body")
+	}
+
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", errors.Errorf("invalid IP address in response: %q", ip)
+	}
+	return ip, nil
+}
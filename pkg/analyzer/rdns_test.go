@@ -0,0 +1,63 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// servePublicIP points publicIPURL at a server that responds with body for
+// the duration of the test.
+func servePublicIP(t *testing.T, body string) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	url := publicIPURL
+	publicIPURL = server.URL
+	t.Cleanup(func() { publicIPURL = url })
+}
+
+func TestPublicIP(t *testing.T) {
+	servePublicIP(t, "192.0.2.1\n")
+	ip, err := publicIP(context.Background(), "tcp4")
+	if err != nil || ip != "192.0.2.1" {
+		t.Errorf("publicIP = %q, %v", ip, err)
+	}
+
+	servePublicIP(t, "<html>blocked by policy</html>")
+	if _, err := publicIP(context.Background(), "tcp4"); err == nil ||
+		!strings.Contains(err.Error(), "invalid IP address in response") {
+		t.Errorf("publicIP with a block page = %v", err)
+	}
+}
+
+func TestAddReverseDNS(t *testing.T) {
+	// The test server only listens on IPv4, so the IPv6 lookup fails.
+	servePublicIP(t, "127.0.0.1")
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.addReverseDNS(context.Background())
+
+	results, ok := a.results["ip-address-ptr"].([]*reverseDNSResult)
+	if !ok || len(results) != 2 {
+		t.Fatalf("results = %#v", a.results["ip-address-ptr"])
+	}
+	ipv4, ipv6 := results[0], results[1]
+	if ipv4.Family != "IPv4" || ipv4.IP != "127.0.0.1" {
+		t.Errorf("IPv4 = %+v", ipv4)
+	}
+	if ipv6.Family != "IPv6" || ipv6.IP != "" || ipv6.Error == "" {
+		t.Errorf("IPv6 = %+v", ipv6)
+	}
+	out := string(storedContents(t, a, "ip-address-ptr.txt"))
+	if !strings.HasPrefix(out, "IPv4: ") || !strings.Contains(out, "\nIPv6: ") {
+		t.Errorf("ip-address-ptr.txt:\n%s", out)
+	}
+	if !a.hasErrors() {
+		t.Error("the IPv6 failure was not recorded")
+	}
+}
@@ -0,0 +1,84 @@
+package analyzer
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// redactRule replaces every match of re with replacement, which may refer
+// to submatches as in regexp.ReplaceAll.
+type redactRule struct {
+	re          *regexp.Regexp
+	replacement []byte
+}
+
+// redactor scrubs potentially identifying information from the collected
+// output before it is archived.
+type redactor struct {
+	rules []redactRule
+}
+
+// defaultRedactPatterns are applied in order. The replacements say what was
+// removed so that the output still makes sense to support staff.
+var defaultRedactPatterns = []struct {
+	pattern     string
+	replacement string
+}{
+	// RFC 1918 addresses
+	{
+		`\b(?:10\.\d{1,3}\.\d{1,3}\.\d{1,3}|172\.(?:1[6-9]|2\d|3[01])\.\d{1,3}\.\d{1,3}|192\.168\.\d{1,3}\.\d{1,3})\b`,
+		"[REDACTED-PRIVATE-IP]",
+	},
+	// MAC addresses
+	{`\b(?:[0-9A-Fa-f]{2}[:-]){5}[0-9A-Fa-f]{2}\b`, "[REDACTED-MAC]"},
+	// User names in home directory paths
+	{`(/home/|/Users/|(?i:[a-z]:\\Users\\))[^/\\\s]+`, "${1}[REDACTED-USER]"},
+	// Host names in commonly used private domains
+	{`(?i)\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:local|lan|internal|intranet|corp|home\.arpa)\b`, "[REDACTED-HOSTNAME]"},
+}
+
+// newRedactor returns a redactor using the default rules, a rule for this
+// machine's host name, and then the extra rules.
+func newRedactor(extra []redactConfig) (*redactor, error) {
+	r := &redactor{}
+	for _, p := range defaultRedactPatterns {
+		r.rules = append(r.rules, redactRule{
+			re:          regexp.MustCompile(p.pattern),
+			replacement: []byte(p.replacement),
+		})
+	}
+
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		names := []string{regexp.QuoteMeta(hostname)}
+		if short := strings.SplitN(hostname, ".", 2)[0]; short != hostname {
+			names = append(names, regexp.QuoteMeta(short))
+		}
+		r.rules = append(r.rules, redactRule{
+			re:          regexp.MustCompile(`(?i)\b(?:` + strings.Join(names, "|") + `)\b`),
+			replacement: []byte("[REDACTED-HOSTNAME]"),
+		})
+	}
+
+	for _, rc := range extra {
+		re, err := regexp.Compile(rc.Pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error compiling redaction pattern %q", rc.Pattern)
+		}
+		replacement := rc.Replacement
+		if replacement == "" {
+			replacement = "[REDACTED]"
+		}
+		r.rules = append(r.rules, redactRule{re: re, replacement: []byte(replacement)})
+	}
+	return r, nil
+}
+
+func (r *redactor) redact(contents []byte) []byte {
+	for _, rule := range r.rules {
+		contents = rule.re.ReplaceAll(contents, rule.replacement)
+	}
+	return contents
+}
@@ -0,0 +1,83 @@
+package analyzer
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	r, err := newRedactor([]redactConfig{
+		{Pattern: `ticket-\d+`},
+		{Pattern: `(customer)=\w+`, Replacement: "${1}=[REDACTED-CUSTOMER]"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{"inet 192.168.1.20/24", "inet [REDACTED-PRIVATE-IP]/24"},
+		{"via 10.0.0.1 and 172.16.5.4", "via [REDACTED-PRIVATE-IP] and [REDACTED-PRIVATE-IP]"},
+		// Public addresses and those that only look private are kept.
+		{"8.8.8.8 172.32.0.1 110.0.0.1", "8.8.8.8 172.32.0.1 110.0.0.1"},
+		{"ether 00:1a:2B:3c:4d:5e", "ether [REDACTED-MAC]"},
+		{"Physical Address: 00-1A-2B-3C-4D-5E", "Physical Address: [REDACTED-MAC]"},
+		{"/home/alice/.config", "/home/[REDACTED-USER]/.config"},
+		{"/Users/bob/Library", "/Users/[REDACTED-USER]/Library"},
+		{`C:\Users\carol\AppData`, `C:\Users\[REDACTED-USER]\AppData`},
+		{"printer.local db01.corp.internal", "[REDACTED-HOSTNAME] [REDACTED-HOSTNAME]"},
+		{"router.home.arpa", "[REDACTED-HOSTNAME]"},
+		{"geoip.maxmind.com", "geoip.maxmind.com"},
+		{"see ticket-1234", "see [REDACTED]"},
+		{"customer=acme", "customer=[REDACTED-CUSTOMER]"},
+	}
+	for _, test := range tests {
+		if got := string(r.redact([]byte(test.in))); got != test.want {
+			t.Errorf("redact(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+
+	if _, err := newRedactor([]redactConfig{{Pattern: "("}}); err == nil {
+		t.Error("newRedactor accepted an invalid pattern")
+	}
+}
+
+func TestRedactHostname(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" || hostname == "localhost" {
+		t.Skip("this machine's host name is not redacted")
+	}
+	r, err := newRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := strings.SplitN(hostname, ".", 2)[0]
+	got := string(r.redact([]byte("host " + hostname + " (" + strings.ToUpper(short) + ")")))
+	if got != "host [REDACTED-HOSTNAME] ([REDACTED-HOSTNAME])" {
+		t.Errorf("the host name was not redacted: %s", got)
+	}
+}
+
+func TestRedactFiles(t *testing.T) {
+	r, err := newRedactor(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &analyzer{
+		redactor:    r,
+		credentials: &credentials{accountID: "1", licenseKey: "secret-license-key"},
+	}
+	defer a.removeSpool()
+	a.storeFile("ip-addr.txt", []byte("inet 192.168.1.20 key=secret-license-key"))
+	a.storeFile("capture.pcap", []byte("192.168.1.20"))
+	a.redactFiles()
+
+	if got := string(storedContents(t, a, "ip-addr.txt")); got != "inet [REDACTED-PRIVATE-IP] key=<license key>" {
+		t.Errorf("ip-addr.txt = %q", got)
+	}
+	// Packet captures are binary and are left alone.
+	if got := string(storedContents(t, a, "capture.pcap")); got != "192.168.1.20" {
+		t.Errorf("capture.pcap = %q", got)
+	}
+}
@@ -0,0 +1,178 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// report is written to report.json. It holds the parsed results of each
+// task that produces them, keyed by task name, so that support tooling
+// does not need to parse the text output.
+type report struct {
+	Generated time.Time              `json:"generated"`
+	Tasks     map[string]interface{} `json:"tasks"`
+	// TimedOut and Interrupted list the tasks that were cancelled before
+	// they finished.
+	TimedOut    []string `json:"timed_out,omitempty"`
+	Interrupted []string `json:"interrupted,omitempty"`
+}
+
+// httpReport is the parsed result of an HTTP trace task.
+type httpReport struct {
+	URL        string        `json:"url"`
+	Network    string        `json:"network"`
+	RemoteAddr string        `json:"remote_address,omitempty"`
+	Protocol   string        `json:"protocol,omitempty"`
+	StatusCode int           `json:"status_code,omitempty"`
+	TLSVersion string        `json:"tls_version,omitempty"`
+	Timings    httpTimingsMS `json:"timings_ms"`
+	Edge       *edgeInfo     `json:"edge,omitempty"`
+	// ClockSkewSeconds is how far the local clock is ahead of the time in
+	// the response's Date header.
+	ClockSkewSeconds *float64 `json:"clock_skew_seconds,omitempty"`
+	Error            string   `json:"error,omitempty"`
+}
+
+type httpTimingsMS struct {
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	TLS     float64 `json:"tls"`
+	TTFB    float64 `json:"ttfb"`
+	Total   float64 `json:"total"`
+}
+
+// dnsReport is the parsed result of a single DNS query. For iterative
+// queries, it describes the final response.
+type dnsReport struct {
+	Question string   `json:"question"`
+	Server   string   `json:"server,omitempty"`
+	Rcode    string   `json:"rcode,omitempty"`
+	Answers  []string `json:"answers,omitempty"`
+	// ClientSubnet and ClientSubnetScope are from the EDNS Client Subnet
+	// option in the response. The scope is the prefix length the answer
+	// applies to; zero means that it does not depend on the subnet.
+	ClientSubnet      string  `json:"client_subnet,omitempty"`
+	ClientSubnetScope *uint8  `json:"client_subnet_scope,omitempty"`
+	RTTMS             float64 `json:"rtt_ms"`
+	Error             string  `json:"error,omitempty"`
+}
+
+// pingReport is the parsed result of a ping task.
+type pingReport struct {
+	Host     string  `json:"host"`
+	Address  string  `json:"address,omitempty"`
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	Loss     float64 `json:"loss_percent"`
+	MinMS    float64 `json:"min_ms"`
+	AvgMS    float64 `json:"avg_ms"`
+	MaxMS    float64 `json:"max_ms"`
+	StdDevMS float64 `json:"stddev_ms"`
+	JitterMS float64 `json:"jitter_ms"`
+	// LossBursts is the number of runs of consecutive lost requests.
+	LossBursts       int `json:"loss_bursts"`
+	LongestLossBurst int `json:"longest_loss_burst"`
+	// RTTsMS are the round-trip times of the requests in order, with null
+	// for those that were lost.
+	RTTsMS []*float64 `json:"rtts_ms,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// ipAddressReport is the parsed result of the ip-address task.
+type ipAddressReport struct {
+	IP string `json:"ip"`
+}
+
+func (a *analyzer) storeResult(name string, result interface{}) {
+	a.resultsMutex.Lock()
+	if a.results == nil {
+		a.results = map[string]interface{}{}
+	}
+	a.results[name] = result
+	a.resultsMutex.Unlock()
+}
+
+func (a *analyzer) addReport() error {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	r := report{
+		Generated:   time.Now().UTC(),
+		Tasks:       a.results,
+		TimedOut:    a.timedOut,
+		Interrupted: a.interrupted,
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "error encoding report.json")
+	}
+	a.storeFile("report.json", b)
+	return nil
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func (r *httpTraceResult) report(err error) *httpReport {
+	hr := &httpReport{
+		URL:        r.url,
+		Network:    r.network,
+		RemoteAddr: r.remoteAddr,
+		Protocol:   r.proto,
+		StatusCode: r.statusCode,
+		Timings: httpTimingsMS{
+			DNS:     durationMS(r.dnsDuration()),
+			Connect: durationMS(r.connectDuration()),
+			TLS:     durationMS(r.tlsDuration()),
+			TTFB:    durationMS(r.ttfbDuration()),
+			Total:   durationMS(r.totalDuration()),
+		},
+		Edge:  newEdgeInfo(r.header),
+		Error: errorString(err),
+	}
+	if r.tlsState != nil {
+		hr.TLSVersion = tlsVersionName(r.tlsState.Version)
+	}
+	if date, err := http.ParseTime(r.header.Get("Date")); err == nil && !r.firstByte.IsZero() {
+		// The Date header only has a resolution of a second.
+		skew := math.Round(r.firstByte.Sub(date).Seconds())
+		hr.ClockSkewSeconds = &skew
+	}
+	return hr
+}
+
+func (r *pingResult) report(host string, err error) *pingReport {
+	pr := &pingReport{Host: host, Error: errorString(err)}
+	if r == nil {
+		return pr
+	}
+	s := r.stats()
+	pr.Address = r.addr
+	pr.Sent = s.sent
+	pr.Received = s.received
+	pr.Loss = s.loss()
+	pr.MinMS = durationMS(s.min)
+	pr.AvgMS = durationMS(s.avg)
+	pr.MaxMS = durationMS(s.max)
+	pr.StdDevMS = durationMS(s.stddev)
+	pr.JitterMS = durationMS(s.jitter)
+	pr.LossBursts = s.lossBursts
+	pr.LongestLossBurst = s.longestLossBurst
+	for _, reply := range r.replies {
+		var rtt *float64
+		if reply.rtt != 0 {
+			ms := durationMS(reply.rtt)
+			rtt = &ms
+		}
+		pr.RTTsMS = append(pr.RTTsMS, rtt)
+	}
+	return pr
+}
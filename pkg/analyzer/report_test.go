@@ -0,0 +1,123 @@
+package analyzer
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func storedContents(t *testing.T, a *analyzer, name string) []byte {
+	t.Helper()
+	a.filesMutex.Lock()
+	defer a.filesMutex.Unlock()
+	for _, sf := range a.files {
+		if sf.name == name {
+			b, err := sf.read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		}
+	}
+	t.Fatalf("%s was not stored", name)
+	return nil
+}
+
+func TestAddReport(t *testing.T) {
+	a := &analyzer{timedOut: []string{"mtr"}}
+	defer a.removeSpool()
+	a.storeResult("ip-address", &ipAddressReport{IP: "192.0.2.1"})
+	a.storeResult("ping", testPingResult(10*time.Millisecond).report("example.com", nil))
+	if err := a.addReport(); err != nil {
+		t.Fatal(err)
+	}
+
+	var r struct {
+		Generated time.Time                  `json:"generated"`
+		Tasks     map[string]json.RawMessage `json:"tasks"`
+		TimedOut  []string                   `json:"timed_out"`
+	}
+	if err := json.Unmarshal(storedContents(t, a, "report.json"), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Generated.IsZero() || !reflect.DeepEqual(r.TimedOut, []string{"mtr"}) {
+		t.Errorf("report = %+v", r)
+	}
+	if got := string(r.Tasks["ip-address"]); got != `{
+      "ip": "192.0.2.1"
+    }` {
+		t.Errorf("ip-address = %s", got)
+	}
+	var ping pingReport
+	if err := json.Unmarshal(r.Tasks["ping"], &ping); err != nil {
+		t.Fatal(err)
+	}
+	if ping.Host != "example.com" || ping.Received != 1 || ping.AvgMS != 10 {
+		t.Errorf("ping = %+v", ping)
+	}
+}
+
+func TestHTTPReport(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ms := func(n int) time.Time { return start.Add(time.Duration(n) * time.Millisecond) }
+	r := &httpTraceResult{
+		url:          "https://geoip.maxmind.com",
+		network:      "tcp4",
+		remoteAddr:   "192.0.2.1:443",
+		proto:        "HTTP/1.1",
+		statusCode:   http.StatusOK,
+		header:       http.Header{"Date": {"Tue, 02 Jan 2024 03:04:00 GMT"}, "Cf-Ray": {"8a1b2c3d4e5f6789-IAD"}},
+		tlsState:     &tls.ConnectionState{Version: tls.VersionTLS13},
+		start:        start,
+		dnsStart:     ms(0),
+		dnsDone:      ms(10),
+		connectStart: ms(10),
+		connectDone:  ms(30),
+		tlsStart:     ms(30),
+		tlsDone:      ms(60),
+		firstByte:    ms(100),
+		done:         ms(120),
+	}
+	hr := r.report(nil)
+	want := httpTimingsMS{DNS: 10, Connect: 20, TLS: 30, TTFB: 100, Total: 120}
+	if hr.Timings != want {
+		t.Errorf("timings = %+v, want %+v", hr.Timings, want)
+	}
+	if hr.StatusCode != http.StatusOK || hr.TLSVersion != "TLS 1.3" || hr.Error != "" {
+		t.Errorf("report = %+v", hr)
+	}
+	if hr.Edge == nil || hr.Edge.POP != "IAD" {
+		t.Errorf("edge = %+v", hr.Edge)
+	}
+	// The local clock is five seconds ahead of the server's.
+	if hr.ClockSkewSeconds == nil || *hr.ClockSkewSeconds != 5 {
+		t.Errorf("clock skew = %v", hr.ClockSkewSeconds)
+	}
+
+	hr = (&httpTraceResult{url: r.url, network: "tcp6"}).report(errors.New("no route to host"))
+	if hr.Error != "no route to host" || hr.ClockSkewSeconds != nil || hr.TLSVersion != "" {
+		t.Errorf("failed report = %+v", hr)
+	}
+}
+
+func TestPingReport(t *testing.T) {
+	pr := testPingResult(10*time.Millisecond, 0, 30*time.Millisecond).report("example.com", nil)
+	if pr.Address != "192.0.2.1" || pr.Sent != 3 || pr.Received != 2 || pr.MinMS != 10 || pr.MaxMS != 30 {
+		t.Errorf("report = %+v", pr)
+	}
+	// Lost requests are null.
+	if len(pr.RTTsMS) != 3 || pr.RTTsMS[1] != nil || *pr.RTTsMS[2] != 30 {
+		t.Errorf("rtts = %v", pr.RTTsMS)
+	}
+
+	var r *pingResult
+	pr = r.report("example.com", errors.New("permission denied"))
+	if pr.Host != "example.com" || pr.Error != "permission denied" || pr.Sent != 0 {
+		t.Errorf("report without a result = %+v", pr)
+	}
+}
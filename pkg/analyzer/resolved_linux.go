@@ -0,0 +1,76 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// systemdResolvedDir exists while systemd-resolved is running. When it
+	// is, resolv.conf usually only lists its stub resolver, 127.0.0.53, so
+	// the upstream servers have to be found through it instead.
+	systemdResolvedDir = "/run/systemd/resolve"
+
+	// systemdConfDir holds resolved.conf and its drop-in directory.
+	systemdConfDir = "/etc/systemd"
+)
+
+// systemdResolvedRunning reports whether runDir, the runtime directory of
+// systemd-resolved, exists.
+func systemdResolvedRunning(runDir string) bool {
+	_, err := os.Stat(runDir)
+	return err == nil
+}
+
+// resolvedTasks returns the tasks that collect systemd-resolved's
+// configuration and status, if it is running. runDir and confDir are
+// normally systemdResolvedDir and systemdConfDir.
+func (a *analyzer) resolvedTasks(runDir, confDir string) []*task {
+	if !systemdResolvedRunning(runDir) {
+		return nil
+	}
+	return []*task{
+		a.createStoreCommand("resolvectl-status.txt", "resolvectl", "status").withTags(tagLocal, tagDNS),
+		a.createStoreCommand("resolvectl-statistics.txt", "resolvectl", "statistics").withTags(tagLocal, tagDNS),
+		a.createResolvedConfTask("systemd-resolved-conf.txt", runDir, confDir),
+	}
+}
+
+// createResolvedConfTask returns a task that stores resolved.conf, its
+// drop-ins, and the resolv.conf that systemd-resolved generates with the
+// upstream servers, from confDir and runDir. Files that do not exist are
+// skipped.
+func (a *analyzer) createResolvedConfTask(f, runDir, confDir string) *task {
+	return newTask(f, func(ctx context.Context) {
+		paths := []string{
+			filepath.Join(confDir, "resolved.conf"),
+			filepath.Join(runDir, "resolv.conf"),
+			filepath.Join(runDir, "stub-resolv.conf"),
+		}
+		dropIns, _ := filepath.Glob(filepath.Join(confDir, "resolved.conf.d", "*.conf"))
+		paths = append(paths, dropIns...)
+
+		buf := new(bytes.Buffer)
+		for _, path := range paths {
+			b, err := os.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			fmt.Fprintf(buf, "# %s\n", path)
+			if err != nil {
+				a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+				fmt.Fprintf(buf, "# %v\n\n", err)
+				continue
+			}
+			buf.Write(b)
+			fmt.Fprintln(buf)
+		}
+		a.storeFile(f, buf.Bytes())
+	}).withTags(tagLocal, tagDNS).
+		withDescription("Copies the systemd-resolved configuration and the resolv.conf files it generates")
+}
@@ -0,0 +1,49 @@
+package analyzer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvedConfTask(t *testing.T) {
+	runDir, confDir := t.TempDir(), t.TempDir()
+
+	files := map[string]string{
+		filepath.Join(confDir, "resolved.conf"):               "[Resolve]\nDNSSEC=no\n",
+		filepath.Join(confDir, "resolved.conf.d", "dns.conf"): "[Resolve]\nDNS=192.0.2.53\n",
+		filepath.Join(confDir, "resolved.conf.d", "README"):   "not a drop-in\n",
+		filepath.Join(runDir, "resolv.conf"):                  "nameserver 192.0.2.53\n",
+	}
+	for path, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if tasks := (&analyzer{}).resolvedTasks(runDir, confDir); len(tasks) != 3 {
+		t.Errorf("%d tasks while systemd-resolved is running", len(tasks))
+	}
+
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.createResolvedConfTask("systemd-resolved-conf.txt", runDir, confDir).run(context.Background())
+	if a.hasErrors() {
+		t.Fatalf("errors: %v", a.errors)
+	}
+	// stub-resolv.conf does not exist, so it is skipped.
+	want := "# " + filepath.Join(confDir, "resolved.conf") + "\n[Resolve]\nDNSSEC=no\n\n" +
+		"# " + filepath.Join(runDir, "resolv.conf") + "\nnameserver 192.0.2.53\n\n" +
+		"# " + filepath.Join(confDir, "resolved.conf.d", "dns.conf") + "\n[Resolve]\nDNS=192.0.2.53\n\n"
+	if got := string(storedContents(t, a, "systemd-resolved-conf.txt")); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if tasks := (&analyzer{}).resolvedTasks(filepath.Join(runDir, "missing"), confDir); tasks != nil {
+		t.Errorf("%d tasks while systemd-resolved is not running", len(tasks))
+	}
+}
@@ -0,0 +1,111 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// resolverLatencySamples is the number of queries used to measure the
+// latency of each resolver.
+const resolverLatencySamples = 5
+
+// resolverCheck is the result of checking a single configured resolver.
+type resolverCheck struct {
+	Resolver string   `json:"resolver"`
+	Question string   `json:"question"`
+	Rcode    string   `json:"rcode,omitempty"`
+	Answers  []string `json:"answers,omitempty"`
+	// UDP and TCP are the first query over each protocol.
+	UDP     endpointCheck   `json:"udp"`
+	TCP     endpointCheck   `json:"tcp"`
+	Latency resolverLatency `json:"latency_ms"`
+}
+
+// resolverLatency summarizes the round trip times of the UDP queries that
+// were answered.
+type resolverLatency struct {
+	Answered int     `json:"answered"`
+	Sent     int     `json:"sent"`
+	Min      float64 `json:"min"`
+	Avg      float64 `json:"avg"`
+	Max      float64 `json:"max"`
+}
+
+// addResolvers checks each of the system's resolvers individually rather
+// than only the one the system stub resolver happens to use, and writes
+// the results to dns-resolvers.json.
+func (a *analyzer) addResolvers(ctx context.Context) {
+	servers, err := systemResolvers()
+	if err != nil {
+		a.storeError(ctx, err)
+		return
+	}
+
+	results := make([]*resolverCheck, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server string) {
+			defer wg.Done()
+			results[i] = checkResolver(ctx, server)
+		}(i, server)
+	}
+	wg.Wait()
+
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding dns-resolvers.json"))
+		return
+	}
+	a.storeFile("dns-resolvers.json", b)
+	a.storeResult("dns-resolvers", results)
+}
+
+func checkResolver(ctx context.Context, server string) *resolverCheck {
+	q := newDNSQuery(defaultHost, dns.TypeA)
+	c := &resolverCheck{Resolver: server, Question: q.String()}
+
+	m := newDNSMessage(q, false)
+	m.RecursionDesired = true
+
+	udp := newDNSClient(ctx, "udp")
+	udp.UDPSize = ednsBufferSize
+	c.Latency.Min = math.Inf(1)
+	var total float64
+	for i := 0; i < resolverLatencySamples && ctx.Err() == nil; i++ {
+		resp, rtt, err := udp.ExchangeContext(ctx, m, server)
+		c.Latency.Sent++
+		if i == 0 {
+			c.UDP = endpointCheck{OK: err == nil, DurationMS: durationMS(rtt), Error: errorString(err)}
+			if err == nil {
+				c.Rcode = dns.RcodeToString[resp.Rcode]
+				for _, rr := range resp.Answer {
+					c.Answers = append(c.Answers, rr.String())
+				}
+			}
+		}
+		if err != nil {
+			continue
+		}
+		ms := durationMS(rtt)
+		c.Latency.Answered++
+		total += ms
+		c.Latency.Min = math.Min(c.Latency.Min, ms)
+		c.Latency.Max = math.Max(c.Latency.Max, ms)
+	}
+	if c.Latency.Answered > 0 {
+		c.Latency.Avg = total / float64(c.Latency.Answered)
+	} else {
+		c.Latency.Min = 0
+	}
+
+	tcp := newDNSClient(ctx, "tcp")
+	_, rtt, err := tcp.ExchangeContext(ctx, m, server)
+	c.TCP = endpointCheck{OK: err == nil, DurationMS: durationMS(rtt), Error: errorString(err)}
+	return c
+}
@@ -0,0 +1,67 @@
+package analyzer
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckResolver(t *testing.T) {
+	server := startTestDNSServer(t, answerA)
+	c := checkResolver(context.Background(), server)
+
+	if c.Resolver != server || c.Rcode != "NOERROR" || len(c.Answers) != 1 || !c.UDP.OK || !c.TCP.OK {
+		t.Errorf("check = %+v", c)
+	}
+	l := c.Latency
+	if l.Sent != resolverLatencySamples || l.Answered != resolverLatencySamples ||
+		l.Min > l.Avg || l.Avg > l.Max {
+		t.Errorf("latency = %+v", l)
+	}
+	if fs := findingsFor(map[string]interface{}{"dns-resolvers": []*resolverCheck{c}}); len(fs) != 0 {
+		t.Errorf("findings = %v", findingChecks(fs))
+	}
+}
+
+func TestCheckResolverDown(t *testing.T) {
+	// Nothing reads from the socket, so the queries are never answered.
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	c := checkResolver(ctx, pc.LocalAddr().String())
+	if c.UDP.OK || c.UDP.Error == "" || c.TCP.OK || c.Rcode != "" {
+		t.Errorf("check = %+v", c)
+	}
+	// The remaining samples are not sent once the context is done.
+	if l := c.Latency; l.Sent == 0 || l.Answered != 0 || l.Min != 0 || l.Avg != 0 {
+		t.Errorf("latency = %+v", l)
+	}
+}
+
+func TestResolverFindings(t *testing.T) {
+	up := &resolverCheck{Resolver: "192.0.2.53:53", Latency: resolverLatency{Answered: 5, Sent: 5}}
+	down := &resolverCheck{
+		Resolver: "192.0.2.54:53",
+		UDP:      endpointCheck{Error: "i/o timeout"},
+		Latency:  resolverLatency{Sent: 5},
+	}
+
+	// Clients fall back to the resolvers that answer.
+	fs := findingsFor(map[string]interface{}{"dns-resolvers": []*resolverCheck{up, down}})
+	if len(fs) != 1 || fs[0].Check != "dns-resolver-down" || fs[0].Severity != severityWarning ||
+		!strings.Contains(fs[0].Summary, "192.0.2.54:53 answered none of 5 queries: i/o timeout") {
+		t.Errorf("findings = %+v", fs)
+	}
+
+	fs = findingsFor(map[string]interface{}{"dns-resolvers": []*resolverCheck{down}})
+	if len(fs) != 1 || fs[0].Severity != severityError {
+		t.Errorf("findings without a working resolver = %+v", fs)
+	}
+}
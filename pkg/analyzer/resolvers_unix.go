@@ -0,0 +1,32 @@
+//go:build !windows
+
+package analyzer
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// hostsFilePath returns the path of the hosts file.
+func hostsFilePath() string {
+	return "/etc/hosts"
+}
+
+// systemResolvers returns the addresses of the nameservers in resolv.conf.
+// It returns an error if there are none.
+func systemResolvers() ([]string, error) {
+	conf, err := dns.ClientConfigFromFile(resolvConfPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading "+resolvConfPath)
+	}
+	if len(conf.Servers) == 0 {
+		return nil, errors.New("no nameservers in " + resolvConfPath)
+	}
+	servers := make([]string, len(conf.Servers))
+	for i, s := range conf.Servers {
+		servers[i] = net.JoinHostPort(s, conf.Port)
+	}
+	return servers, nil
+}
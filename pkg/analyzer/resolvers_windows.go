@@ -0,0 +1,62 @@
+package analyzer
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+// hostsFilePath returns the path of the hosts file.
+func hostsFilePath() string {
+	root := os.Getenv("SystemRoot")
+	if root == "" {
+		root = `C:\Windows`
+	}
+	return filepath.Join(root, "System32", "drivers", "etc", "hosts")
+}
+
+// systemResolvers returns the addresses of the DNS servers configured on
+// the network adapters that are up, as Windows has no resolv.conf. It
+// returns an error if there are none.
+func systemResolvers() ([]string, error) {
+	size := uint32(15000)
+	var adapters *windows.IpAdapterAddresses
+	for {
+		buf := make([]byte, size)
+		adapters = (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_SKIP_ANYCAST, 0, adapters, &size)
+		if err == nil {
+			break
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil, errors.Wrap(err, "error getting network adapters")
+		}
+	}
+
+	var servers []string
+	seen := map[string]bool{}
+	for a := adapters; a != nil; a = a.Next {
+		if a.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		for s := a.FirstDnsServerAddress; s != nil; s = s.Next {
+			ip := s.Address.IP()
+			if ip == nil {
+				continue
+			}
+			server := net.JoinHostPort(ip.String(), "53")
+			if !seen[server] {
+				seen[server] = true
+				servers = append(servers, server)
+			}
+		}
+	}
+	if len(servers) == 0 {
+		return nil, errors.New("no DNS servers configured on any network adapter")
+	}
+	return servers, nil
+}
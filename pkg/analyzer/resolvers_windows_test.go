@@ -0,0 +1,24 @@
+package analyzer
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSystemResolvers(t *testing.T) {
+	servers, err := systemResolvers()
+	if err != nil {
+		t.Skipf("no DNS servers: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, s := range servers {
+		host, port, err := net.SplitHostPort(s)
+		if err != nil || net.ParseIP(host) == nil || port != "53" {
+			t.Errorf("server %q", s)
+		}
+		if seen[s] {
+			t.Errorf("%s is listed twice", s)
+		}
+		seen[s] = true
+	}
+}
@@ -0,0 +1,65 @@
+package analyzer
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Defaults for --retries and --retry-backoff.
+const (
+	defaultRetries      = 2
+	defaultRetryBackoff = time.Second
+)
+
+// retryPolicy controls how network operations that fail, e.g., with a DNS
+// timeout or a TCP reset, are retried.
+type retryPolicy struct {
+	// retries is the number of times a failed operation is retried.
+	retries int
+	// backoff is the delay before the first retry. It doubles for each
+	// subsequent retry.
+	backoff time.Duration
+}
+
+// attemptRecord is the outcome of a single attempt at an operation.
+type attemptRecord struct {
+	Operation  string  `json:"operation"`
+	Attempt    int     `json:"attempt"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// retry calls f until it succeeds, it has been retried as many times as
+// the policy allows, or ctx is done. It returns the last error. Each
+// attempt is recorded in the task's manifest entry.
+func (a *analyzer) retry(ctx context.Context, operation string, f func() error) error {
+	record := taskRecordFromContext(ctx)
+	backoff := a.retryPolicy.backoff
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		err := f()
+		record.addAttempt(attemptRecord{
+			Operation:  operation,
+			Attempt:    attempt,
+			DurationMS: durationMS(time.Since(start)),
+			Error:      errorString(err),
+		})
+		if err == nil || attempt > a.retryPolicy.retries || ctx.Err() != nil {
+			return err
+		}
+
+		slog.Debug(
+			"retrying",
+			"task", record.Name,
+			"operation", operation,
+			"attempt", attempt,
+			"backoff", backoff,
+			"error", err,
+		)
+		if sleepContext(ctx, backoff) != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,61 @@
+package analyzer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRetry(t *testing.T) {
+	a := &analyzer{retryPolicy: retryPolicy{retries: 2, backoff: 10 * time.Millisecond}}
+	record := &taskRecord{Name: "dig"}
+	ctx := context.WithValue(context.Background(), taskRecordKey{}, record)
+
+	calls := 0
+	start := time.Now()
+	err := a.retry(ctx, "query", func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("i/o timeout")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Fatalf("retry = %v after %d calls", err, calls)
+	}
+	// The backoff doubles from 10ms to 20ms.
+	if took := time.Since(start); took < 30*time.Millisecond {
+		t.Errorf("the retries took %s", took)
+	}
+	if len(record.Attempts) != 3 || record.Attempts[0].Error != "i/o timeout" ||
+		record.Attempts[2].Attempt != 3 || record.Attempts[2].Error != "" {
+		t.Errorf("attempts = %+v", record.Attempts)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	a := &analyzer{retryPolicy: retryPolicy{retries: 1}}
+	calls := 0
+	err := a.retry(context.Background(), "connect", func() error {
+		calls++
+		return errors.Errorf("reset %d", calls)
+	})
+	if err == nil || err.Error() != "reset 2" || calls != 2 {
+		t.Errorf("retry = %v after %d calls", err, calls)
+	}
+
+	// Nothing is retried once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	a.retryPolicy = retryPolicy{retries: 5, backoff: time.Hour}
+	calls = 0
+	err = a.retry(ctx, "connect", func() error {
+		calls++
+		cancel()
+		return errors.New("reset")
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("retry after cancellation = %v after %d calls", err, calls)
+	}
+}
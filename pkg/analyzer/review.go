@@ -0,0 +1,124 @@
+package analyzer
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// review writes the collected files to a temporary directory so that the
+// user may inspect them, and then lets the user drop files before the
+// archive is written. Edits the user makes to the files in the directory
+// are kept. If ctx is done, e.g., because the user pressed Ctrl-C, the files
+// dropped so far are dropped and the rest are kept.
+func (a *analyzer) review(ctx context.Context, in io.Reader, out io.Writer) error {
+	a.filesMutex.Lock()
+	defer a.filesMutex.Unlock()
+
+	dir, err := os.MkdirTemp("", "mm-network-analysis-review-")
+	if err != nil {
+		return errors.Wrap(err, "error creating review directory")
+	}
+	defer os.RemoveAll(dir)
+
+	paths := make([]string, len(a.files))
+	for i, sf := range a.files {
+		// The index prefix keeps the paths unique and in the same order
+		// as the list we print.
+		paths[i] = filepath.Join(dir, fmt.Sprintf("%02d-%s", i+1, filepath.Base(sf.name)))
+		err := copyStoredFile(sf, paths[i])
+		if err != nil {
+			return errors.Wrap(err, "error writing "+sf.name+" for review")
+		}
+	}
+
+	lines := make(chan string)
+	scanErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		scanErr <- scanner.Err()
+		close(lines)
+	}()
+
+	dropped := map[int]bool{}
+review:
+	for {
+		fmt.Fprintf(out, "\nThe collected files have been written to %s for review:\n\n", dir)
+		for i, sf := range a.files {
+			mark := " "
+			if dropped[i] {
+				mark = "x"
+			}
+			fmt.Fprintf(out, "  [%s] %2d. %-60s %8d bytes\n", mark, i+1, sf.name, sf.length())
+		}
+		fmt.Fprint(out, "\nEnter the numbers of files to drop or restore, or press Enter to write the archive: ")
+
+		var line string
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				if err := <-scanErr; err != nil {
+					return errors.Wrap(err, "error reading review input")
+				}
+				break review
+			}
+			line = strings.TrimSpace(l)
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			break review
+		}
+		if line == "" {
+			break
+		}
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' }) {
+			n, err := strconv.Atoi(field)
+			if err != nil || n < 1 || n > len(a.files) {
+				fmt.Fprintf(out, "Ignoring %q, which is not a file number\n", field)
+				continue
+			}
+			dropped[n-1] = !dropped[n-1]
+		}
+	}
+	var kept []*storedFile
+	for i, sf := range a.files {
+		if dropped[i] {
+			continue
+		}
+		err := sf.replaceFrom(paths[i])
+		if err != nil {
+			return errors.Wrap(err, "error reading reviewed "+sf.name)
+		}
+		kept = append(kept, sf)
+	}
+	a.files = kept
+	fmt.Fprintf(out, "Writing %d of %d files to the archive\n", len(kept), len(paths))
+	return nil
+}
+
+// copyStoredFile writes the contents of sf to a new file at path.
+func copyStoredFile(sf *storedFile, path string) error {
+	r, err := sf.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600) // nolint: gosec
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return errors.WithStack(err)
+}
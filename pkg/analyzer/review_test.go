@@ -0,0 +1,113 @@
+package analyzer
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newReviewAnalyzer(t *testing.T) *analyzer {
+	t.Helper()
+	a := &analyzer{}
+	t.Cleanup(a.removeSpool)
+	a.storeFile("hosts", []byte("127.0.0.1 localhost\n"))
+	a.storeFile("resolv.conf", []byte("nameserver 192.0.2.53\n"))
+	a.storeFile("ip-addr.txt", []byte("inet 192.0.2.1\n"))
+	return a
+}
+
+func storedNames(a *analyzer) []string {
+	var names []string
+	for _, sf := range a.files {
+		names = append(names, sf.name)
+	}
+	return names
+}
+
+func TestReview(t *testing.T) {
+	a := newReviewAnalyzer(t)
+	in, inW := io.Pipe()
+	defer inW.Close()
+	out := &syncBuffer{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var dir string
+		for dir == "" {
+			time.Sleep(10 * time.Millisecond)
+			m := regexp.MustCompile(`written to (\S+) for review`).FindStringSubmatch(string(out.Bytes()))
+			if m != nil {
+				dir = m[1]
+			}
+		}
+		// The user edits a file and drops two, but then restores one.
+		err := os.WriteFile(filepath.Join(dir, "02-resolv.conf"), []byte("nameserver [removed]\n"), 0o600)
+		if err != nil {
+			t.Error(err)
+		}
+		_, _ = io.WriteString(inW, "1, 3\n3 9 x\n\n")
+	}()
+	err := a.review(context.Background(), in, out)
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(storedNames(a), ","); got != "resolv.conf,ip-addr.txt" {
+		t.Errorf("kept %s", got)
+	}
+	if got := string(storedContents(t, a, "resolv.conf")); got != "nameserver [removed]\n" {
+		t.Errorf("resolv.conf = %q", got)
+	}
+	for _, want := range []string{
+		"  [x]  1. hosts",
+		`Ignoring "9", which is not a file number`,
+		`Ignoring "x", which is not a file number`,
+		"Writing 2 of 3 files to the archive",
+	} {
+		if !strings.Contains(string(out.Bytes()), want) {
+			t.Errorf("the output does not contain %q:\n%s", want, out.Bytes())
+		}
+	}
+}
+
+func TestReviewEndOfInput(t *testing.T) {
+	a := newReviewAnalyzer(t)
+	out := &syncBuffer{}
+	if err := a.review(context.Background(), strings.NewReader("2\n"), out); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(storedNames(a), ","); got != "hosts,ip-addr.txt" {
+		t.Errorf("kept %s", got)
+	}
+}
+
+func TestReviewCancelled(t *testing.T) {
+	a := newReviewAnalyzer(t)
+	in, inW := io.Pipe()
+	defer inW.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out := &syncBuffer{}
+	if err := a.review(ctx, in, out); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(a.files); got != 3 {
+		t.Errorf("kept %d files", got)
+	}
+
+	// The review directory is removed.
+	m := regexp.MustCompile(`written to (\S+) for review`).FindStringSubmatch(string(out.Bytes()))
+	if m == nil {
+		t.Fatalf("the output does not name the directory:\n%s", out.Bytes())
+	}
+	if _, err := os.Stat(m[1]); !os.IsNotExist(err) {
+		t.Errorf("%s was not removed: %v", m[1], err)
+	}
+}
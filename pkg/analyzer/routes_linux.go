@@ -0,0 +1,114 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// createProcRoutesTask returns a task that lists the IPv4 and IPv6 routes
+// from /proc/net. It is the fallback for ip route.
+func (a *analyzer) createProcRoutesTask(f string) *task {
+	return newTask(f, func(ctx context.Context) {
+		buf := new(bytes.Buffer)
+		for _, read := range []func() ([]string, error){readProcRoutes, readProcIPv6Routes} {
+			routes, err := read()
+			if err != nil {
+				a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+				fmt.Fprintf(buf, "# %v\n", err)
+				continue
+			}
+			for _, r := range routes {
+				fmt.Fprintln(buf, r)
+			}
+		}
+		a.storeFile(f, buf.Bytes())
+	}).withTags(tagLocal, tagRouting).
+		withDescription("Lists the routes in /proc/net/route and /proc/net/ipv6_route")
+}
+
+// readProcRoutes returns the routes in /proc/net/route formatted like
+// ip route. Addresses are hex-encoded in host byte order.
+func readProcRoutes() ([]string, error) {
+	b, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading /proc/net/route")
+	}
+	var routes []string
+	for _, line := range strings.Split(string(b), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		dst, err1 := parseProcIPv4(fields[1])
+		gw, err2 := parseProcIPv4(fields[2])
+		mask, err3 := parseProcIPv4(fields[7])
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		ones, _ := net.IPMask(mask.To4()).Size()
+
+		route := "default"
+		if ones > 0 || !dst.Equal(net.IPv4zero) {
+			route = fmt.Sprintf("%s/%d", dst, ones)
+		}
+		if !gw.Equal(net.IPv4zero) {
+			route += " via " + gw.String()
+		}
+		route += " dev " + fields[0] + " metric " + fields[6]
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
+
+func parseProcIPv4(s string) (net.IP, error) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+	ip := make(net.IP, 4)
+	binary.LittleEndian.PutUint32(ip, uint32(v))
+	return ip, nil
+}
+
+// readProcIPv6Routes returns the routes in /proc/net/ipv6_route formatted
+// like ip -6 route.
+func readProcIPv6Routes() ([]string, error) {
+	b, err := os.ReadFile("/proc/net/ipv6_route")
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading /proc/net/ipv6_route")
+	}
+	var routes []string
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 {
+			continue
+		}
+		dst, err1 := hex.DecodeString(fields[0])
+		prefix, err2 := strconv.ParseUint(fields[1], 16, 8)
+		gw, err3 := hex.DecodeString(fields[4])
+		metric, err4 := strconv.ParseUint(fields[5], 16, 32)
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			continue
+		}
+
+		route := "default"
+		if prefix > 0 {
+			route = fmt.Sprintf("%s/%d", net.IP(dst), prefix)
+		}
+		if !net.IP(gw).Equal(net.IPv6zero) {
+			route += " via " + net.IP(gw).String()
+		}
+		route += fmt.Sprintf(" dev %s metric %d", fields[9], metric)
+		routes = append(routes, route)
+	}
+	return routes, nil
+}
@@ -0,0 +1,277 @@
+package analyzer
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultScheduleKeep is the number of scheduled archives kept unless
+// --schedule-keep is given.
+const defaultScheduleKeep = 12
+
+// cronSchedule is a parsed five-field cron expression. Each field is a
+// bit set of the values it matches.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar record whether the day of month and day of week
+	// fields are "*". As in cron, if both are restricted, a day matches if
+	// either does.
+	domStar, dowStar bool
+}
+
+// parseCron parses an expression such as "0 */6 * * *". Each field may be
+// "*", a number, a range such as "1-5", or a comma-separated list of
+// these, and each but a number may have a step such as "/2". Sunday is 0
+// or 7 in the day of week field.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("error parsing schedule %q: expected 5 fields, got %d", expr, len(fields))
+	}
+	s := &cronSchedule{domStar: fields[2] == "*", dowStar: fields[4] == "*"}
+	for i, f := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	} {
+		b, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing schedule %q", expr)
+		}
+		*f.bits = b
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func parseCronField(field string, minValue, maxValue int) (uint64, error) {
+	var b uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step < 1 {
+				return 0, errors.Errorf("invalid step in %q", part)
+			}
+		}
+
+		lo, hi := minValue, maxValue
+		if rng != "*" {
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+			var err error
+			lo, err = strconv.Atoi(loStr)
+			if err != nil {
+				return 0, errors.Errorf("invalid value in %q", part)
+			}
+			hi = lo
+			if isRange {
+				hi, err = strconv.Atoi(hiStr)
+				if err != nil {
+					return 0, errors.Errorf("invalid value in %q", part)
+				}
+			} else if hasStep {
+				hi = maxValue
+			}
+		}
+		if lo < minValue || hi > maxValue || lo > hi {
+			return 0, errors.Errorf("%q is outside of %d-%d", part, minValue, maxValue)
+		}
+		for v := lo; v <= hi; v += step {
+			b |= 1 << v
+		}
+	}
+	return b, nil
+}
+
+// next returns the first minute after t that the schedule matches, or the
+// zero time if there is none in the next five years, e.g., for February
+// 30th.
+func (s *cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(5, 0, 0); t.Before(end); {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domStar && s.dowStar:
+		return true
+	case s.domStar:
+		return dow
+	case s.dowStar:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// runSchedule runs a full collection in a child process each time the
+// schedule matches until interrupted. The child gets the same flags other
+// than the scheduling ones and writes its archive to the current directory
+// with the name archivePath returns for the time of the run, after which
+// the archives of all but the newest keep runs are removed.
+func runSchedule(fs *flag.FlagSet, expr string, keep int, archivePath func(time.Time) string) int {
+	s, err := parseCron(expr)
+	if err != nil {
+		fatal(err)
+	}
+	if s.next(time.Now()).IsZero() {
+		fatal(errors.Errorf("schedule %q never matches", expr))
+	}
+	if keep < 1 {
+		fatal(errors.New("--schedule-keep must be positive"))
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		fatal(errors.Wrap(err, "error finding the analyzer executable"))
+	}
+	args := scheduledArgs(fs)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	archives := &scheduledArchives{keep: keep}
+	for {
+		next := s.next(time.Now())
+		slog.Info("waiting for the next scheduled collection", "time", next.Format(time.RFC3339))
+		if sleepContext(ctx, time.Until(next)) != nil {
+			return exitOK
+		}
+
+		// The child is in the same process group, so it also receives
+		// Ctrl-C and writes what it collected.
+		path := archivePath(next)
+		cmd := exec.Command(exe, append(args, "-output="+path)...) // nolint: gosec
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			slog.Warn("scheduled collection failed", "error", err)
+		}
+		if err := archives.add(path); err != nil {
+			slog.Error(err.Error())
+		}
+		if ctx.Err() != nil {
+			return exitOK
+		}
+	}
+}
+
+// readScheduledSecrets reads the license key for --account-id and the
+// --encrypt-passphrase passphrase once, prompting for them if they are not
+// in the environment, and checks the encryption flags. The scheduled runs
+// cannot prompt, so the values are put in the environment they inherit.
+func readScheduledSecrets(accountID string, encryptTo []string, usePassphrase bool) error {
+	credentials, err := readCredentials(accountID)
+	if err != nil {
+		return err
+	}
+	if credentials != nil {
+		if err := os.Setenv(licenseKeyEnv, credentials.licenseKey); err != nil {
+			return errors.Wrap(err, "error passing the license key to the scheduled runs")
+		}
+	}
+	if usePassphrase && len(encryptTo) == 0 {
+		passphrase, err := readPassphrase()
+		if err != nil {
+			return err
+		}
+		if err := os.Setenv(passphraseEnv, passphrase); err != nil {
+			return errors.Wrap(err, "error passing the passphrase to the scheduled runs")
+		}
+	}
+	_, err = encryptionRecipients(encryptTo, usePassphrase)
+	return err
+}
+
+// scheduledArgs returns the flags set in fs other than the scheduling ones
+// as arguments for the child. A flag that was given more than once, such as
+// --extra-cmd, is passed once for each value.
+func scheduledArgs(fs *flag.FlagSet) []string {
+	var args []string
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "schedule", "schedule-keep":
+			return
+		}
+		if r, ok := f.Value.(interface{ Values() []string }); ok {
+			for _, v := range r.Values() {
+				args = append(args, "-"+f.Name+"="+v)
+			}
+			return
+		}
+		args = append(args, "-"+f.Name+"="+f.Value.String())
+	})
+	return args
+}
+
+// scheduledArchives tracks the archives written by the scheduled runs so
+// that only those are removed. Archives from manual runs and from earlier
+// invocations of --schedule are left alone.
+type scheduledArchives struct {
+	keep int
+	// runs holds the paths each run wrote, oldest first.
+	runs [][]string
+}
+
+// add records the archive a run wrote to path, along with the parts it was
+// split into, and removes the archives of all but the newest keep runs.
+func (s *scheduledArchives) add(path string) error {
+	var paths []string
+	for n := 1; ; n++ {
+		p := path
+		if n > 1 {
+			p = partPath(path, n)
+		}
+		if _, err := os.Stat(p); err != nil {
+			break
+		}
+		paths = append(paths, p)
+	}
+	if len(paths) > 0 {
+		s.runs = append(s.runs, paths)
+	}
+
+	for len(s.runs) > s.keep {
+		for _, p := range s.runs[0] {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "error removing %s", p)
+			}
+			slog.Info("removed old archive", "path", p)
+		}
+		s.runs = s.runs[1:]
+	}
+	return nil
+}
@@ -0,0 +1,301 @@
+package analyzer
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"1,,2 * * * *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestParseCronFields(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}},
+		{"3", 0, 59, []int{3}},
+		{"1-4", 0, 59, []int{1, 2, 3, 4}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"10-20/5", 0, 59, []int{10, 15, 20}},
+		{"50/4", 0, 59, []int{50, 54, 58}},
+		{"1,5-6,*/10", 0, 23, []int{0, 1, 5, 6, 10, 20}},
+		{"*/7", 1, 31, []int{1, 8, 15, 22, 29}},
+	}
+	for _, test := range tests {
+		b, err := parseCronField(test.field, test.min, test.max)
+		if err != nil {
+			t.Errorf("%s: %v", test.field, err)
+			continue
+		}
+		var want uint64
+		for _, v := range test.want {
+			want |= 1 << v
+		}
+		if b != want {
+			t.Errorf("%s = %b, want %b", test.field, b, want)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-01-31 is a Wednesday, and 2024 is a leap year.
+	base := time.Date(2024, 1, 31, 22, 47, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", base, time.Date(2024, 1, 31, 22, 48, 0, 0, time.UTC)},
+		{"47 * * * *", base, time.Date(2024, 1, 31, 23, 47, 0, 0, time.UTC)},
+		{"*/15 * * * *", base, time.Date(2024, 1, 31, 23, 0, 0, 0, time.UTC)},
+		{"0 */6 * * *", base, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9-17 * * *", base, time.Date(2024, 2, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", base, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// Month rollover skips months without the day.
+		{"0 0 31 * *", base, time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 * *", base, time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", base, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Year rollover.
+		{"0 12 1 1 *", base, time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 0 * 11-12 *", base, time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)},
+		// Day of week, with Sunday as 0 or 7.
+		{"0 8 * * 1-5", base, time.Date(2024, 2, 1, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 0", base, time.Date(2024, 2, 4, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 7", base, time.Date(2024, 2, 4, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 6,0", base, time.Date(2024, 2, 3, 8, 0, 0, 0, time.UTC)},
+		{"0 0 * * */3", base, time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC)},
+		// If both day fields are restricted, either matches.
+		{"0 0 15 * 6", base, time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 * 6", base, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// A day of month with "*" for day of week must match.
+		{"0 0 2 * *", base, time.Date(2024, 2, 2, 0, 0, 0, 0, time.UTC)},
+		// The start is excluded even when it is on a matching minute.
+		{"47 22 * * *", time.Date(2024, 1, 31, 22, 47, 0, 0, time.UTC), time.Date(2024, 2, 1, 22, 47, 0, 0, time.UTC)},
+		// Never.
+		{"0 0 30 2 *", base, time.Time{}},
+	}
+	for _, test := range tests {
+		s, err := parseCron(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if got := s.next(test.from); !got.Equal(test.want) {
+			t.Errorf("%q after %s = %s, want %s", test.expr, test.from, got, test.want)
+		}
+	}
+}
+
+func TestScheduledArchives(t *testing.T) {
+	dir := t.TempDir()
+	touch := func(name string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, name))
+		return err == nil
+	}
+
+	manual := "mm-network-analysis-20240101T0000Z.zip"
+	touch(manual)
+	s := &scheduledArchives{keep: 2}
+	runs := []struct {
+		name  string
+		files []string
+	}{
+		{"mm-network-analysis-20240101T0100Z.zip.age", []string{
+			"mm-network-analysis-20240101T0100Z.zip.age",
+			"mm-network-analysis-20240101T0100Z.part2.zip.age",
+			"mm-network-analysis-20240101T0100Z.part3.zip.age",
+		}},
+		// A failed run that wrote nothing does not count.
+		{"mm-network-analysis-20240101T0200Z.zip.age", nil},
+		{"mm-network-analysis-20240101T0300Z.zip.age", []string{"mm-network-analysis-20240101T0300Z.zip.age"}},
+		{"mm-network-analysis-20240101T0400Z.zip.age", []string{"mm-network-analysis-20240101T0400Z.zip.age"}},
+	}
+	for _, run := range runs {
+		for _, f := range run.files {
+			touch(f)
+		}
+		if err := s.add(filepath.Join(dir, run.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, f := range runs[0].files {
+		if exists(f) {
+			t.Errorf("%s was not removed", f)
+		}
+	}
+	for _, f := range []string{manual, runs[2].files[0], runs[3].files[0]} {
+		if !exists(f) {
+			t.Errorf("%s was removed", f)
+		}
+	}
+	if len(s.runs) != 2 {
+		t.Errorf("tracking %d runs, want 2", len(s.runs))
+	}
+}
+
+func TestDefaultArchivePath(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3600))
+	tests := []struct {
+		format    string
+		reference string
+		encrypted bool
+		want      string
+	}{
+		{FormatZip, "", false, "mm-network-analysis-20240102T0204Z.zip"},
+		{FormatTarGz, "CASE-1", false, "mm-network-analysis-CASE-1-20240102T0204Z.tar.gz"},
+		{FormatZip, "", true, "mm-network-analysis-20240102T0204Z.zip.age"},
+	}
+	for _, test := range tests {
+		if got := defaultArchivePath(now, test.format, test.reference, test.encrypted); got != test.want {
+			t.Errorf("defaultArchivePath = %s, want %s", got, test.want)
+		}
+	}
+}
+
+func TestScheduledArgs(t *testing.T) {
+	newFlags := func() (*flag.FlagSet, *repeatedFlag, *stringSliceFlag, *bool) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		extraCmds, hosts := &repeatedFlag{}, &stringSliceFlag{}
+		fs.Var(extraCmds, "extra-cmd", "")
+		fs.Var(hosts, "host", "")
+		redact := fs.Bool("redact", false, "")
+		fs.String("schedule", "", "")
+		fs.Int("schedule-keep", 0, "")
+		fs.String("format", "zip", "")
+		return fs, extraCmds, hosts, redact
+	}
+
+	fs, _, _, _ := newFlags()
+	err := fs.Parse([]string{
+		"--extra-cmd", "routes=ip route show table all",
+		"--host", "a.example,b.example",
+		"--extra-cmd", "dig=dig +short example.com",
+		"--host", "c.example",
+		"--redact",
+		"--schedule", "0 * * * *",
+		"--schedule-keep", "3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := scheduledArgs(fs)
+	want := []string{
+		"-extra-cmd=routes=ip route show table all",
+		"-extra-cmd=dig=dig +short example.com",
+		"-host=a.example",
+		"-host=b.example",
+		"-host=c.example",
+		"-redact=true",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args =\n%q\nwant\n%q", args, want)
+	}
+
+	// The child parses the arguments back to the same values.
+	child, extraCmds, hosts, redact := newFlags()
+	if err := child.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	wantCmds := []string{"routes=ip route show table all", "dig=dig +short example.com"}
+	if !reflect.DeepEqual(extraCmds.Values(), wantCmds) {
+		t.Errorf("the child got --extra-cmd %q", extraCmds.Values())
+	}
+	if want := []string{"a.example", "b.example", "c.example"}; !reflect.DeepEqual(hosts.Values(), want) {
+		t.Errorf("the child got --host %q", hosts.Values())
+	}
+	if !*redact {
+		t.Error("the child did not get --redact")
+	}
+}
+
+func TestReadScheduledSecrets(t *testing.T) {
+	t.Setenv(licenseKeyEnv, "")
+	t.Setenv(passphraseEnv, "")
+
+	// The tests do not run in a terminal, so nothing can be prompted for.
+	for _, test := range []struct {
+		accountID     string
+		encryptTo     []string
+		usePassphrase bool
+		want          string
+	}{
+		{"42", nil, false, licenseKeyEnv + " must be set"},
+		{"", nil, true, passphraseEnv + " must be set"},
+		{"", []string{"not-a-key"}, false, "error parsing age public key"},
+		{"", []string{"not-a-key"}, true, "may not be used together"},
+	} {
+		err := readScheduledSecrets(test.accountID, test.encryptTo, test.usePassphrase)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("readScheduledSecrets(%q, %q, %t) = %v, want %q",
+				test.accountID, test.encryptTo, test.usePassphrase, err, test.want)
+		}
+	}
+
+	if err := readScheduledSecrets("", nil, false); err != nil {
+		t.Errorf("without secrets: %v", err)
+	}
+	t.Setenv(licenseKeyEnv, "testlicensekey")
+	t.Setenv(passphraseEnv, "testpassphrase")
+	if err := readScheduledSecrets("42", nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv(licenseKeyEnv) != "testlicensekey" || os.Getenv(passphraseEnv) != "testpassphrase" {
+		t.Error("the scheduled runs do not inherit the license key and passphrase")
+	}
+}
+
+func TestValidReference(t *testing.T) {
+	for reference, want := range map[string]bool{
+		"CASE-1":                true,
+		"ticket_12.3":           true,
+		strings.Repeat("a", 64): true,
+		strings.Repeat("a", 65): false,
+		"":                      false,
+		"-rf":                   false,
+		".hidden":               false,
+		"../CASE-1":             false,
+		"CASE 1":                false,
+		`CASE\1`:                false,
+	} {
+		if got := validReference.MatchString(reference); got != want {
+			t.Errorf("validReference.MatchString(%q) = %t, want %t", reference, got, want)
+		}
+	}
+}
@@ -0,0 +1,442 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// The environment variables with the credentials for sftp:// upload
+// targets. Without them, the SSH agent and the default keys in ~/.ssh are
+// tried.
+const (
+	sftpPasswordEnv      = "MM_NETWORK_ANALYZER_SFTP_PASSWORD"
+	sftpKeyEnv           = "MM_NETWORK_ANALYZER_SFTP_KEY"
+	sftpKeyPassphraseEnv = "MM_NETWORK_ANALYZER_SFTP_KEY_PASSPHRASE"
+	sftpKnownHostsEnv    = "MM_NETWORK_ANALYZER_SFTP_KNOWN_HOSTS"
+)
+
+const (
+	sftpDialTimeout = 30 * time.Second
+	// sftpChunk is the most data sent in one write request. Every server
+	// accepts packets of 32 KiB plus the header.
+	sftpChunk = 32 << 10
+	// sftpWindow is the number of write requests sent before waiting for
+	// a response, so that the upload is not limited by the round-trip
+	// time.
+	sftpWindow = 16
+	// sftpMaxPacket bounds the responses we read.
+	sftpMaxPacket = 256 << 10
+)
+
+// SFTP version 3 packet types and constants, from
+// draft-ietf-secsh-filexfer-02.
+const (
+	sftpVersion = 3
+
+	sshFxpInit    = 1
+	sshFxpVersion = 2
+	sshFxpOpen    = 3
+	sshFxpClose   = 4
+	sshFxpWrite   = 6
+	sshFxpStatus  = 101
+	sshFxpHandle  = 102
+
+	sshFxfWrite = 0x02
+	sshFxfCreat = 0x08
+	sshFxfTrunc = 0x10
+
+	sshFileXferAttrPermissions = 0x04
+
+	sshFxOK               = 0
+	sshFxEOF              = 1
+	sshFxNoSuchFile       = 2
+	sshFxPermissionDenied = 3
+	sshFxFailure          = 4
+	sshFxBadMessage       = 5
+	sshFxNoConnection     = 6
+	sshFxConnectionLost   = 7
+	sshFxOpUnsupported    = 8
+)
+
+// uploadSFTP uploads the archive at archivePath to a target of the form
+// sftp://user@host:port/path. A path starting with "/~/" is relative to
+// the user's home directory. If the path is empty or ends in "/", the
+// archive's file name is appended. The host key must be in known_hosts.
+func uploadSFTP(u *url.URL, archivePath string) (string, error) {
+	config, err := sftpClientConfig(u)
+	if err != nil {
+		return "", err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "22")
+	}
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return "", errors.Wrapf(err, "error connecting to %s", addr)
+	}
+	defer client.Close()
+
+	remote := u.Path
+	remote = objectKey(strings.TrimPrefix(remote, "/~/"), archivePath)
+
+	f, err := os.Open(archivePath) // nolint: gosec
+	if err != nil {
+		return "", errors.Wrap(err, "error opening archive for upload")
+	}
+	defer f.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", errors.Wrap(err, "error opening SSH session")
+	}
+	defer session.Close()
+	c, err := newSFTPClient(session)
+	if err != nil {
+		return "", err
+	}
+	if err := c.upload(remote, f); err != nil {
+		return "", errors.Wrapf(err, "error uploading archive to %s:%s", u.Host, remote)
+	}
+
+	uploaded := url.URL{Scheme: "sftp", User: url.User(config.User), Host: u.Host, Path: remote}
+	if !strings.HasPrefix(remote, "/") {
+		uploaded.Path = "/~/" + remote
+	}
+	return uploaded.String(), nil
+}
+
+func sftpClientConfig(u *url.URL) (*ssh.ClientConfig, error) {
+	name := u.User.Username()
+	if name == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, errors.Wrap(err, "error getting user name for SFTP upload")
+		}
+		name = current.Username
+	}
+	home, _ := os.UserHomeDir()
+
+	knownHostsPath := os.Getenv(sftpKnownHostsEnv)
+	if knownHostsPath == "" {
+		knownHostsPath = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, errors.Wrapf(
+			err,
+			"error reading %s, which must have the SFTP server's host key, e.g., from ssh-keyscan, or set %s",
+			knownHostsPath, sftpKnownHostsEnv,
+		)
+	}
+
+	var auth []ssh.AuthMethod
+	if keyPath := os.Getenv(sftpKeyEnv); keyPath != "" {
+		signer, err := readSSHKey(keyPath)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	} else {
+		if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+			if conn, err := net.Dial("unix", sock); err == nil {
+				auth = append(auth, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			}
+		}
+		var signers []ssh.Signer
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			signer, err := readSSHKey(filepath.Join(home, ".ssh", name))
+			if err == nil {
+				signers = append(signers, signer)
+			}
+		}
+		if len(signers) > 0 {
+			auth = append(auth, ssh.PublicKeys(signers...))
+		}
+	}
+	if password := os.Getenv(sftpPasswordEnv); password != "" {
+		auth = append(auth, ssh.Password(password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.Errorf(
+			"no SFTP credentials; set %s to a private key or %s to a password, or use an SSH agent",
+			sftpKeyEnv, sftpPasswordEnv,
+		)
+	}
+
+	return &ssh.ClientConfig{
+		User:            name,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sftpDialTimeout,
+	}, nil
+}
+
+// readSSHKey reads the private key at path, decrypting it with the
+// passphrase from sftpKeyPassphraseEnv if it is encrypted.
+func readSSHKey(path string) (ssh.Signer, error) {
+	b, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading SSH key %s", path)
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase := os.Getenv(sftpKeyPassphraseEnv)
+		if passphrase == "" {
+			return nil, errors.Errorf("SSH key %s is encrypted; set %s", path, sftpKeyPassphraseEnv)
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(b, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing SSH key %s", path)
+	}
+	return signer, nil
+}
+
+// sftpClient implements the parts of the SFTP protocol needed to upload a
+// file.
+type sftpClient struct {
+	w      io.Writer
+	r      io.Reader
+	nextID uint32
+	// pending are the IDs of the requests that have not been answered.
+	pending map[uint32]bool
+}
+
+func newSFTPClient(session *ssh.Session) (*sftpClient, error) {
+	w, err := session.StdinPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening SFTP input")
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening SFTP output")
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		return nil, errors.Wrap(err, "error starting the SFTP subsystem")
+	}
+	return initSFTPClient(w, r)
+}
+
+// initSFTPClient negotiates version 3 of the protocol with the server that
+// reads from w and writes to r.
+func initSFTPClient(w io.Writer, r io.Reader) (*sftpClient, error) {
+	c := &sftpClient{w: w, r: r, pending: map[uint32]bool{}}
+
+	init := binary.BigEndian.AppendUint32(nil, sftpVersion)
+	if err := c.send(sshFxpInit, init); err != nil {
+		return nil, err
+	}
+	typ, payload, err := c.recv()
+	if err != nil {
+		return nil, err
+	}
+	if typ != sshFxpVersion {
+		return nil, errors.Errorf("unexpected SFTP packet type %d in place of version", typ)
+	}
+	if len(payload) < 4 {
+		return nil, errors.New("short SFTP version")
+	}
+	if version := binary.BigEndian.Uint32(payload[:4]); version != sftpVersion {
+		return nil, errors.Errorf("unsupported SFTP version %d", version)
+	}
+	return c, nil
+}
+
+func (c *sftpClient) send(typ byte, payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1)) // nolint: gosec
+	packet = append(packet, typ)
+	packet = append(packet, payload...)
+	_, err := c.w.Write(packet)
+	return errors.Wrap(err, "error sending SFTP request")
+}
+
+func (c *sftpClient) recv() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, errors.Wrap(err, "error reading SFTP response")
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > sftpMaxPacket {
+		return 0, nil, errors.Errorf("invalid SFTP response length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, errors.Wrap(err, "error reading SFTP response")
+	}
+	return header[4], payload, nil
+}
+
+// request starts the payload of a new request with its ID, which is
+// pending until recvResponse reads the response to it.
+func (c *sftpClient) request() []byte {
+	c.nextID++
+	c.pending[c.nextID] = true
+	return binary.BigEndian.AppendUint32(nil, c.nextID)
+}
+
+// recvResponse reads a response and checks that it answers a pending
+// request. It returns the payload following the request ID. The server may
+// answer pipelined writes in any order.
+func (c *sftpClient) recvResponse() (byte, []byte, error) {
+	typ, payload, err := c.recv()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(payload) < 4 {
+		return 0, nil, errors.Errorf("short SFTP response of type %d", typ)
+	}
+	id := binary.BigEndian.Uint32(payload[:4])
+	if !c.pending[id] {
+		return 0, nil, errors.Errorf("SFTP response ID %d does not match a pending request", id)
+	}
+	delete(c.pending, id)
+	return typ, payload[4:], nil
+}
+
+func appendSFTPString(b []byte, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s))) // nolint: gosec
+	return append(b, s...)
+}
+
+// readSFTPString reads a length-prefixed string from the start of b and
+// returns it and the rest of b.
+func readSFTPString(b []byte) ([]byte, []byte, bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	n := binary.BigEndian.Uint32(b[:4])
+	if uint64(n) > uint64(len(b)-4) {
+		return nil, nil, false
+	}
+	return b[4 : 4+n], b[4+n:], true
+}
+
+// sftpStatusNames are the names of the status codes of version 3 of the
+// protocol.
+var sftpStatusNames = map[uint32]string{
+	sshFxEOF:              "end of file",
+	sshFxNoSuchFile:       "no such file",
+	sshFxPermissionDenied: "permission denied",
+	sshFxFailure:          "failure",
+	sshFxBadMessage:       "bad message",
+	sshFxNoConnection:     "no connection",
+	sshFxConnectionLost:   "connection lost",
+	sshFxOpUnsupported:    "operation unsupported",
+}
+
+// checkStatus returns an error unless the response, without its request
+// ID, is an OK status.
+func checkStatus(typ byte, payload []byte) error {
+	if typ != sshFxpStatus {
+		return errors.Errorf("unexpected SFTP packet type %d in place of status", typ)
+	}
+	if len(payload) < 4 {
+		return errors.New("short SFTP status")
+	}
+	code := binary.BigEndian.Uint32(payload[:4])
+	if code == sshFxOK {
+		return nil
+	}
+	name, ok := sftpStatusNames[code]
+	if !ok {
+		name = fmt.Sprintf("unknown status %d", code)
+	}
+	// The message is optional in servers that predate version 3.
+	if msg, _, ok := readSFTPString(payload[4:]); ok && len(msg) > 0 {
+		return errors.Errorf("SFTP server returned %s: %s", name, msg)
+	}
+	return errors.Errorf("SFTP server returned %s", name)
+}
+
+// upload writes r to the named remote file, replacing it if it exists.
+func (c *sftpClient) upload(name string, r io.Reader) error {
+	open := c.request()
+	open = appendSFTPString(open, []byte(name))
+	open = binary.BigEndian.AppendUint32(open, sshFxfWrite|sshFxfCreat|sshFxfTrunc)
+	open = binary.BigEndian.AppendUint32(open, sshFileXferAttrPermissions)
+	open = binary.BigEndian.AppendUint32(open, 0o600)
+	if err := c.send(sshFxpOpen, open); err != nil {
+		return err
+	}
+	typ, payload, err := c.recvResponse()
+	if err != nil {
+		return err
+	}
+	if typ != sshFxpHandle {
+		if err := checkStatus(typ, payload); err != nil {
+			return errors.Wrap(err, "error opening remote file")
+		}
+		return errors.New("SFTP server returned OK in place of a handle")
+	}
+	handle, _, ok := readSFTPString(payload)
+	if !ok {
+		return errors.New("short SFTP handle")
+	}
+
+	buf := make([]byte, sftpChunk)
+	var offset uint64
+	outstanding := 0
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			write := c.request()
+			write = appendSFTPString(write, handle)
+			write = binary.BigEndian.AppendUint64(write, offset)
+			write = appendSFTPString(write, buf[:n])
+			if err := c.send(sshFxpWrite, write); err != nil {
+				return err
+			}
+			offset += uint64(n)
+			outstanding++
+			if outstanding == sftpWindow {
+				if err := c.checkResponse(); err != nil {
+					return errors.Wrap(err, "error writing remote file")
+				}
+				outstanding--
+			}
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return errors.Wrap(readErr, "error reading archive")
+		}
+	}
+	for ; outstanding > 0; outstanding-- {
+		if err := c.checkResponse(); err != nil {
+			return errors.Wrap(err, "error writing remote file")
+		}
+	}
+
+	closeReq := appendSFTPString(c.request(), handle)
+	if err := c.send(sshFxpClose, closeReq); err != nil {
+		return err
+	}
+	if err := c.checkResponse(); err != nil {
+		return errors.Wrap(err, "error closing remote file")
+	}
+	return nil
+}
+
+func (c *sftpClient) checkResponse() error {
+	typ, payload, err := c.recvResponse()
+	if err != nil {
+		return err
+	}
+	return checkStatus(typ, payload)
+}
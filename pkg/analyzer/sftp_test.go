@@ -0,0 +1,272 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fakeSFTPServer is an in-process SFTP server that handles the requests
+// sftpClient sends.
+type fakeSFTPServer struct {
+	version uint32
+	// openStatus, if not OK, is returned in place of a handle.
+	openStatus uint32
+	// failWrite, if not zero, is the 1-based number of the write request
+	// that fails.
+	failWrite int
+	// reorder answers each group of four writes, and the last short
+	// write, in reverse order.
+	reorder bool
+	// wrongCloseID answers the close request with an ID that was never
+	// sent.
+	wrongCloseID bool
+
+	name     string
+	contents []byte
+	closed   bool
+	done     chan struct{}
+}
+
+// start serves the client's requests until the client's side is closed.
+// It returns the client.
+func (s *fakeSFTPServer) start(t *testing.T) (*sftpClient, error) {
+	t.Helper()
+	serverR, clientW := io.Pipe()
+	clientR, serverW := io.Pipe()
+	t.Cleanup(func() {
+		_ = clientW.Close()
+		_ = clientR.Close()
+		<-s.done
+	})
+
+	// Responses are queued so that the server never blocks the client's
+	// pipelined writes.
+	responses := make(chan []byte, 1024)
+	s.done = make(chan struct{})
+	go func() {
+		for packet := range responses {
+			if _, err := serverW.Write(packet); err != nil {
+				break
+			}
+		}
+		for range responses {
+		}
+	}()
+	go func() {
+		defer close(s.done)
+		defer close(responses)
+		s.serve(serverR, responses)
+	}()
+	return initSFTPClient(clientW, clientR)
+}
+
+func sftpPacket(typ byte, payload []byte) []byte {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1)) // nolint: gosec
+	return append(append(packet, typ), payload...)
+}
+
+func sftpStatusPacket(id, code uint32, msg string) []byte {
+	payload := binary.BigEndian.AppendUint32(nil, id)
+	payload = binary.BigEndian.AppendUint32(payload, code)
+	payload = appendSFTPString(payload, []byte(msg))
+	payload = appendSFTPString(payload, []byte("en"))
+	return sftpPacket(sshFxpStatus, payload)
+}
+
+func (s *fakeSFTPServer) serve(r io.Reader, responses chan<- []byte) {
+	var held [][]byte
+	flush := func() {
+		slices.Reverse(held)
+		for _, packet := range held {
+			responses <- packet
+		}
+		held = nil
+	}
+	writes := 0
+	for {
+		var header [5]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[:4])-1)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return
+		}
+		if header[4] == sshFxpInit {
+			responses <- sftpPacket(sshFxpVersion, binary.BigEndian.AppendUint32(nil, s.version))
+			continue
+		}
+		id := binary.BigEndian.Uint32(payload[:4])
+		rest := payload[4:]
+		switch header[4] {
+		case sshFxpOpen:
+			name, _, _ := readSFTPString(rest)
+			s.name = string(name)
+			if s.openStatus != sshFxOK {
+				responses <- sftpStatusPacket(id, s.openStatus, "")
+				continue
+			}
+			handle := appendSFTPString(binary.BigEndian.AppendUint32(nil, id), []byte("h1"))
+			responses <- sftpPacket(sshFxpHandle, handle)
+		case sshFxpWrite:
+			writes++
+			_, rest, _ = readSFTPString(rest)
+			offset := binary.BigEndian.Uint64(rest[:8])
+			data, _, _ := readSFTPString(rest[8:])
+			if end := int(offset) + len(data); end > len(s.contents) { // nolint: gosec
+				s.contents = append(s.contents, make([]byte, end-len(s.contents))...)
+			}
+			copy(s.contents[offset:], data)
+			packet := sftpStatusPacket(id, sshFxOK, "")
+			if writes == s.failWrite {
+				packet = sftpStatusPacket(id, sshFxFailure, "disk full")
+			}
+			if !s.reorder {
+				responses <- packet
+				continue
+			}
+			held = append(held, packet)
+			if len(held) == 4 || len(data) < sftpChunk {
+				flush()
+			}
+		case sshFxpClose:
+			flush()
+			s.closed = true
+			if s.wrongCloseID {
+				id += 100
+			}
+			responses <- sftpStatusPacket(id, sshFxOK, "")
+		default:
+			responses <- sftpStatusPacket(id, sshFxOpUnsupported, "")
+		}
+	}
+}
+
+func TestSFTPUpload(t *testing.T) {
+	// The archive takes more write requests than the window, and does not
+	// end on a chunk boundary.
+	archive := testOutput(3*sftpWindow*sftpChunk + 123)
+	for _, reorder := range []bool{false, true} {
+		s := &fakeSFTPServer{version: sftpVersion, reorder: reorder}
+		c, err := s.start(t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.upload("uploads/archive.zip", bytes.NewReader(archive)); err != nil {
+			t.Fatalf("reorder %t: %v", reorder, err)
+		}
+		if s.name != "uploads/archive.zip" || !s.closed {
+			t.Errorf("reorder %t: uploaded %q, closed %t", reorder, s.name, s.closed)
+		}
+		if !bytes.Equal(s.contents, archive) {
+			t.Errorf("reorder %t: the uploaded file differs from the archive", reorder)
+		}
+		if len(c.pending) != 0 {
+			t.Errorf("reorder %t: %d requests were not answered", reorder, len(c.pending))
+		}
+	}
+}
+
+func TestSFTPUploadErrors(t *testing.T) {
+	archive := testOutput(5 * sftpChunk)
+	tests := []struct {
+		name   string
+		server *fakeSFTPServer
+		want   string
+	}{
+		{
+			"open denied",
+			&fakeSFTPServer{version: sftpVersion, openStatus: sshFxPermissionDenied},
+			"error opening remote file: SFTP server returned permission denied",
+		},
+		{
+			"write fails",
+			&fakeSFTPServer{version: sftpVersion, failWrite: 3},
+			"error writing remote file: SFTP server returned failure: disk full",
+		},
+		{
+			"wrong response ID",
+			&fakeSFTPServer{version: sftpVersion, wrongCloseID: true},
+			"does not match a pending request",
+		},
+	}
+	for _, test := range tests {
+		c, err := test.server.start(t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.upload("archive.zip", bytes.NewReader(archive))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestSFTPVersion(t *testing.T) {
+	s := &fakeSFTPServer{version: 2}
+	if _, err := s.start(t); err == nil || !strings.Contains(err.Error(), "unsupported SFTP version 2") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestCheckStatus(t *testing.T) {
+	status := func(code uint32, msg ...string) []byte {
+		payload := binary.BigEndian.AppendUint32(nil, code)
+		for _, m := range msg {
+			payload = appendSFTPString(payload, []byte(m))
+		}
+		return payload
+	}
+	tests := []struct {
+		typ     byte
+		payload []byte
+		want    string
+	}{
+		{sshFxpStatus, status(sshFxOK), ""},
+		{
+			sshFxpStatus,
+			status(sshFxNoSuchFile, "no such directory", "en"),
+			"SFTP server returned no such file: no such directory",
+		},
+		{sshFxpStatus, status(sshFxFailure), "SFTP server returned failure"},
+		{sshFxpStatus, status(42, ""), "SFTP server returned unknown status 42"},
+		// A truncated message is left out rather than read past the end.
+		{sshFxpStatus, append(status(sshFxEOF), 0, 0, 1, 0, 'x'), "SFTP server returned end of file"},
+		{sshFxpStatus, []byte{0, 0}, "short SFTP status"},
+		{sshFxpHandle, status(sshFxOK), "unexpected SFTP packet type 102 in place of status"},
+	}
+	for _, test := range tests {
+		err := checkStatus(test.typ, test.payload)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("checkStatus(%d, %v) = %q, want %q", test.typ, test.payload, got, test.want)
+		}
+	}
+}
+
+func TestSFTPRecvResponse(t *testing.T) {
+	var packets bytes.Buffer
+	packets.Write(sftpStatusPacket(1, sshFxOK, ""))
+	packets.Write(sftpStatusPacket(1, sshFxOK, ""))
+	packets.Write(sftpPacket(sshFxpStatus, []byte{0, 0}))
+	c := &sftpClient{r: &packets, pending: map[uint32]bool{}}
+	c.request()
+
+	if _, _, err := c.recvResponse(); err != nil {
+		t.Fatal(err)
+	}
+	// A second response to the same request is rejected.
+	if _, _, err := c.recvResponse(); err == nil {
+		t.Error("a duplicate response was accepted")
+	}
+	if _, _, err := c.recvResponse(); err == nil {
+		t.Error("a response without an ID was accepted")
+	}
+}
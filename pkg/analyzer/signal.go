@@ -0,0 +1,35 @@
+package analyzer
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// cancelOnSignal returns a context that is cancelled on the first SIGINT or
+// SIGTERM so that the archive may be written with what has been collected.
+// The default behavior is then restored so that a second signal exits
+// immediately.
+func cancelOnSignal(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(parent)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			signal.Reset(os.Interrupt, syscall.SIGTERM)
+			slog.Warn(
+				"writing the archive with what was collected; repeat to exit immediately",
+				"signal", sig.String(),
+			)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		cancel()
+	}
+}
@@ -0,0 +1,77 @@
+package analyzer
+
+import (
+	"compress/flate"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCancelOnSignal(t *testing.T) {
+	ctx, stop := cancelOnSignal(context.Background())
+	defer stop()
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot send an interrupt on this platform: %v", err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("the context was not cancelled by the interrupt")
+	}
+}
+
+func TestCancelOnSignalStop(t *testing.T) {
+	ctx, stop := cancelOnSignal(context.Background())
+	stop()
+	if ctx.Err() == nil {
+		t.Error("the context was not cancelled by stop")
+	}
+}
+
+func TestInterruptedRunWritesArchive(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	path := filepath.Join(t.TempDir(), "out.zip")
+	if err := a.open(FormatZip, path, archiveOptions{level: flate.DefaultCompression}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go func() {
+		<-started
+		cancel()
+	}()
+	a.runTasks(ctx, []*task{
+		newTask("mtr.txt", func(ctx context.Context) {
+			a.storeFile("mtr.txt", []byte("partial output"))
+			close(started)
+			<-ctx.Done()
+		}),
+		blockingTask(a, "ping.txt"),
+	}, 1, time.Minute)
+
+	if want := []string{"mtr", "ping"}; !reflect.DeepEqual(a.interrupted, want) {
+		t.Errorf("interrupted tasks = %v, want %v", a.interrupted, want)
+	}
+	if err := a.writeFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.close(); err != nil {
+		t.Fatal(err)
+	}
+	// The archive is complete and holds the partial output.
+	got := readArchive(t, FormatZip, path)["mtr.txt"]
+	want := "partial output\n*** INTERRUPTED: this output may be incomplete as the run was interrupted ***\n"
+	if got != want {
+		t.Errorf("mtr.txt = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// filterSockets keeps the header and the sockets in the output of ss or
+// netstat that are listening or connected to one of the target hosts, so
+// that connections unrelated to MaxMind are not shared. The header is
+// every line before the first one with an address. Indented lines without
+// an address, such as those ss -i adds, stay with the socket they follow.
+func (a *analyzer) filterSockets(ctx context.Context, output []byte) []byte {
+	return filterSocketLines(output, a.targetAddrs(ctx))
+}
+
+func filterSocketLines(output []byte, addrs []netip.Addr) []byte {
+	buf := new(bytes.Buffer)
+	header, keep := true, false
+	for line := range strings.Lines(string(output)) {
+		hasAddr := slices.ContainsFunc(strings.Fields(line), isSocketAddr)
+		switch {
+		case header && !hasAddr:
+			keep = true
+		case !hasAddr && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")):
+			// A continuation of the previous socket.
+		default:
+			header = false
+			keep = keepSocketLine(line, addrs)
+		}
+		if keep {
+			buf.WriteString(line)
+		}
+	}
+	buf.WriteString("# Only listening sockets and connections to the hosts and MaxMind endpoints are shown\n")
+	return buf.Bytes()
+}
+
+func keepSocketLine(line string, addrs []netip.Addr) bool {
+	for _, field := range strings.Fields(line) {
+		if field == "LISTEN" || field == "LISTENING" {
+			return true
+		}
+		if addr, ok := socketAddr(field); ok && slices.Contains(addrs, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSocketAddr(field string) bool {
+	_, ok := socketAddr(field)
+	return ok
+}
+
+// socketAddr parses the address in a field such as 192.0.2.1:443,
+// [2001:db8::1]:443, or, as macOS's netstat prints them, 192.0.2.1.443.
+func socketAddr(field string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(field)
+	if err != nil {
+		i := strings.LastIndexByte(field, '.')
+		if i < 0 {
+			return netip.Addr{}, false
+		}
+		host = field[:i]
+	}
+	// ss prints the zone of link-local addresses with a %.
+	host, _, _ = strings.Cut(host, "%")
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,89 @@
+package analyzer
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestFilterSocketLines(t *testing.T) {
+	addrs := []netip.Addr{netip.MustParseAddr("104.18.0.5"), netip.MustParseAddr("2606:4700::6812:5")}
+	tests := []struct {
+		name, output, want string
+	}{
+		{
+			name: "ss",
+			output: `Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:Port Process
+tcp   LISTEN 0      4096   127.0.0.53%lo:53     0.0.0.0:*
+tcp   ESTAB  0      0      192.168.1.20:51234  104.18.0.5:443    users:(("curl",pid=42,fd=5))
+	 cubic wscale:7,7 rto:204 rtt:3.5/1.75 retrans:0/2
+tcp   ESTAB  0      0      192.168.1.20:40000  198.51.100.7:22
+	 cubic wscale:7,7 rto:204 rtt:1.2/0.6
+tcp   ESTAB  0      0      [fe80::1%eth0]:50000 [2606:4700::6812:5]:443
+`,
+			want: `Netid State  Recv-Q Send-Q Local Address:Port  Peer Address:Port Process
+tcp   LISTEN 0      4096   127.0.0.53%lo:53     0.0.0.0:*
+tcp   ESTAB  0      0      192.168.1.20:51234  104.18.0.5:443    users:(("curl",pid=42,fd=5))
+	 cubic wscale:7,7 rto:204 rtt:3.5/1.75 retrans:0/2
+tcp   ESTAB  0      0      [fe80::1%eth0]:50000 [2606:4700::6812:5]:443
+`,
+		},
+		{
+			name: "macOS netstat",
+			output: `Active Internet connections (including servers)
+Proto Recv-Q Send-Q  Local Address          Foreign Address        (state)
+tcp4       0      0  192.168.1.20.51234     104.18.0.5.443         ESTABLISHED
+tcp4       0      0  192.168.1.20.40000     198.51.100.7.22        ESTABLISHED
+tcp4       0      0  *.22                   *.*                    LISTEN
+`,
+			want: `Active Internet connections (including servers)
+Proto Recv-Q Send-Q  Local Address          Foreign Address        (state)
+tcp4       0      0  192.168.1.20.51234     104.18.0.5.443         ESTABLISHED
+tcp4       0      0  *.22                   *.*                    LISTEN
+`,
+		},
+		{
+			name: "Windows netstat",
+			output: `
+Active Connections
+
+  Proto  Local Address          Foreign Address        State           PID
+  TCP    0.0.0.0:135            0.0.0.0:0              LISTENING       1000
+  TCP    192.168.1.20:51234     104.18.0.5:443         ESTABLISHED     4242
+  TCP    192.168.1.20:40000     198.51.100.7:22        ESTABLISHED     4343
+`,
+			want: `
+Active Connections
+
+  Proto  Local Address          Foreign Address        State           PID
+  TCP    0.0.0.0:135            0.0.0.0:0              LISTENING       1000
+  TCP    192.168.1.20:51234     104.18.0.5:443         ESTABLISHED     4242
+`,
+		},
+	}
+	const note = "# Only listening sockets and connections to the hosts and MaxMind endpoints are shown\n"
+	for _, test := range tests {
+		if got := string(filterSocketLines([]byte(test.output), addrs)); got != test.want+note {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", test.name, got, test.want+note)
+		}
+	}
+}
+
+func TestSocketAddr(t *testing.T) {
+	for field, want := range map[string]string{
+		"192.0.2.1:443":             "192.0.2.1",
+		"[2001:db8::1]:443":         "2001:db8::1",
+		"192.0.2.1.443":             "192.0.2.1",
+		"[fe80::1%eth0]:546":        "fe80::1",
+		"[::ffff:192.0.2.1]:443":    "192.0.2.1",
+		"2001:db8::1.443":           "2001:db8::1",
+		"users:((\"curl\",pid=42))": "",
+		"0.0.0.0:*":                 "0.0.0.0",
+		"*.*":                       "",
+		"ESTABLISHED":               "",
+	} {
+		addr, ok := socketAddr(field)
+		if got := addr.String(); ok != (want != "") || (ok && got != want) {
+			t.Errorf("socketAddr(%q) = %s, %v, want %q", field, got, ok, want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package analyzer
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// setTTL sets the IPv4 TTL or IPv6 hop limit on the socket underlying c.
+func setTTL(c syscall.RawConn, network string, ttl int) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if network == "ip6" {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl)
+			return
+		}
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+	})
+	if err != nil {
+		return errors.Wrap(err, "error accessing socket")
+	}
+	return errors.Wrap(sockErr, "error setting TTL")
+}
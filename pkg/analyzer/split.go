@@ -0,0 +1,177 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// archiveEntryOverhead bounds the headers of a file in an archive,
+	// e.g., a 512-byte tar header and its padding, plus those of the
+	// archive itself.
+	archiveEntryOverhead = 1024
+	archiveOverhead      = 4096
+	// minArchiveSize is the smallest --max-archive-size allowed, so that
+	// the overhead is a small part of each part.
+	minArchiveSize = 64 << 10
+)
+
+// splitArchive writes an archive in numbered parts, each of which is a
+// complete archive of at most limit bytes. A file that does not fit in a
+// part by itself is split into pieces named, e.g., capture.pcap.001 and
+// capture.pcap.002, which may be joined with cat. The first part is
+// written to the given path and the rest to, e.g., name.part2.zip.
+//
+// The size of a part is estimated from the uncompressed sizes of its
+// files, so parts with text are usually much smaller than the limit.
+type splitArchive struct {
+	format string
+	path   string
+	opts   archiveOptions
+
+	current ArchiveWriter
+	// size is the estimated size of the current part.
+	size  int64
+	paths []string
+}
+
+func newSplitArchive(format, path string, opts archiveOptions) (*splitArchive, error) {
+	if opts.limit < minArchiveSize {
+		return nil, errors.Errorf("the maximum archive size must be at least %d bytes", minArchiveSize)
+	}
+	if path == stdoutPath {
+		return nil, errors.New("an archive written to standard output cannot be split")
+	}
+	w, err := newArchiveWriter(format, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &splitArchive{
+		format:  format,
+		path:    path,
+		opts:    opts,
+		current: w,
+		size:    archiveOverhead,
+		paths:   []string{path},
+	}, nil
+}
+
+func (s *splitArchive) WriteFile(name string, contents []byte, modified time.Time) error {
+	return s.writeFrom(name, bytes.NewReader(contents), int64(len(contents)), modified)
+}
+
+func (s *splitArchive) writeFrom(name string, r io.Reader, size int64, modified time.Time) error {
+	piece := s.opts.limit - archiveOverhead - archiveEntryOverhead
+	// Deflate may expand incompressible data slightly.
+	piece -= piece / 1000
+	if size <= piece {
+		return s.write(name, r, size, modified)
+	}
+	for i, n := int64(0), 1; i < size; i, n = i+piece, n+1 {
+		end := min(i+piece, size)
+		if err := s.write(fmt.Sprintf("%s.%03d", name, n), r, end-i, modified); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write writes size bytes from r as a file that fits in a part, starting a
+// new part if it does not fit in the current one.
+func (s *splitArchive) write(name string, r io.Reader, contentSize int64, modified time.Time) error {
+	size := contentSize + contentSize/1000 + archiveEntryOverhead
+	if s.size > archiveOverhead && s.size+size > s.opts.limit {
+		if err := s.current.Close(); err != nil {
+			return err
+		}
+		path := partPath(s.path, len(s.paths)+1)
+		w, err := newArchiveWriter(s.format, path, s.opts)
+		if err != nil {
+			return err
+		}
+		s.current = w
+		s.size = archiveOverhead
+		s.paths = append(s.paths, path)
+	}
+	s.size += size
+	return writeArchiveFile(s.current, name, r, contentSize, modified)
+}
+
+func (s *splitArchive) Close() error {
+	return s.current.Close()
+}
+
+// partPath returns the path of part n of the archive at path by inserting
+// ".partN" before the archive's extensions.
+func partPath(path string, n int) string {
+	base, ext := path, ""
+	if strings.HasSuffix(base, ".age") {
+		base, ext = strings.TrimSuffix(base, ".age"), ".age"
+	}
+	for _, format := range []string{FormatTarGz, FormatZip} {
+		if strings.HasSuffix(base, "."+format) {
+			base, ext = strings.TrimSuffix(base, "."+format), "."+format+ext
+			break
+		}
+	}
+	return base + ".part" + strconv.Itoa(n) + ext
+}
+
+// newArchive returns an ArchiveWriter for path that is split into parts if
+// opts has a limit.
+func newArchive(format, path string, opts archiveOptions) (ArchiveWriter, error) {
+	if opts.limit == 0 {
+		return newArchiveWriter(format, path, opts)
+	}
+	return newSplitArchive(format, path, opts)
+}
+
+// archivePaths returns the paths of the files w wrote, given that it was
+// created for path.
+func archivePaths(w ArchiveWriter, path string) []string {
+	if s, ok := w.(*splitArchive); ok {
+		return s.paths
+	}
+	return []string{path}
+}
+
+// byteSize is a flag.Value for a number of bytes, optionally with a unit,
+// e.g., "500K", "25MB", or "1GiB". K, M, and G are powers of 1000, and
+// Ki, Mi, and Gi are powers of 1024. A trailing "B" is ignored.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	if *b == 0 {
+		return "0"
+	}
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(v string) error {
+	s := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(v)), "B")
+	multiplier := int64(1)
+	for _, u := range []struct {
+		suffix string
+		value  int64
+	}{
+		{"KI", 1 << 10}, {"MI", 1 << 20}, {"GI", 1 << 30},
+		{"K", 1e3}, {"M", 1e6}, {"G", 1e9},
+	} {
+		if strings.HasSuffix(s, u.suffix) {
+			s, multiplier = strings.TrimSuffix(s, u.suffix), u.value
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return errors.Errorf("invalid size %q", v)
+	}
+	*b = byteSize(n * float64(multiplier))
+	return nil
+}
@@ -0,0 +1,159 @@
+package analyzer
+
+import (
+	"compress/flate"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitArchive(t *testing.T) {
+	// Random data does not compress, so it is the worst case for the
+	// size estimates.
+	rng := rand.New(rand.NewPCG(1, 2)) // nolint: gosec
+	capture := make([]byte, 3*minArchiveSize)
+	for i := range capture {
+		capture[i] = byte(rng.Uint32())
+	}
+
+	for _, format := range []string{FormatZip, FormatTarGz} {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out."+format)
+			w, err := newArchive(format, path, archiveOptions{limit: minArchiveSize, level: flate.DefaultCompression})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, contents := range map[string][]byte{
+				"resolv.conf":  []byte("nameserver 192.0.2.53\n"),
+				"capture.pcap": capture,
+			} {
+				if err := w.WriteFile(name, contents, time.Now()); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			paths := archivePaths(w, path)
+			if len(paths) < 4 || paths[0] != path || paths[1] != partPath(path, 2) {
+				t.Fatalf("paths = %v", paths)
+			}
+			files := map[string]string{}
+			for _, p := range paths {
+				fi, err := os.Stat(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fi.Size() > minArchiveSize {
+					t.Errorf("%s is %d bytes", p, fi.Size())
+				}
+				for name, contents := range readArchive(t, format, p) {
+					files[name] = contents
+				}
+			}
+
+			if files["resolv.conf"] != "nameserver 192.0.2.53\n" {
+				t.Errorf("resolv.conf = %q", files["resolv.conf"])
+			}
+			var pieces []string
+			for name := range files {
+				if strings.HasPrefix(name, "capture.pcap.") {
+					pieces = append(pieces, name)
+				}
+			}
+			sort.Strings(pieces)
+			if len(pieces) < 3 || pieces[0] != "capture.pcap.001" {
+				t.Fatalf("pieces = %v", pieces)
+			}
+			var joined strings.Builder
+			for _, p := range pieces {
+				joined.WriteString(files[p])
+			}
+			if joined.String() != string(capture) {
+				t.Error("the pieces do not join to form the file")
+			}
+		})
+	}
+}
+
+func TestNewSplitArchiveErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.zip")
+	for _, test := range []struct {
+		path  string
+		limit int64
+		want  string
+	}{
+		{path, minArchiveSize - 1, "must be at least"},
+		{stdoutPath, minArchiveSize, "cannot be split"},
+	} {
+		_, err := newSplitArchive(FormatZip, test.path, archiveOptions{limit: test.limit})
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("newSplitArchive(%s, %d) = %v, want %q", test.path, test.limit, err, test.want)
+		}
+	}
+
+	// Without a limit, the archive is not split.
+	w, err := newArchive(FormatZip, path, archiveOptions{level: flate.DefaultCompression})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if paths := archivePaths(w, path); !reflect.DeepEqual(paths, []string{path}) {
+		t.Errorf("paths = %v", paths)
+	}
+}
+
+func TestPartPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"/tmp/mm-network-analysis.zip":        "/tmp/mm-network-analysis.part2.zip",
+		"/tmp/mm-network-analysis.tar.gz":     "/tmp/mm-network-analysis.part2.tar.gz",
+		"/tmp/mm-network-analysis.zip.age":    "/tmp/mm-network-analysis.part2.zip.age",
+		"/tmp/mm-network-analysis.tar.gz.age": "/tmp/mm-network-analysis.part2.tar.gz.age",
+		"/tmp/analysis":                       "/tmp/analysis.part2",
+	} {
+		if got := partPath(path, 2); got != want {
+			t.Errorf("partPath(%s, 2) = %s, want %s", path, got, want)
+		}
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	for v, want := range map[string]byteSize{
+		"0":      0,
+		"1024":   1024,
+		"500K":   500e3,
+		"25MB":   25e6,
+		"25 mb":  25e6,
+		"1.5G":   1.5e9,
+		"64KiB":  64 << 10,
+		"2Mi":    2 << 20,
+		" 1GiB ": 1 << 30,
+	} {
+		var b byteSize
+		if err := b.Set(v); err != nil {
+			t.Errorf("Set(%q) = %v", v, err)
+			continue
+		}
+		if b != want {
+			t.Errorf("Set(%q) = %d, want %d", v, b, want)
+		}
+	}
+	for _, v := range []string{"", "MB", "-1K", "ten", "5T"} {
+		var b byteSize
+		if err := b.Set(v); err == nil {
+			t.Errorf("Set(%q) = %d", v, b)
+		}
+	}
+	b := byteSize(25e6)
+	if got := b.String(); got != "25000000" {
+		t.Errorf("String = %s", got)
+	}
+}
@@ -0,0 +1,411 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// spoolThreshold is the size above which a stored file is kept in a
+// temporary file until the archive is written rather than in memory, so
+// that packet captures and the output of verbose commands do not
+// accumulate in memory.
+const spoolThreshold = 1 << 20
+
+// storedFile is a file to be written to the archive. Its contents are in
+// memory or, if path is set, in a file in the spool directory.
+type storedFile struct {
+	name     string
+	contents []byte
+	path     string
+	// size is the size of the file at path.
+	size int64
+}
+
+// length returns the size of the file's contents.
+func (sf *storedFile) length() int64 {
+	if sf.path == "" {
+		return int64(len(sf.contents))
+	}
+	return sf.size
+}
+
+// open returns a reader for the file's contents.
+func (sf *storedFile) open() (io.ReadCloser, error) {
+	if sf.path == "" {
+		return io.NopCloser(bytes.NewReader(sf.contents)), nil
+	}
+	f, err := os.Open(sf.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening spooled "+sf.name)
+	}
+	return f, nil
+}
+
+// read returns the file's contents, reading them from the spool if
+// necessary.
+func (sf *storedFile) read() ([]byte, error) {
+	if sf.path == "" {
+		return sf.contents, nil
+	}
+	b, err := os.ReadFile(sf.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading spooled "+sf.name)
+	}
+	return b, nil
+}
+
+// sha256 returns the hex-encoded SHA-256 digest of the file's contents.
+func (sf *storedFile) sha256() (string, error) {
+	r, err := sf.open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", errors.Wrap(err, "error hashing "+sf.name)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// replace replaces the file's contents with b.
+func (sf *storedFile) replace(b []byte) error {
+	if sf.path == "" {
+		sf.contents = b
+		return nil
+	}
+	if err := os.WriteFile(sf.path, b, 0o600); err != nil {
+		return errors.Wrap(err, "error writing spooled "+sf.name)
+	}
+	sf.size = int64(len(b))
+	return nil
+}
+
+// replaceFrom replaces the file's contents with those of the file at path,
+// which is moved to the spool if sf is spooled.
+func (sf *storedFile) replaceFrom(path string) error {
+	if sf.path == "" {
+		b, err := os.ReadFile(path) // nolint: gosec
+		if err != nil {
+			return errors.Wrap(err, "error reading "+path)
+		}
+		sf.contents = b
+		return nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "error getting the size of "+path)
+	}
+	if err := os.Rename(path, sf.path); err != nil {
+		return errors.Wrap(err, "error moving "+path+" to the spool")
+	}
+	sf.size = fi.Size()
+	return nil
+}
+
+// appendBytes appends b to the file's contents.
+func (sf *storedFile) appendBytes(b []byte) error {
+	if sf.path == "" {
+		sf.contents = append(sf.contents, b...)
+		return nil
+	}
+	f, err := os.OpenFile(sf.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return errors.Wrap(err, "error opening spooled "+sf.name)
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err, "error appending to spooled "+sf.name)
+	}
+	sf.size += int64(len(b))
+	return nil
+}
+
+// spool returns the spool directory, creating it when first needed.
+func (a *analyzer) spool() (string, error) {
+	a.spoolOnce.Do(func() {
+		dir, err := os.MkdirTemp("", archivePrefix+"-spool-")
+		a.spoolDir, a.spoolErr = dir, errors.Wrap(err, "error creating spool directory")
+	})
+	return a.spoolDir, a.spoolErr
+}
+
+// createSpoolFile creates a file in the spool directory.
+func (a *analyzer) createSpoolFile() (*os.File, error) {
+	dir, err := a.spool()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "file-")
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating spool file")
+	}
+	return f, nil
+}
+
+// removeSpool removes the spool directory, if it was created. It must be
+// called once the archive has been written.
+func (a *analyzer) removeSpool() {
+	if a.spoolDir != "" {
+		_ = os.RemoveAll(a.spoolDir)
+	}
+}
+
+// newStoredFile returns a stored file with contents, which are moved to the
+// spool if they are large.
+func (a *analyzer) newStoredFile(name string, contents []byte) *storedFile {
+	if len(contents) <= spoolThreshold {
+		return &storedFile{name: name, contents: contents}
+	}
+	f, err := a.createSpoolFile()
+	if err == nil {
+		_, err = f.Write(contents)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		slog.Warn("keeping file in memory", "file", name, "error", err)
+		return &storedFile{name: name, contents: contents}
+	}
+	return &storedFile{name: name, path: f.Name(), size: int64(len(contents))}
+}
+
+// storeFileFrom stores the file at path, which is moved to the spool
+// rather than read into memory if it is large. It is not truncated.
+func (a *analyzer) storeFileFrom(name, path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "error getting the size of "+path)
+	}
+	spooled := fi.Size() > spoolThreshold
+	if dir, err := a.spool(); spooled && (err != nil || filepath.Dir(path) != dir) {
+		var f *os.File
+		f, err = a.createSpoolFile()
+		if err == nil {
+			_ = f.Close()
+			if err = os.Rename(path, f.Name()); err == nil {
+				path = f.Name()
+			}
+		}
+		if err != nil {
+			slog.Warn("reading file into memory", "file", name, "error", err)
+			spooled = false
+		}
+	}
+	sf := &storedFile{name: name, path: path, size: fi.Size()}
+	if !spooled {
+		contents, err := os.ReadFile(path) // nolint: gosec
+		if err != nil {
+			return errors.Wrap(err, "error reading "+path)
+		}
+		_ = os.Remove(path)
+		sf = &storedFile{name: name, contents: contents}
+	}
+
+	a.filesMutex.Lock()
+	a.files = append(a.files, sf)
+	a.filesMutex.Unlock()
+	return nil
+}
+
+// taskOutput collects the output of a command, truncated to the limit, in
+// the spool or, if the spool cannot be used, in memory.
+type taskOutput struct {
+	spooled *spooledOutput
+	mem     *cappedBuffer
+}
+
+func (a *analyzer) newTaskOutput() *taskOutput {
+	f, err := a.createSpoolFile()
+	if err != nil {
+		slog.Warn("keeping command output in memory", "error", err)
+		return &taskOutput{mem: newCappedBuffer(a.maxTaskOutput)}
+	}
+	return &taskOutput{spooled: &spooledOutput{limit: a.maxTaskOutput, head: f}}
+}
+
+func (t *taskOutput) Write(p []byte) (int, error) {
+	if t.spooled != nil {
+		return t.spooled.Write(p)
+	}
+	return t.mem.Write(p)
+}
+
+// bytes returns the output, reading it into memory. It must be called
+// after the command has exited, and only once.
+func (t *taskOutput) bytes() ([]byte, error) {
+	if t.spooled == nil {
+		return t.mem.Bytes(), nil
+	}
+	path, err := t.spooled.finish()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+	b, err := os.ReadFile(path) // nolint: gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading spooled output")
+	}
+	return b, nil
+}
+
+// storeOutput stores the output of a command as the named file. It must be
+// called after the command has exited, and only once.
+func (a *analyzer) storeOutput(ctx context.Context, name string, t *taskOutput) {
+	if t.spooled == nil {
+		a.storeFile(name, t.mem.Bytes())
+		return
+	}
+	path, err := t.spooled.finish()
+	if err == nil {
+		err = a.storeFileFrom(name, path)
+	}
+	if err != nil {
+		a.storeError(ctx, errors.Wrapf(err, "error storing %s", name))
+	}
+}
+
+// spooledOutput is an io.Writer that keeps what truncateMiddle would of
+// what is written to it in the spool rather than in memory. The head file
+// holds everything written until the limit is exceeded, and then only the
+// start of it. The tail file is a ring of the last bytes written, which
+// finish appends to the head after the truncation marker.
+type spooledOutput struct {
+	limit int64
+	head  *os.File
+	tail  *os.File
+	// next is the offset in tail of the oldest byte, and tailSize is the
+	// number of bytes in tail.
+	next     int64
+	tailSize int64
+	written  int64
+	err      error
+}
+
+func (o *spooledOutput) Write(p []byte) (int, error) {
+	if o.err == nil {
+		o.err = o.write(p)
+	}
+	if o.err != nil {
+		return 0, o.err
+	}
+	return len(p), nil
+}
+
+func (o *spooledOutput) write(p []byte) error {
+	written := o.written
+	o.written += int64(len(p))
+	if o.limit <= 0 || o.tail == nil && o.written <= o.limit {
+		_, err := o.head.Write(p)
+		return errors.Wrap(err, "error writing spooled output")
+	}
+
+	half := keptHalf(o.limit)
+	if o.tail == nil {
+		tail, err := os.CreateTemp(filepath.Dir(o.head.Name()), "tail-")
+		if err != nil {
+			return errors.Wrap(err, "error creating spool file")
+		}
+		o.tail = tail
+		if written > half {
+			// What was written after the head is the start of the tail.
+			_, err := io.Copy(tailWriter{o}, io.NewSectionReader(o.head, half, written-half))
+			if err != nil {
+				return errors.Wrap(err, "error moving spooled output")
+			}
+			if err := o.head.Truncate(half); err != nil {
+				return errors.Wrap(err, "error truncating spooled output")
+			}
+		} else {
+			take := half - written
+			if _, err := o.head.Write(p[:take]); err != nil {
+				return errors.Wrap(err, "error writing spooled output")
+			}
+			p = p[take:]
+		}
+	}
+	return o.writeTail(p)
+}
+
+func (o *spooledOutput) writeTail(p []byte) error {
+	half := keptHalf(o.limit)
+	for len(p) > 0 && half > 0 {
+		n := min(half-o.next, int64(len(p)))
+		if _, err := o.tail.WriteAt(p[:n], o.next); err != nil {
+			return errors.Wrap(err, "error writing spooled output")
+		}
+		o.next = (o.next + n) % half
+		o.tailSize = min(o.tailSize+n, half)
+		p = p[n:]
+	}
+	return nil
+}
+
+// tailWriter writes to the tail of a spooledOutput.
+type tailWriter struct {
+	o *spooledOutput
+}
+
+func (w tailWriter) Write(p []byte) (int, error) {
+	if err := w.o.writeTail(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// finish closes the output and returns the path of the file holding it.
+func (o *spooledOutput) finish() (string, error) {
+	err := o.err
+	if o.tail != nil {
+		if err == nil {
+			err = o.appendTail()
+		}
+		_ = o.tail.Close()
+		_ = os.Remove(o.tail.Name())
+	}
+	if cerr := o.head.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr, "error closing spooled output")
+	}
+	if err != nil {
+		_ = os.Remove(o.head.Name())
+		return "", err
+	}
+	return o.head.Name(), nil
+}
+
+func (o *spooledOutput) appendTail() error {
+	half := keptHalf(o.limit)
+	if _, err := o.head.Seek(0, io.SeekEnd); err != nil {
+		return errors.Wrap(err, "error seeking spooled output")
+	}
+	marker := fmt.Sprintf(truncationMarker, o.written-half-o.tailSize)
+	if _, err := io.WriteString(o.head, marker); err != nil {
+		return errors.Wrap(err, "error writing spooled output")
+	}
+	// The oldest bytes are from next to the end of the ring.
+	for _, r := range []*io.SectionReader{
+		io.NewSectionReader(o.tail, o.next, o.tailSize-o.next),
+		io.NewSectionReader(o.tail, 0, o.next),
+	} {
+		if _, err := io.Copy(o.head, r); err != nil {
+			return errors.Wrap(err, "error writing spooled output")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// spoolFiles returns the names of the files in the spool directory.
+func spoolFiles(t *testing.T, a *analyzer) []string {
+	t.Helper()
+	dir, err := a.spool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func newTestSpooledOutput(t *testing.T, a *analyzer, limit int64) *spooledOutput {
+	t.Helper()
+	f, err := a.createSpoolFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &spooledOutput{limit: limit, head: f}
+}
+
+func TestSpooledOutputMatchesTruncateMiddle(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	for _, limit := range truncationLimits() {
+		for _, size := range []int{0, 1, 50, 100, 101, 1000, 2500} {
+			for _, chunk := range []int{0, 1, 7, int(keptHalf(limit)) + 1, 3 * int(limit)} {
+				input := testOutput(size)
+				o := newTestSpooledOutput(t, a, limit)
+				writeChunks(t, o, input, chunk)
+				path, err := o.finish()
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := os.ReadFile(path) // nolint: gosec
+				if err != nil {
+					t.Fatal(err)
+				}
+				_ = os.Remove(path)
+				if want := truncateMiddle(input, limit); !bytes.Equal(got, want) {
+					t.Errorf("limit %d, size %d, chunks of %d:\ngot  %q\nwant %q", limit, size, chunk, got, want)
+				}
+			}
+		}
+	}
+	if files := spoolFiles(t, a); len(files) != 0 {
+		t.Errorf("the spool holds %v", files)
+	}
+}
+
+func TestSpooledOutputSwitchesToTail(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	const limit = 1000
+	o := newTestSpooledOutput(t, a, limit)
+
+	writeChunks(t, o, testOutput(limit), 100)
+	if o.tail != nil {
+		t.Fatal("output within the limit created a tail file")
+	}
+	if n := len(spoolFiles(t, a)); n != 1 {
+		t.Errorf("the spool holds %d files, want 1", n)
+	}
+
+	if _, err := o.Write([]byte("past the limit")); err != nil {
+		t.Fatal(err)
+	}
+	if o.tail == nil {
+		t.Fatal("output past the limit did not create a tail file")
+	}
+	if n := len(spoolFiles(t, a)); n != 2 {
+		t.Errorf("the spool holds %d files, want 2", n)
+	}
+	// The head is cut to the half that is kept as soon as the tail is used.
+	fi, err := o.head.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != keptHalf(limit) {
+		t.Errorf("the head file is %d bytes, want %d", fi.Size(), keptHalf(limit))
+	}
+
+	path, err := o.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := spoolFiles(t, a); len(files) != 1 || files[0] != filepath.Base(path) {
+		t.Errorf("after finish the spool holds %v, want only %s", files, filepath.Base(path))
+	}
+}
+
+func TestSpooledOutputErrorRemovesFiles(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	o := newTestSpooledOutput(t, a, 1000)
+
+	writeChunks(t, o, testOutput(2000), 0)
+	// Closing the tail makes the next write to it fail.
+	if err := o.tail.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Write(testOutput(10)); err == nil {
+		t.Fatal("writing to a closed tail succeeded")
+	}
+	// Later writes report the same error.
+	if _, err := o.Write(testOutput(10)); err == nil {
+		t.Error("writing after an error succeeded")
+	}
+
+	if _, err := o.finish(); err == nil {
+		t.Error("finish succeeded after a write error")
+	}
+	if files := spoolFiles(t, a); len(files) != 0 {
+		t.Errorf("the spool holds %v after the error", files)
+	}
+}
+
+func TestTaskOutputInMemory(t *testing.T) {
+	a := &analyzer{maxTaskOutput: 200}
+	// The spool cannot be created, so the output is kept in memory.
+	a.spoolOnce.Do(func() { a.spoolErr = errors.New("no spool") })
+
+	out := a.newTaskOutput()
+	if out.spooled != nil {
+		t.Fatal("the output was spooled without a spool")
+	}
+	input := testOutput(5000)
+	writeChunks(t, out, input, 64)
+	a.storeOutput(context.Background(), "out.txt", out)
+	if got, want := storedContents(t, a, "out.txt"), truncateMiddle(input, 200); !bytes.Equal(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestTaskOutputSpooled(t *testing.T) {
+	a := &analyzer{maxTaskOutput: 3 * spoolThreshold}
+	defer a.removeSpool()
+
+	small := a.newTaskOutput()
+	writeChunks(t, small, []byte("small output"), 0)
+	a.storeOutput(context.Background(), "small.txt", small)
+
+	large := a.newTaskOutput()
+	input := testOutput(4 * spoolThreshold)
+	writeChunks(t, large, input, 1<<16)
+	a.storeOutput(context.Background(), "large.txt", large)
+
+	a.filesMutex.Lock()
+	files := map[string]*storedFile{}
+	for _, sf := range a.files {
+		files[sf.name] = sf
+	}
+	a.filesMutex.Unlock()
+
+	// Small output is read into memory and its spool file removed, and
+	// large output stays in the spool.
+	if sf := files["small.txt"]; sf == nil || sf.path != "" || string(sf.contents) != "small output" {
+		t.Errorf("small.txt = %+v", sf)
+	}
+	sf := files["large.txt"]
+	if sf == nil || sf.path == "" || sf.contents != nil {
+		t.Fatalf("large.txt = %+v, want it in the spool", sf)
+	}
+	if got := storedContents(t, a, "large.txt"); !bytes.Equal(got, truncateMiddle(input, a.maxTaskOutput)) {
+		t.Error("the spooled output does not match truncateMiddle")
+	}
+	if files := spoolFiles(t, a); len(files) != 1 {
+		t.Errorf("the spool holds %v, want only large.txt", files)
+	}
+
+	a.removeSpool()
+	if _, err := os.Stat(sf.path); !os.IsNotExist(err) {
+		t.Errorf("the spool was not removed: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package analyzer
+
+import (
+	"math"
+	"slices"
+)
+
+// distribution summarizes a set of samples, in milliseconds.
+type distribution struct {
+	Count int     `json:"count"`
+	MinMS float64 `json:"min_ms"`
+	P50MS float64 `json:"p50_ms"`
+	P95MS float64 `json:"p95_ms"`
+	P99MS float64 `json:"p99_ms"`
+	MaxMS float64 `json:"max_ms"`
+}
+
+// newDistribution summarizes samples. It returns nil if there are none.
+func newDistribution(samples []float64) *distribution {
+	if len(samples) == 0 {
+		return nil
+	}
+	sorted := slices.Sorted(slices.Values(samples))
+	return &distribution{
+		Count: len(sorted),
+		MinMS: sorted[0],
+		P50MS: percentile(sorted, 50),
+		P95MS: percentile(sorted, 95),
+		P99MS: percentile(sorted, 99),
+		MaxMS: sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the pth percentile of sorted using the nearest-rank
+// method, so that it is always one of the samples.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,34 @@
+package analyzer
+
+import "testing"
+
+func TestNewDistribution(t *testing.T) {
+	if d := newDistribution(nil); d != nil {
+		t.Errorf("distribution of nothing = %+v", d)
+	}
+	samples := make([]float64, 0, 100)
+	for i := 100; i > 0; i-- {
+		samples = append(samples, float64(i))
+	}
+	want := distribution{Count: 100, MinMS: 1, P50MS: 50, P95MS: 95, P99MS: 99, MaxMS: 100}
+	if d := newDistribution(samples); *d != want {
+		t.Errorf("distribution = %+v, want %+v", d, want)
+	}
+	if samples[0] != 100 {
+		t.Error("the samples were sorted in place")
+	}
+
+	want = distribution{Count: 1, MinMS: 7, P50MS: 7, P95MS: 7, P99MS: 7, MaxMS: 7}
+	if d := newDistribution([]float64{7}); *d != want {
+		t.Errorf("distribution of one sample = %+v", d)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{10, 20, 30, 40}
+	for p, want := range map[float64]float64{0: 10, 25: 10, 26: 20, 50: 20, 75: 30, 99: 40, 100: 40} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("percentile %v = %v, want %v", p, got, want)
+		}
+	}
+}
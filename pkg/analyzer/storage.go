@@ -0,0 +1,287 @@
+package analyzer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// uploadToStorage uploads the archive at path to an object storage URL of
+// the form s3://bucket/key, gs://bucket/key, or az://account/container/key,
+// or to an SFTP server with a URL of the form sftp://user@host:port/path.
+// If the key is empty or ends in "/", the archive's file name is appended.
+// Credentials are taken from the environment:
+//
+//   - S3: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and, optionally,
+//     AWS_SESSION_TOKEN, AWS_REGION (or AWS_DEFAULT_REGION), and
+//     AWS_ENDPOINT_URL_S3 for S3-compatible services.
+//   - GCS: GOOGLE_OAUTH_ACCESS_TOKEN, e.g., from
+//     `gcloud auth print-access-token`.
+//   - Azure: AZURE_STORAGE_SAS_TOKEN.
+//   - SFTP: see uploadSFTP.
+//
+// It returns the URL of the uploaded object.
+func uploadToStorage(target, path string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", errors.Wrapf(err, "error parsing upload target %s", target)
+	}
+	if u.Scheme == "sftp" {
+		return uploadSFTP(u, path)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+
+	var req *http.Request
+	switch u.Scheme {
+	case "s3":
+		req, err = newS3Request(u.Host, objectKey(key, path))
+	case "gs":
+		req, err = newGCSRequest(u.Host, objectKey(key, path))
+	case "az":
+		parts := strings.SplitN(key, "/", 2)
+		if len(parts) < 2 {
+			parts = append(parts, "")
+		}
+		req, err = newAzureRequest(u.Host, parts[0], objectKey(parts[1], path))
+	default:
+		return "", errors.Errorf("unsupported upload target scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return "", errors.Wrap(err, "error opening archive for upload")
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", errors.Wrap(err, "error getting archive size")
+	}
+	req.Body = f
+	req.ContentLength = info.Size()
+	req.Header.Set("User-Agent", os.Args[0])
+
+	client := &http.Client{Timeout: uploadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error uploading archive")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", errors.Errorf("upload to %s failed with %s: %s", target, resp.Status, body)
+	}
+
+	objectURL := *req.URL
+	objectURL.RawQuery = ""
+	return objectURL.String(), nil
+}
+
+func objectKey(key, path string) string {
+	if key == "" || strings.HasSuffix(key, "/") {
+		return key + filepath.Base(path)
+	}
+	return key
+}
+
+func newS3Request(bucket, key string) (*http.Request, error) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to upload to S3")
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	u, err := s3ObjectURL(os.Getenv("AWS_ENDPOINT_URL_S3"), region, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPut, u.String(), nil) // nolint: noctx
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating S3 request")
+	}
+	// Parsing u.String() may not give back the same RawPath.
+	req.URL = u
+	signS3Request(req, accessKey, secretKey, os.Getenv("AWS_SESSION_TOKEN"), region, time.Now().UTC())
+	return req, nil
+}
+
+// s3ObjectURL returns the URL of the object key in bucket. If endpoint, the
+// URL of an S3-compatible service, is set, a path-style URL under it is
+// returned. The key is escaped as SigV4 requires, so characters such as
+// "?", "#", and "%" are part of the path.
+func s3ObjectURL(endpoint, region, bucket, key string) (*url.URL, error) {
+	var u *url.URL
+	if endpoint != "" {
+		// S3-compatible services generally expect path-style requests.
+		var err error
+		u, err = url.Parse(endpoint)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing AWS_ENDPOINT_URL_S3")
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, errors.Errorf("AWS_ENDPOINT_URL_S3 %q is not an absolute URL", endpoint)
+		}
+		u = &url.URL{
+			Scheme: u.Scheme,
+			Host:   u.Host,
+			Path:   strings.TrimSuffix(u.Path, "/") + "/" + bucket + "/" + key,
+		}
+	} else {
+		u = &url.URL{
+			Scheme: "https",
+			Host:   bucket + ".s3." + region + ".amazonaws.com",
+			Path:   "/" + key,
+		}
+	}
+	u.RawPath = awsURIEncode(u.Path)
+	return u, nil
+}
+
+// signS3Request adds an AWS Signature Version 4 Authorization header to req.
+// The payload is not signed so that the archive may be streamed.
+func signS3Request(req *http.Request, accessKey, secretKey, sessionToken, region string, now time.Time) {
+	const payloadHash = "UNSIGNED-PAYLOAD"
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+	signV4(req, accessKey, secretKey, region, "s3", payloadHash, now)
+}
+
+// signV4 adds an AWS Signature Version 4 Authorization header to req for
+// service. The Host header and every X-Amz- header are signed. The
+// request must not have a query string, as it is not canonicalized.
+func signV4(req *http.Request, accessKey, secretKey, region, service, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set(
+		"Authorization",
+		"AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+			", SignedHeaders="+signedHeaders+", Signature="+signature,
+	)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsURIEncode escapes everything in path other than unreserved characters
+// and "/", as required for the canonical URI.
+func awsURIEncode(path string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte(hexDigits[c>>4])
+		b.WriteByte(hexDigits[c&0x0f])
+	}
+	return b.String()
+}
+
+func newGCSRequest(bucket, key string) (*http.Request, error) {
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		return nil, errors.New("GOOGLE_OAUTH_ACCESS_TOKEN must be set to upload to GCS")
+	}
+	u := &url.URL{
+		Scheme: "https",
+		Host:   "storage.googleapis.com",
+		Path:   "/" + bucket + "/" + key,
+	}
+	req, err := http.NewRequest(http.MethodPut, u.String(), nil) // nolint: noctx
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating GCS request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
+}
+
+func newAzureRequest(account, container, key string) (*http.Request, error) {
+	sas := strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?")
+	if sas == "" {
+		return nil, errors.New("AZURE_STORAGE_SAS_TOKEN must be set to upload to Azure")
+	}
+	if container == "" {
+		return nil, errors.New("upload targets for Azure must be of the form az://account/container/key")
+	}
+	u := &url.URL{
+		Scheme:   "https",
+		Host:     account + ".blob.core.windows.net",
+		Path:     "/" + container + "/" + key,
+		RawQuery: sas,
+	}
+	req, err := http.NewRequest(http.MethodPut, u.String(), nil) // nolint: noctx
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating Azure request")
+	}
+	req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+	return req, nil
+}
@@ -0,0 +1,208 @@
+package analyzer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// These are from the AWS Signature Version 4 test suite, which signs
+// requests to example.amazonaws.com for "service" in us-east-1.
+const (
+	sigV4TestAccessKey = "AKIDEXAMPLE"
+	sigV4TestSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	// sigV4EmptyPayload is the SHA-256 hash of an empty body.
+	sigV4EmptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func TestSignV4TestSuite(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		signature string
+	}{
+		{
+			name:      "get-vanilla",
+			method:    http.MethodGet,
+			path:      "/",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:      "post-vanilla",
+			method:    http.MethodPost,
+			path:      "/",
+			signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:      "get-utf8",
+			method:    http.MethodGet,
+			path:      "/ሴ",
+			signature: "8318018e0b0f223aa2bbf98705b62bb787dc9c0e678f255a891fd03141be5d85",
+		},
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u := &url.URL{Scheme: "https", Host: "example.amazonaws.com", Path: test.path}
+			u.RawPath = awsURIEncode(u.Path)
+			req := &http.Request{Method: test.method, URL: u, Header: http.Header{}}
+
+			signV4(req, sigV4TestAccessKey, sigV4TestSecretKey, "us-east-1", "service", sigV4EmptyPayload, now)
+
+			want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=" + test.signature
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("Authorization =\n%s\nwant\n%s", got, want)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date = %s", got)
+			}
+		})
+	}
+}
+
+func TestSignS3RequestHeaders(t *testing.T) {
+	u := &url.URL{Scheme: "https", Host: "bucket.s3.us-east-1.amazonaws.com", Path: "/key"}
+	req := &http.Request{Method: http.MethodPut, URL: u, Header: http.Header{}}
+	signS3Request(req, "AKID", "secret", "token", "us-east-1", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	if got := req.Header.Get("X-Amz-Content-Sha256"); got != "UNSIGNED-PAYLOAD" {
+		t.Errorf("X-Amz-Content-Sha256 = %s", got)
+	}
+	if got := req.Header.Get("X-Amz-Security-Token"); got != "token" {
+		t.Errorf("X-Amz-Security-Token = %s", got)
+	}
+	want := "AWS4-HMAC-SHA256 Credential=AKID/20240102/us-east-1/s3/aws4_request, " +
+		"SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature="
+	if got := req.Header.Get("Authorization"); len(got) != len(want)+64 || got[:len(want)] != want {
+		t.Errorf("Authorization = %s", got)
+	}
+}
+
+func TestS3ObjectURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		key      string
+		url      string
+		path     string
+	}{
+		{
+			name: "virtual-hosted",
+			key:  "dir/archive.zip",
+			url:  "https://bucket.s3.eu-west-1.amazonaws.com/dir/archive.zip",
+			path: "/dir/archive.zip",
+		},
+		{
+			name:     "endpoint",
+			endpoint: "http://localhost:9000/",
+			key:      "archive.zip",
+			url:      "http://localhost:9000/bucket/archive.zip",
+			path:     "/bucket/archive.zip",
+		},
+		{
+			name:     "endpoint with path",
+			endpoint: "https://storage.example.com/s3",
+			key:      "archive.zip",
+			url:      "https://storage.example.com/s3/bucket/archive.zip",
+			path:     "/s3/bucket/archive.zip",
+		},
+		{
+			name:     "reserved characters",
+			endpoint: "http://localhost:9000",
+			key:      "a?b#c%d e+f",
+			url:      "http://localhost:9000/bucket/a%3Fb%23c%25d%20e%2Bf",
+			path:     "/bucket/a?b#c%d e+f",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := s3ObjectURL(test.endpoint, "eu-west-1", "bucket", test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := u.String(); got != test.url {
+				t.Errorf("URL = %s, want %s", got, test.url)
+			}
+			if u.Path != test.path {
+				t.Errorf("Path = %s, want %s", u.Path, test.path)
+			}
+			if u.RawQuery != "" || u.Fragment != "" {
+				t.Errorf("URL has query %q and fragment %q", u.RawQuery, u.Fragment)
+			}
+		})
+	}
+
+	if _, err := s3ObjectURL("localhost:9000", "", "bucket", "key"); err == nil {
+		t.Error("s3ObjectURL accepted an endpoint without a scheme")
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"", "archive.zip"},
+		{"dir/", "dir/archive.zip"},
+		{"dir/name.zip", "dir/name.zip"},
+	}
+	for _, test := range tests {
+		if got := objectKey(test.key, "/tmp/archive.zip"); got != test.want {
+			t.Errorf("objectKey(%q) = %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+func TestUploadToStorageS3Endpoint(t *testing.T) {
+	path := writeTestArchive(t, "archive contents")
+
+	var gotPath, gotAuth, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.EscapedPath()
+		gotAuth = r.Header.Get("Authorization")
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "us-west-2")
+	t.Setenv("AWS_ENDPOINT_URL_S3", server.URL)
+
+	uploaded, err := uploadToStorage("s3://bucket/cases/", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := server.URL + "/bucket/cases/mm-network-analysis-test.zip"; uploaded != want {
+		t.Errorf("uploaded to %s, want %s", uploaded, want)
+	}
+	if gotPath != "/bucket/cases/mm-network-analysis-test.zip" {
+		t.Errorf("server got path %s", gotPath)
+	}
+	if !strings.HasPrefix(gotAuth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+		!strings.Contains(gotAuth, "/us-west-2/s3/") {
+		t.Errorf("server got Authorization %s", gotAuth)
+	}
+	if gotBody != "archive contents" {
+		t.Errorf("server got body %q", gotBody)
+	}
+}
+
+func TestUploadToStorageErrors(t *testing.T) {
+	path := writeTestArchive(t, "archive contents")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AZURE_STORAGE_SAS_TOKEN", "sv=1")
+	for _, target := range []string{"s3://bucket/", "az://account", "ftp://host/"} {
+		if _, err := uploadToStorage(target, path); err == nil {
+			t.Errorf("uploadToStorage(%q) succeeded", target)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package analyzer
+
+import (
+	"bytes"
+	_ "embed" // for the summary template
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//go:embed templates/summary.html.tmpl
+var summaryTemplateText string
+
+var summaryTemplate = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"ms": func(v float64) string { return fmt.Sprintf("%.1f", v) },
+	// pct returns v as a percentage of max for sizing the bars.
+	"pct": func(v, max float64) string {
+		if max <= 0 {
+			return "0"
+		}
+		return fmt.Sprintf("%.1f", 100*v/max)
+	},
+}).Parse(summaryTemplateText))
+
+// summaryData is the view of the results used by the summary template.
+type summaryData struct {
+	Generated   string
+	Findings    []*Finding
+	IP          string
+	Endpoints   []*endpointHealth
+	HTTP        []namedHTTPReport
+	HTTPMaxMS   float64
+	DNS         []namedDNSReports
+	Ping        []namedPingReport
+	PingMaxMS   float64
+	Traceroutes []namedTraceroute
+}
+
+type namedHTTPReport struct {
+	Name   string
+	Report *httpReport
+}
+
+type namedDNSReports struct {
+	Name    string
+	Reports []*dnsReport
+}
+
+type namedPingReport struct {
+	Name   string
+	Report *pingReport
+}
+
+type namedTraceroute struct {
+	Name   string
+	Result *tracerouteResult
+	MaxMS  float64
+}
+
+// addSummary renders the task results as summary.html, a self-contained
+// page for reading the key findings without opening each file.
+func (a *analyzer) addSummary(findings []*Finding) error {
+	a.resultsMutex.Lock()
+	defer a.resultsMutex.Unlock()
+
+	names := make([]string, 0, len(a.results))
+	for name := range a.results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	d := &summaryData{
+		Generated: time.Now().UTC().Format(time.RFC1123),
+		Findings:  findings,
+	}
+	for _, name := range names {
+		switch r := a.results[name].(type) {
+		case *ipAddressReport:
+			d.IP = r.IP
+		case []*endpointHealth:
+			d.Endpoints = r
+		case *httpReport:
+			d.HTTP = append(d.HTTP, namedHTTPReport{Name: name, Report: r})
+			if r.Timings.Total > d.HTTPMaxMS {
+				d.HTTPMaxMS = r.Timings.Total
+			}
+		case []*dnsReport:
+			d.DNS = append(d.DNS, namedDNSReports{Name: name, Reports: r})
+		case *pingReport:
+			d.Ping = append(d.Ping, namedPingReport{Name: name, Report: r})
+			if r.AvgMS > d.PingMaxMS {
+				d.PingMaxMS = r.AvgMS
+			}
+		case *tracerouteResult:
+			tr := namedTraceroute{Name: name, Result: r}
+			for _, hop := range r.Hops {
+				if hop.AvgMS > tr.MaxMS {
+					tr.MaxMS = hop.AvgMS
+				}
+			}
+			d.Traceroutes = append(d.Traceroutes, tr)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	err := summaryTemplate.Execute(buf, d)
+	if err != nil {
+		return errors.Wrap(err, "error rendering summary.html")
+	}
+	a.storeFile("summary.html", []byte(strings.TrimSpace(buf.String())+"\n"))
+	return nil
+}
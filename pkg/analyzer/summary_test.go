@@ -0,0 +1,73 @@
+package analyzer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddSummary(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.storeResult("ip-address", &ipAddressReport{IP: "192.0.2.1"})
+	a.storeResult("geoip-https", &httpReport{
+		URL:        "https://geoip.maxmind.com",
+		StatusCode: 200,
+		Timings:    httpTimingsMS{Total: 120},
+	})
+	a.storeResult("updates-https", &httpReport{URL: "https://updates.maxmind.com", Error: "connection refused"})
+	a.storeResult("dig", []*dnsReport{{
+		Question: "geoip.maxmind.com. IN A",
+		Rcode:    "NOERROR",
+		Answers:  []string{"192.0.2.2"},
+	}})
+	a.storeResult("ping", testPingResult(0).report("example.com", nil))
+	a.storeResult("traceroute", &tracerouteResult{Hops: []*tracerouteHop{
+		{TTL: 1, Addresses: []string{"192.0.2.254"}, AvgMS: 1},
+		{TTL: 2, Loss: 100},
+	}})
+
+	findings := []*Finding{{Severity: "error", Summary: "<script>alert(1)</script>", Tasks: []string{"dig"}}}
+	if err := a.addSummary(findings); err != nil {
+		t.Fatal(err)
+	}
+	html := string(storedContents(t, a, "summary.html"))
+	for _, want := range []string{
+		"<code>192.0.2.1</code>",
+		`<td class="num">120.0</td>`,
+		// The longest request fills the bar.
+		`style="width: 100.0%"`,
+		`<span class="bad">connection refused</span>`,
+		"<code>geoip.maxmind.com. IN A</code>",
+		"NOERROR in 0.0 ms",
+		"<code>192.0.2.2</code>",
+		`<td class="num">100.0%</td>`,
+		"(destination not reached)",
+		"???",
+		// The findings are escaped.
+		"&lt;script&gt;alert(1)&lt;/script&gt;",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("summary.html does not contain %s", want)
+		}
+	}
+	if strings.Contains(html, "<script>") {
+		t.Error("summary.html contains an unescaped finding")
+	}
+}
+
+func TestAddSummaryWithoutResults(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	if err := a.addSummary(nil); err != nil {
+		t.Fatal(err)
+	}
+	html := string(storedContents(t, a, "summary.html"))
+	for _, section := range []string{"<h2>Ping</h2>", "<h2>Traceroutes</h2>"} {
+		if strings.Contains(html, section) {
+			t.Errorf("summary.html without results contains %s", section)
+		}
+	}
+	if !strings.Contains(html, `<p class="bad">Unknown</p>`) {
+		t.Error("summary.html does not say that the IP address is unknown")
+	}
+}
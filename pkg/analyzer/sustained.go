@@ -0,0 +1,167 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// sustainedDuration is how long the sustained throughput test
+	// downloads for. It is long enough for traffic shaping that only
+	// starts after a burst to show.
+	sustainedDuration = 20 * time.Second
+	// sustainedInterval is the period of each rate sample.
+	sustainedInterval = time.Second
+)
+
+// throughputSample is the rate over one sustainedInterval.
+type throughputSample struct {
+	ElapsedMS float64 `json:"elapsed_ms"`
+	Mbps      float64 `json:"mbps"`
+}
+
+// sustainedReport is the result of downloading databases for
+// sustainedDuration. Unlike download-throughput.json, it shows how the
+// rate changes over the transfer.
+type sustainedReport struct {
+	URL      string             `json:"url"`
+	Edition  string             `json:"edition"`
+	Requests int                `json:"requests"`
+	Bytes    int64              `json:"bytes"`
+	Samples  []throughputSample `json:"samples"`
+	// AverageMbps is over the whole transfer, and FirstMbps and LastMbps
+	// over its first and last thirds.
+	AverageMbps float64 `json:"average_mbps"`
+	FirstMbps   float64 `json:"first_mbps"`
+	LastMbps    float64 `json:"last_mbps"`
+	// Throttled is true if the last third was less than half as fast as
+	// the first. StalledSamples is the number of intervals in which
+	// nothing was received.
+	Throttled      bool   `json:"throttled"`
+	StalledSamples int    `json:"stalled_samples"`
+	Error          string `json:"error,omitempty"`
+}
+
+// addSustainedThroughput downloads databases with the given credentials
+// for sustainedDuration, writing the rate of each interval to
+// sustained-throughput.json. The data is discarded.
+func (a *analyzer) addSustainedThroughput(ctx context.Context) {
+	edition := configuredEdition()
+	r := &sustainedReport{URL: a.downloadURL(edition), Edition: edition}
+
+	ctx, cancel := context.WithTimeout(ctx, sustainedDuration)
+	defer cancel()
+	err := a.sustainedDownload(ctx, r)
+	r.summarize()
+	if err != nil {
+		r.Error = err.Error()
+		a.storeError(ctx, errors.Wrap(err, "error measuring sustained throughput"))
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding sustained-throughput.json"))
+		return
+	}
+	a.storeFile("sustained-throughput.json", b)
+	a.storeResult("sustained-throughput", r)
+}
+
+// sustainedDownload downloads the database until ctx is done, requesting
+// it again if it is smaller than what can be transferred in that time.
+func (a *analyzer) sustainedDownload(ctx context.Context, r *sustainedReport) error {
+	start := time.Now()
+	next := start.Add(sustainedInterval)
+	var intervalBytes int64
+	buf := make([]byte, 32*1024)
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+		if err != nil {
+			return errors.Wrap(err, "error creating download request")
+		}
+		req.SetBasicAuth(a.credentials.accountID, a.credentials.licenseKey)
+		req.Header.Set("User-Agent", os.Args[0])
+
+		r.Requests++
+		resp, err := a.dial.httpClient().Do(req)
+		if err != nil {
+			return finishedAtDeadline(ctx, errors.Wrap(err, "error making download request"))
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return httpStatusErrorf(resp.StatusCode, "download returned %s", resp.Status)
+		}
+		for {
+			n, err := resp.Body.Read(buf)
+			now := time.Now()
+			// A read that blocked across several intervals leaves those
+			// intervals empty.
+			for !now.Before(next) {
+				r.Samples = append(r.Samples, throughputSample{
+					ElapsedMS: durationMS(next.Sub(start)),
+					Mbps:      mbps(intervalBytes, sustainedInterval),
+				})
+				intervalBytes = 0
+				next = next.Add(sustainedInterval)
+			}
+			intervalBytes += int64(n)
+			r.Bytes += int64(n)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				resp.Body.Close()
+				return finishedAtDeadline(ctx, errors.Wrap(err, "error reading download"))
+			}
+		}
+		resp.Body.Close()
+	}
+}
+
+// finishedAtDeadline returns nil if err is due to ctx's deadline, which
+// is how the transfer normally ends, and err otherwise.
+func finishedAtDeadline(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+	return err
+}
+
+func (r *sustainedReport) summarize() {
+	if len(r.Samples) == 0 {
+		return
+	}
+	r.AverageMbps = mbps(r.Bytes, time.Duration(len(r.Samples))*sustainedInterval)
+	for _, s := range r.Samples {
+		if s.Mbps == 0 {
+			r.StalledSamples++
+		}
+	}
+	third := len(r.Samples) / 3
+	if third == 0 {
+		return
+	}
+	r.FirstMbps = meanMbps(r.Samples[:third])
+	r.LastMbps = meanMbps(r.Samples[len(r.Samples)-third:])
+	r.Throttled = r.LastMbps < r.FirstMbps/2
+}
+
+func meanMbps(samples []throughputSample) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += s.Mbps
+	}
+	return sum / float64(len(samples))
+}
+
+// mbps returns the rate of transferring n bytes in d in megabits per
+// second.
+func mbps(n int64, d time.Duration) float64 {
+	return float64(n) * 8 / 1e6 / d.Seconds()
+}
@@ -0,0 +1,102 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSustainedDownload(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if user, key, _ := r.BasicAuth(); user != "42" || key != "testlicensekey" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write(make([]byte, 64*1024))
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	a := &analyzer{credentials: &credentials{accountID: "42", licenseKey: "testlicensekey"}}
+	r := &sustainedReport{URL: server.URL}
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	// The database is requested again until the deadline, which is not
+	// an error.
+	if err := a.sustainedDownload(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Requests < 2 || int(requests.Load()) > r.Requests || r.Bytes < int64(r.Requests-1)*64*1024 {
+		t.Errorf("%d requests for %d bytes", r.Requests, r.Bytes)
+	}
+	if len(r.Samples) != 1 || r.Samples[0].ElapsedMS != 1000 || r.Samples[0].Mbps == 0 {
+		t.Errorf("samples = %+v", r.Samples)
+	}
+
+	a.credentials.licenseKey = "wrong"
+	r = &sustainedReport{URL: server.URL}
+	err := a.sustainedDownload(context.Background(), r)
+	if err == nil || !strings.Contains(err.Error(), "401 Unauthorized") || r.Requests != 1 {
+		t.Errorf("with the wrong key, %d requests and error %v", r.Requests, err)
+	}
+}
+
+func TestSustainedSummarize(t *testing.T) {
+	r := &sustainedReport{Bytes: 6_000_000}
+	for _, rate := range []float64{10, 12, 8, 0, 4, 2} {
+		r.Samples = append(r.Samples, throughputSample{Mbps: rate})
+	}
+	r.summarize()
+	want := &sustainedReport{
+		Bytes:          6_000_000,
+		Samples:        r.Samples,
+		AverageMbps:    8,
+		FirstMbps:      11,
+		LastMbps:       3,
+		Throttled:      true,
+		StalledSamples: 1,
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("report = %+v, want %+v", r, want)
+	}
+
+	// Too few samples to compare thirds.
+	r = &sustainedReport{Bytes: 250_000, Samples: []throughputSample{{Mbps: 1}, {Mbps: 1}}}
+	r.summarize()
+	if r.AverageMbps != 1 || r.Throttled || r.FirstMbps != 0 {
+		t.Errorf("report = %+v", r)
+	}
+}
+
+func TestMbps(t *testing.T) {
+	if got := mbps(1_250_000, time.Second); got != 10 {
+		t.Errorf("mbps = %v", got)
+	}
+	if got := mbps(1_250_000, 2*time.Second); got != 5 {
+		t.Errorf("mbps over 2s = %v", got)
+	}
+}
+
+func TestSustainedFindings(t *testing.T) {
+	r := &sustainedReport{
+		Samples:        make([]throughputSample, 20),
+		FirstMbps:      40,
+		LastMbps:       5,
+		Throttled:      true,
+		StalledSamples: 3,
+	}
+	fs := findingsFor(map[string]interface{}{"sustained-throughput": r})
+	if want := []string{"throughput-throttled", "throughput-stalled"}; !reflect.DeepEqual(findingChecks(fs), want) {
+		t.Fatalf("findings = %v, want %v", findingChecks(fs), want)
+	}
+	if want := "nothing was received for 3 of the 20 seconds of the sustained download"; fs[1].Summary != want {
+		t.Errorf("summary = %q", fs[1].Summary)
+	}
+}
@@ -0,0 +1,671 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// Tags group related tasks so that they may be selected with --only and
+// --skip.
+const (
+	tagDNS     = "dns"
+	tagHTTP    = "http"
+	tagRouting = "routing"
+	tagLocal   = "local"
+)
+
+// defaultTaskTimeout is the longest a task may run unless it sets its own
+// timeout or --task-timeout is given.
+const defaultTaskTimeout = 60 * time.Second
+
+// defaultParallelism is the number of tasks run at once unless
+// --parallelism is given. Running many latency-sensitive tasks at once on
+// a slow link skews their results.
+const defaultParallelism = 4
+
+// commandWaitDelay is how long a command's output is still read once the
+// command has exited or been killed. Children that outlive the command,
+// e.g., the sleep in `sh -c 'sleep 30 | cat'`, would otherwise hold its
+// output pipe open and keep the task running.
+const commandWaitDelay = 2 * time.Second
+
+// task is a unit of data collection. Each task stores one or more files in
+// the archive.
+type task struct {
+	// name uniquely identifies the task. For most tasks, it is the name of
+	// the output file without the extension.
+	name        string
+	description string
+	tags        []string
+	// tools are the external programs the task runs.
+	tools []string
+	// command is the command line the task runs, if it runs one.
+	command []string
+	// outputs are the names of the files the task stores.
+	outputs []string
+	// fallback, if set, is run instead of the task if one of tools is not
+	// installed.
+	fallback *task
+	// missingTools are the tools that are not installed. The task is not
+	// run if there are any. It is set by preflight.
+	missingTools []string
+	// skipReason, if set, is why the task is not run as it cannot
+	// succeed on this host.
+	skipReason string
+	// privileges describes any special privileges the task needs.
+	privileges string
+	// timeout overrides the default task timeout if it is non-zero.
+	timeout time.Duration
+	// run collects the data. It should return promptly once ctx is done.
+	run func(ctx context.Context)
+}
+
+func newTask(f string, run func(context.Context)) *task {
+	return &task{name: taskName(f), outputs: []string{f}, run: run}
+}
+
+// taskName returns the name of the task that writes the output file f.
+func taskName(f string) string {
+	return strings.TrimSuffix(f, path.Ext(f))
+}
+
+func (t *task) withTags(tags ...string) *task {
+	t.tags = append(t.tags, tags...)
+	return t
+}
+
+func (t *task) withDescription(format string, args ...interface{}) *task {
+	t.description = fmt.Sprintf(format, args...)
+	return t
+}
+
+func (t *task) withTools(tools ...string) *task {
+	t.tools = append(t.tools, tools...)
+	return t
+}
+
+func (t *task) withPrivileges(privileges string) *task {
+	t.privileges = privileges
+	return t
+}
+
+func (t *task) withTimeout(timeout time.Duration) *task {
+	t.timeout = timeout
+	return t
+}
+
+func (t *task) withFallback(fallback *task) *task {
+	t.fallback = fallback
+	return t
+}
+
+// runTasks runs tasks, at most parallelism at a time, in the order given.
+// Tasks that have not started when ctx is done are not run.
+func (a *analyzer) runTasks(ctx context.Context, tasks []*task, parallelism int, defaultTimeout time.Duration) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	a.runStarted = time.Now()
+	queue := make(chan *task)
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				a.progress.taskStarted(t.name)
+				a.runTask(ctx, t, defaultTimeout)
+				a.progress.taskFinished(t.name)
+			}
+		}()
+	}
+	for _, t := range tasks {
+		queue <- t
+	}
+	close(queue)
+	wg.Wait()
+	a.runFinished = time.Now()
+	a.logSlowestTasks()
+}
+
+// slowestTasks is how many tasks logSlowestTasks lists.
+const slowestTasks = 5
+
+// logSlowestTasks logs the tasks that took the longest so that a slow run
+// can be attributed to the probes responsible.
+func (a *analyzer) logSlowestTasks() {
+	a.resultsMutex.Lock()
+	records := slices.Clone(a.taskRecords)
+	a.resultsMutex.Unlock()
+	sort.SliceStable(records, func(i, j int) bool { return records[i].DurationMS > records[j].DurationMS })
+	attrs := []any{"run_duration", a.runFinished.Sub(a.runStarted).Round(time.Millisecond)}
+	for _, r := range records[:min(slowestTasks, len(records))] {
+		if r.Started == nil {
+			break
+		}
+		attrs = append(attrs, r.Name, r.Finished.Sub(*r.Started).Round(time.Millisecond))
+	}
+	slog.Info("slowest tasks", attrs...)
+}
+
+// runTask runs t, cancelling it if it exceeds its timeout, or
+// defaultTimeout if the task does not have one. It is also cancelled when
+// runCtx is done, i.e., when the run exceeds --max-duration or is
+// interrupted.
+func (a *analyzer) runTask(runCtx context.Context, t *task, defaultTimeout time.Duration) {
+	timeout := t.timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	record := &taskRecord{Name: t.name, Command: t.command, outputs: t.outputs}
+	a.resultsMutex.Lock()
+	a.taskRecords = append(a.taskRecords, record)
+	a.resultsMutex.Unlock()
+
+	if len(t.missingTools) > 0 {
+		a.storeTaskError(t.name, errors.Wrapf(
+			exec.ErrNotFound,
+			"task %s was skipped as %s is not installed",
+			t.name,
+			strings.Join(t.missingTools, ", "),
+		))
+		record.Status = taskStatusToolMissing
+		return
+	}
+
+	if t.skipReason != "" {
+		slog.Info("task skipped", "task", t.name, "reason", t.skipReason)
+		record.Status = taskStatusSkipped
+		record.Note = t.skipReason
+		return
+	}
+
+	if runCtx.Err() != nil {
+		slog.Info("task not started", "task", t.name, "reason", runCtx.Err().Error())
+		a.markCancelled(runCtx, runCtx, t.name, timeout)
+		record.Status = taskStatusNotStarted
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(runCtx, timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, taskRecordKey{}, record)
+	ctx = context.WithValue(ctx, dialConfigKey{}, a.dial)
+
+	slog.Debug("task started", "task", t.name, "timeout", timeout)
+	start := time.Now()
+	record.TimeoutMS = durationMS(timeout)
+
+	t.run(ctx)
+
+	finished := time.Now()
+	attrs := []any{"task", t.name, "duration", finished.Sub(start)}
+	if ctx.Err() != nil {
+		attrs = append(attrs, "cancelled", ctx.Err().Error())
+	}
+	slog.Info("task finished", attrs...)
+
+	record.Started = &start
+	record.Finished = &finished
+	record.DurationMS = durationMS(finished.Sub(start))
+	record.Status = a.markCancelled(runCtx, ctx, t.name, timeout)
+}
+
+// markCancelled records why the named task was cancelled, if it was, and
+// returns the task's status. runCtx is the context for the whole run and
+// ctx is the task's context.
+func (a *analyzer) markCancelled(runCtx, ctx context.Context, name string, timeout time.Duration) string {
+	switch {
+	case errors.Is(runCtx.Err(), context.Canceled):
+		a.markIncomplete(name, "INTERRUPTED", "the run was interrupted", context.Canceled)
+		a.resultsMutex.Lock()
+		a.interrupted = append(a.interrupted, name)
+		a.resultsMutex.Unlock()
+		return taskStatusInterrupted
+	case errors.Is(runCtx.Err(), context.DeadlineExceeded):
+		a.markTimedOut(name, "the run exceeded --max-duration")
+		return taskStatusTimedOut
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		a.markTimedOut(name, "it ran for longer than "+timeout.String())
+		return taskStatusTimedOut
+	}
+	return taskStatusCompleted
+}
+
+// markTimedOut records that the named task timed out and lists it in
+// report.json.
+func (a *analyzer) markTimedOut(name, reason string) {
+	a.markIncomplete(name, "TIMED OUT", reason, context.DeadlineExceeded)
+	a.resultsMutex.Lock()
+	a.timedOut = append(a.timedOut, name)
+	a.resultsMutex.Unlock()
+}
+
+// markIncomplete records that the named task was cancelled before it
+// finished, with cause, and appends a marker to the task's text output,
+// which may be incomplete.
+func (a *analyzer) markIncomplete(name, status, reason string, cause error) {
+	a.storeTaskError(name, errors.Wrapf(cause, "task %s was cancelled as %s", name, reason))
+
+	marker := "\n*** " + status + ": this output may be incomplete as " + reason + " ***\n"
+	a.filesMutex.Lock()
+	for _, sf := range a.files {
+		if taskName(sf.name) == name && path.Ext(sf.name) == ".txt" {
+			if err := sf.appendBytes([]byte(marker)); err != nil {
+				slog.Warn("error marking output as incomplete", "file", sf.name, "error", err)
+			}
+		}
+	}
+	a.filesMutex.Unlock()
+}
+
+// sleepContext sleeps for d or until ctx is done, returning ctx.Err() in
+// the latter case.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// matches returns true if selector is the task's name or one of its tags.
+func (t *task) matches(selector string) bool {
+	if t.name == selector {
+		return true
+	}
+	for _, tag := range t.tags {
+		if tag == selector {
+			return true
+		}
+	}
+	return false
+}
+
+// filterTasks returns the tasks matching any of only, or all tasks if only
+// is empty, less those matching any of skip.
+func filterTasks(tasks []*task, only, skip []string) []*task {
+	for _, selector := range append(append([]string{}, only...), skip...) {
+		if !anyTaskMatches(tasks, selector) {
+			slog.Warn("selector does not match any task name or tag", "selector", selector)
+		}
+	}
+
+	var filtered []*task
+	for _, t := range tasks {
+		if len(only) > 0 && !t.matchesAny(only) {
+			continue
+		}
+		if t.matchesAny(skip) {
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+	return filtered
+}
+
+func (t *task) matchesAny(selectors []string) bool {
+	for _, selector := range selectors {
+		if t.matches(selector) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyTaskMatches(tasks []*task, selector string) bool {
+	for _, t := range tasks {
+		if t.matches(selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// tasks returns the tasks that are run once regardless of which hosts are
+// being diagnosed.
+//
+// nolint: lll
+func (a *analyzer) tasks() []*task {
+	tasks := []*task{
+		// rfc4892 - gives geographic region
+		a.createDNSTask("dig-cloudflare-josh-rfc4892.txt", dnsOptions{server: "josh.ns.cloudflare.com", nsid: true}, newChaosQuery("id.server", dns.TypeTXT)),
+		a.createDNSTask("dig-cloudflare-kim-rfc4892.txt", dnsOptions{server: "kim.ns.cloudflare.com", nsid: true}, newChaosQuery("id.server", dns.TypeTXT)),
+
+		// CF support want this, too. Don't see what it's useful for
+		// unless we have customers using this service
+		// and they happen to hit the same box in the pool
+		a.createDNSTask("dig-cloudflare.txt", dnsOptions{server: "1.1.1.1", short: true}, newChaosQuery("hostname.cloudflare", dns.TypeTXT)),
+
+		a.createDNSSECTask("dnssec-maxmind.com.txt", "maxmind.com"),
+		a.createSOATask("dns-soa-maxmind.com.txt", "maxmind.com"),
+
+		{
+			name:        "ip-address",
+			description: "Fetches the public IP address of this machine as seen by " + defaultHost,
+			tags:        []string{tagHTTP},
+			outputs:     []string{"ip-address.txt"},
+			run:         a.addIP,
+		},
+		{
+			name:        "ip-address-ptr",
+			description: "Looks up the PTR records of the public IPv4 and IPv6 addresses of this machine",
+			tags:        []string{tagDNS, tagHTTP},
+			outputs:     []string{"ip-address-ptr.txt"},
+			run:         a.addReverseDNS,
+		},
+		{
+			name:        "ip-address-rdap",
+			description: "Looks up the allocation, holder, and country of the public IP address in RDAP",
+			tags:        []string{tagHTTP},
+			outputs:     []string{"ip-address-rdap.json"},
+			run:         a.addRDAP,
+		},
+		{
+			name:        "asn",
+			description: "Looks up the origin AS of the public IP address and of each MaxMind endpoint address",
+			tags:        []string{tagDNS},
+			outputs:     []string{"asn.json"},
+			run:         a.addASNs,
+		},
+		{
+			name:        "resolv-conf",
+			description: "Copies " + resolvConfPath,
+			tags:        []string{tagDNS, tagLocal},
+			outputs:     []string{"resolv.conf"},
+			run:         a.addResolvConf,
+		},
+		{
+			name:        "hosts",
+			description: "Copies the hosts file and checks it for entries for the hosts and MaxMind endpoints",
+			tags:        []string{tagDNS, tagLocal},
+			outputs:     []string{"hosts", "hosts.json"},
+			run:         a.addHostsFile,
+		},
+		{
+			name:        "ntp",
+			description: "Measures the local clock's offset from several public NTP servers",
+			tags:        []string{tagLocal},
+			outputs:     []string{"ntp.json"},
+			run:         a.addNTP,
+		},
+		{
+			name:        "nsswitch-conf",
+			description: "Copies " + nsswitchConfPath + " if it exists",
+			tags:        []string{tagDNS, tagLocal},
+			outputs:     []string{"nsswitch.conf"},
+			run:         a.addNSSwitchConf,
+		},
+		{
+			name:        "endpoint-health",
+			description: "Checks DNS, TCP, TLS, and HTTPS for each MaxMind endpoint",
+			tags:        []string{tagDNS, tagHTTP},
+			outputs:     []string{"endpoint-health.json"},
+			run:         a.addEndpointHealth,
+		},
+		{
+			name:        "tls-certificates",
+			description: "Checks the TLS certificate chain presented by each MaxMind endpoint",
+			tags:        []string{tagHTTP},
+			outputs:     []string{"tls-certificates.txt"},
+			run:         a.addCertificates,
+		},
+		{
+			name:        "tls-handshakes",
+			description: "Times TLS 1.2 and TLS 1.3 handshakes with each MaxMind endpoint",
+			tags:        []string{tagHTTP},
+			outputs:     []string{"tls-handshakes.json"},
+			run:         a.addTLSHandshakes,
+		},
+		{
+			name:        "quic",
+			description: "Attempts a QUIC handshake on UDP 443 with each MaxMind endpoint",
+			tags:        []string{tagHTTP},
+			outputs:     []string{"quic.json"},
+			run:         a.addQUIC,
+		},
+		{
+			name:        "ocsp",
+			description: "Checks the revocation status of each MaxMind endpoint's certificate with OCSP",
+			tags:        []string{tagHTTP},
+			outputs:     []string{"ocsp.json"},
+			run:         a.addOCSP,
+		},
+		{
+			name:        "dns-transports",
+			description: "Queries public resolvers over UDP, TCP, and DNS over TLS and compares the answers",
+			tags:        []string{tagDNS},
+			outputs:     []string{"dns-transports.txt", "dns-transports.json"},
+			run:         a.addDNSTransports,
+		},
+		{
+			name:        "dns-resolvers",
+			description: "Checks the latency, answers, and UDP and TCP support of each configured resolver",
+			tags:        []string{tagDNS},
+			outputs:     []string{"dns-resolvers.json"},
+			run:         a.addResolvers,
+		},
+		{
+			name:        "dns-edns",
+			description: "Probes each nameserver in " + resolvConfPath + " for EDNS0 buffer sizes, truncation, and TCP support",
+			tags:        []string{tagDNS},
+			outputs:     []string{"dns-edns.json"},
+			run:         a.addEDNS,
+		},
+		{
+			name:        "proxy",
+			description: "Records the proxy environment variables and requests each MaxMind endpoint through the proxy and directly",
+			tags:        []string{tagHTTP},
+			outputs:     []string{"proxy.json"},
+			run:         a.addProxy,
+		},
+		{
+			name:        "wpad",
+			description: "Looks for a proxy auto-config file and records the proxy it selects for each MaxMind endpoint",
+			tags:        []string{tagHTTP},
+			outputs:     []string{"wpad.json", "proxy.pac"},
+			run:         a.addPAC,
+		},
+		{
+			name:        "geoipupdate-conf",
+			description: "Copies GeoIP.conf, with the license key redacted, and the GEOIPUPDATE_ environment variables",
+			tags:        []string{tagLocal},
+			outputs:     []string{"geoipupdate-conf.txt"},
+			run:         a.addGeoIPConf,
+		},
+		{
+			name:        "mmdb",
+			description: "Records the type, build date, and size of each MaxMind DB file in the usual database directories",
+			tags:        []string{tagLocal},
+			outputs:     []string{"mmdb.json"},
+			run:         a.addMMDB,
+		},
+	}
+
+	if a.runGeoIPUpdate {
+		tasks = append(tasks, a.createGeoIPUpdateTask("geoipupdate-dry-run.txt"))
+	}
+
+	if a.credentials != nil {
+		tasks = append(tasks, &task{
+			name:        "geoip-web-service",
+			description: "Looks up the public IP address of this machine in the GeoIP2 City web service",
+			tags:        []string{tagHTTP},
+			outputs:     []string{"geoip-city.json"},
+			run:         a.addWebService,
+		}, &task{
+			name:        "download-throughput",
+			description: "Downloads the first 50 MB of a database from download.maxmind.com, measuring the throughput",
+			tags:        []string{tagHTTP},
+			outputs:     []string{"download-throughput.json"},
+			run:         a.addDownload,
+		}, &task{
+			name: "sustained-throughput",
+			description: "Downloads databases from download.maxmind.com for 20 seconds, " +
+				"measuring the throughput of each second",
+			tags:    []string{tagHTTP},
+			outputs: []string{"sustained-throughput.json"},
+			run:     a.addSustainedThroughput,
+		}, &task{
+			name:        "credentials",
+			description: "Authenticates to the database update service and the GeoIP web service, recording which step fails",
+			tags:        []string{tagHTTP},
+			outputs:     []string{"credentials.json"},
+			run:         a.addCredentialChecks,
+		})
+	}
+
+	return append(tasks, a.platformTasks()...)
+}
+
+// hostTasks returns the tasks that diagnose the connection to host. The
+// output file names all include the host so that the tasks for several
+// hosts may be run together.
+//
+// nolint: lll
+func (a *analyzer) hostTasks(host string) []*task {
+	tasks := []*task{
+		a.createHTTPTraceTask("https-"+host+"-ipv4.txt", "tcp4", "https://"+host),
+		a.createHTTPTraceTask("http-"+host+"-ipv4.txt", "tcp4", "http://"+host),
+		a.createHTTPTraceTask("https-"+host+"-ipv6.txt", "tcp6", "https://"+host),
+		a.createHTTPTraceTask("http-"+host+"-ipv6.txt", "tcp6", "http://"+host),
+
+		// Get Cloudflare /cdn-cgi/trace output to determine colo endpoint
+		a.createHTTPTraceTask("https-"+host+"-cdn-cgi-trace-ipv4.txt", "tcp4", "https://"+host+"/cdn-cgi/trace"),
+		a.createHTTPTraceTask("http-"+host+"-cdn-cgi-trace-ipv4.txt", "tcp4", "http://"+host+"/cdn-cgi/trace"),
+		a.createHTTPTraceTask("https-"+host+"-cdn-cgi-trace-ipv6.txt", "tcp6", "https://"+host+"/cdn-cgi/trace"),
+		a.createHTTPTraceTask("http-"+host+"-cdn-cgi-trace-ipv6.txt", "tcp6", "http://"+host+"/cdn-cgi/trace"),
+
+		// The requests above use HTTP/1.1. Some proxies break HTTP/2 in
+		// ways that only show up when it is negotiated.
+		a.createHTTP2Task("https-"+host+"-http2.txt", host),
+
+		// One request says little about a path whose latency varies.
+		a.createHTTPLatencyTask("https-"+host+"-latency.json", host),
+		// Rate limiting looks like a network failure to most clients.
+		a.createBurstTask("https-"+host+"-burst.json", host),
+		a.createKeepAliveTask("https-"+host+"-keepalive.json", host),
+		// Bouncing between anycast edges explains latency that varies
+		// from one request to the next.
+		a.createPOPTask("https-"+host+"-pops.json", host),
+
+		// Sanity check DNS resolution
+		a.createDNSTask(host+"-dig.txt", dnsOptions{}, newDNSQuery(host, dns.TypeA), newDNSQuery(host, dns.TypeAAAA)),
+		a.createDNSTask(host+"-dig-google.txt", dnsOptions{server: "8.8.8.8"}, newDNSQuery(host, dns.TypeA), newDNSQuery(host, dns.TypeAAAA)),
+		a.createDNSTask(host+"-dig-google-trace.txt", dnsOptions{server: "8.8.8.8", trace: true}, newDNSQuery(host, dns.TypeA), newDNSQuery(host, dns.TypeAAAA)),
+
+		// DNS over HTTPS bypasses the local network's resolvers, so these
+		// show whether they return stale or hijacked records
+		a.createDNSTask(host+"-dig-doh-cloudflare.txt", dnsOptions{server: "https://cloudflare-dns.com/dns-query", transport: dnsOverHTTPS}, newDNSQuery(host, dns.TypeA), newDNSQuery(host, dns.TypeAAAA)),
+		a.createDNSTask(host+"-dig-doh-google.txt", dnsOptions{server: "https://dns.google/dns-query", transport: dnsOverHTTPS}, newDNSQuery(host, dns.TypeA), newDNSQuery(host, dns.TypeAAAA)),
+		a.createDNSTask(host+"-dig-doh-quad9.txt", dnsOptions{server: "https://dns.quad9.net/dns-query", transport: dnsOverHTTPS}, newDNSQuery(host, dns.TypeA), newDNSQuery(host, dns.TypeAAAA)),
+
+		// The client subnet determines which CDN node answers are for
+		a.createECSTask(host+"-dig-ecs.txt", host),
+
+		// CF support want this, but there are multiple boxes in the pool
+		// so no guarantee we will see the same results as a customer
+		// or hit a broken NS, if there is one
+		a.createDNSTask(host+"-dig-cloudflare-josh.txt", dnsOptions{server: "josh.ns.cloudflare.com", nsid: true}, newDNSQuery(host, dns.TypeA)),
+		a.createDNSTask(host+"-dig-cloudflare-kim.txt", dnsOptions{server: "kim.ns.cloudflare.com", nsid: true}, newDNSQuery(host, dns.TypeA)),
+
+		// Every authoritative server should give the same answers; one
+		// that doesn't explains lookups that only fail some of the time
+		a.createAuthoritativeTask(host+"-dig-authoritative.txt", host),
+
+		a.createPingTask(host+"-ping-ipv4.txt", "ip4", host),
+		a.createPingTask(host+"-ping-ipv6.txt", "ip6", host),
+		a.createTracerouteTask(host+"-traceroute-icmp-ipv4.json", tracerouteICMP, "ip4", host),
+		a.createTracerouteTask(host+"-traceroute-icmp-ipv6.json", tracerouteICMP, "ip6", host),
+		a.createTracerouteTask(host+"-traceroute-udp-ipv4.json", tracerouteUDP, "ip4", host),
+		a.createTracerouteTask(host+"-traceroute-tcp-ipv4.json", tracerouteTCP, "ip4", host),
+		a.createTracerouteTask(host+"-traceroute-tcp-ipv6.json", tracerouteTCP, "ip6", host),
+		a.createHappyEyeballsTask(host+"-happy-eyeballs.json", host),
+		a.createPMTUTask(host+"-pmtu-ipv4.json", "ip4", host),
+		a.createPMTUTask(host+"-pmtu-ipv6.json", "ip6", host),
+		a.createTCPOptionsTask(host+"-tcp-options-ipv4.json", "ip4", host),
+		a.createTCPOptionsTask(host+"-tcp-options-ipv6.json", "ip6", host),
+	}
+
+	return append(tasks, a.platformHostTasks(host)...)
+}
+
+// printTasks writes a description of each task to w.
+func printTasks(w io.Writer, tasks []*task) {
+	for _, t := range tasks {
+		tools := "none"
+		if len(t.tools) > 0 {
+			tools = strings.Join(t.tools, ", ")
+		}
+		if len(t.missingTools) > 0 {
+			tools += " (not installed: " + strings.Join(t.missingTools, ", ") + ")"
+		}
+		privileges := "none"
+		if t.privileges != "" {
+			privileges = t.privileges
+		}
+
+		fmt.Fprintf(w, "%s\n", t.name)
+		if t.description != "" {
+			fmt.Fprintf(w, "    %s\n", t.description)
+		}
+		fmt.Fprintf(w, "    Tags:       %s\n", strings.Join(t.tags, ", "))
+		fmt.Fprintf(w, "    Tools:      %s\n", tools)
+		fmt.Fprintf(w, "    Privileges: %s\n", privileges)
+		if t.timeout != 0 {
+			fmt.Fprintf(w, "    Timeout:    %s\n", t.timeout)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// familyName returns a human-readable name for the address family of
+// network, e.g., "tcp4" or "ip6".
+func familyName(network string) string {
+	switch {
+	case strings.HasSuffix(network, "4"):
+		return "IPv4"
+	case strings.HasSuffix(network, "6"):
+		return "IPv6"
+	default:
+		return "IPv4 or IPv6"
+	}
+}
+
+// stringSliceFlag is a flag.Value that may be set more than once. Each
+// value may also be a comma-separated list.
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceFlag) Set(v string) error {
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			*s = append(*s, part)
+		}
+	}
+	return nil
+}
+
+// Values returns each value, with the comma-separated lists split.
+func (s *stringSliceFlag) Values() []string {
+	return *s
+}
@@ -0,0 +1,36 @@
+package analyzer
+
+// platformTasks returns the tasks that gather data using tools specific to
+// the current platform.
+func (a *analyzer) platformTasks() []*task {
+	return []*task{
+		a.createStoreCommand("ifconfig.txt", "ifconfig", "-a").withTags(tagLocal).
+			withFallback(a.createInterfacesTask("ifconfig.txt")),
+		a.createStoreCommand("netstat-rn.txt", "netstat", "-rn").withTags(tagLocal, tagRouting),
+		a.createStoreCommand("netstat-ibd.txt", "netstat", "-ibd").withTags(tagLocal),
+		a.createStoreCommand("arp-an.txt", "arp", "-an").withTags(tagLocal),
+		a.createStoreCommand("ndp-an.txt", "ndp", "-an").withTags(tagLocal),
+		a.createFilteredCommand("netstat-anv.txt", a.filterSockets, "netstat", "-anv", "-f", "inet").
+			withTags(tagLocal),
+		a.createFilteredCommand("netstat-anv6.txt", a.filterSockets, "netstat", "-anv", "-f", "inet6").
+			withTags(tagLocal),
+		a.createStoreCommand("scutil-dns.txt", "scutil", "--dns").withTags(tagLocal, tagDNS),
+		a.createStoreCommand("scutil-proxy.txt", "scutil", "--proxy").withTags(tagLocal, tagHTTP),
+		a.createStoreCommand(
+			"networksetup-listallhardwareports.txt",
+			"networksetup",
+			"-listallhardwareports",
+		).withTags(tagLocal),
+	}
+}
+
+// platformHostTasks returns the tasks that diagnose the connection to host
+// using tools specific to the current platform.
+func (a *analyzer) platformHostTasks(host string) []*task {
+	return []*task{
+		// macOS's traceroute does not require root, unlike our native
+		// traceroute.
+		a.createStoreCommand(host+"-traceroute.txt", "traceroute", host).withTags(tagRouting),
+		a.createStoreCommand(host+"-traceroute6.txt", "traceroute6", host).withTags(tagRouting),
+	}
+}
@@ -0,0 +1,42 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDarwinPlatformTasks(t *testing.T) {
+	a := &analyzer{}
+	commands := map[string][]string{}
+	for _, task := range a.platformTasks() {
+		commands[task.name] = task.command
+	}
+	for name, want := range map[string][]string{
+		"ifconfig":                          {"ifconfig", "-a"},
+		"netstat-rn":                        {"netstat", "-rn"},
+		"scutil-dns":                        {"scutil", "--dns"},
+		"networksetup-listallhardwareports": {"networksetup", "-listallhardwareports"},
+		"arp-an":                            {"arp", "-an"},
+		"ndp-an":                            {"ndp", "-an"},
+	} {
+		if got := commands[name]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s runs %v, want %v", name, got, want)
+		}
+	}
+
+	// Without ifconfig, the interfaces are listed natively into the same
+	// file.
+	for _, task := range a.platformTasks() {
+		if task.name == "ifconfig" && (task.fallback == nil || task.fallback.outputs[0] != "ifconfig.txt") {
+			t.Errorf("ifconfig has the fallback %+v", task.fallback)
+		}
+	}
+
+	var names []string
+	for _, task := range a.platformHostTasks("example.com") {
+		names = append(names, task.name)
+	}
+	if want := []string{"example.com-traceroute", "example.com-traceroute6"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("host tasks = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,51 @@
+package analyzer
+
+// platformTasks returns the tasks that gather data using tools specific to
+// the current platform.
+func (a *analyzer) platformTasks() []*task {
+	tasks := []*task{
+		a.createStoreCommand("ip-addr.txt", "ip", "addr").withTags(tagLocal).
+			withFallback(a.createInterfacesTask("ip-addr.txt")),
+		a.createStoreCommand("ip-route.txt", "ip", "route").withTags(tagLocal, tagRouting).
+			withFallback(a.createProcRoutesTask("ip-route.txt")),
+		// Errors, drops, and overruns point at link-layer problems that
+		// look like packet loss further up.
+		a.createStoreCommand("ip-s-link.txt", "ip", "-s", "-s", "link").withTags(tagLocal).
+			withFallback(a.createSysNetStatsTask("ip-s-link.txt")),
+		a.createInterfaceCommand("ethtool-s.txt", nonLoopbackInterfaces, "ethtool", "-S").withTags(tagLocal),
+		// A link that negotiated 10 Mbps or half duplex explains a
+		// remarkable number of slow downloads.
+		a.createLinkTask("link.json"),
+		a.createInterfaceCommand("ethtool.txt", a.dial.activeInterfaces, "ethtool").withTags(tagLocal),
+		a.createInterfaceCommand("ethtool-k.txt", a.dial.activeInterfaces, "ethtool", "-k").withTags(tagLocal),
+		// A FAILED or INCOMPLETE entry for the gateway, or two addresses
+		// with the same MAC, points at a problem on the local segment.
+		a.createStoreCommand("ip-neigh.txt", "ip", "neigh", "show").withTags(tagLocal).
+			withFallback(a.createProcARPTask("ip-neigh.txt")),
+		// -i adds the retransmit counters and such for each connection,
+		// and -p the owning processes, which requires root for those of
+		// other users.
+		a.createFilteredCommand("ss-tunapi.txt", a.filterSockets, "ss", "-tunapi").withTags(tagLocal),
+
+		// Local firewalls frequently cause the problems we diagnose. The
+		// rules that cannot match our traffic are removed.
+		a.createFilteredCommand("iptables-save.txt", a.filterIPTables, "iptables-save").
+			withTags(tagLocal).withPrivileges("root"),
+		a.createFilteredCommand("ip6tables-save.txt", a.filterIPTables, "ip6tables-save").
+			withTags(tagLocal).withPrivileges("root"),
+		a.createFilteredCommand("nft-ruleset.txt", a.filterNFT, "nft", "list", "ruleset").
+			withTags(tagLocal).withPrivileges("root"),
+	}
+	tasks = append(tasks, a.resolvedTasks(systemdResolvedDir, systemdConfDir)...)
+	return append(tasks, a.netConfigTasks(netplanDir)...)
+}
+
+// platformHostTasks returns the tasks that diagnose the connection to host
+// using tools specific to the current platform.
+func (a *analyzer) platformHostTasks(host string) []*task {
+	return []*task{
+		// Receiving the SYN-ACKs on a raw socket only works on Linux.
+		a.createECNTask(host+"-ecn-ipv4.json", "ip4", host),
+		a.createECNTask(host+"-ecn-ipv6.json", "ip6", host),
+	}
+}
@@ -0,0 +1,42 @@
+package analyzer
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLinuxPlatformTasks(t *testing.T) {
+	a := &analyzer{}
+	byName := map[string]*task{}
+	for _, task := range a.platformTasks() {
+		byName[task.name] = task
+	}
+	for name, want := range map[string][]string{
+		"ip-neigh": {"ip", "neigh", "show"},
+	} {
+		if got := byName[name]; got == nil || !reflect.DeepEqual(got.command, want) {
+			t.Errorf("%s = %+v, want the command %v", name, got, want)
+		}
+	}
+
+	// Without ip, the neighbor table is read from /proc into the same
+	// file.
+	if neigh := byName["ip-neigh"]; neigh == nil || neigh.fallback == nil ||
+		neigh.fallback.outputs[0] != "ip-neigh.txt" {
+		t.Errorf("ip-neigh has the fallback %+v", neigh)
+	}
+}
+
+func TestProcARPTask(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.createProcARPTask("ip-neigh.txt").run(context.Background())
+	if a.hasErrors() {
+		t.Fatalf("errors: %v", a.errors)
+	}
+	if got := string(storedContents(t, a, "ip-neigh.txt")); !strings.HasPrefix(got, "IP address") {
+		t.Errorf("ip-neigh.txt = %q", got)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !windows
+
+package analyzer
+
+// platformTasks returns the tasks that gather data using tools specific to
+// the current platform. We do not have any for this platform yet.
+func (a *analyzer) platformTasks() []*task {
+	return nil
+}
+
+// platformHostTasks returns the tasks that diagnose the connection to host
+// using tools specific to the current platform.
+func (a *analyzer) platformHostTasks(string) []*task {
+	return nil
+}
@@ -0,0 +1,264 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHostTasksAreDistinct(t *testing.T) {
+	a := &analyzer{pingCount: defaultPingCount, pingInterval: defaultPingInterval}
+	hosts := []string{"geoip.maxmind.com", "updates.maxmind.com"}
+
+	tasks := a.tasks()
+	for _, h := range hosts {
+		hostTasks := a.hostTasks(h)
+		if len(hostTasks) == 0 {
+			t.Fatalf("no tasks for %s", h)
+		}
+		for _, task := range hostTasks {
+			for _, f := range task.outputs {
+				if !strings.Contains(f, h) {
+					t.Errorf("%s's output %s does not name the host", task.name, f)
+				}
+			}
+		}
+		tasks = append(tasks, hostTasks...)
+	}
+
+	// Every task and output file must be unique so that the tasks for
+	// several hosts may be run together.
+	names := map[string]bool{}
+	outputs := map[string]string{}
+	for _, task := range tasks {
+		if names[task.name] {
+			t.Errorf("there are two tasks named %s", task.name)
+		}
+		names[task.name] = true
+		for _, f := range task.outputs {
+			if other, ok := outputs[f]; ok {
+				t.Errorf("%s and %s both write %s", other, task.name, f)
+			}
+			outputs[f] = task.name
+		}
+	}
+}
+
+func TestStringSliceFlag(t *testing.T) {
+	var s stringSliceFlag
+	for _, v := range []string{"geoip.maxmind.com", "updates.maxmind.com, download.maxmind.com", " ,"} {
+		if err := s.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"geoip.maxmind.com", "updates.maxmind.com", "download.maxmind.com"}
+	if !reflect.DeepEqual(s.Values(), want) {
+		t.Errorf("Values = %v, want %v", s.Values(), want)
+	}
+	if got := s.String(); got != strings.Join(want, ",") {
+		t.Errorf("String = %q", got)
+	}
+}
+
+func TestFilterTasks(t *testing.T) {
+	tasks := []*task{
+		newTask("dig.txt", nil).withTags(tagDNS),
+		newTask("https.txt", nil).withTags(tagHTTP),
+		newTask("ping.txt", nil).withTags(tagRouting),
+		newTask("resolv.conf", nil).withTags(tagDNS, tagLocal),
+	}
+	names := func(tasks []*task) string {
+		var names []string
+		for _, t := range tasks {
+			names = append(names, t.name)
+		}
+		return strings.Join(names, ",")
+	}
+	tests := []struct {
+		only, skip []string
+		want       string
+	}{
+		{nil, nil, "dig,https,ping,resolv"},
+		{[]string{tagDNS}, nil, "dig,resolv"},
+		{[]string{tagDNS, "ping"}, nil, "dig,ping,resolv"},
+		{nil, []string{tagLocal}, "dig,https,ping"},
+		{[]string{tagDNS}, []string{"resolv"}, "dig"},
+		{[]string{"no-such-task"}, nil, ""},
+		{nil, []string{"no-such-task"}, "dig,https,ping,resolv"},
+	}
+	for _, test := range tests {
+		if got := names(filterTasks(tasks, test.only, test.skip)); got != test.want {
+			t.Errorf("filterTasks(only %v, skip %v) = %s, want %s", test.only, test.skip, got, test.want)
+		}
+	}
+}
+
+func TestPrintTasks(t *testing.T) {
+	a := &analyzer{}
+	command := a.createStoreCommand("ip-route.txt", "ip", "route").withTags(tagLocal, tagRouting)
+	command.missingTools = []string{"ip"}
+	native := newTask("ntp.json", nil).withTags(tagLocal).
+		withDescription("Measures the clock offset").
+		withPrivileges("root").
+		withTimeout(90 * time.Second)
+
+	var buf bytes.Buffer
+	printTasks(&buf, []*task{command, native})
+	want := `ip-route
+    Runs ` + "`ip route`" + `
+    Tags:       local, routing
+    Tools:      ip (not installed: ip)
+    Privileges: none
+
+ntp
+    Measures the clock offset
+    Tags:       local
+    Tools:      none
+    Privileges: root
+    Timeout:    1m30s
+
+`
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+// blockingTask returns a task that stores partial output in f and then
+// waits until it is cancelled.
+func blockingTask(a *analyzer, f string) *task {
+	return newTask(f, func(ctx context.Context) {
+		a.storeFile(f, []byte("partial output"))
+		<-ctx.Done()
+	})
+}
+
+func TestRunTaskTimeout(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	a.runTasks(context.Background(), []*task{
+		blockingTask(a, "mtr.txt").withTimeout(50 * time.Millisecond),
+		blockingTask(a, "dig-trace.txt"),
+	}, 2, 100*time.Millisecond)
+
+	for _, r := range a.taskRecords {
+		if r.Status != taskStatusTimedOut || r.TimeoutMS == 0 {
+			t.Errorf("%s = %+v", r.Name, r)
+		}
+	}
+	if len(a.timedOut) != 2 || a.timedOut[0] != "mtr" {
+		t.Errorf("timed out tasks = %v", a.timedOut)
+	}
+	want := "partial output\n*** TIMED OUT: this output may be incomplete as it ran for longer than 50ms ***\n"
+	if got := string(storedContents(t, a, "mtr.txt")); got != want {
+		t.Errorf("mtr.txt = %q", got)
+	}
+	if !a.hasErrors() {
+		t.Error("the timeouts were not recorded as errors")
+	}
+}
+
+func TestRunTaskKillsCommand(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not installed")
+	}
+	a := &analyzer{}
+	defer a.removeSpool()
+	start := time.Now()
+	a.runTasks(context.Background(), []*task{a.createStoreCommand("sleep.txt", "sleep", "60")}, 1, 100*time.Millisecond)
+	if took := time.Since(start); took > 10*time.Second {
+		t.Errorf("the command ran for %s", took)
+	}
+	if r := a.taskRecords[0]; r.Status != taskStatusTimedOut || r.ExitCode == nil {
+		t.Errorf("record = %+v", r)
+	}
+}
+
+func TestRunTaskKillsCommandWithChildren(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not installed")
+	}
+	a := &analyzer{}
+	defer a.removeSpool()
+	// The sleep and cat keep the output pipe open after sh is killed.
+	start := time.Now()
+	a.runTasks(
+		context.Background(),
+		[]*task{a.createStoreCommand("pipe.txt", "sh", "-c", "sleep 30 | cat")},
+		1,
+		100*time.Millisecond,
+	)
+	if took := time.Since(start); took > 10*time.Second {
+		t.Errorf("the command ran for %s", took)
+	}
+	if r := a.taskRecords[0]; r.Status != taskStatusTimedOut {
+		t.Errorf("record = %+v", r)
+	}
+}
+
+func TestRunTasksMaxDuration(t *testing.T) {
+	a := &analyzer{}
+	defer a.removeSpool()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	a.runTasks(ctx, []*task{blockingTask(a, "mtr.txt"), blockingTask(a, "ping.txt")}, 1, time.Minute)
+
+	statuses := map[string]string{}
+	for _, r := range a.taskRecords {
+		statuses[r.Name] = r.Status
+	}
+	// The task that had not started when the run's deadline passed is
+	// not run.
+	want := map[string]string{"mtr": taskStatusTimedOut, "ping": taskStatusNotStarted}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("statuses = %v, want %v", statuses, want)
+	}
+	if want := []string{"mtr", "ping"}; !reflect.DeepEqual(a.timedOut, want) {
+		t.Errorf("timed out tasks = %v, want %v", a.timedOut, want)
+	}
+	marker := "partial output\n*** TIMED OUT: this output may be incomplete as the run exceeded --max-duration ***\n"
+	if got := string(storedContents(t, a, "mtr.txt")); got != marker {
+		t.Errorf("mtr.txt = %q", got)
+	}
+}
+
+func TestRunTasksParallelism(t *testing.T) {
+	for _, parallelism := range []int{0, 1, 3} {
+		a := &analyzer{}
+		var (
+			mu                  sync.Mutex
+			running, maxRunning int
+			started             []string
+		)
+		var tasks []*task
+		for _, name := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+			tasks = append(tasks, newTask(name+".txt", func(context.Context) {
+				mu.Lock()
+				running++
+				maxRunning = max(maxRunning, running)
+				started = append(started, name)
+				mu.Unlock()
+				time.Sleep(20 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+			}))
+		}
+		a.runTasks(context.Background(), tasks, parallelism, time.Minute)
+
+		if want := max(parallelism, 1); maxRunning != want {
+			t.Errorf("with parallelism %d, %d tasks ran at once", parallelism, maxRunning)
+		}
+		if len(started) != len(tasks) {
+			t.Errorf("with parallelism %d, %d of %d tasks ran", parallelism, len(started), len(tasks))
+		}
+		// One at a time, the tasks run in the order given.
+		if parallelism <= 1 && strings.Join(started, "") != "abcdefg" {
+			t.Errorf("with parallelism %d, the tasks ran in the order %v", parallelism, started)
+		}
+	}
+}
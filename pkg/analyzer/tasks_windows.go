@@ -0,0 +1,32 @@
+package analyzer
+
+// platformTasks returns the tasks that gather data using tools specific to
+// the current platform.
+func (a *analyzer) platformTasks() []*task {
+	return []*task{
+		a.createStoreCommand("netstat-e.txt", "netstat", "-e").withTags(tagLocal),
+		a.createFilteredCommand("netstat-ano.txt", a.filterSockets, "netstat", "-ano").withTags(tagLocal),
+		a.createStoreCommand("arp-a.txt", "arp", "-a").withTags(tagLocal),
+		a.createStoreCommand("netsh-ipv6-neighbors.txt", "netsh", "interface", "ipv6", "show", "neighbors").
+			withTags(tagLocal),
+		a.createStoreCommand(
+			"netsh-advfirewall-profiles.txt",
+			"netsh", "advfirewall", "show", "allprofiles",
+		).withTags(tagLocal),
+		a.createStoreCommand(
+			"netsh-advfirewall-rules.txt",
+			"netsh", "advfirewall", "firewall", "show", "rule", "name=all", "verbose",
+		).withTags(tagLocal),
+		// WinHTTP has its own proxy setting, which services and many
+		// command line programs use instead of the user's.
+		a.createStoreCommand("netsh-winhttp-proxy.txt", "netsh", "winhttp", "show", "proxy").
+			withTags(tagLocal, tagHTTP),
+		a.createInternetSettingsTask("internet-settings.txt"),
+	}
+}
+
+// platformHostTasks returns the tasks that diagnose the connection to host
+// using tools specific to the current platform.
+func (a *analyzer) platformHostTasks(string) []*task {
+	return nil
+}
@@ -0,0 +1,28 @@
+package analyzer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWindowsPlatformTasks(t *testing.T) {
+	a := &analyzer{}
+	commands := map[string][]string{}
+	for _, task := range a.platformTasks() {
+		commands[task.name] = task.command
+	}
+	for name, want := range map[string][]string{
+		"arp-a":                      {"arp", "-a"},
+		"netsh-ipv6-neighbors":       {"netsh", "interface", "ipv6", "show", "neighbors"},
+		"netsh-advfirewall-profiles": {"netsh", "advfirewall", "show", "allprofiles"},
+		"netsh-advfirewall-rules":    {"netsh", "advfirewall", "firewall", "show", "rule", "name=all", "verbose"},
+		"netsh-winhttp-proxy":        {"netsh", "winhttp", "show", "proxy"},
+	} {
+		if got := commands[name]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s runs %v, want %v", name, got, want)
+		}
+	}
+	if _, ok := commands["internet-settings"]; !ok {
+		t.Error("there is no internet-settings task")
+	}
+}
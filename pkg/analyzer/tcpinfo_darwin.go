@@ -0,0 +1,37 @@
+package analyzer
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// readTCPInfo returns the options negotiated for the connection underlying
+// c using TCP_CONNECTION_INFO.
+func readTCPInfo(c syscall.RawConn) (*tcpInfo, error) {
+	var info *unix.TCPConnectionInfo
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		info, sockErr = unix.GetsockoptTCPConnectionInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_CONNECTION_INFO)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error accessing socket")
+	}
+	if sockErr != nil {
+		return nil, errors.Wrap(sockErr, "error getting TCP_CONNECTION_INFO")
+	}
+
+	t := &tcpInfo{
+		MSS:           int(info.Maxseg),
+		Timestamps:    info.Options&tcpOptTimestamps != 0,
+		SACK:          info.Options&tcpOptSACK != 0,
+		WindowScaling: info.Options&tcpOptWindowScaling != 0,
+		ECN:           info.Options&tcpOptECN != 0,
+	}
+	if t.WindowScaling {
+		t.SendWindowScale = int(info.Snd_wscale)
+		t.ReceiveWindowScale = int(info.Rcv_wscale)
+	}
+	return t, nil
+}
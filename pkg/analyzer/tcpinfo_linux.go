@@ -0,0 +1,43 @@
+package analyzer
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// readTCPInfo returns the options negotiated for the connection underlying
+// c using TCP_INFO.
+func readTCPInfo(c syscall.RawConn) (*tcpInfo, error) {
+	var info *unix.TCPInfo
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		info, sockErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error accessing socket")
+	}
+	if sockErr != nil {
+		return nil, errors.Wrap(sockErr, "error getting TCP_INFO")
+	}
+
+	// The window scales are 4-bit fields in the byte after Options, which
+	// unix.TCPInfo leaves as padding.
+	wscale := (*[8]byte)(unsafe.Pointer(info))[6]
+	t := &tcpInfo{
+		MSS:           int(info.Snd_mss),
+		AdvertisedMSS: int(info.Advmss),
+		PathMTU:       int(info.Pmtu),
+		Timestamps:    info.Options&tcpOptTimestamps != 0,
+		SACK:          info.Options&tcpOptSACK != 0,
+		WindowScaling: info.Options&tcpOptWindowScaling != 0,
+		ECN:           info.Options&tcpOptECN != 0,
+	}
+	if t.WindowScaling {
+		t.SendWindowScale = int(wscale & 0x0f)
+		t.ReceiveWindowScale = int(wscale >> 4)
+	}
+	return t, nil
+}
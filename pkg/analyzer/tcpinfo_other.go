@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package analyzer
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// readTCPInfo is not implemented on this platform.
+func readTCPInfo(syscall.RawConn) (*tcpInfo, error) {
+	return nil, errors.New("reading TCP options is not supported on this platform")
+}
@@ -0,0 +1,135 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// Bits in the options field of Linux's TCP_INFO and macOS's
+// TCP_CONNECTION_INFO, which use the same values.
+const (
+	tcpOptTimestamps    = 0x1
+	tcpOptSACK          = 0x2
+	tcpOptWindowScaling = 0x4
+	tcpOptECN           = 0x8
+
+	// tcpTimestampsOverhead is the size of the timestamps option that
+	// the kernel subtracts from the MSS when they are used.
+	tcpTimestampsOverhead = 12
+)
+
+// tcpInfo is what the kernel negotiated for a TCP connection. Fields the
+// platform does not report are zero.
+type tcpInfo struct {
+	// MSS is the largest segment that will be sent, after any clamping.
+	MSS int `json:"mss"`
+	// AdvertisedMSS is the MSS in our SYN.
+	AdvertisedMSS      int  `json:"advertised_mss,omitempty"`
+	PathMTU            int  `json:"path_mtu,omitempty"`
+	Timestamps         bool `json:"timestamps"`
+	SACK               bool `json:"sack"`
+	WindowScaling      bool `json:"window_scaling"`
+	SendWindowScale    int  `json:"send_window_scale,omitempty"`
+	ReceiveWindowScale int  `json:"receive_window_scale,omitempty"`
+	ECN                bool `json:"ecn"`
+}
+
+// tcpOptionsReport is the TCP options negotiated with a host. Middleboxes
+// that rewrite the SYN often lower the MSS or strip options, which can
+// cause stalls or slow transfers.
+type tcpOptionsReport struct {
+	Host       string   `json:"host"`
+	Network    string   `json:"network"`
+	LocalAddr  string   `json:"local_address,omitempty"`
+	RemoteAddr string   `json:"remote_address,omitempty"`
+	LocalMTU   int      `json:"local_mtu,omitempty"`
+	TCP        *tcpInfo `json:"tcp,omitempty"`
+	// MSSClamped is true if the MSS is smaller than the local MTU allows,
+	// i.e., the server or something on the path lowered it.
+	MSSClamped bool `json:"mss_clamped"`
+	// Stripped lists the options that every MaxMind endpoint supports but
+	// were not negotiated.
+	Stripped []string `json:"stripped,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (a *analyzer) createTCPOptionsTask(f, network, host string) *task {
+	return newTask(f, func(ctx context.Context) {
+		r := tcpOptions(ctx, network, host)
+		if r.Error != "" {
+			a.storeError(ctx, errors.Errorf("error getting data for %s: %s", f, r.Error))
+		}
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", f))
+			return
+		}
+		a.storeFile(f, b)
+		a.storeResult(taskName(f), r)
+	}).withTags(tagRouting).
+		withDescription("Records the MSS and TCP options negotiated with %s over %s", host, familyName(network))
+}
+
+// tcpOptions connects to port 443 on host over network ("ip4" or "ip6")
+// and reads the negotiated options from the kernel.
+func tcpOptions(ctx context.Context, network, host string) *tcpOptionsReport {
+	return tcpOptionsTo(ctx, network, host, net.JoinHostPort(host, "443"))
+}
+
+// tcpOptionsTo is tcpOptions connecting to addr.
+func tcpOptionsTo(ctx context.Context, network, host, addr string) *tcpOptionsReport {
+	r := &tcpOptionsReport{Host: host, Network: network}
+
+	ctx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+
+	dial := dialConfigFromContext(ctx)
+	dialer := dial.newDialer("tcp")
+	conn, err := dialer.DialContext(ctx, "tcp"+network[2:], addr)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	defer conn.Close()
+
+	local := conn.LocalAddr().(*net.TCPAddr)
+	remote := conn.RemoteAddr().(*net.TCPAddr)
+	r.LocalAddr, r.RemoteAddr = local.String(), remote.String()
+
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	r.TCP, err = readTCPInfo(raw)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+
+	if !r.TCP.SACK {
+		r.Stripped = append(r.Stripped, "SACK")
+	}
+	if !r.TCP.WindowScaling {
+		r.Stripped = append(r.Stripped, "window scaling")
+	}
+
+	// The MTU is only used to tell whether the MSS was clamped, so failing
+	// to find it is not an error.
+	if mtu, err := dial.interfaceMTU(network, remote.IP); err == nil {
+		r.LocalMTU = mtu
+		expected := min(mtu, 65535) - 40
+		if network == "ip6" {
+			expected -= 20
+		}
+		mss := r.TCP.MSS
+		if r.TCP.Timestamps {
+			mss += tcpTimestampsOverhead
+		}
+		r.MSSClamped = mss < expected
+	}
+	return r
+}
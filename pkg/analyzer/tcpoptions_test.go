@@ -0,0 +1,53 @@
+package analyzer
+
+import (
+	"context"
+	"net"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestTCPOptions(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The kernel completes the handshake without the connection being
+	// accepted.
+	defer l.Close()
+
+	r := tcpOptionsTo(context.Background(), "ip4", "localhost", l.Addr().String())
+	if r.Host != "localhost" || r.Network != "ip4" || r.RemoteAddr != l.Addr().String() || r.LocalAddr == "" {
+		t.Errorf("report = %+v", r)
+	}
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		if r.TCP != nil || !strings.Contains(r.Error, "not supported") {
+			t.Errorf("report on %s = %+v", runtime.GOOS, r)
+		}
+		return
+	}
+	if r.Error != "" || r.TCP == nil || r.TCP.MSS == 0 {
+		t.Fatalf("report = %+v", r)
+	}
+	// Loopback connections negotiate every option.
+	if r.Stripped != nil {
+		t.Errorf("stripped = %v", r.Stripped)
+	}
+
+	closed := l.Addr().String()
+	_ = l.Close()
+	if r := tcpOptionsTo(context.Background(), "ip4", "localhost", closed); r.Error == "" || r.TCP != nil {
+		t.Errorf("report for a closed port = %+v", r)
+	}
+}
+
+func TestTCPOptionsFindings(t *testing.T) {
+	r := &tcpOptionsReport{Host: "geoip.maxmind.com", Network: "ip6", Stripped: []string{"SACK", "window scaling"}}
+	fs := findingsFor(map[string]interface{}{"geoip.maxmind.com-tcp-options-ipv6": r})
+	want := "the IPv6 connection to geoip.maxmind.com did not negotiate SACK or window scaling; " +
+		"a middlebox may be stripping TCP options"
+	if len(fs) != 1 || fs[0].Check != "tcp-options-stripped" || fs[0].Summary != want {
+		t.Errorf("findings = %+v", fs)
+	}
+}
@@ -0,0 +1,522 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Traceroute probe modes.
+const (
+	tracerouteICMP = "icmp"
+	tracerouteUDP  = "udp"
+	tracerouteTCP  = "tcp"
+)
+
+const (
+	tracerouteMaxHops = 30
+	// defaultTracerouteCycles is used unless --traceroute-cycles is given.
+	// Intermittent loss needs more cycles to show up.
+	defaultTracerouteCycles = 10
+	tracerouteInterval      = time.Second
+	tracerouteTimeout       = 2 * time.Second
+
+	// These are the traditional traceroute UDP base port and an
+	// arbitrary base for TCP source ports.
+	tracerouteUDPBasePort = 33434
+	tracerouteTCPBasePort = 44000
+	tracerouteTCPPort     = 443
+
+	// We only keep this many probes in flight so that the ports and
+	// sequence numbers we use stay in a predictable range.
+	traceroutePortRange = 1024
+	// tracerouteTCPInFlight bounds the TCP connection attempts in
+	// progress. Each lasts at most tracerouteTimeout, so this is two
+	// rounds of probes.
+	tracerouteTCPInFlight = 2 * tracerouteMaxHops
+)
+
+// tracerouteHop is the aggregate of every probe sent with a given TTL.
+type tracerouteHop struct {
+	TTL       int      `json:"ttl"`
+	Addresses []string `json:"addresses"`
+	Sent      int      `json:"sent"`
+	Received  int      `json:"received"`
+	Loss      float64  `json:"loss_percent"`
+	BestMS    float64  `json:"best_ms"`
+	AvgMS     float64  `json:"avg_ms"`
+	WorstMS   float64  `json:"worst_ms"`
+	StdDevMS  float64  `json:"stddev_ms"`
+
+	rtts      []time.Duration
+	addresses map[string]struct{}
+}
+
+type tracerouteResult struct {
+	Host    string           `json:"host"`
+	Address string           `json:"address"`
+	Mode    string           `json:"mode"`
+	Cycles  int              `json:"cycles"`
+	Reached bool             `json:"reached"`
+	Hops    []*tracerouteHop `json:"hops"`
+}
+
+type tracerouteProbe struct {
+	ttl  int
+	sent time.Time
+}
+
+// tracer runs a single traceroute. Replies are received on a raw ICMP
+// socket in a separate goroutine and matched to probes by key, which is
+// the UDP destination port, TCP source port, or ICMP sequence number,
+// depending on the mode.
+//
+// TCP probes are connection attempts made with connect() rather than
+// crafted SYN packets, as those would need a second raw socket. Each runs
+// in its own goroutine, at most tracerouteTCPInFlight at a time.
+type tracer struct {
+	mode    string
+	network string
+	dst     net.IP
+	icmp    *icmp.PacketConn
+	id      int
+	dial    *dialConfig
+
+	tcpSlots chan struct{}
+	tcpWG    sync.WaitGroup
+
+	mu        sync.Mutex
+	pending   map[int]tracerouteProbe
+	hops      []*tracerouteHop
+	lastHop   int
+	reachedAt int
+	// tcpErr is the first unexpected error from a TCP probe.
+	tcpErr error
+}
+
+func (a *analyzer) createTracerouteTask(f, mode, network, host string) *task {
+	t := newTask(f, func(ctx context.Context) {
+		result, err := traceroute(ctx, mode, network, host, a.tracerouteCycles)
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error getting data for %s", f))
+		}
+		if result == nil {
+			return
+		}
+		b, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			a.storeError(ctx, errors.Wrapf(err, "error encoding %s", f))
+			return
+		}
+		a.storeFile(f, b)
+		a.storeResult(taskName(f), result)
+	}).withTags(tagRouting).
+		withDescription(
+			"Traces the route to %s over %s using %d cycles of %s probes",
+			host,
+			familyName(network),
+			a.tracerouteCycles,
+			strings.ToUpper(mode),
+		).
+		withPrivileges("root")
+	// Several minutes of cycles need longer than the default timeout.
+	if d := time.Duration(a.tracerouteCycles)*tracerouteInterval + tracerouteTimeout; d > defaultTaskTimeout {
+		t.withTimeout(d + tracerouteTimeout)
+	}
+	return t
+}
+
+// traceroute sends cycles rounds of probes with increasing TTLs to host
+// over network ("ip4" or "ip6") and aggregates the replies per hop. A raw
+// ICMP socket is required to receive the replies from intermediate hops.
+// If ctx is done before all of the cycles are sent, the hops seen so far
+// are returned with ctx.Err().
+func traceroute(ctx context.Context, mode, network, host string, cycles int) (*tracerouteResult, error) {
+	ips, err := net.DefaultResolver.LookupIP(ctx, network, host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error looking up %s", host)
+	}
+
+	rawNetwork := "ip4:icmp"
+	if network == "ip6" {
+		rawNetwork = "ip6:ipv6-icmp"
+	}
+	dial := dialConfigFromContext(ctx)
+	conn, err := icmp.ListenPacket(rawNetwork, dial.listenAddr(network))
+	if err != nil {
+		return nil, errors.Wrap(err, "error opening raw ICMP socket (traceroute requires root)")
+	}
+	defer conn.Close()
+
+	t := &tracer{
+		mode:    mode,
+		network: network,
+		dst:     ips[0],
+		icmp:    conn,
+		dial:    dial,
+		// Use a different ID than ping so that the two can run at the
+		// same time.
+		id:       (os.Getpid() + 1) & 0xffff,
+		tcpSlots: make(chan struct{}, tracerouteTCPInFlight),
+		pending:  map[int]tracerouteProbe{},
+		lastHop:  tracerouteMaxHops,
+	}
+	for ttl := 1; ttl <= tracerouteMaxHops; ttl++ {
+		t.hops = append(t.hops, &tracerouteHop{TTL: ttl, addresses: map[string]struct{}{}})
+	}
+	// This runs before conn is closed so that every reply to a TCP probe
+	// can still be received.
+	defer t.tcpWG.Wait()
+
+	go t.receive()
+
+	seq := 0
+	for cycle := 0; cycle < cycles; cycle++ {
+		roundStart := time.Now()
+		for ttl := 1; ttl <= t.maxTTL(); ttl++ {
+			if err := t.send(ctx, ttl, seq%traceroutePortRange); err != nil {
+				return t.result(host, cycle+1), err
+			}
+			seq++
+		}
+		if err := sleepContext(ctx, time.Until(roundStart.Add(tracerouteInterval))); err != nil {
+			return t.result(host, cycle+1), err
+		}
+	}
+	if err := sleepContext(ctx, tracerouteTimeout); err != nil {
+		return t.result(host, cycles), err
+	}
+
+	t.tcpWG.Wait()
+	return t.result(host, cycles), t.tcpError()
+}
+
+func (t *tracer) maxTTL() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.lastHop
+}
+
+func (t *tracer) send(ctx context.Context, ttl, key int) error {
+	if t.mode == tracerouteTCP {
+		// Wait for a slot before the probe's time starts.
+		select {
+		case t.tcpSlots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	t.mu.Lock()
+	t.pending[key] = tracerouteProbe{ttl: ttl, sent: time.Now()}
+	t.hops[ttl-1].Sent++
+	t.mu.Unlock()
+
+	var err error
+	switch t.mode {
+	case tracerouteICMP:
+		err = t.sendICMP(ttl, key)
+	case tracerouteUDP:
+		err = t.sendUDP(ttl, key)
+	case tracerouteTCP:
+		t.tcpWG.Add(1)
+		go func() {
+			defer t.tcpWG.Done()
+			defer func() { <-t.tcpSlots }()
+			t.sendTCP(ttl, key)
+		}()
+	default:
+		err = errors.Errorf("unknown traceroute mode %q", t.mode)
+	}
+	return err
+}
+
+func (t *tracer) sendICMP(ttl, seq int) error {
+	var echoType icmp.Type = ipv4.ICMPTypeEcho
+	var err error
+	if t.network == "ip6" {
+		echoType = ipv6.ICMPTypeEchoRequest
+		err = t.icmp.IPv6PacketConn().SetHopLimit(ttl)
+	} else {
+		err = t.icmp.IPv4PacketConn().SetTTL(ttl)
+	}
+	if err != nil {
+		return errors.Wrap(err, "error setting TTL")
+	}
+
+	msg := icmp.Message{
+		Type: echoType,
+		Body: &icmp.Echo{ID: t.id, Seq: seq, Data: []byte("mm-network-analyzer")},
+	}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		return errors.Wrap(err, "error creating echo request")
+	}
+	_, err = t.icmp.WriteTo(b, &net.IPAddr{IP: t.dst})
+	return errors.Wrap(err, "error sending echo request")
+}
+
+func (t *tracer) sendUDP(ttl, key int) error {
+	lc := net.ListenConfig{Control: t.dial.bindControl}
+	laddr := net.JoinHostPort(t.dial.listenAddr(t.network), "0")
+	conn, err := lc.ListenPacket(context.Background(), "udp"+t.network[2:], laddr)
+	if err != nil {
+		return errors.Wrap(err, "error opening UDP socket")
+	}
+	defer conn.Close()
+
+	if t.network == "ip6" {
+		err = ipv6.NewPacketConn(conn).SetHopLimit(ttl)
+	} else {
+		err = ipv4.NewPacketConn(conn).SetTTL(ttl)
+	}
+	if err != nil {
+		return errors.Wrap(err, "error setting TTL")
+	}
+
+	dst := &net.UDPAddr{IP: t.dst, Port: tracerouteUDPBasePort + key}
+	_, err = conn.WriteTo([]byte("mm-network-analyzer"), dst)
+	return errors.Wrap(err, "error sending UDP probe")
+}
+
+// sendTCP attempts a TCP connection with the given TTL from the source
+// port for key. Intermediate hops are recorded by the ICMP receiver. If
+// the connection is accepted or refused, the probe reached the
+// destination. A connection that times out or is reported unreachable
+// expired on the way; any other error, such as a failure to bind the
+// source port, is kept for tcpError.
+func (t *tracer) sendTCP(ttl, key int) {
+	dialer := &net.Dialer{
+		LocalAddr: &net.TCPAddr{IP: t.dial.sourceIP(), Port: tracerouteTCPBasePort + key},
+		Timeout:   tracerouteTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			if err := t.dial.bindControl(network, address, c); err != nil {
+				return err
+			}
+			return setTTL(c, t.network, ttl)
+		},
+	}
+	addr := net.JoinHostPort(t.dst.String(), strconv.Itoa(tracerouteTCPPort))
+	conn, err := dialer.Dial("tcp"+t.network[2:], addr)
+	if err == nil {
+		// Resetting the connection rather than closing it leaves no
+		// TIME_WAIT state behind, which would keep the source port from
+		// being bound again when the keys wrap.
+		_ = conn.(*net.TCPConn).SetLinger(0)
+		_ = conn.Close()
+	}
+	var netErr net.Error
+	switch {
+	case err == nil || errors.Is(err, syscall.ECONNREFUSED):
+		t.record(key, t.dst.String(), true)
+	case errors.As(err, &netErr) && netErr.Timeout(),
+		errors.Is(err, syscall.EHOSTUNREACH),
+		errors.Is(err, syscall.ENETUNREACH),
+		errors.Is(err, syscall.ECONNRESET):
+	case errors.Is(err, syscall.EADDRINUSE):
+		t.setTCPError(errors.Wrapf(err, "error binding TCP probe source port %d", tracerouteTCPBasePort+key))
+	default:
+		t.setTCPError(errors.Wrap(err, "error sending TCP probe"))
+	}
+}
+
+func (t *tracer) setTCPError(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tcpErr == nil {
+		t.tcpErr = err
+	}
+}
+
+func (t *tracer) tcpError() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tcpErr
+}
+
+func (t *tracer) receive() {
+	proto := protocolICMP
+	if t.network == "ip6" {
+		proto = protocolICMPv6
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := t.icmp.ReadFrom(buf)
+		if err != nil {
+			// The socket was closed.
+			return
+		}
+		m, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		key, ok := t.replyKey(m)
+		if !ok {
+			continue
+		}
+
+		addr := peer.String()
+		if ipAddr, isIP := peer.(*net.IPAddr); isIP {
+			addr = ipAddr.IP.String()
+		}
+		t.record(key, addr, addr == t.dst.String())
+	}
+}
+
+// replyKey returns the key of the probe an ICMP message is a reply to. ok
+// is false if the message is not a reply to one of our probes.
+func (t *tracer) replyKey(m *icmp.Message) (key int, ok bool) {
+	switch body := m.Body.(type) {
+	case *icmp.Echo:
+		if t.mode != tracerouteICMP || body.ID != t.id ||
+			(m.Type != ipv4.ICMPTypeEchoReply && m.Type != ipv6.ICMPTypeEchoReply) {
+			return 0, false
+		}
+		return body.Seq, true
+	case *icmp.TimeExceeded:
+		return t.quotedKey(body.Data)
+	case *icmp.DstUnreach:
+		return t.quotedKey(body.Data)
+	}
+	return 0, false
+}
+
+// quotedKey extracts the probe key from the original datagram quoted in an
+// ICMP error.
+func (t *tracer) quotedKey(data []byte) (int, bool) {
+	proto, payload, ok := quotedDatagram(t.network, data)
+	if !ok {
+		return 0, false
+	}
+
+	switch {
+	case t.mode == tracerouteUDP && proto == syscall.IPPROTO_UDP:
+		return int(binary.BigEndian.Uint16(payload[2:4])) - tracerouteUDPBasePort, true
+	case t.mode == tracerouteTCP && proto == syscall.IPPROTO_TCP:
+		return int(binary.BigEndian.Uint16(payload[0:2])) - tracerouteTCPBasePort, true
+	case t.mode == tracerouteICMP && (proto == protocolICMP || proto == protocolICMPv6):
+		if int(binary.BigEndian.Uint16(payload[4:6])) != t.id {
+			return 0, false
+		}
+		return int(binary.BigEndian.Uint16(payload[6:8])), true
+	}
+	return 0, false
+}
+
+// quotedDatagram returns the protocol and the first bytes of the payload of
+// the original datagram quoted in an ICMP error. At least 8 bytes of the
+// payload are available if ok is true.
+func quotedDatagram(network string, data []byte) (proto int, payload []byte, ok bool) {
+	if network == "ip6" {
+		if len(data) < 40 {
+			return 0, nil, false
+		}
+		proto, payload = int(data[6]), data[40:]
+	} else {
+		if len(data) < 20 {
+			return 0, nil, false
+		}
+		hdrLen := int(data[0]&0x0f) * 4
+		if len(data) < hdrLen {
+			return 0, nil, false
+		}
+		proto, payload = int(data[9]), data[hdrLen:]
+	}
+	if len(payload) < 8 {
+		return 0, nil, false
+	}
+	return proto, payload, true
+}
+
+func (t *tracer) record(key int, addr string, reached bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	probe, ok := t.pending[key]
+	if !ok {
+		return
+	}
+	delete(t.pending, key)
+
+	rtt := time.Since(probe.sent)
+	if rtt > tracerouteTimeout {
+		return
+	}
+
+	hop := t.hops[probe.ttl-1]
+	hop.rtts = append(hop.rtts, rtt)
+	hop.addresses[addr] = struct{}{}
+
+	if reached && (t.reachedAt == 0 || probe.ttl < t.reachedAt) {
+		t.reachedAt = probe.ttl
+		t.lastHop = probe.ttl
+	}
+}
+
+func (t *tracer) result(host string, cycles int) *tracerouteResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r := &tracerouteResult{
+		Host:    host,
+		Address: t.dst.String(),
+		Mode:    t.mode,
+		Cycles:  cycles,
+		Reached: t.reachedAt > 0,
+	}
+	for _, hop := range t.hops[:t.lastHop] {
+		hop.summarize()
+		r.Hops = append(r.Hops, hop)
+	}
+	return r
+}
+
+func (h *tracerouteHop) summarize() {
+	h.Addresses = []string{}
+	for addr := range h.addresses {
+		h.Addresses = append(h.Addresses, addr)
+	}
+	sort.Strings(h.Addresses)
+
+	h.Received = len(h.rtts)
+	if h.Sent > 0 {
+		h.Loss = 100 * float64(h.Sent-h.Received) / float64(h.Sent)
+	}
+	if h.Received == 0 {
+		return
+	}
+
+	var sum float64
+	h.BestMS = math.Inf(1)
+	for _, rtt := range h.rtts {
+		ms := durationMS(rtt)
+		sum += ms
+		h.BestMS = math.Min(h.BestMS, ms)
+		h.WorstMS = math.Max(h.WorstMS, ms)
+	}
+	h.AvgMS = sum / float64(h.Received)
+	var variance float64
+	for _, rtt := range h.rtts {
+		d := durationMS(rtt) - h.AvgMS
+		variance += d * d
+	}
+	h.StdDevMS = math.Sqrt(variance / float64(h.Received))
+}
+
+func durationMS(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
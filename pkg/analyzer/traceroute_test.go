@@ -0,0 +1,321 @@
+package analyzer
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+func newTestTracer(mode, network string) *tracer {
+	t := &tracer{
+		mode:    mode,
+		network: network,
+		dst:     net.ParseIP("192.0.2.1"),
+		id:      0x1234,
+		pending: map[int]tracerouteProbe{},
+		lastHop: tracerouteMaxHops,
+	}
+	for ttl := 1; ttl <= tracerouteMaxHops; ttl++ {
+		t.hops = append(t.hops, &tracerouteHop{TTL: ttl, addresses: map[string]struct{}{}})
+	}
+	return t
+}
+
+// sent records a probe as if it had been sent rtt ago.
+func (t *tracer) sent(ttl, key int, rtt time.Duration) {
+	t.pending[key] = tracerouteProbe{ttl: ttl, sent: time.Now().Add(-rtt)}
+	t.hops[ttl-1].Sent++
+}
+
+func TestTracerouteHopAggregation(t *testing.T) {
+	tr := newTestTracer(tracerouteUDP, "ip4")
+
+	tr.sent(1, 0, 10*time.Millisecond)
+	tr.sent(2, 1, 20*time.Millisecond)
+	tr.sent(3, 2, 30*time.Millisecond)
+	tr.sent(1, 3, 30*time.Millisecond)
+	tr.sent(2, 4, 20*time.Millisecond)
+	tr.sent(3, 5, 30*time.Millisecond)
+	// A reply that arrives after the timeout counts as lost.
+	tr.sent(1, 6, 2*tracerouteTimeout)
+
+	tr.record(0, "198.51.100.1", false)
+	tr.record(1, "198.51.100.2", false)
+	tr.record(2, "192.0.2.1", true)
+	tr.record(3, "198.51.100.1", false)
+	tr.record(4, "198.51.100.3", false)
+	tr.record(6, "198.51.100.1", false)
+	// Duplicate and unknown replies are ignored.
+	tr.record(0, "198.51.100.1", false)
+	tr.record(99, "198.51.100.9", false)
+
+	r := tr.result("example.com", 2)
+	if !r.Reached {
+		t.Error("Reached = false, want true")
+	}
+	if len(r.Hops) != 3 {
+		t.Fatalf("got %d hops, want 3", len(r.Hops))
+	}
+
+	h := r.Hops[0]
+	if h.Sent != 3 || h.Received != 2 {
+		t.Errorf("hop 1 sent %d and received %d, want 3 and 2", h.Sent, h.Received)
+	}
+	if want := 100.0 / 3; h.Loss < want-0.01 || h.Loss > want+0.01 {
+		t.Errorf("hop 1 loss = %f, want %f", h.Loss, want)
+	}
+	if !reflect.DeepEqual(h.Addresses, []string{"198.51.100.1"}) {
+		t.Errorf("hop 1 addresses = %v", h.Addresses)
+	}
+	if h.BestMS < 10 || h.BestMS >= 20 || h.WorstMS < 30 || h.WorstMS >= 40 {
+		t.Errorf("hop 1 best %f and worst %f, want about 10 and 30", h.BestMS, h.WorstMS)
+	}
+	if h.AvgMS < h.BestMS || h.AvgMS > h.WorstMS {
+		t.Errorf("hop 1 avg %f is outside [%f, %f]", h.AvgMS, h.BestMS, h.WorstMS)
+	}
+	if h.StdDevMS < 9 || h.StdDevMS > 11 {
+		t.Errorf("hop 1 stddev = %f, want about 10", h.StdDevMS)
+	}
+
+	h = r.Hops[1]
+	if !reflect.DeepEqual(h.Addresses, []string{"198.51.100.2", "198.51.100.3"}) {
+		t.Errorf("hop 2 addresses = %v", h.Addresses)
+	}
+	if h.Loss != 0 {
+		t.Errorf("hop 2 loss = %f, want 0", h.Loss)
+	}
+
+	h = r.Hops[2]
+	if h.Sent != 2 || h.Received != 1 || h.Loss != 50 {
+		t.Errorf("hop 3 sent %d, received %d, loss %f", h.Sent, h.Received, h.Loss)
+	}
+}
+
+func TestTracerouteUnreachedHop(t *testing.T) {
+	tr := newTestTracer(tracerouteICMP, "ip4")
+	tr.sent(1, 0, time.Millisecond)
+
+	r := tr.result("example.com", 1)
+	if r.Reached {
+		t.Error("Reached = true, want false")
+	}
+	if len(r.Hops) != tracerouteMaxHops {
+		t.Fatalf("got %d hops, want %d", len(r.Hops), tracerouteMaxHops)
+	}
+	h := r.Hops[0]
+	if h.Loss != 100 || h.Received != 0 || h.BestMS != 0 {
+		t.Errorf("hop 1 = %+v, want total loss", h)
+	}
+	if h.Addresses == nil {
+		t.Error("Addresses is nil, want an empty list for JSON")
+	}
+	if r.Hops[1].Loss != 0 {
+		t.Errorf("hop 2 without probes has loss %f, want 0", r.Hops[1].Loss)
+	}
+}
+
+// quotedIPv4 returns an IPv4 header for proto followed by payload, as an
+// ICMP error quotes it.
+func quotedIPv4(proto byte, payload []byte) []byte {
+	b := make([]byte, 20)
+	b[0] = 0x45
+	b[9] = proto
+	return append(b, payload...)
+}
+
+func quotedIPv6(proto byte, payload []byte) []byte {
+	b := make([]byte, 40)
+	b[0] = 0x60
+	b[6] = proto
+	return append(b, payload...)
+}
+
+func udpHeader(dstPort int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint16(b[0:2], 50000)
+	binary.BigEndian.PutUint16(b[2:4], uint16(dstPort))
+	return b
+}
+
+func tcpHeader(srcPort int) []byte {
+	b := make([]byte, 20)
+	binary.BigEndian.PutUint16(b[0:2], uint16(srcPort))
+	binary.BigEndian.PutUint16(b[2:4], tracerouteTCPPort)
+	return b
+}
+
+func echoHeader(id, seq int) []byte {
+	b := make([]byte, 8)
+	b[0] = 8
+	binary.BigEndian.PutUint16(b[4:6], uint16(id))
+	binary.BigEndian.PutUint16(b[6:8], uint16(seq))
+	return b
+}
+
+func TestTracerouteReplyKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		network string
+		msg     *icmp.Message
+		key     int
+		ok      bool
+	}{
+		{
+			name:    "UDP time exceeded",
+			mode:    tracerouteUDP,
+			network: "ip4",
+			msg: &icmp.Message{
+				Type: ipv4.ICMPTypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Data: quotedIPv4(17, udpHeader(tracerouteUDPBasePort+42))},
+			},
+			key: 42,
+			ok:  true,
+		},
+		{
+			name:    "UDP port unreachable",
+			mode:    tracerouteUDP,
+			network: "ip4",
+			msg: &icmp.Message{
+				Type: ipv4.ICMPTypeDestinationUnreachable,
+				Body: &icmp.DstUnreach{Data: quotedIPv4(17, udpHeader(tracerouteUDPBasePort+7))},
+			},
+			key: 7,
+			ok:  true,
+		},
+		{
+			name:    "TCP time exceeded over IPv6",
+			mode:    tracerouteTCP,
+			network: "ip6",
+			msg: &icmp.Message{
+				Type: ipv6.ICMPTypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Data: quotedIPv6(6, tcpHeader(tracerouteTCPBasePort+3))},
+			},
+			key: 3,
+			ok:  true,
+		},
+		{
+			name:    "ICMP time exceeded",
+			mode:    tracerouteICMP,
+			network: "ip4",
+			msg: &icmp.Message{
+				Type: ipv4.ICMPTypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Data: quotedIPv4(1, echoHeader(0x1234, 9))},
+			},
+			key: 9,
+			ok:  true,
+		},
+		{
+			name:    "ICMP time exceeded for another process",
+			mode:    tracerouteICMP,
+			network: "ip4",
+			msg: &icmp.Message{
+				Type: ipv4.ICMPTypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Data: quotedIPv4(1, echoHeader(0x4321, 9))},
+			},
+		},
+		{
+			name:    "echo reply",
+			mode:    tracerouteICMP,
+			network: "ip4",
+			msg: &icmp.Message{
+				Type: ipv4.ICMPTypeEchoReply,
+				Body: &icmp.Echo{ID: 0x1234, Seq: 11},
+			},
+			key: 11,
+			ok:  true,
+		},
+		{
+			name:    "IPv6 echo reply",
+			mode:    tracerouteICMP,
+			network: "ip6",
+			msg: &icmp.Message{
+				Type: ipv6.ICMPTypeEchoReply,
+				Body: &icmp.Echo{ID: 0x1234, Seq: 12},
+			},
+			key: 12,
+			ok:  true,
+		},
+		{
+			name:    "echo request",
+			mode:    tracerouteICMP,
+			network: "ip4",
+			msg: &icmp.Message{
+				Type: ipv4.ICMPTypeEcho,
+				Body: &icmp.Echo{ID: 0x1234, Seq: 11},
+			},
+		},
+		{
+			name:    "echo reply in UDP mode",
+			mode:    tracerouteUDP,
+			network: "ip4",
+			msg: &icmp.Message{
+				Type: ipv4.ICMPTypeEchoReply,
+				Body: &icmp.Echo{ID: 0x1234, Seq: 11},
+			},
+		},
+		{
+			name:    "TCP quoted in UDP mode",
+			mode:    tracerouteUDP,
+			network: "ip4",
+			msg: &icmp.Message{
+				Type: ipv4.ICMPTypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Data: quotedIPv4(6, tcpHeader(tracerouteTCPBasePort+3))},
+			},
+		},
+		{
+			name:    "truncated quote",
+			mode:    tracerouteUDP,
+			network: "ip4",
+			msg: &icmp.Message{
+				Type: ipv4.ICMPTypeTimeExceeded,
+				Body: &icmp.TimeExceeded{Data: quotedIPv4(17, udpHeader(tracerouteUDPBasePort)[:4])},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tr := newTestTracer(test.mode, test.network)
+			key, ok := tr.replyKey(test.msg)
+			if ok != test.ok || key != test.key {
+				t.Errorf("replyKey = %d, %t, want %d, %t", key, ok, test.key, test.ok)
+			}
+		})
+	}
+}
+
+func TestQuotedDatagramIPv4Options(t *testing.T) {
+	// A header with options is 24 bytes long.
+	b := make([]byte, 24)
+	b[0] = 0x46
+	b[9] = 17
+	b = append(b, udpHeader(1234)...)
+	proto, payload, ok := quotedDatagram("ip4", b)
+	if !ok || proto != 17 || binary.BigEndian.Uint16(payload[2:4]) != 1234 {
+		t.Errorf("quotedDatagram = %d, %x, %t", proto, payload, ok)
+	}
+}
+
+func TestTracerouteTaskTimeout(t *testing.T) {
+	a := &analyzer{tracerouteCycles: defaultTracerouteCycles}
+	task := a.createTracerouteTask("example.com-traceroute-udp-ipv4.json", "udp", "ip4", "example.com")
+	if task.timeout != 0 {
+		t.Errorf("the default cycles have the timeout %s", task.timeout)
+	}
+	if want := "Traces the route to example.com over IPv4 using 10 cycles of UDP probes"; task.description != want {
+		t.Errorf("description = %q", task.description)
+	}
+
+	// Several minutes of cycles get their own timeout.
+	a.tracerouteCycles = 300
+	task = a.createTracerouteTask("example.com-traceroute-udp-ipv4.json", "udp", "ip4", "example.com")
+	if task.timeout != 304*time.Second {
+		t.Errorf("300 cycles have the timeout %s", task.timeout)
+	}
+}
@@ -0,0 +1,127 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// untruncatedFiles are written by the analyzer from the collected data
+// rather than by a task, so the limit does not apply to them. Nor does it
+// apply to packet captures, which truncation would corrupt.
+var untruncatedFiles = map[string]bool{
+	"findings.json":  true,
+	"findings.txt":   true,
+	"report.json":    true,
+	"cdn-edges.json": true,
+	"summary.html":   true,
+	"errors.txt":     true,
+	"errors.json":    true,
+	"run.log":        true,
+	"manifest.json":  true,
+}
+
+// truncateTaskOutput applies the limit to the contents of a file a task
+// stores.
+func truncateTaskOutput(name string, contents []byte, limit int64) []byte {
+	if untruncatedFiles[name] || strings.HasSuffix(name, ".pcap") {
+		return contents
+	}
+	return truncateMiddle(contents, limit)
+}
+
+// defaultMaxTaskOutput is the most output a task may store in a file unless
+// --max-task-output is given.
+const defaultMaxTaskOutput = 64 << 20
+
+// maxMarkerLen is the length of the longest truncation marker. The marker
+// counts towards the limit so that truncated output is at most the limit
+// and truncating it again leaves it unchanged.
+var maxMarkerLen = int64(len(fmt.Sprintf(truncationMarker, int64(math.MaxInt64))))
+
+const truncationMarker = "\n\n[... %d bytes truncated ...]\n\n"
+
+// keptHalf returns how many bytes are kept from each end of output that
+// is truncated to limit.
+func keptHalf(limit int64) int64 {
+	return max((limit-maxMarkerLen)/2, 0)
+}
+
+// truncateMiddle returns b with its middle replaced by a marker if it is
+// longer than limit, keeping as much of the start and end as fits. A limit
+// of zero means no limit.
+func truncateMiddle(b []byte, limit int64) []byte {
+	if limit <= 0 || int64(len(b)) <= limit {
+		return b
+	}
+	half := keptHalf(limit)
+	head, tail := b[:half], b[int64(len(b))-half:]
+	return joinTruncated(head, tail, int64(len(b))-2*half)
+}
+
+func joinTruncated(head, tail []byte, dropped int64) []byte {
+	marker := fmt.Sprintf(truncationMarker, dropped)
+	out := make([]byte, 0, len(head)+len(marker)+len(tail))
+	out = append(out, head...)
+	out = append(out, marker...)
+	return append(out, tail...)
+}
+
+// cappedBuffer is an io.Writer that keeps only what truncateMiddle would
+// of what is written to it so that a runaway command cannot fill memory.
+// A limit of zero means no limit.
+type cappedBuffer struct {
+	limit int64
+	// buf holds everything written until the limit is exceeded and the
+	// start of it afterwards.
+	buf []byte
+	// tail is a ring buffer of the last bytes written once the limit is
+	// exceeded, and next is the index in it of the oldest byte.
+	tail    []byte
+	next    int
+	written int64
+}
+
+func newCappedBuffer(limit int64) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	c.written += int64(n)
+	if c.limit <= 0 || c.tail == nil && int64(len(c.buf)+n) <= c.limit {
+		c.buf = append(c.buf, p...)
+		return n, nil
+	}
+	half := int(keptHalf(c.limit))
+	if c.tail == nil {
+		all := append(c.buf, p...)
+		c.buf = append([]byte(nil), all[:half]...)
+		c.tail = make([]byte, 0, half)
+		p = all[half:]
+	}
+	if half == 0 {
+		return n, nil
+	}
+	for len(p) > 0 {
+		if len(c.tail) < half {
+			take := min(half-len(c.tail), len(p))
+			c.tail = append(c.tail, p[:take]...)
+			p = p[take:]
+			continue
+		}
+		copied := copy(c.tail[c.next:], p)
+		p = p[copied:]
+		c.next = (c.next + copied) % half
+	}
+	return n, nil
+}
+
+// Bytes returns what was kept, with a marker where bytes were dropped.
+func (c *cappedBuffer) Bytes() []byte {
+	if c.tail == nil {
+		return c.buf
+	}
+	tail := append(append([]byte{}, c.tail[c.next:]...), c.tail[:c.next]...)
+	return joinTruncated(c.buf, tail, c.written-int64(len(c.buf)+len(tail)))
+}
@@ -0,0 +1,126 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// testOutput returns n bytes of text in which every position is
+// distinguishable, so that a misplaced byte changes the comparison.
+func testOutput(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < n; i++ {
+		fmt.Fprintf(&b, "%d,", i)
+	}
+	return b.Bytes()[:n]
+}
+
+// writeChunks writes b to w in chunks of size, or all at once if size is
+// zero.
+func writeChunks(t *testing.T, w interface{ Write([]byte) (int, error) }, b []byte, size int) {
+	t.Helper()
+	if size == 0 {
+		size = max(len(b), 1)
+	}
+	for len(b) > 0 {
+		n := min(size, len(b))
+		written, err := w.Write(b[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if written != n {
+			t.Fatalf("wrote %d bytes, want %d", written, n)
+		}
+		b = b[n:]
+	}
+}
+
+// truncationLimits are the limits the truncating writers are tested with:
+// none, smaller than the marker, at and around the marker length, and
+// large enough to keep some of each end.
+func truncationLimits() []int64 {
+	return []int64{0, 1, 2, maxMarkerLen - 1, maxMarkerLen, maxMarkerLen + 1, maxMarkerLen + 2, 100, 101, 1000}
+}
+
+func TestCappedBufferMatchesTruncateMiddle(t *testing.T) {
+	for _, limit := range truncationLimits() {
+		for _, size := range []int{0, 1, 2, 5, 64, 99, 100, 101, 150, 1000, 2500} {
+			// Chunks of 1 and 7 bytes straddle the boundary between the
+			// start that is kept and the ring of the end. Chunks of
+			// exactly the kept half and larger than the buffer also
+			// cross it in one write.
+			for _, chunk := range []int{0, 1, 7, int(keptHalf(limit)), int(keptHalf(limit)) + 1, 3 * int(limit)} {
+				input := testOutput(size)
+				c := newCappedBuffer(limit)
+				writeChunks(t, c, input, chunk)
+				want := truncateMiddle(input, limit)
+				if got := c.Bytes(); !bytes.Equal(got, want) {
+					t.Errorf("limit %d, size %d, chunks of %d:\ngot  %q\nwant %q", limit, size, chunk, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCappedBufferAtLimit(t *testing.T) {
+	const limit = 100
+	input := testOutput(limit)
+	c := newCappedBuffer(limit)
+	writeChunks(t, c, input, 33)
+	if got := c.Bytes(); !bytes.Equal(got, input) {
+		t.Errorf("output exactly at the limit was changed to %q", got)
+	}
+
+	// One more byte truncates it.
+	if _, err := c.Write([]byte("!")); err != nil {
+		t.Fatal(err)
+	}
+	got := c.Bytes()
+	if int64(len(got)) > limit {
+		t.Errorf("output is %d bytes, over the limit of %d", len(got), limit)
+	}
+	if want := truncateMiddle(append(input, '!'), limit); !bytes.Equal(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	if !bytes.HasSuffix(got, []byte("!")) {
+		t.Errorf("the last byte written was not kept: %q", got)
+	}
+}
+
+func TestCappedBufferIsBounded(t *testing.T) {
+	const limit = 1000
+	c := newCappedBuffer(limit)
+	chunk := testOutput(4096)
+	for range 1000 {
+		if _, err := c.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := cap(c.buf) + cap(c.tail); got > 2*limit {
+		t.Errorf("the buffer holds %d bytes after 4 MB were written", got)
+	}
+	if got := c.Bytes(); int64(len(got)) > limit {
+		t.Errorf("output is %d bytes, over the limit of %d", len(got), limit)
+	}
+	if !bytes.Contains(c.Bytes(), []byte(fmt.Sprintf("[... %d bytes truncated ...]", 4096*1000-2*keptHalf(limit)))) {
+		t.Errorf("the marker does not count the dropped bytes: %q", c.Bytes())
+	}
+}
+
+func TestTruncateTaskOutput(t *testing.T) {
+	big := testOutput(1000)
+	if got := truncateTaskOutput("dig.txt", big, 100); int64(len(got)) > 100 {
+		t.Errorf("task output was not truncated: %d bytes", len(got))
+	}
+	for _, name := range []string{"manifest.json", "capture.pcap"} {
+		if got := truncateTaskOutput(name, big, 100); !bytes.Equal(got, big) {
+			t.Errorf("%s was truncated", name)
+		}
+	}
+	// Truncating again leaves the output unchanged.
+	once := truncateMiddle(big, 100)
+	if twice := truncateMiddle(once, 100); !bytes.Equal(once, twice) {
+		t.Errorf("truncating twice gave %q, want %q", twice, once)
+	}
+}
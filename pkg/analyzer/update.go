@@ -0,0 +1,399 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	latestReleaseURL = "https://api.github.com/repos/maxmind/mm-network-analyzer/releases/latest"
+	// checksumsAsset is the release asset with the SHA-256 checksum of
+	// each archive. .goreleaser.yml names it.
+	checksumsAsset = "checksums.txt"
+	// signatureAsset is the Ed25519 signature of checksumsAsset, made by
+	// the signs section of .goreleaser.yml.
+	signatureAsset = checksumsAsset + ".sig"
+	updateTimeout  = 5 * time.Minute
+	// maxReleaseArchive bounds the download of a release archive.
+	maxReleaseArchive = 100 << 20
+)
+
+// releaseSigningKey is the base64-encoded Ed25519 public key that
+// checksums.txt is signed with. Like version, it is set at build time with
+// -ldflags, and .goreleaser.yml sets it. Builds without it cannot update
+// themselves, as the download could not be verified.
+var releaseSigningKey = ""
+
+// release is the part of a GitHub release the update command uses.
+type release struct {
+	TagName string         `json:"tag_name"`
+	HTMLURL string         `json:"html_url"`
+	Assets  []releaseAsset `json:"assets"`
+}
+
+type releaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// runUpdate implements the update command, which replaces the running
+// binary with the latest release for its platform.
+func runUpdate(args []string) int {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s update [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	check := fs.Bool("check", false, "Only report whether a newer release is available")
+	force := fs.Bool(
+		"force",
+		false,
+		"Install the latest release even if it is not newer, e.g., over a development build",
+	)
+	releaseURL := fs.String("release-url", latestReleaseURL, "GitHub API URL of the release to install")
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	client := &http.Client{Timeout: updateTimeout}
+	r, err := latestRelease(client, *releaseURL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUpdateFailed
+	}
+	current := currentBuild().Version
+	latest := strings.TrimPrefix(r.TagName, "v")
+	newer := newerVersion(latest, current)
+	if !newer && !*force {
+		fmt.Printf("mm-network-analyzer %s is up to date; the latest release is %s\n", current, latest)
+		return exitOK
+	}
+	if *check {
+		fmt.Printf("mm-network-analyzer %s is available (running %s): %s\n", latest, current, r.HTMLURL)
+		return exitOK
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, errors.Wrap(err, "error finding the running binary"))
+		return exitUpdateFailed
+	}
+	if err := installRelease(client, r, exe); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUpdateFailed
+	}
+	fmt.Printf("Updated %s from %s to %s\n", exe, current, latest)
+	return exitOK
+}
+
+func latestRelease(client *http.Client, url string) (*release, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating release request")
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", os.Args[0])
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting the latest release")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("getting the latest release failed with %s", resp.Status)
+	}
+	var r release
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, errors.Wrap(err, "error decoding the latest release")
+	}
+	if r.TagName == "" {
+		return nil, errors.New("the latest release has no tag")
+	}
+	return &r, nil
+}
+
+// newerVersion reports whether latest is a later version than current.
+// Versions are compared by their dot-separated numbers, ignoring any
+// pre-release suffix. Development builds are never older.
+func newerVersion(latest, current string) bool {
+	l, ok := versionNumbers(latest)
+	if !ok {
+		return false
+	}
+	c, ok := versionNumbers(strings.TrimPrefix(current, "v"))
+	if !ok {
+		return false
+	}
+	for i := 0; i < len(l) || i < len(c); i++ {
+		var a, b int
+		if i < len(l) {
+			a = l[i]
+		}
+		if i < len(c) {
+			b = c[i]
+		}
+		if a != b {
+			return a > b
+		}
+	}
+	return false
+}
+
+func versionNumbers(v string) ([]int, bool) {
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var nums []int
+	for _, part := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, false
+		}
+		nums = append(nums, n)
+	}
+	return nums, true
+}
+
+// releaseArchiveName returns the suffix of the name goreleaser gives the
+// archive for this platform, following the replacements in
+// .goreleaser.yml.
+func releaseArchiveName() string {
+	goos := runtime.GOOS
+	switch goos {
+	case "darwin":
+		goos = "Darwin"
+	case "linux":
+		goos = "Linux"
+	}
+	goarch := runtime.GOARCH
+	switch goarch {
+	case "386":
+		goarch = "i386"
+	case "amd64":
+		goarch = "x86_64"
+	}
+	return "_" + goos + "_" + goarch
+}
+
+// installRelease downloads the release's archive for this platform,
+// checks it against the release's signed checksums, and replaces exe with
+// the binary in it.
+func installRelease(client *http.Client, r *release, exe string) error {
+	key, err := releasePublicKey()
+	if err != nil {
+		return err
+	}
+	suffix := releaseArchiveName()
+	var archive, checksums, signature *releaseAsset
+	for i, a := range r.Assets {
+		switch {
+		case a.Name == checksumsAsset:
+			checksums = &r.Assets[i]
+		case a.Name == signatureAsset:
+			signature = &r.Assets[i]
+		case strings.HasSuffix(a.Name, suffix+".tar.gz") || strings.HasSuffix(a.Name, suffix+".zip"):
+			archive = &r.Assets[i]
+		}
+	}
+	if archive == nil {
+		return errors.Errorf("release %s has no archive for %s/%s", r.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	if checksums == nil {
+		return errors.Errorf("release %s has no %s to verify the download with", r.TagName, checksumsAsset)
+	}
+
+	if signature == nil {
+		return errors.Errorf("release %s has no %s to verify %s with", r.TagName, signatureAsset, checksumsAsset)
+	}
+
+	sums, err := fetchReleaseAsset(client, checksums.URL, 1<<20)
+	if err != nil {
+		return err
+	}
+	sig, err := fetchReleaseAsset(client, signature.URL, 1<<10)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, sums, sig) {
+		return errors.Errorf("the signature of %s in release %s is not valid", checksumsAsset, r.TagName)
+	}
+	want, err := assetChecksum(sums, archive.Name)
+	if err != nil {
+		return err
+	}
+	b, err := fetchReleaseAsset(client, archive.URL, maxReleaseArchive)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(b)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return errors.Errorf("checksum of %s is %s, but %s lists %s", archive.Name, got, checksumsAsset, want)
+	}
+
+	bin, err := extractBinary(archive.Name, b)
+	if err != nil {
+		return err
+	}
+	return replaceBinary(exe, bin)
+}
+
+// releasePublicKey returns the key releases are signed with.
+func releasePublicKey() (ed25519.PublicKey, error) {
+	if releaseSigningKey == "" {
+		return nil, errors.New(
+			"this build has no release signing key to verify the download with; " +
+				"install the release from GitHub instead",
+		)
+	}
+	key, err := base64.StdEncoding.DecodeString(releaseSigningKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.Errorf("invalid release signing key %q", releaseSigningKey)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func fetchReleaseAsset(client *http.Client, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating request for %s", url)
+	}
+	req.Header.Set("User-Agent", os.Args[0])
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s", url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("downloading %s failed with %s", url, resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error downloading %s", url)
+	}
+	if int64(len(b)) > limit {
+		return nil, errors.Errorf("%s is larger than %d bytes", url, limit)
+	}
+	return b, nil
+}
+
+// assetChecksum returns the checksum of name from a sha256sum-style list.
+func assetChecksum(sums []byte, name string) (string, error) {
+	s := bufio.NewScanner(bytes.NewReader(sums))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", errors.Errorf("%s has no checksum for %s", checksumsAsset, name)
+}
+
+// extractBinary returns the mm-network-analyzer binary from the release
+// archive named name.
+func extractBinary(name string, b []byte) ([]byte, error) {
+	binary := "mm-network-analyzer"
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+	if strings.HasSuffix(name, ".zip") {
+		zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", name)
+		}
+		for _, f := range zr.File {
+			if path.Base(f.Name) != binary || f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, errors.Wrapf(err, "error reading %s from %s", f.Name, name)
+			}
+			defer rc.Close()
+			bin, err := io.ReadAll(io.LimitReader(rc, maxReleaseArchive))
+			return bin, errors.Wrapf(err, "error reading %s from %s", f.Name, name)
+		}
+		return nil, errors.Errorf("%s does not contain %s", name, binary)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", name)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, errors.Errorf("%s does not contain %s", name, binary)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", name)
+		}
+		if hdr.Typeflag != tar.TypeReg || path.Base(hdr.Name) != binary {
+			continue
+		}
+		bin, err := io.ReadAll(io.LimitReader(tr, maxReleaseArchive))
+		return bin, errors.Wrapf(err, "error reading %s from %s", hdr.Name, name)
+	}
+}
+
+// replaceBinary writes bin next to exe and renames it over exe. Windows
+// does not allow a running binary to be replaced, but does allow it to be
+// renamed, so there the old binary is first moved aside to exe.old.
+func replaceBinary(exe string, bin []byte) error {
+	dir := filepath.Dir(exe)
+	f, err := os.CreateTemp(dir, ".mm-network-analyzer-update-*")
+	if err != nil {
+		return errors.Wrapf(err, "error creating the new binary in %s", dir)
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // nolint: errcheck
+	if _, err := f.Write(bin); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "error writing the new binary")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "error writing the new binary")
+	}
+	if err := os.Chmod(tmp, 0o755); err != nil { // nolint: gosec
+		return errors.Wrap(err, "error making the new binary executable")
+	}
+
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return errors.Wrapf(err, "error moving %s aside", exe)
+		}
+		if err := os.Rename(tmp, exe); err != nil {
+			_ = os.Rename(old, exe)
+			return errors.Wrapf(err, "error replacing %s", exe)
+		}
+		return nil
+	}
+	return errors.Wrapf(os.Rename(tmp, exe), "error replacing %s", exe)
+}
@@ -0,0 +1,278 @@
+package analyzer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"1.2.0", "1.1.0", true},
+		{"1.10.0", "1.9.0", true},
+		{"1.1.1", "v1.1.0", true},
+		{"1.1", "1.1.0", false},
+		{"1.1.0", "1.1.0", false},
+		{"1.0.9", "1.1.0", false},
+		{"2.0.0-rc1", "1.9.9", true},
+		{"1.2.0", "dev", false},
+		{"not a version", "1.0.0", false},
+	}
+	for _, test := range tests {
+		if got := newerVersion(test.latest, test.current); got != test.want {
+			t.Errorf("newerVersion(%q, %q) = %t", test.latest, test.current, got)
+		}
+	}
+}
+
+func TestAssetChecksum(t *testing.T) {
+	sums := []byte("ABC123  mm-network-analyzer_1.2.0_Linux_x86_64.tar.gz\n" +
+		"def456 *mm-network-analyzer_1.2.0_Windows_x86_64.zip\n")
+	for name, want := range map[string]string{
+		"mm-network-analyzer_1.2.0_Linux_x86_64.tar.gz": "abc123",
+		"mm-network-analyzer_1.2.0_Windows_x86_64.zip":  "def456",
+	} {
+		if got, err := assetChecksum(sums, name); err != nil || got != want {
+			t.Errorf("assetChecksum(%q) = %q, %v", name, got, err)
+		}
+	}
+	if _, err := assetChecksum(sums, "mm-network-analyzer_1.2.0_Darwin_x86_64.tar.gz"); err == nil {
+		t.Error("found a checksum for an archive that is not listed")
+	}
+}
+
+// releaseBinaryName is the name of the binary in a release archive for
+// this platform.
+func releaseBinaryName() string {
+	if runtime.GOOS == "windows" {
+		return "mm-network-analyzer.exe"
+	}
+	return "mm-network-analyzer"
+}
+
+// testReleaseArchive returns a tar.gz or zip archive, depending on name,
+// with the given files in a directory.
+func testReleaseArchive(t *testing.T, name string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if strings.HasSuffix(name, ".zip") {
+		zw := zip.NewWriter(&buf)
+		for file, contents := range files {
+			w, err := zw.Create("mm-network-analyzer_1.2.0/" + file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write([]byte(contents)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for file, contents := range files {
+		hdr := &tar.Header{Name: "mm-network-analyzer_1.2.0/" + file, Mode: 0o755, Size: int64(len(contents))}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractBinary(t *testing.T) {
+	files := map[string]string{"README.md": "readme", releaseBinaryName(): "new binary"}
+	for _, name := range []string{"release.tar.gz", "release.zip"} {
+		bin, err := extractBinary(name, testReleaseArchive(t, name, files))
+		if err != nil || string(bin) != "new binary" {
+			t.Errorf("%s: extracted %q, %v", name, bin, err)
+		}
+		empty := testReleaseArchive(t, name, map[string]string{"README.md": "readme"})
+		if _, err := extractBinary(name, empty); err == nil {
+			t.Errorf("%s: extracted a binary from an archive without one", name)
+		}
+	}
+	if _, err := extractBinary("release.tar.gz", []byte("not gzip")); err == nil {
+		t.Error("extracted a binary from an invalid archive")
+	}
+}
+
+// testRelease serves a signed release with an archive for this platform.
+type testRelease struct {
+	server  *httptest.Server
+	release *release
+	assets  map[string][]byte
+	key     ed25519.PrivateKey
+}
+
+func newTestRelease(t *testing.T) *testRelease {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := releaseSigningKey
+	releaseSigningKey = base64.StdEncoding.EncodeToString(pub)
+	t.Cleanup(func() { releaseSigningKey = old })
+
+	ext := ".tar.gz"
+	if runtime.GOOS == "windows" {
+		ext = ".zip"
+	}
+	archiveName := "mm-network-analyzer_1.2.0" + releaseArchiveName() + ext
+	archive := testReleaseArchive(t, archiveName, map[string]string{releaseBinaryName(): "new binary"})
+	sum := sha256.Sum256(archive)
+	sums := []byte(hex.EncodeToString(sum[:]) + "  " + archiveName + "\n")
+
+	r := &testRelease{
+		assets: map[string][]byte{
+			archiveName:    archive,
+			checksumsAsset: sums,
+			signatureAsset: ed25519.Sign(key, sums),
+		},
+		key: key,
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/latest" {
+			_ = json.NewEncoder(w).Encode(r.release)
+			return
+		}
+		b, ok := r.assets[strings.TrimPrefix(req.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		_, _ = w.Write(b)
+	}))
+	t.Cleanup(r.server.Close)
+
+	r.release = &release{TagName: "v1.2.0"}
+	for name := range r.assets {
+		r.release.Assets = append(r.release.Assets, releaseAsset{Name: name, URL: r.server.URL + "/" + name})
+	}
+	return r
+}
+
+// testExecutable writes a stand-in for the running binary.
+func testExecutable(t *testing.T) string {
+	t.Helper()
+	exe := filepath.Join(t.TempDir(), releaseBinaryName())
+	if err := os.WriteFile(exe, []byte("old binary"), 0o700); err != nil { // nolint: gosec
+		t.Fatal(err)
+	}
+	return exe
+}
+
+func TestInstallRelease(t *testing.T) {
+	r := newTestRelease(t)
+	got, err := latestRelease(r.server.Client(), r.server.URL+"/latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TagName != "v1.2.0" || len(got.Assets) != 3 {
+		t.Errorf("latestRelease = %+v", got)
+	}
+
+	exe := testExecutable(t)
+	if err := installRelease(r.server.Client(), got, exe); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(exe); string(b) != "new binary" { // nolint: gosec
+		t.Errorf("the binary is %q after the update", b)
+	}
+}
+
+func TestInstallReleaseVerification(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(r *testRelease)
+		want   string
+	}{
+		{
+			"tampered archive",
+			func(r *testRelease) {
+				for name, b := range r.assets {
+					if name != checksumsAsset && name != signatureAsset {
+						r.assets[name] = append(b, 0)
+					}
+				}
+			},
+			"but checksums.txt lists",
+		},
+		{
+			"tampered checksums",
+			func(r *testRelease) { r.assets[checksumsAsset] = append(r.assets[checksumsAsset], '\n') },
+			"signature of checksums.txt in release v1.2.0 is not valid",
+		},
+		{
+			"signed with another key",
+			func(r *testRelease) {
+				_, other, _ := ed25519.GenerateKey(nil)
+				r.assets[signatureAsset] = ed25519.Sign(other, r.assets[checksumsAsset])
+			},
+			"is not valid",
+		},
+		{
+			"no signature",
+			func(r *testRelease) {
+				var assets []releaseAsset
+				for _, a := range r.release.Assets {
+					if a.Name != signatureAsset {
+						assets = append(assets, a)
+					}
+				}
+				r.release.Assets = assets
+			},
+			"has no checksums.txt.sig",
+		},
+		{
+			"no key in the build",
+			func(*testRelease) { releaseSigningKey = "" },
+			"no release signing key",
+		},
+		{
+			"invalid key in the build",
+			func(*testRelease) { releaseSigningKey = "c2hvcnQ=" },
+			"invalid release signing key",
+		},
+	}
+	for _, test := range tests {
+		r := newTestRelease(t)
+		test.change(r)
+		exe := testExecutable(t)
+		err := installRelease(r.server.Client(), r.release, exe)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.want)
+		}
+		if b, _ := os.ReadFile(exe); string(b) != "old binary" { // nolint: gosec
+			t.Errorf("%s: the binary was replaced", test.name)
+		}
+	}
+}
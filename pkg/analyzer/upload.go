@@ -0,0 +1,108 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const uploadTimeout = 10 * time.Minute
+
+// uploadResponse is the body returned by the intake endpoint on success.
+type uploadResponse struct {
+	URL string `json:"url"`
+}
+
+// checkUploadURL returns an error if uploadURL is not an https URL, so
+// that the archive is never uploaded in plaintext.
+func checkUploadURL(uploadURL string) error {
+	u, err := url.Parse(uploadURL)
+	if err != nil {
+		return errors.Wrap(err, "error parsing --upload-url")
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("--upload-url %s is not an https URL", uploadURL)
+	}
+	return nil
+}
+
+// uploadArchive POSTs the archive at path to uploadURL as a multipart form
+// and returns the reference URL from the response. The archive is streamed
+// rather than read into memory.
+func uploadArchive(uploadURL, path, ticket string) (string, error) {
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return "", errors.Wrap(err, "error opening archive for upload")
+	}
+	defer f.Close()
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeUploadForm(mw, f, filepath.Base(path), ticket))
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, uploadURL, pr) // nolint: noctx
+	if err != nil {
+		_ = pr.Close()
+		return "", errors.Wrap(err, "error creating upload request")
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("User-Agent", os.Args[0])
+
+	client := &http.Client{Timeout: uploadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "error uploading archive")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", errors.Wrap(err, "error reading upload response")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", errors.Errorf("upload failed with %s: %s", resp.Status, body)
+	}
+
+	var ur uploadResponse
+	err = json.Unmarshal(body, &ur)
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding upload response")
+	}
+	return ur.URL, nil
+}
+
+func writeUploadForm(mw *multipart.Writer, archive io.Reader, name, ticket string) error {
+	if ticket != "" {
+		err := mw.WriteField("ticket", ticket)
+		if err != nil {
+			return errors.Wrap(err, "error writing ticket field")
+		}
+	}
+	w, err := mw.CreateFormFile("archive", name)
+	if err != nil {
+		return errors.Wrap(err, "error creating archive field")
+	}
+	_, err = io.Copy(w, archive)
+	if err != nil {
+		return errors.Wrap(err, "error writing archive field")
+	}
+	return errors.Wrap(mw.Close(), "error closing form")
+}
+
+func printUploadResult(w io.Writer, url string) {
+	if url == "" {
+		fmt.Fprintln(w, "Archive uploaded to MaxMind support")
+		return
+	}
+	fmt.Fprintf(w, "Archive uploaded to MaxMind support. Reference: %s\n", url)
+}
@@ -0,0 +1,85 @@
+package analyzer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestArchive(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mm-network-analysis-test.zip")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUploadArchive(t *testing.T) {
+	path := writeTestArchive(t, "archive contents")
+
+	var ticket, name, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		ticket = r.FormValue("ticket")
+		f, header, err := r.FormFile("archive")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer f.Close()
+		name = header.Filename
+		b, _ := io.ReadAll(f)
+		body = string(b)
+		_, _ = io.WriteString(w, `{"url":"https://example.com/ref/1"}`)
+	}))
+	defer server.Close()
+
+	url, err := uploadArchive(server.URL, path, "TICKET-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://example.com/ref/1" {
+		t.Errorf("url = %q", url)
+	}
+	if ticket != "TICKET-1" || name != filepath.Base(path) || body != "archive contents" {
+		t.Errorf("got ticket %q, name %q, and body %q", ticket, name, body)
+	}
+}
+
+func TestUploadArchiveError(t *testing.T) {
+	path := writeTestArchive(t, "archive contents")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "too large", http.StatusRequestEntityTooLarge)
+	}))
+	defer server.Close()
+
+	_, err := uploadArchive(server.URL, path, "")
+	if err == nil || !strings.Contains(err.Error(), "413") || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("err = %v, want the status and body", err)
+	}
+}
+
+func TestCheckUploadURL(t *testing.T) {
+	if err := checkUploadURL("https://upload.example.com/intake?token=1"); err != nil {
+		t.Error(err)
+	}
+	for _, uploadURL := range []string{
+		"http://upload.example.com/intake",
+		"HTTP://upload.example.com/intake",
+		"ftp://upload.example.com/intake",
+		"upload.example.com/intake",
+		"https:///intake",
+		"",
+	} {
+		if err := checkUploadURL(uploadURL); err == nil {
+			t.Errorf("checkUploadURL(%q) succeeded", uploadURL)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package analyzer
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// These are set at build time with -ldflags, e.g.,
+// -X github.com/maxmind/mm-network-analyzer/pkg/analyzer.version=1.1.0.
+// .goreleaser.yml sets them.
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// buildInfo identifies the build of the analyzer that produced an archive.
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// currentBuild returns the build information, falling back to that
+// recorded by the Go toolchain for builds without -ldflags, e.g., from
+// go install.
+func currentBuild() buildInfo {
+	b := buildInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	if b.Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		b.Version = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if b.Commit == "" {
+				b.Commit = s.Value
+			}
+		case "vcs.time":
+			if b.Date == "" {
+				b.Date = s.Value
+			}
+		}
+	}
+	return b
+}
+
+func (b buildInfo) String() string {
+	s := "mm-network-analyzer " + b.Version
+	if b.Commit != "" {
+		s += " (commit " + b.Commit
+		if b.Date != "" {
+			s += ", built " + b.Date
+		}
+		s += ")"
+	}
+	return fmt.Sprintf("%s %s %s", s, b.GoVersion, b.Platform)
+}
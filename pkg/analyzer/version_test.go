@@ -0,0 +1,55 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+)
+
+// setBuild sets the variables normally set with -ldflags for the duration
+// of the test.
+func setBuild(t *testing.T, v, c, d string) {
+	t.Helper()
+	oldVersion, oldCommit, oldDate := version, commit, date
+	t.Cleanup(func() { version, commit, date = oldVersion, oldCommit, oldDate })
+	version, commit, date = v, c, d
+}
+
+func TestCurrentBuild(t *testing.T) {
+	setBuild(t, "1.2.0", "abc123", "2024-01-02T03:04:05Z")
+	b := currentBuild()
+	want := buildInfo{
+		Version:   "1.2.0",
+		Commit:    "abc123",
+		Date:      "2024-01-02T03:04:05Z",
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if b != want {
+		t.Errorf("currentBuild = %+v, want %+v", b, want)
+	}
+	if got, want := b.String(), "mm-network-analyzer 1.2.0 (commit abc123, built 2024-01-02T03:04:05Z) "+
+		runtime.Version()+" "+runtime.GOOS+"/"+runtime.GOARCH; got != want {
+		t.Errorf("String = %q, want %q", got, want)
+	}
+}
+
+func TestCurrentBuildWithoutLDFlags(t *testing.T) {
+	setBuild(t, "dev", "", "")
+	// Test binaries have no module version or VCS information.
+	if b := currentBuild(); b.Version != "dev" || b.GoVersion == "" {
+		t.Errorf("currentBuild = %+v", b)
+	}
+
+	b := buildInfo{Version: "dev", GoVersion: "go1.25.0", Platform: "linux/amd64"}
+	if got := b.String(); got != "mm-network-analyzer dev go1.25.0 linux/amd64" {
+		t.Errorf("String = %q", got)
+	}
+	j, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(j); got != `{"version":"dev","go_version":"go1.25.0","platform":"linux/amd64"}` {
+		t.Errorf("JSON = %s", got)
+	}
+}
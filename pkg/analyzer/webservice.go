@@ -0,0 +1,100 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// webServiceURL looks up the address the request comes from in the GeoIP2
+// City web service.
+var webServiceURL = "https://" + defaultHost + "/geoip/v2.1/city/me"
+
+// webServiceReport is the result of looking up this machine's own address
+// in the GeoIP2 City web service.
+type webServiceReport struct {
+	URL        string  `json:"url"`
+	StatusCode int     `json:"status_code,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+	// IP is the address the web service saw the request come from.
+	IP string `json:"ip,omitempty"`
+	// Code is the error code in the body of an error response, e.g.,
+	// AUTHORIZATION_INVALID.
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// addWebService looks up this machine's address in the GeoIP2 City web
+// service with the given credentials, verifying them and the path to the
+// web service end to end, and writes the response to geoip-city.json.
+func (a *analyzer) addWebService(ctx context.Context) {
+	r := &webServiceReport{URL: webServiceURL}
+	defer a.storeResult("geoip-web-service", r)
+
+	var body []byte
+	err := a.retry(ctx, "GET "+webServiceURL, func() error {
+		var err error
+		body, err = a.getWebService(ctx, r)
+		return err
+	})
+	if err != nil {
+		a.storeError(ctx, err)
+		r.Error = err.Error()
+		return
+	}
+	a.storeFile("geoip-city.json", body)
+
+	var parsed struct {
+		Code   string `json:"code"`
+		Error  string `json:"error"`
+		Traits struct {
+			IPAddress string `json:"ip_address"`
+		} `json:"traits"`
+	}
+	// An error response from a proxy may not be JSON.
+	_ = json.Unmarshal(body, &parsed)
+	r.IP = parsed.Traits.IPAddress
+	r.Code = parsed.Code
+	if r.StatusCode != http.StatusOK {
+		err = httpStatusErrorf(r.StatusCode, "web service returned HTTP %d", r.StatusCode)
+		if parsed.Error != "" {
+			err = httpStatusErrorf(
+				r.StatusCode, "web service returned HTTP %d: %s (%s)", r.StatusCode, parsed.Error, parsed.Code,
+			)
+		}
+		a.storeError(ctx, err)
+		r.Error = err.Error()
+	}
+}
+
+// getWebService makes the web service request, filling in r's status and
+// duration, and returns the response body. Error responses are not
+// retried, so they are not returned as errors.
+func (a *analyzer) getWebService(ctx context.Context, r *webServiceReport) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, webServiceURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating web service request")
+	}
+	req.SetBasicAuth(a.credentials.accountID, a.credentials.licenseKey)
+	req.Header.Set("User-Agent", os.Args[0])
+
+	start := time.Now()
+	resp, err := a.dial.httpClient().Do(req)
+	if err != nil {
+		r.DurationMS = durationMS(time.Since(start))
+		return nil, errors.Wrap(err, "error making web service request")
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	r.DurationMS = durationMS(time.Since(start))
+	r.StatusCode = resp.StatusCode
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading web service response")
+	}
+	return body, nil
+}
@@ -0,0 +1,78 @@
+package analyzer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveWebService points webServiceURL at handler for the duration of the
+// test.
+func serveWebService(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	url := webServiceURL
+	webServiceURL = server.URL + "/geoip/v2.1/city/me"
+	t.Cleanup(func() { webServiceURL = url })
+}
+
+func TestAddWebService(t *testing.T) {
+	serveWebService(t, func(w http.ResponseWriter, r *http.Request) {
+		if id, key, ok := r.BasicAuth(); !ok || id != "42" || key != "testlicensekey" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(
+				`{"code":"AUTHORIZATION_INVALID","error":"Your account ID or license key is invalid."}`,
+			))
+			return
+		}
+		_, _ = w.Write([]byte(`{"city":{"names":{"en":"Milton"}},"traits":{"ip_address":"216.160.83.56"}}`))
+	})
+
+	a := &analyzer{credentials: &credentials{accountID: "42", licenseKey: "testlicensekey"}}
+	defer a.removeSpool()
+	a.addWebService(context.Background())
+	r, ok := a.results["geoip-web-service"].(*webServiceReport)
+	if !ok || r.StatusCode != http.StatusOK || r.IP != "216.160.83.56" || r.Error != "" || r.URL != webServiceURL {
+		t.Fatalf("report = %#v", a.results["geoip-web-service"])
+	}
+	if !strings.Contains(string(storedContents(t, a, "geoip-city.json")), "Milton") {
+		t.Error("the response was not stored")
+	}
+	if fs := findingsFor(map[string]interface{}{"geoip-web-service": r}); len(fs) != 0 {
+		t.Errorf("findings = %v", findingChecks(fs))
+	}
+
+	a = &analyzer{credentials: &credentials{accountID: "42", licenseKey: "wrong"}}
+	defer a.removeSpool()
+	a.addWebService(context.Background())
+	r = a.results["geoip-web-service"].(*webServiceReport)
+	want := "web service returned HTTP 401: Your account ID or license key is invalid. (AUTHORIZATION_INVALID)"
+	if r.StatusCode != http.StatusUnauthorized || r.Code != "AUTHORIZATION_INVALID" || r.Error != want {
+		t.Errorf("report = %+v", r)
+	}
+	if !a.hasErrors() {
+		t.Error("the error was not recorded")
+	}
+	fs := findingsFor(map[string]interface{}{"geoip-web-service": r})
+	if len(fs) != 1 || fs[0].Check != "web-service-failure" {
+		t.Errorf("findings = %v", findingChecks(fs))
+	}
+}
+
+func TestAddWebServiceNotJSON(t *testing.T) {
+	// A proxy's error page is not JSON.
+	serveWebService(t, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "<html>Access denied</html>", http.StatusForbidden)
+	})
+
+	a := &analyzer{credentials: &credentials{accountID: "42", licenseKey: "testlicensekey"}}
+	defer a.removeSpool()
+	a.addWebService(context.Background())
+	r := a.results["geoip-web-service"].(*webServiceReport)
+	if r.StatusCode != http.StatusForbidden || r.Code != "" || r.Error != "web service returned HTTP 403" {
+		t.Errorf("report = %+v", r)
+	}
+}
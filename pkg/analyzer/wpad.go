@@ -0,0 +1,149 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// pacMaxSize bounds the size of a PAC file that is fetched.
+const pacMaxSize = 1 << 20
+
+// pacReport is the result of looking for a proxy auto-config file and
+// evaluating it for each MaxMind endpoint.
+type pacReport struct {
+	Candidates []*pacCandidate `json:"candidates"`
+	// URL is the PAC file that was evaluated, if one was found.
+	URL       string         `json:"url,omitempty"`
+	Decisions []*pacDecision `json:"decisions,omitempty"`
+}
+
+// pacCandidate is a location a PAC file was looked for. Source is "system"
+// for the configured URL and "wpad" for one found by WPAD over DNS.
+type pacCandidate struct {
+	Source string `json:"source"`
+	URL    string `json:"url"`
+	Found  bool   `json:"found"`
+	Error  string `json:"error,omitempty"`
+}
+
+// pacDecision is the result of FindProxyForURL for an endpoint, e.g.,
+// "PROXY proxy.example.com:8080; DIRECT".
+type pacDecision struct {
+	URL    string `json:"url"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// addPAC looks for a PAC file in the system proxy settings and through
+// WPAD over DNS, stores the first one found as proxy.pac, and writes the
+// proxy it selects for each MaxMind endpoint to wpad.json.
+func (a *analyzer) addPAC(ctx context.Context) {
+	r := &pacReport{}
+	var candidates []*pacCandidate
+	if u, err := systemPACURL(ctx); err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error getting the system PAC URL"))
+	} else if u != "" {
+		candidates = append(candidates, &pacCandidate{Source: "system", URL: u})
+	}
+	for _, domain := range wpadDomains() {
+		candidates = append(candidates, &pacCandidate{Source: "wpad", URL: "http://wpad." + domain + "/wpad.dat"})
+	}
+
+	var pac []byte
+	for _, c := range candidates {
+		r.Candidates = append(r.Candidates, c)
+		body, err := fetchPAC(ctx, c.URL)
+		if err != nil {
+			c.Error = err.Error()
+			continue
+		}
+		c.Found = true
+		r.URL = c.URL
+		pac = body
+		break
+	}
+
+	if pac != nil {
+		a.storeFile("proxy.pac", pac)
+		for _, host := range maxmindEndpoints {
+			d := &pacDecision{URL: "https://" + host + "/"}
+			var err error
+			d.Result, err = evaluatePAC(ctx, string(pac), d.URL, host)
+			if err != nil {
+				d.Error = err.Error()
+			}
+			r.Decisions = append(r.Decisions, d)
+		}
+	}
+
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		a.storeError(ctx, errors.Wrap(err, "error encoding wpad.json"))
+		return
+	}
+	a.storeFile("wpad.json", b)
+	a.storeResult("wpad", r)
+}
+
+// wpadDomains returns the domains WPAD looks for wpad.<domain> in: the
+// search domains and this machine's domain, and each of their parents
+// short of the top-level domain.
+func wpadDomains() []string {
+	var bases []string
+	if conf, err := dns.ClientConfigFromFile(resolvConfPath); err == nil {
+		bases = append(bases, conf.Search...)
+	}
+	if h, err := os.Hostname(); err == nil {
+		if _, domain, ok := strings.Cut(h, "."); ok {
+			bases = append(bases, domain)
+		}
+	}
+
+	var domains []string
+	seen := map[string]bool{}
+	for _, base := range bases {
+		labels := dns.SplitDomainName(base)
+		for i := 0; i < len(labels)-1; i++ {
+			d := strings.ToLower(strings.Join(labels[i:], "."))
+			if !seen[d] {
+				seen[d] = true
+				domains = append(domains, d)
+			}
+		}
+	}
+	return domains
+}
+
+// fetchPAC fetches a PAC file directly, as clients do.
+func fetchPAC(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, endpointTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating PAC request")
+	}
+	client := &http.Client{Transport: &http.Transport{Proxy: nil, DialContext: dialConfigFromContext(ctx).dialContext}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting PAC file")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpStatusErrorf(resp.StatusCode, "unexpected PAC response status: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, pacMaxSize))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading PAC file")
+	}
+	if !strings.Contains(string(body), "FindProxyForURL") {
+		return nil, errors.New("response is not a PAC file")
+	}
+	return body, nil
+}
@@ -0,0 +1,38 @@
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// systemPACURL returns the PAC URL in the system proxy settings, or "" if
+// there is none.
+func systemPACURL(ctx context.Context) (string, error) {
+	out, err := commandContext(ctx, "scutil", "--proxy").Output()
+	if err != nil {
+		return "", errors.Wrap(err, "error running scutil --proxy")
+	}
+	var url string
+	enabled := false
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		k, v, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(k) {
+		case "ProxyAutoConfigEnable":
+			enabled = strings.TrimSpace(v) == "1"
+		case "ProxyAutoConfigURLString":
+			url = strings.TrimSpace(v)
+		}
+	}
+	if !enabled {
+		return "", nil
+	}
+	return url, nil
+}
@@ -0,0 +1,26 @@
+//go:build !darwin && !windows
+
+package analyzer
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+)
+
+// systemPACURL returns the PAC URL in the GNOME proxy settings, or "" if
+// there is none or GNOME is not in use.
+func systemPACURL(ctx context.Context) (string, error) {
+	if _, err := exec.LookPath("gsettings"); err != nil {
+		return "", nil
+	}
+	mode, err := commandContext(ctx, "gsettings", "get", "org.gnome.system.proxy", "mode").Output()
+	if err != nil || strings.Trim(strings.TrimSpace(string(mode)), "'") != "auto" {
+		return "", nil
+	}
+	url, err := commandContext(ctx, "gsettings", "get", "org.gnome.system.proxy", "autoconfig-url").Output()
+	if err != nil {
+		return "", nil
+	}
+	return strings.Trim(strings.TrimSpace(string(url)), "'"), nil
+}
@@ -0,0 +1,33 @@
+package analyzer
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows/registry"
+)
+
+// systemPACURL returns the PAC URL in the current user's Internet Settings,
+// or "" if there is none.
+func systemPACURL(context.Context) (string, error) {
+	k, err := registry.OpenKey(
+		registry.CURRENT_USER,
+		`Software\Microsoft\Windows\CurrentVersion\Internet Settings`,
+		registry.QUERY_VALUE,
+	)
+	if err == registry.ErrNotExist {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "error opening the Internet Settings registry key")
+	}
+	defer k.Close()
+	url, _, err := k.GetStringValue("AutoConfigURL")
+	if err == registry.ErrNotExist {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "error reading AutoConfigURL")
+	}
+	return url, nil
+}